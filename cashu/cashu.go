@@ -11,8 +11,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/bits"
+	"slices"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/crypto"
 	"github.com/fxamacker/cbor/v2"
 )
 
@@ -20,20 +23,57 @@ type Unit int
 
 const (
 	Sat Unit = iota
+	Msat
+	Usd
+	Eur
 
 	BOLT11_METHOD     = "bolt11"
+	KEYSEND_METHOD    = "keysend"
 	MAX_SECRET_LENGTH = 512
+	// keysets have keys for amounts 2^0 to 2^(MAX_ORDER-1)
+	MAX_ORDER = crypto.MAX_ORDER
+
+	// header with the mint's signature of the response body
+	// for the info and keys endpoints
+	SIGNATURE_HEADER = "X-Cashu-Signature"
 )
 
 func (unit Unit) String() string {
 	switch unit {
 	case Sat:
 		return "sat"
+	case Msat:
+		return "msat"
+	case Usd:
+		return "usd"
+	case Eur:
+		return "eur"
 	default:
 		return "unknown"
 	}
 }
 
+// UnitFromString returns the Unit for the string. It returns ErrInvalidUnit if not known
+func UnitFromString(unit string) (Unit, error) {
+	switch unit {
+	case "sat":
+		return Sat, nil
+	case "msat":
+		return Msat, nil
+	case "usd":
+		return Usd, nil
+	case "eur":
+		return Eur, nil
+	default:
+		return 0, ErrInvalidUnit
+	}
+}
+
+func (unit Unit) valid() bool {
+	_, err := UnitFromString(unit.String())
+	return err == nil
+}
+
 var (
 	ErrInvalidTokenV3  = errors.New("invalid V3 token")
 	ErrInvalidTokenV4  = errors.New("invalid V4 token")
@@ -197,21 +237,27 @@ type TokenV3Proof struct {
 }
 
 func NewTokenV3(proofs Proofs, mint string, unit Unit, includeDLEQ bool) (TokenV3, error) {
-	if !includeDLEQ {
-		for i := 0; i < len(proofs); i++ {
-			proofs[i].DLEQ = nil
-		}
+	if !unit.valid() {
+		return TokenV3{}, ErrInvalidUnit
 	}
 
-	if unit != Sat {
-		return TokenV3{}, ErrInvalidUnit
+	// copy so that DLEQ proofs are not removed from the proofs passed
+	tokenProofs := make(Proofs, len(proofs))
+	copy(tokenProofs, proofs)
+	if !includeDLEQ {
+		for i := 0; i < len(tokenProofs); i++ {
+			tokenProofs[i].DLEQ = nil
+		}
 	}
 
-	tokenProof := TokenV3Proof{Mint: mint, Proofs: proofs}
+	tokenProof := TokenV3Proof{Mint: mint, Proofs: tokenProofs}
 	return TokenV3{Token: []TokenV3Proof{tokenProof}, Unit: unit.String()}, nil
 }
 
 func DecodeTokenV3(tokenstr string) (*TokenV3, error) {
+	if len(tokenstr) < 6 {
+		return nil, ErrInvalidTokenV3
+	}
 	prefixVersion := tokenstr[:6]
 	base64Token := tokenstr[6:]
 
@@ -332,10 +378,13 @@ func (d *DLEQV4) MarshalJSON() ([]byte, error) {
 }
 
 func NewTokenV4(proofs Proofs, mint string, unit Unit, includeDLEQ bool) (TokenV4, error) {
-	if unit != Sat {
+	if !unit.valid() {
 		return TokenV4{}, ErrInvalidUnit
 	}
 
+	// keep keysets in the order they first appear in the proofs
+	// so that the order of the proofs is preserved when decoded
+	var keysetIds []string
 	proofsMap := make(map[string][]ProofV4)
 	for _, proof := range proofs {
 		C, err := hex.DecodeString(proof.C)
@@ -377,25 +426,28 @@ func NewTokenV4(proofs Proofs, mint string, unit Unit, includeDLEQ bool) (TokenV
 				proofV4.DLEQ = dleq
 			}
 		}
+		if _, ok := proofsMap[proof.Id]; !ok {
+			keysetIds = append(keysetIds, proof.Id)
+		}
 		proofsMap[proof.Id] = append(proofsMap[proof.Id], proofV4)
 	}
 
-	proofsV4 := make([]TokenV4Proof, len(proofsMap))
-	i := 0
-	for k, v := range proofsMap {
-		keysetIdBytes, err := hex.DecodeString(k)
+	proofsV4 := make([]TokenV4Proof, len(keysetIds))
+	for i, id := range keysetIds {
+		keysetIdBytes, err := hex.DecodeString(id)
 		if err != nil {
 			return TokenV4{}, fmt.Errorf("invalid keyset id: %v", err)
 		}
-		proofV4 := TokenV4Proof{Id: keysetIdBytes, Proofs: v}
-		proofsV4[i] = proofV4
-		i++
+		proofsV4[i] = TokenV4Proof{Id: keysetIdBytes, Proofs: proofsMap[id]}
 	}
 
 	return TokenV4{MintURL: mint, Unit: unit.String(), TokenProofs: proofsV4}, nil
 }
 
 func DecodeTokenV4(tokenstr string) (*TokenV4, error) {
+	if len(tokenstr) < 6 {
+		return nil, ErrInvalidTokenV4
+	}
 	prefixVersion := tokenstr[:6]
 	base64Token := tokenstr[6:]
 	if prefixVersion != "cashuB" {
@@ -470,7 +522,11 @@ func (t TokenV4) Serialize() (string, error) {
 
 type CashuErrCode int
 
-// Error represents an error to be returned by the mint
+// Error represents an error to be returned by the mint.
+// The code is one of the error codes defined in the NUTs
+// https://github.com/cashubtc/nuts/blob/main/error_codes.md
+// so that errors can be identified by their code regardless of
+// the detail message of the mint that returned them.
 type Error struct {
 	Detail string       `json:"detail"`
 	Code   CashuErrCode `json:"code"`
@@ -484,6 +540,68 @@ func (e Error) Error() string {
 	return e.Detail
 }
 
+// Is reports whether target is a cashu Error, or pointer to one, with the same code.
+// Errors defined in gonuts also need the same detail to match, since some of
+// them share a code, as do codes that do not identify a specific error, like
+// StandardErrCode. Errors from other mints, with their own detail, match by code.
+func (e Error) Is(target error) bool {
+	var t Error
+	switch err := target.(type) {
+	case Error:
+		t = err
+	case *Error:
+		if err == nil {
+			return false
+		}
+		t = *err
+	default:
+		return false
+	}
+
+	if e.Code != t.Code {
+		return false
+	}
+	if e.Code.generic() || (e.defined() && t.defined()) {
+		return e.Detail == t.Detail
+	}
+	return true
+}
+
+// definedErrors has the errors defined in gonuts
+var definedErrors = make(map[Error]bool)
+
+// DefineErrors adds errs to the errors defined in gonuts
+// so that errors.Is tells them apart by their detail.
+// It is meant to be called from init.
+func DefineErrors(errs ...Error) {
+	for _, err := range errs {
+		definedErrors[err] = true
+	}
+}
+
+func (e Error) defined() bool {
+	return definedErrors[e]
+}
+
+// As allows errors.As to find a cashu Error with a target of type **Error
+// when the error is an Error value instead of a pointer
+func (e Error) As(target any) bool {
+	if t, ok := target.(**Error); ok {
+		*t = &Error{Detail: e.Detail, Code: e.Code}
+		return true
+	}
+	return false
+}
+
+// generic returns true for codes that are shared by different errors
+func (code CashuErrCode) generic() bool {
+	switch code {
+	case 0, StandardErrCode, DBErrCode, LightningBackendErrCode, MeltQuoteErrCode:
+		return true
+	}
+	return false
+}
+
 // Common error codes
 const (
 	StandardErrCode CashuErrCode = 10000
@@ -504,6 +622,7 @@ const (
 	AmountLimitExceeded            CashuErrCode = 11006
 	DuplicateInputErrCode          CashuErrCode = 11007
 	DuplicateOutputErrCode         CashuErrCode = 11008
+	AmountBelowMinimumErrCode      CashuErrCode = 11015
 
 	UnknownKeysetErrCode  CashuErrCode = 12001
 	InactiveKeysetErrCode CashuErrCode = 12002
@@ -533,6 +652,7 @@ var (
 	MintQuoteAlreadyIssued       = Error{Detail: "quote already issued", Code: MintQuoteAlreadyIssuedErrCode}
 	MintingDisabled              = Error{Detail: "minting is disabled", Code: MintingDisabledErrCode}
 	MintAmountExceededErr        = Error{Detail: "max amount for minting exceeded", Code: AmountLimitExceeded}
+	MintAmountBelowMinErr        = Error{Detail: "amount is below min amount for minting", Code: AmountBelowMinimumErrCode}
 	MintQuoteInvalidSigErr       = Error{Detail: "Mint quote with pubkey but no valid signature provided.", Code: MintQuoteInvalidSigErrCode}
 	OutputsOverQuoteAmountErr    = Error{Detail: "sum of the output amounts is greater than quote amount", Code: StandardErrCode}
 	ProofAlreadyUsedErr          = Error{Detail: "proof already used", Code: ProofAlreadyUsedErrCode}
@@ -547,7 +667,9 @@ var (
 	LightningPaymentFailed       = Error{Detail: "Lightning payment failed", Code: LightningPaymentErrCode}
 	MeltQuoteAlreadyPaid         = Error{Detail: "quote already paid", Code: MeltQuoteAlreadyPaidErrCode}
 	MeltAmountExceededErr        = Error{Detail: "max amount for melting exceeded", Code: AmountLimitExceeded}
+	MeltAmountBelowMinErr        = Error{Detail: "amount is below min amount for melting", Code: AmountBelowMinimumErrCode}
 	MeltQuoteForRequestExists    = Error{Detail: "melt quote for payment request already exists", Code: MeltQuoteErrCode}
+	LightningBackendUnavailable  = Error{Detail: "lightning backend is temporarily unavailable", Code: StandardErrCode}
 	InsufficientProofsAmount     = Error{
 		Detail: "amount of input proofs is below amount needed for transaction",
 		Code:   InsufficientProofAmountErrCode,
@@ -555,6 +677,35 @@ var (
 	InactiveKeysetSignatureRequest = Error{Detail: "requested signature from inactive keyset", Code: InactiveKeysetErrCode}
 )
 
+func init() {
+	DefineErrors(
+		UnknownKeysetErr,
+		PaymentMethodNotSupportedErr,
+		UnitNotSupportedErr,
+		BlindedMessageAlreadySigned,
+		MintQuoteRequestNotPaid,
+		MintQuoteAlreadyIssued,
+		MintingDisabled,
+		MintAmountExceededErr,
+		MintAmountBelowMinErr,
+		MintQuoteInvalidSigErr,
+		ProofAlreadyUsedErr,
+		ProofPendingErr,
+		InvalidProofErr,
+		SecretTooLongErr,
+		NoProofsProvided,
+		DuplicateProofs,
+		DuplicateOutputs,
+		QuotePending,
+		LightningPaymentFailed,
+		MeltQuoteAlreadyPaid,
+		MeltAmountExceededErr,
+		MeltAmountBelowMinErr,
+		InsufficientProofsAmount,
+		InactiveKeysetSignatureRequest,
+	)
+}
+
 // Given an amount, it returns list of amounts e.g 13 -> [1, 4, 8]
 // that can be used to build blinded messages or split operations.
 // from nutshell implementation
@@ -569,28 +720,77 @@ func AmountSplit(amount uint64) []uint64 {
 	return rv
 }
 
+// AmountSplitTargeting returns a split for the amount that includes, in ascending
+// order of amount, as many of the amounts in targetCounts as fit in it.
+// targetCounts maps an amount to the number of proofs of that amount wanted.
+// What is left that does not fit is split with AmountSplit.
+// The split returned is sorted.
+func AmountSplitTargeting(amount uint64, targetCounts map[uint64]int) []uint64 {
+	targetAmounts := make([]uint64, 0, len(targetCounts))
+	for targetAmount := range targetCounts {
+		targetAmounts = append(targetAmounts, targetAmount)
+	}
+	slices.Sort(targetAmounts)
+
+	var split []uint64
+	remaining := amount
+	for _, targetAmount := range targetAmounts {
+		if targetAmount == 0 {
+			continue
+		}
+		for i := 0; i < targetCounts[targetAmount] && targetAmount <= remaining; i++ {
+			split = append(split, targetAmount)
+			remaining -= targetAmount
+		}
+		if targetAmount > remaining {
+			break
+		}
+	}
+	split = append(split, AmountSplit(remaining)...)
+	slices.Sort(split)
+
+	return split
+}
+
+// BlankOutputsCount returns the number of blank outputs to include in
+// a melt request to get back the change from overpaid fees. This is
+// max(ceil(log2(feeReserve)), 1) as explained in NUT-08 https://github.com/cashubtc/nuts/blob/main/08.md
+// or 0 if there is no fee reserve.
+func BlankOutputsCount(feeReserve uint64) int {
+	if feeReserve == 0 {
+		return 0
+	}
+	// ceil(log2(x)) is the bit length of x-1
+	return max(bits.Len64(feeReserve-1), 1)
+}
+
+// CheckDuplicateProofs returns true if there are proofs with the same secret.
+// Proofs are compared by secret (and so by Y) regardless of the other fields
+// so that the same proof with e.g a different witness is still caught.
 func CheckDuplicateProofs(proofs Proofs) bool {
-	proofsMap := make(map[Proof]bool)
+	secrets := make(map[string]bool)
 
 	for _, proof := range proofs {
-		if proofsMap[proof] {
+		if secrets[proof.Secret] {
 			return true
 		} else {
-			proofsMap[proof] = true
+			secrets[proof.Secret] = true
 		}
 	}
 
 	return false
 }
 
+// CheckDuplicateBlindedMessages returns true if there are blinded messages with the same B_.
+// Blinded messages are compared by B_ regardless of amount, keyset id or witness.
 func CheckDuplicateBlindedMessages(bms BlindedMessages) bool {
-	bmMap := make(map[BlindedMessage]bool)
+	B_s := make(map[string]bool)
 
 	for _, bm := range bms {
-		if bmMap[bm] {
+		if B_s[bm.B_] {
 			return true
 		} else {
-			bmMap[bm] = true
+			B_s[bm.B_] = true
 		}
 	}
 
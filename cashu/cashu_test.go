@@ -2,10 +2,18 @@ package cashu
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"math"
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/crypto"
 )
 
 func TestAmountChecked(t *testing.T) {
@@ -482,3 +490,647 @@ func TestSerializeTokenV3(t *testing.T) {
 		}
 	}
 }
+
+func tokenRoundTripProofs() Proofs {
+	return Proofs{
+		{
+			Amount:  1,
+			Id:      "009a1f293253e41e",
+			Secret:  `["P2PK",{"nonce":"5d11913ee0f92fefdc82a6764fd2457a","data":"026562efcfadc8e86d44da6a8adf80633d974302e62c850774db1fb36ff4cc7198","tags":[["sigflag","SIG_INPUTS"]]}]`,
+			C:       "02698c4e2b5f9534cd0687d87513c759790cf829aa5739184a3e3735471fbda904",
+			Witness: `{"signatures":["60f3c9b766770b46caac1d27e1ae6b77c8866ebaeba0b9489fe6a15a837eaa6fcd6eaa825499c72ac342983983fd3ba3a8a41f56677cc99ffd73da68b59e1383"]}`,
+			DLEQ: &DLEQProof{
+				E: "b31e58ac6527f34975ffab13e70a48b6d2b0d35abc4b03f0151f09ee1a9763d4",
+				S: "8fbae004c59e754d71df67e392b6ae4e29293113ddc2ec86592a0431d16306d8",
+				R: "a6d13fcd7a18442e6076f5e1e7c887ad5de40a019824bdfa9fe740d302e8d861",
+			},
+		},
+		{
+			Amount: 8,
+			Id:     "009a1f293253e41e",
+			Secret: "fe15109314e61d7756b0f8ee0f23a624acaa3f4e042f61433c728c7057b931be",
+			C:      "029e8e5050b890a7d6c0968db16bc1d5d5fa040ea1de284f6ec69d61299f671059",
+		},
+		{
+			Amount: 2,
+			Id:     "00ad268c4d1f5826",
+			Secret: "407915bc212be61a77e3e6d2aeb4c727980bda51cd06a6afc29e2861768a7837",
+			C:      "02bc9097997d81afb2cc7346b5e4345a9346bd2a506eb7958598a72f0cf85163ea",
+			DLEQ: &DLEQProof{
+				E: "9818e061ee51d5c8edc3342369a554998ff7b4381c8652d724cdf46429be73d9",
+				S: "9818e061ee51d5c8edc3342369a554998ff7b4381c8652d724cdf46429be73da",
+				R: "6d7e0e24b8a5d8e1c0c1bc8d6a6bdc0f41f0ccbb1a0f2c4b1c3a1c2d3e4f5a6b",
+			},
+		},
+	}
+}
+
+func TestTokenV3RoundTrip(t *testing.T) {
+	proofs := tokenRoundTripProofs()
+	mint := "http://localhost:3338"
+
+	token, err := NewTokenV3(proofs, mint, Sat, true)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	token.Memo = "thank you"
+	tokenString, err := token.Serialize()
+	if err != nil {
+		t.Fatalf("error serializing token: %v", err)
+	}
+
+	decoded, err := DecodeTokenV3(tokenString)
+	if err != nil {
+		t.Fatalf("error decoding token: %v", err)
+	}
+	if !reflect.DeepEqual(*decoded, token) {
+		t.Fatalf("expected token '%+v' but got '%+v'", token, *decoded)
+	}
+	if !reflect.DeepEqual(decoded.Proofs(), proofs) {
+		t.Fatalf("expected proofs '%+v' but got '%+v'", proofs, decoded.Proofs())
+	}
+
+	reserialized, err := decoded.Serialize()
+	if err != nil {
+		t.Fatalf("error serializing token: %v", err)
+	}
+	if reserialized != tokenString {
+		t.Fatalf("expected token '%v' but got '%v'", tokenString, reserialized)
+	}
+
+	// DLEQ proofs are left out but not removed from the proofs passed
+	token, err = NewTokenV3(proofs, mint, Sat, false)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	for _, proof := range token.Proofs() {
+		if proof.DLEQ != nil {
+			t.Fatal("expected token without DLEQ proofs")
+		}
+	}
+	if proofs[0].DLEQ == nil {
+		t.Fatal("expected DLEQ proof to not be removed from proofs passed")
+	}
+}
+
+func TestTokenV4RoundTrip(t *testing.T) {
+	proofs := tokenRoundTripProofs()
+	mint := "http://localhost:3338"
+
+	token, err := NewTokenV4(proofs, mint, Sat, true)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	token.Memo = "thank you"
+	tokenString, err := token.Serialize()
+	if err != nil {
+		t.Fatalf("error serializing token: %v", err)
+	}
+
+	decoded, err := DecodeTokenV4(tokenString)
+	if err != nil {
+		t.Fatalf("error decoding token: %v", err)
+	}
+	if decoded.Memo != "thank you" {
+		t.Fatalf("expected memo 'thank you' but got '%v'", decoded.Memo)
+	}
+	if !reflect.DeepEqual(decoded.Proofs(), proofs) {
+		t.Fatalf("expected proofs '%+v' but got '%+v'", proofs, decoded.Proofs())
+	}
+
+	reserialized, err := decoded.Serialize()
+	if err != nil {
+		t.Fatalf("error serializing token: %v", err)
+	}
+	if reserialized != tokenString {
+		t.Fatalf("expected token '%v' but got '%v'", tokenString, reserialized)
+	}
+
+	token, err = NewTokenV4(proofs, mint, Sat, false)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+	for _, proof := range token.Proofs() {
+		if proof.DLEQ != nil {
+			t.Fatal("expected token without DLEQ proofs")
+		}
+	}
+}
+
+func TestDecodeShortToken(t *testing.T) {
+	for _, tokenString := range []string{"", "cashu", "cashuB"} {
+		if _, err := DecodeToken(tokenString); err == nil {
+			t.Fatalf("expected error decoding '%v'", tokenString)
+		}
+	}
+}
+
+// signedProof returns a proof for the amount signed
+// with the keyset and with its DLEQ proof
+func signedProof(t *testing.T, keyset *crypto.MintKeyset, amount uint64, secret string) Proof {
+	r, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	B_, r, err := crypto.BlindMessage(secret, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPair := keyset.Keys[amount]
+	C_ := crypto.SignBlindedMessage(B_, keyPair.PrivateKey)
+	e, s := crypto.GenerateDLEQ(keyPair.PrivateKey, B_, C_)
+	C := crypto.UnblindSignature(C_, r, keyPair.PublicKey)
+
+	return Proof{
+		Amount: amount,
+		Id:     keyset.Id,
+		Secret: secret,
+		C:      hex.EncodeToString(C.SerializeCompressed()),
+		DLEQ: &DLEQProof{
+			E: hex.EncodeToString(e.Serialize()),
+			S: hex.EncodeToString(s.Serialize()),
+			R: hex.EncodeToString(r.Serialize()),
+		},
+	}
+}
+
+func TestVerifyTokenOffline(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(master, 0, 0, true)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	otherKeyset, err := crypto.GenerateKeyset(master, 1, 0, true)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	mintKeys := map[string]crypto.PublicKeys{keyset.Id: keyset.PublicKeys()}
+
+	proofs := Proofs{
+		signedProof(t, keyset, 2, "secret1"),
+		signedProof(t, keyset, 8, "secret2"),
+	}
+	mint := "http://localhost:3338"
+	token, _ := NewTokenV4(proofs, mint, Sat, true)
+
+	if err := VerifyTokenOffline(token, mintKeys, OfflineVerifyOptions{RequireDLEQ: true, Amount: 10}); err != nil {
+		t.Fatalf("unexpected error verifying token: %v", err)
+	}
+
+	// proof with DLEQ from a different key
+	invalidDLEQ := signedProof(t, keyset, 4, "secret3")
+	invalidDLEQ.DLEQ = signedProof(t, keyset, 4, "secret4").DLEQ
+	noDLEQ := signedProof(t, keyset, 4, "secret3")
+	noDLEQ.DLEQ = nil
+	wrongKeys := map[string]crypto.PublicKeys{keyset.Id: otherKeyset.PublicKeys()}
+
+	tests := []struct {
+		proofs      Proofs
+		mintKeys    map[string]crypto.PublicKeys
+		opts        OfflineVerifyOptions
+		expectedErr error
+	}{
+		{
+			proofs:      Proofs{invalidDLEQ},
+			mintKeys:    mintKeys,
+			expectedErr: ErrInvalidDLEQ,
+		},
+		{
+			proofs:      Proofs{noDLEQ},
+			mintKeys:    mintKeys,
+			opts:        OfflineVerifyOptions{RequireDLEQ: true},
+			expectedErr: ErrMissingDLEQ,
+		},
+		{
+			proofs:      Proofs{signedProof(t, otherKeyset, 2, "secret5")},
+			mintKeys:    mintKeys,
+			expectedErr: UnknownKeysetErr,
+		},
+		{
+			proofs:      proofs,
+			mintKeys:    wrongKeys,
+			expectedErr: ErrKeysetIdMismatch,
+		},
+		{
+			proofs:      proofs,
+			mintKeys:    mintKeys,
+			opts:        OfflineVerifyOptions{Amount: 11},
+			expectedErr: ErrTokenAmount,
+		},
+		{
+			proofs:      Proofs{proofs[0], proofs[0]},
+			mintKeys:    mintKeys,
+			expectedErr: DuplicateProofs,
+		},
+	}
+
+	for _, test := range tests {
+		token, _ := NewTokenV4(test.proofs, mint, Sat, true)
+		err := VerifyTokenOffline(token, test.mintKeys, test.opts)
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+	}
+
+	// proofs without DLEQ are accepted if not required
+	tokenV3, _ := NewTokenV3(Proofs{noDLEQ}, mint, Sat, false)
+	if err := VerifyTokenOffline(tokenV3, mintKeys, OfflineVerifyOptions{}); err != nil {
+		t.Fatalf("unexpected error verifying token: %v", err)
+	}
+}
+
+func TestCheckDuplicateProofs(t *testing.T) {
+	tests := []struct {
+		proofs            Proofs
+		expectedDuplicate bool
+	}{
+		{
+			proofs: Proofs{
+				Proof{Amount: 2, Secret: "secret1", C: "c1"},
+				Proof{Amount: 4, Secret: "secret2", C: "c2"},
+			},
+			expectedDuplicate: false,
+		},
+		{
+			proofs: Proofs{
+				Proof{Amount: 2, Secret: "secret1", C: "c1"},
+				Proof{Amount: 2, Secret: "secret1", C: "c1"},
+			},
+			expectedDuplicate: true,
+		},
+		// same secret with different witness
+		{
+			proofs: Proofs{
+				Proof{Amount: 2, Secret: "secret1", C: "c1"},
+				Proof{Amount: 2, Secret: "secret1", C: "c1", Witness: "witness"},
+			},
+			expectedDuplicate: true,
+		},
+	}
+
+	for _, test := range tests {
+		duplicate := CheckDuplicateProofs(test.proofs)
+		if duplicate != test.expectedDuplicate {
+			t.Fatalf("expected duplicate '%v' but got '%v'", test.expectedDuplicate, duplicate)
+		}
+	}
+}
+
+func TestCheckDuplicateBlindedMessages(t *testing.T) {
+	tests := []struct {
+		blindedMessages   BlindedMessages
+		expectedDuplicate bool
+	}{
+		{
+			blindedMessages: BlindedMessages{
+				BlindedMessage{Amount: 2, B_: "B_1"},
+				BlindedMessage{Amount: 4, B_: "B_2"},
+			},
+			expectedDuplicate: false,
+		},
+		{
+			blindedMessages: BlindedMessages{
+				BlindedMessage{Amount: 2, B_: "B_1"},
+				BlindedMessage{Amount: 2, B_: "B_1"},
+			},
+			expectedDuplicate: true,
+		},
+		// same B_ with different amount
+		{
+			blindedMessages: BlindedMessages{
+				BlindedMessage{Amount: 2, B_: "B_1"},
+				BlindedMessage{Amount: 8, B_: "B_1"},
+			},
+			expectedDuplicate: true,
+		},
+	}
+
+	for _, test := range tests {
+		duplicate := CheckDuplicateBlindedMessages(test.blindedMessages)
+		if duplicate != test.expectedDuplicate {
+			t.Fatalf("expected duplicate '%v' but got '%v'", test.expectedDuplicate, duplicate)
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		err      error
+		target   error
+		expected bool
+	}{
+		{err: ProofAlreadyUsedErr, target: ProofAlreadyUsedErr, expected: true},
+		// errors from other mints match by code with a different detail
+		{err: Error{Detail: "Token already spent.", Code: ProofAlreadyUsedErrCode}, target: ProofAlreadyUsedErr, expected: true},
+		{err: BuildCashuError("keyset is not known", UnknownKeysetErrCode), target: UnknownKeysetErr, expected: true},
+		{err: fmt.Errorf("error swapping: %w", DuplicateOutputs), target: DuplicateOutputs, expected: true},
+		{err: &Error{Detail: "duplicate outputs", Code: DuplicateOutputErrCode}, target: &DuplicateOutputs, expected: true},
+		{err: DuplicateProofs, target: DuplicateOutputs, expected: false},
+		{err: DuplicateProofs, target: errors.New("duplicate inputs"), expected: false},
+		// generic codes also need the same detail
+		{err: InvalidProofAmount, target: InvalidBlindedMessageAmount, expected: false},
+		{err: BuildCashuError("invalid proof amount", StandardErrCode), target: StandardErr, expected: false},
+		{err: QuoteNotExistErr, target: MeltQuoteForRequestExists, expected: false},
+		// errors defined here that share a code also need the same detail
+		{err: ProofPendingErr, target: ProofAlreadyUsedErr, expected: false},
+		{err: ProofAlreadyUsedErr, target: ProofPendingErr, expected: false},
+		{err: fmt.Errorf("error swapping: %w", ProofPendingErr), target: ProofPendingErr, expected: true},
+		{err: NoProofsProvided, target: InvalidProofErr, expected: false},
+		{err: MeltAmountExceededErr, target: MintAmountExceededErr, expected: false},
+		{err: &Error{Detail: "proof is pending", Code: ProofAlreadyUsedErrCode}, target: ProofPendingErr, expected: true},
+	}
+
+	for _, test := range tests {
+		if errors.Is(test.err, test.target) != test.expected {
+			t.Errorf("expected errors.Is to be %v for '%v' and '%v'", test.expected, test.err, test.target)
+		}
+	}
+
+	var cashuErr *Error
+	err := fmt.Errorf("error: %w", InsufficientProofsAmount)
+	if !errors.As(err, &cashuErr) {
+		t.Fatal("expected errors.As to find cashu error")
+	}
+	if cashuErr.Code != InsufficientProofAmountErrCode {
+		t.Fatalf("expected code %v but got %v", InsufficientProofAmountErrCode, cashuErr.Code)
+	}
+}
+
+func TestAmountSplitTargeting(t *testing.T) {
+	tests := []struct {
+		amount        uint64
+		targetCounts  map[uint64]int
+		expectedSplit []uint64
+	}{
+		{
+			amount:        13,
+			targetCounts:  nil,
+			expectedSplit: []uint64{1, 4, 8},
+		},
+		{
+			amount:        10,
+			targetCounts:  map[uint64]int{1: 2, 2: 2},
+			expectedSplit: []uint64{1, 1, 2, 2, 4},
+		},
+		// targets that do not fit are left out
+		{
+			amount:        5,
+			targetCounts:  map[uint64]int{1: 3, 2: 3, 64: 1},
+			expectedSplit: []uint64{1, 1, 1, 2},
+		},
+		{
+			amount:        0,
+			targetCounts:  map[uint64]int{1: 3},
+			expectedSplit: nil,
+		},
+	}
+
+	for _, test := range tests {
+		split := AmountSplitTargeting(test.amount, test.targetCounts)
+		if !reflect.DeepEqual(split, test.expectedSplit) {
+			t.Fatalf("expected split '%v' but got '%v'", test.expectedSplit, split)
+		}
+		var sum uint64
+		for _, amount := range split {
+			sum += amount
+		}
+		if sum != test.amount {
+			t.Fatalf("expected split to add up to %v but got %v", test.amount, sum)
+		}
+	}
+}
+
+func TestBlankOutputsCount(t *testing.T) {
+	tests := []struct {
+		feeReserve    uint64
+		expectedCount int
+	}{
+		{feeReserve: 0, expectedCount: 0},
+		{feeReserve: 1, expectedCount: 1},
+		{feeReserve: 2, expectedCount: 1},
+		{feeReserve: 3, expectedCount: 2},
+		{feeReserve: 1000, expectedCount: 10},
+		{feeReserve: 1024, expectedCount: 10},
+		{feeReserve: 1025, expectedCount: 11},
+	}
+
+	for _, test := range tests {
+		count := BlankOutputsCount(test.feeReserve)
+		if count != test.expectedCount {
+			t.Fatalf("expected %v blank outputs for fee reserve %v but got %v",
+				test.expectedCount, test.feeReserve, count)
+		}
+	}
+}
+
+func TestProofsValidate(t *testing.T) {
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	C2 := "02a9acc1e48c25eeeb9289b5031cc57da9fe72f3fe2861d264bdc074209b107ba2"
+
+	tests := []struct {
+		proofs      Proofs
+		expectedErr error
+	}{
+		{
+			proofs: Proofs{
+				{Amount: 2, Secret: "secret1", C: C},
+				{Amount: 8, Secret: "secret2", C: C2, Witness: `{"signatures":[]}`},
+				{Amount: 1 << 59, Secret: "secret3", C: C, DLEQ: &DLEQProof{E: "0a", S: "0b", R: "0c"}},
+			},
+			expectedErr: nil,
+		},
+		{
+			proofs:      Proofs{{Amount: 3, Secret: "secret1", C: C}},
+			expectedErr: InvalidProofAmount,
+		},
+		{
+			proofs:      Proofs{{Amount: 0, Secret: "secret1", C: C}},
+			expectedErr: InvalidProofAmount,
+		},
+		{
+			proofs:      Proofs{{Amount: 1 << 60, Secret: "secret1", C: C}},
+			expectedErr: InvalidProofAmount,
+		},
+		{
+			proofs: Proofs{
+				{Amount: 2, Secret: "secret1", C: C},
+				{Amount: 4, Secret: "secret1", C: C2},
+			},
+			expectedErr: DuplicateProofs,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.proofs.Validate()
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+	}
+
+	invalid := []Proofs{
+		{{Amount: 2, Secret: "secret1", C: "c1"}},
+		{{Amount: 2, Secret: "secret1", C: C[:64]}},
+		{{Amount: 2, Secret: "", C: C}},
+		{{Amount: 2, Secret: "secret1", C: C, Witness: "not json"}},
+		{{Amount: 2, Secret: "secret1", C: C, Witness: `["signature"]`}},
+		{{Amount: 2, Secret: "secret1", C: C, DLEQ: &DLEQProof{E: "zz", S: "0b"}}},
+	}
+	for _, proofs := range invalid {
+		if err := proofs.Validate(); err == nil {
+			t.Fatalf("expected error for invalid proofs %+v", proofs)
+		}
+	}
+}
+
+func TestBlindedMessagesValidate(t *testing.T) {
+	B_ := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	B_2 := "02a9acc1e48c25eeeb9289b5031cc57da9fe72f3fe2861d264bdc074209b107ba2"
+
+	tests := []struct {
+		blindedMessages BlindedMessages
+		expectedErr     error
+	}{
+		{
+			blindedMessages: BlindedMessages{{Amount: 2, B_: B_}, {Amount: 4, B_: B_2}},
+			expectedErr:     nil,
+		},
+		{
+			blindedMessages: BlindedMessages{{Amount: 6, B_: B_}},
+			expectedErr:     InvalidBlindedMessageAmount,
+		},
+		{
+			blindedMessages: BlindedMessages{{Amount: 0, B_: B_}},
+			expectedErr:     InvalidBlindedMessageAmount,
+		},
+		{
+			blindedMessages: BlindedMessages{{Amount: 2, B_: B_}, {Amount: 8, B_: B_}},
+			expectedErr:     DuplicateOutputs,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.blindedMessages.Validate()
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+	}
+
+	if err := (BlindedMessages{{Amount: 2, B_: "B_1"}}).Validate(); err == nil {
+		t.Fatal("expected error for invalid B_")
+	}
+	if err := (BlindedMessages{{Amount: 2, B_: B_, Witness: "witness"}}).Validate(); err == nil {
+		t.Fatal("expected error for invalid witness")
+	}
+
+	// blank outputs of melt requests have amount 0
+	blankOutputs := BlindedMessages{{Amount: 0, B_: B_}, {Amount: 0, B_: B_2}}
+	if err := blankOutputs.ValidateBlankOutputs(); err != nil {
+		t.Fatalf("unexpected error validating blank outputs: %v", err)
+	}
+}
+
+func TestDecodeTokenInfo(t *testing.T) {
+	pubkey := "02a9acc1e48c25eeeb9289b5031cc57da9fe72f3fe2861d264bdc074209b107ba2"
+	refund := "03142715675faf8da1ecc4d51e0b9e539fa0d52fdd96ed60dbe99adb15d6b05ad9"
+	lockedSecret, err := nut10.SerializeSecret(nut10.WellKnownSecret{
+		Kind: nut10.P2PK,
+		Data: nut10.SecretData{
+			Nonce: "da62796403af76c80cd6ce9153ed3746",
+			Data:  pubkey,
+			Tags:  [][]string{{"locktime", "1700000000"}, {"refund", refund}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	dleq := &DLEQProof{
+		E: "b31e58ac6527f34975ffab13e70a48b6d2b0d35abc4b03f0151f09ee1a9763d4",
+		S: "8fbae004c59e754d71df67e392b6ae4e29293113ddc2ec86592a0431d16306d8",
+		R: "a6d13fcd7a18442e6076f5e1e7c887ad5de40a019824bdfa9fe740d302e8d861",
+	}
+	proofs := Proofs{
+		{Amount: 1, Id: "00ad268c4d1f5826", Secret: "secret1", C: C, DLEQ: dleq},
+		{Amount: 2, Id: "00ad268c4d1f5826", Secret: "secret2", C: C},
+		{Amount: 4, Id: "00ad268c4d1f5826", Secret: lockedSecret, C: C},
+		{Amount: 8, Id: "00ad268c4d1f5826", Secret: lockedSecret, C: C},
+	}
+	token, err := NewTokenV4(proofs, "http://localhost:3338", Sat, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := token.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := DecodeTokenInfo(serialized)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info.Mint != "http://localhost:3338" {
+		t.Fatalf("expected mint 'http://localhost:3338' but got '%v'", info.Mint)
+	}
+	if info.Unit != "sat" {
+		t.Fatalf("expected unit 'sat' but got '%v'", info.Unit)
+	}
+	if info.Amount != 15 {
+		t.Fatalf("expected amount of 15 but got %v", info.Amount)
+	}
+	if info.ProofCount != 4 {
+		t.Fatalf("expected 4 proofs but got %v", info.ProofCount)
+	}
+	if !reflect.DeepEqual(info.KeysetIds, []string{"00ad268c4d1f5826"}) {
+		t.Fatalf("expected keyset ids '[00ad268c4d1f5826]' but got '%v'", info.KeysetIds)
+	}
+	if info.DLEQCount != 1 {
+		t.Fatalf("expected 1 proof with DLEQ but got %v", info.DLEQCount)
+	}
+
+	expectedLocks := []TokenLock{
+		{
+			Kind:       nut10.P2PK,
+			Data:       pubkey,
+			Locktime:   1700000000,
+			RefundKeys: []string{refund},
+			ProofCount: 2,
+			Amount:     12,
+		},
+	}
+	if !reflect.DeepEqual(info.Locks, expectedLocks) {
+		t.Fatalf("expected locks '%+v' but got '%+v'", expectedLocks, info.Locks)
+	}
+
+	if _, err := DecodeTokenInfo("cashuBinvalid"); err == nil {
+		t.Fatal("expected error decoding invalid token")
+	}
+}
+
+func TestUnitFromString(t *testing.T) {
+	for _, unit := range []Unit{Sat, Msat, Usd, Eur} {
+		parsed, err := UnitFromString(unit.String())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if parsed != unit {
+			t.Fatalf("expected unit '%v' but got '%v'", unit, parsed)
+		}
+	}
+
+	if _, err := UnitFromString("btc"); !errors.Is(err, ErrInvalidUnit) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidUnit, err)
+	}
+
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	proofs := Proofs{{Amount: 2, Id: "00ad268c4d1f5826", Secret: "secret1", C: C}}
+	token, err := NewTokenV4(proofs, "http://localhost:3338", Usd, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if TokenUnit(token) != "usd" {
+		t.Fatalf("expected token unit 'usd' but got '%v'", TokenUnit(token))
+	}
+}
@@ -53,6 +53,15 @@ type MppOption struct {
 	AmountMsat uint64 `json:"amount"`
 }
 
+// PostMeltQuoteKeysendRequest is a request to pay an amount
+// to a node without an invoice. Request is the hex encoded
+// public key of the destination node.
+type PostMeltQuoteKeysendRequest struct {
+	Request string `json:"request"`
+	Amount  uint64 `json:"amount"`
+	Unit    string `json:"unit"`
+}
+
 type PostMeltQuoteBolt11Response struct {
 	Quote      string                  `json:"quote"`
 	Request    string                  `json:"request"`
@@ -63,6 +72,10 @@ type PostMeltQuoteBolt11Response struct {
 	Expiry     uint64                  `json:"expiry"`
 	Preimage   string                  `json:"payment_preimage,omitempty"`
 	Change     cashu.BlindedSignatures `json:"change,omitempty"`
+	// fee reserve from the percentage of the mint's backend and the fee
+	// it estimated by probing routes. FeeReserve is what is required.
+	PercentageFeeReserve uint64  `json:"percentage_fee_reserve,omitempty"`
+	EstimatedFee         *uint64 `json:"estimated_fee,omitempty"`
 }
 
 type PostMeltBolt11Request struct {
@@ -72,28 +85,32 @@ type PostMeltBolt11Request struct {
 }
 
 type tempQuote struct {
-	Quote      string                  `json:"quote"`
-	Request    string                  `json:"request"`
-	Amount     uint64                  `json:"amount"`
-	Unit       string                  `json:"unit"`
-	FeeReserve uint64                  `json:"fee_reserve"`
-	State      string                  `json:"state"`
-	Expiry     uint64                  `json:"expiry"`
-	Preimage   string                  `json:"payment_preimage,omitempty"`
-	Change     cashu.BlindedSignatures `json:"change,omitempty"`
+	Quote                string                  `json:"quote"`
+	Request              string                  `json:"request"`
+	Amount               uint64                  `json:"amount"`
+	Unit                 string                  `json:"unit"`
+	FeeReserve           uint64                  `json:"fee_reserve"`
+	State                string                  `json:"state"`
+	Expiry               uint64                  `json:"expiry"`
+	Preimage             string                  `json:"payment_preimage,omitempty"`
+	Change               cashu.BlindedSignatures `json:"change,omitempty"`
+	PercentageFeeReserve uint64                  `json:"percentage_fee_reserve,omitempty"`
+	EstimatedFee         *uint64                 `json:"estimated_fee,omitempty"`
 }
 
 func (quoteResponse *PostMeltQuoteBolt11Response) MarshalJSON() ([]byte, error) {
 	var tempQuote = tempQuote{
-		Quote:      quoteResponse.Quote,
-		Request:    quoteResponse.Request,
-		Amount:     quoteResponse.Amount,
-		Unit:       quoteResponse.Unit,
-		FeeReserve: quoteResponse.FeeReserve,
-		State:      quoteResponse.State.String(),
-		Expiry:     quoteResponse.Expiry,
-		Preimage:   quoteResponse.Preimage,
-		Change:     quoteResponse.Change,
+		Quote:                quoteResponse.Quote,
+		Request:              quoteResponse.Request,
+		Amount:               quoteResponse.Amount,
+		Unit:                 quoteResponse.Unit,
+		FeeReserve:           quoteResponse.FeeReserve,
+		State:                quoteResponse.State.String(),
+		Expiry:               quoteResponse.Expiry,
+		Preimage:             quoteResponse.Preimage,
+		Change:               quoteResponse.Change,
+		PercentageFeeReserve: quoteResponse.PercentageFeeReserve,
+		EstimatedFee:         quoteResponse.EstimatedFee,
 	}
 	return json.Marshal(tempQuote)
 }
@@ -115,6 +132,8 @@ func (quoteResponse *PostMeltQuoteBolt11Response) UnmarshalJSON(data []byte) err
 	quoteResponse.Expiry = tempQuote.Expiry
 	quoteResponse.Preimage = tempQuote.Preimage
 	quoteResponse.Change = tempQuote.Change
+	quoteResponse.PercentageFeeReserve = tempQuote.PercentageFeeReserve
+	quoteResponse.EstimatedFee = tempQuote.EstimatedFee
 
 	return nil
 }
@@ -0,0 +1,290 @@
+package nut10
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+const (
+	// tags of P2PK and HTLC secrets
+	SIGFLAG  = "sigflag"
+	NSIGS    = "n_sigs"
+	PUBKEYS  = "pubkeys"
+	LOCKTIME = "locktime"
+	REFUND   = "refund"
+
+	// SIGFLAG types
+	SIGINPUTS = "SIG_INPUTS"
+	SIGALL    = "SIG_ALL"
+)
+
+var (
+	ErrInvalidTag          = errors.New("invalid tag")
+	ErrTooManyTags         = errors.New("too many tags")
+	ErrNSigsMustBePositive = errors.New("n_sigs must be a positive integer")
+)
+
+// Conditions are the spending conditions in the tags of P2PK and HTLC secrets
+type Conditions struct {
+	Sigflag  string
+	NSigs    int
+	Pubkeys  []*btcec.PublicKey
+	Locktime int64
+	Refund   []*btcec.PublicKey
+}
+
+// Tags returns the conditions as the tags of a secret.
+// Conditions that are not set are left out.
+func (c Conditions) Tags() [][]string {
+	tags := [][]string{}
+	// if anything other than 'SIG_ALL', leave empty to be treated as SIG_INPUTS
+	if c.Sigflag == SIGALL {
+		tags = append(tags, []string{SIGFLAG, SIGALL})
+	}
+	if c.NSigs > 0 {
+		tags = append(tags, []string{NSIGS, strconv.Itoa(c.NSigs)})
+	}
+	if len(c.Pubkeys) > 0 {
+		tags = append(tags, append([]string{PUBKEYS}, serializeKeys(c.Pubkeys)...))
+	}
+	if c.Locktime > 0 {
+		tags = append(tags, []string{LOCKTIME, strconv.FormatInt(c.Locktime, 10)})
+	}
+	if len(c.Refund) > 0 {
+		tags = append(tags, append([]string{REFUND}, serializeKeys(c.Refund)...))
+	}
+	return tags
+}
+
+func serializeKeys(keys []*btcec.PublicKey) []string {
+	serialized := make([]string, len(keys))
+	for i, key := range keys {
+		serialized[i] = hex.EncodeToString(key.SerializeCompressed())
+	}
+	return serialized
+}
+
+// ParseConditions reads the conditions from the tags of a secret. Unknown tags are ignored.
+func ParseConditions(tags [][]string) (*Conditions, error) {
+	if len(tags) > 5 {
+		return nil, ErrTooManyTags
+	}
+
+	conditions := Conditions{}
+	for _, tag := range tags {
+		if len(tag) < 2 {
+			return nil, ErrInvalidTag
+		}
+		switch tag[0] {
+		case SIGFLAG:
+			if tag[1] != SIGINPUTS && tag[1] != SIGALL {
+				return nil, fmt.Errorf("invalid sigflag: %v", tag[1])
+			}
+			conditions.Sigflag = tag[1]
+		case NSIGS:
+			nsigs, err := strconv.ParseInt(tag[1], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid n_sigs value: %v", err)
+			}
+			if nsigs < 0 {
+				return nil, ErrNSigsMustBePositive
+			}
+			conditions.NSigs = int(nsigs)
+		case PUBKEYS:
+			pubkeys, err := parseKeys(tag[1:])
+			if err != nil {
+				return nil, err
+			}
+			conditions.Pubkeys = pubkeys
+		case LOCKTIME:
+			locktime, err := strconv.ParseInt(tag[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid locktime: %v", err)
+			}
+			conditions.Locktime = locktime
+		case REFUND:
+			refund, err := parseKeys(tag[1:])
+			if err != nil {
+				return nil, err
+			}
+			conditions.Refund = refund
+		}
+	}
+	return &conditions, nil
+}
+
+func parseKeys(keys []string) ([]*btcec.PublicKey, error) {
+	publicKeys := make([]*btcec.PublicKey, len(keys))
+	for i, key := range keys {
+		publicKey, err := ParsePublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys[i] = publicKey
+	}
+	return publicKeys, nil
+}
+
+// ParsePublicKey parses a hex encoded public key. It accepts both
+// compressed keys and the 32-byte x-only keys of BIP-340.
+func ParsePublicKey(key string) (*btcec.PublicKey, error) {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	var publicKey *btcec.PublicKey
+	if len(keyBytes) == schnorr.PubKeyBytesLen {
+		publicKey, err = schnorr.ParsePubKey(keyBytes)
+	} else {
+		publicKey, err = btcec.ParsePubKey(keyBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	return publicKey, nil
+}
+
+// SecretBuilder builds P2PK and HTLC secrets. It is created with
+// NewP2PKSecret or NewHTLCSecret and the conditions are added with its
+// With methods, e.g.
+//
+//	nut10.NewP2PKSecret(pubkey).WithLocktime(locktime).WithRefund(refundKey).Build()
+type SecretBuilder struct {
+	kind       SecretKind
+	data       string
+	conditions Conditions
+}
+
+// NewP2PKSecret starts a secret locked to the public key
+func NewP2PKSecret(publicKey *btcec.PublicKey) *SecretBuilder {
+	var data string
+	if publicKey != nil {
+		data = hex.EncodeToString(publicKey.SerializeCompressed())
+	}
+	return &SecretBuilder{kind: P2PK, data: data}
+}
+
+// NewHTLCSecret starts a secret locked to the hex encoded hash of a preimage
+func NewHTLCSecret(hash string) *SecretBuilder {
+	return &SecretBuilder{kind: HTLC, data: hash}
+}
+
+// WithConditions replaces the conditions of the secret
+func (b *SecretBuilder) WithConditions(conditions Conditions) *SecretBuilder {
+	b.conditions = conditions
+	return b
+}
+
+// WithSigAll requires the signatures on the outputs of the swap as well
+func (b *SecretBuilder) WithSigAll() *SecretBuilder {
+	b.conditions.Sigflag = SIGALL
+	return b
+}
+
+// WithNSigs sets the number of signatures required from the public keys
+func (b *SecretBuilder) WithNSigs(nsigs int) *SecretBuilder {
+	b.conditions.NSigs = nsigs
+	return b
+}
+
+// WithPubkeys adds public keys that can provide signatures
+func (b *SecretBuilder) WithPubkeys(pubkeys ...*btcec.PublicKey) *SecretBuilder {
+	b.conditions.Pubkeys = append(b.conditions.Pubkeys, pubkeys...)
+	return b
+}
+
+// WithLocktime sets the unix timestamp after which the refund keys can spend
+// the proof, or anyone if there are no refund keys
+func (b *SecretBuilder) WithLocktime(locktime int64) *SecretBuilder {
+	b.conditions.Locktime = locktime
+	return b
+}
+
+// WithRefund adds public keys that can spend the proof after the locktime
+func (b *SecretBuilder) WithRefund(refund ...*btcec.PublicKey) *SecretBuilder {
+	b.conditions.Refund = append(b.conditions.Refund, refund...)
+	return b
+}
+
+// SpendingCondition returns the spending condition to create
+// secrets, each with its own nonce, for multiple outputs
+func (b *SecretBuilder) SpendingCondition() (SpendingCondition, error) {
+	if err := b.validate(); err != nil {
+		return SpendingCondition{}, err
+	}
+	return SpendingCondition{
+		Kind: b.kind,
+		Data: b.data,
+		Tags: b.conditions.Tags(),
+	}, nil
+}
+
+// Build returns the serialized secret with a random nonce
+func (b *SecretBuilder) Build() (string, error) {
+	spendingCondition, err := b.SpendingCondition()
+	if err != nil {
+		return "", err
+	}
+	return NewSecretFromSpendingCondition(spendingCondition)
+}
+
+func (b *SecretBuilder) validate() error {
+	if b.conditions.NSigs < 0 {
+		return ErrNSigsMustBePositive
+	}
+	if err := validateKind(b.kind, b.data, b.conditions.Tags()); err != nil {
+		return err
+	}
+	// the public key of P2PK secrets can also sign
+	signers := len(b.conditions.Pubkeys)
+	if b.kind == P2PK {
+		signers++
+	}
+	if b.conditions.NSigs > signers {
+		return fmt.Errorf("n_sigs %v is more than the %v public keys that can sign", b.conditions.NSigs, signers)
+	}
+	return nil
+}
+
+// LockedSecret is a P2PK or HTLC secret with its conditions parsed
+type LockedSecret struct {
+	Kind  SecretKind
+	Nonce string
+	// public key for P2PK or hash of the preimage for HTLC
+	Data       string
+	Conditions Conditions
+}
+
+// ParseLockedSecret parses the secret of a P2PK or HTLC locked proof
+func ParseLockedSecret(secret string) (*LockedSecret, error) {
+	wellKnownSecret, err := DeserializeSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if wellKnownSecret.Kind != P2PK && wellKnownSecret.Kind != HTLC {
+		return nil, errors.New("secret is not P2PK or HTLC")
+	}
+	conditions, err := ParseConditions(wellKnownSecret.Data.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &LockedSecret{
+		Kind:       wellKnownSecret.Kind,
+		Nonce:      wellKnownSecret.Data.Nonce,
+		Data:       wellKnownSecret.Data.Data,
+		Conditions: *conditions,
+	}, nil
+}
+
+// PublicKey returns the public key a P2PK secret is locked to
+func (s LockedSecret) PublicKey() (*btcec.PublicKey, error) {
+	if s.Kind != P2PK {
+		return nil, errors.New("secret is not P2PK")
+	}
+	return ParsePublicKey(s.Data)
+}
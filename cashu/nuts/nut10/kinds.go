@@ -0,0 +1,109 @@
+package nut10
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// KindValidator checks that the data and tags of a secret of its kind are valid
+type KindValidator func(data string, tags [][]string) error
+
+type secretKindEntry struct {
+	name     string
+	validate KindValidator
+}
+
+var (
+	kindsMu     sync.RWMutex
+	kinds       = make(map[SecretKind]secretKindEntry)
+	kindsByName = make(map[string]SecretKind)
+)
+
+var ErrKindRegistered = errors.New("secret kind already registered")
+
+func init() {
+	RegisterKind(P2PK, "P2PK", validateP2PK)
+	RegisterKind(HTLC, "HTLC", validateHTLC)
+}
+
+// RegisterKind adds a kind of well-known secret. name is the kind as it
+// appears in serialized secrets. Secrets of kinds that are not registered
+// are deserialized as AnyoneCanSpend. validate can be nil if the kind
+// does not need checks on its data and tags.
+//
+// Kinds are usually registered from an init function, the same kind
+// and name need to be registered in the wallet and the mint to use them.
+func RegisterKind(kind SecretKind, name string, validate KindValidator) error {
+	if kind == AnyoneCanSpend || name == "" {
+		return errors.New("invalid secret kind")
+	}
+
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	if _, ok := kinds[kind]; ok {
+		return fmt.Errorf("%w: %d", ErrKindRegistered, kind)
+	}
+	if _, ok := kindsByName[name]; ok {
+		return fmt.Errorf("%w: %v", ErrKindRegistered, name)
+	}
+	kinds[kind] = secretKindEntry{name: name, validate: validate}
+	kindsByName[name] = kind
+	return nil
+}
+
+// IsRegistered returns true if the kind was added with RegisterKind
+func IsRegistered(kind SecretKind) bool {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	_, ok := kinds[kind]
+	return ok
+}
+
+// KindFromName returns the kind registered with the name.
+// It returns AnyoneCanSpend if there is none.
+func KindFromName(name string) SecretKind {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	if kind, ok := kindsByName[name]; ok {
+		return kind
+	}
+	return AnyoneCanSpend
+}
+
+// Validate checks the data and tags of the secret
+// with the validator registered for its kind
+func (secret WellKnownSecret) Validate() error {
+	return validateKind(secret.Kind, secret.Data.Data, secret.Data.Tags)
+}
+
+func validateKind(kind SecretKind, data string, tags [][]string) error {
+	kindsMu.RLock()
+	entry, ok := kinds[kind]
+	kindsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown secret kind '%v'", kind)
+	}
+	if entry.validate == nil {
+		return nil
+	}
+	return entry.validate(data, tags)
+}
+
+func validateP2PK(data string, tags [][]string) error {
+	if _, err := ParsePublicKey(data); err != nil {
+		return err
+	}
+	_, err := ParseConditions(tags)
+	return err
+}
+
+func validateHTLC(data string, tags [][]string) error {
+	hash, err := hex.DecodeString(data)
+	if err != nil || len(hash) != 32 {
+		return errors.New("invalid hash for HTLC")
+	}
+	_, err = ParseConditions(tags)
+	return err
+}
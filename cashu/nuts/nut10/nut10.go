@@ -8,6 +8,8 @@ import (
 	"fmt"
 )
 
+// SecretKind is the kind of a well-known secret. Kinds other than
+// P2PK and HTLC can be added with RegisterKind.
 type SecretKind int
 
 const (
@@ -17,14 +19,12 @@ const (
 )
 
 func (kind SecretKind) String() string {
-	switch kind {
-	case P2PK:
-		return "P2PK"
-	case HTLC:
-		return "HTLC"
-	default:
-		return "anyonecanspend"
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	if entry, ok := kinds[kind]; ok {
+		return entry.name
 	}
+	return "anyonecanspend"
 }
 
 type WellKnownSecret struct {
@@ -50,7 +50,9 @@ func SerializeSecret(secret WellKnownSecret) (string, error) {
 }
 
 // DeserializeSecret returns Well-known secret struct.
-// It returns error if it's not valid according to NUT-10
+// It returns error if it's not valid according to NUT-10.
+// The kind is looked up in the registered kinds. The data and tags are
+// not checked, use Validate for that.
 func DeserializeSecret(serializedSecret string) (WellKnownSecret, error) {
 	var rawJsonSecret []json.RawMessage
 	if err := json.Unmarshal([]byte(serializedSecret), &rawJsonSecret); err != nil {
@@ -68,14 +70,7 @@ func DeserializeSecret(serializedSecret string) (WellKnownSecret, error) {
 		return WellKnownSecret{}, errors.New("invalid kind for secret")
 	}
 
-	switch kind {
-	case "P2PK":
-		secret.Kind = P2PK
-	case "HTLC":
-		secret.Kind = HTLC
-	default:
-		secret.Kind = AnyoneCanSpend
-	}
+	secret.Kind = KindFromName(kind)
 
 	if err := json.Unmarshal(rawJsonSecret[1], &secret.Data); err != nil {
 		return WellKnownSecret{}, fmt.Errorf("invalid secret: %v", err)
@@ -99,7 +94,7 @@ func NewSecretFromSpendingCondition(spendingCondition SpendingCondition) (string
 	}
 	nonce := hex.EncodeToString(nonceBytes)
 
-	if spendingCondition.Kind != P2PK && spendingCondition.Kind != HTLC {
+	if !IsRegistered(spendingCondition.Kind) {
 		return "", fmt.Errorf("invalid NUT-10 kind '%s' to create new secret", spendingCondition.Kind)
 	}
 
@@ -1,8 +1,12 @@
 package nut10
 
 import (
+	"encoding/hex"
+	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
 )
 
 func TestSerializeSecret(t *testing.T) {
@@ -95,3 +99,174 @@ func TestDeserializeSecret(t *testing.T) {
 		}
 	}
 }
+
+func TestSecretBuilder(t *testing.T) {
+	key1, _ := btcec.NewPrivateKey()
+	key2, _ := btcec.NewPrivateKey()
+	refundKey, _ := btcec.NewPrivateKey()
+
+	secret, err := NewP2PKSecret(key1.PubKey()).
+		WithSigAll().
+		WithNSigs(2).
+		WithPubkeys(key2.PubKey()).
+		WithLocktime(1700000000).
+		WithRefund(refundKey.PubKey()).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error building secret: %v", err)
+	}
+
+	lockedSecret, err := ParseLockedSecret(secret)
+	if err != nil {
+		t.Fatalf("unexpected error parsing secret: %v", err)
+	}
+	if lockedSecret.Kind != P2PK {
+		t.Fatalf("expected kind '%v' but got '%v' instead", P2PK, lockedSecret.Kind)
+	}
+	if len(lockedSecret.Nonce) != 64 {
+		t.Fatalf("expected nonce of 32 bytes but got '%v'", lockedSecret.Nonce)
+	}
+	publicKey, err := lockedSecret.PublicKey()
+	if err != nil {
+		t.Fatalf("unexpected error getting public key: %v", err)
+	}
+	if !publicKey.IsEqual(key1.PubKey()) {
+		t.Fatalf("expected public key '%x' but got '%x'",
+			key1.PubKey().SerializeCompressed(), publicKey.SerializeCompressed())
+	}
+
+	expectedConditions := Conditions{
+		Sigflag:  SIGALL,
+		NSigs:    2,
+		Pubkeys:  []*btcec.PublicKey{key2.PubKey()},
+		Locktime: 1700000000,
+		Refund:   []*btcec.PublicKey{refundKey.PubKey()},
+	}
+	if !reflect.DeepEqual(lockedSecret.Conditions.Tags(), expectedConditions.Tags()) {
+		t.Fatalf("expected conditions '%v' but got '%v' instead",
+			expectedConditions.Tags(), lockedSecret.Conditions.Tags())
+	}
+
+	// each secret gets its own nonce
+	spendingCondition, err := NewP2PKSecret(key1.PubKey()).SpendingCondition()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret1, _ := NewSecretFromSpendingCondition(spendingCondition)
+	secret2, _ := NewSecretFromSpendingCondition(spendingCondition)
+	if secret1 == secret2 {
+		t.Fatal("expected secrets with different nonces")
+	}
+
+	hash := hex.EncodeToString(make([]byte, 32))
+	htlcSecret, err := NewHTLCSecret(hash).WithNSigs(1).WithPubkeys(key1.PubKey()).Build()
+	if err != nil {
+		t.Fatalf("unexpected error building secret: %v", err)
+	}
+	lockedSecret, err = ParseLockedSecret(htlcSecret)
+	if err != nil {
+		t.Fatalf("unexpected error parsing secret: %v", err)
+	}
+	if lockedSecret.Kind != HTLC || lockedSecret.Data != hash {
+		t.Fatalf("expected HTLC secret locked to '%v' but got '%+v'", hash, lockedSecret)
+	}
+	if _, err := lockedSecret.PublicKey(); err == nil {
+		t.Fatal("expected error getting public key of HTLC secret")
+	}
+
+	invalidBuilders := []*SecretBuilder{
+		NewP2PKSecret(nil),
+		NewHTLCSecret("abcd"),
+		NewP2PKSecret(key1.PubKey()).WithNSigs(2),
+		NewHTLCSecret(hash).WithNSigs(1),
+		NewP2PKSecret(key1.PubKey()).WithNSigs(-1),
+	}
+	for i, builder := range invalidBuilders {
+		if _, err := builder.Build(); err == nil {
+			t.Fatalf("expected error building invalid secret %v", i)
+		}
+	}
+}
+
+func TestParseConditions(t *testing.T) {
+	tests := []struct {
+		tags        [][]string
+		expectedErr error
+	}{
+		{tags: [][]string{{SIGFLAG, SIGINPUTS}, {NSIGS, "1"}}},
+		{tags: [][]string{{SIGFLAG}}, expectedErr: ErrInvalidTag},
+		{tags: [][]string{{NSIGS, "-1"}}, expectedErr: ErrNSigsMustBePositive},
+		{
+			tags:        [][]string{{SIGFLAG, SIGALL}, {NSIGS, "1"}, {LOCKTIME, "1"}, {"a", "b"}, {"c", "d"}, {"e", "f"}},
+			expectedErr: ErrTooManyTags,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := ParseConditions(test.tags)
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v' instead", test.expectedErr, err)
+		}
+	}
+
+	if _, err := ParseConditions([][]string{{PUBKEYS, "invalidkey"}}); err == nil {
+		t.Fatal("expected error parsing invalid public key")
+	}
+	if _, err := ParseLockedSecret("secret"); err == nil {
+		t.Fatal("expected error parsing secret that is not P2PK or HTLC")
+	}
+}
+
+func TestRegisterKind(t *testing.T) {
+	const custom SecretKind = 100
+	errInvalidData := errors.New("invalid data")
+	err := RegisterKind(custom, "CUSTOM", func(data string, tags [][]string) error {
+		if data != "valid" {
+			return errInvalidData
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error registering kind: %v", err)
+	}
+
+	if err := RegisterKind(custom, "OTHER", nil); !errors.Is(err, ErrKindRegistered) {
+		t.Fatalf("expected error '%v' but got '%v' instead", ErrKindRegistered, err)
+	}
+	if err := RegisterKind(101, "P2PK", nil); !errors.Is(err, ErrKindRegistered) {
+		t.Fatalf("expected error '%v' but got '%v' instead", ErrKindRegistered, err)
+	}
+
+	secret, err := NewSecretFromSpendingCondition(SpendingCondition{Kind: custom, Data: "valid"})
+	if err != nil {
+		t.Fatalf("unexpected error creating secret: %v", err)
+	}
+	wellKnownSecret, err := DeserializeSecret(secret)
+	if err != nil {
+		t.Fatalf("unexpected error deserializing secret: %v", err)
+	}
+	if wellKnownSecret.Kind != custom {
+		t.Fatalf("expected kind '%v' but got '%v' instead", custom, wellKnownSecret.Kind)
+	}
+	if err := wellKnownSecret.Validate(); err != nil {
+		t.Fatalf("unexpected error validating secret: %v", err)
+	}
+
+	wellKnownSecret.Data.Data = "invalid"
+	if err := wellKnownSecret.Validate(); !errors.Is(err, errInvalidData) {
+		t.Fatalf("expected error '%v' but got '%v' instead", errInvalidData, err)
+	}
+
+	p2pkSecret := WellKnownSecret{Kind: P2PK, Data: SecretData{Data: "invalidkey"}}
+	if err := p2pkSecret.Validate(); err == nil {
+		t.Fatal("expected error validating P2PK secret with invalid public key")
+	}
+
+	unknown, err := DeserializeSecret(`["UNKNOWN", {"nonce":"da62796403af76c80cd6ce9153ed3746","data":"","tags":[]}]`)
+	if err != nil {
+		t.Fatalf("unexpected error deserializing secret: %v", err)
+	}
+	if unknown.Kind != AnyoneCanSpend {
+		t.Fatalf("expected kind '%v' but got '%v' instead", AnyoneCanSpend, unknown.Kind)
+	}
+}
@@ -1,13 +1,16 @@
 package nut11
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
@@ -18,15 +21,15 @@ import (
 
 const (
 	// supported tags
-	SIGFLAG  = "sigflag"
-	NSIGS    = "n_sigs"
-	PUBKEYS  = "pubkeys"
-	LOCKTIME = "locktime"
-	REFUND   = "refund"
+	SIGFLAG  = nut10.SIGFLAG
+	NSIGS    = nut10.NSIGS
+	PUBKEYS  = nut10.PUBKEYS
+	LOCKTIME = nut10.LOCKTIME
+	REFUND   = nut10.REFUND
 
 	// SIGFLAG types
-	SIGINPUTS = "SIG_INPUTS"
-	SIGALL    = "SIG_ALL"
+	SIGINPUTS = nut10.SIGINPUTS
+	SIGALL    = nut10.SIGALL
 
 	// Error code
 	NUT11ErrCode cashu.CashuErrCode = 30001
@@ -47,177 +50,261 @@ var (
 	SigAllKeysMustBeEqualErr = cashu.Error{Detail: "all public keys must be the same for SIG_ALL", Code: NUT11ErrCode}
 	SigAllOnlySwap           = cashu.Error{Detail: "SIG_ALL can only be used in /swap operation", Code: NUT11ErrCode}
 	NSigsMustBeEqualErr      = cashu.Error{Detail: "all n_sigs must be the same for SIG_ALL", Code: NUT11ErrCode}
+	SigAllConditionsErr      = cashu.Error{Detail: "all inputs must have the same spending conditions for SIG_ALL", Code: NUT11ErrCode}
 )
 
+func init() {
+	cashu.DefineErrors(
+		InvalidTagErr,
+		TooManyTagsErr,
+		NSigsMustBePositiveErr,
+		EmptyPubkeysErr,
+		InvalidWitness,
+		InvalidKindErr,
+		DuplicateSignaturesErr,
+		NotEnoughSignaturesErr,
+		NoSignaturesErr,
+		AllSigAllFlagsErr,
+		SigAllKeysMustBeEqualErr,
+		SigAllOnlySwap,
+		NSigsMustBeEqualErr,
+		SigAllConditionsErr,
+	)
+}
+
 type P2PKWitness struct {
 	Signatures []string `json:"signatures"`
 }
 
-type P2PKTags struct {
-	Sigflag  string
-	NSigs    int
-	Pubkeys  []*btcec.PublicKey
-	Locktime int64
-	Refund   []*btcec.PublicKey
-}
+// P2PKTags are the conditions in the tags of P2PK and HTLC secrets.
+// Use nut10.NewP2PKSecret or nut10.NewHTLCSecret to create secrets with them.
+type P2PKTags = nut10.Conditions
 
 func SerializeP2PKTags(p2pkTags P2PKTags) [][]string {
-	var tags [][]string
-	// if anything other than 'SIG_ALL', leave empty to be treated as SIG_INPUTS
-	if p2pkTags.Sigflag == SIGALL {
-		tags = append(tags, []string{SIGFLAG, SIGALL})
-	}
-	if p2pkTags.NSigs > 0 {
-		numStr := strconv.Itoa(p2pkTags.NSigs)
-		tags = append(tags, []string{NSIGS, numStr})
-	}
-	if len(p2pkTags.Pubkeys) > 0 {
-		pubkeys := []string{PUBKEYS}
-		for _, pubkey := range p2pkTags.Pubkeys {
-			key := hex.EncodeToString(pubkey.SerializeCompressed())
-			pubkeys = append(pubkeys, key)
-		}
-		tags = append(tags, pubkeys)
-	}
-	if p2pkTags.Locktime > 0 {
-		locktime := strconv.FormatInt(p2pkTags.Locktime, 10)
-		tags = append(tags, []string{LOCKTIME, locktime})
-	}
-	if len(p2pkTags.Refund) > 0 {
-		refundKeys := []string{REFUND}
-		for _, pubkey := range p2pkTags.Refund {
-			key := hex.EncodeToString(pubkey.SerializeCompressed())
-			refundKeys = append(refundKeys, key)
-		}
-		tags = append(tags, refundKeys)
-	}
-	return tags
+	return p2pkTags.Tags()
 }
 
+// ParseP2PKTags reads the conditions in the tags. It returns the
+// NUT-11 errors for invalid tags.
 func ParseP2PKTags(tags [][]string) (*P2PKTags, error) {
-	if len(tags) > 5 {
-		return nil, TooManyTagsErr
-	}
-
-	p2pkTags := P2PKTags{}
-
-	for _, tag := range tags {
-		if len(tag) < 2 {
+	p2pkTags, err := nut10.ParseConditions(tags)
+	if err != nil {
+		switch {
+		case errors.Is(err, nut10.ErrTooManyTags):
+			return nil, TooManyTagsErr
+		case errors.Is(err, nut10.ErrInvalidTag):
 			return nil, InvalidTagErr
+		case errors.Is(err, nut10.ErrNSigsMustBePositive):
+			return nil, NSigsMustBePositiveErr
 		}
-		tagType := tag[0]
-		switch tagType {
-		case SIGFLAG:
-			sigflagType := tag[1]
-			if sigflagType == SIGINPUTS || sigflagType == SIGALL {
-				p2pkTags.Sigflag = sigflagType
-			} else {
-				errmsg := fmt.Sprintf("invalig sigflag: %v", sigflagType)
-				return nil, cashu.BuildCashuError(errmsg, NUT11ErrCode)
-			}
-		case NSIGS:
-			nstr := tag[1]
-			nsig, err := strconv.ParseInt(nstr, 10, 8)
-			if err != nil {
-				errmsg := fmt.Sprintf("invalig n_sigs value: %v", err)
-				return nil, cashu.BuildCashuError(errmsg, NUT11ErrCode)
-			}
-			if nsig < 0 {
-				return nil, NSigsMustBePositiveErr
-			}
-			p2pkTags.NSigs = int(nsig)
-		case PUBKEYS:
-			pubkeys := make([]*btcec.PublicKey, len(tag)-1)
-			j := 0
-			for i := 1; i < len(tag); i++ {
-				pubkey, err := ParsePublicKey(tag[i])
-				if err != nil {
-					return nil, err
-				}
-				pubkeys[j] = pubkey
-				j++
-			}
-			p2pkTags.Pubkeys = pubkeys
-		case LOCKTIME:
-			locktimestr := tag[1]
-			locktime, err := strconv.ParseInt(locktimestr, 10, 64)
-			if err != nil {
-				errmsg := fmt.Sprintf("invalid locktime: %v", err)
-				return nil, cashu.BuildCashuError(errmsg, NUT11ErrCode)
-			}
-			p2pkTags.Locktime = locktime
-		case REFUND:
-			refundKeys := make([]*btcec.PublicKey, len(tag)-1)
-			j := 0
-			for i := 1; i < len(tag); i++ {
-				pubkey, err := ParsePublicKey(tag[i])
-				if err != nil {
-					return nil, err
-				}
-				refundKeys[j] = pubkey
-				j++
-			}
-			p2pkTags.Refund = refundKeys
-		}
+		return nil, cashu.BuildCashuError(err.Error(), NUT11ErrCode)
 	}
-
-	return &p2pkTags, nil
+	return p2pkTags, nil
 }
 
 func AddSignatureToInputs(inputs cashu.Proofs, signingKey *btcec.PrivateKey) (cashu.Proofs, error) {
+	return AddSignaturesToInputs(inputs, []*btcec.PrivateKey{signingKey})
+}
+
+// AddSignaturesToInputs sets the witness of the inputs
+// to the signatures from each of the keys
+func AddSignaturesToInputs(inputs cashu.Proofs, signingKeys []*btcec.PrivateKey) (cashu.Proofs, error) {
 	for i, proof := range inputs {
 		hash := sha256.Sum256([]byte(proof.Secret))
-		signature, err := schnorr.Sign(signingKey, hash[:])
+		witness, err := signWitness(hash[:], signingKeys)
 		if err != nil {
 			return nil, err
 		}
-		signatureBytes := signature.Serialize()
+		proof.Witness = witness
+		inputs[i] = proof
+	}
 
-		p2pkWitness := P2PKWitness{
-			Signatures: []string{hex.EncodeToString(signatureBytes)},
-		}
+	return inputs, nil
+}
 
-		witness, err := json.Marshal(p2pkWitness)
+func signWitness(hash []byte, signingKeys []*btcec.PrivateKey) (string, error) {
+	p2pkWitness := P2PKWitness{Signatures: make([]string, len(signingKeys))}
+	for i, key := range signingKeys {
+		signature, err := schnorr.Sign(key, hash)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-		proof.Witness = string(witness)
-		inputs[i] = proof
+		p2pkWitness.Signatures[i] = hex.EncodeToString(signature.Serialize())
 	}
 
-	return inputs, nil
+	witness, err := json.Marshal(p2pkWitness)
+	if err != nil {
+		return "", err
+	}
+	return string(witness), nil
+}
+
+// SigAllMessage returns the message that is signed to spend inputs locked with
+// SIG_ALL as defined in NUT-11: the secret and C of each input followed by the
+// amount, keyset id and B_ of each output, in the order they are in the request.
+func SigAllMessage(inputs cashu.Proofs, outputs cashu.BlindedMessages) []byte {
+	var msg strings.Builder
+	for _, proof := range inputs {
+		msg.WriteString(proof.Secret)
+		msg.WriteString(proof.C)
+	}
+	for _, output := range outputs {
+		msg.WriteString(strconv.FormatUint(output.Amount, 10))
+		msg.WriteString(output.Id)
+		msg.WriteString(output.B_)
+	}
+	return []byte(msg.String())
 }
 
-func AddSignatureToOutputs(
+// SigAllSignatures returns the signatures from each of the keys
+// on the SHA-256 hash of the message from SigAllMessage
+func SigAllSignatures(
+	inputs cashu.Proofs,
 	outputs cashu.BlindedMessages,
-	signingKey *btcec.PrivateKey,
-) (cashu.BlindedMessages, error) {
-	for i, output := range outputs {
-		msgToSign, err := hex.DecodeString(output.B_)
+	signingKeys []*btcec.PrivateKey,
+) ([]string, error) {
+	hash := sha256.Sum256(SigAllMessage(inputs, outputs))
+	signatures := make([]string, len(signingKeys))
+	for i, key := range signingKeys {
+		signature, err := schnorr.Sign(key, hash[:])
 		if err != nil {
 			return nil, err
 		}
+		signatures[i] = hex.EncodeToString(signature.Serialize())
+	}
+	return signatures, nil
+}
 
-		hash := sha256.Sum256(msgToSign)
-		signature, err := schnorr.Sign(signingKey, hash[:])
-		if err != nil {
-			return nil, err
-		}
-		signatureBytes := signature.Serialize()
+// AddSigAllSignatures sets the witness of the first input to the signatures
+// from each of the keys on the message from SigAllMessage. The outputs
+// cannot change after signing.
+func AddSigAllSignatures(
+	inputs cashu.Proofs,
+	outputs cashu.BlindedMessages,
+	signingKeys []*btcec.PrivateKey,
+) (cashu.Proofs, error) {
+	if len(inputs) == 0 {
+		return inputs, nil
+	}
+	signatures, err := SigAllSignatures(inputs, outputs, signingKeys)
+	if err != nil {
+		return nil, err
+	}
+	witness, err := json.Marshal(P2PKWitness{Signatures: signatures})
+	if err != nil {
+		return nil, err
+	}
+	inputs[0].Witness = string(witness)
+	return inputs, nil
+}
 
-		p2pkWitness := P2PKWitness{
-			Signatures: []string{hex.EncodeToString(signatureBytes)},
+// VerifySigAll verifies the signatures of P2PK or HTLC inputs locked with SIG_ALL.
+// All the inputs need the SIG_ALL flag and the same spending conditions, and
+// the witness of the first input needs the signatures on the message from
+// SigAllMessage. Preimages of HTLCs are verified with each input.
+func VerifySigAll(inputs cashu.Proofs, outputs cashu.BlindedMessages) error {
+	if len(inputs) == 0 {
+		return InvalidWitness
+	}
+	var secret nut10.WellKnownSecret
+	for i, proof := range inputs {
+		proofSecret, err := nut10.DeserializeSecret(proof.Secret)
+		if err != nil || !IsSigAll(proofSecret) {
+			return AllSigAllFlagsErr
 		}
+		if i == 0 {
+			secret = proofSecret
+		}
+		if proofSecret.Kind != secret.Kind || proofSecret.Data.Data != secret.Data.Data ||
+			!reflect.DeepEqual(proofSecret.Data.Tags, secret.Data.Tags) {
+			return SigAllConditionsErr
+		}
+	}
+
+	keys, signaturesRequired, err := sigAllSigners(secret)
+	if err != nil {
+		return err
+	}
+	if signaturesRequired == 0 {
+		return nil
+	}
+	hash := sha256.Sum256(SigAllMessage(inputs, outputs))
+	return verifyWitnessSignatures(inputs[0].Witness, hash[:], keys, signaturesRequired)
+}
 
-		witness, err := json.Marshal(p2pkWitness)
+func verifyWitnessSignatures(
+	witness string,
+	hash []byte,
+	keys []*btcec.PublicKey,
+	signaturesRequired int,
+) error {
+	// HTLC witness also has the signatures in the 'signatures' field
+	var p2pkWitness P2PKWitness
+	if err := json.Unmarshal([]byte(witness), &p2pkWitness); err != nil || len(p2pkWitness.Signatures) == 0 {
+		return InvalidWitness
+	}
+	if DuplicateSignatures(p2pkWitness.Signatures) {
+		return DuplicateSignaturesErr
+	}
+	if !HasValidSignatures(hash, p2pkWitness.Signatures, signaturesRequired, keys) {
+		return NotEnoughSignaturesErr
+	}
+	return nil
+}
+
+// sigAllSigners returns the keys that can sign the inputs locked with SIG_ALL
+// and the number of signatures required from them
+func sigAllSigners(secret nut10.WellKnownSecret) ([]*btcec.PublicKey, int, error) {
+	switch secret.Kind {
+	case nut10.P2PK:
+		return RequiredSigners(secret)
+	case nut10.HTLC:
+		p2pkTags, err := ParseP2PKTags(secret.Data.Tags)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
+		}
+		if p2pkTags.Locktime > 0 && time.Now().Local().Unix() > p2pkTags.Locktime {
+			if len(p2pkTags.Refund) == 0 {
+				return nil, 0, nil
+			}
+			return p2pkTags.Refund, 1, nil
+		}
+		if p2pkTags.NSigs > 0 {
+			return p2pkTags.Pubkeys, p2pkTags.NSigs, nil
+		}
+		return nil, 0, nil
+	default:
+		return nil, 0, InvalidKindErr
+	}
+}
+
+// RequiredSigners returns the public keys that can sign the P2PK locked proof
+// at this time and the number of signatures required from them. If the locktime
+// has passed and there are no refund keys, anyone can spend it so it returns 0.
+func RequiredSigners(secret nut10.WellKnownSecret) ([]*btcec.PublicKey, int, error) {
+	p2pkTags, err := ParseP2PKTags(secret.Data.Tags)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if p2pkTags.Locktime > 0 && time.Now().Local().Unix() > p2pkTags.Locktime {
+		if len(p2pkTags.Refund) == 0 {
+			return nil, 0, nil
 		}
-		output.Witness = string(witness)
-		outputs[i] = output
+		return p2pkTags.Refund, 1, nil
 	}
 
-	return outputs, nil
+	pubkey, err := ParsePublicKey(secret.Data.Data)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := []*btcec.PublicKey{pubkey}
+	signaturesRequired := 1
+	if p2pkTags.NSigs > 0 {
+		signaturesRequired = p2pkTags.NSigs
+		keys = append(keys, p2pkTags.Pubkeys...)
+	}
+	return keys, signaturesRequired, nil
 }
 
 // PublicKeys returns a list of public keys that can sign
@@ -246,7 +333,7 @@ func ProofsSigAll(proofs cashu.Proofs) bool {
 	for _, proof := range proofs {
 		secret, err := nut10.DeserializeSecret(proof.Secret)
 		if err != nil {
-			return false
+			continue
 		}
 
 		if IsSigAll(secret) {
@@ -274,11 +361,14 @@ func CanSign(secret nut10.WellKnownSecret, key *btcec.PrivateKey) bool {
 		return false
 	}
 
-	if reflect.DeepEqual(publicKey.SerializeCompressed(), key.PubKey().SerializeCompressed()) {
-		return true
-	}
+	return SameSigner(publicKey, key.PubKey())
+}
 
-	return false
+// SameSigner returns true if the keys have the same x coordinate. BIP-340
+// signatures only commit to the x coordinate, so a key given in compressed
+// form and its x-only form are the same signer.
+func SameSigner(a, b *btcec.PublicKey) bool {
+	return bytes.Equal(schnorr.SerializePubKey(a), schnorr.SerializePubKey(b))
 }
 
 func DuplicateSignatures(signatures []string) bool {
@@ -294,8 +384,16 @@ func DuplicateSignatures(signatures []string) bool {
 }
 
 func HasValidSignatures(hash []byte, signatures []string, Nsigs int, pubkeys []*btcec.PublicKey) bool {
-	pubkeysCopy := make([]*btcec.PublicKey, len(pubkeys))
-	copy(pubkeysCopy, pubkeys)
+	// the same key could be listed in compressed and x-only form.
+	// Only count it once so one key cannot provide two signatures.
+	pubkeysCopy := make([]*btcec.PublicKey, 0, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		if !slices.ContainsFunc(pubkeysCopy, func(pk *btcec.PublicKey) bool {
+			return SameSigner(pk, pubkey)
+		}) {
+			pubkeysCopy = append(pubkeysCopy, pubkey)
+		}
+	}
 
 	validSignatures := 0
 	for _, signature := range signatures {
@@ -307,9 +405,7 @@ func HasValidSignatures(hash []byte, signatures []string, Nsigs int, pubkeys []*
 		for i, pubkey := range pubkeysCopy {
 			if sig.Verify(hash, pubkey) {
 				validSignatures++
-				if len(pubkeysCopy) > 1 {
-					pubkeysCopy = slices.Delete(pubkeysCopy, i, i+1)
-				}
+				pubkeysCopy = slices.Delete(pubkeysCopy, i, i+1)
 				break
 			}
 		}
@@ -318,16 +414,11 @@ func HasValidSignatures(hash []byte, signatures []string, Nsigs int, pubkeys []*
 	return validSignatures >= Nsigs
 }
 
+// ParsePublicKey parses a hex encoded public key, either compressed or x-only
 func ParsePublicKey(key string) (*btcec.PublicKey, error) {
-	hexPubkey, err := hex.DecodeString(key)
+	pubkey, err := nut10.ParsePublicKey(key)
 	if err != nil {
-		errmsg := fmt.Sprintf("invalid public key: %v", err)
-		return nil, cashu.BuildCashuError(errmsg, NUT11ErrCode)
-	}
-	pubkey, err := btcec.ParsePubKey(hexPubkey)
-	if err != nil {
-		errmsg := fmt.Sprintf("invalid public key: %v", err)
-		return nil, cashu.BuildCashuError(errmsg, NUT11ErrCode)
+		return nil, cashu.BuildCashuError(err.Error(), NUT11ErrCode)
 	}
 	return pubkey, nil
 }
@@ -347,6 +438,9 @@ func ParseSignature(signature string) (*schnorr.Signature, error) {
 	return sig, nil
 }
 
+// VerifyP2PKLockedProof verifies the signatures in the witness of the proof.
+// Signatures of proofs with SIG_ALL are not on the proof so they need
+// to be verified with the rest of the request using VerifySigAll.
 func VerifyP2PKLockedProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret) error {
 	var p2pkWitness P2PKWitness
 	json.Unmarshal([]byte(proof.Witness), &p2pkWitness)
@@ -355,6 +449,9 @@ func VerifyP2PKLockedProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret)
 	if err != nil {
 		return err
 	}
+	if p2pkTags.Sigflag == SIGALL {
+		return nil
+	}
 
 	signaturesRequired := 1
 	// if locktime is expired and there is no refund pubkey, treat as anyone can spend
@@ -1,10 +1,16 @@
 package nut11
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 )
 
@@ -94,3 +100,339 @@ func TestCanSign(t *testing.T) {
 		}
 	}
 }
+
+func TestRequiredSigners(t *testing.T) {
+	key1, _ := btcec.NewPrivateKey()
+	key2, _ := btcec.NewPrivateKey()
+	refund, _ := btcec.NewPrivateKey()
+	pubkey1 := hex.EncodeToString(key1.PubKey().SerializeCompressed())
+	pubkey2 := hex.EncodeToString(key2.PubKey().SerializeCompressed())
+	refundKey := hex.EncodeToString(refund.PubKey().SerializeCompressed())
+
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	tests := []struct {
+		tags          [][]string
+		expectedKeys  []string
+		expectedNSigs int
+	}{
+		{
+			tags:          [][]string{},
+			expectedKeys:  []string{pubkey1},
+			expectedNSigs: 1,
+		},
+		{
+			// pubkeys only count if n_sigs is set
+			tags:          [][]string{{PUBKEYS, pubkey2}},
+			expectedKeys:  []string{pubkey1},
+			expectedNSigs: 1,
+		},
+		{
+			tags:          [][]string{{NSIGS, "2"}, {PUBKEYS, pubkey2}},
+			expectedKeys:  []string{pubkey1, pubkey2},
+			expectedNSigs: 2,
+		},
+		{
+			tags:          [][]string{{LOCKTIME, future}, {REFUND, refundKey}},
+			expectedKeys:  []string{pubkey1},
+			expectedNSigs: 1,
+		},
+		{
+			tags:          [][]string{{NSIGS, "2"}, {PUBKEYS, pubkey2}, {LOCKTIME, past}, {REFUND, refundKey}},
+			expectedKeys:  []string{refundKey},
+			expectedNSigs: 1,
+		},
+		{
+			tags:          [][]string{{LOCKTIME, past}},
+			expectedKeys:  []string{},
+			expectedNSigs: 0,
+		},
+	}
+
+	for i, test := range tests {
+		secret := nut10.WellKnownSecret{
+			Kind: nut10.P2PK,
+			Data: nut10.SecretData{Data: pubkey1, Tags: test.tags},
+		}
+		pubkeys, nsigs, err := RequiredSigners(secret)
+		if err != nil {
+			t.Fatalf("test %v: unexpected error: %v", i, err)
+		}
+		keys := make([]string, len(pubkeys))
+		for j, pubkey := range pubkeys {
+			keys[j] = hex.EncodeToString(pubkey.SerializeCompressed())
+		}
+		if !slices.Equal(keys, test.expectedKeys) {
+			t.Fatalf("test %v: expected keys %v but got %v", i, test.expectedKeys, keys)
+		}
+		if nsigs != test.expectedNSigs {
+			t.Fatalf("test %v: expected %v signatures but got %v", i, test.expectedNSigs, nsigs)
+		}
+	}
+}
+
+func TestAddSignaturesToInputs(t *testing.T) {
+	key1, _ := btcec.NewPrivateKey()
+	key2, _ := btcec.NewPrivateKey()
+	pubkey1 := hex.EncodeToString(key1.PubKey().SerializeCompressed())
+	pubkey2 := hex.EncodeToString(key2.PubKey().SerializeCompressed())
+
+	secret := nut10.WellKnownSecret{
+		Kind: nut10.P2PK,
+		Data: nut10.SecretData{
+			Nonce: "da62796403af76c80cd6ce9153ed3746",
+			Data:  pubkey1,
+			Tags:  [][]string{{NSIGS, "2"}, {PUBKEYS, pubkey2}},
+		},
+	}
+	serialized, err := nut10.SerializeSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs := cashu.Proofs{{Amount: 1, Secret: serialized}}
+
+	proofs, err = AddSignaturesToInputs(proofs, []*btcec.PrivateKey{key1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := VerifyP2PKLockedProof(proofs[0], secret); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+
+	proofs, err = AddSignaturesToInputs(proofs, []*btcec.PrivateKey{key1, key2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := VerifyP2PKLockedProof(proofs[0], secret); err != nil {
+		t.Fatalf("unexpected error verifying signatures: %v", err)
+	}
+}
+
+// valid proof from the NUT-11 test vectors
+func TestVerifyP2PKLockedProofVector(t *testing.T) {
+	proof := cashu.Proof{
+		Amount:  1,
+		Secret:  `["P2PK",{"nonce":"859d4935c4907062a6297cf4e663e2835d90d97ecdd510745d32f6816323a41f","data":"0249098aa8b9d2fbec49ff8598feb17b592b986e62319a4fa488a3dc36387157a7","tags":[["sigflag","SIG_INPUTS"]]}]`,
+		Witness: `{"signatures":["60f3c9b766770b46caac1d27e1ae6b77c8866ebaeba0b9489fe6a15a837eaa6fcd6eaa825499c72ac342983983fd3ba3a8a41f56677cc99ffd73da68b59e1383"]}`,
+	}
+	secret, err := nut10.DeserializeSecret(proof.Secret)
+	if err != nil {
+		t.Fatalf("unexpected error deserializing secret: %v", err)
+	}
+	if err := VerifyP2PKLockedProof(proof, secret); err != nil {
+		t.Fatalf("unexpected error verifying proof: %v", err)
+	}
+
+	// signature is not valid for another secret locked to the same key
+	proof.Secret = `["P2PK",{"nonce":"0ed3fcb22c649dd7bbbdcca36e0c52d4f0187dd3b6a19efcc2bfbebb5f85b2a1","data":"0249098aa8b9d2fbec49ff8598feb17b592b986e62319a4fa488a3dc36387157a7","tags":[["sigflag","SIG_INPUTS"]]}]`
+	secret, err = nut10.DeserializeSecret(proof.Secret)
+	if err != nil {
+		t.Fatalf("unexpected error deserializing secret: %v", err)
+	}
+	if err := VerifyP2PKLockedProof(proof, secret); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+}
+
+func TestXOnlyPublicKeys(t *testing.T) {
+	key1, _ := btcec.NewPrivateKey()
+	key2, _ := btcec.NewPrivateKey()
+	xOnly1 := hex.EncodeToString(schnorr.SerializePubKey(key1.PubKey()))
+	xOnly2 := hex.EncodeToString(schnorr.SerializePubKey(key2.PubKey()))
+
+	secret := nut10.WellKnownSecret{
+		Kind: nut10.P2PK,
+		Data: nut10.SecretData{
+			Nonce: "da62796403af76c80cd6ce9153ed3746",
+			Data:  xOnly1,
+			Tags:  [][]string{{NSIGS, "2"}, {PUBKEYS, xOnly2}},
+		},
+	}
+	if !CanSign(secret, key1) {
+		t.Fatal("expected key to be able to sign secret locked to its x-only public key")
+	}
+
+	serialized, err := nut10.SerializeSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs := cashu.Proofs{{Amount: 1, Secret: serialized}}
+	proofs, err = AddSignaturesToInputs(proofs, []*btcec.PrivateKey{key1, key2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := VerifyP2PKLockedProof(proofs[0], secret); err != nil {
+		t.Fatalf("unexpected error verifying signatures: %v", err)
+	}
+
+	// same key listed in compressed and x-only form can only provide one signature
+	hash := sha256.Sum256([]byte(serialized))
+	sig1, _ := schnorr.Sign(key1, hash[:], schnorr.CustomNonce([32]byte{1}))
+	sig2, _ := schnorr.Sign(key1, hash[:], schnorr.CustomNonce([32]byte{2}))
+	signatures := []string{hex.EncodeToString(sig1.Serialize()), hex.EncodeToString(sig2.Serialize())}
+	xOnlyKey, err := ParsePublicKey(xOnly1)
+	if err != nil {
+		t.Fatalf("unexpected error parsing x-only key: %v", err)
+	}
+	if HasValidSignatures(hash[:], signatures, 2, []*btcec.PublicKey{key1.PubKey(), xOnlyKey}) {
+		t.Fatal("expected signatures from the same key to only count once")
+	}
+}
+
+func TestSigAllMessage(t *testing.T) {
+	inputs := cashu.Proofs{
+		{
+			Amount: 2,
+			Id:     "009a1f293253e41e",
+			Secret: `["P2PK",{"nonce":"c7f280eb55c1e8564e03db06973e94bc9b666d9e1ca42ad278408fe625950303","data":"030d8acedfe072c9fa449a1efe0817157403fbec460d8e79f957966056e5dd76c1","tags":[["sigflag","SIG_ALL"]]}]`,
+			C:      "02698c4e2b5f9534cd0687d87513c759790cf829aa5739184a3e3735471fbda904",
+		},
+		{
+			Amount: 8,
+			Id:     "009a1f293253e41e",
+			Secret: `["P2PK",{"nonce":"2b6f9d3c8cd2a7e5d8b9b4a0f3c1e7d6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0","data":"030d8acedfe072c9fa449a1efe0817157403fbec460d8e79f957966056e5dd76c1","tags":[["sigflag","SIG_ALL"]]}]`,
+			C:      "0344d0e6a0b3ec9a0ea1a0b1bdc29b0b71b1da6b9cf58a06e1b0ab8e5c8b1e4a70",
+		},
+	}
+	outputs := cashu.BlindedMessages{
+		{Amount: 2, Id: "009a1f293253e41e", B_: "038ec853d65ae1b79b5cdbc2774150b2cb288d6d26e12958a16fb33c32d9a86c39"},
+		{Amount: 8, Id: "009a1f293253e41e", B_: "03c4d6d6da9bb47e5f4aa0ca21bb7fb6ed4bd3a0e5bd0f2d88c0a8b2f5cb3a2d15"},
+	}
+
+	// secret_0 || C_0 || secret_1 || C_1 || amount_0 || id_0 || B_0 || amount_1 || id_1 || B_1
+	expected := `["P2PK",{"nonce":"c7f280eb55c1e8564e03db06973e94bc9b666d9e1ca42ad278408fe625950303","data":"030d8acedfe072c9fa449a1efe0817157403fbec460d8e79f957966056e5dd76c1","tags":[["sigflag","SIG_ALL"]]}]` +
+		`02698c4e2b5f9534cd0687d87513c759790cf829aa5739184a3e3735471fbda904` +
+		`["P2PK",{"nonce":"2b6f9d3c8cd2a7e5d8b9b4a0f3c1e7d6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0","data":"030d8acedfe072c9fa449a1efe0817157403fbec460d8e79f957966056e5dd76c1","tags":[["sigflag","SIG_ALL"]]}]` +
+		`0344d0e6a0b3ec9a0ea1a0b1bdc29b0b71b1da6b9cf58a06e1b0ab8e5c8b1e4a70` +
+		`2009a1f293253e41e038ec853d65ae1b79b5cdbc2774150b2cb288d6d26e12958a16fb33c32d9a86c39` +
+		`8009a1f293253e41e03c4d6d6da9bb47e5f4aa0ca21bb7fb6ed4bd3a0e5bd0f2d88c0a8b2f5cb3a2d15`
+	if msg := string(SigAllMessage(inputs, outputs)); msg != expected {
+		t.Fatalf("expected message '%v' but got '%v'", expected, msg)
+	}
+}
+
+func TestSigAll(t *testing.T) {
+	key1, _ := btcec.NewPrivateKey()
+	key2, _ := btcec.NewPrivateKey()
+
+	spendingCondition, err := nut10.NewP2PKSecret(key1.PubKey()).
+		WithSigAll().
+		WithNSigs(2).
+		WithPubkeys(key2.PubKey()).
+		SpendingCondition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret1, _ := nut10.NewSecretFromSpendingCondition(spendingCondition)
+	secret2, _ := nut10.NewSecretFromSpendingCondition(spendingCondition)
+	inputs := cashu.Proofs{
+		{Amount: 1, Id: "009a1f293253e41e", Secret: secret1, C: hex.EncodeToString(key2.PubKey().SerializeCompressed())},
+		{Amount: 2, Id: "009a1f293253e41e", Secret: secret2, C: hex.EncodeToString(key1.PubKey().SerializeCompressed())},
+	}
+	outputs := cashu.BlindedMessages{
+		{Amount: 1, Id: "009a1f293253e41e", B_: hex.EncodeToString(key1.PubKey().SerializeCompressed())},
+		{Amount: 2, Id: "009a1f293253e41e", B_: hex.EncodeToString(key2.PubKey().SerializeCompressed())},
+	}
+
+	// signatures are not verified on each input
+	for _, proof := range inputs {
+		wellKnownSecret, _ := nut10.DeserializeSecret(proof.Secret)
+		if err := VerifyP2PKLockedProof(proof, wellKnownSecret); err != nil {
+			t.Fatalf("unexpected error verifying SIG_ALL input: %v", err)
+		}
+	}
+	if err := VerifySigAll(inputs, outputs); err != InvalidWitness {
+		t.Fatalf("expected error '%v' but got '%v'", InvalidWitness, err)
+	}
+
+	inputs, err = AddSigAllSignatures(inputs, outputs, []*btcec.PrivateKey{key1})
+	if err != nil {
+		t.Fatalf("unexpected error signing: %v", err)
+	}
+	if err := VerifySigAll(inputs, outputs); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+
+	inputs, err = AddSigAllSignatures(inputs, outputs, []*btcec.PrivateKey{key1, key2})
+	if err != nil {
+		t.Fatalf("unexpected error signing: %v", err)
+	}
+	if err := VerifySigAll(inputs, outputs); err != nil {
+		t.Fatalf("unexpected error verifying signatures: %v", err)
+	}
+
+	// outputs changed after signing
+	changedOutputs := cashu.BlindedMessages{outputs[1], outputs[0]}
+	if err := VerifySigAll(inputs, changedOutputs); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+	changedOutputs = cashu.BlindedMessages{outputs[0], outputs[1]}
+	changedOutputs[1].Amount = 4
+	if err := VerifySigAll(inputs, changedOutputs); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+	changedOutputs[1] = outputs[1]
+	changedOutputs[1].Id = "00ad268c4d1f5826"
+	if err := VerifySigAll(inputs, changedOutputs); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+	changedInputs := cashu.Proofs{inputs[0], inputs[1]}
+	changedInputs[1].C = inputs[0].C
+	if err := VerifySigAll(changedInputs, outputs); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+
+	// inputs with different conditions
+	otherSecret, _ := nut10.NewP2PKSecret(key2.PubKey()).WithSigAll().Build()
+	mixedInputs := cashu.Proofs{inputs[0], {Amount: 4, Secret: otherSecret}}
+	if err := VerifySigAll(mixedInputs, outputs); err != SigAllConditionsErr {
+		t.Fatalf("expected error '%v' but got '%v'", SigAllConditionsErr, err)
+	}
+
+	// not all inputs with SIG_ALL
+	sigInputsSecret, _ := nut10.NewP2PKSecret(key1.PubKey()).Build()
+	mixedInputs = cashu.Proofs{{Amount: 4, Secret: "regularsecret"}, {Amount: 4, Secret: sigInputsSecret}, inputs[0]}
+	if !ProofsSigAll(mixedInputs) {
+		t.Fatal("expected proofs to have SIG_ALL")
+	}
+	if err := VerifySigAll(mixedInputs, outputs); err != AllSigAllFlagsErr {
+		t.Fatalf("expected error '%v' but got '%v'", AllSigAllFlagsErr, err)
+	}
+}
+
+func TestSigAllPerOutput(t *testing.T) {
+	key1, _ := btcec.NewPrivateKey()
+	key2, _ := btcec.NewPrivateKey()
+
+	secret1, _ := nut10.NewP2PKSecret(key1.PubKey()).WithSigAll().WithNSigs(2).WithPubkeys(key2.PubKey()).Build()
+	secret2 := secret1
+	inputs := cashu.Proofs{{Amount: 1, Secret: secret1}, {Amount: 2, Secret: secret2}}
+	outputs := cashu.BlindedMessages{
+		{Amount: 1, B_: hex.EncodeToString(key1.PubKey().SerializeCompressed())},
+		{Amount: 2, B_: hex.EncodeToString(key2.PubKey().SerializeCompressed())},
+	}
+	signingKeys := []*btcec.PrivateKey{key1, key2}
+
+	// signatures on each input and output separately, as in the previous
+	// version of NUT-11, do not commit to the amounts, C and keyset ids
+	inputs, _ = AddSignaturesToInputs(inputs, signingKeys)
+	for i, output := range outputs {
+		B_, _ := hex.DecodeString(output.B_)
+		hash := sha256.Sum256(B_)
+		witness, err := signWitness(hash[:], signingKeys)
+		if err != nil {
+			t.Fatalf("unexpected error signing output: %v", err)
+		}
+		outputs[i].Witness = witness
+	}
+	if err := VerifySigAll(inputs, outputs); err != NotEnoughSignaturesErr {
+		t.Fatalf("expected error '%v' but got '%v'", NotEnoughSignaturesErr, err)
+	}
+
+	// witness in the outputs is ignored
+	inputs, _ = AddSigAllSignatures(inputs, outputs, signingKeys)
+	if err := VerifySigAll(inputs, outputs); err != nil {
+		t.Fatalf("unexpected error verifying signatures: %v", err)
+	}
+}
@@ -32,39 +32,7 @@ func VerifyProofDLEQ(
 	proof cashu.Proof,
 	A *secp256k1.PublicKey,
 ) bool {
-	e, s, r, err := ParseDLEQ(*proof.DLEQ)
-	if err != nil || r == nil {
-		return false
-	}
-
-	B_, _, err := crypto.BlindMessage(proof.Secret, r)
-	if err != nil {
-		return false
-	}
-
-	CBytes, err := hex.DecodeString(proof.C)
-	if err != nil {
-		return false
-	}
-
-	C, err := secp256k1.ParsePubKey(CBytes)
-	if err != nil {
-		return false
-	}
-
-	var CPoint, APoint secp256k1.JacobianPoint
-	C.AsJacobian(&CPoint)
-	A.AsJacobian(&APoint)
-
-	// C' = C + r*A
-	var C_Point, rAPoint secp256k1.JacobianPoint
-	secp256k1.ScalarMultNonConst(&r.Key, &APoint, &rAPoint)
-	rAPoint.ToAffine()
-	secp256k1.AddNonConst(&CPoint, &rAPoint, &C_Point)
-	C_Point.ToAffine()
-	C_ := secp256k1.NewPublicKey(&C_Point.X, &C_Point.Y)
-
-	return crypto.VerifyDLEQ(e, s, A, B_, C_)
+	return cashu.VerifyProofDLEQ(proof, A) == nil
 }
 
 func VerifyBlindSignatureDLEQ(
@@ -105,27 +73,5 @@ func ParseDLEQ(dleq cashu.DLEQProof) (
 	*secp256k1.PrivateKey,
 	error,
 ) {
-	ebytes, err := hex.DecodeString(dleq.E)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-	e := secp256k1.PrivKeyFromBytes(ebytes)
-
-	sbytes, err := hex.DecodeString(dleq.S)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-	s := secp256k1.PrivKeyFromBytes(sbytes)
-
-	if dleq.R == "" {
-		return e, s, nil, nil
-	}
-
-	rbytes, err := hex.DecodeString(dleq.R)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-	r := secp256k1.PrivKeyFromBytes(rbytes)
-
-	return e, s, r, nil
+	return dleq.Parse()
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/internal/keys"
 )
 
 func DeriveKeysetPath(master *hdkeychain.ExtendedKey, keysetId string) (*hdkeychain.ExtendedKey, error) {
@@ -16,36 +17,13 @@ func DeriveKeysetPath(master *hdkeychain.ExtendedKey, keysetId string) (*hdkeych
 	bigEndianBytes := binary.BigEndian.Uint64(keysetBytes)
 	keysetIdInt := bigEndianBytes % (1<<31 - 1)
 
-	// m/129372
-	purpose, err := master.Derive(hdkeychain.HardenedKeyStart + 129372)
-	if err != nil {
-		return nil, err
-	}
-
-	// m/129372'/0'
-	coinType, err := purpose.Derive(hdkeychain.HardenedKeyStart + 0)
-	if err != nil {
-		return nil, err
-	}
-
 	// m/129372'/0'/keyset_k_int'
-	keysetPath, err := coinType.Derive(hdkeychain.HardenedKeyStart + uint32(keysetIdInt))
-	if err != nil {
-		return nil, err
-	}
-
-	return keysetPath, nil
+	return keys.DerivePath(master, keys.Hardened(129372), keys.Hardened(0), keys.Hardened(uint32(keysetIdInt)))
 }
 
 func DeriveBlindingFactor(keysetPath *hdkeychain.ExtendedKey, counter uint32) (*secp256k1.PrivateKey, error) {
-	// m/129372'/0'/keyset_k_int'/counter'
-	counterPath, err := keysetPath.Derive(hdkeychain.HardenedKeyStart + counter)
-	if err != nil {
-		return nil, err
-	}
-
 	// m/129372'/0'/keyset_k_int'/counter'/1
-	rDerivationPath, err := counterPath.Derive(1)
+	rDerivationPath, err := keys.DerivePath(keysetPath, keys.Hardened(counter), 1)
 	if err != nil {
 		return nil, err
 	}
@@ -59,14 +37,8 @@ func DeriveBlindingFactor(keysetPath *hdkeychain.ExtendedKey, counter uint32) (*
 }
 
 func DeriveSecret(keysetPath *hdkeychain.ExtendedKey, counter uint32) (string, error) {
-	// m/129372'/0'/keyset_k_int'/counter'
-	counterPath, err := keysetPath.Derive(hdkeychain.HardenedKeyStart + counter)
-	if err != nil {
-		return "", err
-	}
-
 	// m/129372'/0'/keyset_k_int'/counter'/0
-	secretDerivationPath, err := counterPath.Derive(0)
+	secretDerivationPath, err := keys.DerivePath(keysetPath, keys.Hardened(counter), 0)
 	if err != nil {
 		return "", err
 	}
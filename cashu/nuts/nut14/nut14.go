@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"slices"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
@@ -13,6 +12,7 @@ import (
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/crypto"
 )
 
 const (
@@ -25,6 +25,10 @@ var (
 	InvalidHashErr     = cashu.Error{Detail: "Invalid hash in secret", Code: NUT14ErrCode}
 )
 
+func init() {
+	cashu.DefineErrors(InvalidPreimageErr, InvalidHashErr)
+}
+
 type HTLCWitness struct {
 	Preimage   string   `json:"preimage"`
 	Signatures []string `json:"signatures"`
@@ -51,11 +55,10 @@ func AddWitnessHTLC(
 			return nil, errors.New("unable to provide enough signatures")
 		}
 
-		publicKey := signingKey.PubKey().SerializeCompressed()
 		canSign := false
 		// read pubkeys and check signingKey can sign
 		for _, pk := range tags.Pubkeys {
-			if slices.Equal(pk.SerializeCompressed(), publicKey) {
+			if nut11.SameSigner(pk, signingKey.PubKey()) {
 				canSign = true
 				break
 			}
@@ -90,34 +93,52 @@ func AddWitnessHTLC(
 	return proofs, nil
 }
 
-func AddWitnessHTLCToOutputs(
+// AddSigAllWitnessHTLC adds the preimage to the witness of the inputs locked with
+// SIG_ALL. If the HTLC requires a signature, the signature of the key on the
+// message from nut11.SigAllMessage is added to the witness of the first input.
+// The outputs cannot change after signing.
+func AddSigAllWitnessHTLC(
+	inputs cashu.Proofs,
 	outputs cashu.BlindedMessages,
 	preimage string,
 	signingKey *btcec.PrivateKey,
-) (cashu.BlindedMessages, error) {
-	for i, output := range outputs {
-		hash := sha256.Sum256([]byte(output.B_))
-		signature, err := schnorr.Sign(signingKey, hash[:])
-		if err != nil {
-			return nil, err
-		}
+) (cashu.Proofs, error) {
+	if len(inputs) == 0 {
+		return inputs, nil
+	}
+	secret, err := nut10.DeserializeSecret(inputs[0].Secret)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := nut11.ParseP2PKTags(secret.Data.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if tags.NSigs > 1 {
+		return nil, errors.New("unable to provide enough signatures")
+	}
 
-		htlcWitness := HTLCWitness{
-			Preimage:   preimage,
-			Signatures: []string{hex.EncodeToString(signature.Serialize())},
+	for i, proof := range inputs {
+		htlcWitness := HTLCWitness{Preimage: preimage}
+		if i == 0 && tags.NSigs > 0 {
+			htlcWitness.Signatures, err = nut11.SigAllSignatures(inputs, outputs, []*btcec.PrivateKey{signingKey})
+			if err != nil {
+				return nil, err
+			}
 		}
-
 		witness, err := json.Marshal(htlcWitness)
 		if err != nil {
 			return nil, err
 		}
-		output.Witness = string(witness)
-		outputs[i] = output
+		proof.Witness = string(witness)
+		inputs[i] = proof
 	}
-
-	return outputs, nil
+	return inputs, nil
 }
 
+// VerifyHTLCProof verifies the preimage and signatures in the witness of the proof.
+// Signatures of proofs with SIG_ALL are not on the proof so they need to be
+// verified with the rest of the request using nut11.VerifySigAll.
 func VerifyHTLCProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret) error {
 	var htlcWitness HTLCWitness
 	json.Unmarshal([]byte(proof.Witness), &htlcWitness)
@@ -126,11 +147,12 @@ func VerifyHTLCProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret) error
 	if err != nil {
 		return err
 	}
+	sigAll := p2pkTags.Sigflag == nut11.SIGALL
 
 	// if locktime is expired and there is no refund pubkey, treat as anyone can spend
 	// if refund pubkey present, check signature
 	if p2pkTags.Locktime > 0 && time.Now().Local().Unix() > p2pkTags.Locktime {
-		if len(p2pkTags.Refund) == 0 {
+		if len(p2pkTags.Refund) == 0 || sigAll {
 			return nil
 		} else {
 			hash := sha256.Sum256([]byte(proof.Secret))
@@ -155,12 +177,12 @@ func VerifyHTLCProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret) error
 	if len(proofSecret.Data.Data) != 64 {
 		return InvalidHashErr
 	}
-	if hash != proofSecret.Data.Data {
+	if !crypto.ConstantTimeEqual(hash, proofSecret.Data.Data) {
 		return InvalidPreimageErr
 	}
 
 	// if n_sigs flag present, verify signatures
-	if p2pkTags.NSigs > 0 {
+	if p2pkTags.NSigs > 0 && !sigAll {
 		if len(htlcWitness.Signatures) < 1 {
 			return nut11.NoSignaturesErr
 		}
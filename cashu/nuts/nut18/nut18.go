@@ -0,0 +1,95 @@
+// Package nut18 implements payment requests as defined in NUT-18
+// https://github.com/cashubtc/nuts/blob/main/18.md
+package nut18
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	PaymentRequestPrefix = "creq"
+	PaymentRequestV1     = "A"
+
+	NostrTransport TransportType = "nostr"
+	PostTransport  TransportType = "post"
+)
+
+var (
+	ErrInvalidPaymentRequest = errors.New("invalid payment request")
+)
+
+type TransportType string
+
+// Transport specifies how the payment for a request should be sent
+type Transport struct {
+	Type TransportType `json:"t" cbor:"t"`
+	// target of the transport. Nostr nprofile or URL for post
+	Target string     `json:"a" cbor:"a"`
+	Tags   [][]string `json:"g,omitempty" cbor:"g,omitempty"`
+}
+
+type PaymentRequest struct {
+	Id          string      `json:"i,omitempty" cbor:"i,omitempty"`
+	Amount      uint64      `json:"a,omitempty" cbor:"a,omitempty"`
+	Unit        string      `json:"u,omitempty" cbor:"u,omitempty"`
+	SingleUse   bool        `json:"s,omitempty" cbor:"s,omitempty"`
+	Mints       []string    `json:"m,omitempty" cbor:"m,omitempty"`
+	Description string      `json:"d,omitempty" cbor:"d,omitempty"`
+	Transports  []Transport `json:"t,omitempty" cbor:"t,omitempty"`
+}
+
+// Encode returns the payment request serialized as 'creqA' + base64 url-safe CBOR
+func (pr PaymentRequest) Encode() (string, error) {
+	cborData, err := cbor.Marshal(pr)
+	if err != nil {
+		return "", err
+	}
+	return PaymentRequestPrefix + PaymentRequestV1 + base64.URLEncoding.EncodeToString(cborData), nil
+}
+
+func DecodePaymentRequest(request string) (*PaymentRequest, error) {
+	encoded, found := strings.CutPrefix(request, PaymentRequestPrefix+PaymentRequestV1)
+	if !found {
+		return nil, ErrInvalidPaymentRequest
+	}
+
+	cborData, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		cborData, err = base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding payment request: %v", err)
+		}
+	}
+
+	var paymentRequest PaymentRequest
+	if err := cbor.Unmarshal(cborData, &paymentRequest); err != nil {
+		return nil, fmt.Errorf("cbor.Unmarshal: %v", err)
+	}
+
+	return &paymentRequest, nil
+}
+
+// Transport returns the first transport in the request of the type passed
+func (pr PaymentRequest) Transport(transportType TransportType) (Transport, bool) {
+	for _, transport := range pr.Transports {
+		if transport.Type == transportType {
+			return transport, true
+		}
+	}
+	return Transport{}, false
+}
+
+// PaymentRequestPayload is sent through the transport to pay a request
+type PaymentRequestPayload struct {
+	Id     string       `json:"id,omitempty"`
+	Memo   string       `json:"memo,omitempty"`
+	Mint   string       `json:"mint"`
+	Unit   string       `json:"unit"`
+	Proofs cashu.Proofs `json:"proofs"`
+}
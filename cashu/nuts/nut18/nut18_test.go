@@ -0,0 +1,92 @@
+package nut18
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPaymentRequestEncodeDecode(t *testing.T) {
+	paymentRequest := PaymentRequest{
+		Id:          "b7a90176",
+		Amount:      10,
+		Unit:        "sat",
+		SingleUse:   true,
+		Mints:       []string{"https://8333.space:3338"},
+		Description: "coffee",
+		Transports: []Transport{
+			{
+				Type:   NostrTransport,
+				Target: "nprofile1qy28wumn8ghj7un9d3shjtnyv9kh2uewd9hsz9mhwden5te0wfjkccte9curxven9eehqctrv5hszrthwden5te0dehhxtnvdakqqgydaqy7curk439ykptkysv7udhdhu68sucm295akqefdehkf0d495cwunl5",
+				Tags:   [][]string{{"n", "17"}},
+			},
+			{
+				Type:   PostTransport,
+				Target: "https://api.example.com/v1/payment",
+			},
+		},
+	}
+
+	encoded, err := paymentRequest.Encode()
+	if err != nil {
+		t.Fatalf("unexpected error encoding payment request: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "creqA") {
+		t.Fatalf("expected payment request with prefix 'creqA' but got '%v'", encoded)
+	}
+
+	decoded, err := DecodePaymentRequest(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error decoding payment request: %v", err)
+	}
+	if !reflect.DeepEqual(paymentRequest, *decoded) {
+		t.Fatalf("expected payment request '%+v' but got '%+v'", paymentRequest, *decoded)
+	}
+
+	transport, ok := decoded.Transport(PostTransport)
+	if !ok {
+		t.Fatal("expected payment request to have post transport")
+	}
+	if transport.Target != "https://api.example.com/v1/payment" {
+		t.Fatalf("expected post target 'https://api.example.com/v1/payment' but got '%v'", transport.Target)
+	}
+
+	// empty optional fields
+	minimal := PaymentRequest{Amount: 21}
+	encoded, err = minimal.Encode()
+	if err != nil {
+		t.Fatalf("unexpected error encoding payment request: %v", err)
+	}
+	decoded, err = DecodePaymentRequest(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error decoding payment request: %v", err)
+	}
+	if !reflect.DeepEqual(minimal, *decoded) {
+		t.Fatalf("expected payment request '%+v' but got '%+v'", minimal, *decoded)
+	}
+	if _, ok := decoded.Transport(NostrTransport); ok {
+		t.Fatal("expected payment request without nostr transport")
+	}
+}
+
+func TestDecodePaymentRequestInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"creqB",
+		"cashuBpGF0",
+		"creqA!!!",
+	}
+
+	for _, test := range tests {
+		_, err := DecodePaymentRequest(test)
+		if err == nil {
+			t.Fatalf("expected error decoding invalid payment request '%v'", test)
+		}
+	}
+
+	_, err := DecodePaymentRequest("creqB")
+	if !errors.Is(err, ErrInvalidPaymentRequest) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidPaymentRequest, err)
+	}
+}
@@ -0,0 +1,147 @@
+package cashu
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+)
+
+// TokenInfo describes the content of a token so it can
+// be inspected before redeeming it
+type TokenInfo struct {
+	Mint       string
+	Unit       string
+	Memo       string
+	Amount     uint64
+	ProofCount int
+	KeysetIds  []string
+	// number of proofs that include a DLEQ proof
+	DLEQCount int
+	// spending conditions of locked proofs. Proofs locked
+	// to the same conditions are grouped together
+	Locks []TokenLock
+}
+
+// TokenLock is a NUT-10 spending condition that proofs in the token are locked to
+type TokenLock struct {
+	// P2PK or HTLC
+	Kind nut10.SecretKind
+	// public key for P2PK or hash of the preimage for HTLC
+	Data string
+	// additional keys that can sign from the pubkeys tag
+	PublicKeys []string
+	// number of signatures required
+	NSigs    int
+	SigAll   bool
+	Locktime int64
+	// keys that can spend the proofs after the locktime
+	RefundKeys []string
+	ProofCount int
+	Amount     uint64
+}
+
+// DecodeTokenInfo decodes the token and returns a description of it
+func DecodeTokenInfo(tokenstr string) (*TokenInfo, error) {
+	token, err := DecodeToken(tokenstr)
+	if err != nil {
+		return nil, err
+	}
+	return GetTokenInfo(token), nil
+}
+
+// GetTokenInfo returns a description of the token
+func GetTokenInfo(token Token) *TokenInfo {
+	info := &TokenInfo{
+		Mint:      token.Mint(),
+		Unit:      TokenUnit(token),
+		Amount:    token.Amount(),
+		KeysetIds: []string{},
+		Locks:     []TokenLock{},
+	}
+	switch t := token.(type) {
+	case TokenV3:
+		info.Memo = t.Memo
+	case *TokenV3:
+		info.Memo = t.Memo
+	case TokenV4:
+		info.Memo = t.Memo
+	case *TokenV4:
+		info.Memo = t.Memo
+	}
+
+	proofs := token.Proofs()
+	info.ProofCount = len(proofs)
+	for _, proof := range proofs {
+		if !slices.Contains(info.KeysetIds, proof.Id) {
+			info.KeysetIds = append(info.KeysetIds, proof.Id)
+		}
+		if proof.DLEQ != nil {
+			info.DLEQCount++
+		}
+
+		secret, err := nut10.DeserializeSecret(proof.Secret)
+		if err != nil || (secret.Kind != nut10.P2PK && secret.Kind != nut10.HTLC) {
+			continue
+		}
+		lock := tokenLock(secret)
+		i := slices.IndexFunc(info.Locks, func(l TokenLock) bool {
+			return l.Kind == lock.Kind && l.Data == lock.Data &&
+				slices.Equal(l.PublicKeys, lock.PublicKeys) && l.NSigs == lock.NSigs &&
+				l.SigAll == lock.SigAll && l.Locktime == lock.Locktime &&
+				slices.Equal(l.RefundKeys, lock.RefundKeys)
+		})
+		if i < 0 {
+			info.Locks = append(info.Locks, lock)
+			i = len(info.Locks) - 1
+		}
+		info.Locks[i].ProofCount++
+		info.Locks[i].Amount += proof.Amount
+	}
+
+	return info
+}
+
+// TokenUnit returns the unit of the token. Tokens that
+// do not specify one are assumed to be in sat.
+func TokenUnit(token Token) string {
+	var unit string
+	switch t := token.(type) {
+	case TokenV3:
+		unit = t.Unit
+	case *TokenV3:
+		unit = t.Unit
+	case TokenV4:
+		unit = t.Unit
+	case *TokenV4:
+		unit = t.Unit
+	}
+	if len(unit) == 0 {
+		return Sat.String()
+	}
+	return unit
+}
+
+// tokenLock reads the tags of the secret. Invalid
+// tags are ignored since the mint will reject them.
+func tokenLock(secret nut10.WellKnownSecret) TokenLock {
+	lock := TokenLock{Kind: secret.Kind, Data: secret.Data.Data}
+	for _, tag := range secret.Data.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case nut10.PUBKEYS:
+			lock.PublicKeys = tag[1:]
+		case nut10.NSIGS:
+			lock.NSigs, _ = strconv.Atoi(tag[1])
+		case nut10.SIGFLAG:
+			lock.SigAll = tag[1] == nut10.SIGALL
+		case nut10.LOCKTIME:
+			lock.Locktime, _ = strconv.ParseInt(tag[1], 10, 64)
+		case nut10.REFUND:
+			lock.RefundKeys = tag[1:]
+		}
+	}
+	return lock
+}
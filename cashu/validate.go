@@ -0,0 +1,120 @@
+package cashu
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// ValidAmount returns true if the amount is a power of two
+// that a keyset can have a key for
+func ValidAmount(amount uint64) bool {
+	return amount != 0 && amount&(amount-1) == 0 && amount < 1<<MAX_ORDER
+}
+
+// Validate performs structural checks on the proofs. It does not verify
+// the signatures or spending conditions. It checks that:
+// - amounts are powers of two within the range of a keyset
+// - secrets are not too long
+// - C and DLEQ fields are valid hex
+// - witness, if present, is a JSON object
+// - there are no duplicate proofs
+func (proofs Proofs) Validate() error {
+	for _, proof := range proofs {
+		if !ValidAmount(proof.Amount) {
+			return InvalidProofAmount
+		}
+		if len(proof.Secret) == 0 {
+			return BuildCashuError("proof secret cannot be empty", StandardErrCode)
+		}
+		if len(proof.Secret) > MAX_SECRET_LENGTH {
+			return SecretTooLongErr
+		}
+		if err := validatePublicKey(proof.C); err != nil {
+			return BuildCashuError(fmt.Sprintf("invalid C: %v", err), StandardErrCode)
+		}
+		if err := validateWitness(proof.Witness); err != nil {
+			return err
+		}
+		if proof.DLEQ != nil {
+			if err := proof.DLEQ.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if CheckDuplicateProofs(proofs) {
+		return DuplicateProofs
+	}
+	return nil
+}
+
+// Validate performs structural checks on the blinded messages. It checks that:
+// - amounts are powers of two within the range of a keyset
+// - B_ is a valid public key
+// - witness, if present, is a JSON object
+// - there are no duplicate blinded messages
+func (bm BlindedMessages) Validate() error {
+	return bm.validate(false)
+}
+
+// ValidateBlankOutputs is the same as Validate but it allows amounts of 0 for
+// the blank outputs of a melt request (NUT-08), which get their amount assigned by the mint
+func (bm BlindedMessages) ValidateBlankOutputs() error {
+	return bm.validate(true)
+}
+
+func (bm BlindedMessages) validate(allowZeroAmount bool) error {
+	for _, msg := range bm {
+		if !ValidAmount(msg.Amount) && !(allowZeroAmount && msg.Amount == 0) {
+			return InvalidBlindedMessageAmount
+		}
+		if err := validatePublicKey(msg.B_); err != nil {
+			return BuildCashuError(fmt.Sprintf("invalid B_: %v", err), StandardErrCode)
+		}
+		if err := validateWitness(msg.Witness); err != nil {
+			return err
+		}
+	}
+
+	if CheckDuplicateBlindedMessages(bm) {
+		return DuplicateOutputs
+	}
+	return nil
+}
+
+func (dleq DLEQProof) validate() error {
+	if _, err := hex.DecodeString(dleq.E); err != nil {
+		return BuildCashuError(fmt.Sprintf("invalid DLEQ e: %v", err), StandardErrCode)
+	}
+	if _, err := hex.DecodeString(dleq.S); err != nil {
+		return BuildCashuError(fmt.Sprintf("invalid DLEQ s: %v", err), StandardErrCode)
+	}
+	// r is only included when sending the proof to another wallet
+	if _, err := hex.DecodeString(dleq.R); err != nil {
+		return BuildCashuError(fmt.Sprintf("invalid DLEQ r: %v", err), StandardErrCode)
+	}
+	return nil
+}
+
+func validatePublicKey(key string) error {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil {
+		return err
+	}
+	_, err = secp256k1.ParsePubKey(keyBytes)
+	return err
+}
+
+func validateWitness(witness string) error {
+	if len(witness) == 0 {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(witness), &fields); err != nil {
+		return BuildCashuError("witness must be a JSON object", StandardErrCode)
+	}
+	return nil
+}
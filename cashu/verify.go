@@ -0,0 +1,146 @@
+package cashu
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+var (
+	ErrEmptyToken       = errors.New("token does not have proofs")
+	ErrMissingDLEQ      = errors.New("proof does not have a DLEQ proof")
+	ErrInvalidDLEQ      = errors.New("invalid DLEQ proof")
+	ErrKeysetIdMismatch = errors.New("keyset id does not match the keys")
+	ErrTokenAmount      = errors.New("token amount is less than expected")
+)
+
+// OfflineVerifyOptions are the options for VerifyTokenOffline
+type OfflineVerifyOptions struct {
+	// RequireDLEQ fails the verification for proofs without a DLEQ proof.
+	// If not set, proofs without one are only checked for keyset and amount.
+	RequireDLEQ bool
+	// Amount, if set, is the minimum amount the token needs to have
+	Amount uint64
+}
+
+// VerifyTokenOffline checks the token without contacting the mint. It can be used
+// as a fast pre-check before redeeming the token at the mint. mintKeys are the
+// public keys of the mint's keysets by keyset id as returned from the mint's keys endpoint.
+//
+// It checks that:
+// - the proofs pass the structural checks of Proofs.Validate
+// - the proofs are from one of the keysets in mintKeys and the keyset id matches its keys
+// - DLEQ proofs are valid for the key of the proof's amount
+// - the token has at least opts.Amount
+//
+// A token that passes this can still have been spent already
+// since that can only be checked with the mint.
+func VerifyTokenOffline(token Token, mintKeys map[string]crypto.PublicKeys, opts OfflineVerifyOptions) error {
+	proofs := token.Proofs()
+	if len(proofs) == 0 {
+		return ErrEmptyToken
+	}
+	if err := proofs.Validate(); err != nil {
+		return err
+	}
+
+	checkedKeysets := make(map[string]bool)
+	for _, proof := range proofs {
+		keys, ok := mintKeys[proof.Id]
+		if !ok {
+			return fmt.Errorf("%w: '%v'", UnknownKeysetErr, proof.Id)
+		}
+		// ids of version 00 are derived from the keys
+		if !checkedKeysets[proof.Id] && strings.HasPrefix(proof.Id, "00") {
+			if crypto.DeriveKeysetId(keys) != proof.Id {
+				return fmt.Errorf("%w: '%v'", ErrKeysetIdMismatch, proof.Id)
+			}
+			checkedKeysets[proof.Id] = true
+		}
+
+		A, ok := keys[proof.Amount]
+		if !ok {
+			return fmt.Errorf("%w: no key for amount %v in keyset '%v'", InvalidProofAmount, proof.Amount, proof.Id)
+		}
+
+		if proof.DLEQ == nil {
+			if opts.RequireDLEQ {
+				return ErrMissingDLEQ
+			}
+			continue
+		}
+		if err := VerifyProofDLEQ(proof, A); err != nil {
+			return err
+		}
+	}
+
+	if opts.Amount > 0 && token.Amount() < opts.Amount {
+		return fmt.Errorf("%w: got %v but expected %v", ErrTokenAmount, token.Amount(), opts.Amount)
+	}
+	return nil
+}
+
+// VerifyProofDLEQ verifies the DLEQ proof in the proof
+// with the public key A of the mint for the proof's amount.
+func VerifyProofDLEQ(proof Proof, A *secp256k1.PublicKey) error {
+	if proof.DLEQ == nil {
+		return ErrMissingDLEQ
+	}
+	e, s, r, err := proof.DLEQ.Parse()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDLEQ, err)
+	}
+	if r == nil {
+		return fmt.Errorf("%w: missing blinding factor r", ErrInvalidDLEQ)
+	}
+
+	Cbytes, err := hex.DecodeString(proof.C)
+	if err != nil {
+		return fmt.Errorf("invalid C: %v", err)
+	}
+	C, err := secp256k1.ParsePubKey(Cbytes)
+	if err != nil {
+		return fmt.Errorf("invalid C: %v", err)
+	}
+
+	if !crypto.VerifyProofDLEQ(e, s, r, A, proof.Secret, C) {
+		return ErrInvalidDLEQ
+	}
+	return nil
+}
+
+// Parse returns e, s and r of the DLEQ proof. r is nil if not present.
+func (dleq DLEQProof) Parse() (
+	*secp256k1.PrivateKey,
+	*secp256k1.PrivateKey,
+	*secp256k1.PrivateKey,
+	error,
+) {
+	ebytes, err := hex.DecodeString(dleq.E)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	e := secp256k1.PrivKeyFromBytes(ebytes)
+
+	sbytes, err := hex.DecodeString(dleq.S)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	s := secp256k1.PrivKeyFromBytes(sbytes)
+
+	if dleq.R == "" {
+		return e, s, nil, nil
+	}
+
+	rbytes, err := hex.DecodeString(dleq.R)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r := secp256k1.PrivKeyFromBytes(rbytes)
+
+	return e, s, r, nil
+}
@@ -8,9 +8,12 @@ import (
 	"math/rand/v2"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/elnosh/gonuts/cashu/nuts/nut02"
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
 	"github.com/elnosh/gonuts/mint/manager"
 	"github.com/urfave/cli/v2"
 )
@@ -68,6 +71,43 @@ func main() {
 				},
 				Action: rotateKeyset,
 			},
+			{
+				Name:   "backends",
+				Usage:  "Get health of the lightning backends",
+				Action: lightningBackends,
+			},
+			{
+				Name:   "nodeinfo",
+				Usage:  "Get info and channel liquidity of the lightning node",
+				Action: lightningNodeInfo,
+			},
+			{
+				Name:      "backup",
+				Usage:     "Back up the mint db to a new file while the mint is running",
+				ArgsUsage: "[path]",
+				Action:    backupDB,
+			},
+			{
+				Name:  "prune",
+				Usage: "Delete quotes and blind signatures older than the retention policy of the mint",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Only show what would be deleted",
+					},
+				},
+				Action: pruneData,
+			},
+			{
+				Name:   "reconcile",
+				Usage:  "Check unpaid mint quotes and pending melt quotes against the lightning backend",
+				Action: reconcileQuotes,
+			},
+			{
+				Name:   "version",
+				Usage:  "Get the version of the mint and of its db schema",
+				Action: version,
+			},
 		},
 	}
 
@@ -262,3 +302,154 @@ func rotateKeyset(ctx *cli.Context) error {
 
 	return nil
 }
+
+func lightningBackends(ctx *cli.Context) error {
+	resp, err := sendRequest(manager.LIGHTNING_BACKENDS, nil)
+	if err != nil {
+		return err
+	}
+
+	var backends []lightning.BackendHealth
+	if err := json.Unmarshal(resp.Result, &backends); err != nil {
+		return err
+	}
+
+	fmt.Println("Lightning backends: ")
+
+	for _, backend := range backends {
+		fmt.Printf("\n%v\n", backend.Name)
+		fmt.Printf("\thealthy: %v\n", backend.Healthy)
+		fmt.Printf("\tactive: %v\n", backend.Active)
+		fmt.Printf("\tconsecutive failures: %v\n", backend.ConsecutiveFailures)
+		if len(backend.LastError) > 0 {
+			fmt.Printf("\tlast error: %v\n", backend.LastError)
+		}
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func lightningNodeInfo(ctx *cli.Context) error {
+	resp, err := sendRequest(manager.LIGHTNING_NODE_INFO, nil)
+	if err != nil {
+		return err
+	}
+
+	var nodeInfo manager.NodeInfoResponse
+	if err := json.Unmarshal(resp.Result, &nodeInfo); err != nil {
+		return err
+	}
+
+	fmt.Printf("Alias: %v\n", nodeInfo.Alias)
+	fmt.Printf("Pubkey: %v\n", nodeInfo.Pubkey)
+	fmt.Printf("Block height: %v\n", nodeInfo.BlockHeight)
+	fmt.Printf("Active channels: %v\n", nodeInfo.ActiveChannels)
+	fmt.Printf("Outbound liquidity: %v sats\n", nodeInfo.OutboundMsat/1000)
+	fmt.Printf("Inbound liquidity: %v sats\n", nodeInfo.InboundMsat/1000)
+	fmt.Printf("Pending HTLCs: %v\n", nodeInfo.PendingHTLCs)
+
+	return nil
+}
+
+func backupDB(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		return errors.New("please specify the path for the backup file")
+	}
+
+	// the mint could be running in a different directory
+	path, err := filepath.Abs(args.First())
+	if err != nil {
+		return err
+	}
+
+	resp, err := sendRequest(manager.BACKUP_DB, []string{path})
+	if err != nil {
+		return err
+	}
+
+	var backup manager.BackupResponse
+	if err := json.Unmarshal(resp.Result, &backup); err != nil {
+		return err
+	}
+
+	fmt.Printf("Mint db backed up to: %v\n", backup.Path)
+	return nil
+}
+
+func pruneData(ctx *cli.Context) error {
+	var params []string
+	if ctx.Bool("dry-run") {
+		params = []string{"dryrun"}
+	}
+
+	resp, err := sendRequest(manager.PRUNE_DATA, params)
+	if err != nil {
+		return err
+	}
+
+	var pruned manager.PruneDataResponse
+	if err := json.Unmarshal(resp.Result, &pruned); err != nil {
+		return err
+	}
+
+	if pruned.DryRun {
+		fmt.Println("Data that would be deleted:")
+	} else {
+		fmt.Println("Deleted:")
+	}
+	fmt.Printf("\tmint quotes: %v\n", pruned.MintQuotes)
+	fmt.Printf("\tmelt quotes: %v\n", pruned.MeltQuotes)
+	fmt.Printf("\tblind signatures: %v\n", pruned.BlindSignatures)
+
+	return nil
+}
+
+func reconcileQuotes(ctx *cli.Context) error {
+	resp, err := sendRequest(manager.RECONCILE_QUOTES, nil)
+	if err != nil {
+		return err
+	}
+
+	var report mint.ReconcileReport
+	if err := json.Unmarshal(resp.Result, &report); err != nil {
+		return err
+	}
+
+	fmt.Printf("Checked %v mint quotes and %v melt quotes\n", report.MintQuotesChecked, report.MeltQuotesChecked)
+	if report.Errors > 0 {
+		fmt.Printf("Could not check %v quotes. See the mint logs for the errors\n", report.Errors)
+	}
+	if len(report.Discrepancies) == 0 {
+		fmt.Println("No quotes out of sync with the lightning backend")
+		return nil
+	}
+
+	fmt.Println("Quotes updated to match the lightning backend:")
+	for _, discrepancy := range report.Discrepancies {
+		fmt.Printf("\t%v quote '%v': %v -> %v\n", discrepancy.Kind, discrepancy.QuoteId,
+			discrepancy.PreviousState, discrepancy.State)
+	}
+
+	return nil
+}
+
+func version(ctx *cli.Context) error {
+	resp, err := sendRequest(manager.VERSION, nil)
+	if err != nil {
+		return err
+	}
+
+	var versionResponse manager.VersionResponse
+	if err := json.Unmarshal(resp.Result, &versionResponse); err != nil {
+		return err
+	}
+
+	fmt.Printf("Version: %v\n", versionResponse.Version)
+	if versionResponse.SchemaVersion != nil {
+		fmt.Printf("DB schema version: %v\n", *versionResponse.SchemaVersion)
+	}
+
+	return nil
+}
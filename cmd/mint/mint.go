@@ -3,8 +3,10 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/url"
 	"os"
@@ -14,6 +16,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/elnosh/gonuts/cashu/nuts/nut06"
 	"github.com/elnosh/gonuts/mint"
@@ -25,6 +28,12 @@ import (
 	"gopkg.in/macaroon.v2"
 )
 
+var (
+	devMode     = flag.Bool("dev", false, "run the mint with the fake lightning backend for local development")
+	exportState = flag.String("export-state", "", "write the state of the mint to a new file in this path and exit")
+	importState = flag.String("import-state", "", "load the state from a file written with -export-state into a new mint and exit")
+)
+
 func configFromEnv() (*mint.Config, error) {
 	var inputFeePpk uint = 0
 	if inputFeeEnv, ok := os.LookupEnv("INPUT_FEE_PPK"); ok {
@@ -53,6 +62,10 @@ func configFromEnv() (*mint.Config, error) {
 			return nil, err
 		}
 		mintPath = filepath.Join(homedir, ".gonuts", "mint")
+		// keep dev mint separate from a real one
+		if *devMode {
+			mintPath = filepath.Join(homedir, ".gonuts", "mint-dev")
+		}
 	}
 
 	mintLimits := mint.MintLimits{}
@@ -64,12 +77,28 @@ func configFromEnv() (*mint.Config, error) {
 		mintLimits.MaxBalance = maxBalance
 	}
 
+	if minMintEnv, ok := os.LookupEnv("MINTING_MIN_AMOUNT"); ok {
+		minMint, err := strconv.ParseUint(minMintEnv, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MINTING_MIN_AMOUNT: %v", err)
+		}
+		mintLimits.MintingSettings.MinAmount = minMint
+	}
+
 	if maxMintEnv, ok := os.LookupEnv("MINTING_MAX_AMOUNT"); ok {
 		maxMint, err := strconv.ParseUint(maxMintEnv, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid MINTING_MAX_AMOUNT: %v", err)
 		}
-		mintLimits.MintingSettings = mint.MintMethodSettings{MaxAmount: maxMint}
+		mintLimits.MintingSettings.MaxAmount = maxMint
+	}
+
+	if minMeltEnv, ok := os.LookupEnv("MELTING_MIN_AMOUNT"); ok {
+		minMelt, err := strconv.ParseUint(minMeltEnv, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MELTING_MIN_AMOUNT: %v", err)
+		}
+		mintLimits.MeltingSettings.MinAmount = minMelt
 	}
 
 	if maxMeltEnv, ok := os.LookupEnv("MELTING_MAX_AMOUNT"); ok {
@@ -77,7 +106,35 @@ func configFromEnv() (*mint.Config, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid MELTING_MAX_AMOUNT: %v", err)
 		}
-		mintLimits.MeltingSettings = mint.MeltMethodSettings{MaxAmount: maxMelt}
+		mintLimits.MeltingSettings.MaxAmount = maxMelt
+	}
+
+	retention := mint.RetentionPolicy{}
+	retentionDays := []struct {
+		env  string
+		days *uint
+	}{
+		{"RETENTION_MINT_QUOTE_DAYS", &retention.MintQuoteDays},
+		{"RETENTION_MELT_QUOTE_DAYS", &retention.MeltQuoteDays},
+		{"RETENTION_BLIND_SIGNATURE_DAYS", &retention.BlindSignatureDays},
+	}
+	for _, r := range retentionDays {
+		if daysEnv, ok := os.LookupEnv(r.env); ok {
+			days, err := strconv.ParseUint(daysEnv, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v: %v", r.env, err)
+			}
+			*r.days = uint(days)
+		}
+	}
+
+	var reconcileInterval time.Duration
+	if intervalEnv, ok := os.LookupEnv("RECONCILE_INTERVAL_MINUTES"); ok {
+		minutes, err := strconv.ParseUint(intervalEnv, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RECONCILE_INTERVAL_MINUTES: %v", err)
+		}
+		reconcileInterval = time.Minute * time.Duration(minutes)
 	}
 
 	mintInfo := mint.MintInfo{
@@ -125,8 +182,87 @@ func configFromEnv() (*mint.Config, error) {
 		}
 	}
 
+	lightningBackend := os.Getenv("LIGHTNING_BACKEND")
+	if *devMode {
+		lightningBackend = "FakeBackend"
+	}
+
+	lightningClient, err := lightningClientFromEnv(lightningBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	// if fallback backends are set, route to them when the primary is unhealthy
+	if fallbacks := os.Getenv("LIGHTNING_FALLBACK_BACKENDS"); len(fallbacks) > 0 && !*devMode {
+		backends := []lightning.FailoverBackend{{Name: lightningBackend, Client: lightningClient}}
+		for _, fallback := range strings.Split(fallbacks, ",") {
+			fallback = strings.TrimSpace(fallback)
+			fallbackClient, err := lightningClientFromEnv(fallback)
+			if err != nil {
+				return nil, fmt.Errorf("error setting fallback backend %v: %v", fallback, err)
+			}
+			backends = append(backends, lightning.FailoverBackend{Name: fallback, Client: fallbackClient})
+		}
+
+		failoverConfig := lightning.FailoverConfig{Backends: backends}
+		if maxFailuresEnv, ok := os.LookupEnv("LIGHTNING_MAX_FAILURES"); ok {
+			maxFailures, err := strconv.Atoi(maxFailuresEnv)
+			if err != nil || maxFailures < 1 {
+				return nil, errors.New("invalid LIGHTNING_MAX_FAILURES")
+			}
+			failoverConfig.MaxFailures = maxFailures
+		}
+		lightningClient, err = lightning.NewFailoverClient(failoverConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	enableMPP := false
+	if strings.ToLower(os.Getenv("ENABLE_MPP")) == "true" {
+		enableMPP = true
+	}
+
+	enableAdminServer := false
+	if strings.ToLower(os.Getenv("ENABLE_ADMIN_SERVER")) == "true" {
+		enableAdminServer = true
+	}
+
+	logLevel := mint.Info
+	if strings.ToLower(os.Getenv("LOG")) == "debug" {
+		logLevel = mint.Debug
+	}
+
+	// MINT_DB_DRIVER=memory runs a throwaway mint that does not persist anything
+	dbDriver := mint.DBDriver(strings.ToLower(os.Getenv("MINT_DB_DRIVER")))
+	// MINT_DB_MIGRATIONS overrides the embedded migrations with the ones in that directory
+	dbMigrationPath := os.Getenv("MINT_DB_MIGRATIONS")
+	// MINT_DB_READ_REPLICA is a directory with a read-only replica of the db for restore requests
+	dbReadReplicaPath := os.Getenv("MINT_DB_READ_REPLICA")
+
+	return &mint.Config{
+		RotateKeyset:      rotateKeyset,
+		Port:              port,
+		MintPath:          mintPath,
+		InputFeePpk:       inputFeePpk,
+		MintInfo:          mintInfo,
+		Limits:            mintLimits,
+		LightningClient:   lightningClient,
+		EnableMPP:         enableMPP,
+		EnableAdminServer: enableAdminServer,
+		LogLevel:          logLevel,
+		DBDriver:          dbDriver,
+		DBMigrationPath:   dbMigrationPath,
+		DBReadReplicaPath: dbReadReplicaPath,
+		Retention:         retention,
+		ReconcileInterval: reconcileInterval,
+	}, nil
+}
+
+func lightningClientFromEnv(backend string) (lightning.Client, error) {
 	var lightningClient lightning.Client
-	switch os.Getenv("LIGHTNING_BACKEND") {
+	var err error
+	switch backend {
 	case "Lnd":
 		// read values for setting up LND
 		host := os.Getenv("LND_GRPC_HOST")
@@ -161,52 +297,185 @@ func configFromEnv() (*mint.Config, error) {
 			return nil, fmt.Errorf("error setting macaroon creds: %v", err)
 		}
 		lndConfig := lightning.LndConfig{
-			GRPCHost: host,
-			Cert:     creds,
-			Macaroon: macarooncreds,
+			GRPCHost:   host,
+			Cert:       creds,
+			Macaroon:   macarooncreds,
+			RouteHints: strings.ToLower(os.Getenv("LND_ROUTE_HINTS")) == "true",
 		}
 
 		lightningClient, err = lightning.SetupLndClient(lndConfig)
 		if err != nil {
 			return nil, fmt.Errorf("error setting LND client: %v", err)
 		}
+	case "CLN":
+		socketPath := os.Getenv("CLN_SOCKET_PATH")
+		if socketPath == "" {
+			return nil, errors.New("CLN_SOCKET_PATH cannot be empty")
+		}
+
+		// requests to CLN are only logged with LOG=debug
+		logLevel := slog.LevelInfo
+		if strings.ToLower(os.Getenv("LOG")) == "debug" {
+			logLevel = slog.LevelDebug
+		}
+		clnConfig := lightning.CLNConfig{
+			SocketPath:          socketPath,
+			Logger:              slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})),
+			InvoiceDescription:  os.Getenv("CLN_INVOICE_DESCRIPTION"),
+			DescriptionHashOnly: strings.ToLower(os.Getenv("CLN_INVOICE_DESCRIPTION_HASH")) == "true",
+			LabelPrefix:         os.Getenv("CLN_INVOICE_LABEL_PREFIX"),
+			RouteHints:          strings.ToLower(os.Getenv("CLN_ROUTE_HINTS")) == "true",
+		}
+
+		lightningClient, err = lightning.SetupCLNClient(clnConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error setting CLN client: %v", err)
+		}
+	case "Phoenixd":
+		host := os.Getenv("PHOENIXD_HOST")
+		if host == "" {
+			return nil, errors.New("PHOENIXD_HOST cannot be empty")
+		}
+		password := os.Getenv("PHOENIXD_PASSWORD")
+		if password == "" {
+			return nil, errors.New("PHOENIXD_PASSWORD cannot be empty")
+		}
+
+		phoenixdConfig := lightning.PhoenixdConfig{
+			Host:     host,
+			Password: password,
+			ProxyURL: os.Getenv("LIGHTNING_PROXY_URL"),
+		}
+		lightningClient, err = lightning.SetupPhoenixdClient(phoenixdConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error setting phoenixd client: %v", err)
+		}
+	case "NWC":
+		connectionURI := os.Getenv("NWC_CONNECTION_URI")
+		if connectionURI == "" {
+			return nil, errors.New("NWC_CONNECTION_URI cannot be empty")
+		}
+
+		lightningClient, err = lightning.SetupNWCClient(lightning.NWCConfig{ConnectionURI: connectionURI})
+		if err != nil {
+			return nil, fmt.Errorf("error setting NWC client: %v", err)
+		}
+	case "LNDHub":
+		lndhubConfig := lightning.LNDHubConfig{
+			URL:      os.Getenv("LNDHUB_URL"),
+			Login:    os.Getenv("LNDHUB_LOGIN"),
+			Password: os.Getenv("LNDHUB_PASSWORD"),
+			ProxyURL: os.Getenv("LIGHTNING_PROXY_URL"),
+		}
+		if lndhubConfig.URL == "" {
+			return nil, errors.New("LNDHUB_URL cannot be empty")
+		}
+
+		lightningClient, err = lightning.SetupLNDHubClient(lndhubConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error setting LNDHub client: %v", err)
+		}
+	case "Strike":
+		apiKey := os.Getenv("STRIKE_API_KEY")
+		if apiKey == "" {
+			return nil, errors.New("STRIKE_API_KEY cannot be empty")
+		}
+		strikeConfig := lightning.StrikeConfig{
+			APIKey:   apiKey,
+			Sandbox:  strings.ToLower(os.Getenv("STRIKE_SANDBOX")) == "true",
+			ProxyURL: os.Getenv("LIGHTNING_PROXY_URL"),
+		}
+
+		lightningClient, err = lightning.SetupStrikeClient(strikeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error setting Strike client: %v", err)
+		}
+	case "grpc-plugin":
+		address := os.Getenv("PLUGIN_GRPC_ADDRESS")
+		if address == "" {
+			return nil, errors.New("PLUGIN_GRPC_ADDRESS cannot be empty")
+		}
+		pluginConfig := lightning.PluginConfig{Address: address}
+		// TLS is optional for plugins running on the same machine
+		if certPath := os.Getenv("PLUGIN_CERT_PATH"); certPath != "" {
+			creds, err := credentials.NewClientTLSFromFile(certPath, "")
+			if err != nil {
+				return nil, err
+			}
+			pluginConfig.Cert = creds
+		}
+
+		lightningClient, err = lightning.SetupPluginClient(pluginConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error setting gRPC plugin client: %v", err)
+		}
 	case "FakeBackend":
-		lightningClient = &lightning.FakeBackend{}
+		fakeBackend := &lightning.FakeBackend{}
+		if settleDelayEnv, ok := os.LookupEnv("FAKE_BACKEND_SETTLE_DELAY"); ok {
+			settleDelay, err := strconv.ParseInt(settleDelayEnv, 10, 64)
+			if err != nil || settleDelay < 0 {
+				return nil, errors.New("invalid FAKE_BACKEND_SETTLE_DELAY")
+			}
+			fakeBackend.SettleDelay = settleDelay
+		}
+		if paymentDelayEnv, ok := os.LookupEnv("FAKE_BACKEND_PAYMENT_DELAY"); ok {
+			paymentDelay, err := strconv.ParseInt(paymentDelayEnv, 10, 64)
+			if err != nil || paymentDelay < 0 {
+				return nil, errors.New("invalid FAKE_BACKEND_PAYMENT_DELAY")
+			}
+			fakeBackend.PaymentDelay = paymentDelay
+		}
+		if failureRateEnv, ok := os.LookupEnv("FAKE_BACKEND_FAILURE_RATE"); ok {
+			failureRate, err := strconv.ParseFloat(failureRateEnv, 64)
+			if err != nil || failureRate < 0 || failureRate > 1 {
+				return nil, errors.New("invalid FAKE_BACKEND_FAILURE_RATE. Expected value between 0 and 1")
+			}
+			fakeBackend.FailureRate = failureRate
+		}
+		lightningClient = fakeBackend
 	default:
-		return nil, errors.New("invalid lightning backend")
+		return nil, fmt.Errorf("invalid lightning backend '%v'", backend)
 	}
 
-	enableMPP := false
-	if strings.ToLower(os.Getenv("ENABLE_MPP")) == "true" {
-		enableMPP = true
-	}
+	return lightningClient, nil
+}
 
-	enableAdminServer := false
-	if strings.ToLower(os.Getenv("ENABLE_ADMIN_SERVER")) == "true" {
-		enableAdminServer = true
+func runStateCommand(m *mint.Mint) error {
+	if len(*exportState) > 0 && len(*importState) > 0 {
+		return errors.New("only one of -export-state and -import-state can be set")
 	}
 
-	logLevel := mint.Info
-	if strings.ToLower(os.Getenv("LOG")) == "debug" {
-		logLevel = mint.Debug
+	if len(*exportState) > 0 {
+		// the state has the seed of the mint
+		file, err := os.OpenFile(*exportState, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("error creating file for state: %v", err)
+		}
+		defer file.Close()
+		if err := m.ExportState(file); err != nil {
+			return fmt.Errorf("error exporting state: %v", err)
+		}
+		log.Printf("state of the mint written to %v", *exportState)
+		return nil
 	}
 
-	return &mint.Config{
-		RotateKeyset:      rotateKeyset,
-		Port:              port,
-		MintPath:          mintPath,
-		InputFeePpk:       inputFeePpk,
-		MintInfo:          mintInfo,
-		Limits:            mintLimits,
-		LightningClient:   lightningClient,
-		EnableMPP:         enableMPP,
-		EnableAdminServer: enableAdminServer,
-		LogLevel:          logLevel,
-	}, nil
+	file, err := os.Open(*importState)
+	if err != nil {
+		return fmt.Errorf("error opening state file: %v", err)
+	}
+	defer file.Close()
+	if err := m.ImportState(file); err != nil {
+		return fmt.Errorf("error importing state: %v", err)
+	}
+	log.Printf("state from %v imported into the mint", *importState)
+	return nil
 }
 
 func main() {
-	if err := godotenv.Load(); err != nil {
+	flag.Parse()
+
+	// .env file is optional in dev mode
+	if err := godotenv.Load(); err != nil && !*devMode {
 		log.Fatal("error loading .env file")
 	}
 	mintConfig, err := configFromEnv()
@@ -218,6 +487,17 @@ func main() {
 	if err != nil {
 		log.Fatalf("error loading mint: %v", err)
 	}
+
+	// state is exported and imported without starting the mint server
+	// so that no requests change the db or use the keys while it runs
+	if len(*exportState) > 0 || len(*importState) > 0 {
+		err := runStateCommand(m)
+		m.Shutdown()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	serverConfig := mint.ServerConfig{Port: mintConfig.Port, MeltTimeout: mintConfig.MeltTimeout}
 
 	mintServer := mint.SetupMintServer(m, serverConfig)
@@ -228,10 +508,12 @@ func main() {
 	var adminServer *manager.Server
 	go func() {
 		<-c
-		mintServer.Shutdown()
+		// admin requests can use the keys of the mint so stop
+		// them before the mint server shutdown zeroes them
 		if mintConfig.EnableAdminServer {
 			adminServer.Shutdown()
 		}
+		mintServer.Shutdown()
 	}()
 
 	var wg sync.WaitGroup
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -15,16 +16,19 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
-	"github.com/elnosh/gonuts/cashu/nuts/nut04"
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
-	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/cashu/nuts/nut18"
 	"github.com/elnosh/gonuts/wallet"
 	"github.com/elnosh/gonuts/wallet/client"
-	"github.com/elnosh/gonuts/wallet/submanager"
+	"github.com/elnosh/gonuts/wallet/lnurl"
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/elnosh/gonuts/wallet/walletd"
 	"github.com/joho/godotenv"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
 	"github.com/urfave/cli/v2"
@@ -56,6 +60,57 @@ func walletConfig() (wallet.Config, error) {
 	}
 	config := wallet.Config{WalletPath: walletPath, CurrentMintURL: mint}
 
+	switch strings.ToLower(os.Getenv("WALLET_DB")) {
+	case "", "bolt":
+		config.StorageType = wallet.BoltStorage
+	case "sqlite":
+		config.StorageType = wallet.SQLiteStorage
+	default:
+		return wallet.Config{}, errors.New("invalid WALLET_DB. Options are 'bolt' or 'sqlite'")
+	}
+
+	// comma separated list of relays
+	relays := os.Getenv("NOSTR_RELAYS")
+	for _, relay := range strings.Split(relays, ",") {
+		relay = strings.TrimSpace(relay)
+		if len(relay) > 0 {
+			config.NostrRelays = append(config.NostrRelays, relay)
+		}
+	}
+
+	// socks5 or http proxy, i.e Tor
+	config.ProxyURL = os.Getenv("PROXY_URL")
+
+	if proofsPerAmount := os.Getenv("SPLIT_PROOFS_PER_AMOUNT"); len(proofsPerAmount) > 0 {
+		n, err := strconv.Atoi(proofsPerAmount)
+		if err != nil || n < 1 {
+			return wallet.Config{}, errors.New("invalid SPLIT_PROOFS_PER_AMOUNT. Should be a number greater than 0")
+		}
+		config.SplitStrategy.ProofsPerAmount = n
+	}
+	if maxAmount := os.Getenv("SPLIT_MAX_AMOUNT"); len(maxAmount) > 0 {
+		n, err := strconv.ParseUint(maxAmount, 10, 64)
+		if err != nil {
+			return wallet.Config{}, errors.New("invalid SPLIT_MAX_AMOUNT. Should be a positive number")
+		}
+		config.SplitStrategy.MaxAmount = n
+	}
+
+	if autoConsolidate := os.Getenv("AUTO_CONSOLIDATE"); len(autoConsolidate) > 0 {
+		auto, err := strconv.ParseBool(autoConsolidate)
+		if err != nil {
+			return wallet.Config{}, errors.New("invalid AUTO_CONSOLIDATE. Should be true or false")
+		}
+		config.AutoConsolidate = auto
+	}
+	if threshold := os.Getenv("CONSOLIDATION_THRESHOLD"); len(threshold) > 0 {
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n < 1 {
+			return wallet.Config{}, errors.New("invalid CONSOLIDATION_THRESHOLD. Should be a number greater than 0")
+		}
+		config.ConsolidationThreshold = n
+	}
+
 	return config, nil
 }
 
@@ -98,6 +153,22 @@ func setupWallet(ctx *cli.Context) error {
 	return nil
 }
 
+// useUnitAccount switches the wallet to the account of the unit
+// if it was specified with the unit flag
+func useUnitAccount(ctx *cli.Context) {
+	if !ctx.IsSet(unitFlag) {
+		return
+	}
+	unit, err := cashu.UnitFromString(ctx.String(unitFlag))
+	if err != nil {
+		printErr(fmt.Errorf("%v '%v'", err, ctx.String(unitFlag)))
+	}
+	nutw, err = nutw.Account(unit)
+	if err != nil {
+		printErr(err)
+	}
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "nutw",
@@ -110,12 +181,22 @@ func main() {
 			payCmd,
 			pendingCmd,
 			quotesCmd,
+			historyCmd,
+			consolidateCmd,
+			syncCmd,
+			sweepCmd,
 			p2pkLockCmd,
 			mnemonicCmd,
 			restoreCmd,
+			backupCmd,
 			currentMintCmd,
 			updateMintCmd,
+			removeMintCmd,
 			decodeCmd,
+			daemonCmd,
+			requestCmd,
+			nostrCmd,
+			contactsCmd,
 		},
 	}
 
@@ -126,6 +207,8 @@ func main() {
 
 const (
 	pendingFlag = "pending"
+	perMintFlag = "per-mint"
+	unitFlag    = "unit"
 )
 
 var balanceCmd = &cli.Command{
@@ -139,28 +222,80 @@ var balanceCmd = &cli.Command{
 			Usage:              "show pending balance",
 			DisableDefaultText: true,
 		},
+		&cli.BoolFlag{
+			Name:               perMintFlag,
+			Usage:              "show balance of each mint",
+			DisableDefaultText: true,
+		},
+		&cli.BoolFlag{
+			Name:               checkFlag,
+			Usage:              "check state of proofs with the mints and remove spent ones",
+			DisableDefaultText: true,
+		},
+		&cli.StringFlag{
+			Name:  unitFlag,
+			Usage: "unit of the account to use (sat, msat, usd, eur)",
+		},
+		jsonOutputFlag,
 	},
 }
 
 func getBalance(ctx *cli.Context) error {
+	useUnitAccount(ctx)
+	unit := nutw.Unit()
+	jsonOutput := ctx.Bool(jsonFlag)
+
+	if ctx.Bool(checkFlag) {
+		report, err := nutw.CheckProofsSpent()
+		if err != nil {
+			printErr(err)
+		}
+		if len(report.Spent) > 0 && !jsonOutput {
+			fmt.Printf("removed %v %v in spent proofs\n", report.Spent.Amount(), unit)
+		}
+		if len(report.Pending) > 0 && !jsonOutput {
+			fmt.Printf("moved %v %v in pending proofs to pending balance\n", report.Pending.Amount(), unit)
+		}
+	}
+
 	balanceByMints := nutw.GetBalanceByMints()
-	fmt.Printf("Balance by mint:\n\n")
 	totalBalance := uint64(0)
+	for _, balance := range balanceByMints {
+		totalBalance += balance
+	}
 
-	mints := nutw.TrustedMints()
-	slices.Sort(mints)
+	if jsonOutput {
+		printJSON(walletd.BalanceResponse{
+			Total:   totalBalance,
+			Pending: nutw.PendingBalance(),
+			Mints:   balanceByMints,
+		})
+		return nil
+	}
 
-	for i, mint := range mints {
-		balance := balanceByMints[mint]
-		fmt.Printf("Mint %v: %v ---- balance: %v sats\n", i+1, mint, balance)
-		totalBalance += balance
+	if ctx.Bool(perMintFlag) {
+		fmt.Printf("Balance by mint:\n\n")
+		mints := nutw.TrustedMints()
+		slices.Sort(mints)
+		for i, mint := range mints {
+			fmt.Printf("Mint %v: %v ---- balance: %v %v\n", i+1, mint, balanceByMints[mint], unit)
+		}
+		fmt.Println()
 	}
 
-	fmt.Printf("\nTotal balance: %v sats\n", totalBalance)
+	fmt.Printf("Total balance: %v %v\n", totalBalance, unit)
 
 	if ctx.Bool(pendingFlag) {
 		pendingBalance := nutw.PendingBalance()
-		fmt.Printf("Pending balance: %v sats\n", pendingBalance)
+		fmt.Printf("Pending balance: %v %v\n", pendingBalance, unit)
+	}
+
+	if !ctx.IsSet(unitFlag) {
+		for otherUnit, balance := range nutw.GetBalanceByUnit() {
+			if otherUnit != unit && balance > 0 {
+				fmt.Printf("Balance in %v: %v. Use '--%v %v' to see it\n", otherUnit, balance, unitFlag, otherUnit)
+			}
+		}
 	}
 
 	return nil
@@ -172,8 +307,8 @@ const (
 
 var receiveCmd = &cli.Command{
 	Name:      "receive",
-	Usage:     "Receive token",
-	ArgsUsage: "[TOKEN]",
+	Usage:     "Receive token. Multiple tokens from trusted mints are received in a single swap per mint",
+	ArgsUsage: "[TOKEN]...",
 	Before:    setupWallet,
 	Action:    receive,
 	Flags: []cli.Flag{
@@ -181,6 +316,11 @@ var receiveCmd = &cli.Command{
 			Name:  preimageFlag,
 			Usage: "preimage if receiving ecash HTLC",
 		},
+		&cli.BoolFlag{
+			Name:               jsonFlag,
+			Usage:              "print output as json. Tokens from untrusted mints are swapped to the current mint",
+			DisableDefaultText: true,
+		},
 	},
 }
 
@@ -189,6 +329,9 @@ func receive(ctx *cli.Context) error {
 	if args.Len() < 1 {
 		printErr(errors.New("token not provided"))
 	}
+	if args.Len() > 1 && !ctx.IsSet(preimageFlag) {
+		return receiveAll(args.Slice(), ctx.Bool(jsonFlag))
+	}
 	serializedToken := args.First()
 
 	token, err := cashu.DecodeToken(serializedToken)
@@ -196,6 +339,7 @@ func receive(ctx *cli.Context) error {
 		printErr(err)
 	}
 	mintURL := token.Mint()
+	unit := useTokenAccount(token)
 
 	if ctx.IsSet(preimageFlag) {
 		preimage := ctx.String(preimageFlag)
@@ -203,7 +347,11 @@ func receive(ctx *cli.Context) error {
 		if err != nil {
 			printErr(err)
 		}
-		fmt.Printf("%v sats received from ecash HTLC\n", receivedAmount)
+		if ctx.Bool(jsonFlag) {
+			printJSON(amountOutput{Amount: receivedAmount, Unit: unit.String()})
+			return nil
+		}
+		fmt.Printf("%v %v received from ecash HTLC\n", receivedAmount, unit)
 		return nil
 	}
 
@@ -211,7 +359,7 @@ func receive(ctx *cli.Context) error {
 	trustedMints := nutw.TrustedMints()
 
 	isTrusted := slices.Contains(trustedMints, mintURL)
-	if !isTrusted {
+	if !isTrusted && !ctx.Bool(jsonFlag) {
 		fmt.Printf("Token received comes from an untrusted mint: %v. Do you wish to trust this mint? (y/n) ", mintURL)
 
 		reader := bufio.NewReader(os.Stdin)
@@ -227,7 +375,7 @@ func receive(ctx *cli.Context) error {
 		} else {
 			fmt.Println("Token will be swapped to your default trusted mint")
 		}
-	} else {
+	} else if isTrusted {
 		// if it comes from an already trusted mint, do not swap
 		swap = false
 	}
@@ -237,7 +385,55 @@ func receive(ctx *cli.Context) error {
 		printErr(err)
 	}
 
-	fmt.Printf("%v sats received\n", receivedAmount)
+	if ctx.Bool(jsonFlag) {
+		printJSON(amountOutput{Amount: receivedAmount, Unit: unit.String()})
+		return nil
+	}
+	fmt.Printf("%v %v received\n", receivedAmount, unit)
+	return nil
+}
+
+// useTokenAccount switches the wallet to the account of the token's unit
+func useTokenAccount(token cashu.Token) cashu.Unit {
+	unit, err := cashu.UnitFromString(cashu.TokenUnit(token))
+	if err != nil {
+		printErr(fmt.Errorf("%v '%v'", err, cashu.TokenUnit(token)))
+	}
+	nutw, err = nutw.Account(unit)
+	if err != nil {
+		printErr(err)
+	}
+	return unit
+}
+
+func receiveAll(serializedTokens []string, jsonOutput bool) error {
+	trustedMints := nutw.TrustedMints()
+
+	tokens := make([]cashu.Token, len(serializedTokens))
+	for i, serializedToken := range serializedTokens {
+		token, err := cashu.DecodeToken(serializedToken)
+		if err != nil {
+			printErr(err)
+		}
+		if !slices.Contains(trustedMints, token.Mint()) {
+			printErr(fmt.Errorf("token from untrusted mint '%v'. Receive it on its own", token.Mint()))
+		}
+		if i > 0 && cashu.TokenUnit(token) != cashu.TokenUnit(tokens[0]) {
+			printErr(errors.New("tokens must all be in the same unit"))
+		}
+		tokens[i] = token
+	}
+	unit := useTokenAccount(tokens[0])
+
+	receivedAmount, err := nutw.ReceiveAll(tokens)
+	if jsonOutput {
+		printJSON(amountOutput{Amount: receivedAmount, Unit: unit.String()})
+	} else {
+		fmt.Printf("%v %v received\n", receivedAmount, unit)
+	}
+	if err != nil {
+		printErr(err)
+	}
 	return nil
 }
 
@@ -260,14 +456,25 @@ var mintCmd = &cli.Command{
 			Name:  mintFlag,
 			Usage: "Specify mint from which to request mint quote",
 		},
+		&cli.BoolFlag{
+			Name:               jsonFlag,
+			Usage:              "print the invoice and then the amount minted as json",
+			DisableDefaultText: true,
+		},
+		&cli.StringFlag{
+			Name:  unitFlag,
+			Usage: "unit of the account to use (sat, msat, usd, eur)",
+		},
 	},
 	Action: mint,
 }
 
 func mint(ctx *cli.Context) error {
+	useUnitAccount(ctx)
+
 	// if paid invoice was passed, request tokens from mint
 	if ctx.IsSet(invoiceFlag) {
-		err := mintTokens(ctx.String(invoiceFlag))
+		err := mintTokens(ctx.String(invoiceFlag), ctx.Bool(jsonFlag))
 		if err != nil {
 			printErr(err)
 		}
@@ -288,7 +495,7 @@ func mint(ctx *cli.Context) error {
 		mint = ctx.String(mintFlag)
 	}
 
-	err = requestMint(amount, mint)
+	err = requestMint(amount, mint, ctx.Bool(jsonFlag))
 	if err != nil {
 		printErr(err)
 	}
@@ -296,79 +503,60 @@ func mint(ctx *cli.Context) error {
 	return nil
 }
 
-func requestMint(amount uint64, mintURL string) error {
+type mintQuoteOutput struct {
+	Quote   string `json:"quote"`
+	Request string `json:"request"`
+	Amount  uint64 `json:"amount"`
+	Expiry  uint64 `json:"expiry,omitempty"`
+}
+
+func requestMint(amount uint64, mintURL string, jsonOutput bool) error {
 	mintResponse, err := nutw.RequestMint(amount, mintURL)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("invoice: %v\n\n", mintResponse.Request)
-
-	subMananger, err := submanager.NewSubscriptionManager(mintURL)
-	if err != nil {
-		fmt.Println("after paying the invoice you can redeem the ecash by doing 'nutw mint --invoice [invoice]'")
-		return nil
-	}
-	defer subMananger.Close()
-
-	errChan := make(chan error)
-	go subMananger.Run(errChan)
-
-	subscription, err := subMananger.Subscribe(nut17.Bolt11MintQuote, []string{mintResponse.Quote})
-	if err != nil {
-		fmt.Println("after paying the invoice you can redeem the ecash by doing 'nutw mint --invoice [invoice]'")
-		return nil
+	if jsonOutput {
+		printJSON(mintQuoteOutput{
+			Quote:   mintResponse.Quote,
+			Request: mintResponse.Request,
+			Amount:  amount,
+			Expiry:  mintResponse.Expiry,
+		})
+	} else {
+		fmt.Printf("invoice: %v\n\n", mintResponse.Request)
+		fmt.Println("checking if invoice gets paid...")
 	}
 
-	fmt.Println("checking if invoice gets paid...")
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, os.Kill, syscall.SIGTERM)
-	done := make(chan struct{})
-
-	go func() {
-		select {
-		case err := <-errChan:
-			fmt.Printf("error reading from websocket connection: %v\n\n", err)
-			fmt.Println("after paying the invoice you can redeem the ecash by doing 'nutw mint --invoice [invoice]'")
-			os.Exit(1)
-		case <-sigChan:
-			fmt.Println("\nterminating... after paying the invoice you can also redeem the ecash by doing 'nutw mint --invoice [invoice]'")
-			os.Exit(0)
-		case <-done:
-			return
-		}
-	}()
-
-	for {
-		notification, err := subscription.Read()
-		if err != nil {
-			return err
-		}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-		var mintQuote nut04.PostMintQuoteBolt11Response
-		if err := json.Unmarshal(notification.Params.Payload, &mintQuote); err != nil {
+	if err := nutw.AwaitMintPaid(ctx, mintResponse.Quote); err != nil {
+		if jsonOutput {
 			return err
 		}
-
-		if mintQuote.State == nut04.Paid {
-			mintedAmount, err := nutw.MintTokens(mintResponse.Quote)
-			if err != nil {
-				return err
-			}
-
-			fmt.Printf("%v sats successfully minted\n", mintedAmount)
-
-			if err := subMananger.CloseSubscripton(subscription.SubId()); err != nil {
-				return err
-			}
-			done <- struct{}{}
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("\nterminating... after paying the invoice you can also redeem the ecash by doing 'nutw mint --invoice [invoice]'")
 			return nil
 		}
+		fmt.Printf("error checking state of invoice: %v\n\n", err)
+		fmt.Println("after paying the invoice you can redeem the ecash by doing 'nutw mint --invoice [invoice]'")
+		return nil
+	}
+
+	mintedAmount, err := nutw.MintTokens(mintResponse.Quote)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printJSON(amountOutput{Amount: mintedAmount, Unit: nutw.Unit().String()})
+		return nil
 	}
+	fmt.Printf("%v %v successfully minted\n", mintedAmount, nutw.Unit())
+	return nil
 }
 
-func mintTokens(paymentRequest string) error {
+func mintTokens(paymentRequest string, jsonOutput bool) error {
 	quote, err := nutw.GetMintQuoteByPaymentRequest(paymentRequest)
 	if err != nil {
 		return err
@@ -379,7 +567,11 @@ func mintTokens(paymentRequest string) error {
 		return err
 	}
 
-	fmt.Printf("%v sats successfully minted\n", mintedAmount)
+	if jsonOutput {
+		printJSON(amountOutput{Amount: mintedAmount, Unit: nutw.Unit().String()})
+		return nil
+	}
+	fmt.Printf("%v %v successfully minted\n", mintedAmount, nutw.Unit())
 	return nil
 }
 
@@ -393,6 +585,10 @@ const (
 	noFeesFlag       = "no-fees"
 	legacyFlag       = "legacy"
 	includeDLEQFlag  = "include-dleq"
+	offlineFlag      = "offline"
+	nostrFlag        = "nostr"
+	toFlag           = "to"
+	memoFlag         = "memo"
 )
 
 var sendCmd = &cli.Command{
@@ -402,8 +598,9 @@ var sendCmd = &cli.Command{
 	Before:    setupWallet,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:  p2pklockFlag,
-			Usage: "generate ecash locked to a public key",
+			Name:    p2pklockFlag,
+			Aliases: []string{"lock"},
+			Usage:   "generate ecash locked to a public key",
 		},
 		&cli.StringFlag{
 			Name:  htlcLockFlag,
@@ -448,11 +645,39 @@ var sendCmd = &cli.Command{
 			Usage:              "include DLEQ proofs",
 			DisableDefaultText: true,
 		},
+		&cli.BoolFlag{
+			Name:               offlineFlag,
+			Usage:              "only send from stored proofs without swapping at the mint",
+			DisableDefaultText: true,
+		},
+		&cli.StringFlag{
+			Name:  nostrFlag,
+			Usage: "send token as a nostr direct message to the npub",
+		},
+		&cli.StringFlag{
+			Name:  toFlag,
+			Usage: "send to a contact. Locks the ecash to its public key and sends it through nostr if the contact has them",
+		},
+		&cli.StringFlag{
+			Name:  memoFlag,
+			Usage: "memo to include in the token",
+		},
+		&cli.StringFlag{
+			Name:  mintFlag,
+			Usage: "mint to send from",
+		},
+		jsonOutputFlag,
+		&cli.StringFlag{
+			Name:  unitFlag,
+			Usage: "unit of the account to use (sat, msat, usd, eur)",
+		},
 	},
 	Action: send,
 }
 
 func send(ctx *cli.Context) error {
+	useUnitAccount(ctx)
+
 	args := ctx.Args()
 	if args.Len() < 1 {
 		printErr(errors.New("specify an amount to send"))
@@ -463,7 +688,7 @@ func send(ctx *cli.Context) error {
 		printErr(err)
 	}
 
-	selectedMint := promptMintSelection("send")
+	selectedMint := selectMint(ctx, "send")
 
 	includeFees := true
 	if ctx.Bool(noFeesFlag) {
@@ -471,9 +696,24 @@ func send(ctx *cli.Context) error {
 	}
 
 	var proofsToSend cashu.Proofs
+	var contact *storage.Contact
+	var contactErr error
 
-	// if either P2PK or HTLC, read optional flags
-	if ctx.IsSet(p2pklockFlag) || ctx.IsSet(htlcLockFlag) {
+	if ctx.IsSet(toFlag) {
+		if ctx.IsSet(p2pklockFlag) || ctx.IsSet(htlcLockFlag) || ctx.IsSet(nostrFlag) || ctx.Bool(offlineFlag) {
+			printErr(fmt.Errorf("--%v cannot be used with lock, nostr or offline flags", toFlag))
+		}
+		contact, err = nutw.GetContact(ctx.String(toFlag))
+		if err != nil {
+			printErr(fmt.Errorf("%v '%v'", err, ctx.String(toFlag)))
+		}
+		proofsToSend, contactErr = nutw.SendToContact(sendAmount, selectedMint, contact.Name, includeFees)
+		// proofs are returned if only sending the token through nostr failed
+		if contactErr != nil && len(proofsToSend) == 0 {
+			printErr(contactErr)
+		}
+	} else if ctx.IsSet(p2pklockFlag) || ctx.IsSet(htlcLockFlag) {
+		// if either P2PK or HTLC, read optional flags
 		tags := nut11.P2PKTags{
 			NSigs:    ctx.Int(requiredSigsFlag),
 			Locktime: ctx.Int64(locktimeFlag),
@@ -526,6 +766,11 @@ func send(ctx *cli.Context) error {
 				printErr(err)
 			}
 		}
+	} else if ctx.Bool(offlineFlag) {
+		proofsToSend, err = nutw.SendOffline(sendAmount, selectedMint, includeFees)
+		if err != nil {
+			printErr(err)
+		}
 	} else {
 		proofsToSend, err = nutw.Send(sendAmount, selectedMint, includeFees)
 		if err != nil {
@@ -540,18 +785,45 @@ func send(ctx *cli.Context) error {
 
 	var token cashu.Token
 	if ctx.Bool(legacyFlag) {
-		token, _ = cashu.NewTokenV3(proofsToSend, selectedMint, cashu.Sat, includeDLEQ)
+		tokenV3, _ := cashu.NewTokenV3(proofsToSend, selectedMint, nutw.Unit(), includeDLEQ)
+		tokenV3.Memo = ctx.String(memoFlag)
+		token = tokenV3
 	} else {
-		token, err = cashu.NewTokenV4(proofsToSend, selectedMint, cashu.Sat, includeDLEQ)
+		tokenV4, err := cashu.NewTokenV4(proofsToSend, selectedMint, nutw.Unit(), includeDLEQ)
 		if err != nil {
 			printErr(fmt.Errorf("could not serialize token: %v", err))
 		}
+		tokenV4.Memo = ctx.String(memoFlag)
+		token = tokenV4
 	}
 
 	tokenString, err := token.Serialize()
 	if err != nil {
 		printErr(fmt.Errorf("could not serialize token: %v", err))
 	}
+
+	if contact != nil && len(contact.Nostr) > 0 {
+		if contactErr != nil {
+			printErr(fmt.Errorf("%v. Token: %v", contactErr, tokenString))
+		}
+		if !ctx.Bool(jsonFlag) {
+			fmt.Printf("token sent to %v\n", contact.Name)
+			return nil
+		}
+	}
+	if ctx.IsSet(nostrFlag) {
+		if err := nutw.SendToNostr(ctx.String(nostrFlag), tokenString); err != nil {
+			printErr(fmt.Errorf("could not send token through nostr: %v. Token: %v", err, tokenString))
+		}
+		if !ctx.Bool(jsonFlag) {
+			fmt.Printf("token sent to %v\n", ctx.String(nostrFlag))
+			return nil
+		}
+	}
+	if ctx.Bool(jsonFlag) {
+		printJSON(walletd.SendResponse{Token: tokenString})
+		return nil
+	}
 	fmt.Printf("%v\n", tokenString)
 
 	return nil
@@ -559,17 +831,32 @@ func send(ctx *cli.Context) error {
 
 const (
 	multimintFlag = "multimint"
+	amountFlag    = "amount"
+	commentFlag   = "comment"
 )
 
 var payCmd = &cli.Command{
 	Name:      "pay",
-	Usage:     "Pay a lightning invoice",
-	ArgsUsage: "[INVOICE]",
+	Usage:     "Pay a lightning invoice, lightning address, LNURL, payment request (creqA...) or contact",
+	ArgsUsage: "[INVOICE | LIGHTNING ADDRESS | LNURL | PAYMENT REQUEST | CONTACT]",
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
 			Name:  multimintFlag,
 			Usage: "pay invoice using funds from multiple mints",
 		},
+		&cli.Uint64Flag{
+			Name:  amountFlag,
+			Usage: "amount to pay to lightning address or if the payment request does not specify one",
+		},
+		&cli.StringFlag{
+			Name:  commentFlag,
+			Usage: "comment to send with payment to lightning address",
+		},
+		&cli.StringFlag{
+			Name:  mintFlag,
+			Usage: "mint to pay from",
+		},
+		jsonOutputFlag,
 	},
 	Before: setupWallet,
 	Action: pay,
@@ -582,6 +869,28 @@ func pay(ctx *cli.Context) error {
 	}
 	invoice := args.First()
 
+	if strings.HasPrefix(invoice, nut18.PaymentRequestPrefix) {
+		return payPaymentRequest(invoice, ctx.Uint64(amountFlag))
+	}
+
+	// pay to lightning address of contact
+	if contact, err := nutw.GetContact(invoice); err == nil && len(contact.LightningAddress) > 0 {
+		invoice = contact.LightningAddress
+	}
+
+	// resolve lightning address or LNURL to an invoice
+	if lnurl.IsLNURL(invoice) {
+		amount := ctx.Uint64(amountFlag)
+		if amount == 0 {
+			printErr(errors.New("specify amount to pay with --amount"))
+		}
+		var err error
+		invoice, err = lnurl.GetInvoice(invoice, amount, ctx.String(commentFlag))
+		if err != nil {
+			printErr(fmt.Errorf("could not get invoice: %v", err))
+		}
+	}
+
 	// check invoice passed is valid
 	bolt11, err := decodepay.Decodepay(invoice)
 	if err != nil {
@@ -674,7 +983,7 @@ func pay(ctx *cli.Context) error {
 
 	} else {
 		// do regular single mint payment if multimint not set
-		selectedMint := promptMintSelection("pay invoice")
+		selectedMint := selectMint(ctx, "pay invoice")
 		meltQuote, err := nutw.RequestMeltQuote(invoice, selectedMint)
 		if err != nil {
 			printErr(err)
@@ -684,6 +993,10 @@ func pay(ctx *cli.Context) error {
 		if err != nil {
 			printErr(err)
 		}
+		if ctx.Bool(jsonFlag) {
+			printJSON(meltResult)
+			return nil
+		}
 
 		switch meltResult.State {
 		case nut05.Paid:
@@ -803,65 +1116,382 @@ func quotes(ctx *cli.Context) error {
 	return nil
 }
 
-var p2pkLockCmd = &cli.Command{
-	Name:   "p2pk-lock",
-	Usage:  "Retrieves a public key to which ecash can be locked",
+const (
+	pageFlag  = "page"
+	limitFlag = "limit"
+	typeFlag  = "type"
+	labelFlag = "label"
+)
+
+var historyCmd = &cli.Command{
+	Name:   "history",
+	Usage:  "List transactions made by the wallet, newest first",
 	Before: setupWallet,
-	Action: p2pkLock,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  pageFlag,
+			Usage: "page of transactions to show",
+			Value: 1,
+		},
+		&cli.IntFlag{
+			Name:  limitFlag,
+			Usage: "number of transactions per page",
+			Value: 10,
+		},
+		&cli.StringFlag{
+			Name:  typeFlag,
+			Usage: "only show transactions of type: mint, send, receive, melt or swap",
+		},
+		&cli.StringFlag{
+			Name:  mintFlag,
+			Usage: "only show transactions from mint",
+		},
+		&cli.StringFlag{
+			Name:  labelFlag,
+			Usage: "only show transactions with label",
+		},
+		jsonOutputFlag,
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:      "label",
+			Usage:     "Add labels to a transaction",
+			ArgsUsage: "[TRANSACTION ID] [LABEL]...",
+			Before:    setupWallet,
+			Action:    labelTransaction,
+		},
+	},
+	Action: history,
 }
 
-func p2pkLock(ctx *cli.Context) error {
-	lockpubkey := nutw.GetReceivePubkey()
-	pubkey := hex.EncodeToString(lockpubkey.SerializeCompressed())
+type transactionOutput struct {
+	Id          string   `json:"id"`
+	Type        string   `json:"type"`
+	Mint        string   `json:"mint"`
+	Unit        string   `json:"unit"`
+	Amount      uint64   `json:"amount"`
+	Fee         uint64   `json:"fee"`
+	Counterpart string   `json:"counterpart"`
+	Balance     uint64   `json:"balance"`
+	CreatedAt   int64    `json:"created_at"`
+	Memo        string   `json:"memo,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+}
 
-	fmt.Printf("Pay to Public Key (P2PK) lock: %v\n\n", pubkey)
-	fmt.Println("You can unlock ecash locked to this public key")
+func history(ctx *cli.Context) error {
+	page := ctx.Int(pageFlag)
+	limit := ctx.Int(limitFlag)
+	if page < 1 || limit < 1 {
+		printErr(errors.New("page and limit should be greater than 0"))
+	}
+
+	filter := storage.TransactionFilter{
+		Mint:   ctx.String(mintFlag),
+		Label:  ctx.String(labelFlag),
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	}
+	if ctx.IsSet(typeFlag) {
+		filter.Type = storage.StringToTransactionType(ctx.String(typeFlag))
+		if filter.Type == 0 {
+			printErr(fmt.Errorf("invalid transaction type '%v'", ctx.String(typeFlag)))
+		}
+	}
+
+	transactions := nutw.GetHistory(filter)
+	if ctx.Bool(jsonFlag) {
+		output := make([]transactionOutput, len(transactions))
+		for i, transaction := range transactions {
+			output[i] = transactionOutput{
+				Id:          transaction.Id,
+				Type:        transaction.Type.String(),
+				Mint:        transaction.Mint,
+				Unit:        transaction.Unit,
+				Amount:      transaction.Amount,
+				Fee:         transaction.Fee,
+				Counterpart: transaction.Counterpart,
+				Balance:     transaction.Balance,
+				CreatedAt:   transaction.CreatedAt,
+				Memo:        transaction.Memo,
+				Labels:      transaction.Labels,
+			}
+		}
+		printJSON(output)
+		return nil
+	}
+	if len(transactions) == 0 {
+		fmt.Println("no transactions")
+		return nil
+	}
 
+	for _, transaction := range transactions {
+		fmt.Printf("%v  %-7v  %v %v  fee: %v  balance: %v  mint: %v  id: %v\n",
+			time.Unix(transaction.CreatedAt, 0).Format(time.DateTime),
+			transaction.Type,
+			transaction.Amount,
+			transaction.Unit,
+			transaction.Fee,
+			transaction.Balance,
+			transaction.Mint,
+			transaction.Id,
+		)
+		if len(transaction.Memo) > 0 {
+			fmt.Printf("    memo: %v\n", transaction.Memo)
+		}
+		if len(transaction.Labels) > 0 {
+			fmt.Printf("    labels: %v\n", strings.Join(transaction.Labels, ", "))
+		}
+	}
 	return nil
 }
 
-var mnemonicCmd = &cli.Command{
-	Name:   "mnemonic",
-	Usage:  "Mnemonic to restore wallet",
-	Before: setupWallet,
-	Action: mnemonic,
-}
+func labelTransaction(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 2 {
+		printErr(errors.New("specify the transaction id and at least one label"))
+	}
 
-func mnemonic(ctx *cli.Context) error {
-	mnemonic := nutw.Mnemonic()
-	fmt.Printf("mnemonic: %v\n", mnemonic)
+	if err := nutw.LabelTransaction(args.First(), args.Tail()...); err != nil {
+		printErr(err)
+	}
+	fmt.Println("transaction labeled")
 	return nil
 }
 
-var restoreCmd = &cli.Command{
-	Name:   "restore",
-	Usage:  "Restore wallet from mnemonic",
-	Action: restore,
+var consolidateCmd = &cli.Command{
+	Name:   "consolidate",
+	Usage:  "Swap proofs of amounts the wallet has too many of for proofs of larger amounts",
+	Before: setupWallet,
+	Action: consolidate,
 }
 
-func restore(ctx *cli.Context) error {
-	config, err := walletConfig()
+func consolidate(ctx *cli.Context) error {
+	proofsRemoved, err := nutw.Consolidate()
 	if err != nil {
 		printErr(err)
 	}
-	fmt.Printf("enter mnemonic: ")
-
-	reader := bufio.NewReader(os.Stdin)
-	mnemonic, err := reader.ReadString('\n')
+	if proofsRemoved == 0 {
+		fmt.Println("nothing to consolidate")
+		return nil
+	}
+	fmt.Printf("consolidated wallet. %v less proofs\n", proofsRemoved)
+	return nil
+}
+
+var syncCmd = &cli.Command{
+	Name:   "sync",
+	Usage:  "Mint quotes that were paid, settle pending payments and remove spent pending proofs",
+	Before: setupWallet,
+	Action: syncWallet,
+}
+
+func syncWallet(ctx *cli.Context) error {
+	report, err := nutw.Sync()
+	if report.Minted > 0 {
+		fmt.Printf("%v sats minted from %v paid quotes\n", report.Minted, len(report.MintedQuotes))
+	}
+	for _, quote := range report.MeltsPaid {
+		fmt.Printf("payment for quote '%v' succeeded\n", quote)
+	}
+	for _, quote := range report.MeltsFailed {
+		fmt.Printf("payment for quote '%v' failed. Proofs were returned to the wallet\n", quote)
+	}
+	if err != nil {
+		printErr(err)
+	}
+	fmt.Println("wallet synced")
+	return nil
+}
+
+var sweepCmd = &cli.Command{
+	Name:      "sweep",
+	Usage:     "Pay all the balance to a lightning address or LNURL. An invoice is paid from the mint with the largest balance",
+	ArgsUsage: "[LIGHTNING ADDRESS | LNURL | INVOICE]",
+	Before:    setupWallet,
+	Action:    sweep,
+}
+
+func sweep(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify where to send the funds"))
+	}
+	destination := args.First()
+
+	fmt.Printf("This will send %v sats minus fees to %v. Continue? (y/n) ", nutw.GetBalance(), destination)
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatal("error reading input, please try again")
+	}
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input != "y" && input != "yes" {
+		return nil
+	}
+
+	report, err := nutw.SweepAll(destination)
+	if report != nil {
+		for _, payment := range report.Payments {
+			fmt.Printf("%v: paid %v sats with %v sats in fees (%v)\n", payment.Mint, payment.Amount, payment.Fee, payment.State)
+		}
+		fmt.Printf("\nTotal paid: %v sats. Fees: %v sats\n", report.Paid, report.Fees)
+	}
+	if err != nil {
+		printErr(err)
+	}
+	return nil
+}
+
+var p2pkLockCmd = &cli.Command{
+	Name:   "p2pk-lock",
+	Usage:  "Retrieves a public key to which ecash can be locked",
+	Before: setupWallet,
+	Action: p2pkLock,
+}
+
+func p2pkLock(ctx *cli.Context) error {
+	lockpubkey := nutw.GetReceivePubkey()
+	pubkey := hex.EncodeToString(lockpubkey.SerializeCompressed())
+
+	fmt.Printf("Pay to Public Key (P2PK) lock: %v\n\n", pubkey)
+	fmt.Println("You can unlock ecash locked to this public key")
+
+	return nil
+}
+
+var mnemonicCmd = &cli.Command{
+	Name:   "mnemonic",
+	Usage:  "Mnemonic to restore wallet",
+	Before: setupWallet,
+	Action: mnemonic,
+}
+
+func mnemonic(ctx *cli.Context) error {
+	mnemonic := nutw.Mnemonic()
+	fmt.Printf("mnemonic: %v\n", mnemonic)
+	return nil
+}
+
+const (
+	backupFlag = "backup"
+)
+
+var restoreCmd = &cli.Command{
+	Name:  "restore",
+	Usage: "Restore wallet from mnemonic",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  backupFlag,
+			Usage: "restore wallet from backup file instead",
+		},
+		jsonOutputFlag,
+	},
+	Action: restore,
+}
+
+func restore(ctx *cli.Context) error {
+	config, err := walletConfig()
+	if err != nil {
+		printErr(err)
+	}
+
+	if ctx.IsSet(backupFlag) {
+		passphrase := readPassphrase()
+		amountRestored, err := wallet.RestoreFromBackup(config.WalletPath, config.StorageType, ctx.String(backupFlag), passphrase)
+		if err != nil {
+			printErr(fmt.Errorf("error restoring wallet: %v", err))
+		}
+		printRestored(amountRestored, ctx.Bool(jsonFlag))
+		return nil
+	}
+
+	fmt.Fprint(os.Stderr, "enter mnemonic: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	mnemonic, err := reader.ReadString('\n')
 	if err != nil {
 		log.Fatal("error reading input, please try again")
 	}
 	mnemonic = mnemonic[:len(mnemonic)-1]
 
-	amountRestored, err := wallet.Restore(config.WalletPath, mnemonic, []string{config.CurrentMintURL})
+	amountRestored, err := wallet.Restore(config.WalletPath, config.StorageType, mnemonic, []string{config.CurrentMintURL})
 	if err != nil {
 		printErr(fmt.Errorf("error restoring wallet: %v", err))
 	}
 
+	printRestored(amountRestored, ctx.Bool(jsonFlag))
+	return nil
+}
+
+func printRestored(amountRestored uint64, jsonOutput bool) {
+	if jsonOutput {
+		printJSON(amountOutput{Amount: amountRestored, Unit: cashu.Sat.String()})
+		return
+	}
 	fmt.Printf("restored proofs for amount: %v\n", amountRestored)
+}
+
+var backupCmd = &cli.Command{
+	Name:  "backup",
+	Usage: "Export and import encrypted backups of the wallet",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "export",
+			Usage:     "Write encrypted backup of seed, proofs, mints and counters to file",
+			ArgsUsage: "[FILE]",
+			Before:    setupWallet,
+			Action:    exportBackup,
+		},
+		{
+			Name:      "import",
+			Usage:     "Merge proofs and mints from backup file into the wallet",
+			ArgsUsage: "[FILE]",
+			Before:    setupWallet,
+			Action:    importBackup,
+		},
+	},
+}
+
+func exportBackup(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify file to write backup to"))
+	}
+
+	passphrase := readPassphrase()
+	if err := nutw.ExportBackup(args.First(), passphrase); err != nil {
+		printErr(fmt.Errorf("error exporting backup: %v", err))
+	}
+	fmt.Printf("backup written to %v\n", args.First())
 	return nil
 }
 
+func importBackup(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify backup file to import"))
+	}
+
+	passphrase := readPassphrase()
+	amountImported, err := nutw.ImportBackup(args.First(), passphrase)
+	if err != nil {
+		printErr(fmt.Errorf("error importing backup: %v", err))
+	}
+	fmt.Printf("imported proofs for amount: %v\n", amountImported)
+	return nil
+}
+
+func readPassphrase() string {
+	fmt.Fprint(os.Stderr, "enter backup passphrase: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	passphrase, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatal("error reading input, please try again")
+	}
+	return strings.TrimSuffix(passphrase, "\n")
+}
+
 var currentMintCmd = &cli.Command{
 	Name:  "currentmint",
 	Usage: "See and change default mint",
@@ -952,11 +1582,42 @@ func updateMintURL(ctx *cli.Context) error {
 	return nil
 }
 
+var removeMintCmd = &cli.Command{
+	Name:      "remove-mint",
+	ArgsUsage: "[mint]",
+	Usage:     "Remove mint from the list of trusted mints",
+	Before:    setupWallet,
+	Action:    removeMint,
+}
+
+func removeMint(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected mint URL as argument")
+	}
+	mintURL := ctx.Args().First()
+
+	if err := nutw.RemoveMint(mintURL); err != nil {
+		printErr(err)
+	}
+	fmt.Println("Mint removed successfully")
+	return nil
+}
+
+const (
+	jsonFlag = "json"
+)
+
 var decodeCmd = &cli.Command{
 	Name:      "decode",
 	ArgsUsage: "[TOKEN]",
-	Usage:     "Decode token",
-	Action:    decode,
+	Usage:     "Decode token to inspect it before receiving it",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  jsonFlag,
+			Usage: "print the full token as json",
+		},
+	},
+	Action: decode,
 }
 
 func decode(ctx *cli.Context) error {
@@ -971,11 +1632,45 @@ func decode(ctx *cli.Context) error {
 		printErr(err)
 	}
 
-	jsonToken, err := json.MarshalIndent(token, "", "  ")
-	if err != nil {
-		printErr(err)
+	if ctx.Bool(jsonFlag) {
+		printJSON(token)
+		return nil
+	}
+
+	info := cashu.GetTokenInfo(token)
+	fmt.Printf("mint: %v\n", info.Mint)
+	fmt.Printf("amount: %v %v\n", info.Amount, info.Unit)
+	if len(info.Memo) > 0 {
+		fmt.Printf("memo: %v\n", info.Memo)
+	}
+	fmt.Printf("proofs: %v\n", info.ProofCount)
+	fmt.Printf("keysets: %v\n", strings.Join(info.KeysetIds, ", "))
+	fmt.Printf("proofs with DLEQ: %v/%v\n", info.DLEQCount, info.ProofCount)
+
+	for _, lock := range info.Locks {
+		fmt.Printf("\n%v %v locked with %v\n", lock.Amount, info.Unit, lock.Kind)
+		if lock.Kind == nut10.HTLC {
+			fmt.Printf("  hash: %v\n", lock.Data)
+			if len(lock.PublicKeys) > 0 {
+				fmt.Printf("  keys: %v\n", strings.Join(lock.PublicKeys, ", "))
+			}
+		} else {
+			keys := append([]string{lock.Data}, lock.PublicKeys...)
+			fmt.Printf("  keys: %v\n", strings.Join(keys, ", "))
+		}
+		if lock.NSigs > 1 {
+			fmt.Printf("  signatures required: %v\n", lock.NSigs)
+		}
+		if lock.SigAll {
+			fmt.Println("  sigflag: SIG_ALL")
+		}
+		if lock.Locktime > 0 {
+			fmt.Printf("  locktime: %v\n", time.Unix(lock.Locktime, 0).Format(time.DateTime))
+			if len(lock.RefundKeys) > 0 {
+				fmt.Printf("  refund keys: %v\n", strings.Join(lock.RefundKeys, ", "))
+			}
+		}
 	}
-	fmt.Printf("token: %s\n", jsonToken)
 
 	return nil
 }
@@ -992,7 +1687,7 @@ func promptMintSelection(action string) string {
 
 		for i, mint := range mints {
 			balance := balanceByMints[mint]
-			fmt.Printf("Mint %v: %v ---- balance: %v sats\n", i+1, mint, balance)
+			fmt.Printf("Mint %v: %v ---- balance: %v %v\n", i+1, mint, balance, nutw.Unit())
 		}
 
 		fmt.Printf("\nSelect from which mint (1-%v) you wish to %v: ", mintsLen, action)
@@ -1021,3 +1716,417 @@ func printErr(msg error) {
 	fmt.Println(msg.Error())
 	os.Exit(0)
 }
+
+// jsonOutputFlag prints the result of the command as json for
+// scripting. Commands do not prompt for input when it is set.
+var jsonOutputFlag = &cli.BoolFlag{
+	Name:               jsonFlag,
+	Usage:              "print output as json",
+	DisableDefaultText: true,
+}
+
+func printJSON(v any) {
+	output, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		printErr(err)
+	}
+	fmt.Println(string(output))
+}
+
+type amountOutput struct {
+	Amount uint64 `json:"amount"`
+	Unit   string `json:"unit"`
+}
+
+// selectMint returns the mint passed with the mint flag. If it was not set,
+// it asks which mint to use unless the output is json, in which case
+// the current mint is used.
+func selectMint(ctx *cli.Context, action string) string {
+	if ctx.IsSet(mintFlag) {
+		return ctx.String(mintFlag)
+	}
+	if ctx.Bool(jsonFlag) {
+		return nutw.CurrentMint()
+	}
+	return promptMintSelection(action)
+}
+
+const (
+	portFlag         = "port"
+	grpcPortFlag     = "grpc-port"
+	syncIntervalFlag = "sync-interval"
+)
+
+var daemonCmd = &cli.Command{
+	Name:   "daemon",
+	Usage:  "Run wallet daemon exposing a local HTTP API",
+	Before: setupWallet,
+	Action: daemon,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  portFlag,
+			Usage: "port for the HTTP API",
+			Value: 3339,
+		},
+		&cli.IntFlag{
+			Name:  grpcPortFlag,
+			Usage: "port for the gRPC interface with streaming events. Not served if not set",
+		},
+		&cli.DurationFlag{
+			Name:  syncIntervalFlag,
+			Usage: "how often to check for paid mint quotes, pending payments and pending proofs. 0 to disable",
+			Value: 5 * time.Minute,
+		},
+	},
+}
+
+func daemon(ctx *cli.Context) error {
+	authToken := os.Getenv("WALLETD_AUTH_TOKEN")
+	if len(authToken) == 0 {
+		printErr(errors.New("WALLETD_AUTH_TOKEN needs to be set to run the daemon"))
+	}
+
+	server, err := walletd.SetupServer(nutw, walletd.ServerConfig{
+		Port:      ctx.Int(portFlag),
+		AuthToken: authToken,
+		GRPCPort:  ctx.Int(grpcPortFlag),
+	})
+	if err != nil {
+		printErr(err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		server.Shutdown()
+	}()
+
+	if interval := ctx.Duration(syncIntervalFlag); interval > 0 {
+		nutw.StartSync(interval, func(report *wallet.SyncReport, err error) {
+			if err != nil {
+				log.Printf("error syncing wallet: %v", err)
+			}
+			if report.Minted > 0 {
+				log.Printf("minted %v sats from paid quotes", report.Minted)
+			}
+			server.NotifySync(report)
+		})
+	}
+
+	fmt.Printf("wallet daemon listening on port %v\n", ctx.Int(portFlag))
+	if ctx.IsSet(grpcPortFlag) {
+		fmt.Printf("gRPC interface listening on port %v\n", ctx.Int(grpcPortFlag))
+	}
+	if err := server.Start(); err != nil {
+		printErr(err)
+	}
+	return nutw.Shutdown()
+}
+
+func payPaymentRequest(request string, amount uint64) error {
+	paymentRequest, err := nut18.DecodePaymentRequest(request)
+	if err != nil {
+		printErr(err)
+	}
+
+	payload, err := nutw.PayPaymentRequest(*paymentRequest, amount)
+	if err != nil {
+		printErr(err)
+	}
+
+	if len(paymentRequest.Transports) == 0 {
+		// no transport so print token to deliver it out-of-band
+		token, err := cashu.NewTokenV4(payload.Proofs, payload.Mint, nutw.Unit(), false)
+		if err != nil {
+			printErr(err)
+		}
+		tokenstr, err := token.Serialize()
+		if err != nil {
+			printErr(err)
+		}
+		fmt.Printf("payment request does not have a transport. Send this token to the receiver:\n%v\n", tokenstr)
+		return nil
+	}
+
+	fmt.Printf("paid %v sats\n", payload.Proofs.Amount())
+	return nil
+}
+
+const (
+	descriptionFlag = "description"
+	postURLFlag     = "post-url"
+)
+
+var requestCmd = &cli.Command{
+	Name:      "request",
+	Usage:     "Create a payment request (NUT-18)",
+	ArgsUsage: "[AMOUNT]",
+	Before:    setupWallet,
+	Action:    createPaymentRequest,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  descriptionFlag,
+			Usage: "description of the payment request",
+		},
+		&cli.StringFlag{
+			Name:  postURLFlag,
+			Usage: "URL to which the payment should be posted",
+		},
+		&cli.BoolFlag{
+			Name:               nostrFlag,
+			Usage:              "receive the payment as a nostr direct message",
+			DisableDefaultText: true,
+		},
+	},
+}
+
+func createPaymentRequest(ctx *cli.Context) error {
+	var amount uint64
+	if ctx.Args().Len() > 0 {
+		var err error
+		amount, err = strconv.ParseUint(ctx.Args().First(), 10, 64)
+		if err != nil {
+			printErr(err)
+		}
+	}
+
+	var transports []nut18.Transport
+	if ctx.IsSet(postURLFlag) {
+		transports = append(transports, nut18.Transport{Type: nut18.PostTransport, Target: ctx.String(postURLFlag)})
+	}
+	if ctx.Bool(nostrFlag) {
+		nprofile, err := nutw.NostrProfile()
+		if err != nil {
+			printErr(err)
+		}
+		transports = append(transports, nut18.Transport{
+			Type:   nut18.NostrTransport,
+			Target: nprofile,
+			Tags:   [][]string{{"n", "17"}},
+		})
+	}
+
+	paymentRequest, err := nutw.CreatePaymentRequest(amount, ctx.String(descriptionFlag), transports)
+	if err != nil {
+		printErr(err)
+	}
+	encoded, err := paymentRequest.Encode()
+	if err != nil {
+		printErr(err)
+	}
+	fmt.Println(encoded)
+	return nil
+}
+
+var nostrCmd = &cli.Command{
+	Name:  "nostr",
+	Usage: "Send and receive ecash through nostr",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "npub",
+			Usage:  "Show npub where the wallet receives ecash",
+			Before: setupWallet,
+			Action: nostrNpub,
+		},
+		{
+			Name:   "listen",
+			Usage:  "Listen for ecash sent to the wallet's npub and redeem it",
+			Before: setupWallet,
+			Action: nostrListen,
+		},
+	},
+}
+
+func nostrNpub(ctx *cli.Context) error {
+	npub, err := nutw.NostrPublicKey()
+	if err != nil {
+		printErr(err)
+	}
+	fmt.Printf("npub: %v\n", npub)
+
+	relays := nutw.NostrRelays()
+	if len(relays) == 0 {
+		fmt.Println("no relays configured. Set NOSTR_RELAYS to send and receive ecash through nostr")
+	} else {
+		fmt.Printf("relays: %v\n", strings.Join(relays, ", "))
+	}
+	return nil
+}
+
+func nostrListen(ctx *cli.Context) error {
+	listenCtx, cancel := signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	redeemed, err := nutw.ListenNostr(listenCtx)
+	if err != nil {
+		printErr(err)
+	}
+
+	fmt.Printf("listening for ecash on relays: %v\n", strings.Join(nutw.NostrRelays(), ", "))
+	for result := range redeemed {
+		if result.Err != nil {
+			fmt.Printf("error redeeming ecash: %v\n", result.Err)
+			continue
+		}
+		fmt.Printf("received %v sats\n", result.Amount)
+	}
+	return nutw.Shutdown()
+}
+
+const (
+	contactPubkeyFlag           = "pubkey"
+	contactLightningAddressFlag = "lightning-address"
+)
+
+var contactsCmd = &cli.Command{
+	Name:   "contacts",
+	Usage:  "Manage contacts to send ecash to by name",
+	Before: setupWallet,
+	Flags:  []cli.Flag{jsonOutputFlag},
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Usage:     "Add a contact or replace the one with the same name",
+			ArgsUsage: "[NAME]",
+			Before:    setupWallet,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  contactPubkeyFlag,
+					Usage: "public key to lock the ecash sent to the contact",
+				},
+				&cli.StringFlag{
+					Name:  nostrFlag,
+					Usage: "npub or nprofile to send the ecash to through nostr",
+				},
+				&cli.StringFlag{
+					Name:  contactLightningAddressFlag,
+					Usage: "lightning address to pay the contact",
+				},
+			},
+			Action: addContact,
+		},
+		{
+			Name:   "list",
+			Usage:  "List the contacts",
+			Before: setupWallet,
+			Flags:  []cli.Flag{jsonOutputFlag},
+			Action: listContacts,
+		},
+		{
+			Name:      "remove",
+			Usage:     "Remove a contact",
+			ArgsUsage: "[NAME]",
+			Before:    setupWallet,
+			Action:    removeContact,
+		},
+		{
+			Name:      "export",
+			Usage:     "Export the contacts as JSON to the file or to stdout",
+			ArgsUsage: "[FILE]",
+			Before:    setupWallet,
+			Action:    exportContacts,
+		},
+		{
+			Name:      "import",
+			Usage:     "Import contacts from a JSON file created with export",
+			ArgsUsage: "[FILE]",
+			Before:    setupWallet,
+			Action:    importContacts,
+		},
+	},
+	Action: listContacts,
+}
+
+func addContact(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify a name for the contact"))
+	}
+
+	contact := storage.Contact{
+		Name:             args.First(),
+		PublicKey:        ctx.String(contactPubkeyFlag),
+		Nostr:            ctx.String(nostrFlag),
+		LightningAddress: ctx.String(contactLightningAddressFlag),
+	}
+	if err := nutw.AddContact(contact); err != nil {
+		printErr(err)
+	}
+	fmt.Printf("contact '%v' saved\n", strings.TrimSpace(contact.Name))
+	return nil
+}
+
+func listContacts(ctx *cli.Context) error {
+	contacts := nutw.Contacts()
+	if ctx.Bool(jsonFlag) {
+		printJSON(contacts)
+		return nil
+	}
+	if len(contacts) == 0 {
+		fmt.Println("no contacts")
+		return nil
+	}
+
+	for _, contact := range contacts {
+		fmt.Printf("%v\n", contact.Name)
+		if len(contact.PublicKey) > 0 {
+			fmt.Printf("\tpublic key: %v\n", contact.PublicKey)
+		}
+		if len(contact.Nostr) > 0 {
+			fmt.Printf("\tnostr: %v\n", contact.Nostr)
+		}
+		if len(contact.LightningAddress) > 0 {
+			fmt.Printf("\tlightning address: %v\n", contact.LightningAddress)
+		}
+	}
+	return nil
+}
+
+func removeContact(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify the name of the contact to remove"))
+	}
+	if err := nutw.RemoveContact(args.First()); err != nil {
+		printErr(fmt.Errorf("%v '%v'", err, args.First()))
+	}
+	fmt.Printf("contact '%v' removed\n", args.First())
+	return nil
+}
+
+func exportContacts(ctx *cli.Context) error {
+	contacts, err := nutw.ExportContacts()
+	if err != nil {
+		printErr(err)
+	}
+
+	args := ctx.Args()
+	if args.Len() < 1 {
+		fmt.Println(string(contacts))
+		return nil
+	}
+	if err := os.WriteFile(args.First(), contacts, 0600); err != nil {
+		printErr(err)
+	}
+	fmt.Printf("contacts exported to %v\n", args.First())
+	return nil
+}
+
+func importContacts(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify the file with the contacts to import"))
+	}
+	data, err := os.ReadFile(args.First())
+	if err != nil {
+		printErr(err)
+	}
+
+	imported, err := nutw.ImportContacts(data)
+	if err != nil {
+		printErr(err)
+	}
+	fmt.Printf("%v contacts imported\n", imported)
+	return nil
+}
@@ -6,6 +6,7 @@ package crypto
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -124,7 +125,7 @@ func verify(Y *secp256k1.PublicKey, k *secp256k1.PrivateKey, C *secp256k1.Public
 	result.ToAffine()
 	pk := secp256k1.NewPublicKey(&result.X, &result.Y)
 
-	return C.IsEqual(pk)
+	return subtle.ConstantTimeCompare(C.SerializeCompressed(), pk.SerializeCompressed()) == 1
 }
 
 func HashE(publicKeys []*secp256k1.PublicKey) [32]byte {
@@ -191,7 +192,6 @@ func VerifyDLEQ(
 	var APoint, eA_Point secp256k1.JacobianPoint
 	A.AsJacobian(&APoint)
 	secp256k1.ScalarMultNonConst(&eNeg, &APoint, &eA_Point)
-	eA_Point.ToAffine()
 
 	// R1 = s*G - e*A
 	secp256k1.AddNonConst(&SPoint, &eA_Point, &R1Point)
@@ -201,13 +201,11 @@ func VerifyDLEQ(
 	var B_Point, sB_Point secp256k1.JacobianPoint
 	B_.AsJacobian(&B_Point)
 	secp256k1.ScalarMultNonConst(&s.Key, &B_Point, &sB_Point)
-	sB_Point.ToAffine()
 
 	// -e*C'
 	var C_Point, eC_Point secp256k1.JacobianPoint
 	C_.AsJacobian(&C_Point)
 	secp256k1.ScalarMultNonConst(&eNeg, &C_Point, &eC_Point)
-	eC_Point.ToAffine()
 
 	// R2 = s*B' - e*C'
 	secp256k1.AddNonConst(&sB_Point, &eC_Point, &R2Point)
@@ -221,3 +219,34 @@ func VerifyDLEQ(
 
 	return reflect.DeepEqual(ebytes, hash[:])
 }
+
+// VerifyProofDLEQ verifies the DLEQ proof (e, s) of an unblinded signature C on the secret.
+// The blinded message B_ and blinded signature C_ the proof was made for are
+// computed again with the blinding factor r.
+func VerifyProofDLEQ(
+	e *secp256k1.PrivateKey,
+	s *secp256k1.PrivateKey,
+	r *secp256k1.PrivateKey,
+	A *secp256k1.PublicKey,
+	secret string,
+	C *secp256k1.PublicKey,
+) bool {
+	B_, _, err := BlindMessage(secret, r)
+	if err != nil {
+		return false
+	}
+
+	var CPoint, APoint secp256k1.JacobianPoint
+	C.AsJacobian(&CPoint)
+	A.AsJacobian(&APoint)
+
+	// C' = C + r*A
+	var C_Point, rAPoint secp256k1.JacobianPoint
+	secp256k1.ScalarMultNonConst(&r.Key, &APoint, &rAPoint)
+	rAPoint.ToAffine()
+	secp256k1.AddNonConst(&CPoint, &rAPoint, &C_Point)
+	C_Point.ToAffine()
+	C_ := secp256k1.NewPublicKey(&C_Point.X, &C_Point.Y)
+
+	return VerifyDLEQ(e, s, A, B_, C_)
+}
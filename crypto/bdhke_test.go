@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"encoding/hex"
+	"fmt"
 	"testing"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
@@ -17,6 +18,8 @@ func TestHashToCurve(t *testing.T) {
 			expected: "024cce997d3b518f739663b757deaec95bcd9473c30a14ac2fd04023a739d1a725"},
 		{message: "0000000000000000000000000000000000000000000000000000000000000001",
 			expected: "022e7158e11c9506f1aa4248bf531298daa7febd6194f003edcd9b93ade6253acf"},
+		{message: "0000000000000000000000000000000000000000000000000000000000000002",
+			expected: "026cdbe15362df59cd1dd3c9c11de8aedac2106eca69236ecd9fbe117af897be4f"},
 	}
 
 	for _, test := range tests {
@@ -324,3 +327,63 @@ func BenchmarkE2E(b *testing.B) {
 
 	result = C
 }
+
+// dleqInputs returns the keys, B_ and C_ for n signatures
+func dleqInputs(b *testing.B, n int) ([]*secp256k1.PrivateKey, []*secp256k1.PublicKey, []*secp256k1.PublicKey) {
+	keys := make([]*secp256k1.PrivateKey, n)
+	B_s := make([]*secp256k1.PublicKey, n)
+	C_s := make([]*secp256k1.PublicKey, n)
+	for i := 0; i < n; i++ {
+		k, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			b.Fatalf("unexpected error generating private key: %v", err)
+		}
+		r, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			b.Fatalf("unexpected error generating private key: %v", err)
+		}
+		B_, _, err := BlindMessage(fmt.Sprintf("test_message_%v", i), r)
+		if err != nil {
+			b.Fatalf("unexpected error blinding message: %v", err)
+		}
+		keys[i] = k
+		B_s[i] = B_
+		C_s[i] = SignBlindedMessage(B_, k)
+	}
+	return keys, B_s, C_s
+}
+
+var dleqResult [2]*secp256k1.PrivateKey
+
+func BenchmarkGenerateDLEQ64(b *testing.B) {
+	keys, B_s, C_s := dleqInputs(b, 64)
+
+	var e, s *secp256k1.PrivateKey
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range keys {
+			e, s = GenerateDLEQ(keys[i], B_s[i], C_s[i])
+		}
+	}
+	dleqResult = [2]*secp256k1.PrivateKey{e, s}
+}
+
+func BenchmarkVerifyDLEQ64(b *testing.B) {
+	keys, B_s, C_s := dleqInputs(b, 64)
+	es := make([]*secp256k1.PrivateKey, len(keys))
+	ss := make([]*secp256k1.PrivateKey, len(keys))
+	As := make([]*secp256k1.PublicKey, len(keys))
+	for i := range keys {
+		es[i], ss[i] = GenerateDLEQ(keys[i], B_s[i], C_s[i])
+		As[i] = keys[i].PubKey()
+	}
+
+	var valid bool
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range keys {
+			valid = VerifyDLEQ(es[i], ss[i], As[i], B_s[i], C_s[i])
+		}
+	}
+	boolResult = valid
+}
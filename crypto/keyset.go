@@ -12,7 +12,7 @@ import (
 
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
-	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/internal/keys"
 )
 
 const MAX_ORDER = 60
@@ -32,25 +32,8 @@ type KeyPair struct {
 }
 
 func DeriveKeysetPath(key *hdkeychain.ExtendedKey, index uint32) (*hdkeychain.ExtendedKey, error) {
-	// path m/0'
-	child, err := key.Derive(hdkeychain.HardenedKeyStart + 0)
-	if err != nil {
-		return nil, err
-	}
-
-	// path m/0'/0' for sat
-	unitPath, err := child.Derive(hdkeychain.HardenedKeyStart + 0)
-	if err != nil {
-		return nil, err
-	}
-
-	// path m/0'/0'/index'
-	keysetPath, err := unitPath.Derive(hdkeychain.HardenedKeyStart + index)
-	if err != nil {
-		return nil, err
-	}
-
-	return keysetPath, nil
+	// path m/0'/0'/index' where m/0'/0' is for sat
+	return keys.DerivePath(key, keys.Hardened(0), keys.Hardened(0), keys.Hardened(index))
 }
 
 func GenerateKeyset(master *hdkeychain.ExtendedKey, index uint32, inputFeePpk uint, active bool) (*MintKeyset, error) {
@@ -85,7 +68,7 @@ func GenerateKeyset(master *hdkeychain.ExtendedKey, index uint32, inputFeePpk ui
 
 	return &MintKeyset{
 		Id:                keysetId,
-		Unit:              cashu.Sat.String(),
+		Unit:              "sat",
 		Active:            active,
 		DerivationPathIdx: index,
 		Keys:              keys,
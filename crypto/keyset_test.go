@@ -2,8 +2,11 @@ package crypto
 
 import (
 	"encoding/hex"
+	"strings"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 )
 
@@ -112,3 +115,140 @@ func TestDeriveKeysetId(t *testing.T) {
 
 	}
 }
+
+func TestGenerateKeysetVectors(t *testing.T) {
+	tests := []struct {
+		seed         []byte
+		index        uint32
+		expectedKeys map[uint64]string
+		// keys for amounts above MAX_ORDER to derive the id of a keyset with
+		// 64 amounts, which is what the vector from nutshell is for
+		extraKeys        map[uint64]string
+		expectedKeysetId string
+	}{
+		{
+			seed:  []byte("TEST_PRIVATE_KEY"),
+			index: 0,
+			expectedKeys: map[uint64]string{
+				1: "02194603ffa36356f4a56b7df9371fc3192472351453ec7398b8da8117e7c3e104",
+			},
+			extraKeys: map[uint64]string{
+				1 << 60: "0342f67cf3e82cde49ced155b7117f8d583ae8766bce4fd7aa170179ee43a0608e",
+				1 << 61: "0366c51883c60f37f3a74d05e725791efd98773eb143a98aa8808915b0ffe23c6d",
+				1 << 62: "020d25d8c67e59395983569cf5a7b86f13cccf95a7b4d374bc40ffac04c6437b86",
+				1 << 63: "023c84c0895cc0e827b348ea0a62951ca489a5e436f3ea7545f3c1d5f1bea1c866",
+			},
+			expectedKeysetId: "009a1f293253e41e",
+		},
+	}
+
+	for _, test := range tests {
+		master, err := hdkeychain.NewMaster(test.seed, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("error creating master key: %v", err)
+		}
+		keyset, err := GenerateKeyset(master, test.index, 0, true)
+		if err != nil {
+			t.Fatalf("error generating keyset: %v", err)
+		}
+
+		for amount, expected := range test.expectedKeys {
+			pubkey := hex.EncodeToString(keyset.Keys[amount].PublicKey.SerializeCompressed())
+			if pubkey != expected {
+				t.Errorf("expected key '%v' for amount %v but got '%v'", expected, amount, pubkey)
+			}
+		}
+
+		publicKeys := keyset.PublicKeys()
+		for amount, pubkey := range test.extraKeys {
+			pubkeyBytes, _ := hex.DecodeString(pubkey)
+			publicKey, err := secp256k1.ParsePubKey(pubkeyBytes)
+			if err != nil {
+				t.Fatalf("error parsing pub key: %v", err)
+			}
+			publicKeys[amount] = publicKey
+		}
+		if id := DeriveKeysetId(publicKeys); id != test.expectedKeysetId {
+			t.Errorf("expected keyset id '%v' but got '%v'", test.expectedKeysetId, id)
+		}
+	}
+}
+
+func TestGenerateKeyset(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("error creating master key: %v", err)
+	}
+
+	keyset, err := GenerateKeyset(master, 0, 100, true)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+
+	if len(keyset.Keys) != MAX_ORDER {
+		t.Fatalf("expected %v keys but got %v", MAX_ORDER, len(keyset.Keys))
+	}
+	for i := 0; i < MAX_ORDER; i++ {
+		amount := uint64(1) << i
+		keyPair, ok := keyset.Keys[amount]
+		if !ok {
+			t.Fatalf("expected key for amount %v", amount)
+		}
+		if !keyPair.PrivateKey.PubKey().IsEqual(keyPair.PublicKey) {
+			t.Fatalf("public key for amount %v does not match private key", amount)
+		}
+	}
+
+	if !strings.HasPrefix(keyset.Id, "00") || len(keyset.Id) != 16 {
+		t.Fatalf("expected version 00 keyset id of 16 characters but got '%v'", keyset.Id)
+	}
+	expectedId := DeriveKeysetId(keyset.PublicKeys())
+	if keyset.Id != expectedId {
+		t.Fatalf("expected keyset id '%v' but got '%v'", expectedId, keyset.Id)
+	}
+	if keyset.InputFeePpk != 100 || !keyset.Active || keyset.DerivationPathIdx != 0 {
+		t.Fatalf("unexpected keyset fields: %+v", keyset)
+	}
+
+	// same master and index should always derive the same keyset
+	sameKeyset, err := GenerateKeyset(master, 0, 100, true)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	if sameKeyset.Id != keyset.Id {
+		t.Fatalf("expected keyset id '%v' but got '%v'", keyset.Id, sameKeyset.Id)
+	}
+
+	otherKeyset, err := GenerateKeyset(master, 1, 100, true)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	if otherKeyset.Id == keyset.Id {
+		t.Fatal("expected different keyset id for different derivation index")
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	privateKey, _ := secp256k1.GeneratePrivateKey()
+	otherKey, _ := secp256k1.GeneratePrivateKey()
+	msg := []byte(`{"keysets":[]}`)
+
+	signature, err := SignMessage(privateKey, msg)
+	if err != nil {
+		t.Fatalf("unexpected error signing message: %v", err)
+	}
+
+	if !VerifyMessageSignature(signature, msg, privateKey.PubKey()) {
+		t.Fatal("expected valid signature")
+	}
+	if VerifyMessageSignature(signature, []byte(`{"keysets":[{}]}`), privateKey.PubKey()) {
+		t.Fatal("expected invalid signature for different message")
+	}
+	if VerifyMessageSignature(signature, msg, otherKey.PubKey()) {
+		t.Fatal("expected invalid signature for different public key")
+	}
+	if VerifyMessageSignature("not-hex", msg, privateKey.PubKey()) {
+		t.Fatal("expected invalid signature for malformed signature")
+	}
+}
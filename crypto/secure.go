@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// ConstantTimeEqual reports whether a and b are equal. The time it takes
+// does not depend on the contents, only on the length, so it should be used
+// when comparing secrets or preimages.
+func ConstantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// ZeroBytes overwrites b with zeros
+func ZeroBytes(b []byte) {
+	clear(b)
+}
+
+// ZeroPrivateKeys overwrites the private keys with zeros. nil keys are skipped.
+func ZeroPrivateKeys(keys ...*secp256k1.PrivateKey) {
+	for _, key := range keys {
+		if key != nil {
+			key.Zero()
+		}
+	}
+}
+
+// ZeroExtendedKey overwrites the key material of the extended key with zeros
+func ZeroExtendedKey(key *hdkeychain.ExtendedKey) {
+	if key != nil {
+		key.Zero()
+	}
+}
+
+// Zero overwrites the private keys of the keyset with zeros.
+// The keyset cannot be used to sign after this.
+func (ks *MintKeyset) Zero() {
+	for _, kp := range ks.Keys {
+		ZeroPrivateKeys(kp.PrivateKey)
+	}
+}
+
+// String returns only the public key so that
+// private keys do not end up in logs by mistake
+func (kp KeyPair) String() string {
+	if kp.PublicKey == nil {
+		return "{}"
+	}
+	return "{" + hex.EncodeToString(kp.PublicKey.SerializeCompressed()) + "}"
+}
+
+// GoString returns the same as String so that %#v does not print private keys either
+func (kp KeyPair) GoString() string {
+	return kp.String()
+}
@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestConstantTimeEqual(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected bool
+	}{
+		{a: "secret", b: "secret", expected: true},
+		{a: "", b: "", expected: true},
+		{a: "secret", b: "secreT", expected: false},
+		{a: "secret", b: "secrets", expected: false},
+		{a: "secret", b: "", expected: false},
+	}
+
+	for _, test := range tests {
+		if ConstantTimeEqual(test.a, test.b) != test.expected {
+			t.Errorf("expected %v comparing '%v' and '%v'", test.expected, test.a, test.b)
+		}
+	}
+}
+
+func TestZeroKeyset(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("error creating master key: %v", err)
+	}
+	keyset, err := GenerateKeyset(master, 0, 0, true)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+
+	keyPair := keyset.Keys[1]
+	privateKey := hex.EncodeToString(keyPair.PrivateKey.Serialize())
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		if strings.Contains(fmt.Sprintf(format, keyset), privateKey) {
+			t.Fatalf("private key should not be in keyset formatted with %v", format)
+		}
+	}
+
+	keyset.Zero()
+	for amount, kp := range keyset.Keys {
+		if !kp.PrivateKey.Key.IsZero() {
+			t.Fatalf("expected private key for amount %v to be zeroed", amount)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// SignMessage returns the hex-encoded schnorr signature of the sha256 hash of msg.
+// The mint uses it to sign the responses of its info and keys endpoints.
+func SignMessage(privateKey *secp256k1.PrivateKey, msg []byte) (string, error) {
+	hash := sha256.Sum256(msg)
+	sig, err := schnorr.Sign(privateKey, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sig.Serialize()), nil
+}
+
+// VerifyMessageSignature checks that signature is a valid hex-encoded
+// schnorr signature of the sha256 hash of msg by publicKey.
+func VerifyMessageSignature(signature string, msg []byte, publicKey *secp256k1.PublicKey) bool {
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256(msg)
+	return sig.Verify(hash[:], publicKey)
+}
@@ -0,0 +1,77 @@
+// Package keys wraps the BIP-39 mnemonic and BIP-32 key derivation
+// shared by the mint for its keysets and by the wallet for
+// deterministic secrets (NUT-13) and its other keys.
+package keys
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	// 128 bits of entropy give a mnemonic of 12 words
+	mnemonicEntropyBits = 128
+	// length in bytes of the random seeds generated for the mint
+	seedLength = 32
+)
+
+// NetParams are the chain params used to create master keys. They only
+// set the version bytes of serialized extended keys and do not change
+// any of the keys derived, so mainnet is used regardless of the network.
+var NetParams = &chaincfg.MainNetParams
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// NewMnemonic generates a new random 12 word BIP-39 mnemonic
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// ValidMnemonic returns true if the mnemonic has valid words and checksum
+func ValidMnemonic(mnemonic string) bool {
+	return bip39.IsMnemonicValid(mnemonic)
+}
+
+// SeedFromMnemonic returns the BIP-39 seed of the mnemonic with an empty passphrase
+func SeedFromMnemonic(mnemonic string) ([]byte, error) {
+	if !ValidMnemonic(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	return bip39.NewSeed(mnemonic, ""), nil
+}
+
+// NewSeed generates a new random seed
+func NewSeed() ([]byte, error) {
+	return hdkeychain.GenerateSeed(seedLength)
+}
+
+// NewMaster returns the BIP-32 master key of the seed
+func NewMaster(seed []byte) (*hdkeychain.ExtendedKey, error) {
+	return hdkeychain.NewMaster(seed, NetParams)
+}
+
+// Hardened returns the index for hardened derivation
+func Hardened(index uint32) uint32 {
+	return hdkeychain.HardenedKeyStart + index
+}
+
+// DerivePath derives the child key at the path from key.
+// Indexes for hardened derivation should be passed through Hardened, e.g
+// m/129372'/0'/1'/0 is DerivePath(master, Hardened(129372), Hardened(0), Hardened(1), 0)
+func DerivePath(key *hdkeychain.ExtendedKey, path ...uint32) (*hdkeychain.ExtendedKey, error) {
+	var err error
+	for _, index := range path {
+		key, err = key.Derive(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,85 @@
+package keys
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestSeedFromMnemonic(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	expectedSeed := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+
+	seed, err := SeedFromMnemonic(mnemonic)
+	if err != nil {
+		t.Fatalf("unexpected error getting seed: %v", err)
+	}
+	if hex.EncodeToString(seed) != expectedSeed {
+		t.Fatalf("expected seed '%v' but got '%v'", expectedSeed, hex.EncodeToString(seed))
+	}
+
+	invalid := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"
+	if ValidMnemonic(invalid) {
+		t.Fatal("expected mnemonic with invalid checksum to not be valid")
+	}
+	if _, err := SeedFromMnemonic(invalid); err != ErrInvalidMnemonic {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidMnemonic, err)
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatalf("unexpected error generating mnemonic: %v", err)
+	}
+	if !ValidMnemonic(mnemonic) {
+		t.Fatalf("expected generated mnemonic '%v' to be valid", mnemonic)
+	}
+}
+
+// test vector 1 from BIP-32
+func TestDerivePath(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMaster(seed)
+	if err != nil {
+		t.Fatalf("unexpected error creating master key: %v", err)
+	}
+
+	tests := []struct {
+		path        []uint32
+		expectedPub string
+		expectedPrv string
+	}{
+		{
+			path:        nil,
+			expectedPub: "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+			expectedPrv: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+		},
+		{
+			path:        []uint32{Hardened(0)},
+			expectedPub: "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			expectedPrv: "xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7",
+		},
+		{
+			path:        []uint32{Hardened(0), 1},
+			expectedPub: "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ",
+			expectedPrv: "xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs",
+		},
+	}
+
+	for _, test := range tests {
+		key, err := DerivePath(master, test.path...)
+		if err != nil {
+			t.Fatalf("unexpected error deriving path %v: %v", test.path, err)
+		}
+		if key.String() != test.expectedPrv {
+			t.Errorf("expected private key '%v' but got '%v'", test.expectedPrv, key.String())
+		}
+		pub, err := key.Neuter()
+		if err != nil {
+			t.Fatalf("unexpected error getting public key: %v", err)
+		}
+		if pub.String() != test.expectedPub {
+			t.Errorf("expected public key '%v' but got '%v'", test.expectedPub, pub.String())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package nip01 has the Nostr events defined in NIP-01 and their
+// signing and verification, shared by the wallet and the mint.
+package nip01
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+var (
+	ErrInvalidEventId        = errors.New("invalid event id")
+	ErrInvalidEventSignature = errors.New("invalid event signature")
+)
+
+// Event as defined in NIP-01
+type Event struct {
+	Id        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig,omitempty"`
+}
+
+// PublicKeyHex returns the x-only hex encoded public key used in events
+func PublicKeyHex(publicKey *secp256k1.PublicKey) string {
+	return hex.EncodeToString(schnorr.SerializePubKey(publicKey))
+}
+
+// ParsePublicKey parses an x-only hex encoded public key
+func ParsePublicKey(publicKey string) (*secp256k1.PublicKey, error) {
+	pubkeyBytes, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.ParsePubKey(pubkeyBytes)
+}
+
+// serialize returns the serialization of the event used to compute its id
+func (e *Event) serialize() ([]byte, error) {
+	tags := e.Tags
+	if tags == nil {
+		tags = [][]string{}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode([]any{0, e.PubKey, e.CreatedAt, e.Kind, tags, e.Content}); err != nil {
+		return nil, err
+	}
+	// remove newline added by the encoder
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ComputeId sets the id of the event
+func (e *Event) ComputeId() error {
+	if e.Tags == nil {
+		e.Tags = [][]string{}
+	}
+	serialized, err := e.serialize()
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(serialized)
+	e.Id = hex.EncodeToString(hash[:])
+	return nil
+}
+
+// Sign sets the pubkey, id and signature of the event
+func (e *Event) Sign(privateKey *secp256k1.PrivateKey) error {
+	e.PubKey = PublicKeyHex(privateKey.PubKey())
+	if err := e.ComputeId(); err != nil {
+		return err
+	}
+
+	id, _ := hex.DecodeString(e.Id)
+	sig, err := schnorr.Sign(privateKey, id)
+	if err != nil {
+		return err
+	}
+	e.Sig = hex.EncodeToString(sig.Serialize())
+	return nil
+}
+
+// Verify checks that the id and signature of the event are valid
+func (e *Event) Verify() error {
+	serialized, err := e.serialize()
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(serialized)
+	if hex.EncodeToString(hash[:]) != e.Id {
+		return ErrInvalidEventId
+	}
+
+	publicKey, err := ParsePublicKey(e.PubKey)
+	if err != nil {
+		return err
+	}
+	sigBytes, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return ErrInvalidEventSignature
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return ErrInvalidEventSignature
+	}
+	if !sig.Verify(hash[:], publicKey) {
+		return ErrInvalidEventSignature
+	}
+	return nil
+}
+
+// Tag returns the value of the first tag with the name passed
+func (e *Event) Tag(name string) (string, bool) {
+	for _, tag := range e.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1], true
+		}
+	}
+	return "", false
+}
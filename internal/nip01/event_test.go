@@ -0,0 +1,44 @@
+package nip01
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestSignVerify(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	event := Event{CreatedAt: 1700000000, Kind: 1, Content: "hello <nostr> & \"friends\""}
+	if err := event.Sign(key); err != nil {
+		t.Fatalf("unexpected error signing event: %v", err)
+	}
+	if event.PubKey != PublicKeyHex(key.PubKey()) {
+		t.Fatalf("expected pubkey '%v' but got '%v'", PublicKeyHex(key.PubKey()), event.PubKey)
+	}
+	if err := event.Verify(); err != nil {
+		t.Fatalf("expected valid event but got error: %v", err)
+	}
+
+	tampered := event
+	tampered.Content = "bye"
+	if err := tampered.Verify(); !errors.Is(err, ErrInvalidEventId) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidEventId, err)
+	}
+
+	// valid id but signed by a different key
+	otherKey, _ := secp256k1.GeneratePrivateKey()
+	other := Event{CreatedAt: event.CreatedAt, Kind: event.Kind, Content: event.Content}
+	if err := other.Sign(otherKey); err != nil {
+		t.Fatalf("unexpected error signing event: %v", err)
+	}
+	tampered = event
+	tampered.Sig = other.Sig
+	if err := tampered.Verify(); !errors.Is(err, ErrInvalidEventSignature) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidEventSignature, err)
+	}
+}
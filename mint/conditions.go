@@ -0,0 +1,51 @@
+package mint
+
+import (
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/cashu/nuts/nut14"
+)
+
+// SpendingConditionVerifier verifies that a proof locked to a
+// NUT-10 spending condition has a valid witness to be spent.
+type SpendingConditionVerifier interface {
+	VerifyProof(proof cashu.Proof, secret nut10.WellKnownSecret) error
+}
+
+// SpendingConditionVerifierFunc allows using a regular function as a SpendingConditionVerifier.
+type SpendingConditionVerifierFunc func(proof cashu.Proof, secret nut10.WellKnownSecret) error
+
+func (f SpendingConditionVerifierFunc) VerifyProof(proof cashu.Proof, secret nut10.WellKnownSecret) error {
+	return f(proof, secret)
+}
+
+// defaultSpendingConditions returns the verifiers for the
+// spending conditions supported by the mint out of the box.
+func defaultSpendingConditions() map[nut10.SecretKind]SpendingConditionVerifier {
+	return map[nut10.SecretKind]SpendingConditionVerifier{
+		nut10.P2PK: SpendingConditionVerifierFunc(nut11.VerifyP2PKLockedProof),
+		nut10.HTLC: SpendingConditionVerifierFunc(nut14.VerifyHTLCProof),
+	}
+}
+
+// verifySpendingCondition checks the witness of the proof if its secret is a
+// well-known secret with a registered verifier for its kind.
+// Proofs with regular secrets or kinds that do not have a verifier are left as is.
+func (m *Mint) verifySpendingCondition(proof cashu.Proof) error {
+	secret, err := nut10.DeserializeSecret(proof.Secret)
+	if err != nil {
+		return nil
+	}
+
+	verifier, ok := m.spendingConditions[secret.Kind]
+	if !ok {
+		return nil
+	}
+	if err := verifier.VerifyProof(proof, secret); err != nil {
+		return err
+	}
+	m.logDebugf("verified %v locked proof", secret.Kind)
+
+	return nil
+}
@@ -1,9 +1,11 @@
 package mint
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 	"github.com/elnosh/gonuts/mint/lightning"
 )
 
@@ -15,6 +17,17 @@ const (
 	Disable
 )
 
+// DBDriver is the storage used by the mint
+type DBDriver string
+
+const (
+	// SQLite stores the mint data in a sqlite db in MintPath. It is the default.
+	SQLite DBDriver = "sqlite"
+	// Memory keeps the mint data in memory, nothing is written to disk.
+	// Everything is lost when the mint stops so it is only for tests and throwaway mints.
+	Memory DBDriver = "memory"
+)
+
 type Config struct {
 	RotateKeyset      bool
 	Port              int
@@ -26,10 +39,48 @@ type Config struct {
 	EnableMPP         bool
 	EnableAdminServer bool
 	LogLevel          LogLevel
+	DBDriver          DBDriver
+	// DBMigrationPath is a directory to read the sqlite migrations from
+	// instead of the ones embedded in the binary. Only meant for development.
+	DBMigrationPath string
+	// DBReadReplicaPath is a directory with a read-only replica of the sqlite db
+	// kept in sync with the primary by an external tool (e.g. LiteFS). If set,
+	// restoring signatures (NUT-09) and the issued and redeemed ecash reported
+	// to the admin are read from it. Writes and the state of proofs always
+	// go to the primary.
+	DBReadReplicaPath string
+	Retention         RetentionPolicy
+	// ReconcileInterval is how often unpaid mint quotes and pending melt quotes
+	// are checked against the lightning backend in case the mint missed an update.
+	// If 0, they are only reconciled when requested.
+	ReconcileInterval time.Duration
+	// SpendingConditions registers additional verifiers for NUT-10 secret kinds.
+	// These take precedence over the built-in P2PK and HTLC verifiers.
+	// Kinds other than those need to be added first with nut10.RegisterKind.
+	SpendingConditions map[nut10.SecretKind]SpendingConditionVerifier
 	// NOTE: using this value for testing
 	MeltTimeout *time.Duration
 }
 
+// RetentionPolicy sets how long the mint keeps data it no longer needs to operate.
+// A value of 0 keeps that data forever. Spent proofs are always kept since they
+// are needed to prevent double spends.
+type RetentionPolicy struct {
+	// days to keep issued mint quotes after they expire
+	MintQuoteDays uint
+	// days to keep paid melt quotes after they expire
+	MeltQuoteDays uint
+	// days to keep blind signatures. Wallets can only restore (NUT-09)
+	// ecash that was signed within this window.
+	BlindSignatureDays uint
+	// how often old data is deleted. Defaults to once a day
+	Interval time.Duration
+}
+
+func (policy RetentionPolicy) enabled() bool {
+	return policy.MintQuoteDays > 0 || policy.MeltQuoteDays > 0 || policy.BlindSignatureDays > 0
+}
+
 type MintInfo struct {
 	Name            string
 	Description     string
@@ -55,3 +106,17 @@ type MintLimits struct {
 	MintingSettings MintMethodSettings
 	MeltingSettings MeltMethodSettings
 }
+
+func (limits MintLimits) validate() error {
+	minting := limits.MintingSettings
+	if minting.MaxAmount > 0 && minting.MinAmount > minting.MaxAmount {
+		return fmt.Errorf("min amount for minting (%v) is greater than max amount (%v)",
+			minting.MinAmount, minting.MaxAmount)
+	}
+	melting := limits.MeltingSettings
+	if melting.MaxAmount > 0 && melting.MinAmount > melting.MaxAmount {
+		return fmt.Errorf("min amount for melting (%v) is greater than max amount (%v)",
+			melting.MinAmount, melting.MaxAmount)
+	}
+	return nil
+}
@@ -8,8 +8,12 @@ import (
 
 	"github.com/elnosh/gonuts/cashu/nuts/nut04"
 	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/mint/storage"
 )
 
+// how long to wait before subscribing again if the invoices subscription fails
+const invoicesResubscribeDelay = time.Second * 5
+
 // checkInvoicePaid should be called in a different goroutine to check in the background
 // if the invoice for the quoteId gets paid and update it in the db.
 func (m *Mint) checkInvoicePaid(ctx context.Context, quoteId string) {
@@ -53,12 +57,7 @@ func (m *Mint) checkInvoicePaid(ctx context.Context, quoteId string) {
 	case invoice := <-updateChan:
 		if invoice.Settled {
 			m.logInfof("received update from invoice sub. Invoice for mint quote '%v' is PAID", mintQuote.Id)
-			mintQuote.State = nut04.Paid
-			if err := m.db.UpdateMintQuoteState(mintQuote.Id, mintQuote.State); err != nil {
-				m.logErrorf("could not mark mint quote '%v' as PAID in db: %v", mintQuote.Id, err)
-			}
-			jsonQuote, _ := json.Marshal(mintQuote)
-			m.publisher.Publish(BOLT11_MINT_QUOTE_TOPIC, jsonQuote)
+			m.setMintQuotePaid(mintQuote)
 		}
 	case err := <-errChan:
 		if errors.Is(ctx.Err(), context.Canceled) {
@@ -71,3 +70,59 @@ func (m *Mint) checkInvoicePaid(ctx context.Context, quoteId string) {
 		m.logDebugf("canceling invoice subscription for quote '%v'. Reached deadline", mintQuote.Id)
 	}
 }
+
+// watchInvoices uses a single subscription to the backend for all invoices
+// and marks mint quotes as paid when their invoice gets settled.
+// If the subscription fails, it subscribes again after a delay.
+func (m *Mint) watchInvoices(ctx context.Context, subscriber lightning.InvoicesSubscriber) {
+	for {
+		err := m.processInvoiceUpdates(ctx, subscriber)
+		if ctx.Err() != nil {
+			m.logDebugf("stopping invoices subscription. Context canceled")
+			return
+		}
+		m.logErrorf("error reading from invoices subscription: %v. Subscribing again in %v", err, invoicesResubscribeDelay)
+
+		select {
+		case <-time.After(invoicesResubscribeDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Mint) processInvoiceUpdates(ctx context.Context, subscriber lightning.InvoicesSubscriber) error {
+	invoicesSub, err := subscriber.SubscribeInvoices(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		invoice, err := invoicesSub.Recv()
+		if err != nil {
+			return err
+		}
+		if !invoice.Settled {
+			continue
+		}
+
+		// not all invoices from the backend are for mint quotes
+		mintQuote, err := m.db.GetMintQuoteByPaymentHash(invoice.PaymentHash)
+		if err != nil || mintQuote.State != nut04.Unpaid {
+			continue
+		}
+		m.logInfof("received update from invoices sub. Invoice for mint quote '%v' is PAID", mintQuote.Id)
+		m.setMintQuotePaid(mintQuote)
+	}
+}
+
+func (m *Mint) setMintQuotePaid(mintQuote storage.MintQuote) error {
+	mintQuote.State = nut04.Paid
+	if err := m.db.UpdateMintQuoteState(mintQuote.Id, mintQuote.State); err != nil {
+		m.logErrorf("could not mark mint quote '%v' as PAID in db: %v", mintQuote.Id, err)
+		return err
+	}
+	jsonQuote, _ := json.Marshal(mintQuote)
+	m.publisher.Publish(BOLT11_MINT_QUOTE_TOPIC, jsonQuote)
+	return nil
+}
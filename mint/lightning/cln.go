@@ -0,0 +1,673 @@
+package lightning
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const (
+	// CLN JSON-RPC error codes
+	CLNInvoiceExpiredErrCode = 903
+	CLNPaymentFailedErrCode  = 210
+)
+
+var ErrCLNConnectionClosed = errors.New("connection to CLN closed")
+
+type CLNConfig struct {
+	// path to the lightning-rpc unix socket. i.e ~/.lightning/bitcoin/lightning-rpc
+	SocketPath string
+	// optional logger for requests to CLN. Nothing is logged if nil
+	Logger *slog.Logger
+	// description for invoices created by the mint. Empty by default
+	InvoiceDescription string
+	// only include the hash of the description in the invoice
+	DescriptionHashOnly bool
+	// prefix for invoice labels. Labels are the prefix followed by the
+	// quote id so invoices can be matched with mint quotes. Default is "gonuts"
+	LabelPrefix string
+	// include route hints for private channels in invoices so that
+	// payers can split large payments across them
+	RouteHints bool
+}
+
+// CLNClient talks JSON-RPC to CLN over its lightning-rpc unix socket.
+// Requests are pipelined over a single connection and matched
+// to their responses by id. If the node restarts, the connection
+// is re-established on the next request.
+type CLNClient struct {
+	socketPath string
+	logger     *slog.Logger
+
+	invoiceDescription  string
+	descriptionHashOnly bool
+	labelPrefix         string
+	routeHints          bool
+
+	mu      sync.Mutex
+	conn    net.Conn
+	nextId  uint64
+	pending map[string]chan clnRPCResponse
+}
+
+func SetupCLNClient(config CLNConfig) (*CLNClient, error) {
+	if len(config.SocketPath) == 0 {
+		return nil, errors.New("CLN socket path cannot be empty")
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	labelPrefix := config.LabelPrefix
+	if len(labelPrefix) == 0 {
+		labelPrefix = "gonuts"
+	}
+
+	client := &CLNClient{
+		socketPath:          config.SocketPath,
+		logger:              logger,
+		invoiceDescription:  config.InvoiceDescription,
+		descriptionHashOnly: config.DescriptionHashOnly,
+		labelPrefix:         labelPrefix,
+		routeHints:          config.RouteHints,
+		pending:             make(map[string]chan clnRPCResponse),
+	}
+	if err := client.ConnectionStatus(context.Background()); err != nil {
+		return nil, fmt.Errorf("could not connect to CLN: %v", err)
+	}
+	return client, nil
+}
+
+type clnRPCRequest struct {
+	JsonRPC string `json:"jsonrpc"`
+	Id      string `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type clnRPCResponse struct {
+	Id     string          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *CLNRPCError    `json:"error"`
+
+	// set if the connection was closed before getting a response
+	connErr error
+}
+
+type CLNRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e CLNRPCError) Error() string {
+	return fmt.Sprintf("CLN error %v: %v", e.Code, e.Message)
+}
+
+type clnInvoice struct {
+	Label           string `json:"label"`
+	Bolt11          string `json:"bolt11"`
+	PaymentHash     string `json:"payment_hash"`
+	AmountMsat      uint64 `json:"amount_msat"`
+	Status          string `json:"status"`
+	PaymentPreimage string `json:"payment_preimage"`
+	ExpiresAt       uint64 `json:"expires_at"`
+	PayIndex        uint64 `json:"pay_index"`
+	// with MPP, the sum of all the parts received
+	AmountReceivedMsat uint64 `json:"amount_received_msat"`
+}
+
+func (invoice clnInvoice) toInvoice() Invoice {
+	return Invoice{
+		PaymentRequest: invoice.Bolt11,
+		PaymentHash:    invoice.PaymentHash,
+		Preimage:       invoice.PaymentPreimage,
+		Settled:        invoice.Status == "paid" && invoice.AmountReceivedMsat >= invoice.AmountMsat,
+		Accepted:       invoice.Status == "accepted",
+		Amount:         invoice.AmountMsat / 1000,
+		Expiry:         invoice.ExpiresAt,
+	}
+}
+
+type clnPayment struct {
+	PaymentHash     string `json:"payment_hash"`
+	Status          string `json:"status"`
+	PaymentPreimage string `json:"payment_preimage"`
+	Preimage        string `json:"preimage"`
+	AmountMsat      uint64 `json:"amount_msat"`
+	AmountSentMsat  uint64 `json:"amount_sent_msat"`
+}
+
+func (payment clnPayment) toPaymentStatus() PaymentStatus {
+	preimage := payment.PaymentPreimage
+	if len(preimage) == 0 {
+		preimage = payment.Preimage
+	}
+
+	switch payment.Status {
+	case "complete":
+		var fee uint64
+		if payment.AmountSentMsat > payment.AmountMsat {
+			fee = payment.AmountSentMsat - payment.AmountMsat
+		}
+		return PaymentStatus{Preimage: preimage, PaymentStatus: Succeeded, FeeMsat: fee}
+	case "pending":
+		return PaymentStatus{PaymentStatus: Pending}
+	default:
+		return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: payment.Status}
+	}
+}
+
+func (cln *CLNClient) ConnectionStatus(ctx context.Context) error {
+	var info struct {
+		Id string `json:"id"`
+	}
+	return cln.call(ctx, "getinfo", struct{}{}, &info)
+}
+
+func (cln *CLNClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return Invoice{}, err
+	}
+
+	label, ok := QuoteIdFromContext(ctx)
+	if !ok {
+		label = hex.EncodeToString(random[:])
+	}
+
+	params := map[string]any{
+		"amount_msat": amount * 1000,
+		"label":       cln.labelPrefix + "-" + label,
+		"description": cln.invoiceDescription,
+		"expiry":      InvoiceExpiryTime,
+	}
+	if cln.descriptionHashOnly {
+		params["deschashonly"] = true
+	}
+	// invoices from CLN always allow the payer to use MPP
+	if cln.routeHints {
+		params["exposeprivatechannels"] = true
+	}
+	var invoice clnInvoice
+	if err := cln.call(ctx, "invoice", params, &invoice); err != nil {
+		return Invoice{}, err
+	}
+
+	return Invoice{
+		PaymentRequest: invoice.Bolt11,
+		PaymentHash:    invoice.PaymentHash,
+		Amount:         amount,
+		Expiry:         InvoiceExpiryTime,
+	}, nil
+}
+
+func (cln *CLNClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	invoice, err := cln.lookupInvoice(ctx, hash)
+	if err != nil {
+		return Invoice{}, err
+	}
+	return invoice.toInvoice(), nil
+}
+
+func (cln *CLNClient) lookupInvoice(ctx context.Context, hash string) (clnInvoice, error) {
+	var listInvoices struct {
+		Invoices []clnInvoice `json:"invoices"`
+	}
+	params := map[string]string{"payment_hash": hash}
+	if err := cln.call(ctx, "listinvoices", params, &listInvoices); err != nil {
+		return clnInvoice{}, err
+	}
+	if len(listInvoices.Invoices) == 0 {
+		return clnInvoice{}, fmt.Errorf("invoice with hash '%v' not found", hash)
+	}
+	return listInvoices.Invoices[0], nil
+}
+
+func (cln *CLNClient) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	params := map[string]any{
+		"bolt11": request,
+		"maxfee": maxFee * 1000,
+	}
+	return cln.pay(ctx, params)
+}
+
+func (cln *CLNClient) PayPartialAmount(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	params := map[string]any{
+		"bolt11":       request,
+		"partial_msat": amountMsat,
+		"maxfee":       maxFee * 1000,
+	}
+	return cln.pay(ctx, params)
+}
+
+func (cln *CLNClient) pay(ctx context.Context, params map[string]any) (PaymentStatus, error) {
+	var payment clnPayment
+	if err := cln.call(ctx, "pay", params, &payment); err != nil {
+		// if context deadline is exceeded or connection was lost
+		// the payment could still be in flight so mark it as pending.
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, ErrCLNConnectionClosed) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	status := payment.toPaymentStatus()
+	if status.PaymentStatus == Failed {
+		return status, fmt.Errorf("payment failed with status '%v'", payment.Status)
+	}
+	return status, nil
+}
+
+func (cln *CLNClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	var listSendPays struct {
+		Payments []clnPayment `json:"payments"`
+	}
+	params := map[string]string{"payment_hash": hash}
+	if err := cln.call(ctx, "listsendpays", params, &listSendPays); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	// the payment might not be in the db yet if it was just sent
+	// so do not treat it as failed
+	if len(listSendPays.Payments) == 0 {
+		return PaymentStatus{PaymentStatus: Unknown}, nil
+	}
+
+	// there is an entry for each part of a payment and for each
+	// attempt. If any part completed the payment succeeded, if any
+	// is pending it is still in flight.
+	var succeeded, pending bool
+	var fee uint64
+	var preimage string
+	for _, payment := range listSendPays.Payments {
+		status := payment.toPaymentStatus()
+		switch status.PaymentStatus {
+		case Succeeded:
+			succeeded = true
+			fee += status.FeeMsat
+			preimage = status.Preimage
+		case Pending:
+			pending = true
+		}
+	}
+	if succeeded {
+		return PaymentStatus{Preimage: preimage, PaymentStatus: Succeeded, FeeMsat: fee}, nil
+	}
+	if pending {
+		return PaymentStatus{PaymentStatus: Pending}, nil
+	}
+	return listSendPays.Payments[len(listSendPays.Payments)-1].toPaymentStatus(), nil
+}
+
+func (cln *CLNClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * FeePercent)
+	return uint64(fee)
+}
+
+func (cln *CLNClient) EstimateFee(ctx context.Context, request string) (uint64, error) {
+	bolt11, err := decodepay.Decodepay(request)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding invoice: %v", err)
+	}
+
+	var info struct {
+		Id string `json:"id"`
+	}
+	if err := cln.call(ctx, "getinfo", struct{}{}, &info); err != nil {
+		return 0, err
+	}
+
+	amountMsat := uint64(bolt11.MSatoshi)
+	params := map[string]any{
+		"source":      info.Id,
+		"destination": bolt11.Payee,
+		"amount_msat": amountMsat,
+		"layers":      []string{"auto.localchans"},
+		"maxfee_msat": amountMsat,
+		"final_cltv":  bolt11.MinFinalCLTVExpiry,
+	}
+	var getRoutes struct {
+		Routes []struct {
+			AmountMsat uint64 `json:"amount_msat"`
+			Path       []struct {
+				AmountMsat uint64 `json:"amount_msat"`
+			} `json:"path"`
+		} `json:"routes"`
+	}
+	if err := cln.call(ctx, "getroutes", params, &getRoutes); err != nil {
+		return 0, err
+	}
+	if len(getRoutes.Routes) == 0 {
+		return 0, errors.New("no routes found")
+	}
+
+	// the payment could be split across routes. Fee is what
+	// gets sent to the first hop minus what gets delivered.
+	var fee uint64
+	for _, route := range getRoutes.Routes {
+		if len(route.Path) == 0 || route.Path[0].AmountMsat < route.AmountMsat {
+			return 0, errors.New("invalid route from CLN")
+		}
+		fee += route.Path[0].AmountMsat - route.AmountMsat
+	}
+	return fee, nil
+}
+
+func (cln *CLNClient) GetInfo(ctx context.Context) (NodeInfo, error) {
+	var info struct {
+		Id                string `json:"id"`
+		Alias             string `json:"alias"`
+		NumActiveChannels uint32 `json:"num_active_channels"`
+		BlockHeight       uint32 `json:"blockheight"`
+	}
+	if err := cln.call(ctx, "getinfo", struct{}{}, &info); err != nil {
+		return NodeInfo{}, err
+	}
+	return NodeInfo{
+		Alias:          info.Alias,
+		Pubkey:         info.Id,
+		ActiveChannels: info.NumActiveChannels,
+		BlockHeight:    info.BlockHeight,
+	}, nil
+}
+
+func (cln *CLNClient) ChannelBalances(ctx context.Context) (ChannelBalances, error) {
+	var peerChannels struct {
+		Channels []struct {
+			State          string            `json:"state"`
+			PeerConnected  bool              `json:"peer_connected"`
+			SpendableMsat  uint64            `json:"spendable_msat"`
+			ReceivableMsat uint64            `json:"receivable_msat"`
+			Htlcs          []json.RawMessage `json:"htlcs"`
+		} `json:"channels"`
+	}
+	if err := cln.call(ctx, "listpeerchannels", struct{}{}, &peerChannels); err != nil {
+		return ChannelBalances{}, err
+	}
+
+	var balances ChannelBalances
+	for _, channel := range peerChannels.Channels {
+		if channel.State != "CHANNELD_NORMAL" || !channel.PeerConnected {
+			continue
+		}
+		balances.OutboundMsat += channel.SpendableMsat
+		balances.InboundMsat += channel.ReceivableMsat
+		balances.PendingHTLCs += uint32(len(channel.Htlcs))
+	}
+	return balances, nil
+}
+
+func (cln *CLNClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
+	invoice, err := cln.lookupInvoice(ctx, paymentHash)
+	if err != nil {
+		return nil, err
+	}
+	return &CLNInvoiceSub{
+		ctx:    ctx,
+		label:  invoice.Label,
+		client: cln,
+	}, nil
+}
+
+// CLNInvoiceSub uses waitinvoice which blocks
+// until the invoice is paid or expires.
+type CLNInvoiceSub struct {
+	ctx    context.Context
+	label  string
+	client *CLNClient
+}
+
+func (sub *CLNInvoiceSub) Recv() (Invoice, error) {
+	var invoice clnInvoice
+	params := map[string]string{"label": sub.label}
+	if err := sub.client.call(sub.ctx, "waitinvoice", params, &invoice); err != nil {
+		var rpcErr CLNRPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == CLNInvoiceExpiredErrCode {
+			return Invoice{}, errors.New("invoice expired")
+		}
+		return Invoice{}, err
+	}
+	return invoice.toInvoice(), nil
+}
+
+func (cln *CLNClient) SubscribeInvoices(ctx context.Context) (InvoiceSubscriptionClient, error) {
+	var listInvoices struct {
+		Invoices []clnInvoice `json:"invoices"`
+	}
+	if err := cln.call(ctx, "listinvoices", struct{}{}, &listInvoices); err != nil {
+		return nil, err
+	}
+
+	// start from the last paid invoice to only get invoices paid from now on
+	var lastPayIndex uint64
+	for _, invoice := range listInvoices.Invoices {
+		lastPayIndex = max(lastPayIndex, invoice.PayIndex)
+	}
+
+	return &CLNInvoicesSub{
+		ctx:          ctx,
+		lastPayIndex: lastPayIndex,
+		client:       cln,
+	}, nil
+}
+
+// CLNInvoicesSub uses waitanyinvoice to get
+// invoices in the order in which they get paid.
+type CLNInvoicesSub struct {
+	ctx          context.Context
+	lastPayIndex uint64
+	client       *CLNClient
+}
+
+func (sub *CLNInvoicesSub) Recv() (Invoice, error) {
+	var invoice clnInvoice
+	params := map[string]uint64{"lastpay_index": sub.lastPayIndex}
+	if err := sub.client.call(sub.ctx, "waitanyinvoice", params, &invoice); err != nil {
+		return Invoice{}, err
+	}
+	sub.lastPayIndex = invoice.PayIndex
+	return invoice.toInvoice(), nil
+}
+
+// CreateHoldInvoice needs the hold plugin (https://github.com/BoltzExchange/hold)
+// since CLN does not support hold invoices on its own.
+func (cln *CLNClient) CreateHoldInvoice(ctx context.Context, paymentHash string, amount uint64) (Invoice, error) {
+	params := map[string]any{
+		"payment_hash": paymentHash,
+		"amount_msat":  amount * 1000,
+		"description":  cln.invoiceDescription,
+		"expiry":       InvoiceExpiryTime,
+	}
+	var holdInvoice struct {
+		Bolt11 string `json:"bolt11"`
+	}
+	if err := cln.call(ctx, "holdinvoice", params, &holdInvoice); err != nil {
+		return Invoice{}, err
+	}
+
+	return Invoice{
+		PaymentRequest: holdInvoice.Bolt11,
+		PaymentHash:    paymentHash,
+		Amount:         amount,
+		Expiry:         InvoiceExpiryTime,
+	}, nil
+}
+
+func (cln *CLNClient) SettleHoldInvoice(ctx context.Context, preimage string) error {
+	var result json.RawMessage
+	return cln.call(ctx, "settleholdinvoice", map[string]string{"preimage": preimage}, &result)
+}
+
+func (cln *CLNClient) CancelHoldInvoice(ctx context.Context, paymentHash string) error {
+	var result json.RawMessage
+	return cln.call(ctx, "cancelholdinvoice", map[string]string{"payment_hash": paymentHash}, &result)
+}
+
+// call sends the request to CLN and waits for its response or until ctx is done.
+func (cln *CLNClient) call(ctx context.Context, method string, params any, dst any) error {
+	responseChan := make(chan clnRPCResponse, 1)
+
+	cln.mu.Lock()
+	if cln.conn == nil {
+		if err := cln.connect(); err != nil {
+			cln.mu.Unlock()
+			return err
+		}
+	}
+	cln.nextId++
+	request := clnRPCRequest{
+		JsonRPC: "2.0",
+		Id:      "gonuts:" + method + "#" + strconv.FormatUint(cln.nextId, 10),
+		Method:  method,
+		Params:  params,
+	}
+	cln.pending[request.Id] = responseChan
+	cln.logger.Debug("sending request to CLN", slog.String("id", request.Id), slog.String("method", method))
+
+	if err := json.NewEncoder(cln.conn).Encode(request); err != nil {
+		delete(cln.pending, request.Id)
+		cln.closeConn(err)
+		cln.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrCLNConnectionClosed, err)
+	}
+	cln.mu.Unlock()
+
+	defer func() {
+		cln.mu.Lock()
+		delete(cln.pending, request.Id)
+		cln.mu.Unlock()
+	}()
+
+	select {
+	case response := <-responseChan:
+		if response.connErr != nil {
+			cln.logger.Debug("connection to CLN closed", slog.String("id", request.Id), slog.Any("error", response.connErr))
+			return response.connErr
+		}
+		if response.Error != nil {
+			cln.logger.Debug("error response from CLN", slog.String("id", request.Id), slog.Any("error", *response.Error))
+			return *response.Error
+		}
+		if cln.logger.Enabled(ctx, slog.LevelDebug) {
+			cln.logger.Debug("response from CLN", slog.String("id", request.Id), slog.String("result", redactCLNResult(response.Result)))
+		}
+		if err := json.Unmarshal(response.Result, dst); err != nil {
+			return fmt.Errorf("invalid response for '%v' from CLN: %v", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connect should be called while holding the lock.
+func (cln *CLNClient) connect() error {
+	conn, err := net.DialTimeout("unix", cln.socketPath, time.Second*10)
+	if err != nil {
+		return fmt.Errorf("could not connect to CLN socket '%v': %v", cln.socketPath, err)
+	}
+	cln.conn = conn
+	go cln.readLoop(conn)
+	return nil
+}
+
+// closeConn closes the current connection and fails all pending requests.
+// It should be called while holding the lock.
+func (cln *CLNClient) closeConn(reason error) {
+	if cln.conn == nil {
+		return
+	}
+	cln.conn.Close()
+	cln.conn = nil
+
+	for id, responseChan := range cln.pending {
+		responseChan <- clnRPCResponse{
+			Id:      id,
+			connErr: fmt.Errorf("%w: %v", ErrCLNConnectionClosed, reason),
+		}
+		delete(cln.pending, id)
+	}
+}
+
+func (cln *CLNClient) readLoop(conn net.Conn) {
+	decoder := json.NewDecoder(conn)
+	for {
+		var response clnRPCResponse
+		if err := decoder.Decode(&response); err != nil {
+			cln.mu.Lock()
+			if cln.conn == conn {
+				cln.closeConn(err)
+			}
+			cln.mu.Unlock()
+			return
+		}
+
+		cln.mu.Lock()
+		responseChan, ok := cln.pending[response.Id]
+		if ok {
+			delete(cln.pending, response.Id)
+		}
+		cln.mu.Unlock()
+
+		if ok {
+			responseChan <- response
+		}
+	}
+}
+
+// fields removed from CLN responses before logging them
+var clnRedactedFields = map[string]bool{
+	"payment_preimage": true,
+	"preimage":         true,
+	"rune":             true,
+}
+
+// redactCLNResult returns the result as a string with
+// the values of sensitive fields replaced.
+func redactCLNResult(result json.RawMessage) string {
+	var value any
+	if err := json.Unmarshal(result, &value); err != nil {
+		return "<invalid json>"
+	}
+	redacted, _ := json.Marshal(redactValue(value))
+	return string(redacted)
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, fieldValue := range v {
+			if clnRedactedFields[key] {
+				v[key] = "[redacted]"
+			} else {
+				v[key] = redactValue(fieldValue)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
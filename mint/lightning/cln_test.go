@@ -0,0 +1,521 @@
+package lightning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeCLNPreimage = "0000000000000000000000000000000000000000000000000000000000000001"
+
+type fakeCLN struct {
+	listener net.Listener
+	hash     string
+	bolt11   string
+	// params of the last invoice request
+	invoiceParams chan map[string]any
+}
+
+func newFakeCLN(t *testing.T, socketPath string) *fakeCLN {
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("error listening on socket: %v", err)
+	}
+	bolt11, _, hash, _ := CreateFakeInvoice(2100, false)
+	fake := &fakeCLN{listener: listener, hash: hash, bolt11: bolt11, invoiceParams: make(chan map[string]any, 1)}
+	go fake.serve()
+	return fake
+}
+
+func (fake *fakeCLN) serve() {
+	for {
+		conn, err := fake.listener.Accept()
+		if err != nil {
+			return
+		}
+		go fake.handleConn(conn)
+	}
+}
+
+func (fake *fakeCLN) handleConn(conn net.Conn) {
+	defer conn.Close()
+	decoder := json.NewDecoder(conn)
+	responses := make(chan any)
+	go func() {
+		encoder := json.NewEncoder(conn)
+		for response := range responses {
+			encoder.Encode(response)
+		}
+	}()
+	defer close(responses)
+
+	for {
+		var request clnRPCRequest
+		if err := decoder.Decode(&request); err != nil {
+			return
+		}
+
+		switch request.Method {
+		case "getinfo":
+			info := map[string]any{"id": "02abc", "alias": "fakecln", "num_active_channels": 2, "blockheight": 800000}
+			responses <- map[string]any{"id": request.Id, "result": info}
+		case "invoice":
+			params, _ := request.Params.(map[string]any)
+			fake.invoiceParams <- params
+			responses <- map[string]any{"id": request.Id, "result": map[string]any{"bolt11": fake.bolt11, "payment_hash": fake.hash}}
+		case "listinvoices":
+			invoice := clnInvoice{Label: "label", Bolt11: fake.bolt11, PaymentHash: fake.hash, AmountMsat: 2100000, Status: "unpaid"}
+			responses <- map[string]any{"id": request.Id, "result": map[string]any{"invoices": []clnInvoice{invoice}}}
+		case "waitinvoice":
+			// respond after other requests to check responses are matched by id
+			go func(id string) {
+				time.Sleep(time.Millisecond * 200)
+				invoice := clnInvoice{
+					Label:              "label",
+					Bolt11:             fake.bolt11,
+					PaymentHash:        fake.hash,
+					AmountMsat:         2100000,
+					Status:             "paid",
+					AmountReceivedMsat: 2100000,
+				}
+				responses <- map[string]any{"id": id, "result": invoice}
+			}(request.Id)
+		case "waitanyinvoice":
+			params, _ := request.Params.(map[string]any)
+			lastPayIndex, _ := params["lastpay_index"].(float64)
+			go func(id string) {
+				time.Sleep(time.Millisecond * 100)
+				invoice := clnInvoice{
+					Label:              "label",
+					Bolt11:             fake.bolt11,
+					PaymentHash:        fake.hash,
+					AmountMsat:         2100000,
+					Status:             "paid",
+					PayIndex:           uint64(lastPayIndex) + 1,
+					PaymentPreimage:    fakeCLNPreimage,
+					AmountReceivedMsat: 2100000,
+				}
+				responses <- map[string]any{"id": id, "result": invoice}
+			}(request.Id)
+		case "holdinvoice":
+			params, _ := request.Params.(map[string]any)
+			if params["payment_hash"] != fake.hash {
+				responses <- map[string]any{"id": request.Id, "error": map[string]any{"code": -32602, "message": "invalid payment hash"}}
+				continue
+			}
+			responses <- map[string]any{"id": request.Id, "result": map[string]string{"bolt11": fake.bolt11}}
+		case "settleholdinvoice", "cancelholdinvoice":
+			responses <- map[string]any{"id": request.Id, "result": map[string]any{}}
+		case "getroutes":
+			routes := []map[string]any{
+				{"amount_msat": 1500000, "path": []map[string]any{{"amount_msat": 1501500}, {"amount_msat": 1500000}}},
+				{"amount_msat": 600000, "path": []map[string]any{{"amount_msat": 600600}}},
+			}
+			responses <- map[string]any{"id": request.Id, "result": map[string]any{"routes": routes}}
+		case "listpeerchannels":
+			channels := []map[string]any{
+				{"state": "CHANNELD_NORMAL", "peer_connected": true, "spendable_msat": 400000, "receivable_msat": 600000,
+					"htlcs": []map[string]any{{"direction": "out"}}},
+				{"state": "CHANNELD_NORMAL", "peer_connected": true, "spendable_msat": 100000, "receivable_msat": 0},
+				{"state": "CHANNELD_AWAITING_LOCKIN", "peer_connected": true, "spendable_msat": 500000},
+			}
+			responses <- map[string]any{"id": request.Id, "result": map[string]any{"channels": channels}}
+		case "listsendpays":
+			params, _ := request.Params.(map[string]any)
+			payments := []map[string]any{}
+			if params["payment_hash"] == fake.hash {
+				// failed attempt and then the payment split in two parts
+				payments = []map[string]any{
+					{"payment_hash": fake.hash, "status": "failed", "amount_msat": 2100000, "amount_sent_msat": 2101000},
+					{"payment_hash": fake.hash, "status": "complete", "amount_msat": 1500000, "amount_sent_msat": 1501500,
+						"payment_preimage": fakeCLNPreimage},
+					{"payment_hash": fake.hash, "status": "complete", "amount_msat": 600000, "amount_sent_msat": 600600,
+						"payment_preimage": fakeCLNPreimage},
+				}
+			}
+			responses <- map[string]any{"id": request.Id, "result": map[string]any{"payments": payments}}
+		case "pay":
+			responses <- map[string]any{
+				"id":    request.Id,
+				"error": map[string]any{"code": CLNPaymentFailedErrCode, "message": "Ran out of routes to try"},
+			}
+		case "stop":
+			// simulate node restart by dropping the connection
+			return
+		}
+	}
+}
+
+func TestCLNClient(t *testing.T) {
+	// unix socket paths have a short max length so not using t.TempDir
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	client, err := SetupCLNClient(CLNConfig{SocketPath: socketPath})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	sub, err := client.SubscribeInvoice(context.Background(), fake.hash)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to invoice: %v", err)
+	}
+	subUpdate := make(chan Invoice)
+	go func() {
+		invoice, _ := sub.Recv()
+		subUpdate <- invoice
+	}()
+
+	// while waitinvoice is pending, other requests should still get responses
+	invoice, err := client.InvoiceStatus(context.Background(), fake.hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if invoice.Settled {
+		t.Fatal("expected unpaid invoice")
+	}
+
+	select {
+	case invoice := <-subUpdate:
+		if !invoice.Settled {
+			t.Fatal("expected paid invoice from subscription")
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("timed out waiting for invoice subscription")
+	}
+
+	payment, err := client.SendPayment(context.Background(), fake.bolt11, 10)
+	var rpcErr CLNRPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CLNPaymentFailedErrCode {
+		t.Fatalf("expected payment failed error but got '%v'", err)
+	}
+	if payment.PaymentStatus != Failed {
+		t.Fatalf("expected payment status '%v' but got '%v'", Failed, payment.PaymentStatus)
+	}
+
+	// connection gets dropped. Client should reconnect on next request
+	var stopped struct{}
+	err = client.call(context.Background(), "stop", struct{}{}, &stopped)
+	if !errors.Is(err, ErrCLNConnectionClosed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrCLNConnectionClosed, err)
+	}
+	if err := client.ConnectionStatus(context.Background()); err != nil {
+		t.Fatalf("expected client to reconnect but got error: %v", err)
+	}
+}
+
+func TestCLNSubscribeInvoices(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	client, err := SetupCLNClient(CLNConfig{SocketPath: socketPath})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	sub, err := client.SubscribeInvoices(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to invoices: %v", err)
+	}
+
+	// each Recv should wait for invoices paid after the previous one
+	for i := 1; i <= 2; i++ {
+		invoice, err := sub.Recv()
+		if err != nil {
+			t.Fatalf("unexpected error receiving invoice: %v", err)
+		}
+		if !invoice.Settled {
+			t.Fatal("expected paid invoice from subscription")
+		}
+		if lastPayIndex := sub.(*CLNInvoicesSub).lastPayIndex; lastPayIndex != uint64(i) {
+			t.Fatalf("expected last pay index of %v but got %v", i, lastPayIndex)
+		}
+	}
+}
+
+func TestCLNLogRedaction(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := SetupCLNClient(CLNConfig{SocketPath: socketPath, Logger: logger})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	sub, err := client.SubscribeInvoices(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to invoices: %v", err)
+	}
+	if _, err := sub.Recv(); err != nil {
+		t.Fatalf("unexpected error receiving invoice: %v", err)
+	}
+
+	if !strings.Contains(logs.String(), "waitanyinvoice") {
+		t.Fatalf("expected request to be logged but got logs: %v", logs.String())
+	}
+	if strings.Contains(logs.String(), fakeCLNPreimage) {
+		t.Fatal("expected preimage to be redacted from logs")
+	}
+
+	redacted := redactCLNResult(json.RawMessage(`{"pays":[{"status":"complete","preimage":"abcd","rune":"secret"}]}`))
+	expected := `{"pays":[{"preimage":"[redacted]","rune":"[redacted]","status":"complete"}]}`
+	if redacted != expected {
+		t.Fatalf("expected redacted result '%v' but got '%v'", expected, redacted)
+	}
+}
+
+func TestCLNHoldInvoice(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	client, err := SetupCLNClient(CLNConfig{SocketPath: socketPath})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	var holdClient HoldInvoiceClient = client
+	ctx := context.Background()
+	invoice, err := holdClient.CreateHoldInvoice(ctx, fake.hash, 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating hold invoice: %v", err)
+	}
+	if invoice.PaymentRequest != fake.bolt11 {
+		t.Fatalf("expected invoice '%v' but got '%v'", fake.bolt11, invoice.PaymentRequest)
+	}
+
+	if err := holdClient.SettleHoldInvoice(ctx, fakeCLNPreimage); err != nil {
+		t.Fatalf("unexpected error settling hold invoice: %v", err)
+	}
+	if err := holdClient.CancelHoldInvoice(ctx, fake.hash); err != nil {
+		t.Fatalf("unexpected error canceling hold invoice: %v", err)
+	}
+
+	var rpcErr CLNRPCError
+	_, err = holdClient.CreateHoldInvoice(ctx, "invalidhash", 2100)
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("expected CLN error but got '%v'", err)
+	}
+}
+
+func TestCLNEstimateFee(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	client, err := SetupCLNClient(CLNConfig{SocketPath: socketPath})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	// fee should add up the fees of all the routes
+	fee, err := client.EstimateFee(context.Background(), fake.bolt11)
+	if err != nil {
+		t.Fatalf("unexpected error estimating fee: %v", err)
+	}
+	if fee != 2100 {
+		t.Fatalf("expected fee of %v msat but got %v", 2100, fee)
+	}
+
+	if _, err := client.EstimateFee(context.Background(), "invalidinvoice"); err == nil {
+		t.Fatal("expected error for invalid invoice but got nil")
+	}
+}
+
+func TestCLNNodeInfo(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	client, err := SetupCLNClient(CLNConfig{SocketPath: socketPath})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	info, err := client.GetInfo(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error getting node info: %v", err)
+	}
+	expectedInfo := NodeInfo{Alias: "fakecln", Pubkey: "02abc", ActiveChannels: 2, BlockHeight: 800000}
+	if info != expectedInfo {
+		t.Fatalf("expected node info '%+v' but got '%+v'", expectedInfo, info)
+	}
+
+	// channels that are not open should not be counted
+	balances, err := client.ChannelBalances(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error getting channel balances: %v", err)
+	}
+	expectedBalances := ChannelBalances{OutboundMsat: 500000, InboundMsat: 600000, PendingHTLCs: 1}
+	if balances != expectedBalances {
+		t.Fatalf("expected balances '%+v' but got '%+v'", expectedBalances, balances)
+	}
+}
+
+func TestCLNOutgoingPaymentStatus(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	client, err := SetupCLNClient(CLNConfig{SocketPath: socketPath})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	payment, err := client.OutgoingPaymentStatus(context.Background(), fake.hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if payment.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, payment.PaymentStatus)
+	}
+	if payment.Preimage != fakeCLNPreimage {
+		t.Fatalf("expected preimage '%v' but got '%v'", fakeCLNPreimage, payment.Preimage)
+	}
+	if payment.FeeMsat != 2100 {
+		t.Fatalf("expected fee of %v msat but got %v", 2100, payment.FeeMsat)
+	}
+
+	// payment not found should not be marked as failed
+	payment, err = client.OutgoingPaymentStatus(context.Background(), "notfoundhash")
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if payment.PaymentStatus != Unknown {
+		t.Fatalf("expected payment status '%v' but got '%v'", Unknown, payment.PaymentStatus)
+	}
+}
+
+func TestCLNInvoiceLabel(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cln")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "lightning-rpc")
+
+	fake := newFakeCLN(t, socketPath)
+	defer fake.listener.Close()
+
+	client, err := SetupCLNClient(CLNConfig{
+		SocketPath:          socketPath,
+		InvoiceDescription:  "mint invoice",
+		DescriptionHashOnly: true,
+		LabelPrefix:         "testmint",
+	})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+
+	ctx := WithQuoteId(context.Background(), "quoteid123")
+	if _, err := client.CreateInvoice(ctx, 2100); err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	params := <-fake.invoiceParams
+	if params["label"] != "testmint-quoteid123" {
+		t.Fatalf("expected label '%v' but got '%v'", "testmint-quoteid123", params["label"])
+	}
+	if params["description"] != "mint invoice" {
+		t.Fatalf("expected description '%v' but got '%v'", "mint invoice", params["description"])
+	}
+	if params["deschashonly"] != true {
+		t.Fatalf("expected deschashonly to be set but got '%v'", params["deschashonly"])
+	}
+
+	// without a quote id labels should still be unique
+	if _, err := client.CreateInvoice(context.Background(), 2100); err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	params = <-fake.invoiceParams
+	label, _ := params["label"].(string)
+	if !strings.HasPrefix(label, "testmint-") || label == "testmint-" {
+		t.Fatalf("expected random label with prefix but got '%v'", label)
+	}
+}
+
+func TestCLNInvoiceSettled(t *testing.T) {
+	tests := []struct {
+		invoice  clnInvoice
+		expected bool
+	}{
+		{
+			invoice:  clnInvoice{Status: "unpaid", AmountMsat: 2100000},
+			expected: false,
+		},
+		// multi-part payment with all the parts received
+		{
+			invoice:  clnInvoice{Status: "paid", AmountMsat: 2100000, AmountReceivedMsat: 2100000},
+			expected: true,
+		},
+		{
+			invoice:  clnInvoice{Status: "paid", AmountMsat: 2100000, AmountReceivedMsat: 1500000},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		invoice := test.invoice.toInvoice()
+		if invoice.Settled != test.expected {
+			t.Fatalf("expected settled '%v' for invoice '%+v' but got '%v'", test.expected, test.invoice, invoice.Settled)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package lightning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const (
+	// consecutive errors after which a backend is considered unhealthy
+	DefaultMaxBackendFailures = 3
+	// how often to check again an unhealthy backend
+	DefaultHealthCheckInterval = time.Minute
+)
+
+// BackendHealth reports the health of a Lightning backend.
+type BackendHealth struct {
+	Name                string `json:"name"`
+	Healthy             bool   `json:"healthy"`
+	Active              bool   `json:"active"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	LastChecked         int64  `json:"last_checked,omitempty"`
+}
+
+// HealthReporter is implemented by clients that can
+// report the health of the backends they use.
+type HealthReporter interface {
+	BackendHealth(ctx context.Context) []BackendHealth
+}
+
+type FailoverBackend struct {
+	Name   string
+	Client Client
+}
+
+type FailoverConfig struct {
+	// backends in order of priority. The first one is the primary.
+	Backends            []FailoverBackend
+	MaxFailures         int
+	HealthCheckInterval time.Duration
+}
+
+// FailoverClient routes new invoices and payments to the first healthy
+// backend. A backend becomes unhealthy after failing MaxFailures times
+// in a row and is checked again with ConnectionStatus after HealthCheckInterval.
+// Lookups for invoices and payments go to the backend that created them.
+// Payments are never retried on a different backend since the
+// payment could still be in flight.
+//
+// The routes are only kept in memory. Callers that need to check a payment
+// after a restart should store the backend from SelectBackend and pass it
+// with WithBackend, both when sending the payment and when checking it.
+type FailoverClient struct {
+	backends            []*failoverBackend
+	maxFailures         int
+	healthCheckInterval time.Duration
+
+	mu sync.Mutex
+	// index of the backend that handled an invoice or payment, by payment hash
+	routes map[string]int
+}
+
+type failoverBackend struct {
+	name                string
+	client              Client
+	consecutiveFailures int
+	lastError           error
+	lastChecked         time.Time
+}
+
+func NewFailoverClient(config FailoverConfig) (*FailoverClient, error) {
+	if len(config.Backends) == 0 {
+		return nil, errors.New("no lightning backends specified")
+	}
+
+	backends := make([]*failoverBackend, len(config.Backends))
+	for i, backend := range config.Backends {
+		if backend.Client == nil {
+			return nil, fmt.Errorf("lightning backend '%v' cannot be nil", backend.Name)
+		}
+		backends[i] = &failoverBackend{name: backend.Name, client: backend.Client}
+	}
+
+	maxFailures := config.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = DefaultMaxBackendFailures
+	}
+	healthCheckInterval := config.HealthCheckInterval
+	if healthCheckInterval <= 0 {
+		healthCheckInterval = DefaultHealthCheckInterval
+	}
+
+	return &FailoverClient{
+		backends:            backends,
+		maxFailures:         maxFailures,
+		healthCheckInterval: healthCheckInterval,
+		routes:              make(map[string]int),
+	}, nil
+}
+
+func (f *FailoverClient) ConnectionStatus(ctx context.Context) error {
+	var errs []error
+	for i, backend := range f.backends {
+		err := backend.client.ConnectionStatus(ctx)
+		f.mu.Lock()
+		f.recordResult(i, err)
+		backend.lastChecked = time.Now()
+		f.mu.Unlock()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%v: %v", backend.name, err))
+	}
+	return fmt.Errorf("no lightning backend available: %w", errors.Join(errs...))
+}
+
+func (f *FailoverClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	// creating an invoice is safe to retry on the next backend
+	var err error
+	for _, i := range f.backendOrder(ctx) {
+		var invoice Invoice
+		invoice, err = f.backends[i].client.CreateInvoice(ctx, amount)
+		f.mu.Lock()
+		f.recordResult(i, err)
+		if err == nil {
+			f.routes[invoice.PaymentHash] = i
+		}
+		f.mu.Unlock()
+		if err == nil {
+			return invoice, nil
+		}
+	}
+	return Invoice{}, err
+}
+
+func (f *FailoverClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	var invoice Invoice
+	err := f.lookup(ctx, hash, func(client Client) error {
+		var err error
+		invoice, err = client.InvoiceStatus(ctx, hash)
+		return err
+	})
+	return invoice, err
+}
+
+func (f *FailoverClient) SelectBackend(ctx context.Context) string {
+	return f.backends[f.backendOrder(ctx)[0]].name
+}
+
+// Available reports if the backend that a new payment would go to is available
+func (f *FailoverClient) Available(ctx context.Context) bool {
+	i, err := f.paymentBackend(ctx)
+	if err != nil {
+		return false
+	}
+	checker, ok := f.backends[i].client.(AvailabilityChecker)
+	return !ok || checker.Available(ctx)
+}
+
+func (f *FailoverClient) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	i, err := f.paymentBackend(ctx)
+	if err != nil {
+		return PaymentStatus{}, err
+	}
+	paymentStatus, err := f.backends[i].client.SendPayment(ctx, request, maxFee)
+	f.recordPayment(i, request, err)
+	return paymentStatus, err
+}
+
+func (f *FailoverClient) PayPartialAmount(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	i, err := f.paymentBackend(ctx)
+	if err != nil {
+		return PaymentStatus{}, err
+	}
+	paymentStatus, err := f.backends[i].client.PayPartialAmount(ctx, request, amountMsat, maxFee)
+	f.recordPayment(i, request, err)
+	return paymentStatus, err
+}
+
+// OutgoingPaymentStatus checks the payment with the backend passed with WithBackend
+// or, if not set, the one that made the payment. If neither is known, each backend is
+// asked but only a Succeeded or Pending status is taken from them since backends report
+// Failed for payments they have never seen. Otherwise the status is Unknown.
+func (f *FailoverClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	i, ok, err := f.route(ctx, hash)
+	if err != nil {
+		return PaymentStatus{}, err
+	}
+	if ok {
+		return f.backends[i].client.OutgoingPaymentStatus(ctx, hash)
+	}
+
+	for _, i := range f.backendOrder(ctx) {
+		paymentStatus, err := f.backends[i].client.OutgoingPaymentStatus(ctx, hash)
+		if err != nil {
+			continue
+		}
+		if paymentStatus.PaymentStatus == Succeeded || paymentStatus.PaymentStatus == Pending {
+			f.mu.Lock()
+			f.routes[hash] = i
+			f.mu.Unlock()
+			return paymentStatus, nil
+		}
+	}
+	return PaymentStatus{PaymentStatus: Unknown}, nil
+}
+
+func (f *FailoverClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	return f.backends[f.backendOrder(ctx)[0]].client.FeeReserve(ctx, amountMsat)
+}
+
+func (f *FailoverClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
+	var sub InvoiceSubscriptionClient
+	err := f.lookup(ctx, paymentHash, func(client Client) error {
+		var err error
+		sub, err = client.SubscribeInvoice(ctx, paymentHash)
+		return err
+	})
+	return sub, err
+}
+
+func (f *FailoverClient) BackendHealth(ctx context.Context) []BackendHealth {
+	active := f.backendOrder(ctx)[0]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	health := make([]BackendHealth, len(f.backends))
+	for i, backend := range f.backends {
+		health[i] = BackendHealth{
+			Name:                backend.name,
+			Healthy:             f.isHealthy(backend),
+			Active:              i == active,
+			ConsecutiveFailures: backend.consecutiveFailures,
+		}
+		if backend.lastError != nil {
+			health[i].LastError = backend.lastError.Error()
+		}
+		if !backend.lastChecked.IsZero() {
+			health[i].LastChecked = backend.lastChecked.Unix()
+		}
+	}
+	return health
+}
+
+// backendOrder returns the indexes of the backends to try in order. Healthy
+// backends go first by priority followed by unhealthy ones. Unhealthy backends
+// are checked again if it has been longer than the health check interval.
+func (f *FailoverClient) backendOrder(ctx context.Context) []int {
+	var recheck []int
+	f.mu.Lock()
+	for i, backend := range f.backends {
+		if !f.isHealthy(backend) && time.Since(backend.lastChecked) >= f.healthCheckInterval {
+			// set it here so only one caller does the check
+			backend.lastChecked = time.Now()
+			recheck = append(recheck, i)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, i := range recheck {
+		err := f.backends[i].client.ConnectionStatus(ctx)
+		f.mu.Lock()
+		f.recordResult(i, err)
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	healthy := make([]int, 0, len(f.backends))
+	var unhealthy []int
+	for i, backend := range f.backends {
+		if f.isHealthy(backend) {
+			healthy = append(healthy, i)
+		} else {
+			unhealthy = append(unhealthy, i)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// paymentBackend returns the index of the backend passed with
+// WithBackend or the first one in order if not set.
+func (f *FailoverClient) paymentBackend(ctx context.Context) (int, error) {
+	if name, ok := BackendFromContext(ctx); ok {
+		return f.backendIndex(name)
+	}
+	return f.backendOrder(ctx)[0], nil
+}
+
+// route returns the index of the backend passed with WithBackend or
+// the one that handled the payment hash. ok is false if neither is known.
+func (f *FailoverClient) route(ctx context.Context, hash string) (int, bool, error) {
+	if name, ok := BackendFromContext(ctx); ok {
+		i, err := f.backendIndex(name)
+		return i, err == nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, ok := f.routes[hash]
+	return i, ok, nil
+}
+
+func (f *FailoverClient) backendIndex(name string) (int, error) {
+	for i, backend := range f.backends {
+		if backend.name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown lightning backend '%v'", name)
+}
+
+// lookup calls fn with the backend that handled the payment hash.
+// If not known (i.e after a restart), it tries each backend until one succeeds.
+func (f *FailoverClient) lookup(ctx context.Context, hash string, fn func(Client) error) error {
+	i, ok, err := f.route(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fn(f.backends[i].client)
+	}
+
+	var errs []error
+	for _, i := range f.backendOrder(ctx) {
+		err := fn(f.backends[i].client)
+		if err == nil {
+			f.mu.Lock()
+			f.routes[hash] = i
+			f.mu.Unlock()
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%v: %v", f.backends[i].name, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FailoverClient) recordPayment(i int, request string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.recordResult(i, err)
+	if bolt11, decodeErr := decodepay.Decodepay(request); decodeErr == nil {
+		f.routes[bolt11.PaymentHash] = i
+	}
+}
+
+// recordResult should be called while holding the lock.
+func (f *FailoverClient) recordResult(i int, err error) {
+	backend := f.backends[i]
+	if err != nil {
+		backend.consecutiveFailures++
+		backend.lastError = err
+		// wait for the health check interval before checking it again
+		if backend.consecutiveFailures == f.maxFailures {
+			backend.lastChecked = time.Now()
+		}
+	} else {
+		backend.consecutiveFailures = 0
+		backend.lastError = nil
+	}
+}
+
+func (f *FailoverClient) isHealthy(backend *failoverBackend) bool {
+	return backend.consecutiveFailures < f.maxFailures
+}
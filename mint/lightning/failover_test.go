@@ -0,0 +1,247 @@
+package lightning
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingBackend returns errors from the FakeBackend while down is set.
+type failingBackend struct {
+	*FakeBackend
+	down atomic.Bool
+}
+
+var errBackendDown = errors.New("backend down")
+
+func (b *failingBackend) ConnectionStatus(ctx context.Context) error {
+	if b.down.Load() {
+		return errBackendDown
+	}
+	return nil
+}
+
+func (b *failingBackend) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	if b.down.Load() {
+		return Invoice{}, errBackendDown
+	}
+	return b.FakeBackend.CreateInvoice(ctx, amount)
+}
+
+func (b *failingBackend) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	if b.down.Load() {
+		return PaymentStatus{PaymentStatus: Failed}, errBackendDown
+	}
+	return b.FakeBackend.SendPayment(ctx, request, maxFee)
+}
+
+func TestFailoverClient(t *testing.T) {
+	primary := &failingBackend{FakeBackend: &FakeBackend{}}
+	fallback := &failingBackend{FakeBackend: &FakeBackend{}}
+
+	client, err := NewFailoverClient(FailoverConfig{
+		Backends: []FailoverBackend{
+			{Name: "primary", Client: primary},
+			{Name: "fallback", Client: fallback},
+		},
+		MaxFailures:         2,
+		HealthCheckInterval: time.Millisecond * 100,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting up failover client: %v", err)
+	}
+
+	primaryInvoice, err := client.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if len(primary.Invoices) != 1 {
+		t.Fatalf("expected invoice to be created in primary backend")
+	}
+
+	// invoice creation should go to fallback if primary errors
+	primary.down.Store(true)
+	if _, err := client.CreateInvoice(context.Background(), 2100); err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if len(fallback.Invoices) != 1 {
+		t.Fatalf("expected invoice to be created in fallback backend")
+	}
+
+	// payment errors on primary should not be retried on fallback
+	request, _, _, err := CreateFakeInvoice(2100, false)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if _, err := client.SendPayment(context.Background(), request, 0); !errors.Is(err, errBackendDown) {
+		t.Fatalf("expected error '%v' but got '%v'", errBackendDown, err)
+	}
+
+	// after reaching max failures, primary should be unhealthy
+	// and new payments should go to fallback
+	health := client.BackendHealth(context.Background())
+	if health[0].Healthy || health[0].Active {
+		t.Fatalf("expected primary to be unhealthy and not active but got %+v", health[0])
+	}
+	if !health[1].Healthy || !health[1].Active {
+		t.Fatalf("expected fallback to be healthy and active but got %+v", health[1])
+	}
+
+	payment, err := client.SendPayment(context.Background(), request, 0)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if payment.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, payment.PaymentStatus)
+	}
+
+	// lookups should go to the backend that created the invoice
+	invoice, err := client.InvoiceStatus(context.Background(), primaryInvoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if invoice.PaymentHash != primaryInvoice.PaymentHash {
+		t.Fatalf("expected invoice with hash '%v' but got '%v'", primaryInvoice.PaymentHash, invoice.PaymentHash)
+	}
+
+	// primary should be used again once it passes the health check
+	primary.down.Store(false)
+	time.Sleep(time.Millisecond * 150)
+	if _, err := client.CreateInvoice(context.Background(), 2100); err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if len(primary.Invoices) != 2 {
+		t.Fatalf("expected invoice to be created in primary backend after recovering")
+	}
+	health = client.BackendHealth(context.Background())
+	if !health[0].Healthy || !health[0].Active {
+		t.Fatalf("expected primary to be healthy and active but got %+v", health[0])
+	}
+}
+
+func TestFailoverClientLookupUnknownHash(t *testing.T) {
+	primary := &FakeBackend{}
+	fallback := &FakeBackend{}
+	invoice, err := fallback.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+
+	client, err := NewFailoverClient(FailoverConfig{
+		Backends: []FailoverBackend{
+			{Name: "primary", Client: primary},
+			{Name: "fallback", Client: fallback},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting up failover client: %v", err)
+	}
+
+	// hash not created through the failover client should be found in any backend
+	invoiceStatus, err := client.InvoiceStatus(context.Background(), invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if !invoiceStatus.Settled {
+		t.Fatal("expected settled invoice")
+	}
+
+	if _, err := client.InvoiceStatus(context.Background(), "unknownhash"); err == nil {
+		t.Fatal("expected error for unknown invoice but got nil")
+	}
+}
+
+// forgetfulBackend reports payments it has never seen as failed like LNDHub and NWC do.
+type forgetfulBackend struct {
+	*FakeBackend
+}
+
+func (b *forgetfulBackend) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	paymentStatus, err := b.FakeBackend.OutgoingPaymentStatus(ctx, hash)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, nil
+	}
+	return paymentStatus, nil
+}
+
+func TestFailoverClientPaymentBackend(t *testing.T) {
+	primary := &forgetfulBackend{FakeBackend: &FakeBackend{}}
+	fallback := &forgetfulBackend{FakeBackend: &FakeBackend{}}
+
+	client, err := NewFailoverClient(FailoverConfig{
+		Backends: []FailoverBackend{
+			{Name: "primary", Client: primary},
+			{Name: "fallback", Client: fallback},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting up failover client: %v", err)
+	}
+	if backend := client.SelectBackend(context.Background()); backend != "primary" {
+		t.Fatalf("expected selected backend 'primary' but got '%v'", backend)
+	}
+
+	// payment should go to the backend passed even if it is not the first one
+	request, _, hash, err := CreateFakeInvoice(2100, false)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	ctx := WithBackend(context.Background(), "fallback")
+	if _, err := client.SendPayment(ctx, request, 0); err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if len(primary.Invoices) != 0 || len(fallback.Invoices) != 1 {
+		t.Fatal("expected payment to be sent by fallback backend")
+	}
+
+	// a new client does not know which backend made the payment (i.e after a restart)
+	client, err = NewFailoverClient(FailoverConfig{
+		Backends: []FailoverBackend{
+			{Name: "primary", Client: primary},
+			{Name: "fallback", Client: fallback},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting up failover client: %v", err)
+	}
+
+	// primary reports failed for the payment it has never seen
+	paymentStatus, err := client.OutgoingPaymentStatus(WithBackend(context.Background(), "primary"), hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if paymentStatus.PaymentStatus != Failed {
+		t.Fatalf("expected payment status '%v' but got '%v'", Failed, paymentStatus.PaymentStatus)
+	}
+
+	paymentStatus, err = client.OutgoingPaymentStatus(ctx, hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if paymentStatus.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, paymentStatus.PaymentStatus)
+	}
+
+	// without the backend, failed from primary should not be taken as the status
+	paymentStatus, err = client.OutgoingPaymentStatus(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if paymentStatus.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, paymentStatus.PaymentStatus)
+	}
+
+	paymentStatus, err = client.OutgoingPaymentStatus(context.Background(), "unknownhash")
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if paymentStatus.PaymentStatus != Unknown {
+		t.Fatalf("expected payment status '%v' but got '%v'", Unknown, paymentStatus.PaymentStatus)
+	}
+
+	if _, err := client.OutgoingPaymentStatus(WithBackend(context.Background(), "other"), hash); err == nil {
+		t.Fatal("expected error for unknown backend but got nil")
+	}
+}
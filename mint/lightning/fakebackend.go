@@ -7,7 +7,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	mathrand "math/rand/v2"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
@@ -31,6 +33,8 @@ type FakeBackendInvoice struct {
 	Status         State
 	Amount         uint64
 	Expiry         uint64
+	// unix time at which a pending invoice gets settled
+	SettleAt int64
 }
 
 func (i *FakeBackendInvoice) ToInvoice() Invoice {
@@ -44,14 +48,23 @@ func (i *FakeBackendInvoice) ToInvoice() Invoice {
 	}
 }
 
+// FakeBackend is an in-memory Lightning backend for testing
+// and running the mint locally without a node.
 type FakeBackend struct {
 	Invoices     []FakeBackendInvoice
 	PaymentDelay int64
+	// seconds after creation until an invoice gets settled.
+	// If 0, invoices are settled as soon as they are created.
+	SettleDelay int64
+	// probability (between 0 and 1) that an outgoing payment fails
+	FailureRate float64
+
+	mu sync.Mutex
 }
 
-func (fb *FakeBackend) ConnectionStatus() error { return nil }
+func (fb *FakeBackend) ConnectionStatus(ctx context.Context) error { return nil }
 
-func (fb *FakeBackend) CreateInvoice(amount uint64) (Invoice, error) {
+func (fb *FakeBackend) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
 	req, preimage, paymentHash, err := CreateFakeInvoice(amount, false)
 	if err != nil {
 		return Invoice{}, err
@@ -65,20 +78,61 @@ func (fb *FakeBackend) CreateInvoice(amount uint64) (Invoice, error) {
 		Amount:         amount,
 		Expiry:         InvoiceExpiry,
 	}
+	if fb.SettleDelay > 0 {
+		fakeInvoice.Status = Pending
+		fakeInvoice.SettleAt = time.Now().Unix() + fb.SettleDelay
+	}
+
+	fb.mu.Lock()
 	fb.Invoices = append(fb.Invoices, fakeInvoice)
+	fb.mu.Unlock()
 
 	return fakeInvoice.ToInvoice(), nil
 }
 
-func (fb *FakeBackend) InvoiceStatus(hash string) (Invoice, error) {
+func (fb *FakeBackend) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	invoice, err := fb.getInvoice(hash)
+	if err != nil {
+		return Invoice{}, errors.New("invoice does not exist")
+	}
+	return invoice.ToInvoice(), nil
+}
+
+// getInvoice returns the invoice for the hash
+// settling it if its settle time has passed.
+func (fb *FakeBackend) getInvoice(hash string) (FakeBackendInvoice, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
 	invoiceIdx := slices.IndexFunc(fb.Invoices, func(i FakeBackendInvoice) bool {
 		return i.PaymentHash == hash
 	})
 	if invoiceIdx == -1 {
-		return Invoice{}, errors.New("invoice does not exist")
+		return FakeBackendInvoice{}, errors.New("invoice does not exist")
+	}
+
+	invoice := &fb.Invoices[invoiceIdx]
+	if invoice.Status == Pending && invoice.SettleAt > 0 && time.Now().Unix() >= invoice.SettleAt {
+		invoice.Status = Succeeded
 	}
+	return *invoice, nil
+}
 
-	return fb.Invoices[invoiceIdx].ToInvoice(), nil
+// paymentStatus returns the status for an outgoing payment
+// applying the configured delay and failure rate.
+func (fb *FakeBackend) paymentStatus(invoice *decodepay.Bolt11) State {
+	if invoice.Description == FailPaymentDescription {
+		return Failed
+	}
+	if fb.FailureRate > 0 && mathrand.Float64() < fb.FailureRate {
+		return Failed
+	}
+	if fb.PaymentDelay > 0 {
+		if time.Now().Unix() < int64(invoice.CreatedAt)+fb.PaymentDelay {
+			return Pending
+		}
+	}
+	return Succeeded
 }
 
 func (fb *FakeBackend) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
@@ -87,22 +141,16 @@ func (fb *FakeBackend) SendPayment(ctx context.Context, request string, maxFee u
 		return PaymentStatus{}, fmt.Errorf("error decoding invoice: %v", err)
 	}
 
-	status := Succeeded
-	if invoice.Description == FailPaymentDescription {
-		status = Failed
-	} else if fb.PaymentDelay > 0 {
-		if time.Now().Unix() < int64(invoice.CreatedAt)+fb.PaymentDelay {
-			status = Pending
-		}
-	}
-
+	status := fb.paymentStatus(&invoice)
 	outgoingPayment := FakeBackendInvoice{
 		PaymentHash: invoice.PaymentHash,
 		Preimage:    FakePreimage,
 		Status:      status,
 		Amount:      uint64(invoice.MSatoshi) * 1000,
 	}
+	fb.mu.Lock()
 	fb.Invoices = append(fb.Invoices, outgoingPayment)
+	fb.mu.Unlock()
 
 	return PaymentStatus{
 		Preimage:      FakePreimage,
@@ -116,22 +164,16 @@ func (fb *FakeBackend) PayPartialAmount(ctx context.Context, request string, amo
 		return PaymentStatus{}, fmt.Errorf("error decoding invoice: %v", err)
 	}
 
-	status := Succeeded
-	if invoice.Description == FailPaymentDescription {
-		status = Failed
-	} else if fb.PaymentDelay > 0 {
-		if time.Now().Unix() < int64(invoice.CreatedAt)+fb.PaymentDelay {
-			status = Pending
-		}
-	}
-
+	status := fb.paymentStatus(&invoice)
 	outgoingPayment := FakeBackendInvoice{
 		PaymentHash: invoice.PaymentHash,
 		Preimage:    FakePreimage,
 		Status:      status,
 		Amount:      uint64(invoice.MSatoshi) * 1000,
 	}
+	fb.mu.Lock()
 	fb.Invoices = append(fb.Invoices, outgoingPayment)
+	fb.mu.Unlock()
 
 	return PaymentStatus{
 		Preimage:      FakePreimage,
@@ -139,48 +181,97 @@ func (fb *FakeBackend) PayPartialAmount(ctx context.Context, request string, amo
 	}, nil
 }
 
+func (fb *FakeBackend) SendKeysend(
+	ctx context.Context,
+	destination string,
+	amountMsat uint64,
+	preimage string,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	preimageBytes, err := hex.DecodeString(preimage)
+	if err != nil {
+		return PaymentStatus{}, errors.New("invalid preimage provided")
+	}
+	paymentHash := sha256.Sum256(preimageBytes)
+
+	status := Succeeded
+	if fb.FailureRate > 0 && mathrand.Float64() < fb.FailureRate {
+		status = Failed
+	}
+	outgoingPayment := FakeBackendInvoice{
+		PaymentHash: hex.EncodeToString(paymentHash[:]),
+		Preimage:    preimage,
+		Status:      status,
+		Amount:      amountMsat,
+	}
+	fb.mu.Lock()
+	fb.Invoices = append(fb.Invoices, outgoingPayment)
+	fb.mu.Unlock()
+
+	return PaymentStatus{
+		Preimage:      preimage,
+		PaymentStatus: status,
+	}, nil
+}
+
 func (fb *FakeBackend) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
-	invoiceIdx := slices.IndexFunc(fb.Invoices, func(i FakeBackendInvoice) bool {
-		return i.PaymentHash == hash
-	})
-	if invoiceIdx == -1 {
+	payment, err := fb.getInvoice(hash)
+	if err != nil {
 		return PaymentStatus{}, errors.New("payment does not exist")
 	}
 
 	return PaymentStatus{
 		Preimage:      FakePreimage,
-		PaymentStatus: fb.Invoices[invoiceIdx].Status,
+		PaymentStatus: payment.Status,
 	}, nil
 }
 
-func (fb *FakeBackend) FeeReserve(amount uint64) uint64 {
+func (fb *FakeBackend) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
 	return 0
 }
 
 func (fb *FakeBackend) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
 	return &FakeInvoiceSub{
+		ctx:         ctx,
 		paymentHash: paymentHash,
 		fb:          fb,
 	}, nil
 }
 
 type FakeInvoiceSub struct {
+	ctx         context.Context
 	paymentHash string
 	fb          *FakeBackend
 }
 
+// Recv returns the invoice. If the invoice is set to settle
+// after a delay, it blocks until then.
 func (fakeSub *FakeInvoiceSub) Recv() (Invoice, error) {
-	invoiceIdx := slices.IndexFunc(fakeSub.fb.Invoices, func(i FakeBackendInvoice) bool {
-		return i.PaymentHash == fakeSub.paymentHash
-	})
-	if invoiceIdx == -1 {
-		return Invoice{}, errors.New("invoice does not exist")
+	invoice, err := fakeSub.fb.getInvoice(fakeSub.paymentHash)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	if invoice.Status == Pending && invoice.SettleAt > 0 {
+		wait := time.Until(time.Unix(invoice.SettleAt, 0))
+		select {
+		case <-time.After(wait):
+		case <-fakeSub.ctx.Done():
+			return Invoice{}, fakeSub.ctx.Err()
+		}
+		invoice, err = fakeSub.fb.getInvoice(fakeSub.paymentHash)
+		if err != nil {
+			return Invoice{}, err
+		}
 	}
 
-	return fakeSub.fb.Invoices[invoiceIdx].ToInvoice(), nil
+	return invoice.ToInvoice(), nil
 }
 
 func (fb *FakeBackend) SetInvoiceStatus(hash string, status State) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
 	invoiceIdx := slices.IndexFunc(fb.Invoices, func(i FakeBackendInvoice) bool {
 		return i.PaymentHash == hash
 	})
@@ -0,0 +1,86 @@
+package lightning
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeBackendSettleDelay(t *testing.T) {
+	fb := &FakeBackend{SettleDelay: 1}
+
+	invoice, err := fb.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+
+	invoice, err = fb.InvoiceStatus(context.Background(), invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if invoice.Settled {
+		t.Fatal("expected invoice to not be settled before delay")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	sub, err := fb.SubscribeInvoice(ctx, invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to invoice: %v", err)
+	}
+	invoice, err = sub.Recv()
+	if err != nil {
+		t.Fatalf("unexpected error receiving invoice: %v", err)
+	}
+	if !invoice.Settled {
+		t.Fatal("expected invoice to be settled after delay")
+	}
+
+	invoice, err = fb.InvoiceStatus(context.Background(), invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if !invoice.Settled {
+		t.Fatal("expected invoice to be settled after delay")
+	}
+
+	// subscription should return when context is done
+	pending, err := fb.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	cancelledCtx, cancelSub := context.WithCancel(context.Background())
+	cancelSub()
+	sub, err = fb.SubscribeInvoice(cancelledCtx, pending.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to invoice: %v", err)
+	}
+	if _, err := sub.Recv(); err == nil {
+		t.Fatal("expected error from cancelled subscription but got nil")
+	}
+}
+
+func TestFakeBackendFailureRate(t *testing.T) {
+	fb := &FakeBackend{FailureRate: 1}
+	request, _, _, err := CreateFakeInvoice(2100, false)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+
+	payment, err := fb.SendPayment(context.Background(), request, 0)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if payment.PaymentStatus != Failed {
+		t.Fatalf("expected payment status '%v' but got '%v'", Failed, payment.PaymentStatus)
+	}
+
+	fb.FailureRate = 0
+	payment, err = fb.SendPayment(context.Background(), request, 0)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if payment.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, payment.PaymentStatus)
+	}
+}
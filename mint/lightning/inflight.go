@@ -0,0 +1,41 @@
+package lightning
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPaymentInFlight is returned when trying to send a payment
+// for a payment hash that is already being paid.
+var ErrPaymentInFlight = errors.New("payment already in flight")
+
+// InflightPayments keeps track of the payment hashes that are currently
+// being paid so that the same invoice is not sent concurrently twice.
+type InflightPayments struct {
+	mu     sync.Mutex
+	hashes map[string]struct{}
+}
+
+func NewInflightPayments() *InflightPayments {
+	return &InflightPayments{hashes: make(map[string]struct{})}
+}
+
+// Add registers the payment hash as in flight.
+// It returns ErrPaymentInFlight if it was already registered.
+func (p *InflightPayments) Add(hash string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.hashes[hash]; ok {
+		return ErrPaymentInFlight
+	}
+	p.hashes[hash] = struct{}{}
+	return nil
+}
+
+// Remove unregisters the payment hash once the payment attempt is done.
+func (p *InflightPayments) Remove(hash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.hashes, hash)
+}
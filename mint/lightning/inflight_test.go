@@ -0,0 +1,42 @@
+package lightning
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInflightPayments(t *testing.T) {
+	inflight := NewInflightPayments()
+	hash := "a3b2f1"
+
+	var added atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := inflight.Add(hash)
+			if err == nil {
+				added.Add(1)
+			} else if !errors.Is(err, ErrPaymentInFlight) {
+				t.Errorf("expected error '%v' but got '%v'", ErrPaymentInFlight, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if added.Load() != 1 {
+		t.Fatalf("expected only 1 payment to be added but got %v", added.Load())
+	}
+
+	if err := inflight.Add("c4d5e6"); err != nil {
+		t.Fatalf("unexpected error adding different payment: %v", err)
+	}
+
+	inflight.Remove(hash)
+	if err := inflight.Add(hash); err != nil {
+		t.Fatalf("unexpected error adding payment after removing it: %v", err)
+	}
+}
@@ -4,23 +4,72 @@ import "context"
 
 // Client interface to interact with a Lightning backend
 type Client interface {
-	ConnectionStatus() error
-	CreateInvoice(amount uint64) (Invoice, error)
-	InvoiceStatus(hash string) (Invoice, error)
+	ConnectionStatus(ctx context.Context) error
+	CreateInvoice(ctx context.Context, amount uint64) (Invoice, error)
+	InvoiceStatus(ctx context.Context, hash string) (Invoice, error)
 	SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error)
 	PayPartialAmount(ctx context.Context, request string, amountMsat uint64, maxFee uint64) (PaymentStatus, error)
 	OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error)
-	FeeReserve(amount uint64) uint64
+	// FeeReserve returns the fee reserve in msat needed to pay amountMsat
+	FeeReserve(ctx context.Context, amountMsat uint64) uint64
 	SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error)
 }
 
+type quoteIdKey struct{}
+
+// WithQuoteId returns a context with the id of the mint quote an invoice
+// is being created for. Backends can use it to label the invoice so that
+// it can be matched with the quote.
+func WithQuoteId(ctx context.Context, quoteId string) context.Context {
+	return context.WithValue(ctx, quoteIdKey{}, quoteId)
+}
+
+// QuoteIdFromContext returns the quote id set with WithQuoteId
+func QuoteIdFromContext(ctx context.Context) (string, bool) {
+	quoteId, ok := ctx.Value(quoteIdKey{}).(string)
+	return quoteId, ok && len(quoteId) > 0
+}
+
+type backendKey struct{}
+
+// WithBackend returns a context with the name of the backend that should handle
+// a payment. Clients that route payments across several backends use it to send
+// the payment with, and check its status on, that backend only.
+func WithBackend(ctx context.Context, backend string) context.Context {
+	return context.WithValue(ctx, backendKey{}, backend)
+}
+
+// BackendFromContext returns the backend set with WithBackend
+func BackendFromContext(ctx context.Context) (string, bool) {
+	backend, ok := ctx.Value(backendKey{}).(string)
+	return backend, ok && len(backend) > 0
+}
+
+// BackendSelector is implemented by clients that route payments across several
+// backends. The mint stores the backend selected for a melt quote before paying it
+// so that the status of the payment is only ever checked with that backend.
+type BackendSelector interface {
+	// SelectBackend returns the name of the backend a new payment should go to
+	SelectBackend(ctx context.Context) string
+}
+
+// AvailabilityChecker is implemented by clients that can tell ahead of a
+// request that it would fail with ErrBackendUnavailable without being sent.
+type AvailabilityChecker interface {
+	// Available returns false while the circuit breaker of the backend is open
+	Available(ctx context.Context) bool
+}
+
 type Invoice struct {
 	PaymentRequest string
 	PaymentHash    string
 	Preimage       string
 	Settled        bool
-	Amount         uint64
-	Expiry         uint64
+	// for hold invoices, set when the payment is
+	// held and waiting to be settled or canceled
+	Accepted bool
+	Amount   uint64
+	Expiry   uint64
 }
 
 type State int
@@ -29,12 +78,73 @@ const (
 	Succeeded State = iota
 	Failed
 	Pending
+	// the backend has no record of the payment yet. It could still
+	// be in flight so it should not be considered failed.
+	Unknown
 )
 
 type PaymentStatus struct {
 	Preimage             string
 	PaymentStatus        State
 	PaymentFailureReason string
+	// fee paid for the payment in msat if reported by the backend
+	FeeMsat uint64
+}
+
+// FeeEstimator is implemented by backends that can estimate the routing fee
+// for an invoice by probing routes to the destination. The mint uses the
+// estimate as the fee reserve and falls back to FeeReserve if it fails.
+type FeeEstimator interface {
+	// EstimateFee returns the estimated fee in msat to pay the invoice
+	EstimateFee(ctx context.Context, request string) (uint64, error)
+}
+
+// NodeInfoClient is implemented by backends that run their own node
+// and can report its info and the liquidity in its channels.
+type NodeInfoClient interface {
+	GetInfo(ctx context.Context) (NodeInfo, error)
+	ChannelBalances(ctx context.Context) (ChannelBalances, error)
+}
+
+type NodeInfo struct {
+	Alias          string `json:"alias"`
+	Pubkey         string `json:"pubkey"`
+	ActiveChannels uint32 `json:"active_channels"`
+	BlockHeight    uint32 `json:"block_height"`
+}
+
+// ChannelBalances has the liquidity across the active channels of the node
+type ChannelBalances struct {
+	// amount that can be sent (used to pay melts)
+	OutboundMsat uint64 `json:"outbound_msat"`
+	// amount that can be received (used to get paid for mint quotes)
+	InboundMsat  uint64 `json:"inbound_msat"`
+	PendingHTLCs uint32 `json:"pending_htlcs"`
+}
+
+// KeysendClient is implemented by backends that can make spontaneous
+// payments to a node without an invoice. The preimage is generated by
+// the caller and sent to the destination in the keysend custom record.
+type KeysendClient interface {
+	SendKeysend(ctx context.Context, destination string, amountMsat uint64, preimage string, maxFee uint64) (PaymentStatus, error)
+}
+
+// HoldInvoiceClient is implemented by backends that support hold invoices.
+// The backend accepts the payment for a hold invoice but does not settle it
+// until it is given the preimage, so the payment can still be canceled.
+type HoldInvoiceClient interface {
+	CreateHoldInvoice(ctx context.Context, paymentHash string, amount uint64) (Invoice, error)
+	SettleHoldInvoice(ctx context.Context, preimage string) error
+	CancelHoldInvoice(ctx context.Context, paymentHash string) error
+}
+
+// InvoicesSubscriber is implemented by backends that can stream updates
+// for all invoices over a single subscription. If the backend implements it,
+// the mint uses it instead of subscribing to each invoice.
+type InvoicesSubscriber interface {
+	// SubscribeInvoices returns a subscription whose Recv blocks
+	// until the next invoice gets settled
+	SubscribeInvoices(ctx context.Context) (InvoiceSubscriptionClient, error)
 }
 
 // InvoiceSubscriptionClient subscribes to get updates on the status of an invoice
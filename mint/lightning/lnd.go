@@ -2,6 +2,7 @@ package lightning
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/lightningnetwork/lnd/macaroons"
+	"github.com/lightningnetwork/lnd/record"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
@@ -20,18 +22,26 @@ const (
 	// 1 hour
 	InvoiceExpiryTime         = 3600
 	FeePercent        float64 = 0.01
+	// max seconds to wait for a probe when estimating fees
+	FeeProbeTimeout = 30
+	// max seconds to try finding a route for a keysend payment
+	KeysendTimeout = 60
 )
 
 type LndConfig struct {
 	GRPCHost string
 	Cert     credentials.TransportCredentials
 	Macaroon macaroons.MacaroonCredential
+	// include route hints for private channels in invoices so that
+	// payers can split large payments across them
+	RouteHints bool
 }
 
 type LndClient struct {
 	grpcClient     lnrpc.LightningClient
 	routerClient   routerrpc.RouterClient
 	invoicesClient invoicesrpc.InvoicesClient
+	routeHints     bool
 }
 
 func SetupLndClient(config LndConfig) (*LndClient, error) {
@@ -53,26 +63,29 @@ func SetupLndClient(config LndConfig) (*LndClient, error) {
 		grpcClient:     grpcClient,
 		routerClient:   routerClient,
 		invoicesClient: invoicesClient,
+		routeHints:     config.RouteHints,
 	}, nil
 }
 
-func (lnd *LndClient) ConnectionStatus() error {
+func (lnd *LndClient) ConnectionStatus(ctx context.Context) error {
 	// call to check connection is good
 	request := lnrpc.WalletBalanceRequest{}
-	_, err := lnd.grpcClient.WalletBalance(context.Background(), &request)
+	_, err := lnd.grpcClient.WalletBalance(ctx, &request)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (lnd *LndClient) CreateInvoice(amount uint64) (Invoice, error) {
+func (lnd *LndClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	// invoices from LND always allow the payer to use MPP
 	invoiceRequest := lnrpc.Invoice{
-		Value:  int64(amount),
-		Expiry: InvoiceExpiryTime,
+		Value:   int64(amount),
+		Expiry:  InvoiceExpiryTime,
+		Private: lnd.routeHints,
 	}
 
-	addInvoiceResponse, err := lnd.grpcClient.AddInvoice(context.Background(), &invoiceRequest)
+	addInvoiceResponse, err := lnd.grpcClient.AddInvoice(ctx, &invoiceRequest)
 	if err != nil {
 		return Invoice{}, err
 	}
@@ -87,24 +100,68 @@ func (lnd *LndClient) CreateInvoice(amount uint64) (Invoice, error) {
 	return invoice, nil
 }
 
-func (lnd *LndClient) InvoiceStatus(hash string) (Invoice, error) {
+func (lnd *LndClient) CreateHoldInvoice(ctx context.Context, paymentHash string, amount uint64) (Invoice, error) {
+	hash, err := hex.DecodeString(paymentHash)
+	if err != nil || len(hash) != 32 {
+		return Invoice{}, errors.New("invalid hash provided")
+	}
+
+	holdInvoiceRequest := invoicesrpc.AddHoldInvoiceRequest{
+		Hash:   hash,
+		Value:  int64(amount),
+		Expiry: InvoiceExpiryTime,
+	}
+	holdInvoiceResponse, err := lnd.invoicesClient.AddHoldInvoice(ctx, &holdInvoiceRequest)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	invoice := Invoice{
+		PaymentRequest: holdInvoiceResponse.PaymentRequest,
+		PaymentHash:    paymentHash,
+		Amount:         amount,
+		Expiry:         InvoiceExpiryTime,
+	}
+	return invoice, nil
+}
+
+func (lnd *LndClient) SettleHoldInvoice(ctx context.Context, preimage string) error {
+	preimageBytes, err := hex.DecodeString(preimage)
+	if err != nil || len(preimageBytes) != 32 {
+		return errors.New("invalid preimage provided")
+	}
+	_, err = lnd.invoicesClient.SettleInvoice(ctx, &invoicesrpc.SettleInvoiceMsg{Preimage: preimageBytes})
+	return err
+}
+
+func (lnd *LndClient) CancelHoldInvoice(ctx context.Context, paymentHash string) error {
+	hash, err := hex.DecodeString(paymentHash)
+	if err != nil || len(hash) != 32 {
+		return errors.New("invalid hash provided")
+	}
+	_, err = lnd.invoicesClient.CancelInvoice(ctx, &invoicesrpc.CancelInvoiceMsg{PaymentHash: hash})
+	return err
+}
+
+func (lnd *LndClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
 	hashBytes, err := hex.DecodeString(hash)
 	if err != nil {
 		return Invoice{}, errors.New("invalid hash provided")
 	}
 
 	paymentHashRequest := lnrpc.PaymentHash{RHash: hashBytes}
-	lookupInvoiceResponse, err := lnd.grpcClient.LookupInvoice(context.Background(), &paymentHashRequest)
+	lookupInvoiceResponse, err := lnd.grpcClient.LookupInvoice(ctx, &paymentHashRequest)
 	if err != nil {
 		return Invoice{}, err
 	}
 
-	invoiceSettled := lookupInvoiceResponse.State == lnrpc.Invoice_SETTLED
+	invoiceSettled := lndInvoiceSettled(lookupInvoiceResponse)
 	invoice := Invoice{
 		PaymentRequest: lookupInvoiceResponse.PaymentRequest,
 		PaymentHash:    hash,
 		Preimage:       hex.EncodeToString(lookupInvoiceResponse.RPreimage),
 		Settled:        invoiceSettled,
+		Accepted:       lookupInvoiceResponse.State == lnrpc.Invoice_ACCEPTED,
 		Amount:         uint64(lookupInvoiceResponse.Value),
 		Expiry:         uint64(lookupInvoiceResponse.Expiry),
 	}
@@ -201,6 +258,66 @@ func (lnd *LndClient) PayPartialAmount(
 	return PaymentStatus{PaymentStatus: Failed}, errors.New("payment failed")
 }
 
+func (lnd *LndClient) SendKeysend(
+	ctx context.Context,
+	destination string,
+	amountMsat uint64,
+	preimage string,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	destBytes, err := hex.DecodeString(destination)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, errors.New("invalid destination provided")
+	}
+	preimageBytes, err := hex.DecodeString(preimage)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, errors.New("invalid preimage provided")
+	}
+	paymentHash := sha256.Sum256(preimageBytes)
+
+	sendPaymentRequest := routerrpc.SendPaymentRequest{
+		Dest:        destBytes,
+		AmtMsat:     int64(amountMsat),
+		PaymentHash: paymentHash[:],
+		// the receiving node gets the preimage in this custom record
+		DestCustomRecords: map[uint64][]byte{record.KeySendType: preimageBytes},
+		FeeLimitSat:       int64(maxFee),
+		TimeoutSeconds:    KeysendTimeout,
+		NoInflightUpdates: true,
+	}
+
+	paymentStream, err := lnd.routerClient.SendPaymentV2(ctx, &sendPaymentRequest)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+			strings.Contains(err.Error(), "context deadline exceeded") {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	payment, err := paymentStream.Recv()
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+			strings.Contains(err.Error(), "context deadline exceeded") {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	switch payment.Status {
+	case lnrpc.Payment_SUCCEEDED:
+		return PaymentStatus{
+			PaymentStatus: Succeeded,
+			Preimage:      payment.PaymentPreimage,
+			FeeMsat:       uint64(payment.FeeMsat),
+		}, nil
+	case lnrpc.Payment_IN_FLIGHT, lnrpc.Payment_INITIATED:
+		return PaymentStatus{PaymentStatus: Pending}, nil
+	}
+	return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: payment.FailureReason.String()},
+		fmt.Errorf("payment error: %v", payment.FailureReason.String())
+}
+
 func (lnd *LndClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
 	hashBytes, err := hex.DecodeString(hash)
 	if err != nil {
@@ -244,11 +361,62 @@ func (lnd *LndClient) OutgoingPaymentStatus(ctx context.Context, hash string) (P
 	return PaymentStatus{PaymentStatus: Failed}, errors.New("unknown")
 }
 
-func (lnd *LndClient) FeeReserve(amount uint64) uint64 {
-	fee := math.Ceil(float64(amount) * FeePercent)
+func (lnd *LndClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * FeePercent)
 	return uint64(fee)
 }
 
+func (lnd *LndClient) EstimateFee(ctx context.Context, request string) (uint64, error) {
+	// LND sends a probe payment to the destination of the invoice
+	routeFeeRequest := routerrpc.RouteFeeRequest{
+		PaymentRequest: request,
+		Timeout:        FeeProbeTimeout,
+	}
+	routeFeeResponse, err := lnd.routerClient.EstimateRouteFee(ctx, &routeFeeRequest)
+	if err != nil {
+		return 0, err
+	}
+	if routeFeeResponse.FailureReason != lnrpc.PaymentFailureReason_FAILURE_REASON_NONE {
+		return 0, fmt.Errorf("could not estimate fee: %v", routeFeeResponse.FailureReason.String())
+	}
+	return uint64(routeFeeResponse.RoutingFeeMsat), nil
+}
+
+func (lnd *LndClient) GetInfo(ctx context.Context) (NodeInfo, error) {
+	info, err := lnd.grpcClient.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		return NodeInfo{}, err
+	}
+	return NodeInfo{
+		Alias:          info.Alias,
+		Pubkey:         info.IdentityPubkey,
+		ActiveChannels: info.NumActiveChannels,
+		BlockHeight:    info.BlockHeight,
+	}, nil
+}
+
+func (lnd *LndClient) ChannelBalances(ctx context.Context) (ChannelBalances, error) {
+	channels, err := lnd.grpcClient.ListChannels(ctx, &lnrpc.ListChannelsRequest{ActiveOnly: true})
+	if err != nil {
+		return ChannelBalances{}, err
+	}
+
+	var balances ChannelBalances
+	for _, channel := range channels.Channels {
+		// channel reserves can't be spent
+		local := channel.LocalBalance - int64(channel.LocalConstraints.GetChanReserveSat())
+		if local > 0 {
+			balances.OutboundMsat += uint64(local) * 1000
+		}
+		remote := channel.RemoteBalance - int64(channel.RemoteConstraints.GetChanReserveSat())
+		if remote > 0 {
+			balances.InboundMsat += uint64(remote) * 1000
+		}
+		balances.PendingHTLCs += uint32(len(channel.PendingHtlcs))
+	}
+	return balances, nil
+}
+
 func (lnd *LndClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
 	hash, err := hex.DecodeString(paymentHash)
 	if err != nil {
@@ -268,6 +436,42 @@ func (lnd *LndClient) SubscribeInvoice(ctx context.Context, paymentHash string)
 	return invoiceSub, nil
 }
 
+func (lnd *LndClient) SubscribeInvoices(ctx context.Context) (InvoiceSubscriptionClient, error) {
+	// without a settle index, only invoices settled from now on are sent
+	invoicesClient, err := lnd.grpcClient.SubscribeInvoices(ctx, &lnrpc.InvoiceSubscription{})
+	if err != nil {
+		return nil, err
+	}
+	return &LndInvoicesSub{invoicesClient: invoicesClient}, nil
+}
+
+// LndInvoicesSub streams updates for all invoices using the SubscribeInvoices RPC.
+type LndInvoicesSub struct {
+	invoicesClient lnrpc.Lightning_SubscribeInvoicesClient
+}
+
+func (lndSub *LndInvoicesSub) Recv() (Invoice, error) {
+	for {
+		invoiceRes, err := lndSub.invoicesClient.Recv()
+		if err != nil {
+			return Invoice{}, err
+		}
+		// LND also sends updates for new invoices. Only return settled ones
+		if !lndInvoiceSettled(invoiceRes) {
+			continue
+		}
+
+		invoice := Invoice{
+			PaymentRequest: invoiceRes.PaymentRequest,
+			PaymentHash:    hex.EncodeToString(invoiceRes.RHash),
+			Preimage:       hex.EncodeToString(invoiceRes.RPreimage),
+			Settled:        true,
+			Amount:         uint64(invoiceRes.Value),
+		}
+		return invoice, nil
+	}
+}
+
 type LndInvoiceSub struct {
 	paymentHash      string
 	invoiceSubClient invoicesrpc.Invoices_SubscribeSingleInvoiceClient
@@ -278,7 +482,7 @@ func (lndSub *LndInvoiceSub) Recv() (Invoice, error) {
 	if err != nil {
 		return Invoice{}, err
 	}
-	invoiceSettled := invoiceRes.State == lnrpc.Invoice_SETTLED
+	invoiceSettled := lndInvoiceSettled(invoiceRes)
 	invoice := Invoice{
 		PaymentRequest: invoiceRes.PaymentRequest,
 		PaymentHash:    lndSub.paymentHash,
@@ -288,3 +492,9 @@ func (lndSub *LndInvoiceSub) Recv() (Invoice, error) {
 	}
 	return invoice, nil
 }
+
+// lndInvoiceSettled returns whether the invoice is settled and the full amount
+// was received. With MPP, the amount paid is the sum of all the parts.
+func lndInvoiceSettled(invoice *lnrpc.Invoice) bool {
+	return invoice.State == lnrpc.Invoice_SETTLED && invoice.AmtPaidMsat >= invoice.ValueMsat
+}
@@ -0,0 +1,396 @@
+package lightning
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const (
+	// error code returned by LNDHub when the access token is invalid or expired
+	LNDHubBadAuthErrCode = 1
+
+	// how often to check an invoice when subscribed to it
+	LNDHubPollInterval = time.Second * 2
+)
+
+type LNDHubConfig struct {
+	// url of the LNDHub api. i.e https://lndhub.io
+	URL      string
+	Login    string
+	Password string
+	// retries and circuit breaker for requests to the api
+	Retry RetryConfig
+	// socks5 or http proxy for requests to the api. Optional
+	ProxyURL string
+}
+
+// LNDHubClient is a backend for hosted accounts on
+// LNDHub-compatible servers (BlueWallet, LNbits extension, Alby).
+type LNDHubClient struct {
+	url        string
+	login      string
+	password   string
+	httpClient *http.Client
+
+	mu           sync.RWMutex
+	accessToken  string
+	refreshToken string
+}
+
+func SetupLNDHubClient(config LNDHubConfig) (*LNDHubClient, error) {
+	hubURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LNDHub url: %v", err)
+	}
+	if hubURL.Scheme != "http" && hubURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid LNDHub url '%v'. Expected http or https scheme", config.URL)
+	}
+	if len(config.Login) == 0 || len(config.Password) == 0 {
+		return nil, errors.New("LNDHub login and password cannot be empty")
+	}
+	httpClient, err := newHTTPClient(time.Minute*2, config.Retry, config.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &LNDHubClient{
+		url:        strings.TrimSuffix(hubURL.String(), "/"),
+		login:      config.Login,
+		password:   config.Password,
+		httpClient: httpClient,
+	}
+	if err := client.authenticate(context.Background()); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+type lndhubError struct {
+	IsError bool   `json:"error"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e lndhubError) Error() string {
+	return fmt.Sprintf("LNDHub error %v: %v", e.Code, e.Message)
+}
+
+type lndhubTokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// lndhubBytes handles fields that some LNDHub implementations return as
+// hex strings and others as serialized node Buffers ({"type":"Buffer","data":[...]}).
+type lndhubBytes string
+
+func (b *lndhubBytes) UnmarshalJSON(data []byte) error {
+	var hexStr string
+	if err := json.Unmarshal(data, &hexStr); err == nil {
+		*b = lndhubBytes(hexStr)
+		return nil
+	}
+
+	var buffer struct {
+		Data []int `json:"data"`
+	}
+	if err := json.Unmarshal(data, &buffer); err != nil {
+		return err
+	}
+	raw := make([]byte, len(buffer.Data))
+	for i, v := range buffer.Data {
+		raw[i] = byte(v)
+	}
+	*b = lndhubBytes(hex.EncodeToString(raw))
+	return nil
+}
+
+type lndhubInvoice struct {
+	PaymentRequest string `json:"payment_request"`
+	PayReq         string `json:"pay_req"`
+}
+
+type lndhubPayment struct {
+	PaymentError    string      `json:"payment_error"`
+	PaymentPreimage lndhubBytes `json:"payment_preimage"`
+	PaymentRoute    struct {
+		TotalFees     uint64 `json:"total_fees"`
+		TotalFeesMsat uint64 `json:"total_fees_msat"`
+	} `json:"payment_route"`
+}
+
+type lndhubTransaction struct {
+	Type            string      `json:"type"`
+	PaymentHash     lndhubBytes `json:"payment_hash"`
+	PaymentPreimage lndhubBytes `json:"payment_preimage"`
+	// fee paid in sats
+	Fee uint64 `json:"fee"`
+}
+
+func (hub *LNDHubClient) ConnectionStatus(ctx context.Context) error {
+	var balance json.RawMessage
+	return hub.request(ctx, http.MethodGet, "/balance", nil, &balance)
+}
+
+func (hub *LNDHubClient) Available(ctx context.Context) bool {
+	return available(hub.httpClient)
+}
+
+func (hub *LNDHubClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	params := map[string]string{
+		"amt":  strconv.FormatUint(amount, 10),
+		"memo": "",
+	}
+	var lndhubInvoice lndhubInvoice
+	if err := hub.request(ctx, http.MethodPost, "/addinvoice", params, &lndhubInvoice); err != nil {
+		return Invoice{}, err
+	}
+
+	paymentRequest := lndhubInvoice.PaymentRequest
+	if len(paymentRequest) == 0 {
+		paymentRequest = lndhubInvoice.PayReq
+	}
+	bolt11, err := decodepay.Decodepay(paymentRequest)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("invalid invoice from LNDHub: %v", err)
+	}
+
+	return Invoice{
+		PaymentRequest: paymentRequest,
+		PaymentHash:    bolt11.PaymentHash,
+		Amount:         amount,
+		Expiry:         uint64(bolt11.Expiry),
+	}, nil
+}
+
+func (hub *LNDHubClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	return hub.invoiceStatus(ctx, hash)
+}
+
+func (hub *LNDHubClient) invoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	var status struct {
+		Paid bool `json:"paid"`
+	}
+	if err := hub.request(ctx, http.MethodGet, "/checkpayment/"+url.PathEscape(hash), nil, &status); err != nil {
+		return Invoice{}, err
+	}
+
+	return Invoice{
+		PaymentHash: hash,
+		Settled:     status.Paid,
+	}, nil
+}
+
+func (hub *LNDHubClient) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	var payment lndhubPayment
+	params := map[string]string{"invoice": request}
+	if err := hub.request(ctx, http.MethodPost, "/payinvoice", params, &payment); err != nil {
+		// if context deadline is exceeded, mark payment as pending
+		// if any other error, mark as failed
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	if len(payment.PaymentError) > 0 {
+		return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: payment.PaymentError},
+			fmt.Errorf("payment error: %v", payment.PaymentError)
+	}
+
+	feeMsat := payment.PaymentRoute.TotalFeesMsat
+	if feeMsat == 0 {
+		feeMsat = payment.PaymentRoute.TotalFees * 1000
+	}
+	return PaymentStatus{
+		Preimage:      string(payment.PaymentPreimage),
+		PaymentStatus: Succeeded,
+		FeeMsat:       feeMsat,
+	}, nil
+}
+
+func (hub *LNDHubClient) PayPartialAmount(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	return PaymentStatus{PaymentStatus: Failed}, errors.New("LNDHub does not support paying partial amounts")
+}
+
+// OutgoingPaymentStatus looks for the payment in the account's transactions.
+// LNDHub pays invoices synchronously so a payment that
+// is not in the list has not been made.
+func (hub *LNDHubClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	var transactions []lndhubTransaction
+	if err := hub.request(ctx, http.MethodGet, "/gettxs", nil, &transactions); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	for _, tx := range transactions {
+		if string(tx.PaymentHash) == hash {
+			return PaymentStatus{
+				Preimage:      string(tx.PaymentPreimage),
+				PaymentStatus: Succeeded,
+				FeeMsat:       tx.Fee * 1000,
+			}, nil
+		}
+	}
+	return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: "payment not found"}, nil
+}
+
+func (hub *LNDHubClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * FeePercent)
+	return uint64(fee)
+}
+
+func (hub *LNDHubClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
+	return &LNDHubInvoiceSub{
+		ctx:         ctx,
+		paymentHash: paymentHash,
+		client:      hub,
+	}, nil
+}
+
+// LNDHubInvoiceSub polls the status of the invoice until it gets paid.
+type LNDHubInvoiceSub struct {
+	ctx         context.Context
+	paymentHash string
+	client      *LNDHubClient
+}
+
+func (sub *LNDHubInvoiceSub) Recv() (Invoice, error) {
+	ticker := time.NewTicker(LNDHubPollInterval)
+	defer ticker.Stop()
+
+	for {
+		invoice, err := sub.client.invoiceStatus(sub.ctx, sub.paymentHash)
+		if err != nil {
+			return Invoice{}, err
+		}
+		if invoice.Settled {
+			return invoice, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-sub.ctx.Done():
+			return Invoice{}, sub.ctx.Err()
+		}
+	}
+}
+
+// authenticate gets new tokens using the refresh token if there is one,
+// otherwise it logs in with the account credentials.
+func (hub *LNDHubClient) authenticate(ctx context.Context) error {
+	hub.mu.RLock()
+	refreshToken := hub.refreshToken
+	hub.mu.RUnlock()
+
+	var tokens lndhubTokens
+	var err error
+	if len(refreshToken) > 0 {
+		params := map[string]string{"refresh_token": refreshToken}
+		err = hub.do(ctx, http.MethodPost, "/auth?type=refresh_token", params, "", &tokens)
+	}
+	if len(refreshToken) == 0 || err != nil || len(tokens.AccessToken) == 0 {
+		params := map[string]string{"login": hub.login, "password": hub.password}
+		if err := hub.do(ctx, http.MethodPost, "/auth?type=auth", params, "", &tokens); err != nil {
+			return fmt.Errorf("could not authenticate with LNDHub: %v", err)
+		}
+	}
+	if len(tokens.AccessToken) == 0 {
+		return errors.New("could not authenticate with LNDHub: no access token in response")
+	}
+
+	hub.mu.Lock()
+	hub.accessToken = tokens.AccessToken
+	hub.refreshToken = tokens.RefreshToken
+	hub.mu.Unlock()
+	return nil
+}
+
+// request makes an authenticated request. If the access token expired,
+// it re-authenticates and retries the request once.
+func (hub *LNDHubClient) request(ctx context.Context, method, path string, body any, dst any) error {
+	hub.mu.RLock()
+	accessToken := hub.accessToken
+	hub.mu.RUnlock()
+
+	err := hub.do(ctx, method, path, body, accessToken, dst)
+	var hubErr lndhubError
+	if errors.As(err, &hubErr) && hubErr.Code == LNDHubBadAuthErrCode {
+		if err := hub.authenticate(ctx); err != nil {
+			return err
+		}
+		hub.mu.RLock()
+		accessToken = hub.accessToken
+		hub.mu.RUnlock()
+		return hub.do(ctx, method, path, body, accessToken, dst)
+	}
+	return err
+}
+
+func (hub *LNDHubClient) do(ctx context.Context, method, path string, body any, accessToken string, dst any) error {
+	var reqBody io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, hub.url+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(accessToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := hub.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// LNDHub returns errors with a 200 status code
+	var hubErr lndhubError
+	if err := json.Unmarshal(respBody, &hubErr); err == nil && hubErr.IsError {
+		return hubErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("LNDHub error (%v): %s", resp.StatusCode, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, dst); err != nil {
+		return fmt.Errorf("error reading response from LNDHub: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package lightning
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLNDHubClient(t *testing.T) {
+	invoice, preimage, hash, _ := CreateFakeInvoice(2100, false)
+	preimageBytes, _ := hex.DecodeString(preimage)
+
+	logins := 0
+	accessToken := "token1"
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth", func(rw http.ResponseWriter, req *http.Request) {
+		var creds map[string]string
+		json.NewDecoder(req.Body).Decode(&creds)
+		if req.URL.Query().Get("type") == "auth" {
+			if creds["login"] != "login" || creds["password"] != "password" {
+				rw.Write([]byte(`{"error":true,"code":1,"message":"bad auth"}`))
+				return
+			}
+			logins++
+		}
+		json.NewEncoder(rw).Encode(lndhubTokens{AccessToken: accessToken, RefreshToken: "refresh"})
+	})
+
+	authed := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") != "Bearer "+accessToken {
+				rw.Write([]byte(`{"error":true,"code":1,"message":"bad auth"}`))
+				return
+			}
+			handler(rw, req)
+		}
+	}
+	mux.HandleFunc("POST /addinvoice", authed(func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]any{"payment_request": invoice, "r_hash": hash})
+	}))
+	mux.HandleFunc("GET /checkpayment/{hash}", authed(func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]bool{"paid": req.PathValue("hash") == hash})
+	}))
+	mux.HandleFunc("POST /payinvoice", authed(func(rw http.ResponseWriter, req *http.Request) {
+		// BlueWallet's LNDHub returns the preimage as a serialized Buffer
+		data := make([]int, len(preimageBytes))
+		for i, b := range preimageBytes {
+			data[i] = int(b)
+		}
+		json.NewEncoder(rw).Encode(map[string]any{
+			"payment_error":    "",
+			"payment_preimage": map[string]any{"type": "Buffer", "data": data},
+			"payment_route":    map[string]any{"total_fees": 3},
+		})
+	}))
+	mux.HandleFunc("GET /gettxs", authed(func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode([]map[string]any{
+			{"type": "paid_invoice", "payment_hash": hash, "payment_preimage": preimage, "fee": 3},
+		})
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if _, err := SetupLNDHubClient(LNDHubConfig{URL: server.URL, Login: "login", Password: "wrong"}); err == nil {
+		t.Fatal("expected error with wrong credentials")
+	}
+
+	client, err := SetupLNDHubClient(LNDHubConfig{URL: server.URL, Login: "login", Password: "password"})
+	if err != nil {
+		t.Fatalf("error setting up LNDHub client: %v", err)
+	}
+
+	createdInvoice, err := client.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if createdInvoice.PaymentHash != hash {
+		t.Fatalf("expected payment hash '%v' but got '%v'", hash, createdInvoice.PaymentHash)
+	}
+
+	// expire access token. Client should refresh it and retry
+	accessToken = "token2"
+	status, err := client.InvoiceStatus(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if !status.Settled {
+		t.Fatal("expected settled invoice")
+	}
+	if logins != 1 {
+		t.Fatalf("expected token to be refreshed without logging in again but got %v logins", logins)
+	}
+
+	payment, err := client.SendPayment(context.Background(), invoice, 10)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if payment.PaymentStatus != Succeeded || payment.Preimage != preimage {
+		t.Fatalf("expected succeeded payment with preimage '%v' but got '%+v'", preimage, payment)
+	}
+	if payment.FeeMsat != 3000 {
+		t.Fatalf("expected fee of %v msat but got %v", 3000, payment.FeeMsat)
+	}
+
+	outgoing, err := client.OutgoingPaymentStatus(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if outgoing.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, outgoing.PaymentStatus)
+	}
+
+	outgoing, _ = client.OutgoingPaymentStatus(context.Background(), "unknownhash")
+	if outgoing.PaymentStatus != Failed {
+		t.Fatalf("expected payment status '%v' but got '%v'", Failed, outgoing.PaymentStatus)
+	}
+}
@@ -0,0 +1,512 @@
+package lightning
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/internal/nip01"
+	"github.com/gorilla/websocket"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const (
+	NWCRequestKind  = 23194
+	NWCResponseKind = 23195
+
+	// timeout for requests that are not made with a context
+	NWCRequestTimeout = time.Second * 30
+	// how often to lookup an invoice when subscribed to it
+	NWCPollInterval = time.Second * 2
+)
+
+var ErrNWCNotConnected = errors.New("not connected to NWC relay")
+
+type NWCConfig struct {
+	// nostr+walletconnect://<wallet pubkey>?relay=<relay url>&secret=<secret>
+	ConnectionURI string
+}
+
+// NWCClient is a backend that uses a wallet service
+// through Nostr Wallet Connect (NIP-47).
+type NWCClient struct {
+	walletPubkey *secp256k1.PublicKey
+	walletPubHex string
+	relayURL     string
+	secret       *secp256k1.PrivateKey
+	pubkey       string
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	pending map[string]chan nwcResponse
+}
+
+func SetupNWCClient(config NWCConfig) (*NWCClient, error) {
+	uri, err := url.Parse(config.ConnectionURI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NWC connection uri: %v", err)
+	}
+	if uri.Scheme != "nostr+walletconnect" && uri.Scheme != "nostrwalletconnect" {
+		return nil, errors.New("invalid NWC connection uri. Expected nostr+walletconnect scheme")
+	}
+
+	walletPubHex := uri.Host
+	if len(walletPubHex) == 0 {
+		walletPubHex = strings.TrimPrefix(uri.Opaque, "//")
+	}
+	walletPubBytes, err := hex.DecodeString(walletPubHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wallet pubkey: %v", err)
+	}
+	walletPubkey, err := schnorr.ParsePubKey(walletPubBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wallet pubkey: %v", err)
+	}
+
+	query := uri.Query()
+	relayURL := query.Get("relay")
+	if len(relayURL) == 0 {
+		return nil, errors.New("NWC connection uri does not have a relay")
+	}
+	secretBytes, err := hex.DecodeString(query.Get("secret"))
+	if err != nil || len(secretBytes) != 32 {
+		return nil, errors.New("invalid secret in NWC connection uri")
+	}
+	secret := secp256k1.PrivKeyFromBytes(secretBytes)
+
+	client := &NWCClient{
+		walletPubkey: walletPubkey,
+		walletPubHex: walletPubHex,
+		relayURL:     relayURL,
+		secret:       secret,
+		pubkey:       hex.EncodeToString(schnorr.SerializePubKey(secret.PubKey())),
+		pending:      make(map[string]chan nwcResponse),
+	}
+	if err := client.connect(); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+type nwcRequest struct {
+	Method string `json:"method"`
+	Params any    `json:"params"`
+}
+
+type nwcResponse struct {
+	ResultType string          `json:"result_type"`
+	Error      *nwcError       `json:"error"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type nwcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e nwcError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Code, e.Message)
+}
+
+type nwcTransaction struct {
+	Type        string `json:"type"`
+	Invoice     string `json:"invoice"`
+	PaymentHash string `json:"payment_hash"`
+	Preimage    string `json:"preimage"`
+	// amount in msat
+	Amount    uint64 `json:"amount"`
+	FeesPaid  uint64 `json:"fees_paid"`
+	ExpiresAt int64  `json:"expires_at"`
+	SettledAt int64  `json:"settled_at"`
+	State     string `json:"state"`
+}
+
+type nwcPayResult struct {
+	Preimage string `json:"preimage"`
+	// fees paid in msat
+	FeesPaid uint64 `json:"fees_paid"`
+}
+
+func (nwc *NWCClient) ConnectionStatus(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, NWCRequestTimeout)
+	defer cancel()
+
+	var info json.RawMessage
+	return nwc.request(ctx, "get_info", struct{}{}, &info)
+}
+
+func (nwc *NWCClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, NWCRequestTimeout)
+	defer cancel()
+
+	params := map[string]any{
+		"amount": amount * 1000,
+		"expiry": InvoiceExpiryTime,
+	}
+	var transaction nwcTransaction
+	if err := nwc.request(ctx, "make_invoice", params, &transaction); err != nil {
+		return Invoice{}, err
+	}
+
+	invoice := Invoice{
+		PaymentRequest: transaction.Invoice,
+		PaymentHash:    transaction.PaymentHash,
+		Amount:         amount,
+		Expiry:         InvoiceExpiryTime,
+	}
+	return invoice, nil
+}
+
+func (nwc *NWCClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, NWCRequestTimeout)
+	defer cancel()
+	return nwc.lookupInvoice(ctx, hash)
+}
+
+func (nwc *NWCClient) lookupInvoice(ctx context.Context, hash string) (Invoice, error) {
+	var transaction nwcTransaction
+	params := map[string]string{"payment_hash": hash}
+	if err := nwc.request(ctx, "lookup_invoice", params, &transaction); err != nil {
+		return Invoice{}, err
+	}
+
+	invoice := Invoice{
+		PaymentRequest: transaction.Invoice,
+		PaymentHash:    hash,
+		Preimage:       transaction.Preimage,
+		Settled:        transaction.SettledAt > 0 || transaction.State == "settled",
+		Amount:         transaction.Amount / 1000,
+	}
+	if bolt11, err := decodepay.Decodepay(transaction.Invoice); err == nil {
+		invoice.Expiry = uint64(bolt11.Expiry)
+	}
+	return invoice, nil
+}
+
+func (nwc *NWCClient) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	var result nwcPayResult
+	err := nwc.request(ctx, "pay_invoice", map[string]string{"invoice": request}, &result)
+	if err != nil {
+		// only mark as failed if the wallet service responded with an error
+		// or the request could not be sent. Otherwise the payment might
+		// still be in flight so mark as pending
+		var nwcErr nwcError
+		if errors.As(err, &nwcErr) || errors.Is(err, ErrNWCNotConnected) {
+			return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: nwcErr.Message}, err
+		}
+		return PaymentStatus{PaymentStatus: Pending}, nil
+	}
+
+	return PaymentStatus{
+		Preimage:      result.Preimage,
+		PaymentStatus: Succeeded,
+		FeeMsat:       result.FeesPaid,
+	}, nil
+}
+
+func (nwc *NWCClient) PayPartialAmount(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	return PaymentStatus{PaymentStatus: Failed}, errors.New("NWC does not support paying partial amounts")
+}
+
+func (nwc *NWCClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	var transaction nwcTransaction
+	params := map[string]string{"payment_hash": hash}
+	if err := nwc.request(ctx, "lookup_invoice", params, &transaction); err != nil {
+		var nwcErr nwcError
+		if errors.As(err, &nwcErr) && nwcErr.Code == "NOT_FOUND" {
+			return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: nwcErr.Message}, nil
+		}
+		return PaymentStatus{PaymentStatus: Pending}, nil
+	}
+
+	switch {
+	case transaction.SettledAt > 0 || transaction.State == "settled":
+		return PaymentStatus{
+			Preimage:      transaction.Preimage,
+			PaymentStatus: Succeeded,
+			FeeMsat:       transaction.FeesPaid,
+		}, nil
+	case transaction.State == "failed" || transaction.State == "expired":
+		return PaymentStatus{PaymentStatus: Failed}, nil
+	}
+	return PaymentStatus{PaymentStatus: Pending}, nil
+}
+
+func (nwc *NWCClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * FeePercent)
+	return uint64(fee)
+}
+
+func (nwc *NWCClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
+	return &NWCInvoiceSub{
+		ctx:         ctx,
+		paymentHash: paymentHash,
+		client:      nwc,
+	}, nil
+}
+
+// NWCInvoiceSub looks up the invoice from the
+// wallet service until it gets settled.
+type NWCInvoiceSub struct {
+	ctx         context.Context
+	paymentHash string
+	client      *NWCClient
+}
+
+func (sub *NWCInvoiceSub) Recv() (Invoice, error) {
+	ticker := time.NewTicker(NWCPollInterval)
+	defer ticker.Stop()
+
+	for {
+		invoice, err := sub.client.lookupInvoice(sub.ctx, sub.paymentHash)
+		if err != nil && sub.ctx.Err() != nil {
+			return Invoice{}, sub.ctx.Err()
+		}
+		// errors from the relay connection are retried on the next tick
+		if err == nil && invoice.Settled {
+			return invoice, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-sub.ctx.Done():
+			return Invoice{}, sub.ctx.Err()
+		}
+	}
+}
+
+// request sends an encrypted request to the wallet service
+// and waits for the response or until ctx is done.
+func (nwc *NWCClient) request(ctx context.Context, method string, params any, dst any) error {
+	content, err := json.Marshal(nwcRequest{Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	encrypted, err := nip04Encrypt(nwc.secret, nwc.walletPubkey, content)
+	if err != nil {
+		return err
+	}
+	event := nip01.Event{
+		CreatedAt: time.Now().Unix(),
+		Kind:      NWCRequestKind,
+		Tags:      [][]string{{"p", nwc.walletPubHex}},
+		Content:   encrypted,
+	}
+	if err := event.Sign(nwc.secret); err != nil {
+		return err
+	}
+
+	responseChan := make(chan nwcResponse, 1)
+	nwc.mu.Lock()
+	nwc.pending[event.Id] = responseChan
+	nwc.mu.Unlock()
+	defer func() {
+		nwc.mu.Lock()
+		delete(nwc.pending, event.Id)
+		nwc.mu.Unlock()
+	}()
+
+	if err := nwc.send([]any{"EVENT", event}); err != nil {
+		return err
+	}
+
+	select {
+	case response := <-responseChan:
+		if response.Error != nil {
+			return *response.Error
+		}
+		if err := json.Unmarshal(response.Result, dst); err != nil {
+			return fmt.Errorf("invalid %v response from wallet service: %v", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send writes the message to the relay.
+// It will reconnect first if the connection was lost.
+func (nwc *NWCClient) send(msg []any) error {
+	nwc.mu.Lock()
+	conn := nwc.conn
+	nwc.mu.Unlock()
+
+	if conn == nil {
+		if err := nwc.connect(); err != nil {
+			return fmt.Errorf("%w: %v", ErrNWCNotConnected, err)
+		}
+	}
+
+	nwc.mu.Lock()
+	defer nwc.mu.Unlock()
+	if nwc.conn == nil {
+		return ErrNWCNotConnected
+	}
+	if err := nwc.conn.WriteJSON(msg); err != nil {
+		nwc.conn.Close()
+		nwc.conn = nil
+		return fmt.Errorf("%w: %v", ErrNWCNotConnected, err)
+	}
+	return nil
+}
+
+// connect dials the relay and subscribes to responses from the wallet service.
+func (nwc *NWCClient) connect() error {
+	conn, _, err := websocket.DefaultDialer.Dial(nwc.relayURL, nil)
+	if err != nil {
+		return fmt.Errorf("could not connect to relay '%v': %v", nwc.relayURL, err)
+	}
+
+	filter := map[string]any{
+		"kinds":   []int{NWCResponseKind},
+		"authors": []string{nwc.walletPubHex},
+		"#p":      []string{nwc.pubkey},
+		"since":   time.Now().Add(-time.Minute).Unix(),
+	}
+	if err := conn.WriteJSON([]any{"REQ", "nwc-" + nwc.pubkey[:16], filter}); err != nil {
+		conn.Close()
+		return fmt.Errorf("could not subscribe to relay '%v': %v", nwc.relayURL, err)
+	}
+
+	nwc.mu.Lock()
+	if nwc.conn != nil {
+		nwc.conn.Close()
+	}
+	nwc.conn = conn
+	nwc.mu.Unlock()
+
+	go nwc.readLoop(conn)
+	return nil
+}
+
+func (nwc *NWCClient) readLoop(conn *websocket.Conn) {
+	for {
+		var msg []json.RawMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			// drop the connection so that the next request reconnects
+			nwc.mu.Lock()
+			if nwc.conn == conn {
+				nwc.conn.Close()
+				nwc.conn = nil
+			}
+			nwc.mu.Unlock()
+			return
+		}
+
+		var msgType string
+		if len(msg) < 3 || json.Unmarshal(msg[0], &msgType) != nil || msgType != "EVENT" {
+			continue
+		}
+		var event nip01.Event
+		if err := json.Unmarshal(msg[2], &event); err != nil {
+			continue
+		}
+		nwc.handleResponse(event)
+	}
+}
+
+func (nwc *NWCClient) handleResponse(event nip01.Event) {
+	if event.Kind != NWCResponseKind || event.PubKey != nwc.walletPubHex || event.Verify() != nil {
+		return
+	}
+
+	var requestId string
+	for _, tag := range event.Tags {
+		if len(tag) > 1 && tag[0] == "e" {
+			requestId = tag[1]
+		}
+	}
+
+	nwc.mu.Lock()
+	responseChan, ok := nwc.pending[requestId]
+	nwc.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	content, err := nip04Decrypt(nwc.secret, nwc.walletPubkey, event.Content)
+	if err != nil {
+		return
+	}
+	var response nwcResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return
+	}
+
+	select {
+	case responseChan <- response:
+	default:
+	}
+}
+
+// nip04Encrypt encrypts the content with AES-256-CBC using the
+// ECDH shared secret between key and pubkey as described in NIP-04.
+func nip04Encrypt(key *secp256k1.PrivateKey, pubkey *secp256k1.PublicKey, content []byte) (string, error) {
+	block, err := aes.NewCipher(secp256k1.GenerateSharedSecret(key, pubkey))
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	padding := aes.BlockSize - len(content)%aes.BlockSize
+	padded := append(content, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	return base64.StdEncoding.EncodeToString(ciphertext) + "?iv=" + base64.StdEncoding.EncodeToString(iv), nil
+}
+
+func nip04Decrypt(key *secp256k1.PrivateKey, pubkey *secp256k1.PublicKey, content string) ([]byte, error) {
+	parts := strings.Split(content, "?iv=")
+	if len(parts) != 2 {
+		return nil, errors.New("invalid NIP-04 content")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	iv, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid NIP-04 content")
+	}
+
+	block, err := aes.NewCipher(secp256k1.GenerateSharedSecret(key, pubkey))
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) {
+		return nil, errors.New("invalid NIP-04 padding")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
@@ -0,0 +1,171 @@
+package lightning
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/internal/nip01"
+	"github.com/gorilla/websocket"
+)
+
+// fakeWalletService acts as both relay and NIP-47 wallet service
+type fakeWalletService struct {
+	key         *secp256k1.PrivateKey
+	invoice     string
+	paymentHash string
+	preimage    string
+	requests    atomic.Int32
+	// close connection after handling this number of requests
+	dropAfter int32
+}
+
+func (ws *fakeWalletService) handler(t *testing.T) http.HandlerFunc {
+	upgrader := websocket.Upgrader{}
+	return func(rw http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(rw, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg []json.RawMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			var msgType string
+			json.Unmarshal(msg[0], &msgType)
+			if msgType != "EVENT" {
+				continue
+			}
+
+			var event nip01.Event
+			json.Unmarshal(msg[1], &event)
+			if event.Verify() != nil {
+				t.Errorf("invalid event signature")
+				return
+			}
+			clientPubBytes, _ := hex.DecodeString(event.PubKey)
+			clientPubkey, _ := schnorr.ParsePubKey(clientPubBytes)
+			content, err := nip04Decrypt(ws.key, clientPubkey, event.Content)
+			if err != nil {
+				t.Errorf("could not decrypt request: %v", err)
+				return
+			}
+			var request nwcRequest
+			json.Unmarshal(content, &request)
+
+			response := nwcResponse{ResultType: request.Method}
+			switch request.Method {
+			case "make_invoice":
+				response.Result, _ = json.Marshal(nwcTransaction{Invoice: ws.invoice, PaymentHash: ws.paymentHash})
+			case "lookup_invoice":
+				response.Result, _ = json.Marshal(nwcTransaction{
+					Invoice:     ws.invoice,
+					PaymentHash: ws.paymentHash,
+					Preimage:    ws.preimage,
+					Amount:      2100000,
+					SettledAt:   1,
+				})
+			case "pay_invoice":
+				response.Error = &nwcError{Code: "INSUFFICIENT_BALANCE", Message: "not enough funds"}
+			}
+
+			responseContent, _ := json.Marshal(response)
+			encrypted, _ := nip04Encrypt(ws.key, clientPubkey, responseContent)
+			tags := [][]string{{"p", event.PubKey}, {"e", event.Id}}
+			responseEvent := nip01.Event{CreatedAt: time.Now().Unix(), Kind: NWCResponseKind, Tags: tags, Content: encrypted}
+			responseEvent.Sign(ws.key)
+			conn.WriteJSON([]any{"EVENT", "sub", responseEvent})
+
+			if ws.requests.Add(1) == ws.dropAfter {
+				return
+			}
+		}
+	}
+}
+
+func TestNWCClient(t *testing.T) {
+	walletKey, _ := secp256k1.GeneratePrivateKey()
+	invoice, preimage, hash, _ := CreateFakeInvoice(2100, false)
+	walletService := &fakeWalletService{
+		key:         walletKey,
+		invoice:     invoice,
+		paymentHash: hash,
+		preimage:    preimage,
+		dropAfter:   1,
+	}
+	server := httptest.NewServer(walletService.handler(t))
+	defer server.Close()
+
+	clientSecret, _ := secp256k1.GeneratePrivateKey()
+	uri := "nostr+walletconnect://" + hex.EncodeToString(schnorr.SerializePubKey(walletKey.PubKey())) +
+		"?relay=" + "ws" + strings.TrimPrefix(server.URL, "http") +
+		"&secret=" + hex.EncodeToString(clientSecret.Serialize())
+
+	client, err := SetupNWCClient(NWCConfig{ConnectionURI: uri})
+	if err != nil {
+		t.Fatalf("error setting up NWC client: %v", err)
+	}
+
+	createdInvoice, err := client.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if createdInvoice.PaymentHash != hash {
+		t.Fatalf("expected payment hash '%v' but got '%v'", hash, createdInvoice.PaymentHash)
+	}
+
+	// relay dropped connection after first request. Should reconnect
+	var status Invoice
+	for i := 0; i < 3; i++ {
+		status, err = client.InvoiceStatus(context.Background(), hash)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("unexpected error looking up invoice: %v", err)
+	}
+	if !status.Settled || status.Amount != 2100 {
+		t.Fatalf("expected settled invoice of 2100 sats but got '%+v'", status)
+	}
+
+	payment, err := client.SendPayment(context.Background(), invoice, 10)
+	var nwcErr nwcError
+	if !errors.As(err, &nwcErr) || nwcErr.Code != "INSUFFICIENT_BALANCE" {
+		t.Fatalf("expected INSUFFICIENT_BALANCE error but got '%v'", err)
+	}
+	if payment.PaymentStatus != Failed {
+		t.Fatalf("expected payment status '%v' but got '%v'", Failed, payment.PaymentStatus)
+	}
+}
+
+func TestNIP04(t *testing.T) {
+	key1, _ := secp256k1.GeneratePrivateKey()
+	key2, _ := secp256k1.GeneratePrivateKey()
+
+	msg := []byte(`{"method":"get_info","params":{}}`)
+	encrypted, err := nip04Encrypt(key1, key2.PubKey(), msg)
+	if err != nil {
+		t.Fatalf("unexpected error encrypting: %v", err)
+	}
+
+	decrypted, err := nip04Decrypt(key2, key1.PubKey(), encrypted)
+	if err != nil {
+		t.Fatalf("unexpected error decrypting: %v", err)
+	}
+	if string(decrypted) != string(msg) {
+		t.Fatalf("expected '%s' but got '%s'", msg, decrypted)
+	}
+}
@@ -0,0 +1,309 @@
+package lightning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const (
+	// phoenixd charges 0.4% + 4 sats for outgoing payments
+	PhoenixdFeePercent  float64 = 0.004
+	PhoenixdBaseFeeMsat         = 4000
+
+	// how often to check an incoming payment when subscribed to an invoice
+	PhoenixdPollInterval = time.Second * 2
+)
+
+type PhoenixdConfig struct {
+	// url of the phoenixd http api. i.e http://127.0.0.1:9740
+	Host string
+	// http-password from the phoenixd config
+	Password string
+	// retries and circuit breaker for requests to phoenixd
+	Retry RetryConfig
+	// socks5 or http proxy for requests to phoenixd. Optional
+	ProxyURL string
+}
+
+// PhoenixdClient is a backend for the http api of ACINQ's phoenixd.
+type PhoenixdClient struct {
+	host       string
+	password   string
+	httpClient *http.Client
+}
+
+func SetupPhoenixdClient(config PhoenixdConfig) (*PhoenixdClient, error) {
+	host, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid phoenixd host: %v", err)
+	}
+	if host.Scheme != "http" && host.Scheme != "https" {
+		return nil, fmt.Errorf("invalid phoenixd host '%v'. Expected http or https scheme", config.Host)
+	}
+	if len(config.Password) == 0 {
+		return nil, errors.New("phoenixd password cannot be empty")
+	}
+	httpClient, err := newHTTPClient(0, config.Retry, config.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PhoenixdClient{
+		host:       strings.TrimSuffix(host.String(), "/"),
+		password:   config.Password,
+		httpClient: httpClient,
+	}, nil
+}
+
+type phoenixdNodeInfo struct {
+	NodeId string `json:"nodeId"`
+}
+
+type phoenixdInvoice struct {
+	AmountSat   uint64 `json:"amountSat"`
+	PaymentHash string `json:"paymentHash"`
+	Serialized  string `json:"serialized"`
+}
+
+type phoenixdIncomingPayment struct {
+	PaymentHash string `json:"paymentHash"`
+	Preimage    string `json:"preimage"`
+	Invoice     string `json:"invoice"`
+	IsPaid      bool   `json:"isPaid"`
+	ReceivedSat uint64 `json:"receivedSat"`
+}
+
+type phoenixdPaymentResult struct {
+	RecipientAmountSat uint64 `json:"recipientAmountSat"`
+	RoutingFeeSat      uint64 `json:"routingFeeSat"`
+	PaymentId          string `json:"paymentId"`
+	PaymentHash        string `json:"paymentHash"`
+	PaymentPreimage    string `json:"paymentPreimage"`
+	Reason             string `json:"reason"`
+}
+
+type phoenixdOutgoingPayment struct {
+	PaymentId   string `json:"paymentId"`
+	PaymentHash string `json:"paymentHash"`
+	Preimage    string `json:"preimage"`
+	IsPaid      bool   `json:"isPaid"`
+	// fees paid in msat
+	Fees        uint64 `json:"fees"`
+	CompletedAt int64  `json:"completedAt"`
+}
+
+func (p *PhoenixdClient) ConnectionStatus(ctx context.Context) error {
+	var info phoenixdNodeInfo
+	if err := p.request(ctx, http.MethodGet, "/getinfo", nil, &info); err != nil {
+		return err
+	}
+	if len(info.NodeId) == 0 {
+		return errors.New("phoenixd did not return node id")
+	}
+	return nil
+}
+
+func (p *PhoenixdClient) Available(ctx context.Context) bool {
+	return available(p.httpClient)
+}
+
+func (p *PhoenixdClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	form := url.Values{}
+	form.Set("amountSat", strconv.FormatUint(amount, 10))
+	form.Set("description", "")
+	form.Set("expirySeconds", strconv.Itoa(InvoiceExpiryTime))
+
+	var phoenixdInvoice phoenixdInvoice
+	if err := p.request(ctx, http.MethodPost, "/createinvoice", form, &phoenixdInvoice); err != nil {
+		return Invoice{}, err
+	}
+
+	invoice := Invoice{
+		PaymentRequest: phoenixdInvoice.Serialized,
+		PaymentHash:    phoenixdInvoice.PaymentHash,
+		Amount:         amount,
+		Expiry:         InvoiceExpiryTime,
+	}
+	return invoice, nil
+}
+
+func (p *PhoenixdClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	return p.invoiceStatus(ctx, hash)
+}
+
+func (p *PhoenixdClient) invoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	var payment phoenixdIncomingPayment
+	if err := p.request(ctx, http.MethodGet, "/payments/incoming/"+url.PathEscape(hash), nil, &payment); err != nil {
+		return Invoice{}, err
+	}
+
+	invoice := Invoice{
+		PaymentRequest: payment.Invoice,
+		PaymentHash:    hash,
+		Preimage:       payment.Preimage,
+		Settled:        payment.IsPaid,
+		Amount:         payment.ReceivedSat,
+	}
+	if bolt11, err := decodepay.Decodepay(payment.Invoice); err == nil {
+		invoice.Amount = uint64(bolt11.MSatoshi) / 1000
+		invoice.Expiry = uint64(bolt11.Expiry)
+	}
+	return invoice, nil
+}
+
+func (p *PhoenixdClient) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	// phoenixd does not take a fee limit. Check that the fee from
+	// its fee model will not go over the max fee before paying.
+	bolt11, err := decodepay.Decodepay(request)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, fmt.Errorf("error decoding invoice: %v", err)
+	}
+	feeMsat := p.FeeReserve(ctx, uint64(bolt11.MSatoshi))
+	if feeMsat > maxFee*1000 {
+		return PaymentStatus{PaymentStatus: Failed},
+			fmt.Errorf("fee of %v msat is over max fee of %v sats", feeMsat, maxFee)
+	}
+
+	form := url.Values{}
+	form.Set("invoice", request)
+
+	var result phoenixdPaymentResult
+	if err := p.request(ctx, http.MethodPost, "/payinvoice", form, &result); err != nil {
+		// if context deadline is exceeded, mark payment as pending
+		// if any other error, mark as failed
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	if len(result.Reason) > 0 || len(result.PaymentPreimage) == 0 {
+		return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: result.Reason},
+			fmt.Errorf("payment error: %v", result.Reason)
+	}
+
+	return PaymentStatus{
+		Preimage:      result.PaymentPreimage,
+		PaymentStatus: Succeeded,
+		FeeMsat:       result.RoutingFeeSat * 1000,
+	}, nil
+}
+
+func (p *PhoenixdClient) PayPartialAmount(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	return PaymentStatus{PaymentStatus: Failed}, errors.New("phoenixd does not support paying partial amounts")
+}
+
+func (p *PhoenixdClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	var payment phoenixdOutgoingPayment
+	if err := p.request(ctx, http.MethodGet, "/payments/outgoingbyhash/"+url.PathEscape(hash), nil, &payment); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	if payment.IsPaid {
+		return PaymentStatus{
+			Preimage:      payment.Preimage,
+			PaymentStatus: Succeeded,
+			FeeMsat:       payment.Fees,
+		}, nil
+	}
+	// completed without being paid means it failed
+	if payment.CompletedAt > 0 {
+		return PaymentStatus{PaymentStatus: Failed}, nil
+	}
+	return PaymentStatus{PaymentStatus: Pending}, nil
+}
+
+func (p *PhoenixdClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * PhoenixdFeePercent)
+	return uint64(fee) + PhoenixdBaseFeeMsat
+}
+
+func (p *PhoenixdClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
+	return &PhoenixdInvoiceSub{
+		ctx:         ctx,
+		paymentHash: paymentHash,
+		client:      p,
+	}, nil
+}
+
+// PhoenixdInvoiceSub polls phoenixd for the status of an
+// incoming payment until it gets paid.
+type PhoenixdInvoiceSub struct {
+	ctx         context.Context
+	paymentHash string
+	client      *PhoenixdClient
+}
+
+func (sub *PhoenixdInvoiceSub) Recv() (Invoice, error) {
+	ticker := time.NewTicker(PhoenixdPollInterval)
+	defer ticker.Stop()
+
+	for {
+		invoice, err := sub.client.invoiceStatus(sub.ctx, sub.paymentHash)
+		if err != nil {
+			return Invoice{}, err
+		}
+		if invoice.Settled {
+			return invoice, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-sub.ctx.Done():
+			return Invoice{}, sub.ctx.Err()
+		}
+	}
+}
+
+func (p *PhoenixdClient) request(ctx context.Context, method, path string, form url.Values, dst any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.host+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("", p.password)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("phoenixd error (%v): %s", resp.StatusCode, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, dst); err != nil {
+		return fmt.Errorf("error reading response from phoenixd: %v", err)
+	}
+	return nil
+}
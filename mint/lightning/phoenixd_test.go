@@ -0,0 +1,132 @@
+package lightning
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func setupPhoenixdTest(t *testing.T, password string) *PhoenixdClient {
+	invoice, preimage, hash, err := CreateFakeInvoice(2100, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/createinvoice", func(rw http.ResponseWriter, req *http.Request) {
+		if req.FormValue("amountSat") != "2100" {
+			http.Error(rw, "invalid amount", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(rw).Encode(phoenixdInvoice{AmountSat: 2100, PaymentHash: hash, Serialized: invoice})
+	})
+	mux.HandleFunc("/payments/incoming/"+hash, func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(phoenixdIncomingPayment{
+			PaymentHash: hash,
+			Preimage:    preimage,
+			Invoice:     invoice,
+			IsPaid:      true,
+			ReceivedSat: 2100,
+		})
+	})
+	mux.HandleFunc("/payinvoice", func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(phoenixdPaymentResult{
+			RecipientAmountSat: 2100,
+			RoutingFeeSat:      13,
+			PaymentHash:        hash,
+			PaymentPreimage:    preimage,
+		})
+	})
+	mux.HandleFunc("/payments/outgoingbyhash/"+hash, func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(phoenixdOutgoingPayment{
+			PaymentHash: hash,
+			Preimage:    preimage,
+			IsPaid:      true,
+			Fees:        13000,
+			CompletedAt: 1,
+		})
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if _, pass, ok := req.BasicAuth(); !ok || pass != password {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(rw, req)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := SetupPhoenixdClient(PhoenixdConfig{Host: server.URL, Password: "password"})
+	if err != nil {
+		t.Fatalf("error setting up phoenixd client: %v", err)
+	}
+	return client
+}
+
+func TestPhoenixdClient(t *testing.T) {
+	client := setupPhoenixdTest(t, "password")
+
+	invoice, err := client.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+
+	status, err := client.InvoiceStatus(context.Background(), invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if !status.Settled {
+		t.Fatal("expected settled invoice")
+	}
+	if status.Amount != 2100 {
+		t.Fatalf("expected amount of %v but got %v", 2100, status.Amount)
+	}
+
+	sub, _ := client.SubscribeInvoice(context.Background(), invoice.PaymentHash)
+	update, err := sub.Recv()
+	if err != nil {
+		t.Fatalf("unexpected error from invoice subscription: %v", err)
+	}
+	if !update.Settled {
+		t.Fatal("expected settled invoice from subscription")
+	}
+
+	// fee reserve for 2100 sats is 4 + 8.4 sats
+	if feeReserve := client.FeeReserve(context.Background(), 2100*1000); feeReserve != 12400 {
+		t.Fatalf("expected fee reserve of %v but got %v", 12400, feeReserve)
+	}
+
+	_, err = client.SendPayment(context.Background(), invoice.PaymentRequest, 10)
+	if err == nil {
+		t.Fatal("expected error paying with max fee below fee reserve")
+	}
+
+	payment, err := client.SendPayment(context.Background(), invoice.PaymentRequest, 13)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if payment.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, payment.PaymentStatus)
+	}
+	if payment.FeeMsat != 13000 {
+		t.Fatalf("expected fee of %v msat but got %v", 13000, payment.FeeMsat)
+	}
+
+	outgoing, err := client.OutgoingPaymentStatus(context.Background(), invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if outgoing.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, outgoing.PaymentStatus)
+	}
+}
+
+func TestPhoenixdUnauthorized(t *testing.T) {
+	client := setupPhoenixdTest(t, "other-password")
+
+	if _, err := client.CreateInvoice(context.Background(), 2100); err == nil {
+		t.Fatal("expected error with wrong password")
+	}
+}
@@ -0,0 +1,167 @@
+package lightning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/elnosh/gonuts/mint/lightning/pluginrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// PluginConfig is the config for a backend that runs out of process
+// and implements the LightningPlugin gRPC service in pluginrpc/plugin.proto.
+type PluginConfig struct {
+	// host:port or unix:///path/to/socket
+	Address string
+	// if nil, the connection is made without TLS.
+	// Only use that for plugins on the same machine.
+	Cert credentials.TransportCredentials
+}
+
+type PluginClient struct {
+	grpcClient pluginrpc.LightningPluginClient
+}
+
+func SetupPluginClient(config PluginConfig) (*PluginClient, error) {
+	creds := config.Cert
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+
+	conn, err := grpc.NewClient(config.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("error setting up grpc client: %v", err)
+	}
+
+	return &PluginClient{grpcClient: pluginrpc.NewLightningPluginClient(conn)}, nil
+}
+
+func (plugin *PluginClient) ConnectionStatus(ctx context.Context) error {
+	_, err := plugin.grpcClient.ConnectionStatus(ctx, &pluginrpc.ConnectionStatusRequest{})
+	return err
+}
+
+func (plugin *PluginClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	invoice, err := plugin.grpcClient.CreateInvoice(ctx, &pluginrpc.CreateInvoiceRequest{Amount: amount})
+	if err != nil {
+		return Invoice{}, err
+	}
+	return pluginInvoice(invoice), nil
+}
+
+func (plugin *PluginClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	invoice, err := plugin.grpcClient.InvoiceStatus(ctx, &pluginrpc.InvoiceStatusRequest{PaymentHash: hash})
+	if err != nil {
+		return Invoice{}, err
+	}
+	return pluginInvoice(invoice), nil
+}
+
+func (plugin *PluginClient) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	paymentStatus, err := plugin.grpcClient.SendPayment(ctx, &pluginrpc.SendPaymentRequest{
+		Request: request,
+		MaxFee:  maxFee,
+	})
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	return pluginPaymentStatus(paymentStatus), nil
+}
+
+func (plugin *PluginClient) PayPartialAmount(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	paymentStatus, err := plugin.grpcClient.PayPartialAmount(ctx, &pluginrpc.PayPartialAmountRequest{
+		Request:    request,
+		AmountMsat: amountMsat,
+		MaxFee:     maxFee,
+	})
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	return pluginPaymentStatus(paymentStatus), nil
+}
+
+// OutgoingPaymentStatus returns the error from the plugin as is so that
+// a NotFound status code can be checked by the mint.
+func (plugin *PluginClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	paymentStatus, err := plugin.grpcClient.OutgoingPaymentStatus(ctx, &pluginrpc.OutgoingPaymentStatusRequest{
+		PaymentHash: hash,
+	})
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	return pluginPaymentStatus(paymentStatus), nil
+}
+
+func (plugin *PluginClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	feeReserve, err := plugin.grpcClient.FeeReserve(ctx, &pluginrpc.FeeReserveRequest{AmountMsat: amountMsat})
+	if err != nil {
+		// interface does not return an error so use the
+		// same percentage as other backends if plugin fails
+		return uint64(math.Ceil(float64(amountMsat) * FeePercent))
+	}
+	return feeReserve.FeeReserveMsat
+}
+
+func (plugin *PluginClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
+	stream, err := plugin.grpcClient.SubscribeInvoice(ctx, &pluginrpc.SubscribeInvoiceRequest{PaymentHash: paymentHash})
+	if err != nil {
+		return nil, err
+	}
+	return &PluginInvoiceSub{stream: stream}, nil
+}
+
+type PluginInvoiceSub struct {
+	stream pluginrpc.LightningPlugin_SubscribeInvoiceClient
+}
+
+func (sub *PluginInvoiceSub) Recv() (Invoice, error) {
+	invoice, err := sub.stream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Invoice{}, errors.New("invoice subscription closed by plugin")
+		}
+		return Invoice{}, err
+	}
+	return pluginInvoice(invoice), nil
+}
+
+func pluginInvoice(invoice *pluginrpc.Invoice) Invoice {
+	return Invoice{
+		PaymentRequest: invoice.PaymentRequest,
+		PaymentHash:    invoice.PaymentHash,
+		Preimage:       invoice.Preimage,
+		Settled:        invoice.Settled,
+		Amount:         invoice.Amount,
+		Expiry:         invoice.Expiry,
+	}
+}
+
+func pluginPaymentStatus(paymentStatus *pluginrpc.PaymentStatus) PaymentStatus {
+	status := PaymentStatus{
+		Preimage:             paymentStatus.Preimage,
+		PaymentFailureReason: paymentStatus.FailureReason,
+		FeeMsat:              paymentStatus.FeeMsat,
+	}
+	switch paymentStatus.State {
+	case pluginrpc.PaymentState_SUCCEEDED:
+		status.PaymentStatus = Succeeded
+	case pluginrpc.PaymentState_FAILED:
+		status.PaymentStatus = Failed
+	case pluginrpc.PaymentState_PENDING:
+		status.PaymentStatus = Pending
+	default:
+		// an unknown state could still be in flight
+		status.PaymentStatus = Unknown
+	}
+	return status
+}
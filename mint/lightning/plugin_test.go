@@ -0,0 +1,126 @@
+package lightning
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elnosh/gonuts/mint/lightning/pluginrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakePlugin implements the plugin service using the FakeBackend.
+// FeeReserve is left unimplemented.
+type fakePlugin struct {
+	pluginrpc.UnimplementedLightningPluginServer
+	fb *FakeBackend
+}
+
+func (p *fakePlugin) ConnectionStatus(
+	ctx context.Context,
+	req *pluginrpc.ConnectionStatusRequest,
+) (*pluginrpc.ConnectionStatusResponse, error) {
+	return &pluginrpc.ConnectionStatusResponse{}, nil
+}
+
+func (p *fakePlugin) CreateInvoice(ctx context.Context, req *pluginrpc.CreateInvoiceRequest) (*pluginrpc.Invoice, error) {
+	invoice, err := p.fb.CreateInvoice(ctx, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	return &pluginrpc.Invoice{
+		PaymentRequest: invoice.PaymentRequest,
+		PaymentHash:    invoice.PaymentHash,
+		Settled:        invoice.Settled,
+		Amount:         invoice.Amount,
+	}, nil
+}
+
+func (p *fakePlugin) SendPayment(ctx context.Context, req *pluginrpc.SendPaymentRequest) (*pluginrpc.PaymentStatus, error) {
+	return &pluginrpc.PaymentStatus{Preimage: FakePreimage, State: pluginrpc.PaymentState_SUCCEEDED}, nil
+}
+
+func (p *fakePlugin) OutgoingPaymentStatus(
+	ctx context.Context,
+	req *pluginrpc.OutgoingPaymentStatusRequest,
+) (*pluginrpc.PaymentStatus, error) {
+	return nil, status.Error(codes.NotFound, "payment not found")
+}
+
+func (p *fakePlugin) SubscribeInvoice(
+	req *pluginrpc.SubscribeInvoiceRequest,
+	stream pluginrpc.LightningPlugin_SubscribeInvoiceServer,
+) error {
+	return stream.Send(&pluginrpc.Invoice{PaymentHash: req.PaymentHash, Settled: true, Preimage: FakePreimage})
+}
+
+func TestPluginClient(t *testing.T) {
+	dir, err := os.MkdirTemp("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "plugin.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("error listening on socket: %v", err)
+	}
+	server := grpc.NewServer()
+	pluginrpc.RegisterLightningPluginServer(server, &fakePlugin{fb: &FakeBackend{}})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	client, err := SetupPluginClient(PluginConfig{Address: "unix://" + socketPath})
+	if err != nil {
+		t.Fatalf("error setting up plugin client: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := client.ConnectionStatus(ctx); err != nil {
+		t.Fatalf("unexpected error checking connection status: %v", err)
+	}
+
+	invoice, err := client.CreateInvoice(ctx, 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if invoice.Amount != 2100 {
+		t.Fatalf("expected invoice amount of %v but got %v", 2100, invoice.Amount)
+	}
+
+	paymentStatus, err := client.SendPayment(ctx, invoice.PaymentRequest, 10)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if paymentStatus.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, paymentStatus.PaymentStatus)
+	}
+
+	// status codes from the plugin should be kept
+	_, err = client.OutgoingPaymentStatus(ctx, invoice.PaymentHash)
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound status code but got '%v'", err)
+	}
+
+	// should fallback to percentage fee if plugin does not implement it
+	if fee := client.FeeReserve(ctx, 100000); fee != 1000 {
+		t.Fatalf("expected fee reserve of %v but got %v", 1000, fee)
+	}
+
+	sub, err := client.SubscribeInvoice(ctx, invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to invoice: %v", err)
+	}
+	update, err := sub.Recv()
+	if err != nil {
+		t.Fatalf("unexpected error receiving invoice update: %v", err)
+	}
+	if !update.Settled || update.PaymentHash != invoice.PaymentHash {
+		t.Fatalf("expected settled invoice with hash '%v' but got '%+v'", invoice.PaymentHash, update)
+	}
+}
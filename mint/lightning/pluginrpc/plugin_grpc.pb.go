@@ -0,0 +1,381 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pluginrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// LightningPluginClient is the client API for LightningPlugin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LightningPluginClient interface {
+	ConnectionStatus(ctx context.Context, in *ConnectionStatusRequest, opts ...grpc.CallOption) (*ConnectionStatusResponse, error)
+	CreateInvoice(ctx context.Context, in *CreateInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error)
+	InvoiceStatus(ctx context.Context, in *InvoiceStatusRequest, opts ...grpc.CallOption) (*Invoice, error)
+	SendPayment(ctx context.Context, in *SendPaymentRequest, opts ...grpc.CallOption) (*PaymentStatus, error)
+	PayPartialAmount(ctx context.Context, in *PayPartialAmountRequest, opts ...grpc.CallOption) (*PaymentStatus, error)
+	OutgoingPaymentStatus(ctx context.Context, in *OutgoingPaymentStatusRequest, opts ...grpc.CallOption) (*PaymentStatus, error)
+	FeeReserve(ctx context.Context, in *FeeReserveRequest, opts ...grpc.CallOption) (*FeeReserveResponse, error)
+	SubscribeInvoice(ctx context.Context, in *SubscribeInvoiceRequest, opts ...grpc.CallOption) (LightningPlugin_SubscribeInvoiceClient, error)
+}
+
+type lightningPluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLightningPluginClient(cc grpc.ClientConnInterface) LightningPluginClient {
+	return &lightningPluginClient{cc}
+}
+
+func (c *lightningPluginClient) ConnectionStatus(ctx context.Context, in *ConnectionStatusRequest, opts ...grpc.CallOption) (*ConnectionStatusResponse, error) {
+	out := new(ConnectionStatusResponse)
+	err := c.cc.Invoke(ctx, "/pluginrpc.LightningPlugin/ConnectionStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lightningPluginClient) CreateInvoice(ctx context.Context, in *CreateInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error) {
+	out := new(Invoice)
+	err := c.cc.Invoke(ctx, "/pluginrpc.LightningPlugin/CreateInvoice", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lightningPluginClient) InvoiceStatus(ctx context.Context, in *InvoiceStatusRequest, opts ...grpc.CallOption) (*Invoice, error) {
+	out := new(Invoice)
+	err := c.cc.Invoke(ctx, "/pluginrpc.LightningPlugin/InvoiceStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lightningPluginClient) SendPayment(ctx context.Context, in *SendPaymentRequest, opts ...grpc.CallOption) (*PaymentStatus, error) {
+	out := new(PaymentStatus)
+	err := c.cc.Invoke(ctx, "/pluginrpc.LightningPlugin/SendPayment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lightningPluginClient) PayPartialAmount(ctx context.Context, in *PayPartialAmountRequest, opts ...grpc.CallOption) (*PaymentStatus, error) {
+	out := new(PaymentStatus)
+	err := c.cc.Invoke(ctx, "/pluginrpc.LightningPlugin/PayPartialAmount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lightningPluginClient) OutgoingPaymentStatus(ctx context.Context, in *OutgoingPaymentStatusRequest, opts ...grpc.CallOption) (*PaymentStatus, error) {
+	out := new(PaymentStatus)
+	err := c.cc.Invoke(ctx, "/pluginrpc.LightningPlugin/OutgoingPaymentStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lightningPluginClient) FeeReserve(ctx context.Context, in *FeeReserveRequest, opts ...grpc.CallOption) (*FeeReserveResponse, error) {
+	out := new(FeeReserveResponse)
+	err := c.cc.Invoke(ctx, "/pluginrpc.LightningPlugin/FeeReserve", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lightningPluginClient) SubscribeInvoice(ctx context.Context, in *SubscribeInvoiceRequest, opts ...grpc.CallOption) (LightningPlugin_SubscribeInvoiceClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LightningPlugin_ServiceDesc.Streams[0], "/pluginrpc.LightningPlugin/SubscribeInvoice", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &lightningPluginSubscribeInvoiceClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LightningPlugin_SubscribeInvoiceClient interface {
+	Recv() (*Invoice, error)
+	grpc.ClientStream
+}
+
+type lightningPluginSubscribeInvoiceClient struct {
+	grpc.ClientStream
+}
+
+func (x *lightningPluginSubscribeInvoiceClient) Recv() (*Invoice, error) {
+	m := new(Invoice)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LightningPluginServer is the server API for LightningPlugin service.
+// All implementations must embed UnimplementedLightningPluginServer
+// for forward compatibility
+type LightningPluginServer interface {
+	ConnectionStatus(context.Context, *ConnectionStatusRequest) (*ConnectionStatusResponse, error)
+	CreateInvoice(context.Context, *CreateInvoiceRequest) (*Invoice, error)
+	InvoiceStatus(context.Context, *InvoiceStatusRequest) (*Invoice, error)
+	SendPayment(context.Context, *SendPaymentRequest) (*PaymentStatus, error)
+	PayPartialAmount(context.Context, *PayPartialAmountRequest) (*PaymentStatus, error)
+	OutgoingPaymentStatus(context.Context, *OutgoingPaymentStatusRequest) (*PaymentStatus, error)
+	FeeReserve(context.Context, *FeeReserveRequest) (*FeeReserveResponse, error)
+	SubscribeInvoice(*SubscribeInvoiceRequest, LightningPlugin_SubscribeInvoiceServer) error
+	mustEmbedUnimplementedLightningPluginServer()
+}
+
+// UnimplementedLightningPluginServer must be embedded to have forward compatible implementations.
+type UnimplementedLightningPluginServer struct {
+}
+
+func (UnimplementedLightningPluginServer) ConnectionStatus(context.Context, *ConnectionStatusRequest) (*ConnectionStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConnectionStatus not implemented")
+}
+func (UnimplementedLightningPluginServer) CreateInvoice(context.Context, *CreateInvoiceRequest) (*Invoice, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateInvoice not implemented")
+}
+func (UnimplementedLightningPluginServer) InvoiceStatus(context.Context, *InvoiceStatusRequest) (*Invoice, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InvoiceStatus not implemented")
+}
+func (UnimplementedLightningPluginServer) SendPayment(context.Context, *SendPaymentRequest) (*PaymentStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendPayment not implemented")
+}
+func (UnimplementedLightningPluginServer) PayPartialAmount(context.Context, *PayPartialAmountRequest) (*PaymentStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PayPartialAmount not implemented")
+}
+func (UnimplementedLightningPluginServer) OutgoingPaymentStatus(context.Context, *OutgoingPaymentStatusRequest) (*PaymentStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OutgoingPaymentStatus not implemented")
+}
+func (UnimplementedLightningPluginServer) FeeReserve(context.Context, *FeeReserveRequest) (*FeeReserveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FeeReserve not implemented")
+}
+func (UnimplementedLightningPluginServer) SubscribeInvoice(*SubscribeInvoiceRequest, LightningPlugin_SubscribeInvoiceServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeInvoice not implemented")
+}
+func (UnimplementedLightningPluginServer) mustEmbedUnimplementedLightningPluginServer() {}
+
+// UnsafeLightningPluginServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LightningPluginServer will
+// result in compilation errors.
+type UnsafeLightningPluginServer interface {
+	mustEmbedUnimplementedLightningPluginServer()
+}
+
+func RegisterLightningPluginServer(s grpc.ServiceRegistrar, srv LightningPluginServer) {
+	s.RegisterService(&LightningPlugin_ServiceDesc, srv)
+}
+
+func _LightningPlugin_ConnectionStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConnectionStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LightningPluginServer).ConnectionStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pluginrpc.LightningPlugin/ConnectionStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LightningPluginServer).ConnectionStatus(ctx, req.(*ConnectionStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LightningPlugin_CreateInvoice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateInvoiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LightningPluginServer).CreateInvoice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pluginrpc.LightningPlugin/CreateInvoice",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LightningPluginServer).CreateInvoice(ctx, req.(*CreateInvoiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LightningPlugin_InvoiceStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvoiceStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LightningPluginServer).InvoiceStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pluginrpc.LightningPlugin/InvoiceStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LightningPluginServer).InvoiceStatus(ctx, req.(*InvoiceStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LightningPlugin_SendPayment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendPaymentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LightningPluginServer).SendPayment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pluginrpc.LightningPlugin/SendPayment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LightningPluginServer).SendPayment(ctx, req.(*SendPaymentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LightningPlugin_PayPartialAmount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PayPartialAmountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LightningPluginServer).PayPartialAmount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pluginrpc.LightningPlugin/PayPartialAmount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LightningPluginServer).PayPartialAmount(ctx, req.(*PayPartialAmountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LightningPlugin_OutgoingPaymentStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OutgoingPaymentStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LightningPluginServer).OutgoingPaymentStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pluginrpc.LightningPlugin/OutgoingPaymentStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LightningPluginServer).OutgoingPaymentStatus(ctx, req.(*OutgoingPaymentStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LightningPlugin_FeeReserve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FeeReserveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LightningPluginServer).FeeReserve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pluginrpc.LightningPlugin/FeeReserve",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LightningPluginServer).FeeReserve(ctx, req.(*FeeReserveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LightningPlugin_SubscribeInvoice_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeInvoiceRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LightningPluginServer).SubscribeInvoice(m, &lightningPluginSubscribeInvoiceServer{stream})
+}
+
+type LightningPlugin_SubscribeInvoiceServer interface {
+	Send(*Invoice) error
+	grpc.ServerStream
+}
+
+type lightningPluginSubscribeInvoiceServer struct {
+	grpc.ServerStream
+}
+
+func (x *lightningPluginSubscribeInvoiceServer) Send(m *Invoice) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// LightningPlugin_ServiceDesc is the grpc.ServiceDesc for LightningPlugin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LightningPlugin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pluginrpc.LightningPlugin",
+	HandlerType: (*LightningPluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ConnectionStatus",
+			Handler:    _LightningPlugin_ConnectionStatus_Handler,
+		},
+		{
+			MethodName: "CreateInvoice",
+			Handler:    _LightningPlugin_CreateInvoice_Handler,
+		},
+		{
+			MethodName: "InvoiceStatus",
+			Handler:    _LightningPlugin_InvoiceStatus_Handler,
+		},
+		{
+			MethodName: "SendPayment",
+			Handler:    _LightningPlugin_SendPayment_Handler,
+		},
+		{
+			MethodName: "PayPartialAmount",
+			Handler:    _LightningPlugin_PayPartialAmount_Handler,
+		},
+		{
+			MethodName: "OutgoingPaymentStatus",
+			Handler:    _LightningPlugin_OutgoingPaymentStatus_Handler,
+		},
+		{
+			MethodName: "FeeReserve",
+			Handler:    _LightningPlugin_FeeReserve_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeInvoice",
+			Handler:       _LightningPlugin_SubscribeInvoice_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "plugin.proto",
+}
@@ -0,0 +1,165 @@
+package lightning
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/proxy"
+)
+
+// ErrBackendUnavailable is returned without making the request
+// while the circuit breaker for a backend is open.
+var ErrBackendUnavailable = errors.New("lightning backend unavailable")
+
+const (
+	DefaultMaxRetries       = 3
+	DefaultInitialBackoff   = time.Millisecond * 250
+	DefaultMaxBackoff       = time.Second * 5
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = time.Second * 30
+)
+
+// RetryConfig configures retries and the circuit breaker for
+// requests to HTTP backends. Zero values use the defaults.
+type RetryConfig struct {
+	// retries for requests that are safe to repeat (GET and HEAD).
+	// Requests like creating invoices or paying are never retried.
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// consecutive failed requests after which the breaker opens
+	// and requests fail with ErrBackendUnavailable
+	BreakerThreshold int
+	// how long the breaker stays open before letting a request through
+	BreakerCooldown time.Duration
+}
+
+func (config RetryConfig) withDefaults() RetryConfig {
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = DefaultInitialBackoff
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.BreakerThreshold == 0 {
+		config.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if config.BreakerCooldown == 0 {
+		config.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return config
+}
+
+// retryTransport is an http.RoundTripper that retries idempotent requests
+// with jittered exponential backoff on connection errors and 5xx responses.
+// After BreakerThreshold consecutive failures it stops making requests
+// until BreakerCooldown has passed.
+type retryTransport struct {
+	base   http.RoundTripper
+	config RetryConfig
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newRetryTransport(config RetryConfig) *retryTransport {
+	return &retryTransport{
+		base:   http.DefaultTransport,
+		config: config.withDefaults(),
+	}
+}
+
+// newHTTPClient returns the client for the HTTP backends. Requests are
+// retried according to the config and made through the proxy if set.
+func newHTTPClient(timeout time.Duration, config RetryConfig, proxyURL string) (*http.Client, error) {
+	transport := newRetryTransport(config)
+	if len(proxyURL) > 0 {
+		u, err := proxy.Parse(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.base = proxy.Transport(u)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.isOpen() {
+		return nil, ErrBackendUnavailable
+	}
+
+	retries := 0
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		retries = t.config.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			t.recordSuccess()
+			return resp, nil
+		}
+		if attempt >= retries {
+			t.recordFailure()
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(t.backoff(attempt)):
+		case <-req.Context().Done():
+			t.recordFailure()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// backoff returns the time to wait before the next attempt using
+// exponential backoff with full jitter.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	backoff := t.config.InitialBackoff << attempt
+	if backoff <= 0 || backoff > t.config.MaxBackoff {
+		backoff = t.config.MaxBackoff
+	}
+	return time.Duration(rand.Int64N(int64(backoff))) + 1
+}
+
+// available returns false while the circuit breaker
+// of the transport of the client is open
+func available(client *http.Client) bool {
+	t, ok := client.Transport.(*retryTransport)
+	return !ok || !t.isOpen()
+}
+
+func (t *retryTransport) isOpen() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Now().Before(t.openUntil)
+}
+
+func (t *retryTransport) recordSuccess() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures = 0
+}
+
+func (t *retryTransport) recordFailure() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures++
+	// after the cooldown, a single failed request opens it again
+	if t.failures >= t.config.BreakerThreshold {
+		t.openUntil = time.Now().Add(t.config.BreakerCooldown)
+	}
+}
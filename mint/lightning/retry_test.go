@@ -0,0 +1,87 @@
+package lightning
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var requests atomic.Int32
+	var failUntil atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if requests.Add(1) <= failUntil.Load() {
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRetryTransport(RetryConfig{
+		MaxRetries:       2,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       time.Millisecond * 5,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Millisecond * 200,
+	})}
+
+	// GET should be retried until it succeeds
+	failUntil.Store(2)
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, resp.StatusCode)
+	}
+	if requests.Load() != 3 {
+		t.Fatalf("expected 3 requests but got %v", requests.Load())
+	}
+
+	// POST should not be retried
+	requests.Store(0)
+	failUntil.Store(100)
+	resp, err = client.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %v but got %v", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("expected 1 request but got %v", requests.Load())
+	}
+
+	// second consecutive failure should open the breaker
+	resp, err = client.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	_, err = client.Get(server.URL)
+	if !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrBackendUnavailable, err)
+	}
+	if requests.Load() != 2 {
+		t.Fatalf("expected no requests while breaker is open but got %v", requests.Load()-2)
+	}
+	if available(client) {
+		t.Fatal("expected client to not be available while breaker is open")
+	}
+
+	// after cooldown, requests should go through again
+	time.Sleep(time.Millisecond * 250)
+	failUntil.Store(0)
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error after cooldown: %v", err)
+	}
+	resp.Body.Close()
+}
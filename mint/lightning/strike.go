@@ -0,0 +1,390 @@
+package lightning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const (
+	StrikeAPIURL        = "https://api.strike.me"
+	StrikeSandboxAPIURL = "https://api.dev.strike.me"
+
+	// how often to check the state of an invoice when subscribed to it
+	StrikePollInterval = time.Second * 2
+)
+
+type StrikeConfig struct {
+	APIKey string
+	// use the Strike sandbox environment instead of production
+	Sandbox bool
+	// overrides the API url. Used for testing
+	APIURL string
+	// retries and circuit breaker for requests to the API
+	Retry RetryConfig
+	// socks5 or http proxy for requests to the API. Optional
+	ProxyURL string
+}
+
+// StrikeClient is a backend that uses the Strike API to receive
+// and send payments so that a mint can run without its own node.
+type StrikeClient struct {
+	apiURL     string
+	apiKey     string
+	httpClient *http.Client
+
+	// Strike identifies invoices and payments by their own ids.
+	// These map payment hashes to those ids.
+	mu         sync.RWMutex
+	invoiceIds map[string]string
+	paymentIds map[string]string
+}
+
+func SetupStrikeClient(config StrikeConfig) (*StrikeClient, error) {
+	if len(config.APIKey) == 0 {
+		return nil, errors.New("strike api key cannot be empty")
+	}
+
+	apiURL := config.APIURL
+	if len(apiURL) == 0 {
+		apiURL = StrikeAPIURL
+		if config.Sandbox {
+			apiURL = StrikeSandboxAPIURL
+		}
+	}
+	httpClient, err := newHTTPClient(time.Minute, config.Retry, config.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StrikeClient{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		apiKey:     config.APIKey,
+		httpClient: httpClient,
+		invoiceIds: make(map[string]string),
+		paymentIds: make(map[string]string),
+	}, nil
+}
+
+type strikeAmount struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type strikeInvoice struct {
+	InvoiceId string       `json:"invoiceId"`
+	Amount    strikeAmount `json:"amount"`
+	State     string       `json:"state"`
+}
+
+type strikeInvoiceQuote struct {
+	QuoteId         string `json:"quoteId"`
+	LnInvoice       string `json:"lnInvoice"`
+	ExpirationInSec uint64 `json:"expirationInSec"`
+}
+
+type strikePaymentQuote struct {
+	PaymentQuoteId      string       `json:"paymentQuoteId"`
+	Amount              strikeAmount `json:"amount"`
+	LightningNetworkFee strikeAmount `json:"lightningNetworkFee"`
+}
+
+type strikePayment struct {
+	PaymentId           string       `json:"paymentId"`
+	State               string       `json:"state"`
+	LightningNetworkFee strikeAmount `json:"lightningNetworkFee"`
+	Lightning           struct {
+		Preimage   string       `json:"preimage"`
+		NetworkFee strikeAmount `json:"networkFee"`
+	} `json:"lightning"`
+}
+
+type strikeError struct {
+	Data struct {
+		Status  int    `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"data"`
+}
+
+func (s *StrikeClient) ConnectionStatus(ctx context.Context) error {
+	var balances []strikeAmount
+	return s.request(ctx, http.MethodGet, "/v1/balances", nil, &balances)
+}
+
+func (s *StrikeClient) Available(ctx context.Context) bool {
+	return available(s.httpClient)
+}
+
+func (s *StrikeClient) CreateInvoice(ctx context.Context, amount uint64) (Invoice, error) {
+	invoiceRequest := map[string]any{
+		"description": "",
+		"amount":      strikeAmount{Amount: satsToBTC(amount), Currency: "BTC"},
+	}
+	var invoice strikeInvoice
+	if err := s.request(ctx, http.MethodPost, "/v1/invoices", invoiceRequest, &invoice); err != nil {
+		return Invoice{}, err
+	}
+
+	var quote strikeInvoiceQuote
+	if err := s.request(ctx, http.MethodPost, "/v1/invoices/"+invoice.InvoiceId+"/quote", nil, &quote); err != nil {
+		return Invoice{}, err
+	}
+
+	bolt11, err := decodepay.Decodepay(quote.LnInvoice)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("invalid invoice from strike: %v", err)
+	}
+
+	s.mu.Lock()
+	s.invoiceIds[bolt11.PaymentHash] = invoice.InvoiceId
+	s.mu.Unlock()
+
+	return Invoice{
+		PaymentRequest: quote.LnInvoice,
+		PaymentHash:    bolt11.PaymentHash,
+		Amount:         amount,
+		Expiry:         quote.ExpirationInSec,
+	}, nil
+}
+
+func (s *StrikeClient) InvoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	return s.invoiceStatus(ctx, hash)
+}
+
+func (s *StrikeClient) invoiceStatus(ctx context.Context, hash string) (Invoice, error) {
+	s.mu.RLock()
+	invoiceId, ok := s.invoiceIds[hash]
+	s.mu.RUnlock()
+	if !ok {
+		return Invoice{}, fmt.Errorf("no strike invoice found for hash '%v'", hash)
+	}
+
+	var invoice strikeInvoice
+	if err := s.request(ctx, http.MethodGet, "/v1/invoices/"+invoiceId, nil, &invoice); err != nil {
+		return Invoice{}, err
+	}
+	amount, err := btcToSats(invoice.Amount.Amount)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	return Invoice{
+		PaymentHash: hash,
+		Settled:     invoice.State == "PAID",
+		Amount:      amount,
+	}, nil
+}
+
+func (s *StrikeClient) SendPayment(ctx context.Context, request string, maxFee uint64) (PaymentStatus, error) {
+	bolt11, err := decodepay.Decodepay(request)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, fmt.Errorf("error decoding invoice: %v", err)
+	}
+
+	quoteRequest := map[string]string{
+		"lnInvoice":      request,
+		"sourceCurrency": "BTC",
+	}
+	var quote strikePaymentQuote
+	if err := s.request(ctx, http.MethodPost, "/v1/payment-quotes/lightning", quoteRequest, &quote); err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	fee, err := btcToSats(quote.LightningNetworkFee.Amount)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	if fee > maxFee {
+		return PaymentStatus{PaymentStatus: Failed},
+			fmt.Errorf("fee of %v sats is over max fee of %v sats", fee, maxFee)
+	}
+
+	var payment strikePayment
+	path := "/v1/payment-quotes/" + quote.PaymentQuoteId + "/execute"
+	if err := s.request(ctx, http.MethodPatch, path, nil, &payment); err != nil {
+		// if context deadline is exceeded, mark payment as pending
+		// if any other error, mark as failed
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	s.mu.Lock()
+	s.paymentIds[bolt11.PaymentHash] = payment.PaymentId
+	s.mu.Unlock()
+
+	return payment.toPaymentStatus()
+}
+
+func (s *StrikeClient) PayPartialAmount(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFee uint64,
+) (PaymentStatus, error) {
+	return PaymentStatus{PaymentStatus: Failed}, errors.New("strike does not support paying partial amounts")
+}
+
+func (s *StrikeClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	s.mu.RLock()
+	paymentId, ok := s.paymentIds[hash]
+	s.mu.RUnlock()
+	if !ok {
+		return PaymentStatus{PaymentStatus: Failed}, fmt.Errorf("no strike payment found for hash '%v'", hash)
+	}
+
+	var payment strikePayment
+	if err := s.request(ctx, http.MethodGet, "/v1/payments/"+paymentId, nil, &payment); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+
+	return payment.toPaymentStatus()
+}
+
+func (payment strikePayment) toPaymentStatus() (PaymentStatus, error) {
+	switch payment.State {
+	case "COMPLETED":
+		fee := payment.Lightning.NetworkFee.Amount
+		if len(fee) == 0 {
+			fee = payment.LightningNetworkFee.Amount
+		}
+		feeSats, _ := btcToSats(fee)
+		return PaymentStatus{
+			Preimage:      payment.Lightning.Preimage,
+			PaymentStatus: Succeeded,
+			FeeMsat:       feeSats * 1000,
+		}, nil
+	case "FAILED":
+		return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: "payment failed"}, nil
+	default:
+		return PaymentStatus{PaymentStatus: Pending}, nil
+	}
+}
+
+func (s *StrikeClient) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * FeePercent)
+	return uint64(fee)
+}
+
+func (s *StrikeClient) SubscribeInvoice(ctx context.Context, paymentHash string) (InvoiceSubscriptionClient, error) {
+	return &StrikeInvoiceSub{
+		ctx:         ctx,
+		paymentHash: paymentHash,
+		client:      s,
+	}, nil
+}
+
+// StrikeInvoiceSub polls the state of the invoice until it gets paid.
+type StrikeInvoiceSub struct {
+	ctx         context.Context
+	paymentHash string
+	client      *StrikeClient
+}
+
+func (sub *StrikeInvoiceSub) Recv() (Invoice, error) {
+	ticker := time.NewTicker(StrikePollInterval)
+	defer ticker.Stop()
+
+	for {
+		invoice, err := sub.client.invoiceStatus(sub.ctx, sub.paymentHash)
+		if err != nil {
+			return Invoice{}, err
+		}
+		if invoice.Settled {
+			return invoice, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-sub.ctx.Done():
+			return Invoice{}, sub.ctx.Err()
+		}
+	}
+}
+
+func (s *StrikeClient) request(ctx context.Context, method, path string, reqBody any, dst any) error {
+	var body io.Reader
+	if reqBody != nil {
+		jsonBody, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errRes strikeError
+		if err := json.Unmarshal(respBody, &errRes); err == nil && len(errRes.Data.Code) > 0 {
+			return fmt.Errorf("strike error (%v): %v", errRes.Data.Code, errRes.Data.Message)
+		}
+		return fmt.Errorf("strike error (%v): %s", resp.StatusCode, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, dst); err != nil {
+		return fmt.Errorf("error reading response from strike: %v", err)
+	}
+	return nil
+}
+
+// satsToBTC formats an amount in sats as a BTC decimal string
+func satsToBTC(sats uint64) string {
+	return fmt.Sprintf("%d.%08d", sats/100_000_000, sats%100_000_000)
+}
+
+// btcToSats parses a BTC decimal string into sats
+func btcToSats(btc string) (uint64, error) {
+	if len(btc) == 0 {
+		return 0, nil
+	}
+	whole, fraction, _ := strings.Cut(btc, ".")
+	if len(fraction) > 8 {
+		return 0, fmt.Errorf("invalid BTC amount '%v'", btc)
+	}
+	fraction += strings.Repeat("0", 8-len(fraction))
+
+	wholeSats, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid BTC amount '%v'", btc)
+	}
+	fractionSats, err := strconv.ParseUint(fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid BTC amount '%v'", btc)
+	}
+	return wholeSats*100_000_000 + fractionSats, nil
+}
@@ -0,0 +1,157 @@
+package lightning
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const strikeFixturesPath = "testdata/strike"
+
+// strike fixtures follow the shape of responses from the Strike API
+func serveStrikeFixture(t *testing.T, name string, statusCode int) http.HandlerFunc {
+	fixture, err := os.ReadFile(filepath.Join(strikeFixturesPath, name))
+	if err != nil {
+		t.Fatalf("error reading fixture: %v", err)
+	}
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer test-api-key" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(statusCode)
+		rw.Write(fixture)
+	}
+}
+
+func setupStrikeTest(t *testing.T, failPayments bool) *StrikeClient {
+	invoiceId := "b1e0a1c6-3d5b-4e2f-9b6a-6f1d2c3e4a5b"
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/invoices", serveStrikeFixture(t, "create_invoice.json", http.StatusCreated))
+	mux.Handle("POST /v1/invoices/"+invoiceId+"/quote", serveStrikeFixture(t, "invoice_quote.json", http.StatusCreated))
+	mux.Handle("GET /v1/invoices/"+invoiceId, serveStrikeFixture(t, "invoice_paid.json", http.StatusOK))
+	mux.Handle("POST /v1/payment-quotes/lightning", serveStrikeFixture(t, "payment_quote.json", http.StatusCreated))
+	if failPayments {
+		mux.Handle("PATCH /v1/payment-quotes/{id}/execute",
+			serveStrikeFixture(t, "error_insufficient_balance.json", http.StatusUnprocessableEntity))
+	} else {
+		mux.Handle("PATCH /v1/payment-quotes/{id}/execute", serveStrikeFixture(t, "execute_payment.json", http.StatusOK))
+		mux.Handle("GET /v1/payments/{id}", serveStrikeFixture(t, "execute_payment.json", http.StatusOK))
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := SetupStrikeClient(StrikeConfig{APIKey: "test-api-key", APIURL: server.URL})
+	if err != nil {
+		t.Fatalf("error setting up strike client: %v", err)
+	}
+	return client
+}
+
+func TestStrikeClient(t *testing.T) {
+	client := setupStrikeTest(t, false)
+
+	invoice, err := client.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	expectedHash := "0a1f23179d77a00af3ef6d87ac99a4fc2b29692acc39c5c98f5170fd59eb7705"
+	if invoice.PaymentHash != expectedHash {
+		t.Fatalf("expected payment hash '%v' but got '%v'", expectedHash, invoice.PaymentHash)
+	}
+
+	status, err := client.InvoiceStatus(context.Background(), invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if !status.Settled {
+		t.Fatal("expected settled invoice")
+	}
+	if status.Amount != 2100 {
+		t.Fatalf("expected amount of %v but got %v", 2100, status.Amount)
+	}
+
+	if _, err := client.InvoiceStatus(context.Background(), "unknownhash"); err == nil {
+		t.Fatal("expected error for unknown invoice")
+	}
+
+	// quote in fixture has fee of 5 sats
+	_, err = client.SendPayment(context.Background(), invoice.PaymentRequest, 4)
+	if err == nil {
+		t.Fatal("expected error paying with max fee below fee from quote")
+	}
+
+	payment, err := client.SendPayment(context.Background(), invoice.PaymentRequest, 5)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if payment.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, payment.PaymentStatus)
+	}
+	if payment.FeeMsat != 5000 {
+		t.Fatalf("expected fee of %v msat but got %v", 5000, payment.FeeMsat)
+	}
+
+	outgoing, err := client.OutgoingPaymentStatus(context.Background(), invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if outgoing.PaymentStatus != Succeeded {
+		t.Fatalf("expected payment status '%v' but got '%v'", Succeeded, outgoing.PaymentStatus)
+	}
+}
+
+func TestStrikePaymentError(t *testing.T) {
+	client := setupStrikeTest(t, true)
+
+	invoice, err := client.CreateInvoice(context.Background(), 2100)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+
+	payment, err := client.SendPayment(context.Background(), invoice.PaymentRequest, 10)
+	if err == nil || !strings.Contains(err.Error(), "BALANCE_TOO_LOW") {
+		t.Fatalf("expected BALANCE_TOO_LOW error but got '%v'", err)
+	}
+	if payment.PaymentStatus != Failed {
+		t.Fatalf("expected payment status '%v' but got '%v'", Failed, payment.PaymentStatus)
+	}
+}
+
+func TestBTCAmounts(t *testing.T) {
+	tests := []struct {
+		sats uint64
+		btc  string
+	}{
+		{sats: 0, btc: "0.00000000"},
+		{sats: 1, btc: "0.00000001"},
+		{sats: 2100, btc: "0.00002100"},
+		{sats: 123_456_789, btc: "1.23456789"},
+	}
+
+	for _, test := range tests {
+		if btc := satsToBTC(test.sats); btc != test.btc {
+			t.Fatalf("expected '%v' but got '%v'", test.btc, btc)
+		}
+		sats, err := btcToSats(test.btc)
+		if err != nil {
+			t.Fatalf("unexpected error parsing '%v': %v", test.btc, err)
+		}
+		if sats != test.sats {
+			t.Fatalf("expected %v sats but got %v", test.sats, sats)
+		}
+	}
+
+	if sats, _ := btcToSats("0.5"); sats != 50_000_000 {
+		t.Fatalf("expected %v sats but got %v", 50_000_000, sats)
+	}
+	if _, err := btcToSats("0.000000001"); err == nil {
+		t.Fatal("expected error for amount with more than 8 decimals")
+	}
+}
@@ -1,15 +1,18 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
 )
 
 const (
@@ -22,6 +25,12 @@ const (
 	TOTAL_BALANCE          = "total_balance"
 	LIST_KEYSETS           = "list_keysets"
 	ROTATE_KEYSET          = "rotate_keyset"
+	LIGHTNING_BACKENDS     = "lightning_backends"
+	LIGHTNING_NODE_INFO    = "lightning_node_info"
+	BACKUP_DB              = "backup_db"
+	PRUNE_DATA             = "prune_data"
+	RECONCILE_QUOTES       = "reconcile_quotes"
+	VERSION                = "version"
 )
 
 type Server struct {
@@ -174,6 +183,11 @@ type KeysetRedeemed struct {
 	AmountRedeemed uint64 `json:"amount_redeemed"`
 }
 
+type NodeInfoResponse struct {
+	lightning.NodeInfo
+	lightning.ChannelBalances
+}
+
 type TotalBalanceResponse struct {
 	TotalIssued        IssuedEcashResponse   `json:"total_issued"`
 	TotalRedeemed      RedeemedEcashResponse `json:"total_redeemed"`
@@ -199,6 +213,43 @@ func (s *Server) processRequest(req Request) (Response, *Error) {
 	case ROTATE_KEYSET:
 		return s.handleRotateKeyset(req)
 
+	case LIGHTNING_BACKENDS:
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		backends := s.mint.LightningBackendHealth(ctx)
+		result, _ := json.Marshal(backends)
+		return NewResponse(result, req.Id), nil
+
+	case LIGHTNING_NODE_INFO:
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		info, balances, err := s.mint.LightningNodeInfo(ctx)
+		if err != nil {
+			return Response{}, &Error{Code: -32000, Message: err.Error()}
+		}
+		result, _ := json.Marshal(NodeInfoResponse{NodeInfo: info, ChannelBalances: balances})
+		return NewResponse(result, req.Id), nil
+
+	case BACKUP_DB:
+		return s.handleBackupDB(req)
+
+	case PRUNE_DATA:
+		return s.handlePruneData(req)
+
+	case RECONCILE_QUOTES:
+		// each quote can take up to the lightning request timeout
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+		defer cancel()
+		report, err := s.mint.Reconcile(ctx)
+		if err != nil {
+			return Response{}, &Error{Code: -32000, Message: err.Error()}
+		}
+		result, _ := json.Marshal(report)
+		return NewResponse(result, req.Id), nil
+
+	case VERSION:
+		return s.handleVersion(req)
+
 	default:
 		return Response{}, &Error{Code: -32601, Message: "invalid method"}
 	}
@@ -301,6 +352,76 @@ func (s *Server) handleRotateKeyset(req Request) (Response, *Error) {
 	}
 }
 
+type BackupResponse struct {
+	Path string `json:"path"`
+}
+
+func (s *Server) handleBackupDB(req Request) (Response, *Error) {
+	if len(req.Params) < 1 {
+		return Response{}, &Error{-32000, "backup path not included"}
+	}
+
+	// path is relative to the mint process, not the caller
+	path := req.Params[0]
+	if !filepath.IsAbs(path) {
+		return Response{}, &Error{-32000, "backup path needs to be absolute"}
+	}
+
+	if err := s.mint.BackupDB(path); err != nil {
+		return Response{}, &Error{-32000, err.Error()}
+	}
+
+	result, _ := json.Marshal(BackupResponse{Path: path})
+	return NewResponse(result, req.Id), nil
+}
+
+type PruneDataResponse struct {
+	DryRun          bool  `json:"dry_run"`
+	MintQuotes      int64 `json:"mint_quotes"`
+	MeltQuotes      int64 `json:"melt_quotes"`
+	BlindSignatures int64 `json:"blind_signatures"`
+}
+
+// handlePruneData deletes the data older than the retention policy of the mint.
+// If the first param is "dryrun" it only reports what would be deleted.
+func (s *Server) handlePruneData(req Request) (Response, *Error) {
+	dryRun := len(req.Params) > 0 && req.Params[0] == "dryrun"
+
+	pruned, err := s.mint.PruneData(dryRun)
+	if err != nil {
+		return Response{}, &Error{-32000, err.Error()}
+	}
+
+	result, _ := json.Marshal(PruneDataResponse{
+		DryRun:          dryRun,
+		MintQuotes:      pruned.MintQuotes,
+		MeltQuotes:      pruned.MeltQuotes,
+		BlindSignatures: pruned.BlindSignatures,
+	})
+	return NewResponse(result, req.Id), nil
+}
+
+type VersionResponse struct {
+	Version string `json:"version"`
+	// not set if the db does not have a versioned schema
+	SchemaVersion *uint `json:"schema_version,omitempty"`
+}
+
+func (s *Server) handleVersion(req Request) (Response, *Error) {
+	versionResponse := VersionResponse{Version: mint.Version}
+
+	schemaVersion, ok, err := s.mint.DBSchemaVersion()
+	if err != nil {
+		return Response{}, &Error{-32000, fmt.Sprintf("unable to get db schema version: %v", err)}
+	}
+	if ok {
+		versionResponse.SchemaVersion = &schemaVersion
+	}
+
+	result, _ := json.Marshal(versionResponse)
+	return NewResponse(result, req.Id), nil
+}
+
 func (s *Server) issuedEcash() (IssuedEcashResponse, error) {
 	issuedEcashMap, err := s.mint.IssuedEcash()
 	if err != nil {
@@ -2,6 +2,7 @@ package mint
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
@@ -12,15 +13,14 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"reflect"
 	"runtime"
 	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
-	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut01"
@@ -31,13 +31,14 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
-	"github.com/elnosh/gonuts/cashu/nuts/nut14"
 	"github.com/elnosh/gonuts/cashu/nuts/nut17"
 	"github.com/elnosh/gonuts/cashu/nuts/nut20"
 	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/internal/keys"
 	"github.com/elnosh/gonuts/mint/lightning"
 	"github.com/elnosh/gonuts/mint/pubsub"
 	"github.com/elnosh/gonuts/mint/storage"
+	"github.com/elnosh/gonuts/mint/storage/inmem"
 	"github.com/elnosh/gonuts/mint/storage/sqlite"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
 	"google.golang.org/grpc/codes"
@@ -45,11 +46,29 @@ import (
 )
 
 const (
+	// Version of gonuts reported in the mint info
+	Version = "0.4.0"
+
 	QuoteExpiryMins = 10
+
+	// max time to wait for the lightning backend
+	// on requests that are not payments
+	lightningRequestTimeout = time.Second * 30
+
+	// the fee estimated by probing routes is increased by this percentage
+	// for the fee reserve since fees can change before the invoice is paid
+	feeEstimateBufferPercent = 25
+	// min fee reserve in msat when it is set from an estimate
+	minEstimatedFeeReserveMsat = 2000
 )
 
 type Mint struct {
 	db storage.MintDB
+	// used for reads that can be served by a read replica that lags the
+	// primary db. State of proofs is never read from it since NUT-07 checks
+	// need to see spent proofs right away. It is the same as db if the
+	// mint does not have a replica.
+	reader storage.MintDBReader
 
 	// active keyset
 	activeKeyset *crypto.MintKeyset
@@ -57,20 +76,44 @@ type Mint struct {
 	// map of all keysets (both active and inactive)
 	keysets map[string]crypto.MintKeyset
 
+	// key derived from the seed used to sign info and keys responses.
+	// Its public key is the one advertised in the mint info
+	signingKey *secp256k1.PrivateKey
+	// key derived from the seed used to derive keysend preimages
+	keysendKey []byte
+
 	lightningClient lightning.Client
 	mintInfo        nut06.MintInfo
 	limits          MintLimits
 	logger          *slog.Logger
 	mppEnabled      bool
 
+	// payment hashes of melts currently being processed
+	inflightPayments *lightning.InflightPayments
+
+	// verifiers for the NUT-10 spending conditions supported by the mint
+	spendingConditions map[nut10.SecretKind]SpendingConditionVerifier
+
+	retention RetentionPolicy
+
+	// set while the mint server is accepting requests
+	serving atomic.Bool
+
 	publisher *pubsub.PubSub
 	ctx       context.Context
 	cancel    context.CancelFunc
 }
 
 func LoadMint(config Config) (*Mint, error) {
+	if err := config.Limits.validate(); err != nil {
+		return nil, err
+	}
+
 	path := config.MintPath
-	if err := os.MkdirAll(path, 0700); err != nil {
+	// the in-memory db does not use the mint directory and logs only go to stdout
+	if config.DBDriver == Memory {
+		path = ""
+	} else if err := os.MkdirAll(path, 0700); err != nil {
 		return nil, err
 	}
 
@@ -79,15 +122,19 @@ func LoadMint(config Config) (*Mint, error) {
 		return nil, err
 	}
 
-	db, err := sqlite.InitSQLite(path)
+	db, err := openDB(config.DBDriver, path, config.DBMigrationPath)
 	if err != nil {
-		return nil, fmt.Errorf("error setting up sqlite: %v", err)
+		return nil, err
+	}
+	reader, err := openReadReplica(config.DBDriver, config.DBReadReplicaPath, db)
+	if err != nil {
+		return nil, err
 	}
 
 	seed, err := db.GetSeed()
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			seed, err = hdkeychain.GenerateSeed(32)
+			seed, err = keys.NewSeed()
 			if err != nil {
 				return nil, err
 			}
@@ -99,7 +146,15 @@ func LoadMint(config Config) (*Mint, error) {
 		}
 	}
 
-	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	defer crypto.ZeroBytes(seed)
+
+	master, err := keys.NewMaster(seed)
+	if err != nil {
+		return nil, err
+	}
+	// keys needed are derived below, master is not kept after that
+	defer crypto.ZeroExtendedKey(master)
+	signingKey, keysendKey, err := deriveMintKeys(master)
 	if err != nil {
 		return nil, err
 	}
@@ -109,16 +164,30 @@ func LoadMint(config Config) (*Mint, error) {
 		return nil, fmt.Errorf("error reading keysets from db: %v", err)
 	}
 
+	spendingConditions := defaultSpendingConditions()
+	for kind, verifier := range config.SpendingConditions {
+		if !nut10.IsRegistered(kind) {
+			return nil, fmt.Errorf("spending condition for secret kind %d that is not registered in nut10", kind)
+		}
+		spendingConditions[kind] = verifier
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	mint := &Mint{
-		db:         db,
-		keysets:    make(map[string]crypto.MintKeyset, len(dbKeysets)),
-		limits:     config.Limits,
-		logger:     logger,
-		mppEnabled: config.EnableMPP,
-		publisher:  pubsub.NewPubSub(),
-		ctx:        ctx,
-		cancel:     cancel,
+		db:                 db,
+		reader:             reader,
+		keysets:            make(map[string]crypto.MintKeyset, len(dbKeysets)),
+		signingKey:         signingKey,
+		keysendKey:         keysendKey,
+		limits:             config.Limits,
+		logger:             logger,
+		mppEnabled:         config.EnableMPP,
+		inflightPayments:   lightning.NewInflightPayments(),
+		spendingConditions: spendingConditions,
+		retention:          config.Retention,
+		publisher:          pubsub.NewPubSub(),
+		ctx:                ctx,
+		cancel:             cancel,
 	}
 
 	// if no keysets stored, just create a new one
@@ -172,15 +241,88 @@ func LoadMint(config Config) (*Mint, error) {
 	if config.LightningClient == nil {
 		return nil, errors.New("invalid lightning client")
 	}
-	if err := config.LightningClient.ConnectionStatus(); err != nil {
+	connCtx, cancelConn := context.WithTimeout(mint.ctx, lightningRequestTimeout)
+	defer cancelConn()
+	if err := config.LightningClient.ConnectionStatus(connCtx); err != nil {
 		return nil, fmt.Errorf("can't connect to lightning backend: %v", err)
 	}
 	mint.lightningClient = config.LightningClient
 	mint.SetMintInfo(config.MintInfo)
 
+	// if backend can stream invoice updates, use a single
+	// subscription instead of one for each invoice
+	if subscriber, ok := config.LightningClient.(lightning.InvoicesSubscriber); ok {
+		go mint.watchInvoices(mint.ctx, subscriber)
+	}
+
+	if config.Retention.enabled() {
+		go mint.pruneDataPeriodically(mint.ctx)
+	}
+
+	if config.ReconcileInterval > 0 {
+		go mint.reconcileQuotesPeriodically(mint.ctx, config.ReconcileInterval)
+	}
+
 	return mint, nil
 }
 
+func openDB(driver DBDriver, path, migrationPath string) (storage.MintDB, error) {
+	switch driver {
+	case SQLite, "":
+		db, err := sqlite.InitSQLiteWithMigrations(path, migrationPath)
+		if err != nil {
+			return nil, fmt.Errorf("error setting up sqlite: %v", err)
+		}
+		return db, nil
+	case Memory:
+		return inmem.NewInMemoryDB(), nil
+	default:
+		return nil, fmt.Errorf("unknown db driver '%v'", driver)
+	}
+}
+
+// openReadReplica opens the read-only replica in path. If path is empty,
+// reads go to the primary db.
+func openReadReplica(driver DBDriver, path string, primary storage.MintDB) (storage.MintDBReader, error) {
+	if len(path) == 0 {
+		return primary, nil
+	}
+	if driver != SQLite && driver != "" {
+		return nil, fmt.Errorf("read replica is not supported for db driver '%v'", driver)
+	}
+
+	replica, err := sqlite.OpenReadReplica(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening db read replica: %v", err)
+	}
+
+	// replica might not be synced yet with migrations applied to the primary
+	versioner, ok := primary.(storage.SchemaVersioner)
+	if !ok {
+		replica.Close()
+		return nil, errors.New("primary db does not have a versioned schema to compare with the read replica")
+	}
+	primaryVersion, err := versioner.SchemaVersion()
+	if err != nil {
+		replica.Close()
+		return nil, fmt.Errorf("error reading db schema version: %v", err)
+	}
+	replicaVersion, err := replica.SchemaVersion()
+	if err != nil {
+		replica.Close()
+		return nil, fmt.Errorf("error reading schema version of db read replica: %v", err)
+	}
+	if replicaVersion != primaryVersion {
+		replica.Close()
+		return nil, fmt.Errorf("db read replica has schema version %v but primary db has %v",
+			replicaVersion, primaryVersion)
+	}
+
+	return replica, nil
+}
+
+// setupLogger logs to stdout and to a mint.log file in mintPath.
+// If mintPath is empty it only logs to stdout.
 func setupLogger(mintPath string, logLevel LogLevel) (*slog.Logger, error) {
 	replacer := func(groups []string, a slog.Attr) slog.Attr {
 		if a.Key == slog.SourceKey {
@@ -193,12 +335,14 @@ func setupLogger(mintPath string, logLevel LogLevel) (*slog.Logger, error) {
 		return a
 	}
 
-	logFile, err := os.OpenFile(filepath.Join(mintPath, "mint.log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
-	if err != nil {
-		return nil, fmt.Errorf("error opening log file: %v", err)
+	var logWriter io.Writer = os.Stdout
+	if len(mintPath) > 0 {
+		logFile, err := os.OpenFile(filepath.Join(mintPath, "mint.log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening log file: %v", err)
+		}
+		logWriter = io.MultiWriter(os.Stdout, logFile)
 	}
-
-	logWriter := io.MultiWriter(os.Stdout, logFile)
 	level := slog.LevelInfo
 	switch logLevel {
 	case Debug:
@@ -242,8 +386,18 @@ func (m *Mint) logDebugf(format string, args ...any) {
 	_ = m.logger.Handler().Handle(context.Background(), r)
 }
 
+// Shutdown stops the mint, closes the db and zeroes the private keys
+// held in memory
 func (m *Mint) Shutdown() error {
 	m.cancel()
+	if replica, ok := m.reader.(io.Closer); ok && m.reader != m.db {
+		replica.Close()
+	}
+	for _, keyset := range m.keysets {
+		keyset.Zero()
+	}
+	crypto.ZeroPrivateKeys(m.signingKey)
+	crypto.ZeroBytes(m.keysendKey)
 	return m.db.Close()
 }
 
@@ -251,7 +405,7 @@ func (m *Mint) Shutdown() error {
 // and returns a mint quote or an error.
 // The request to mint a token is explained in
 // NUT-04 here: https://github.com/cashubtc/nuts/blob/main/04.md.
-func (m *Mint) RequestMintQuote(mintQuoteRequest nut04.PostMintQuoteBolt11Request) (storage.MintQuote, error) {
+func (m *Mint) RequestMintQuote(ctx context.Context, mintQuoteRequest nut04.PostMintQuoteBolt11Request) (storage.MintQuote, error) {
 	// only support sat unit
 	if mintQuoteRequest.Unit != cashu.Sat.String() {
 		errmsg := fmt.Sprintf("unit '%v' not supported", mintQuoteRequest.Unit)
@@ -280,6 +434,9 @@ func (m *Mint) RequestMintQuote(mintQuoteRequest nut04.PostMintQuoteBolt11Reques
 			return storage.MintQuote{}, cashu.MintAmountExceededErr
 		}
 	}
+	if requestAmount < m.limits.MintingSettings.MinAmount {
+		return storage.MintQuote{}, cashu.MintAmountBelowMinErr
+	}
 	if m.limits.MaxBalance > 0 {
 		balance, err := m.TotalBalance()
 		if err != nil {
@@ -291,19 +448,23 @@ func (m *Mint) RequestMintQuote(mintQuoteRequest nut04.PostMintQuoteBolt11Reques
 		}
 	}
 
+	quoteId, err := cashu.GenerateRandomQuoteId()
+	if err != nil {
+		m.logErrorf("error generating random quote id: %v", err)
+		return storage.MintQuote{}, cashu.StandardErr
+	}
+
 	// get an invoice from the lightning backend
 	m.logInfof("requesting invoice from lightning backend for %v sats", requestAmount)
-	invoice, err := m.requestInvoice(requestAmount)
+	invoice, err := m.requestInvoice(lightning.WithQuoteId(ctx, quoteId), requestAmount)
 	if err != nil {
+		if errors.Is(err, lightning.ErrBackendUnavailable) {
+			m.logErrorf("refusing mint quote. Lightning backend is unavailable")
+			return storage.MintQuote{}, cashu.LightningBackendUnavailable
+		}
 		errmsg := fmt.Sprintf("could not generate invoice: %v", err)
 		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
 	}
-
-	quoteId, err := cashu.GenerateRandomQuoteId()
-	if err != nil {
-		m.logErrorf("error generating random quote id: %v", err)
-		return storage.MintQuote{}, cashu.StandardErr
-	}
 	mintQuote := storage.MintQuote{
 		Id:             quoteId,
 		Amount:         requestAmount,
@@ -320,14 +481,17 @@ func (m *Mint) RequestMintQuote(mintQuoteRequest nut04.PostMintQuoteBolt11Reques
 		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 	}
 
-	// goroutine to check in the background when invoice gets paid and update db if so
-	go m.checkInvoicePaid(m.ctx, quoteId)
+	// goroutine to check in the background when invoice gets paid and update db if so.
+	// Not needed if the backend streams updates for all invoices.
+	if _, ok := m.lightningClient.(lightning.InvoicesSubscriber); !ok {
+		go m.checkInvoicePaid(m.ctx, quoteId)
+	}
 
 	return mintQuote, nil
 }
 
 // GetMintQuoteState returns the state of a mint quote.
-func (m *Mint) GetMintQuoteState(quoteId string) (storage.MintQuote, error) {
+func (m *Mint) GetMintQuoteState(ctx context.Context, quoteId string) (storage.MintQuote, error) {
 	mintQuote, err := m.db.GetMintQuote(quoteId)
 	if err != nil {
 		return storage.MintQuote{}, cashu.QuoteNotExistErr
@@ -336,7 +500,9 @@ func (m *Mint) GetMintQuoteState(quoteId string) (storage.MintQuote, error) {
 	// if previously unpaid, check if invoice has been paid
 	if mintQuote.State == nut04.Unpaid {
 		m.logDebugf("checking status of invoice with hash '%v'", mintQuote.PaymentHash)
-		status, err := m.lightningClient.InvoiceStatus(mintQuote.PaymentHash)
+		ctx, cancel := context.WithTimeout(ctx, lightningRequestTimeout)
+		defer cancel()
+		status, err := m.lightningClient.InvoiceStatus(ctx, mintQuote.PaymentHash)
 		if err != nil {
 			errmsg := fmt.Sprintf("error getting invoice status: %v", err)
 			return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
@@ -361,8 +527,8 @@ func (m *Mint) GetMintQuoteState(quoteId string) (storage.MintQuote, error) {
 
 // MintTokens verifies whether the mint quote with id has been paid and proceeds to
 // sign the blindedMessages and return the BlindedSignatures if it was paid.
-func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.BlindedSignatures, error) {
-	mintQuote, err := m.GetMintQuoteState(mintTokensRequest.Quote)
+func (m *Mint) MintTokens(ctx context.Context, mintTokensRequest nut04.PostMintBolt11Request) (cashu.BlindedSignatures, error) {
+	mintQuote, err := m.GetMintQuoteState(ctx, mintTokensRequest.Quote)
 	if err != nil {
 		return nil, err
 	}
@@ -391,8 +557,8 @@ func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.
 				return cashu.InvalidBlindedMessageAmount
 			}
 
-			if cashu.CheckDuplicateBlindedMessages(blindedMessages) {
-				return cashu.DuplicateOutputs
+			if err := blindedMessages.Validate(); err != nil {
+				return err
 			}
 
 			// verify that amount from blinded messages is enough
@@ -498,8 +664,8 @@ func (m *Mint) Swap(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages)
 		return nil, cashu.InvalidBlindedMessageAmount
 	}
 
-	if cashu.CheckDuplicateBlindedMessages(blindedMessages) {
-		return nil, cashu.DuplicateOutputs
+	if err := blindedMessages.Validate(); err != nil {
+		return nil, err
 	}
 
 	B_s := make([]string, len(blindedMessages))
@@ -529,10 +695,10 @@ func (m *Mint) Swap(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages)
 		return nil, cashu.BlindedMessageAlreadySigned
 	}
 
-	// if sig all, verify signatures in blinded messages
+	// if sig all, verify signatures on the inputs and outputs
 	if nut11.ProofsSigAll(proofs) {
-		m.logDebugf("locked proofs have SIG_ALL flag. Verifying blinded messages")
-		if err := verifyBlindedMessages(proofs, blindedMessages); err != nil {
+		m.logDebugf("locked proofs have SIG_ALL flag. Verifying signatures on inputs and outputs")
+		if err := nut11.VerifySigAll(proofs, blindedMessages); err != nil {
 			return nil, err
 		}
 	}
@@ -560,7 +726,7 @@ func (m *Mint) Swap(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages)
 
 // RequestMeltQuote will process a request to melt tokens and return a MeltQuote.
 // A melt is requested by a wallet to request the mint to pay an invoice.
-func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Request) (storage.MeltQuote, error) {
+func (m *Mint) RequestMeltQuote(ctx context.Context, meltQuoteRequest nut05.PostMeltQuoteBolt11Request) (storage.MeltQuote, error) {
 	if meltQuoteRequest.Unit != cashu.Sat.String() {
 		errmsg := fmt.Sprintf("unit '%v' not supported", meltQuoteRequest.Unit)
 		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.UnitErrCode)
@@ -576,8 +742,9 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 	if bolt11.MSatoshi == 0 {
 		return storage.MeltQuote{}, cashu.BuildCashuError("invoice has no amount", cashu.MeltQuoteErrCode)
 	}
-	invoiceSatAmount := uint64(bolt11.MSatoshi) / 1000
-	quoteAmount := invoiceSatAmount
+	// amounts are tracked in msat and only rounded up to
+	// sats for the amount of ecash needed to pay the quote
+	amountMsat := uint64(bolt11.MSatoshi)
 
 	// check if a mint quote exists with the same invoice.
 	_, err = m.db.GetMintQuoteByPaymentHash(bolt11.PaymentHash)
@@ -587,7 +754,6 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 	}
 
 	isMpp := false
-	var amountMsat uint64 = 0
 	// check mpp option
 	if len(meltQuoteRequest.Options) > 0 {
 		mpp, ok := meltQuoteRequest.Options["mpp"]
@@ -607,9 +773,8 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 				}
 				isMpp = true
 				amountMsat = mpp.AmountMsat
-				quoteAmount = amountMsat / 1000
-				m.logInfof("got melt quote request to pay partial amount '%v' of invoice with amount '%v'",
-					quoteAmount, invoiceSatAmount)
+				m.logInfof("got melt quote request to pay partial amount '%v' msat of invoice with amount '%v' msat",
+					amountMsat, bolt11.MSatoshi)
 			} else {
 				return storage.MeltQuote{},
 					cashu.BuildCashuError("MPP is not supported", cashu.MeltQuoteErrCode)
@@ -617,12 +782,17 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 		}
 	}
 
+	quoteAmount := msatToSat(amountMsat)
+
 	// check melt limit
 	if m.limits.MeltingSettings.MaxAmount > 0 {
 		if quoteAmount > m.limits.MeltingSettings.MaxAmount {
 			return storage.MeltQuote{}, cashu.MeltAmountExceededErr
 		}
 	}
+	if quoteAmount < m.limits.MeltingSettings.MinAmount {
+		return storage.MeltQuote{}, cashu.MeltAmountBelowMinErr
+	}
 
 	// check if a melt quote for the invoice already exists
 	quote, _ := m.db.GetMeltQuoteByPaymentRequest(request)
@@ -636,28 +806,128 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 		return storage.MeltQuote{}, cashu.StandardErr
 	}
 	// Fee reserve that is required by the mint
-	fee := m.lightningClient.FeeReserve(quoteAmount)
+	feeCtx, cancel := context.WithTimeout(ctx, lightningRequestTimeout)
+	defer cancel()
+	percentageFeeMsat := m.lightningClient.FeeReserve(feeCtx, amountMsat)
+	feeMsat := percentageFeeMsat
+	// if backend can probe routes, use a more accurate fee. Not for MPP
+	// since the probe would be for the full amount of the invoice.
+	var estimatedFeeMsat *uint64
+	if estimator, ok := m.lightningClient.(lightning.FeeEstimator); ok && !isMpp && !isInternal {
+		estimatedFee, err := estimator.EstimateFee(feeCtx, request)
+		if err != nil {
+			m.logDebugf("could not estimate fee for invoice. Using fee reserve of %v msat: %v", feeMsat, err)
+		} else {
+			estimatedFeeMsat = &estimatedFee
+			feeMsat = max(estimatedFee+estimatedFee*feeEstimateBufferPercent/100, minEstimatedFeeReserveMsat)
+			m.logDebugf("estimated fee of %v msat for invoice. Setting fee reserve to %v msat instead of percentage fee reserve of %v msat",
+				estimatedFee, feeMsat, percentageFeeMsat)
+		}
+	}
 	// if mint quote exists with same invoice, it can be
 	// settled internally so set the fee to 0
 	if isInternal {
 		m.logDebugf(`in melt quote request found mint quote with same invoice. 
 		Setting fee reserve to 0 because quotes can be settled internally.`)
-		fee = 0
+		feeMsat = 0
+		percentageFeeMsat = 0
 	}
 	meltQuote := storage.MeltQuote{
-		Id:             quoteId,
-		InvoiceRequest: request,
-		PaymentHash:    bolt11.PaymentHash,
-		Amount:         quoteAmount,
-		FeeReserve:     fee,
-		State:          nut05.Unpaid,
-		Expiry:         uint64(time.Now().Add(time.Minute * QuoteExpiryMins).Unix()),
-		IsMpp:          isMpp,
-		AmountMsat:     amountMsat,
+		Id:                       quoteId,
+		InvoiceRequest:           request,
+		PaymentHash:              bolt11.PaymentHash,
+		Amount:                   quoteAmount,
+		FeeReserve:               msatToSat(feeMsat),
+		State:                    nut05.Unpaid,
+		Expiry:                   uint64(time.Now().Add(time.Minute * QuoteExpiryMins).Unix()),
+		IsMpp:                    isMpp,
+		AmountMsat:               amountMsat,
+		FeeReserveMsat:           feeMsat,
+		PercentageFeeReserveMsat: percentageFeeMsat,
+		EstimatedFeeMsat:         estimatedFeeMsat,
+	}
+
+	m.logInfof("got melt quote request for invoice of amount '%v' msat. Setting fee reserve to %v",
+		amountMsat, meltQuote.FeeReserve)
+
+	if err := m.db.SaveMeltQuote(meltQuote); err != nil {
+		errmsg := fmt.Sprintf("error saving melt quote to db: %v", err)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 	}
 
-	m.logInfof("got melt quote request for invoice of amount '%v'. Setting fee reserve to %v",
-		invoiceSatAmount, meltQuote.FeeReserve)
+	return meltQuote, nil
+}
+
+// RequestKeysendMeltQuote will process a request to melt tokens by making
+// a keysend payment of the amount to the destination node without an invoice.
+func (m *Mint) RequestKeysendMeltQuote(
+	ctx context.Context,
+	meltQuoteRequest nut05.PostMeltQuoteKeysendRequest,
+) (storage.MeltQuote, error) {
+	if _, ok := m.lightningClient.(lightning.KeysendClient); !ok {
+		return storage.MeltQuote{}, cashu.PaymentMethodNotSupportedErr
+	}
+	if meltQuoteRequest.Unit != cashu.Sat.String() {
+		errmsg := fmt.Sprintf("unit '%v' not supported", meltQuoteRequest.Unit)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.UnitErrCode)
+	}
+
+	destination, err := hex.DecodeString(meltQuoteRequest.Request)
+	if err != nil {
+		return storage.MeltQuote{}, cashu.BuildCashuError("invalid destination", cashu.MeltQuoteErrCode)
+	}
+	if _, err := secp256k1.ParsePubKey(destination); err != nil {
+		errmsg := fmt.Sprintf("invalid destination: %v", err)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.MeltQuoteErrCode)
+	}
+	if meltQuoteRequest.Amount == 0 {
+		return storage.MeltQuote{}, cashu.BuildCashuError("amount cannot be 0", cashu.MeltQuoteErrCode)
+	}
+
+	// check melt limit
+	if m.limits.MeltingSettings.MaxAmount > 0 {
+		if meltQuoteRequest.Amount > m.limits.MeltingSettings.MaxAmount {
+			return storage.MeltQuote{}, cashu.MeltAmountExceededErr
+		}
+	}
+	if meltQuoteRequest.Amount < m.limits.MeltingSettings.MinAmount {
+		return storage.MeltQuote{}, cashu.MeltAmountBelowMinErr
+	}
+
+	quoteId, err := cashu.GenerateRandomQuoteId()
+	if err != nil {
+		m.logErrorf("error generating random quote id: %v", err)
+		return storage.MeltQuote{}, cashu.StandardErr
+	}
+	preimage, err := m.keysendPreimage(quoteId)
+	if err != nil {
+		m.logErrorf("error generating keysend preimage: %v", err)
+		return storage.MeltQuote{}, cashu.StandardErr
+	}
+	preimageBytes, _ := hex.DecodeString(preimage)
+	paymentHash := sha256.Sum256(preimageBytes)
+
+	amountMsat := meltQuoteRequest.Amount * 1000
+	feeCtx, cancel := context.WithTimeout(ctx, lightningRequestTimeout)
+	defer cancel()
+	feeMsat := m.lightningClient.FeeReserve(feeCtx, amountMsat)
+
+	meltQuote := storage.MeltQuote{
+		Id:                       quoteId,
+		InvoiceRequest:           meltQuoteRequest.Request,
+		PaymentHash:              hex.EncodeToString(paymentHash[:]),
+		Amount:                   meltQuoteRequest.Amount,
+		FeeReserve:               msatToSat(feeMsat),
+		State:                    nut05.Unpaid,
+		Expiry:                   uint64(time.Now().Add(time.Minute * QuoteExpiryMins).Unix()),
+		AmountMsat:               amountMsat,
+		FeeReserveMsat:           feeMsat,
+		Method:                   cashu.KEYSEND_METHOD,
+		PercentageFeeReserveMsat: feeMsat,
+	}
+
+	m.logInfof("got keysend melt quote request for amount '%v' to node '%v'. Setting fee reserve to %v",
+		meltQuote.Amount, meltQuote.InvoiceRequest, meltQuote.FeeReserve)
 
 	if err := m.db.SaveMeltQuote(meltQuote); err != nil {
 		errmsg := fmt.Sprintf("error saving melt quote to db: %v", err)
@@ -667,6 +937,18 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 	return meltQuote, nil
 }
 
+// keysendPreimage derives the preimage for a keysend melt quote from the
+// mint's keysend key so that it does not need to be stored before the payment.
+func (m *Mint) keysendPreimage(quoteId string) (string, error) {
+	if m.keysendKey == nil {
+		return "", errors.New("mint does not have a keysend key")
+	}
+	mac := hmac.New(sha256.New, m.keysendKey)
+	mac.Write([]byte("keysend"))
+	mac.Write([]byte(quoteId))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
 // GetMeltQuoteState returns the state of a melt quote.
 // Used to check whether a melt quote has been paid.
 func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.MeltQuote, error) {
@@ -680,55 +962,73 @@ func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.M
 		m.logDebugf("checking status of payment with hash '%v' for melt quote '%v'",
 			meltQuote.PaymentHash, meltQuote.Id)
 
-		paymentStatus, err := m.lightningClient.OutgoingPaymentStatus(ctx, meltQuote.PaymentHash)
+		paymentStatus, err := m.lightningClient.OutgoingPaymentStatus(paymentContext(ctx, meltQuote), meltQuote.PaymentHash)
 		if err != nil {
 			m.logErrorf(`error checking outgoing payment status: %v. Leaving proofs for quote '%v' as pending`,
 				err, meltQuote.Id)
 			return meltQuote, nil
 		}
 
-		switch paymentStatus.PaymentStatus {
-		// settle proofs (remove pending, and add to used)
-		// mark quote as paid and set preimage
-		case lightning.Succeeded:
-			m.logInfof("payment %v succeded. setting melt quote '%v' to paid and invalidating proofs",
-				meltQuote.PaymentHash, meltQuote.Id)
+		return m.updatePendingMeltQuote(meltQuote, paymentStatus)
+	}
 
-			proofs, err := m.removePendingProofsForQuote(meltQuote.Id)
-			if err != nil {
-				errmsg := fmt.Sprintf("error removing pending proofs for quote: %v", err)
-				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
-			}
-			err = m.db.SaveProofs(proofs)
-			if err != nil {
-				errmsg := fmt.Sprintf("error invalidating proofs. Could not save proofs to db: %v", err)
-				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
-			}
+	return meltQuote, nil
+}
 
-			meltQuote.State = nut05.Paid
-			meltQuote.Preimage = paymentStatus.Preimage
-			err = m.db.UpdateMeltQuote(meltQuote.Id, paymentStatus.Preimage, nut05.Paid)
-			if err != nil {
-				errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
-				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
-			}
-			m.publishProofsStateChanges(proofs, nut07.Spent)
+// paymentContext returns ctx with the backend that the
+// payment for the melt quote was sent with, if known
+func paymentContext(ctx context.Context, meltQuote storage.MeltQuote) context.Context {
+	if len(meltQuote.Backend) > 0 {
+		return lightning.WithBackend(ctx, meltQuote.Backend)
+	}
+	return ctx
+}
 
-		case lightning.Failed:
-			m.logInfof("payment %v failed with error: %v. Setting melt quote '%v' to unpaid and removing proofs from pending",
-				meltQuote.PaymentHash, paymentStatus.PaymentFailureReason, meltQuote.Id)
+// updatePendingMeltQuote updates the pending melt quote with the status of its
+// payment from the backend. If the payment succeeded, the pending proofs are
+// invalidated. If it failed, they are removed from pending.
+func (m *Mint) updatePendingMeltQuote(meltQuote storage.MeltQuote, paymentStatus lightning.PaymentStatus) (storage.MeltQuote, error) {
+	switch paymentStatus.PaymentStatus {
+	// settle proofs (remove pending, and add to used)
+	// mark quote as paid and set preimage
+	case lightning.Succeeded:
+		m.logInfof("payment %v succeded. setting melt quote '%v' to paid and invalidating proofs",
+			meltQuote.PaymentHash, meltQuote.Id)
 
-			meltQuote.State = nut05.Unpaid
-			err = m.db.UpdateMeltQuote(meltQuote.Id, "", meltQuote.State)
-			if err != nil {
-				errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
-				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
-			}
-			_, err = m.removePendingProofsForQuote(meltQuote.Id)
-			if err != nil {
-				errmsg := fmt.Sprintf("error removing pending proofs for quote: %v", err)
-				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
-			}
+		proofs, err := m.removePendingProofsForQuote(meltQuote.Id)
+		if err != nil {
+			errmsg := fmt.Sprintf("error removing pending proofs for quote: %v", err)
+			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+		err = m.db.SaveProofs(proofs)
+		if err != nil {
+			errmsg := fmt.Sprintf("error invalidating proofs. Could not save proofs to db: %v", err)
+			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+
+		meltQuote.State = nut05.Paid
+		meltQuote.Preimage = paymentStatus.Preimage
+		err = m.db.UpdateMeltQuote(meltQuote.Id, paymentStatus.Preimage, nut05.Paid)
+		if err != nil {
+			errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
+			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+		m.publishProofsStateChanges(proofs, nut07.Spent)
+
+	case lightning.Failed:
+		m.logInfof("payment %v failed with error: %v. Setting melt quote '%v' to unpaid and removing proofs from pending",
+			meltQuote.PaymentHash, paymentStatus.PaymentFailureReason, meltQuote.Id)
+
+		meltQuote.State = nut05.Unpaid
+		err := m.db.UpdateMeltQuote(meltQuote.Id, "", meltQuote.State)
+		if err != nil {
+			errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
+			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+		_, err = m.removePendingProofsForQuote(meltQuote.Id)
+		if err != nil {
+			errmsg := fmt.Sprintf("error removing pending proofs for quote: %v", err)
+			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 		}
 	}
 
@@ -782,6 +1082,10 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 		Ys[i] = Yhex
 	}
 
+	if err := meltTokensRequest.Outputs.ValidateBlankOutputs(); err != nil {
+		return storage.MeltQuote{}, err
+	}
+
 	meltQuote, err := m.db.GetMeltQuote(meltTokensRequest.Quote)
 	if err != nil {
 		return storage.MeltQuote{}, cashu.QuoteNotExistErr
@@ -792,6 +1096,28 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 	if meltQuote.State == nut05.Pending {
 		return storage.MeltQuote{}, cashu.QuotePending
 	}
+	// the quote state is only set to pending after verifying the proofs
+	// so guard against a concurrent request paying the same invoice
+	if err := m.inflightPayments.Add(meltQuote.PaymentHash); err != nil {
+		m.logDebugf("payment with hash '%v' for melt quote '%v' is already in flight", meltQuote.PaymentHash, meltQuote.Id)
+		return storage.MeltQuote{}, cashu.QuotePending
+	}
+	defer m.inflightPayments.Remove(meltQuote.PaymentHash)
+
+	var keysendClient lightning.KeysendClient
+	var keysendPreimage string
+	if meltQuote.Method == cashu.KEYSEND_METHOD {
+		var ok bool
+		keysendClient, ok = m.lightningClient.(lightning.KeysendClient)
+		if !ok {
+			return storage.MeltQuote{}, cashu.PaymentMethodNotSupportedErr
+		}
+		keysendPreimage, err = m.keysendPreimage(meltQuote.Id)
+		if err != nil {
+			m.logErrorf("error generating keysend preimage: %v", err)
+			return storage.MeltQuote{}, cashu.StandardErr
+		}
+	}
 
 	err = m.verifyProofs(proofs, Ys)
 	if err != nil {
@@ -808,6 +1134,23 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 		return storage.MeltQuote{}, nut11.SigAllOnlySwap
 	}
 
+	// save the backend that will make the payment so that its status
+	// is only checked with that backend, also after a restart
+	if selector, ok := m.lightningClient.(lightning.BackendSelector); ok {
+		meltQuote.Backend = selector.SelectBackend(ctx)
+		if err := m.db.UpdateMeltQuoteBackend(meltQuote.Id, meltQuote.Backend); err != nil {
+			errmsg := fmt.Sprintf("error updating melt quote backend: %v", err)
+			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+	}
+	ctx = paymentContext(ctx, meltQuote)
+
+	// the payment would fail without being sent so do not set the proofs as pending
+	if checker, ok := m.lightningClient.(lightning.AvailabilityChecker); ok && !checker.Available(ctx) {
+		m.logErrorf("refusing melt for quote '%v'. Lightning backend is unavailable", meltQuote.Id)
+		return storage.MeltQuote{}, cashu.LightningBackendUnavailable
+	}
+
 	m.logInfof("verified proofs in melt tokens request. Setting proofs as pending before attempting payment.")
 	// set proofs as pending before trying to make payment
 	err = m.db.AddPendingProofs(proofs, meltQuote.Id)
@@ -827,7 +1170,7 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 	mintQuote, err := m.db.GetMintQuoteByPaymentHash(meltQuote.PaymentHash)
 	if err == nil {
 		m.logDebugf("quotes '%v' and '%v' have same invoice so settling them internally", meltQuote.Id, mintQuote.Id)
-		meltQuote, err = m.settleQuotesInternally(mintQuote, meltQuote)
+		meltQuote, err = m.settleQuotesInternally(ctx, mintQuote, meltQuote)
 		if err != nil {
 			return storage.MeltQuote{}, err
 		}
@@ -844,19 +1187,43 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 		m.publishProofsStateChanges(proofs, nut07.Spent)
 	} else {
 		var sendPaymentResponse lightning.PaymentStatus
-		// if melt is MPP, pay partial amount. If not, send full payment
-		if meltQuote.IsMpp {
+		// if melt is keysend, pay the destination node. If MPP, pay
+		// partial amount. If not, send full payment
+		if meltQuote.Method == cashu.KEYSEND_METHOD {
+			m.logInfof("attempting keysend payment of amount '%v' to node '%v'",
+				meltQuote.Amount, meltQuote.InvoiceRequest)
+			sendPaymentResponse, err = keysendClient.SendKeysend(
+				ctx,
+				meltQuote.InvoiceRequest,
+				meltQuote.AmountMsat,
+				keysendPreimage,
+				meltQuote.FeeReserve,
+			)
+		} else if meltQuote.IsMpp {
 			m.logInfof("attempting MPP payment of amount '%v' for invoice '%v'",
 				meltQuote.Amount, meltQuote.InvoiceRequest)
 			sendPaymentResponse, err = m.lightningClient.PayPartialAmount(
 				ctx,
 				meltQuote.InvoiceRequest,
 				meltQuote.AmountMsat,
-				m.lightningClient.FeeReserve(meltQuote.AmountMsat/1000),
+				meltQuote.FeeReserve,
 			)
 		} else {
 			m.logInfof("attempting to pay invoice: %v", meltQuote.InvoiceRequest)
-			sendPaymentResponse, err = m.lightningClient.SendPayment(ctx, meltQuote.InvoiceRequest, meltQuote.Amount)
+			sendPaymentResponse, err = m.lightningClient.SendPayment(ctx, meltQuote.InvoiceRequest, meltQuote.FeeReserve)
+		}
+		if errors.Is(err, lightning.ErrBackendUnavailable) {
+			// breaker opened after the check above. Payment was not sent
+			m.logErrorf("lightning backend is unavailable. Removing pending proofs and marking quote '%v' as unpaid", meltQuote.Id)
+			if err := m.db.UpdateMeltQuote(meltQuote.Id, "", nut05.Unpaid); err != nil {
+				errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
+				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+			}
+			if err := m.db.RemovePendingProofs(Ys); err != nil {
+				errmsg := fmt.Sprintf("error removing proofs from pending: %v", err)
+				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+			}
+			return storage.MeltQuote{}, cashu.LightningBackendUnavailable
 		}
 		if err != nil {
 			// if SendPayment failed do not return yet, an extra check will be done
@@ -882,7 +1249,7 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 			}
 
-		case lightning.Pending:
+		case lightning.Pending, lightning.Unknown:
 			// if payment is pending, leave quote and proofs as pending and return
 			m.logInfof("outgoing payment for quote '%v' is pending.", meltQuote.Id)
 			return meltQuote, nil
@@ -946,6 +1313,9 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 					errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
 					return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 				}
+			case lightning.Unknown:
+				m.logInfof("backend has no record of payment with hash '%v' yet. Leaving proofs for quote '%v' as pending",
+					meltQuote.PaymentHash, meltQuote.Id)
 			}
 		}
 	}
@@ -956,11 +1326,14 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 // if a pair of mint and melt quotes have the same invoice,
 // settle them internally and update in db
 func (m *Mint) settleQuotesInternally(
+	ctx context.Context,
 	mintQuote storage.MintQuote,
 	meltQuote storage.MeltQuote,
 ) (storage.MeltQuote, error) {
 	// need to get the invoice from the backend first to get the preimage
-	invoice, err := m.lightningClient.InvoiceStatus(mintQuote.PaymentHash)
+	ctx, cancel := context.WithTimeout(ctx, lightningRequestTimeout)
+	defer cancel()
+	invoice, err := m.lightningClient.InvoiceStatus(ctx, mintQuote.PaymentHash)
 	if err != nil {
 		errmsg := fmt.Sprintf("error getting invoice status from lightning backend: %v", err)
 		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
@@ -1077,18 +1450,29 @@ func (m *Mint) ProofsStateCheck(Ys []string) ([]nut07.ProofState, error) {
 }
 
 func (m *Mint) RestoreSignatures(blindedMessages cashu.BlindedMessages) (cashu.BlindedMessages, cashu.BlindedSignatures, error) {
-	outputs := make(cashu.BlindedMessages, 0, len(blindedMessages))
-	signatures := make(cashu.BlindedSignatures, 0, len(blindedMessages))
+	B_s := make([]string, len(blindedMessages))
+	for i, bm := range blindedMessages {
+		B_s[i] = bm.B_
+	}
+
+	dbSignatures, err := m.reader.GetBlindSignaturesByB_(B_s)
+	if err != nil {
+		errmsg := fmt.Sprintf("could not get signatures from db: %v", err)
+		return nil, nil, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	signaturesByB_ := make(map[string]cashu.BlindedSignature, len(dbSignatures))
+	for _, sig := range dbSignatures {
+		signaturesByB_[sig.B_] = sig.Signature
+	}
 
+	// return outputs and signatures in the same order as the request
+	outputs := make(cashu.BlindedMessages, 0, len(dbSignatures))
+	signatures := make(cashu.BlindedSignatures, 0, len(dbSignatures))
 	for _, bm := range blindedMessages {
-		sig, err := m.db.GetBlindSignature(bm.B_)
-		if errors.Is(err, sql.ErrNoRows) {
+		sig, ok := signaturesByB_[bm.B_]
+		if !ok {
 			continue
-		} else if err != nil {
-			errmsg := fmt.Sprintf("could not get signature from db: %v", err)
-			return nil, nil, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 		}
-
 		outputs = append(outputs, bm)
 		signatures = append(signatures, sig)
 	}
@@ -1124,16 +1508,11 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 		return cashu.ProofAlreadyUsedErr
 	}
 
-	// check duplicte proofs
-	if cashu.CheckDuplicateProofs(proofs) {
-		return cashu.DuplicateProofs
+	if err := proofs.Validate(); err != nil {
+		return err
 	}
 
 	for _, proof := range proofs {
-		if len(proof.Secret) > cashu.MAX_SECRET_LENGTH {
-			return cashu.SecretTooLongErr
-		}
-
 		// check that id in the proof matches id of any
 		// of the mint's keyset
 		var k *secp256k1.PrivateKey
@@ -1147,20 +1526,9 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 			}
 		}
 
-		// if P2PK locked proof, verify valid witness
-		nut10Secret, err := nut10.DeserializeSecret(proof.Secret)
-		if err == nil {
-			if nut10Secret.Kind == nut10.P2PK {
-				if err := nut11.VerifyP2PKLockedProof(proof, nut10Secret); err != nil {
-					return err
-				}
-				m.logDebugf("verified P2PK locked proof")
-			} else if nut10Secret.Kind == nut10.HTLC {
-				if err := nut14.VerifyHTLCProof(proof, nut10Secret); err != nil {
-					return err
-				}
-				m.logDebugf("verified HTLC proof")
-			}
+		// if proof is locked to a spending condition, verify valid witness
+		if err := m.verifySpendingCondition(proof); err != nil {
+			return err
 		}
 
 		Cbytes, err := hex.DecodeString(proof.C)
@@ -1181,117 +1549,6 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 	return nil
 }
 
-// verifyBlindedMessages used to verify blinded messages are signed when SIG_ALL flag
-// is present in either a P2PK or HTLC locked proofs
-func verifyBlindedMessages(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages) error {
-	secret, err := nut10.DeserializeSecret(proofs[0].Secret)
-	if err != nil {
-		return cashu.BuildCashuError(err.Error(), cashu.StandardErrCode)
-	}
-
-	// pubkeys will hold list of public keys that can sign
-	pubkeys, err := nut11.PublicKeys(secret)
-	if err != nil {
-		return err
-	}
-
-	signaturesRequired := 1
-	p2pkTags, err := nut11.ParseP2PKTags(secret.Data.Tags)
-	if err != nil {
-		return err
-	}
-	if p2pkTags.NSigs > 0 {
-		signaturesRequired = p2pkTags.NSigs
-	}
-
-	// Check that the conditions across all proofs are the same
-	for _, proof := range proofs {
-		secret, err := nut10.DeserializeSecret(proof.Secret)
-		if err != nil {
-			return cashu.BuildCashuError(err.Error(), cashu.StandardErrCode)
-		}
-		// all flags need to be SIG_ALL
-		if !nut11.IsSigAll(secret) {
-			return nut11.AllSigAllFlagsErr
-		}
-
-		currentSignaturesRequired := 1
-		p2pkTags, err := nut11.ParseP2PKTags(secret.Data.Tags)
-		if err != nil {
-			return err
-		}
-		if p2pkTags.NSigs > 0 {
-			currentSignaturesRequired = p2pkTags.NSigs
-		}
-
-		currentKeys, err := nut11.PublicKeys(secret)
-		if err != nil {
-			return err
-		}
-
-		// list of valid keys should be the same
-		// across all proofs
-		if !reflect.DeepEqual(pubkeys, currentKeys) {
-			return nut11.SigAllKeysMustBeEqualErr
-		}
-
-		// all n_sigs must be same
-		if signaturesRequired != currentSignaturesRequired {
-			return nut11.NSigsMustBeEqualErr
-		}
-	}
-
-	for _, bm := range blindedMessages {
-		B_bytes, err := hex.DecodeString(bm.B_)
-		if err != nil {
-			return cashu.BuildCashuError(err.Error(), cashu.StandardErrCode)
-		}
-		hash := sha256.Sum256(B_bytes)
-
-		var signatures []string
-		switch secret.Kind {
-		case nut10.P2PK:
-			var witness nut11.P2PKWitness
-			if err := json.Unmarshal([]byte(bm.Witness), &witness); err != nil {
-				return nut11.InvalidWitness
-			}
-			signatures = witness.Signatures
-		case nut10.HTLC:
-			var witness nut14.HTLCWitness
-			if err := json.Unmarshal([]byte(bm.Witness), &witness); err != nil {
-				return nut11.InvalidWitness
-			}
-
-			// verify valid preimage
-			preimageBytes, err := hex.DecodeString(witness.Preimage)
-			if err != nil {
-				return nut14.InvalidPreimageErr
-			}
-			hashBytes := sha256.Sum256(preimageBytes)
-			hash := hex.EncodeToString(hashBytes[:])
-
-			if len(secret.Data.Data) != 64 {
-				return nut14.InvalidHashErr
-			}
-			if hash != secret.Data.Data {
-				return nut14.InvalidPreimageErr
-			}
-			signatures = witness.Signatures
-		default:
-			return nut11.InvalidKindErr
-		}
-
-		if nut11.DuplicateSignatures(signatures) {
-			return nut11.DuplicateSignaturesErr
-		}
-		if !nut11.HasValidSignatures(hash[:], signatures, signaturesRequired, pubkeys) {
-			return nut11.NotEnoughSignaturesErr
-		}
-	}
-
-	return nil
-}
-
 // signBlindedMessages will sign the blindedMessages and return the blindedSignatures
 func (m *Mint) signBlindedMessages(blindedMessages cashu.BlindedMessages) (cashu.BlindedSignatures, error) {
 	blindedSignatures := make(cashu.BlindedSignatures, len(blindedMessages))
@@ -1343,14 +1600,23 @@ func (m *Mint) signBlindedMessages(blindedMessages cashu.BlindedMessages) (cashu
 }
 
 // requestInvoice requests an invoice from the Lightning backend for the given amount
-func (m *Mint) requestInvoice(amount uint64) (*lightning.Invoice, error) {
-	invoice, err := m.lightningClient.CreateInvoice(amount)
+func (m *Mint) requestInvoice(ctx context.Context, amount uint64) (*lightning.Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, lightningRequestTimeout)
+	defer cancel()
+
+	invoice, err := m.lightningClient.CreateInvoice(ctx, amount)
 	if err != nil {
 		return nil, err
 	}
 	return &invoice, nil
 }
 
+// msatToSat converts an amount in msat to sats rounding up
+// so that sub-sat amounts are fully covered by the ecash provided.
+func msatToSat(msat uint64) uint64 {
+	return (msat + 999) / 1000
+}
+
 func (m *Mint) TransactionFees(inputs cashu.Proofs) uint {
 	var fees uint = 0
 	for _, proof := range inputs {
@@ -1403,10 +1669,13 @@ func (m *Mint) RotateKeyset(fee uint) (*nut02.Keyset, error) {
 		return nil, err
 	}
 
-	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	defer crypto.ZeroBytes(seed)
+
+	master, err := keys.NewMaster(seed)
 	if err != nil {
 		return nil, err
 	}
+	defer crypto.ZeroExtendedKey(master)
 
 	currentActiveKeyset := m.activeKeyset
 
@@ -1455,11 +1724,83 @@ func (m *Mint) RotateKeyset(fee uint) (*nut02.Keyset, error) {
 }
 
 func (m *Mint) IssuedEcash() (map[string]uint64, error) {
-	return m.db.GetIssuedEcash()
+	return m.reader.GetIssuedEcash()
 }
 
 func (m *Mint) RedeemedEcash() (map[string]uint64, error) {
-	return m.db.GetRedeemedEcash()
+	return m.reader.GetRedeemedEcash()
+}
+
+// LightningBackendHealth returns the health of the Lightning backends.
+// If the client does not report health of multiple backends,
+// it returns a single entry from its connection status.
+func (m *Mint) LightningBackendHealth(ctx context.Context) []lightning.BackendHealth {
+	if reporter, ok := m.lightningClient.(lightning.HealthReporter); ok {
+		return reporter.BackendHealth(ctx)
+	}
+
+	health := lightning.BackendHealth{
+		Name:        "primary",
+		Healthy:     true,
+		Active:      true,
+		LastChecked: time.Now().Unix(),
+	}
+	if err := m.lightningClient.ConnectionStatus(ctx); err != nil {
+		health.Healthy = false
+		health.LastError = err.Error()
+	}
+	return []lightning.BackendHealth{health}
+}
+
+// ErrNodeInfoNotSupported is returned when the lightning
+// backend can not report info about its node.
+var ErrNodeInfoNotSupported = errors.New("lightning backend does not support node info")
+
+// LightningNodeInfo returns the info and channel balances
+// of the node used by the lightning backend.
+func (m *Mint) LightningNodeInfo(ctx context.Context) (lightning.NodeInfo, lightning.ChannelBalances, error) {
+	client, ok := m.lightningClient.(lightning.NodeInfoClient)
+	if !ok {
+		return lightning.NodeInfo{}, lightning.ChannelBalances{}, ErrNodeInfoNotSupported
+	}
+
+	info, err := client.GetInfo(ctx)
+	if err != nil {
+		return lightning.NodeInfo{}, lightning.ChannelBalances{}, fmt.Errorf("error getting node info: %v", err)
+	}
+	balances, err := client.ChannelBalances(ctx)
+	if err != nil {
+		return lightning.NodeInfo{}, lightning.ChannelBalances{}, fmt.Errorf("error getting channel balances: %v", err)
+	}
+	return info, balances, nil
+}
+
+// ErrBackupNotSupported is returned when the db
+// used by the mint can not be backed up while running.
+var ErrBackupNotSupported = errors.New("db does not support online backups")
+
+// BackupDB writes a consistent copy of the mint db to a new file in path
+// without stopping the mint.
+func (m *Mint) BackupDB(path string) error {
+	backuper, ok := m.db.(storage.Backuper)
+	if !ok {
+		return ErrBackupNotSupported
+	}
+	return backuper.Backup(path)
+}
+
+// DBSchemaVersion returns the version of the schema of the mint db.
+// It returns false if the db does not have a versioned schema.
+func (m *Mint) DBSchemaVersion() (uint, bool, error) {
+	versioner, ok := m.db.(storage.SchemaVersioner)
+	if !ok {
+		return 0, false, nil
+	}
+	version, err := versioner.SchemaVersion()
+	if err != nil {
+		return 0, false, err
+	}
+	return version, true, nil
 }
 
 func (m *Mint) TotalBalance() (uint64, error) {
@@ -1537,6 +1878,15 @@ func (m *Mint) SetMintInfo(mintInfo MintInfo) {
 		Nut20: nut06.Supported{Supported: true},
 	}
 
+	if _, ok := m.lightningClient.(lightning.KeysendClient); ok {
+		nuts.Nut05.Methods = append(nuts.Nut05.Methods, nut06.MethodSetting{
+			Method:    cashu.KEYSEND_METHOD,
+			Unit:      cashu.Sat.String(),
+			MinAmount: m.limits.MeltingSettings.MinAmount,
+			MaxAmount: m.limits.MeltingSettings.MaxAmount,
+		})
+	}
+
 	if m.mppEnabled {
 		nuts.Nut15 = &nut06.NutSetting{
 			Methods: []nut06.MethodSetting{
@@ -1547,7 +1897,7 @@ func (m *Mint) SetMintInfo(mintInfo MintInfo) {
 
 	info := nut06.MintInfo{
 		Name:            mintInfo.Name,
-		Version:         "gonuts/0.4.0",
+		Version:         "gonuts/" + Version,
 		Description:     mintInfo.Description,
 		LongDescription: mintInfo.LongDescription,
 		Contact:         mintInfo.Contact,
@@ -1560,20 +1910,7 @@ func (m *Mint) SetMintInfo(mintInfo MintInfo) {
 	m.mintInfo = info
 }
 
-func (m Mint) RetrieveMintInfo() (nut06.MintInfo, error) {
-	seed, err := m.db.GetSeed()
-	if err != nil {
-		return nut06.MintInfo{}, err
-	}
-	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
-	if err != nil {
-		return nut06.MintInfo{}, err
-	}
-	publicKey, err := master.ECPubKey()
-	if err != nil {
-		return nut06.MintInfo{}, err
-	}
-
+func (m *Mint) RetrieveMintInfo() (nut06.MintInfo, error) {
 	mintingDisabled := false
 	mintBalance, err := m.TotalBalance()
 	if err != nil {
@@ -1589,11 +1926,56 @@ func (m Mint) RetrieveMintInfo() (nut06.MintInfo, error) {
 	nut04 := m.mintInfo.Nuts.Nut04
 	nut04.Disabled = mintingDisabled
 	m.mintInfo.Nuts.Nut04 = nut04
-	m.mintInfo.Pubkey = hex.EncodeToString(publicKey.SerializeCompressed())
+	m.mintInfo.Pubkey = hex.EncodeToString(m.signingKey.PubKey().SerializeCompressed())
 
 	return m.mintInfo, nil
 }
 
+// SignResponse signs the body of a response with the mint's signing key
+// so that wallets can verify it against the pubkey in the mint info.
+// It returns an empty signature if the mint does not have a signing key.
+func (m *Mint) SignResponse(body []byte) (string, error) {
+	if m.signingKey == nil {
+		return "", nil
+	}
+	return crypto.SignMessage(m.signingKey, body)
+}
+
+// paths of the keys derived from the master key that are not keyset keys.
+// Each is a hardened child so that the keys are only used for one purpose.
+// Keysets are derived at m/0'/0'/index'
+var (
+	signingKeyPath = []uint32{keys.Hardened(1), keys.Hardened(0)}
+	keysendKeyPath = []uint32{keys.Hardened(1), keys.Hardened(1)}
+)
+
+// deriveMintKeys derives from the master key the key that signs
+// info and keys responses and the key for keysend preimages
+func deriveMintKeys(master *hdkeychain.ExtendedKey) (*secp256k1.PrivateKey, []byte, error) {
+	signingExtKey, err := keys.DerivePath(master, signingKeyPath...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.ZeroExtendedKey(signingExtKey)
+	signingKey, err := signingExtKey.ECPrivKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keysendExtKey, err := keys.DerivePath(master, keysendKeyPath...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.ZeroExtendedKey(keysendExtKey)
+	keysendPrivateKey, err := keysendExtKey.ECPrivKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.ZeroPrivateKeys(keysendPrivateKey)
+
+	return signingKey, keysendPrivateKey.Serialize(), nil
+}
+
 func (m *Mint) publishProofsStateChanges(proofs cashu.Proofs, state nut07.State) {
 	proofStates := make([]nut07.ProofState, len(proofs))
 
@@ -165,14 +165,14 @@ func testMain(m *testing.M) (int, error) {
 func TestRequestMintQuote(t *testing.T) {
 	var mintAmount uint64 = 10000
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	_, err := testMint.RequestMintQuote(mintQuoteRequest)
+	_, err := testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
 
 	// test invalid unit
 	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: "eth"}
-	_, err = testMint.RequestMintQuote(mintQuoteRequest)
+	_, err = testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	cashuErr, ok := err.(*cashu.Error)
 	if !ok {
 		t.Fatalf("got unexpected non-Cashu error: %v", err)
@@ -187,7 +187,7 @@ func TestRequestMintQuote(t *testing.T) {
 		Unit:   cashu.Sat.String(),
 		Pubkey: "invalidpubkey",
 	}
-	_, err = testMint.RequestMintQuote(mintQuoteRequest)
+	_, err = testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	cashuErr, _ = err.(*cashu.Error)
 	invalidPubkeyErr := "invalid public key"
 	if !strings.Contains(cashuErr.Detail, invalidPubkeyErr) {
@@ -198,7 +198,7 @@ func TestRequestMintQuote(t *testing.T) {
 func TestMintQuoteState(t *testing.T) {
 	var mintAmount uint64 = 42000
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := testMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err := testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
@@ -206,13 +206,13 @@ func TestMintQuoteState(t *testing.T) {
 	keyset := testMint.GetActiveKeyset()
 
 	// test invalid quote
-	_, err = testMint.GetMintQuoteState("mintquote1234")
+	_, err = testMint.GetMintQuoteState(context.Background(), "mintquote1234")
 	if !errors.Is(err, cashu.QuoteNotExistErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.QuoteNotExistErr, err)
 	}
 
 	// test quote state before paying invoice
-	quoteStateResponse, err := testMint.GetMintQuoteState(mintQuoteResponse.Id)
+	quoteStateResponse, err := testMint.GetMintQuoteState(context.Background(), mintQuoteResponse.Id)
 	if err != nil {
 		t.Fatalf("unexpected error getting quote state: %v", err)
 	}
@@ -226,7 +226,7 @@ func TestMintQuoteState(t *testing.T) {
 	}
 
 	// test quote state after paying invoice
-	quoteStateResponse, err = testMint.GetMintQuoteState(mintQuoteResponse.Id)
+	quoteStateResponse, err = testMint.GetMintQuoteState(context.Background(), mintQuoteResponse.Id)
 	if err != nil {
 		t.Fatalf("unexpected error getting quote state: %v", err)
 	}
@@ -238,13 +238,13 @@ func TestMintQuoteState(t *testing.T) {
 
 	// mint tokens
 	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error minting tokens: %v", err)
 	}
 
 	// test quote state after minting tokens
-	quoteStateResponse, err = testMint.GetMintQuoteState(mintQuoteResponse.Id)
+	quoteStateResponse, err = testMint.GetMintQuoteState(context.Background(), mintQuoteResponse.Id)
 	if err != nil {
 		t.Fatalf("unexpected error getting quote state: %v", err)
 	}
@@ -256,7 +256,7 @@ func TestMintQuoteState(t *testing.T) {
 func TestMintTokens(t *testing.T) {
 	var mintAmount uint64 = 42000
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := testMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err := testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
@@ -266,14 +266,14 @@ func TestMintTokens(t *testing.T) {
 
 	// test without paying invoice
 	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.MintQuoteRequestNotPaid) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteRequestNotPaid, err)
 	}
 
 	// test invalid quote
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: "mintquote1234", Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.QuoteNotExistErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.QuoteNotExistErr, err)
 	}
@@ -286,7 +286,7 @@ func TestMintTokens(t *testing.T) {
 	// test with blinded messages over request mint amount
 	overBlindedMessages, _, _, err := testutils.CreateBlindedMessages(mintAmount+100, keyset)
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: overBlindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.OutputsOverQuoteAmountErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.OutputsOverQuoteAmountErr, err)
 	}
@@ -295,7 +295,7 @@ func TestMintTokens(t *testing.T) {
 	invalidKeyset := crypto.MintKeyset{Id: "0192384aa"}
 	invalidKeysetMessages, _, _, err := testutils.CreateBlindedMessages(mintAmount, invalidKeyset.Id)
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: invalidKeysetMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.UnknownKeysetErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnknownKeysetErr, err)
 	}
@@ -305,7 +305,7 @@ func TestMintTokens(t *testing.T) {
 	bms, _, _, err := testutils.CreateBlindedMessages(mintAmount, keyset)
 	overflowBlindedMessages = append(overflowBlindedMessages, bms...)
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: overflowBlindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.InvalidBlindedMessageAmount) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InvalidBlindedMessageAmount, err)
 	}
@@ -316,27 +316,27 @@ func TestMintTokens(t *testing.T) {
 	copy(duplicateBlindedMessages, blindedMessages)
 	duplicateBlindedMessages[bmLen-2] = duplicateBlindedMessages[bmLen-1]
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: duplicateBlindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.DuplicateOutputs) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.DuplicateOutputs, err)
 	}
 
 	// valid mint request
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error minting tokens: %v", err)
 	}
 
 	// test already minted tokens
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.MintQuoteAlreadyIssued) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteAlreadyIssued, err)
 	}
 
 	// test mint with blinded messages already signed
 	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err = testMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err = testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
@@ -346,7 +346,7 @@ func TestMintTokens(t *testing.T) {
 	}
 
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.BlindedMessageAlreadySigned) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.BlindedMessageAlreadySigned, err)
 	}
@@ -358,7 +358,7 @@ func TestMintTokens(t *testing.T) {
 		Unit:   cashu.Sat.String(),
 		Pubkey: hex.EncodeToString(privateKey.PubKey().SerializeCompressed()),
 	}
-	mintQuoteResponse, err = testMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err = testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
@@ -370,7 +370,7 @@ func TestMintTokens(t *testing.T) {
 
 	// test no signature for mint quote with pubkey
 	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.MintQuoteInvalidSigErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteInvalidSigErr, err)
 	}
@@ -383,7 +383,7 @@ func TestMintTokens(t *testing.T) {
 		Outputs:   blindedMessages,
 		Signature: hex.EncodeToString(sig.Serialize()),
 	}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if !errors.Is(err, cashu.MintQuoteInvalidSigErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteInvalidSigErr, err)
 	}
@@ -395,7 +395,7 @@ func TestMintTokens(t *testing.T) {
 		Outputs:   blindedMessages,
 		Signature: hex.EncodeToString(validSig.Serialize()),
 	}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error minting tokens: %v", err)
 	}
@@ -529,7 +529,7 @@ func TestRequestMeltQuote(t *testing.T) {
 
 	// test invalid unit
 	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: invoice.PaymentRequest, Unit: "eth"}
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	_, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	cashuErr, ok := err.(*cashu.Error)
 	if !ok {
 		t.Fatalf("got unexpected non-Cashu error: %v", err)
@@ -540,19 +540,19 @@ func TestRequestMeltQuote(t *testing.T) {
 
 	// test invalid invoice
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: "invoice1111", Unit: cashu.Sat.String()}
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	_, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err == nil {
 		t.Fatal("expected error but got nil")
 	}
 
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: invoice.PaymentRequest, Unit: cashu.Sat.String()}
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	_, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
 
 	// trying to create another melt quote with same invoice should throw error
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	_, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if !errors.Is(err, cashu.MeltQuoteForRequestExists) {
 		//if !errors.Is(err, cashu.PaymentMethodNotSupportedErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteForRequestExists, err)
@@ -566,7 +566,7 @@ func TestMeltQuoteState(t *testing.T) {
 	}
 
 	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: newInvoice.PaymentRequest, Unit: cashu.Sat.String()}
-	meltRequest, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltRequest, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -630,7 +630,7 @@ func TestMelt(t *testing.T) {
 	paymentRequest := invoice.PaymentRequest
 
 	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -692,7 +692,7 @@ func TestMelt(t *testing.T) {
 
 	// test already used proofs
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	newQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	newQuote, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -730,7 +730,7 @@ func TestMelt(t *testing.T) {
 	paymentRequest = invoice.PaymentRequest
 
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err = mintFees.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err = mintFees.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -754,14 +754,14 @@ func TestMelt(t *testing.T) {
 
 	// test failed lightning payment
 	// create invoice from node for which there is no route so payment fails
-	noRouteInvoice, err := lightningClient3.CreateInvoice(2000)
+	noRouteInvoice, err := lightningClient3.CreateInvoice(context.Background(), 2000)
 	if err != nil {
 		t.Fatalf("error creating invoice: %v", err)
 	}
 	paymentRequest = noRouteInvoice.PaymentRequest
 
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -781,7 +781,7 @@ func TestMelt(t *testing.T) {
 	// test internal quotes (mint and melt quotes with same invoice)
 	var mintAmount uint64 = 42000
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := testMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err := testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
@@ -797,7 +797,7 @@ func TestMelt(t *testing.T) {
 		Request: mintQuoteResponse.PaymentRequest,
 		Unit:    cashu.Sat.String(),
 	}
-	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -816,7 +816,7 @@ func TestMelt(t *testing.T) {
 
 	// now mint should work because quote was settled internally
 	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	_, err = testMint.MintTokens(context.Background(), mintTokensRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in mint: %v", err)
 	}
@@ -865,7 +865,7 @@ func TestMPPMelt(t *testing.T) {
 		Unit:    cashu.Sat.String(),
 		Options: map[string]nut05.MppOption{"mpp": {AmountMsat: 6000 * 1000}},
 	}
-	meltQuote1, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote1, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -875,7 +875,7 @@ func TestMPPMelt(t *testing.T) {
 		Unit:    cashu.Sat.String(),
 		Options: map[string]nut05.MppOption{"mpp": {AmountMsat: 4000 * 1000}},
 	}
-	meltQuote2, err := testMppMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote2, err := testMppMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -919,7 +919,7 @@ func TestMPPMelt(t *testing.T) {
 	}
 
 	// MPP will fail because there is no route
-	noRouteInvoice, err := lightningClient4.CreateInvoice(10000)
+	noRouteInvoice, err := lightningClient4.CreateInvoice(context.Background(), 10000)
 	if err != nil {
 		t.Fatalf("error creating invoice: %v", err)
 	}
@@ -930,7 +930,7 @@ func TestMPPMelt(t *testing.T) {
 		Unit:    cashu.Sat.String(),
 		Options: map[string]nut05.MppOption{"mpp": {AmountMsat: 6000 * 1000}},
 	}
-	meltQuote1, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote1, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -940,7 +940,7 @@ func TestMPPMelt(t *testing.T) {
 		Unit:    cashu.Sat.String(),
 		Options: map[string]nut05.MppOption{"mpp": {AmountMsat: 4000 * 1000}},
 	}
-	meltQuote2, err = testMppMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote2, err = testMppMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -976,7 +976,7 @@ func TestMPPMelt(t *testing.T) {
 	}
 
 	// test err on mpp amount over invoice amount
-	newInvoice, err := lightningClient4.CreateInvoice(10000)
+	newInvoice, err := lightningClient4.CreateInvoice(context.Background(), 10000)
 	if err != nil {
 		t.Fatalf("error creating invoice: %v", err)
 	}
@@ -986,7 +986,7 @@ func TestMPPMelt(t *testing.T) {
 		Unit:    cashu.Sat.String(),
 		Options: map[string]nut05.MppOption{"mpp": {AmountMsat: 10100 * 1000}},
 	}
-	meltQuote1, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote1, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err == nil {
 		t.Fatal("expected error but got nil")
 	}
@@ -1012,7 +1012,7 @@ func TestMPPMelt(t *testing.T) {
 		Unit:    cashu.Sat.String(),
 		Options: map[string]nut05.MppOption{"mpp": {AmountMsat: 2000 * 1000}},
 	}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -1053,7 +1053,7 @@ func TestMPPMelt(t *testing.T) {
 
 	// test reject MPP for internal quotes
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: 10000, Unit: cashu.Sat.String()}
-	mintQuote, err := testMint.RequestMintQuote(mintQuoteRequest)
+	mintQuote, err := testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
@@ -1063,7 +1063,7 @@ func TestMPPMelt(t *testing.T) {
 		Unit:    cashu.Sat.String(),
 		Options: map[string]nut05.MppOption{"mpp": {AmountMsat: 6000 * 1000}},
 	}
-	meltQuote1, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote1, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	expectedErrMsg = "mpp for internal invoice is not allowed"
 	if err.Error() != expectedErrMsg {
 		t.Fatalf("expected error '%v' but got '%v'", expectedErrMsg, err.Error())
@@ -1084,7 +1084,7 @@ func TestPendingProofs(t *testing.T) {
 	paymentRequest := hodlInvoice.PaymentRequest
 
 	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -1146,6 +1146,10 @@ func TestPendingProofs(t *testing.T) {
 	if !errors.Is(err, cashu.ProofPendingErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.ProofPendingErr, err)
 	}
+	// pending shares its code with already used proofs
+	if errors.Is(err, cashu.ProofAlreadyUsedErr) {
+		t.Fatalf("expected proofs to be pending but got '%v'", err)
+	}
 
 	if err := node2.SettleHodlInvoice(preimage, "", nil); err != nil {
 		t.Fatalf("error settling hodl invoice: %v", err)
@@ -1179,7 +1183,7 @@ func TestPendingProofs(t *testing.T) {
 func TestConcurrentMint(t *testing.T) {
 	var mintAmount uint64 = 2100
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, _ := testMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, _ := testMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 
 	keyset := testMint.GetActiveKeyset().Id
 	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
@@ -1198,7 +1202,7 @@ func TestConcurrentMint(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-			_, err := testMint.MintTokens(mintTokensRequest)
+			_, err := testMint.MintTokens(context.Background(), mintTokensRequest)
 			if err != nil {
 				mu.Lock()
 				errCount++
@@ -1267,7 +1271,7 @@ func TestConcurrentMelt(t *testing.T) {
 		}
 
 		meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: invoice.PaymentRequest, Unit: cashu.Sat.String()}
-		meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+		meltQuote, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 		if err != nil {
 			t.Fatalf("got unexpected error in melt request: %v", err)
 		}
@@ -1483,7 +1487,7 @@ func TestMintLimits(t *testing.T) {
 	// test above mint max amount
 	var mintAmount uint64 = 20000
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := limitsMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err := limitsMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if !errors.Is(err, cashu.MintAmountExceededErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintAmountExceededErr, err)
 	}
@@ -1491,7 +1495,7 @@ func TestMintLimits(t *testing.T) {
 	// amount below max limit
 	mintAmount = 9500
 	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err = limitsMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("error requesting mint quote: %v", err)
 	}
@@ -1504,14 +1508,14 @@ func TestMintLimits(t *testing.T) {
 	}
 
 	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	blindedSignatures, err := limitsMint.MintTokens(mintTokensRequest)
+	blindedSignatures, err := limitsMint.MintTokens(context.Background(), mintTokensRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error minting tokens: %v", err)
 	}
 
 	// test request mint that will make it go above max balance
 	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: 9000, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err = limitsMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if !errors.Is(err, cashu.MintingDisabled) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintingDisabled, err)
 	}
@@ -1524,7 +1528,7 @@ func TestMintLimits(t *testing.T) {
 	paymentRequest := invoice.PaymentRequest
 
 	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	_, err = limitsMint.RequestMeltQuote(meltQuoteRequest)
+	_, err = limitsMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if !errors.Is(err, cashu.MeltAmountExceededErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltAmountExceededErr, err)
 	}
@@ -1538,7 +1542,7 @@ func TestMintLimits(t *testing.T) {
 	paymentRequest = invoice.PaymentRequest
 
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := limitsMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err := limitsMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -1551,7 +1555,7 @@ func TestMintLimits(t *testing.T) {
 
 	// this should be within max balance now
 	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: 9000, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err = limitsMint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error requesting mint quote: %v", err)
 	}
@@ -1612,27 +1616,49 @@ func TestNUT11P2PK(t *testing.T) {
 
 	// proofs with only 1 signature but require 2
 	blindedMessages, _, _, _ = testutils.CreateBlindedMessages(mintAmount, keyset)
-	notEnoughSigsProofs, _ := nut11.AddSignatureToInputs(multisigProofs, lock)
+	notEnoughSigsProofs, _ := nut11.AddSigAllSignatures(multisigProofs, blindedMessages, []*btcec.PrivateKey{key1})
 	_, err = testMint.Swap(notEnoughSigsProofs, blindedMessages)
 	if !errors.Is(err, nut11.NotEnoughSignaturesErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", nut11.NotEnoughSignaturesErr, err)
 	}
 
 	signingKeys := []*btcec.PrivateKey{key1, key2}
-	// enough signatures but blinded messages not signed
+	// only inputs signed without the outputs of the request
 	signedProofs, _ = testutils.AddP2PKWitnessToInputs(multisigProofs, signingKeys)
 	_, err = testMint.Swap(signedProofs, blindedMessages)
-	if !errors.Is(err, nut11.InvalidWitness) {
-		t.Fatalf("expected error '%v' but got '%v' instead", nut11.InvalidWitness, err)
+	if !errors.Is(err, nut11.NotEnoughSignaturesErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut11.NotEnoughSignaturesErr, err)
 	}
 
-	// inputs and outputs with valid signatures
-	signedBlindedMessages, _ := testutils.AddP2PKWitnessToOutputs(blindedMessages, signingKeys)
-	_, err = testMint.Swap(signedProofs, signedBlindedMessages)
+	// signatures on other outputs
+	otherBlindedMessages, _, _, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+	signedProofs, _ = nut11.AddSigAllSignatures(multisigProofs, otherBlindedMessages, signingKeys)
+	_, err = testMint.Swap(signedProofs, blindedMessages)
+	if !errors.Is(err, nut11.NotEnoughSignaturesErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut11.NotEnoughSignaturesErr, err)
+	}
+
+	// valid signatures on inputs and outputs
+	signedProofs, _ = nut11.AddSigAllSignatures(multisigProofs, blindedMessages, signingKeys)
+	_, err = testMint.Swap(signedProofs, blindedMessages)
 	if err != nil {
 		t.Fatalf("unexpected error in swap: %v", err)
 	}
 
+	// inputs and outputs signed separately as in the previous SIG_ALL format
+	// do not commit to the amounts and keyset ids so they are rejected
+	multisigProofs, err = testutils.GetProofsWithSpendingCondition(mintAmount, p2pkSpendingCondition, testMint, node2)
+	if err != nil {
+		t.Fatalf("error getting locked proofs: %v", err)
+	}
+	blindedMessages, _, _, _ = testutils.CreateBlindedMessages(mintAmount, keyset)
+	signedProofs, _ = testutils.AddP2PKWitnessToInputs(multisigProofs, signingKeys)
+	signedBlindedMessages, _ := testutils.AddP2PKWitnessToOutputs(blindedMessages, signingKeys)
+	_, err = testMint.Swap(signedProofs, signedBlindedMessages)
+	if !errors.Is(err, nut11.NotEnoughSignaturesErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut11.NotEnoughSignaturesErr, err)
+	}
+
 	// test with locktime
 	tags = nut11.P2PKTags{
 		Locktime: time.Now().Add(time.Minute * 1).Unix(),
@@ -1709,7 +1735,7 @@ func TestNUT11P2PK(t *testing.T) {
 	paymentRequest := invoice.PaymentRequest
 
 	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -1745,7 +1771,7 @@ func TestNUT11P2PK(t *testing.T) {
 	paymentRequest = invoice.PaymentRequest
 
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -1916,16 +1942,18 @@ func TestHTLC(t *testing.T) {
 	}
 	blindedMessages, _, _, _ = testutils.CreateBlindedMessages(mintAmount, keyset)
 
-	// test only inputs signed
+	// test only inputs signed without the outputs of the request
 	proofs, _ = testutils.AddHTLCWitnessToInputs(lockedProofs, preimage, signingKey)
-	blindedMessages, _ = testutils.AddHTLCWitnessToOutputs(blindedMessages, preimage, nil)
 	_, err = testMint.Swap(proofs, blindedMessages)
 	if !errors.Is(err, nut11.NotEnoughSignaturesErr) {
 		t.Fatalf("expected error '%v' but got '%v' instead", nut11.NotEnoughSignaturesErr, err)
 	}
 
-	// add signatures to outputs for SIG_ALL
-	blindedMessages, err = testutils.AddHTLCWitnessToOutputs(blindedMessages, preimage, signingKey)
+	// sign inputs and outputs for SIG_ALL
+	proofs, err = nut14.AddSigAllWitnessHTLC(lockedProofs, blindedMessages, preimage, signingKey)
+	if err != nil {
+		t.Fatalf("unexpected error adding HTLC witness: %v", err)
+	}
 	_, err = testMint.Swap(proofs, blindedMessages)
 	if err != nil {
 		t.Fatalf("got unexpected error swapping HTLC proofs: %v", err)
@@ -1998,7 +2026,7 @@ func TestHTLC(t *testing.T) {
 	paymentRequest := invoice.PaymentRequest
 
 	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err := testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
@@ -2036,7 +2064,7 @@ func TestHTLC(t *testing.T) {
 		t.Fatalf("error creating invoice: %v", err)
 	}
 	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: invoice.PaymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err = testMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
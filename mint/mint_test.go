@@ -1,10 +1,30 @@
 package mint
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/crypto"
 	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/mint/storage"
+	"github.com/elnosh/gonuts/mint/storage/inmem"
 )
 
 func TestKeysetRotations(t *testing.T) {
@@ -97,3 +117,836 @@ func TestKeysetRotations(t *testing.T) {
 		t.Fatalf("expected fee of '%v' but got '%v'", 200, mint.activeKeyset.InputFeePpk)
 	}
 }
+
+func TestSpendingConditionVerifier(t *testing.T) {
+	fakeBackend := lightning.FakeBackend{}
+	testMintPath := "./testmintspendingconditions"
+
+	errCustomCondition := errors.New("custom condition not met")
+	verifierCalled := false
+	config := Config{
+		MintPath:        testMintPath,
+		LightningClient: &fakeBackend,
+		LogLevel:        Disable,
+		SpendingConditions: map[nut10.SecretKind]SpendingConditionVerifier{
+			nut10.P2PK: SpendingConditionVerifierFunc(func(cashu.Proof, nut10.WellKnownSecret) error {
+				verifierCalled = true
+				return errCustomCondition
+			}),
+		},
+	}
+	defer os.RemoveAll(testMintPath)
+
+	mint, err := LoadMint(config)
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	defer mint.Shutdown()
+
+	if _, ok := mint.spendingConditions[nut10.HTLC]; !ok {
+		t.Fatal("expected default HTLC verifier to be registered")
+	}
+
+	secret, err := nut10.NewSecretFromSpendingCondition(nut10.SpendingCondition{
+		Kind: nut10.P2PK,
+		Data: "033281c37677ea273eb7183b783067f5244933ef78d8c3f15b1a77cb246099c26e",
+	})
+	if err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+	proof := cashu.Proof{
+		Amount: 1,
+		Id:     mint.activeKeyset.Id,
+		Secret: secret,
+		C:      "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf",
+	}
+
+	err = mint.verifyProofs(cashu.Proofs{proof}, []string{"y"})
+	if !errors.Is(err, errCustomCondition) {
+		t.Fatalf("expected error '%v' but got '%v'", errCustomCondition, err)
+	}
+	if !verifierCalled {
+		t.Fatal("expected custom verifier to be called")
+	}
+}
+
+func TestMsatToSat(t *testing.T) {
+	tests := []struct {
+		msat        uint64
+		expectedSat uint64
+	}{
+		{msat: 0, expectedSat: 0},
+		{msat: 1, expectedSat: 1},
+		{msat: 999, expectedSat: 1},
+		{msat: 1000, expectedSat: 1},
+		{msat: 1001, expectedSat: 2},
+		{msat: 21_000_500, expectedSat: 21001},
+	}
+
+	for _, test := range tests {
+		sat := msatToSat(test.msat)
+		if sat != test.expectedSat {
+			t.Fatalf("expected '%v' sats for '%v' msat but got '%v'", test.expectedSat, test.msat, sat)
+		}
+	}
+}
+
+func TestExportImportState(t *testing.T) {
+	fakeBackend := lightning.FakeBackend{}
+	exportMintPath := "./testmintexportstate"
+	importMintPath := "./testmintimportstate"
+	defer os.RemoveAll(exportMintPath)
+	defer os.RemoveAll(importMintPath)
+
+	exportMint, err := LoadMint(Config{
+		MintPath:        exportMintPath,
+		InputFeePpk:     100,
+		LightningClient: &fakeBackend,
+		LogLevel:        Disable,
+	})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+
+	mintQuote, err := exportMint.RequestMintQuote(context.Background(), nut04.PostMintQuoteBolt11Request{Amount: 1000, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("unexpected error requesting mint quote: %v", err)
+	}
+	invoice, _, _, err := lightning.CreateFakeInvoice(500, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := exportMint.RequestMeltQuote(context.Background(), nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+
+	var state bytes.Buffer
+	if err := exportMint.ExportState(&state); err != nil {
+		t.Fatalf("unexpected error exporting state: %v", err)
+	}
+	exported := state.Bytes()
+
+	// mint with quotes should not accept import
+	err = exportMint.ImportState(bytes.NewReader(exported))
+	if !errors.Is(err, ErrMintNotEmpty) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotEmpty, err)
+	}
+
+	importMint, err := LoadMint(Config{
+		MintPath:        importMintPath,
+		LightningClient: &fakeBackend,
+		LogLevel:        Disable,
+	})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+
+	// mint serving requests should not accept import
+	importMint.serving.Store(true)
+	err = importMint.ImportState(bytes.NewReader(exported))
+	if !errors.Is(err, ErrMintServing) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintServing, err)
+	}
+	importMint.serving.Store(false)
+
+	if err := importMint.ImportState(bytes.NewReader(exported)); err != nil {
+		t.Fatalf("unexpected error importing state: %v", err)
+	}
+
+	if importMint.activeKeyset.Id != exportMint.activeKeyset.Id {
+		t.Fatalf("expected active keyset '%v' but got '%v'", exportMint.activeKeyset.Id, importMint.activeKeyset.Id)
+	}
+	if importMint.activeKeyset.InputFeePpk != 100 {
+		t.Fatalf("expected keyset with fee of %v but got %v", 100, importMint.activeKeyset.InputFeePpk)
+	}
+
+	importedMintQuote, err := importMint.db.GetMintQuote(mintQuote.Id)
+	if err != nil {
+		t.Fatalf("expected mint quote '%v' to be imported but got error: %v", mintQuote.Id, err)
+	}
+	if importedMintQuote.PaymentRequest != mintQuote.PaymentRequest {
+		t.Fatalf("expected payment request '%v' but got '%v'", mintQuote.PaymentRequest, importedMintQuote.PaymentRequest)
+	}
+
+	importedMeltQuote, err := importMint.db.GetMeltQuote(meltQuote.Id)
+	if err != nil {
+		t.Fatalf("expected melt quote '%v' to be imported but got error: %v", meltQuote.Id, err)
+	}
+	if importedMeltQuote.AmountMsat != meltQuote.AmountMsat {
+		t.Fatalf("expected amount of %v msat but got %v", meltQuote.AmountMsat, importedMeltQuote.AmountMsat)
+	}
+
+	// reloading the mint should keep the imported keyset
+	importMint, err = LoadMint(Config{
+		MintPath:        importMintPath,
+		LightningClient: &fakeBackend,
+		LogLevel:        Disable,
+	})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	if importMint.activeKeyset.Id != exportMint.activeKeyset.Id {
+		t.Fatalf("expected active keyset '%v' after reload but got '%v'", exportMint.activeKeyset.Id, importMint.activeKeyset.Id)
+	}
+}
+
+func TestDeriveMintKeys(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	masterKey, _ := master.ECPrivKey()
+
+	signingKey, keysendKey, err := deriveMintKeys(master)
+	if err != nil {
+		t.Fatalf("unexpected error deriving keys: %v", err)
+	}
+	if signingKey.Key.Equals(&masterKey.Key) {
+		t.Fatal("expected signing key to be different from master key")
+	}
+	if bytes.Equal(keysendKey, masterKey.Serialize()) || bytes.Equal(keysendKey, signingKey.Serialize()) {
+		t.Fatal("expected keysend key to be different from master and signing keys")
+	}
+
+	// same keys from the same seed
+	signingKey2, keysendKey2, _ := deriveMintKeys(master)
+	if !signingKey.Key.Equals(&signingKey2.Key) || !bytes.Equal(keysendKey, keysendKey2) {
+		t.Fatal("expected same keys derived from the same master key")
+	}
+}
+
+func TestMinAmountLimits(t *testing.T) {
+	testMintPath := "./testmintminlimits"
+	defer os.RemoveAll(testMintPath)
+
+	config := Config{
+		MintPath:        testMintPath,
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        Disable,
+		Limits: MintLimits{
+			MintingSettings: MintMethodSettings{MinAmount: 100, MaxAmount: 10000},
+			MeltingSettings: MeltMethodSettings{MinAmount: 50},
+		},
+	}
+	limitsMint, err := LoadMint(config)
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+
+	// mint amount below min
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: 99, Unit: cashu.Sat.String()}
+	_, err = limitsMint.RequestMintQuote(context.Background(), mintQuoteRequest)
+	if !errors.Is(err, cashu.MintAmountBelowMinErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintAmountBelowMinErr, err)
+	}
+
+	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: 100, Unit: cashu.Sat.String()}
+	if _, err := limitsMint.RequestMintQuote(context.Background(), mintQuoteRequest); err != nil {
+		t.Fatalf("unexpected error requesting mint quote: %v", err)
+	}
+
+	// melt amount below min
+	invoice, _, _, _ := lightning.CreateFakeInvoice(49, false)
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()}
+	_, err = limitsMint.RequestMeltQuote(context.Background(), meltQuoteRequest)
+	if !errors.Is(err, cashu.MeltAmountBelowMinErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltAmountBelowMinErr, err)
+	}
+
+	invoice, _, _, _ = lightning.CreateFakeInvoice(50, false)
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()}
+	if _, err := limitsMint.RequestMeltQuote(context.Background(), meltQuoteRequest); err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+
+	// min greater than max should not be allowed
+	config.Limits.MintingSettings = MintMethodSettings{MinAmount: 1000, MaxAmount: 100}
+	if _, err := LoadMint(config); err == nil {
+		t.Fatal("expected error loading mint with min amount greater than max amount")
+	}
+}
+
+// streamingBackend sends settled invoices on the updates channel
+// to its subscribers.
+type streamingBackend struct {
+	*lightning.FakeBackend
+	updates chan lightning.Invoice
+}
+
+func (b *streamingBackend) SubscribeInvoices(ctx context.Context) (lightning.InvoiceSubscriptionClient, error) {
+	return &streamingInvoicesSub{ctx: ctx, updates: b.updates}, nil
+}
+
+type streamingInvoicesSub struct {
+	ctx     context.Context
+	updates chan lightning.Invoice
+}
+
+func (sub *streamingInvoicesSub) Recv() (lightning.Invoice, error) {
+	select {
+	case invoice := <-sub.updates:
+		return invoice, nil
+	case <-sub.ctx.Done():
+		return lightning.Invoice{}, sub.ctx.Err()
+	}
+}
+
+func TestWatchInvoices(t *testing.T) {
+	backend := &streamingBackend{
+		// invoices will not get settled by the fake backend itself
+		FakeBackend: &lightning.FakeBackend{SettleDelay: 3600},
+		updates:     make(chan lightning.Invoice),
+	}
+	testMintPath := "./testmintwatchinvoices"
+	mint, err := LoadMint(Config{MintPath: testMintPath, LightningClient: backend, LogLevel: Disable})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	defer func() {
+		mint.Shutdown()
+		os.RemoveAll(testMintPath)
+	}()
+
+	mintQuote, err := mint.RequestMintQuote(context.Background(), nut04.PostMintQuoteBolt11Request{Amount: 21, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("unexpected error requesting mint quote: %v", err)
+	}
+
+	// invoices not belonging to a mint quote should be ignored
+	backend.updates <- lightning.Invoice{PaymentHash: "unknownhash", Settled: true}
+	backend.updates <- lightning.Invoice{PaymentHash: mintQuote.PaymentHash, Settled: true}
+
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		quote, err := mint.db.GetMintQuote(mintQuote.Id)
+		if err != nil {
+			t.Fatalf("unexpected error getting mint quote: %v", err)
+		}
+		if quote.State == nut04.Paid {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected mint quote state '%v' but got '%v'", nut04.Paid, quote.State)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+// estimatingBackend returns a fixed fee estimate or an error if fail is set.
+// It keeps the max fee passed for the last payment.
+type estimatingBackend struct {
+	*lightning.FakeBackend
+	feeMsat uint64
+	fail    bool
+	maxFee  uint64
+}
+
+func (b *estimatingBackend) FeeReserve(ctx context.Context, amountMsat uint64) uint64 {
+	return amountMsat / 100
+}
+
+func (b *estimatingBackend) SendPayment(ctx context.Context, request string, maxFee uint64) (lightning.PaymentStatus, error) {
+	b.maxFee = maxFee
+	return b.FakeBackend.SendPayment(ctx, request, maxFee)
+}
+
+func (b *estimatingBackend) EstimateFee(ctx context.Context, request string) (uint64, error) {
+	if b.fail {
+		return 0, errors.New("no route")
+	}
+	return b.feeMsat, nil
+}
+
+func TestMeltQuoteFeeEstimate(t *testing.T) {
+	backend := &estimatingBackend{FakeBackend: &lightning.FakeBackend{}, feeMsat: 5000}
+	mint, err := LoadMint(Config{LightningClient: backend, LogLevel: Disable, DBDriver: Memory})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+
+	invoice, _, _, err := lightning.CreateFakeInvoice(2100, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := mint.RequestMeltQuote(context.Background(), nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	// estimate plus buffer
+	if meltQuote.FeeReserve != 7 || meltQuote.FeeReserveMsat != 6250 {
+		t.Fatalf("expected fee reserve of %v but got %v", 7, meltQuote.FeeReserve)
+	}
+	if meltQuote.EstimatedFeeMsat == nil || *meltQuote.EstimatedFeeMsat != 5000 {
+		t.Fatalf("expected estimated fee of %v msat but got %v", 5000, meltQuote.EstimatedFeeMsat)
+	}
+	if meltQuote.PercentageFeeReserveMsat != 21000 {
+		t.Fatalf("expected percentage fee reserve of %v msat but got %v", 21000, meltQuote.PercentageFeeReserveMsat)
+	}
+
+	// fee reserve should be the limit for the fee of the payment
+	meltQuote, err = mint.MeltTokens(context.Background(), nut05.PostMeltBolt11Request{
+		Quote:  meltQuote.Id,
+		Inputs: keysetProofs(t, mint, 2048, 32, 16, 8, 4),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error melting tokens: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, meltQuote.State)
+	}
+	if backend.maxFee != 7 {
+		t.Fatalf("expected max fee of %v for payment but got %v", 7, backend.maxFee)
+	}
+
+	// estimate of 0 should still leave a min fee reserve
+	backend.feeMsat = 0
+	invoice, _, _, err = lightning.CreateFakeInvoice(2100, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err = mint.RequestMeltQuote(context.Background(), nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	if meltQuote.FeeReserveMsat != minEstimatedFeeReserveMsat {
+		t.Fatalf("expected fee reserve of %v msat but got %v", minEstimatedFeeReserveMsat, meltQuote.FeeReserveMsat)
+	}
+
+	// should fallback to fee reserve from backend if estimate fails
+	backend.fail = true
+	invoice, _, _, err = lightning.CreateFakeInvoice(2100, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err = mint.RequestMeltQuote(context.Background(), nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	if meltQuote.FeeReserve != 21 {
+		t.Fatalf("expected fee reserve of %v but got %v", 21, meltQuote.FeeReserve)
+	}
+	if meltQuote.EstimatedFeeMsat != nil {
+		t.Fatalf("expected no estimated fee but got %v", *meltQuote.EstimatedFeeMsat)
+	}
+}
+
+// keysetProofs returns valid proofs signed with the active keyset of the mint
+func keysetProofs(t *testing.T, m *Mint, amounts ...uint64) cashu.Proofs {
+	proofs := make(cashu.Proofs, len(amounts))
+	for i, amount := range amounts {
+		secret, err := cashu.GenerateRandomQuoteId()
+		if err != nil {
+			t.Fatalf("error generating secret: %v", err)
+		}
+		Y, err := crypto.HashToCurve([]byte(secret))
+		if err != nil {
+			t.Fatalf("error hashing secret: %v", err)
+		}
+		C := crypto.SignBlindedMessage(Y, m.activeKeyset.Keys[amount].PrivateKey)
+		proofs[i] = cashu.Proof{
+			Amount: amount,
+			Id:     m.activeKeyset.Id,
+			Secret: secret,
+			C:      hex.EncodeToString(C.SerializeCompressed()),
+		}
+	}
+	return proofs
+}
+
+func TestKeysendMelt(t *testing.T) {
+	mint, err := LoadMint(Config{LightningClient: &lightning.FakeBackend{}, LogLevel: Disable, DBDriver: Memory})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+
+	mint.SetMintInfo(MintInfo{})
+	info, err := mint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatalf("error getting mint info: %v", err)
+	}
+	keysendSupported := slices.ContainsFunc(info.Nuts.Nut05.Methods, func(method nut06.MethodSetting) bool {
+		return method.Method == cashu.KEYSEND_METHOD
+	})
+	if !keysendSupported {
+		t.Fatal("expected keysend method in mint info")
+	}
+
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	destination := hex.EncodeToString(key.PubKey().SerializeCompressed())
+
+	invalidRequest := nut05.PostMeltQuoteKeysendRequest{Request: "notapubkey", Amount: 64, Unit: cashu.Sat.String()}
+	_, err = mint.RequestKeysendMeltQuote(context.Background(), invalidRequest)
+	var cashuErr *cashu.Error
+	if !errors.As(err, &cashuErr) || cashuErr.Code != cashu.MeltQuoteErrCode {
+		t.Fatalf("expected melt quote error for invalid destination but got '%v'", err)
+	}
+
+	meltQuoteRequest := nut05.PostMeltQuoteKeysendRequest{Request: destination, Amount: 64, Unit: cashu.Sat.String()}
+	meltQuote, err := mint.RequestKeysendMeltQuote(context.Background(), meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("unexpected error requesting keysend melt quote: %v", err)
+	}
+	if meltQuote.Method != cashu.KEYSEND_METHOD {
+		t.Fatalf("expected method '%v' but got '%v'", cashu.KEYSEND_METHOD, meltQuote.Method)
+	}
+
+	meltRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: keysetProofs(t, mint, 64)}
+	meltQuote, err = mint.MeltTokens(context.Background(), meltRequest)
+	if err != nil {
+		t.Fatalf("unexpected error melting tokens: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, meltQuote.State)
+	}
+	preimage, err := hex.DecodeString(meltQuote.Preimage)
+	if err != nil {
+		t.Fatalf("invalid preimage: %v", err)
+	}
+	hash := sha256.Sum256(preimage)
+	if hex.EncodeToString(hash[:]) != meltQuote.PaymentHash {
+		t.Fatalf("expected preimage to match payment hash '%v'", meltQuote.PaymentHash)
+	}
+
+	// backend without keysend should reject quote
+	noKeysendPath := "./testmintnokeysend"
+	noKeysendMint, err := LoadMint(Config{
+		MintPath:        noKeysendPath,
+		LightningClient: struct{ lightning.Client }{&lightning.FakeBackend{}},
+		LogLevel:        Disable,
+	})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	defer os.RemoveAll(noKeysendPath)
+
+	_, err = noKeysendMint.RequestKeysendMeltQuote(context.Background(), meltQuoteRequest)
+	if !errors.Is(err, cashu.PaymentMethodNotSupportedErr) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.PaymentMethodNotSupportedErr, err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	// invoices will not get settled by the fake backend itself
+	backend := &lightning.FakeBackend{SettleDelay: 3600}
+	mint, err := LoadMint(Config{LightningClient: backend, LogLevel: Disable, DBDriver: Memory})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	defer mint.Shutdown()
+	ctx := context.Background()
+
+	// mint quotes are saved directly so that the mint does not
+	// start watching their invoices and only Reconcile updates them
+	unpaidMintQuote := func() storage.MintQuote {
+		invoice, err := backend.CreateInvoice(ctx, 21)
+		if err != nil {
+			t.Fatalf("error creating invoice: %v", err)
+		}
+		quoteId, _ := cashu.GenerateRandomQuoteId()
+		mintQuote := storage.MintQuote{
+			Id:             quoteId,
+			Amount:         21,
+			PaymentRequest: invoice.PaymentRequest,
+			PaymentHash:    invoice.PaymentHash,
+			State:          nut04.Unpaid,
+			Expiry:         uint64(time.Now().Add(time.Hour).Unix()),
+		}
+		if err := mint.db.SaveMintQuote(mintQuote); err != nil {
+			t.Fatalf("error saving mint quote: %v", err)
+		}
+		return mintQuote
+	}
+	paidQuote := unpaidMintQuote()
+	unpaidQuote := unpaidMintQuote()
+	// invoice settled without the mint getting notified
+	backend.SetInvoiceStatus(paidQuote.PaymentHash, lightning.Succeeded)
+
+	// melt quotes left pending while the payments completed in the backend
+	pendingMeltQuote := func(failPayment bool) (storage.MeltQuote, cashu.Proofs) {
+		invoice, _, paymentHash, err := lightning.CreateFakeInvoice(8000, failPayment)
+		if err != nil {
+			t.Fatalf("error creating invoice: %v", err)
+		}
+		if _, err := backend.SendPayment(ctx, invoice, 0); err != nil {
+			t.Fatalf("unexpected error sending payment: %v", err)
+		}
+		quoteId, _ := cashu.GenerateRandomQuoteId()
+		meltQuote := storage.MeltQuote{
+			Id:             quoteId,
+			InvoiceRequest: invoice,
+			PaymentHash:    paymentHash,
+			Amount:         8,
+			State:          nut05.Pending,
+			Expiry:         uint64(time.Now().Add(time.Hour).Unix()),
+		}
+		if err := mint.db.SaveMeltQuote(meltQuote); err != nil {
+			t.Fatalf("error saving melt quote: %v", err)
+		}
+		proofs := keysetProofs(t, mint, 8)
+		if err := mint.db.AddPendingProofs(proofs, quoteId); err != nil {
+			t.Fatalf("error adding pending proofs: %v", err)
+		}
+		return meltQuote, proofs
+	}
+	succeededMelt, _ := pendingMeltQuote(false)
+	failedMelt, _ := pendingMeltQuote(true)
+
+	report, err := mint.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error reconciling quotes: %v", err)
+	}
+	if report.MintQuotesChecked != 2 || report.MeltQuotesChecked != 2 {
+		t.Fatalf("expected 2 mint and 2 melt quotes checked but got %v and %v",
+			report.MintQuotesChecked, report.MeltQuotesChecked)
+	}
+	if len(report.Discrepancies) != 3 {
+		t.Fatalf("expected 3 discrepancies but got %v", len(report.Discrepancies))
+	}
+
+	if quote, _ := mint.db.GetMintQuote(paidQuote.Id); quote.State != nut04.Paid {
+		t.Fatalf("expected mint quote state '%v' but got '%v'", nut04.Paid, quote.State)
+	}
+	if quote, _ := mint.db.GetMintQuote(unpaidQuote.Id); quote.State != nut04.Unpaid {
+		t.Fatalf("expected mint quote state '%v' but got '%v'", nut04.Unpaid, quote.State)
+	}
+
+	if quote, _ := mint.db.GetMeltQuote(succeededMelt.Id); quote.State != nut05.Paid {
+		t.Fatalf("expected melt quote state '%v' but got '%v'", nut05.Paid, quote.State)
+	}
+	if quote, _ := mint.db.GetMeltQuote(failedMelt.Id); quote.State != nut05.Unpaid {
+		t.Fatalf("expected melt quote state '%v' but got '%v'", nut05.Unpaid, quote.State)
+	}
+	for _, quoteId := range []string{succeededMelt.Id, failedMelt.Id} {
+		if pending, _ := mint.db.GetPendingProofsByQuote(quoteId); len(pending) != 0 {
+			t.Fatalf("expected no pending proofs for quote '%v' but got %v", quoteId, len(pending))
+		}
+	}
+
+	// nothing left to fix
+	report, err = mint.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error reconciling quotes: %v", err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Fatalf("expected no discrepancies but got %v", report.Discrepancies)
+	}
+}
+
+// forgetfulBackend reports payments it has never seen as failed like LNDHub and NWC do.
+type forgetfulBackend struct {
+	*lightning.FakeBackend
+}
+
+func (b *forgetfulBackend) OutgoingPaymentStatus(ctx context.Context, hash string) (lightning.PaymentStatus, error) {
+	paymentStatus, err := b.FakeBackend.OutgoingPaymentStatus(ctx, hash)
+	if err != nil {
+		return lightning.PaymentStatus{PaymentStatus: lightning.Failed}, nil
+	}
+	return paymentStatus, nil
+}
+
+func TestMeltFailoverBackend(t *testing.T) {
+	primary := &forgetfulBackend{FakeBackend: &lightning.FakeBackend{}}
+	fallback := &forgetfulBackend{FakeBackend: &lightning.FakeBackend{}}
+	failoverClient, err := lightning.NewFailoverClient(lightning.FailoverConfig{
+		Backends: []lightning.FailoverBackend{
+			{Name: "primary", Client: primary},
+			{Name: "fallback", Client: fallback},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error setting up failover client: %v", err)
+	}
+	mint, err := LoadMint(Config{LightningClient: failoverClient, LogLevel: Disable, DBDriver: Memory})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	defer mint.Shutdown()
+	ctx := context.Background()
+
+	invoice, _, _, err := lightning.CreateFakeInvoice(8, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := mint.RequestMeltQuote(ctx, nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	meltQuote, err = mint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: keysetProofs(t, mint, 8)})
+	if err != nil {
+		t.Fatalf("unexpected error melting tokens: %v", err)
+	}
+	if quote, _ := mint.db.GetMeltQuote(meltQuote.Id); quote.Backend != "primary" {
+		t.Fatalf("expected melt quote backend 'primary' but got '%v'", quote.Backend)
+	}
+
+	// pending melt quotes left from before a restart
+	pendingMeltQuote := func(backend string) storage.MeltQuote {
+		invoice, _, paymentHash, err := lightning.CreateFakeInvoice(8, false)
+		if err != nil {
+			t.Fatalf("error creating invoice: %v", err)
+		}
+		quoteId, _ := cashu.GenerateRandomQuoteId()
+		meltQuote := storage.MeltQuote{
+			Id:             quoteId,
+			InvoiceRequest: invoice,
+			PaymentHash:    paymentHash,
+			Amount:         8,
+			State:          nut05.Pending,
+			Expiry:         uint64(time.Now().Add(time.Hour).Unix()),
+			Backend:        backend,
+		}
+		if err := mint.db.SaveMeltQuote(meltQuote); err != nil {
+			t.Fatalf("error saving melt quote: %v", err)
+		}
+		if err := mint.db.AddPendingProofs(keysetProofs(t, mint, 8), quoteId); err != nil {
+			t.Fatalf("error adding pending proofs: %v", err)
+		}
+		return meltQuote
+	}
+
+	// primary does not know the payment sent by fallback and reports it as failed
+	paidQuote := pendingMeltQuote("fallback")
+	if _, err := fallback.SendPayment(ctx, paidQuote.InvoiceRequest, 0); err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	quote, err := mint.GetMeltQuoteState(ctx, paidQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if quote.State != nut05.Paid {
+		t.Fatalf("expected melt quote state '%v' but got '%v'", nut05.Paid, quote.State)
+	}
+
+	// without the backend, failed from a backend should not release the proofs
+	unknownQuote := pendingMeltQuote("")
+	quote, err = mint.GetMeltQuoteState(ctx, unknownQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if quote.State != nut05.Pending {
+		t.Fatalf("expected melt quote state '%v' but got '%v'", nut05.Pending, quote.State)
+	}
+	if pending, _ := mint.db.GetPendingProofsByQuote(unknownQuote.Id); len(pending) != 1 {
+		t.Fatalf("expected proofs for quote to still be pending but got %v", len(pending))
+	}
+}
+
+// unavailableBackend fails payments with ErrBackendUnavailable as
+// backends do while their circuit breaker is open. If available is set
+// it reports being available but payments still fail.
+type unavailableBackend struct {
+	*lightning.FakeBackend
+	available bool
+}
+
+func (b *unavailableBackend) Available(ctx context.Context) bool {
+	return b.available
+}
+
+func (b *unavailableBackend) SendPayment(ctx context.Context, request string, maxFee uint64) (lightning.PaymentStatus, error) {
+	return lightning.PaymentStatus{}, lightning.ErrBackendUnavailable
+}
+
+func TestMeltBackendUnavailable(t *testing.T) {
+	backend := &unavailableBackend{FakeBackend: &lightning.FakeBackend{}}
+	mint, err := LoadMint(Config{LightningClient: backend, LogLevel: Disable, DBDriver: Memory})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	ctx := context.Background()
+
+	melt := func() {
+		invoice, _, _, err := lightning.CreateFakeInvoice(8, false)
+		if err != nil {
+			t.Fatalf("error creating invoice: %v", err)
+		}
+		meltQuote, err := mint.RequestMeltQuote(ctx, nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+		if err != nil {
+			t.Fatalf("unexpected error requesting melt quote: %v", err)
+		}
+		_, err = mint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: keysetProofs(t, mint, 8)})
+		if !errors.Is(err, cashu.LightningBackendUnavailable) {
+			t.Fatalf("expected error '%v' but got '%v' instead", cashu.LightningBackendUnavailable, err)
+		}
+
+		quote, err := mint.db.GetMeltQuote(meltQuote.Id)
+		if err != nil {
+			t.Fatalf("unexpected error getting melt quote: %v", err)
+		}
+		if quote.State != nut05.Unpaid {
+			t.Fatalf("expected melt quote state '%v' but got '%v'", nut05.Unpaid, quote.State)
+		}
+		if pending, _ := mint.db.GetPendingProofsByQuote(meltQuote.Id); len(pending) != 0 {
+			t.Fatalf("expected no pending proofs for quote but got %v", len(pending))
+		}
+	}
+
+	// breaker is open before the proofs are set as pending
+	melt()
+
+	// breaker opens after the check so the payment fails without being sent
+	backend.available = true
+	melt()
+}
+
+func TestReadReplica(t *testing.T) {
+	_, err := LoadMint(Config{
+		LightningClient:   &lightning.FakeBackend{},
+		LogLevel:          Disable,
+		DBDriver:          Memory,
+		DBReadReplicaPath: t.TempDir(),
+	})
+	if err == nil {
+		t.Fatal("expected error using read replica with in-memory db")
+	}
+
+	// replica copied before the proofs are spent lags the primary
+	mintPath, replicaPath := t.TempDir(), t.TempDir()
+	mint, err := LoadMint(Config{MintPath: mintPath, LightningClient: &lightning.FakeBackend{}, LogLevel: Disable})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	if err := mint.BackupDB(filepath.Join(replicaPath, "mint.sqlite.db")); err != nil {
+		t.Fatalf("error copying db to replica: %v", err)
+	}
+	mint.Shutdown()
+
+	mint, err = LoadMint(Config{
+		MintPath:          mintPath,
+		LightningClient:   &lightning.FakeBackend{},
+		LogLevel:          Disable,
+		DBReadReplicaPath: replicaPath,
+	})
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	defer mint.Shutdown()
+
+	proofs := keysetProofs(t, mint, 1, 2)
+	if err := mint.db.SaveProofs(proofs[:1]); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+
+	// state of proofs is read from the primary
+	states, err := mint.ProofsStateCheck(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error checking proofs state: %v", err)
+	}
+	if states[0].State != nut07.Spent || states[1].State != nut07.Unspent {
+		t.Fatalf("expected states '%v' and '%v' but got '%v' and '%v'",
+			nut07.Spent, nut07.Unspent, states[0].State, states[1].State)
+	}
+
+	// primary without a schema version cannot be compared with the replica
+	if _, err := openReadReplica(SQLite, replicaPath, inmem.NewInMemoryDB()); err == nil {
+		t.Fatal("expected error opening replica for db without schema version")
+	}
+}
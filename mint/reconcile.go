@@ -0,0 +1,184 @@
+package mint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+)
+
+const (
+	// number of quotes read from the db at a time when reconciling
+	reconcileBatchSize = 100
+	// unpaid mint quotes are still checked for this long after they expire
+	// in case the invoice was paid right before expiring
+	reconcileExpiredWindow = time.Hour * 24
+)
+
+// QuoteDiscrepancy is a quote that had a different state in the db than
+// what the lightning backend reported. The quote is updated to State.
+type QuoteDiscrepancy struct {
+	QuoteId     string `json:"quote_id"`
+	PaymentHash string `json:"payment_hash"`
+	// "mint" or "melt"
+	Kind          string `json:"kind"`
+	PreviousState string `json:"previous_state"`
+	State         string `json:"state"`
+}
+
+// ReconcileReport has the result of reconciling quotes with the lightning backend.
+type ReconcileReport struct {
+	MintQuotesChecked int `json:"mint_quotes_checked"`
+	MeltQuotesChecked int `json:"melt_quotes_checked"`
+	// quotes that could not be checked because the backend returned an error
+	Errors        int                `json:"errors"`
+	Discrepancies []QuoteDiscrepancy `json:"discrepancies"`
+}
+
+// Reconcile checks the mint quotes that are unpaid and the melt quotes that are
+// pending against the lightning backend. Quotes whose invoice or payment was
+// settled without the mint being notified are updated to the state from the backend.
+func (m *Mint) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	report := ReconcileReport{Discrepancies: []QuoteDiscrepancy{}}
+
+	if err := m.reconcileMintQuotes(ctx, &report); err != nil {
+		return report, err
+	}
+	if err := m.reconcileMeltQuotes(ctx, &report); err != nil {
+		return report, err
+	}
+
+	if len(report.Discrepancies) > 0 {
+		m.logInfof("reconciled %v quotes that were out of sync with the lightning backend",
+			len(report.Discrepancies))
+	}
+	return report, nil
+}
+
+func (m *Mint) reconcileMintQuotes(ctx context.Context, report *ReconcileReport) error {
+	checkAfter := time.Now().Add(-reconcileExpiredWindow).Unix()
+
+	offset := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		quotes, err := m.db.ListMintQuotes(nut04.Unpaid, reconcileBatchSize, offset)
+		if err != nil {
+			return fmt.Errorf("error reading mint quotes from db: %v", err)
+		}
+
+		for _, quote := range quotes {
+			if int64(quote.Expiry) < checkAfter {
+				continue
+			}
+			report.MintQuotesChecked++
+
+			reqCtx, cancel := context.WithTimeout(ctx, lightningRequestTimeout)
+			invoice, err := m.lightningClient.InvoiceStatus(reqCtx, quote.PaymentHash)
+			cancel()
+			if err != nil {
+				m.logErrorf("could not check invoice for mint quote '%v': %v", quote.Id, err)
+				report.Errors++
+				continue
+			}
+			if !invoice.Settled {
+				continue
+			}
+
+			m.logInfof("invoice for mint quote '%v' was paid but quote was UNPAID. Setting it to PAID", quote.Id)
+			if err := m.setMintQuotePaid(quote); err != nil {
+				return err
+			}
+			report.Discrepancies = append(report.Discrepancies, QuoteDiscrepancy{
+				QuoteId:       quote.Id,
+				PaymentHash:   quote.PaymentHash,
+				Kind:          "mint",
+				PreviousState: nut04.Unpaid.String(),
+				State:         nut04.Paid.String(),
+			})
+			// quote is not in the list of unpaid quotes anymore
+			offset--
+		}
+
+		if len(quotes) < reconcileBatchSize {
+			return nil
+		}
+		offset += len(quotes)
+	}
+}
+
+func (m *Mint) reconcileMeltQuotes(ctx context.Context, report *ReconcileReport) error {
+	offset := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		quotes, err := m.db.ListMeltQuotes(nut05.Pending, reconcileBatchSize, offset)
+		if err != nil {
+			return fmt.Errorf("error reading melt quotes from db: %v", err)
+		}
+
+		for _, quote := range quotes {
+			// payment is being sent right now, the melt will update the quote
+			if err := m.inflightPayments.Add(quote.PaymentHash); err != nil {
+				continue
+			}
+			report.MeltQuotesChecked++
+
+			reqCtx, cancel := context.WithTimeout(paymentContext(ctx, quote), lightningRequestTimeout)
+			paymentStatus, err := m.lightningClient.OutgoingPaymentStatus(reqCtx, quote.PaymentHash)
+			cancel()
+			if err != nil {
+				m.inflightPayments.Remove(quote.PaymentHash)
+				m.logErrorf("could not check payment for melt quote '%v': %v", quote.Id, err)
+				report.Errors++
+				continue
+			}
+			updated, err := m.updatePendingMeltQuote(quote, paymentStatus)
+			m.inflightPayments.Remove(quote.PaymentHash)
+			if err != nil {
+				return err
+			}
+			if updated.State == nut05.Pending {
+				continue
+			}
+
+			m.logInfof("payment for melt quote '%v' is no longer pending. Quote set to %v",
+				quote.Id, updated.State)
+			report.Discrepancies = append(report.Discrepancies, QuoteDiscrepancy{
+				QuoteId:       quote.Id,
+				PaymentHash:   quote.PaymentHash,
+				Kind:          "melt",
+				PreviousState: nut05.Pending.String(),
+				State:         updated.State.String(),
+			})
+			offset--
+		}
+
+		if len(quotes) < reconcileBatchSize {
+			return nil
+		}
+		offset += len(quotes)
+	}
+}
+
+// reconcileQuotesPeriodically runs Reconcile every interval until ctx is done.
+func (m *Mint) reconcileQuotesPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			m.logErrorf("could not reconcile quotes with lightning backend: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package mint
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// how often old data is deleted if the retention policy does not set it
+const defaultRetentionInterval = time.Hour * 24
+
+// ErrNoRetentionPolicy is returned when pruning data
+// without a retention policy set in the config.
+var ErrNoRetentionPolicy = errors.New("mint does not have a retention policy")
+
+// PruneData deletes the quotes and blind signatures older than what
+// the retention policy of the mint keeps. With dryRun it only reports
+// what would be deleted.
+func (m *Mint) PruneData(dryRun bool) (storage.PruneResult, error) {
+	if !m.retention.enabled() {
+		return storage.PruneResult{}, ErrNoRetentionPolicy
+	}
+
+	cutoffs := m.retention.cutoffs(time.Now())
+	result, err := m.db.Prune(cutoffs, dryRun)
+	if err != nil {
+		return storage.PruneResult{}, err
+	}
+	if !dryRun {
+		m.logInfof("pruned %v mint quotes, %v melt quotes and %v blind signatures",
+			result.MintQuotes, result.MeltQuotes, result.BlindSignatures)
+	}
+	return result, nil
+}
+
+// cutoffs returns the times before which data is deleted.
+// Data without a retention period gets a zero cutoff so it is kept.
+func (policy RetentionPolicy) cutoffs(now time.Time) storage.PruneCutoffs {
+	cutoff := func(days uint) int64 {
+		if days == 0 {
+			return 0
+		}
+		return now.Add(-time.Hour * 24 * time.Duration(days)).Unix()
+	}
+
+	return storage.PruneCutoffs{
+		MintQuotes:      cutoff(policy.MintQuoteDays),
+		MeltQuotes:      cutoff(policy.MeltQuoteDays),
+		BlindSignatures: cutoff(policy.BlindSignatureDays),
+	}
+}
+
+// pruneDataPeriodically runs PruneData on the interval of the
+// retention policy until ctx is done.
+func (m *Mint) pruneDataPeriodically(ctx context.Context) {
+	interval := m.retention.Interval
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.PruneData(false); err != nil {
+			m.logErrorf("could not prune data: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
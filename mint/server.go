@@ -23,6 +23,7 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/mint/storage"
 	"github.com/gorilla/mux"
 )
 
@@ -158,6 +159,7 @@ func (ms *MintServer) Start() error {
 	}()
 
 	ms.mint.logger.Info("mint server listening on: " + ms.httpServer.Addr)
+	ms.mint.serving.Store(true)
 	err := ms.httpServer.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		return err
@@ -167,18 +169,20 @@ func (ms *MintServer) Start() error {
 	return nil
 }
 
+// Shutdown stops accepting requests and waits for the ones in flight
+// to finish before shutting down the mint, which zeroes its keys.
 func (ms *MintServer) Shutdown() error {
 	ms.mint.logger.Info("starting shutdown")
-	if err := ms.mint.Shutdown(); err != nil {
+	if err := ms.httpServer.Shutdown(context.Background()); err != nil {
 		return err
 	}
+	// websocket connections are hijacked so they are not
+	// closed by the http server
 	if err := ms.websocketManager.Shutdown(); err != nil {
 		return err
 	}
-	if err := ms.httpServer.Shutdown(context.Background()); err != nil {
-		return err
-	}
-	return nil
+	ms.mint.serving.Store(false)
+	return ms.mint.Shutdown()
 }
 
 func (ms *MintServer) setupHttpServer(port int) {
@@ -265,16 +269,37 @@ func (ms *MintServer) writeErr(rw http.ResponseWriter, req *http.Request, errRes
 	)
 	_ = ms.mint.logger.Handler().Handle(context.Background(), r)
 
+	// respond with errors that are not cashu errors
+	// with the standard code instead of an empty body
+	var cashuErr *cashu.Error
+	if !errors.As(errResponse, &cashuErr) {
+		cashuErr = cashu.BuildCashuError(errResponse.Error(), cashu.StandardErrCode)
+	}
+
 	rw.WriteHeader(code)
-	errRes, _ := json.Marshal(errResponse)
+	errRes, _ := json.Marshal(cashuErr)
 	rw.Write(errRes)
 }
 
+// writeSigned writes the response body along with the
+// mint's signature of it in the SIGNATURE_HEADER.
+func (ms *MintServer) writeSigned(rw http.ResponseWriter, req *http.Request, body []byte) {
+	signature, err := ms.mint.SignResponse(body)
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr, fmt.Sprintf("error signing response: %v", err))
+		return
+	}
+	if len(signature) > 0 {
+		rw.Header().Set(cashu.SIGNATURE_HEADER, signature)
+	}
+	rw.Write(body)
+}
+
 func (ms *MintServer) getActiveKeysets(rw http.ResponseWriter, req *http.Request) {
 	activeKeysetResponse, found := ms.cache.Get(ACTIVE_KEYSET)
 	if found {
 		ms.logRequest(req, http.StatusOK, "returning active keyset from cache")
-		rw.Write(activeKeysetResponse)
+		ms.writeSigned(rw, req, activeKeysetResponse)
 		return
 	}
 
@@ -289,7 +314,7 @@ func (ms *MintServer) getActiveKeysets(rw http.ResponseWriter, req *http.Request
 	ms.cache.Set(ACTIVE_KEYSET, jsonRes, time.Second*KEYSET_TTL)
 
 	ms.logRequest(req, http.StatusOK, "returning active keysets")
-	rw.Write(jsonRes)
+	ms.writeSigned(rw, req, jsonRes)
 }
 
 func (ms *MintServer) getKeysetsList(rw http.ResponseWriter, req *http.Request) {
@@ -300,7 +325,7 @@ func (ms *MintServer) getKeysetsList(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 	ms.logRequest(req, http.StatusOK, "returning list of all keysets")
-	rw.Write(jsonRes)
+	ms.writeSigned(rw, req, jsonRes)
 }
 
 func (ms *MintServer) getKeysetById(rw http.ResponseWriter, req *http.Request) {
@@ -310,7 +335,7 @@ func (ms *MintServer) getKeysetById(rw http.ResponseWriter, req *http.Request) {
 	keysetResponse, found := ms.cache.Get(id)
 	if found {
 		ms.logRequest(req, http.StatusOK, "returning keyset with id: %v from cache", id)
-		rw.Write(keysetResponse)
+		ms.writeSigned(rw, req, keysetResponse)
 		return
 	}
 
@@ -329,7 +354,7 @@ func (ms *MintServer) getKeysetById(rw http.ResponseWriter, req *http.Request) {
 	ms.cache.Set(id, jsonRes, time.Second*KEYSET_TTL)
 
 	ms.logRequest(req, http.StatusOK, "returning keyset with id: %v", id)
-	rw.Write(jsonRes)
+	ms.writeSigned(rw, req, jsonRes)
 }
 
 func (ms *MintServer) mintRequest(rw http.ResponseWriter, req *http.Request) {
@@ -348,9 +373,10 @@ func (ms *MintServer) mintRequest(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	ms.logRequest(req, 0, "mint request for %v %v", mintReq.Amount, mintReq.Unit)
-	mintQuote, err := ms.mint.RequestMintQuote(mintReq)
+	mintQuote, err := ms.mint.RequestMintQuote(req.Context(), mintReq)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from lightning backend generating invoice
 		// or error from db, log that error but return generic response
 		if ok {
@@ -394,9 +420,10 @@ func (ms *MintServer) mintQuoteState(rw http.ResponseWriter, req *http.Request)
 	}
 
 	quoteId := vars["quote_id"]
-	mintQuote, err := ms.mint.GetMintQuoteState(quoteId)
+	mintQuote, err := ms.mint.GetMintQuoteState(req.Context(), quoteId)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from lightning backend
 		// or error from db, log that error but return generic response
 		if ok {
@@ -462,9 +489,10 @@ func (ms *MintServer) mintTokensRequest(rw http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	blindedSignatures, err := ms.mint.MintTokens(mintReq)
+	blindedSignatures, err := ms.mint.MintTokens(req.Context(), mintReq)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from lightning backend
 		// or error from db, log that error but return generic response
 		if ok {
@@ -519,7 +547,8 @@ func (ms *MintServer) swapRequest(rw http.ResponseWriter, req *http.Request) {
 
 	blindedSignatures, err := ms.mint.Swap(swapReq.Inputs, swapReq.Outputs)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from db
 		// log that error but return generic response
 		if ok && cashuErr.Code == cashu.DBErrCode {
@@ -550,21 +579,31 @@ func (ms *MintServer) swapRequest(rw http.ResponseWriter, req *http.Request) {
 func (ms *MintServer) meltQuoteRequest(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
-	if method != cashu.BOLT11_METHOD {
-		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
-		return
-	}
 
-	var meltRequest nut05.PostMeltQuoteBolt11Request
-	err := decodeJsonReqBody(req, &meltRequest)
-	if err != nil {
-		ms.writeErr(rw, req, err)
+	var meltQuote storage.MeltQuote
+	var err error
+	switch method {
+	case cashu.BOLT11_METHOD:
+		var meltRequest nut05.PostMeltQuoteBolt11Request
+		if err := decodeJsonReqBody(req, &meltRequest); err != nil {
+			ms.writeErr(rw, req, err)
+			return
+		}
+		meltQuote, err = ms.mint.RequestMeltQuote(req.Context(), meltRequest)
+	case cashu.KEYSEND_METHOD:
+		var meltRequest nut05.PostMeltQuoteKeysendRequest
+		if err := decodeJsonReqBody(req, &meltRequest); err != nil {
+			ms.writeErr(rw, req, err)
+			return
+		}
+		meltQuote, err = ms.mint.RequestKeysendMeltQuote(req.Context(), meltRequest)
+	default:
+		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
-
-	meltQuote, err := ms.mint.RequestMeltQuote(meltRequest)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from db
 		// log that error but return generic response
 		if ok && cashuErr.Code == cashu.DBErrCode {
@@ -576,13 +615,15 @@ func (ms *MintServer) meltQuoteRequest(rw http.ResponseWriter, req *http.Request
 	}
 
 	meltQuoteResponse := &nut05.PostMeltQuoteBolt11Response{
-		Quote:      meltQuote.Id,
-		Request:    meltQuote.InvoiceRequest,
-		Amount:     meltQuote.Amount,
-		Unit:       cashu.Sat.String(),
-		FeeReserve: meltQuote.FeeReserve,
-		State:      meltQuote.State,
-		Expiry:     meltQuote.Expiry,
+		Quote:                meltQuote.Id,
+		Request:              meltQuote.InvoiceRequest,
+		Amount:               meltQuote.Amount,
+		Unit:                 cashu.Sat.String(),
+		FeeReserve:           meltQuote.FeeReserve,
+		State:                meltQuote.State,
+		PercentageFeeReserve: msatToSat(meltQuote.PercentageFeeReserveMsat),
+		EstimatedFee:         estimatedFee(meltQuote),
+		Expiry:               meltQuote.Expiry,
 	}
 
 	jsonRes, err := json.Marshal(&meltQuoteResponse)
@@ -600,18 +641,19 @@ func (ms *MintServer) meltQuoteRequest(rw http.ResponseWriter, req *http.Request
 func (ms *MintServer) meltQuoteState(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
-	if method != cashu.BOLT11_METHOD {
+	if method != cashu.BOLT11_METHOD && method != cashu.KEYSEND_METHOD {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(req.Context(), time.Second*5)
 	defer cancel()
 
 	quoteId := vars["quote_id"]
 	meltQuote, err := ms.mint.GetMeltQuoteState(ctx, quoteId)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from lightning backend
 		// or error from db, log that error but return generic response
 		if ok {
@@ -625,14 +667,16 @@ func (ms *MintServer) meltQuoteState(rw http.ResponseWriter, req *http.Request)
 	}
 
 	quoteState := &nut05.PostMeltQuoteBolt11Response{
-		Quote:      meltQuote.Id,
-		Request:    meltQuote.InvoiceRequest,
-		Amount:     meltQuote.Amount,
-		Unit:       cashu.Sat.String(),
-		FeeReserve: meltQuote.FeeReserve,
-		State:      meltQuote.State,
-		Expiry:     meltQuote.Expiry,
-		Preimage:   meltQuote.Preimage,
+		Quote:                meltQuote.Id,
+		Request:              meltQuote.InvoiceRequest,
+		Amount:               meltQuote.Amount,
+		Unit:                 cashu.Sat.String(),
+		FeeReserve:           meltQuote.FeeReserve,
+		State:                meltQuote.State,
+		PercentageFeeReserve: msatToSat(meltQuote.PercentageFeeReserveMsat),
+		EstimatedFee:         estimatedFee(meltQuote),
+		Expiry:               meltQuote.Expiry,
+		Preimage:             meltQuote.Preimage,
 	}
 
 	jsonRes, err := json.Marshal(&quoteState)
@@ -648,7 +692,7 @@ func (ms *MintServer) meltQuoteState(rw http.ResponseWriter, req *http.Request)
 func (ms *MintServer) meltTokens(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
-	if method != cashu.BOLT11_METHOD {
+	if method != cashu.BOLT11_METHOD && method != cashu.KEYSEND_METHOD {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
@@ -664,12 +708,15 @@ func (ms *MintServer) meltTokens(rw http.ResponseWriter, req *http.Request) {
 	if ms.meltTimeout != nil {
 		timeout = *ms.meltTimeout
 	}
+	// not using the request context here so that the payment
+	// does not get canceled if the client disconnects
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	meltQuote, err := ms.mint.MeltTokens(ctx, meltTokensRequest)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from lightning backend
 		// or error from db, log that error but return generic response
 		if ok {
@@ -687,14 +734,16 @@ func (ms *MintServer) meltTokens(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	meltQuoteResponse := &nut05.PostMeltQuoteBolt11Response{
-		Quote:      meltQuote.Id,
-		Request:    meltQuote.InvoiceRequest,
-		Amount:     meltQuote.Amount,
-		Unit:       cashu.Sat.String(),
-		FeeReserve: meltQuote.FeeReserve,
-		State:      meltQuote.State,
-		Expiry:     meltQuote.Expiry,
-		Preimage:   meltQuote.Preimage,
+		Quote:                meltQuote.Id,
+		Request:              meltQuote.InvoiceRequest,
+		Amount:               meltQuote.Amount,
+		Unit:                 cashu.Sat.String(),
+		FeeReserve:           meltQuote.FeeReserve,
+		State:                meltQuote.State,
+		PercentageFeeReserve: msatToSat(meltQuote.PercentageFeeReserveMsat),
+		EstimatedFee:         estimatedFee(meltQuote),
+		Expiry:               meltQuote.Expiry,
+		Preimage:             meltQuote.Preimage,
 	}
 
 	jsonRes, err := json.Marshal(&meltQuoteResponse)
@@ -709,6 +758,15 @@ func (ms *MintServer) meltTokens(rw http.ResponseWriter, req *http.Request) {
 	rw.Write(jsonRes)
 }
 
+// estimatedFee returns the fee estimate of the melt quote in sats, if any
+func estimatedFee(meltQuote storage.MeltQuote) *uint64 {
+	if meltQuote.EstimatedFeeMsat == nil {
+		return nil
+	}
+	fee := msatToSat(*meltQuote.EstimatedFeeMsat)
+	return &fee
+}
+
 func (ms *MintServer) tokenStateCheck(rw http.ResponseWriter, req *http.Request) {
 	var stateRequest nut07.PostCheckStateRequest
 	err := decodeJsonReqBody(req, &stateRequest)
@@ -719,7 +777,8 @@ func (ms *MintServer) tokenStateCheck(rw http.ResponseWriter, req *http.Request)
 
 	proofStates, err := ms.mint.ProofsStateCheck(stateRequest.Ys)
 	if err != nil {
-		cashuErr, ok := err.(*cashu.Error)
+		var cashuErr *cashu.Error
+		ok := errors.As(err, &cashuErr)
 		// note: if there was internal error from lightning backend
 		// or error from db, log that error but return generic response
 		if ok {
@@ -785,7 +844,7 @@ func (ms *MintServer) mintInfo(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	ms.logRequest(req, http.StatusOK, "returning mint info")
-	rw.Write(jsonRes)
+	ms.writeSigned(rw, req, jsonRes)
 }
 
 func decodeJsonReqBody(req *http.Request, dst any) error {
@@ -213,3 +213,42 @@ func TestGetKeysetByIdHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSignedKeysResponse(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	signingKey, _, _ := deriveMintKeys(master)
+	activeKeyset, _ := crypto.GenerateKeyset(master, 0, 0, true)
+
+	mint := &Mint{
+		activeKeyset: activeKeyset,
+		signingKey:   signingKey,
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	mintServer := MintServer{
+		mint:  mint,
+		cache: NewCache(),
+	}
+
+	// second request is served from cache and should be signed as well
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, "/v1/keys", nil)
+		if err != nil {
+			t.Fatalf("error creating request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		mintServer.getActiveKeysets(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %d but got %d", http.StatusOK, w.Code)
+		}
+
+		signature := w.Header().Get(cashu.SIGNATURE_HEADER)
+		if len(signature) == 0 {
+			t.Fatal("expected signature header in response")
+		}
+		if !crypto.VerifyMessageSignature(signature, w.Body.Bytes(), signingKey.PubKey()) {
+			t.Fatal("invalid signature for keys response")
+		}
+	}
+}
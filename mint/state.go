@@ -0,0 +1,404 @@
+package mint
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/internal/keys"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// StateVersion is the version of the format produced by ExportState.
+// Bump when making backwards incompatible changes to the format.
+const StateVersion = 1
+
+var (
+	ErrMintNotEmpty = errors.New("state can only be imported into a mint without quotes, proofs or signatures")
+	ErrMintServing  = errors.New("state can not be imported while the mint is serving requests")
+)
+
+type mintState struct {
+	Version         int                   `json:"version"`
+	Seed            string                `json:"seed"`
+	Keysets         []stateKeyset         `json:"keysets"`
+	MintQuotes      []stateMintQuote      `json:"mint_quotes"`
+	MeltQuotes      []stateMeltQuote      `json:"melt_quotes"`
+	Proofs          []stateProof          `json:"proofs"`
+	PendingProofs   []stateProof          `json:"pending_proofs"`
+	BlindSignatures []stateBlindSignature `json:"blind_signatures"`
+}
+
+type stateKeyset struct {
+	Id                string `json:"id"`
+	Unit              string `json:"unit"`
+	Active            bool   `json:"active"`
+	DerivationPathIdx uint32 `json:"derivation_path_idx"`
+	InputFeePpk       uint   `json:"input_fee_ppk"`
+}
+
+type stateMintQuote struct {
+	Id             string `json:"id"`
+	Amount         uint64 `json:"amount"`
+	PaymentRequest string `json:"payment_request"`
+	PaymentHash    string `json:"payment_hash"`
+	State          string `json:"state"`
+	Expiry         uint64 `json:"expiry"`
+	Pubkey         string `json:"pubkey,omitempty"`
+}
+
+type stateMeltQuote struct {
+	Id                       string  `json:"id"`
+	InvoiceRequest           string  `json:"request"`
+	PaymentHash              string  `json:"payment_hash"`
+	Amount                   uint64  `json:"amount"`
+	FeeReserve               uint64  `json:"fee_reserve"`
+	State                    string  `json:"state"`
+	Expiry                   uint64  `json:"expiry"`
+	Preimage                 string  `json:"preimage,omitempty"`
+	IsMpp                    bool    `json:"is_mpp"`
+	AmountMsat               uint64  `json:"amount_msat"`
+	FeeReserveMsat           uint64  `json:"fee_reserve_msat"`
+	Method                   string  `json:"method,omitempty"`
+	Backend                  string  `json:"backend,omitempty"`
+	PercentageFeeReserveMsat uint64  `json:"percentage_fee_reserve_msat,omitempty"`
+	EstimatedFeeMsat         *uint64 `json:"estimated_fee_msat,omitempty"`
+}
+
+type stateProof struct {
+	Y           string `json:"Y"`
+	Amount      uint64 `json:"amount"`
+	Id          string `json:"id"`
+	Secret      string `json:"secret"`
+	C           string `json:"C"`
+	Witness     string `json:"witness,omitempty"`
+	MeltQuoteId string `json:"melt_quote_id,omitempty"`
+}
+
+type stateBlindSignature struct {
+	B_        string                 `json:"B_"`
+	Signature cashu.BlindedSignature `json:"signature"`
+}
+
+// ExportState writes a versioned dump of the mint's state (seed, keysets, quotes,
+// used and pending proofs and blind signatures) to w.
+// The dump can be loaded into a new mint with ImportState to migrate
+// to a different database or host.
+func (m *Mint) ExportState(w io.Writer) error {
+	seed, err := m.db.GetSeed()
+	if err != nil {
+		return fmt.Errorf("error reading seed from db: %v", err)
+	}
+	state := mintState{
+		Version: StateVersion,
+		Seed:    hex.EncodeToString(seed),
+	}
+
+	dbKeysets, err := m.db.GetKeysets()
+	if err != nil {
+		return fmt.Errorf("error reading keysets from db: %v", err)
+	}
+	for _, keyset := range dbKeysets {
+		state.Keysets = append(state.Keysets, stateKeyset{
+			Id:                keyset.Id,
+			Unit:              keyset.Unit,
+			Active:            keyset.Active,
+			DerivationPathIdx: keyset.DerivationPathIdx,
+			InputFeePpk:       keyset.InputFeePpk,
+		})
+	}
+
+	mintQuotes, err := m.db.GetMintQuotes()
+	if err != nil {
+		return fmt.Errorf("error reading mint quotes from db: %v", err)
+	}
+	for _, quote := range mintQuotes {
+		stateQuote := stateMintQuote{
+			Id:             quote.Id,
+			Amount:         quote.Amount,
+			PaymentRequest: quote.PaymentRequest,
+			PaymentHash:    quote.PaymentHash,
+			State:          quote.State.String(),
+			Expiry:         quote.Expiry,
+		}
+		if quote.Pubkey != nil {
+			stateQuote.Pubkey = hex.EncodeToString(quote.Pubkey.SerializeCompressed())
+		}
+		state.MintQuotes = append(state.MintQuotes, stateQuote)
+	}
+
+	meltQuotes, err := m.db.GetMeltQuotes()
+	if err != nil {
+		return fmt.Errorf("error reading melt quotes from db: %v", err)
+	}
+	for _, quote := range meltQuotes {
+		state.MeltQuotes = append(state.MeltQuotes, stateMeltQuote{
+			Id:                       quote.Id,
+			InvoiceRequest:           quote.InvoiceRequest,
+			PaymentHash:              quote.PaymentHash,
+			Amount:                   quote.Amount,
+			FeeReserve:               quote.FeeReserve,
+			State:                    quote.State.String(),
+			Expiry:                   quote.Expiry,
+			Preimage:                 quote.Preimage,
+			IsMpp:                    quote.IsMpp,
+			AmountMsat:               quote.AmountMsat,
+			FeeReserveMsat:           quote.FeeReserveMsat,
+			Method:                   quote.Method,
+			Backend:                  quote.Backend,
+			PercentageFeeReserveMsat: quote.PercentageFeeReserveMsat,
+			EstimatedFeeMsat:         quote.EstimatedFeeMsat,
+		})
+	}
+
+	usedProofs, err := m.db.GetAllProofsUsed()
+	if err != nil {
+		return fmt.Errorf("error reading used proofs from db: %v", err)
+	}
+	state.Proofs = toStateProofs(usedProofs)
+
+	pendingProofs, err := m.db.GetAllPendingProofs()
+	if err != nil {
+		return fmt.Errorf("error reading pending proofs from db: %v", err)
+	}
+	state.PendingProofs = toStateProofs(pendingProofs)
+
+	blindSignatures, err := m.db.GetAllBlindSignatures()
+	if err != nil {
+		return fmt.Errorf("error reading blind signatures from db: %v", err)
+	}
+	for _, sig := range blindSignatures {
+		state.BlindSignatures = append(state.BlindSignatures, stateBlindSignature{
+			B_:        sig.B_,
+			Signature: sig.Signature,
+		})
+	}
+
+	m.logInfof("exporting state with %v keysets, %v mint quotes, %v melt quotes, %v proofs and %v blind signatures",
+		len(state.Keysets), len(state.MintQuotes), len(state.MeltQuotes), len(state.Proofs), len(state.BlindSignatures))
+
+	return json.NewEncoder(w).Encode(state)
+}
+
+func toStateProofs(dbproofs []storage.DBProof) []stateProof {
+	proofs := make([]stateProof, len(dbproofs))
+	for i, proof := range dbproofs {
+		proofs[i] = stateProof{
+			Y:           proof.Y,
+			Amount:      proof.Amount,
+			Id:          proof.Id,
+			Secret:      proof.Secret,
+			C:           proof.C,
+			Witness:     proof.Witness,
+			MeltQuoteId: proof.MeltQuoteId,
+		}
+	}
+	return proofs
+}
+
+// ImportState reads a dump produced by ExportState and loads it into the mint.
+// The seed and keysets of the mint are replaced by the ones in the dump. Everything
+// is saved in a single db transaction so the mint is left unchanged if it fails.
+// It returns ErrMintNotEmpty if the mint already has quotes, proofs or signatures
+// and ErrMintServing if the mint server is running, since the keys of the
+// previous keysets are zeroed and could still be used by requests in flight.
+func (m *Mint) ImportState(r io.Reader) error {
+	if m.serving.Load() {
+		return ErrMintServing
+	}
+
+	var state mintState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return fmt.Errorf("invalid state: %v", err)
+	}
+	if state.Version != StateVersion {
+		return fmt.Errorf("unsupported state version '%v'", state.Version)
+	}
+
+	empty, err := m.isEmpty()
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return ErrMintNotEmpty
+	}
+
+	seed, err := hex.DecodeString(state.Seed)
+	if err != nil {
+		return fmt.Errorf("invalid seed: %v", err)
+	}
+	defer crypto.ZeroBytes(seed)
+	master, err := keys.NewMaster(seed)
+	if err != nil {
+		return fmt.Errorf("invalid seed: %v", err)
+	}
+	defer crypto.ZeroExtendedKey(master)
+	signingKey, keysendKey, err := deriveMintKeys(master)
+	if err != nil {
+		return fmt.Errorf("invalid seed: %v", err)
+	}
+
+	// regenerate keysets from the seed and check ids match
+	// before making any changes to the db
+	keysets := make(map[string]crypto.MintKeyset, len(state.Keysets))
+	var activeKeyset *crypto.MintKeyset
+	for _, stateKeyset := range state.Keysets {
+		keyset, err := crypto.GenerateKeyset(
+			master,
+			stateKeyset.DerivationPathIdx,
+			stateKeyset.InputFeePpk,
+			stateKeyset.Active,
+		)
+		if err != nil {
+			return err
+		}
+		if keyset.Id != stateKeyset.Id {
+			return fmt.Errorf("keyset '%v' does not match keyset derived from seed", stateKeyset.Id)
+		}
+		if keyset.Active {
+			activeKeyset = keyset
+		}
+		keysets[keyset.Id] = *keyset
+	}
+	if activeKeyset == nil {
+		return errors.New("state does not have an active keyset")
+	}
+
+	dbState := storage.MintState{
+		Seed:          seed,
+		Proofs:        fromStateProofs(state.Proofs),
+		PendingProofs: make(map[string]cashu.Proofs),
+	}
+	for _, keyset := range state.Keysets {
+		dbState.Keysets = append(dbState.Keysets, storage.DBKeyset{
+			Id:                keyset.Id,
+			Unit:              keyset.Unit,
+			Active:            keyset.Active,
+			Seed:              state.Seed,
+			DerivationPathIdx: keyset.DerivationPathIdx,
+			InputFeePpk:       keyset.InputFeePpk,
+		})
+	}
+	for _, quote := range state.MintQuotes {
+		mintQuote := storage.MintQuote{
+			Id:             quote.Id,
+			Amount:         quote.Amount,
+			PaymentRequest: quote.PaymentRequest,
+			PaymentHash:    quote.PaymentHash,
+			State:          nut04.StringToState(quote.State),
+			Expiry:         quote.Expiry,
+		}
+		if len(quote.Pubkey) > 0 {
+			pubkeyBytes, err := hex.DecodeString(quote.Pubkey)
+			if err != nil {
+				return fmt.Errorf("invalid public key in mint quote '%v': %v", quote.Id, err)
+			}
+			pubkey, err := secp256k1.ParsePubKey(pubkeyBytes)
+			if err != nil {
+				return fmt.Errorf("invalid public key in mint quote '%v': %v", quote.Id, err)
+			}
+			mintQuote.Pubkey = pubkey
+		}
+		dbState.MintQuotes = append(dbState.MintQuotes, mintQuote)
+	}
+	for _, quote := range state.MeltQuotes {
+		dbState.MeltQuotes = append(dbState.MeltQuotes, storage.MeltQuote{
+			Id:                       quote.Id,
+			InvoiceRequest:           quote.InvoiceRequest,
+			PaymentHash:              quote.PaymentHash,
+			Amount:                   quote.Amount,
+			FeeReserve:               quote.FeeReserve,
+			State:                    nut05.StringToState(quote.State),
+			Expiry:                   quote.Expiry,
+			Preimage:                 quote.Preimage,
+			IsMpp:                    quote.IsMpp,
+			AmountMsat:               quote.AmountMsat,
+			FeeReserveMsat:           quote.FeeReserveMsat,
+			Method:                   quote.Method,
+			Backend:                  quote.Backend,
+			PercentageFeeReserveMsat: quote.PercentageFeeReserveMsat,
+			EstimatedFeeMsat:         quote.EstimatedFeeMsat,
+		})
+	}
+	for _, proof := range state.PendingProofs {
+		dbState.PendingProofs[proof.MeltQuoteId] = append(
+			dbState.PendingProofs[proof.MeltQuoteId],
+			fromStateProofs([]stateProof{proof})...,
+		)
+	}
+	for _, sig := range state.BlindSignatures {
+		dbState.BlindSignatures = append(dbState.BlindSignatures, storage.DBBlindSignature{
+			B_:        sig.B_,
+			Signature: sig.Signature,
+		})
+	}
+
+	if err := m.db.ImportState(dbState); err != nil {
+		return fmt.Errorf("error importing state: %v", err)
+	}
+
+	// keys derived from the previous seed are no longer used
+	for _, keyset := range m.keysets {
+		keyset.Zero()
+	}
+	crypto.ZeroPrivateKeys(m.signingKey)
+	crypto.ZeroBytes(m.keysendKey)
+	m.keysets = keysets
+	m.activeKeyset = activeKeyset
+	m.signingKey = signingKey
+	m.keysendKey = keysendKey
+
+	m.logInfof("imported state with %v keysets, %v mint quotes, %v melt quotes, %v proofs and %v blind signatures",
+		len(state.Keysets), len(state.MintQuotes), len(state.MeltQuotes), len(state.Proofs), len(state.BlindSignatures))
+	m.logInfof("setting active keyset '%v' with fee %v", m.activeKeyset.Id, m.activeKeyset.InputFeePpk)
+
+	return nil
+}
+
+func fromStateProofs(stateProofs []stateProof) cashu.Proofs {
+	proofs := make(cashu.Proofs, len(stateProofs))
+	for i, proof := range stateProofs {
+		proofs[i] = cashu.Proof{
+			Amount:  proof.Amount,
+			Id:      proof.Id,
+			Secret:  proof.Secret,
+			C:       proof.C,
+			Witness: proof.Witness,
+		}
+	}
+	return proofs
+}
+
+// isEmpty returns true if the mint does not have any quotes, proofs or signatures
+func (m *Mint) isEmpty() (bool, error) {
+	mintQuotes, err := m.db.GetMintQuotes()
+	if err != nil {
+		return false, fmt.Errorf("error reading mint quotes from db: %v", err)
+	}
+	meltQuotes, err := m.db.GetMeltQuotes()
+	if err != nil {
+		return false, fmt.Errorf("error reading melt quotes from db: %v", err)
+	}
+	usedProofs, err := m.db.GetAllProofsUsed()
+	if err != nil {
+		return false, fmt.Errorf("error reading used proofs from db: %v", err)
+	}
+	pendingProofs, err := m.db.GetAllPendingProofs()
+	if err != nil {
+		return false, fmt.Errorf("error reading pending proofs from db: %v", err)
+	}
+	blindSignatures, err := m.db.GetAllBlindSignatures()
+	if err != nil {
+		return false, fmt.Errorf("error reading blind signatures from db: %v", err)
+	}
+
+	return len(mintQuotes) == 0 && len(meltQuotes) == 0 && len(usedProofs) == 0 &&
+		len(pendingProofs) == 0 && len(blindSignatures) == 0, nil
+}
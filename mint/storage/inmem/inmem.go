@@ -0,0 +1,641 @@
+// Package inmem implements storage.MintDB in memory. Nothing is written to
+// disk so everything is lost when the mint stops. It is meant for tests and
+// throwaway mints.
+package inmem
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// InMemoryDB keeps the mint data in maps. Lookups that do not find
+// anything return sql.ErrNoRows, same as the sqlite implementation.
+type InMemoryDB struct {
+	mu sync.RWMutex
+
+	seed []byte
+	// keysets and quotes are kept in the order they were saved
+	keysets         []storage.DBKeyset
+	proofs          map[string]storage.DBProof
+	pendingProofs   map[string]storage.DBProof
+	mintQuotes      []storage.MintQuote
+	meltQuotes      []storage.MeltQuote
+	blindSignatures map[string]cashu.BlindedSignature
+	// unix time at which each blind signature was saved
+	blindSignaturesCreated map[string]int64
+	// amounts by keyset of the blind signatures deleted by Prune
+	prunedIssued map[string]uint64
+}
+
+func NewInMemoryDB() *InMemoryDB {
+	return &InMemoryDB{
+		proofs:                 make(map[string]storage.DBProof),
+		pendingProofs:          make(map[string]storage.DBProof),
+		blindSignatures:        make(map[string]cashu.BlindedSignature),
+		blindSignaturesCreated: make(map[string]int64),
+		prunedIssued:           make(map[string]uint64),
+	}
+}
+
+func (db *InMemoryDB) Close() error {
+	return nil
+}
+
+func (db *InMemoryDB) SaveSeed(seed []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.seed = slices.Clone(seed)
+	return nil
+}
+
+func (db *InMemoryDB) GetSeed() ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.seed == nil {
+		return nil, sql.ErrNoRows
+	}
+	return slices.Clone(db.seed), nil
+}
+
+func (db *InMemoryDB) SaveKeyset(keyset storage.DBKeyset) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.keysetIndex(keyset.Id) >= 0 {
+		return fmt.Errorf("keyset '%v' already exists", keyset.Id)
+	}
+	db.keysets = append(db.keysets, keyset)
+	return nil
+}
+
+func (db *InMemoryDB) GetKeysets() ([]storage.DBKeyset, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return slices.Clone(db.keysets), nil
+}
+
+func (db *InMemoryDB) ListKeysets(limit, offset int) ([]storage.DBKeyset, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return page(db.keysets, limit, offset), nil
+}
+
+// page returns a copy of the items in the range given by limit and offset.
+// A limit of 0 returns all the items after offset.
+func page[T any](items []T, limit, offset int) []T {
+	if offset < 0 || offset >= len(items) {
+		return []T{}
+	}
+	end := len(items)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return slices.Clone(items[offset:end])
+}
+
+func (db *InMemoryDB) UpdateKeysetActive(id string, active bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.keysetIndex(id)
+	if idx < 0 {
+		return errors.New("keyset was not updated")
+	}
+	db.keysets[idx].Active = active
+	return nil
+}
+
+func (db *InMemoryDB) DeleteKeyset(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.keysetIndex(id)
+	if idx < 0 {
+		return errors.New("keyset was not deleted")
+	}
+	db.keysets = slices.Delete(db.keysets, idx, idx+1)
+	return nil
+}
+
+func (db *InMemoryDB) keysetIndex(id string) int {
+	return slices.IndexFunc(db.keysets, func(keyset storage.DBKeyset) bool {
+		return keyset.Id == id
+	})
+}
+
+// dbProofs returns the proofs with their Y. It fails if a proof is already in
+// saved or if the list has duplicates, like the unique constraints in sqlite.
+func dbProofs(proofs cashu.Proofs, saved map[string]storage.DBProof, quoteId string) ([]storage.DBProof, error) {
+	dbProofs := make([]storage.DBProof, len(proofs))
+	seen := make(map[string]bool, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return nil, err
+		}
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+		if _, ok := saved[Yhex]; ok || seen[Yhex] {
+			return nil, fmt.Errorf("proof with Y '%v' already exists", Yhex)
+		}
+		seen[Yhex] = true
+
+		dbProofs[i] = storage.DBProof{
+			Amount:      proof.Amount,
+			Id:          proof.Id,
+			Secret:      proof.Secret,
+			Y:           Yhex,
+			C:           proof.C,
+			Witness:     proof.Witness,
+			MeltQuoteId: quoteId,
+		}
+	}
+	return dbProofs, nil
+}
+
+func (db *InMemoryDB) SaveProofs(proofs cashu.Proofs) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	dbProofs, err := dbProofs(proofs, db.proofs, "")
+	if err != nil {
+		return err
+	}
+	for _, proof := range dbProofs {
+		db.proofs[proof.Y] = proof
+	}
+	return nil
+}
+
+func (db *InMemoryDB) GetProofsUsed(Ys []string) ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return proofsByY(db.proofs, Ys), nil
+}
+
+func (db *InMemoryDB) GetAllProofsUsed() ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return allProofs(db.proofs), nil
+}
+
+func (db *InMemoryDB) AddPendingProofs(proofs cashu.Proofs, quoteId string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	dbProofs, err := dbProofs(proofs, db.pendingProofs, quoteId)
+	if err != nil {
+		return err
+	}
+	for _, proof := range dbProofs {
+		db.pendingProofs[proof.Y] = proof
+	}
+	return nil
+}
+
+func (db *InMemoryDB) GetPendingProofs(Ys []string) ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return proofsByY(db.pendingProofs, Ys), nil
+}
+
+func (db *InMemoryDB) GetPendingProofsByQuote(quoteId string) ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	proofs := []storage.DBProof{}
+	for _, proof := range db.pendingProofs {
+		if proof.MeltQuoteId == quoteId {
+			proofs = append(proofs, proof)
+		}
+	}
+	return proofs, nil
+}
+
+func (db *InMemoryDB) GetAllPendingProofs() ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return allProofs(db.pendingProofs), nil
+}
+
+func (db *InMemoryDB) RemovePendingProofs(Ys []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, y := range Ys {
+		delete(db.pendingProofs, y)
+	}
+	return nil
+}
+
+func proofsByY(proofs map[string]storage.DBProof, Ys []string) []storage.DBProof {
+	found := []storage.DBProof{}
+	for _, y := range Ys {
+		if proof, ok := proofs[y]; ok {
+			found = append(found, proof)
+		}
+	}
+	return found
+}
+
+func allProofs(proofs map[string]storage.DBProof) []storage.DBProof {
+	all := make([]storage.DBProof, 0, len(proofs))
+	for _, proof := range proofs {
+		all = append(all, proof)
+	}
+	return all
+}
+
+func (db *InMemoryDB) SaveMintQuote(mintQuote storage.MintQuote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.mintQuoteIndex(mintQuote.Id) >= 0 {
+		return fmt.Errorf("mint quote '%v' already exists", mintQuote.Id)
+	}
+	db.mintQuotes = append(db.mintQuotes, mintQuote)
+	return nil
+}
+
+func (db *InMemoryDB) GetMintQuote(quoteId string) (storage.MintQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx := db.mintQuoteIndex(quoteId)
+	if idx < 0 {
+		return storage.MintQuote{}, sql.ErrNoRows
+	}
+	return db.mintQuotes[idx], nil
+}
+
+func (db *InMemoryDB) GetMintQuoteByPaymentHash(paymentHash string) (storage.MintQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, mintQuote := range db.mintQuotes {
+		if mintQuote.PaymentHash == paymentHash {
+			return mintQuote, nil
+		}
+	}
+	return storage.MintQuote{}, sql.ErrNoRows
+}
+
+func (db *InMemoryDB) GetMintQuotes() ([]storage.MintQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return slices.Clone(db.mintQuotes), nil
+}
+
+func (db *InMemoryDB) ListMintQuotes(state nut04.State, limit, offset int) ([]storage.MintQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	mintQuotes := db.mintQuotes
+	if state != nut04.Unknown {
+		mintQuotes = slices.DeleteFunc(slices.Clone(mintQuotes), func(quote storage.MintQuote) bool {
+			return quote.State != state
+		})
+	}
+	return page(mintQuotes, limit, offset), nil
+}
+
+func (db *InMemoryDB) UpdateMintQuoteState(quoteId string, state nut04.State) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.mintQuoteIndex(quoteId)
+	if idx < 0 {
+		return errors.New("mint quote was not updated")
+	}
+	db.mintQuotes[idx].State = state
+	return nil
+}
+
+func (db *InMemoryDB) mintQuoteIndex(quoteId string) int {
+	return slices.IndexFunc(db.mintQuotes, func(quote storage.MintQuote) bool {
+		return quote.Id == quoteId
+	})
+}
+
+func (db *InMemoryDB) SaveMeltQuote(meltQuote storage.MeltQuote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.meltQuoteIndex(meltQuote.Id) >= 0 {
+		return fmt.Errorf("melt quote '%v' already exists", meltQuote.Id)
+	}
+	db.meltQuotes = append(db.meltQuotes, meltQuote)
+	return nil
+}
+
+func (db *InMemoryDB) GetMeltQuote(quoteId string) (storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx := db.meltQuoteIndex(quoteId)
+	if idx < 0 {
+		return storage.MeltQuote{}, sql.ErrNoRows
+	}
+	return db.meltQuotes[idx], nil
+}
+
+func (db *InMemoryDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, meltQuote := range db.meltQuotes {
+		if meltQuote.InvoiceRequest == invoice {
+			return &meltQuote, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (db *InMemoryDB) GetMeltQuotes() ([]storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return slices.Clone(db.meltQuotes), nil
+}
+
+func (db *InMemoryDB) ListMeltQuotes(state nut05.State, limit, offset int) ([]storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	meltQuotes := db.meltQuotes
+	if state != nut05.Unknown {
+		meltQuotes = slices.DeleteFunc(slices.Clone(meltQuotes), func(quote storage.MeltQuote) bool {
+			return quote.State != state
+		})
+	}
+	return page(meltQuotes, limit, offset), nil
+}
+
+func (db *InMemoryDB) UpdateMeltQuote(quoteId, preimage string, state nut05.State) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.meltQuoteIndex(quoteId)
+	if idx < 0 {
+		return errors.New("melt quote was not updated")
+	}
+	db.meltQuotes[idx].State = state
+	db.meltQuotes[idx].Preimage = preimage
+	return nil
+}
+
+func (db *InMemoryDB) UpdateMeltQuoteBackend(quoteId, backend string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.meltQuoteIndex(quoteId)
+	if idx < 0 {
+		return errors.New("melt quote was not updated")
+	}
+	db.meltQuotes[idx].Backend = backend
+	return nil
+}
+
+func (db *InMemoryDB) meltQuoteIndex(quoteId string) int {
+	return slices.IndexFunc(db.meltQuotes, func(quote storage.MeltQuote) bool {
+		return quote.Id == quoteId
+	})
+}
+
+func (db *InMemoryDB) SaveBlindSignatures(B_s []string, blindSignatures cashu.BlindedSignatures) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(B_s) < len(blindSignatures) {
+		return errors.New("lengths do not match")
+	}
+	for i := range blindSignatures {
+		if _, ok := db.blindSignatures[B_s[i]]; ok || slices.Contains(B_s[:i], B_s[i]) {
+			return fmt.Errorf("blind signature for B_ '%v' already exists", B_s[i])
+		}
+	}
+	createdAt := time.Now().Unix()
+	for i, sig := range blindSignatures {
+		db.blindSignatures[B_s[i]] = cashu.BlindedSignature{
+			Amount: sig.Amount,
+			C_:     sig.C_,
+			Id:     sig.Id,
+			DLEQ:   dleqWithoutR(sig.DLEQ),
+		}
+		db.blindSignaturesCreated[B_s[i]] = createdAt
+	}
+	return nil
+}
+
+// dleqWithoutR copies e and s of the DLEQ proof, which are the
+// only parts of it stored with the blind signature
+func dleqWithoutR(dleq *cashu.DLEQProof) *cashu.DLEQProof {
+	if dleq == nil {
+		return nil
+	}
+	return &cashu.DLEQProof{E: dleq.E, S: dleq.S}
+}
+
+func (db *InMemoryDB) GetBlindSignature(B_ string) (cashu.BlindedSignature, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	sig, ok := db.blindSignatures[B_]
+	if !ok {
+		return cashu.BlindedSignature{}, sql.ErrNoRows
+	}
+	sig.DLEQ = dleqWithoutR(sig.DLEQ)
+	return sig, nil
+}
+
+func (db *InMemoryDB) GetBlindSignatures(B_s []string) (cashu.BlindedSignatures, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	signatures := cashu.BlindedSignatures{}
+	for _, B_ := range B_s {
+		if sig, ok := db.blindSignatures[B_]; ok {
+			sig.DLEQ = dleqWithoutR(sig.DLEQ)
+			signatures = append(signatures, sig)
+		}
+	}
+	return signatures, nil
+}
+
+func (db *InMemoryDB) GetBlindSignaturesByB_(B_s []string) ([]storage.DBBlindSignature, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	signatures := []storage.DBBlindSignature{}
+	for _, B_ := range B_s {
+		if sig, ok := db.blindSignatures[B_]; ok {
+			sig.DLEQ = dleqWithoutR(sig.DLEQ)
+			signatures = append(signatures, storage.DBBlindSignature{B_: B_, Signature: sig})
+		}
+	}
+	return signatures, nil
+}
+
+func (db *InMemoryDB) GetAllBlindSignatures() ([]storage.DBBlindSignature, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	signatures := make([]storage.DBBlindSignature, 0, len(db.blindSignatures))
+	for B_, sig := range db.blindSignatures {
+		sig.DLEQ = dleqWithoutR(sig.DLEQ)
+		signatures = append(signatures, storage.DBBlindSignature{B_: B_, Signature: sig})
+	}
+	return signatures, nil
+}
+
+func (db *InMemoryDB) GetIssuedEcash() (map[string]uint64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	ecashIssued := make(map[string]uint64)
+	for _, sig := range db.blindSignatures {
+		ecashIssued[sig.Id] += sig.Amount
+	}
+	for keysetId, amount := range db.prunedIssued {
+		ecashIssued[keysetId] += amount
+	}
+	return ecashIssued, nil
+}
+
+func (db *InMemoryDB) GetRedeemedEcash() (map[string]uint64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	ecashRedeemed := make(map[string]uint64)
+	for _, proof := range db.proofs {
+		ecashRedeemed[proof.Id] += proof.Amount
+	}
+	return ecashRedeemed, nil
+}
+
+func (db *InMemoryDB) ImportState(state storage.MintState) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// state is saved to a copy of the data that
+	// replaces it only if everything is saved
+	staged := &InMemoryDB{
+		seed:                   db.seed,
+		proofs:                 maps.Clone(db.proofs),
+		pendingProofs:          maps.Clone(db.pendingProofs),
+		mintQuotes:             slices.Clone(db.mintQuotes),
+		meltQuotes:             slices.Clone(db.meltQuotes),
+		blindSignatures:        maps.Clone(db.blindSignatures),
+		blindSignaturesCreated: maps.Clone(db.blindSignaturesCreated),
+		prunedIssued:           db.prunedIssued,
+	}
+	if err := staged.SaveSeed(state.Seed); err != nil {
+		return fmt.Errorf("error saving seed: %v", err)
+	}
+	for _, keyset := range state.Keysets {
+		if err := staged.SaveKeyset(keyset); err != nil {
+			return fmt.Errorf("error saving keyset '%v': %v", keyset.Id, err)
+		}
+	}
+	for _, quote := range state.MintQuotes {
+		if err := staged.SaveMintQuote(quote); err != nil {
+			return fmt.Errorf("error saving mint quote '%v': %v", quote.Id, err)
+		}
+	}
+	for _, quote := range state.MeltQuotes {
+		if err := staged.SaveMeltQuote(quote); err != nil {
+			return fmt.Errorf("error saving melt quote '%v': %v", quote.Id, err)
+		}
+	}
+	if err := staged.SaveProofs(state.Proofs); err != nil {
+		return fmt.Errorf("error saving used proofs: %v", err)
+	}
+	for quoteId, proofs := range state.PendingProofs {
+		if err := staged.AddPendingProofs(proofs, quoteId); err != nil {
+			return fmt.Errorf("error saving pending proofs for quote '%v': %v", quoteId, err)
+		}
+	}
+	B_s := make([]string, len(state.BlindSignatures))
+	signatures := make(cashu.BlindedSignatures, len(state.BlindSignatures))
+	for i, sig := range state.BlindSignatures {
+		B_s[i] = sig.B_
+		signatures[i] = sig.Signature
+	}
+	if err := staged.SaveBlindSignatures(B_s, signatures); err != nil {
+		return fmt.Errorf("error saving blind signatures: %v", err)
+	}
+
+	db.seed = staged.seed
+	db.keysets = staged.keysets
+	db.proofs = staged.proofs
+	db.pendingProofs = staged.pendingProofs
+	db.mintQuotes = staged.mintQuotes
+	db.meltQuotes = staged.meltQuotes
+	db.blindSignatures = staged.blindSignatures
+	db.blindSignaturesCreated = staged.blindSignaturesCreated
+	return nil
+}
+
+func (db *InMemoryDB) Prune(cutoffs storage.PruneCutoffs, dryRun bool) (storage.PruneResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	pruneMintQuote := func(quote storage.MintQuote) bool {
+		return quote.State == nut04.Issued && int64(quote.Expiry) < cutoffs.MintQuotes
+	}
+	pruneMeltQuote := func(quote storage.MeltQuote) bool {
+		return quote.State == nut05.Paid && int64(quote.Expiry) < cutoffs.MeltQuotes
+	}
+
+	var result storage.PruneResult
+	for _, quote := range db.mintQuotes {
+		if pruneMintQuote(quote) {
+			result.MintQuotes++
+		}
+	}
+	for _, quote := range db.meltQuotes {
+		if pruneMeltQuote(quote) {
+			result.MeltQuotes++
+		}
+	}
+	prunedB_s := []string{}
+	for B_, createdAt := range db.blindSignaturesCreated {
+		if createdAt < cutoffs.BlindSignatures {
+			prunedB_s = append(prunedB_s, B_)
+		}
+	}
+	result.BlindSignatures = int64(len(prunedB_s))
+	if dryRun {
+		return result, nil
+	}
+
+	db.mintQuotes = slices.DeleteFunc(db.mintQuotes, pruneMintQuote)
+	db.meltQuotes = slices.DeleteFunc(db.meltQuotes, pruneMeltQuote)
+	for _, B_ := range prunedB_s {
+		sig := db.blindSignatures[B_]
+		db.prunedIssued[sig.Id] += sig.Amount
+		delete(db.blindSignatures, B_)
+		delete(db.blindSignaturesCreated, B_)
+	}
+	return result, nil
+}
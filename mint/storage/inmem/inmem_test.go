@@ -0,0 +1,346 @@
+package inmem
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+func TestSeed(t *testing.T) {
+	db := NewInMemoryDB()
+	if _, err := db.GetSeed(); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+
+	if err := db.SaveSeed([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("unexpected error saving seed: %v", err)
+	}
+	seed, err := db.GetSeed()
+	if err != nil {
+		t.Fatalf("unexpected error getting seed: %v", err)
+	}
+	if string(seed) != string([]byte{1, 2, 3}) {
+		t.Fatalf("expected seed '%v' but got '%v'", []byte{1, 2, 3}, seed)
+	}
+}
+
+func TestProofs(t *testing.T) {
+	db := NewInMemoryDB()
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: "00a", Secret: "secret1", C: "c1"},
+		{Amount: 4, Id: "00a", Secret: "secret2", C: "c2"},
+		{Amount: 8, Id: "00b", Secret: "secret3", C: "c3"},
+	}
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+
+	if err := db.AddPendingProofs(proofs[:2], "quote1"); err != nil {
+		t.Fatalf("unexpected error adding pending proofs: %v", err)
+	}
+	pending, err := db.GetPendingProofsByQuote("quote1")
+	if err != nil {
+		t.Fatalf("unexpected error getting pending proofs: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending proofs but got %v", len(pending))
+	}
+	if err := db.RemovePendingProofs(Ys[:2]); err != nil {
+		t.Fatalf("unexpected error removing pending proofs: %v", err)
+	}
+	pending, _ = db.GetPendingProofs(Ys)
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending proofs but got %v", len(pending))
+	}
+
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("unexpected error saving proofs: %v", err)
+	}
+	used, err := db.GetProofsUsed(Ys[1:])
+	if err != nil {
+		t.Fatalf("unexpected error getting used proofs: %v", err)
+	}
+	if len(used) != 2 || used[0].Secret != "secret2" || used[0].Y != Ys[1] {
+		t.Fatalf("expected used proofs for Ys but got %v", used)
+	}
+
+	// proofs can only be saved once
+	if err := db.SaveProofs(cashu.Proofs{{Amount: 1, Secret: "secret4"}, proofs[0]}); err == nil {
+		t.Fatal("expected error saving proof that was already saved")
+	}
+	if used, _ := db.GetAllProofsUsed(); len(used) != 3 {
+		t.Fatalf("expected 3 used proofs but got %v", len(used))
+	}
+
+	redeemed, err := db.GetRedeemedEcash()
+	if err != nil {
+		t.Fatalf("unexpected error getting redeemed ecash: %v", err)
+	}
+	if redeemed["00a"] != 5 || redeemed["00b"] != 8 {
+		t.Fatalf("expected redeemed amounts of 5 and 8 but got %v", redeemed)
+	}
+}
+
+func TestQuotes(t *testing.T) {
+	db := NewInMemoryDB()
+
+	mintQuote := storage.MintQuote{Id: "mint1", Amount: 21, PaymentHash: "hash1", State: nut04.Unpaid}
+	if err := db.SaveMintQuote(mintQuote); err != nil {
+		t.Fatalf("unexpected error saving mint quote: %v", err)
+	}
+	if err := db.SaveMintQuote(mintQuote); err == nil {
+		t.Fatal("expected error saving mint quote twice")
+	}
+	if err := db.UpdateMintQuoteState("mint1", nut04.Issued); err != nil {
+		t.Fatalf("unexpected error updating mint quote: %v", err)
+	}
+	quote, err := db.GetMintQuoteByPaymentHash("hash1")
+	if err != nil {
+		t.Fatalf("unexpected error getting mint quote: %v", err)
+	}
+	if quote.State != nut04.Issued {
+		t.Fatalf("expected state '%v' but got '%v'", nut04.Issued, quote.State)
+	}
+	if _, err := db.GetMintQuote("unknown"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+	if err := db.UpdateMintQuoteState("unknown", nut04.Paid); err == nil {
+		t.Fatal("expected error updating quote that does not exist")
+	}
+
+	meltQuote := storage.MeltQuote{Id: "melt1", InvoiceRequest: "lnbc1", Amount: 10, State: nut05.Unpaid}
+	if err := db.SaveMeltQuote(meltQuote); err != nil {
+		t.Fatalf("unexpected error saving melt quote: %v", err)
+	}
+	if err := db.UpdateMeltQuote("melt1", "preimage", nut05.Paid); err != nil {
+		t.Fatalf("unexpected error updating melt quote: %v", err)
+	}
+	melt, err := db.GetMeltQuoteByPaymentRequest("lnbc1")
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote: %v", err)
+	}
+	if melt.State != nut05.Paid || melt.Preimage != "preimage" {
+		t.Fatalf("expected paid melt quote with preimage but got %+v", melt)
+	}
+	if err := db.UpdateMeltQuoteBackend("melt1", "fallback"); err != nil {
+		t.Fatalf("unexpected error updating melt quote backend: %v", err)
+	}
+	if melt, _ := db.GetMeltQuote("melt1"); melt.Backend != "fallback" {
+		t.Fatalf("expected melt quote backend 'fallback' but got '%v'", melt.Backend)
+	}
+	if err := db.UpdateMeltQuoteBackend("unknown", "fallback"); err == nil {
+		t.Fatal("expected error updating quote that does not exist")
+	}
+	if _, err := db.GetMeltQuoteByPaymentRequest("lnbc2"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+}
+
+func TestListQuotes(t *testing.T) {
+	db := NewInMemoryDB()
+
+	states := []nut04.State{nut04.Unpaid, nut04.Paid, nut04.Unpaid, nut04.Paid, nut04.Paid}
+	for i, state := range states {
+		quote := storage.MintQuote{Id: fmt.Sprintf("mint%v", i), State: state}
+		if err := db.SaveMintQuote(quote); err != nil {
+			t.Fatalf("unexpected error saving mint quote: %v", err)
+		}
+	}
+
+	quotes, err := db.ListMintQuotes(nut04.Unknown, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error listing mint quotes: %v", err)
+	}
+	if len(quotes) != len(states) {
+		t.Fatalf("expected %v mint quotes but got %v", len(states), len(quotes))
+	}
+
+	quotes, err = db.ListMintQuotes(nut04.Paid, 2, 1)
+	if err != nil {
+		t.Fatalf("unexpected error listing mint quotes: %v", err)
+	}
+	if len(quotes) != 2 || quotes[0].Id != "mint3" || quotes[1].Id != "mint4" {
+		t.Fatalf("expected quotes 'mint3' and 'mint4' but got %+v", quotes)
+	}
+
+	if err := db.SaveMeltQuote(storage.MeltQuote{Id: "melt1", State: nut05.Pending}); err != nil {
+		t.Fatalf("unexpected error saving melt quote: %v", err)
+	}
+	meltQuotes, err := db.ListMeltQuotes(nut05.Paid, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error listing melt quotes: %v", err)
+	}
+	if len(meltQuotes) != 0 {
+		t.Fatalf("expected no paid melt quotes but got %v", len(meltQuotes))
+	}
+
+	keysets, err := db.ListKeysets(10, 5)
+	if err != nil {
+		t.Fatalf("unexpected error listing keysets: %v", err)
+	}
+	if len(keysets) != 0 {
+		t.Fatalf("expected no keysets but got %v", len(keysets))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db := NewInMemoryDB()
+
+	now := time.Now().Unix()
+	mintQuotes := []storage.MintQuote{
+		{Id: "mint1", State: nut04.Issued, Expiry: uint64(now - 1000)},
+		{Id: "mint2", State: nut04.Paid, Expiry: uint64(now - 1000)},
+		{Id: "mint3", State: nut04.Issued, Expiry: uint64(now + 1000)},
+	}
+	for _, quote := range mintQuotes {
+		if err := db.SaveMintQuote(quote); err != nil {
+			t.Fatalf("unexpected error saving mint quote: %v", err)
+		}
+	}
+	if err := db.SaveMeltQuote(storage.MeltQuote{Id: "melt1", State: nut05.Paid, Expiry: uint64(now - 1000)}); err != nil {
+		t.Fatalf("unexpected error saving melt quote: %v", err)
+	}
+	sigs := cashu.BlindedSignatures{{Amount: 2, Id: "00a", C_: "c1"}, {Amount: 8, Id: "00a", C_: "c2"}}
+	if err := db.SaveBlindSignatures([]string{"b1", "b2"}, sigs); err != nil {
+		t.Fatalf("unexpected error saving blind signatures: %v", err)
+	}
+
+	cutoffs := storage.PruneCutoffs{MintQuotes: now, MeltQuotes: now, BlindSignatures: now + 1}
+	expected := storage.PruneResult{MintQuotes: 1, MeltQuotes: 1, BlindSignatures: 2}
+	result, err := db.Prune(cutoffs, true)
+	if err != nil {
+		t.Fatalf("unexpected error in dry run: %v", err)
+	}
+	if result != expected {
+		t.Fatalf("expected dry run result %+v but got %+v", expected, result)
+	}
+	if _, err := db.GetMintQuote("mint1"); err != nil {
+		t.Fatalf("expected dry run to keep mint quote but got error: %v", err)
+	}
+
+	result, err = db.Prune(cutoffs, false)
+	if err != nil {
+		t.Fatalf("unexpected error pruning: %v", err)
+	}
+	if result != expected {
+		t.Fatalf("expected result %+v but got %+v", expected, result)
+	}
+	if _, err := db.GetMintQuote("mint1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+	if _, err := db.GetMintQuote("mint2"); err != nil {
+		t.Fatalf("unexpected error getting mint quote that is not issued: %v", err)
+	}
+	if _, err := db.GetBlindSignature("b1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+
+	issued, err := db.GetIssuedEcash()
+	if err != nil {
+		t.Fatalf("unexpected error getting issued ecash: %v", err)
+	}
+	if issued["00a"] != 10 {
+		t.Fatalf("expected issued ecash of 10 after pruning but got %v", issued["00a"])
+	}
+}
+
+func TestBlindSignatures(t *testing.T) {
+	db := NewInMemoryDB()
+
+	B_s := []string{"b1", "b2"}
+	signatures := cashu.BlindedSignatures{
+		{Amount: 2, C_: "c1", Id: "00a", DLEQ: &cashu.DLEQProof{E: "e", S: "s", R: "r"}},
+		{Amount: 16, C_: "c2", Id: "00a"},
+	}
+	if err := db.SaveBlindSignatures(B_s, signatures); err != nil {
+		t.Fatalf("unexpected error saving blind signatures: %v", err)
+	}
+	if err := db.SaveBlindSignatures(B_s[1:], signatures[1:]); err == nil {
+		t.Fatal("expected error saving blind signature twice")
+	}
+
+	sig, err := db.GetBlindSignature("b1")
+	if err != nil {
+		t.Fatalf("unexpected error getting blind signature: %v", err)
+	}
+	if sig.DLEQ == nil || sig.DLEQ.E != "e" || sig.DLEQ.R != "" {
+		t.Fatalf("expected DLEQ proof with only e and s but got %+v", sig.DLEQ)
+	}
+	if _, err := db.GetBlindSignature("b3"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+
+	issued, err := db.GetIssuedEcash()
+	if err != nil {
+		t.Fatalf("unexpected error getting issued ecash: %v", err)
+	}
+	if issued["00a"] != 18 {
+		t.Fatalf("expected issued amount of 18 but got %v", issued["00a"])
+	}
+}
+
+func TestImportState(t *testing.T) {
+	db := NewInMemoryDB()
+	if err := db.SaveKeyset(storage.DBKeyset{Id: "00a", Unit: "sat", Active: true}); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: "00b", Secret: "secret1", C: "c1"},
+		{Amount: 4, Id: "00b", Secret: "secret2", C: "c2"},
+	}
+	state := storage.MintState{
+		Seed:          []byte{1, 2, 3},
+		Keysets:       []storage.DBKeyset{{Id: "00b", Unit: "sat", Active: true}},
+		MintQuotes:    []storage.MintQuote{{Id: "mintquote1", PaymentHash: "hash1"}},
+		Proofs:        proofs,
+		PendingProofs: map[string]cashu.Proofs{"meltquote1": {{Amount: 2, Id: "00b", Secret: "secret3", C: "c3"}}},
+	}
+
+	// nothing should be saved if one of the writes fails
+	failingState := state
+	failingState.Proofs = append(cashu.Proofs{proofs[0]}, proofs...)
+	if err := db.ImportState(failingState); err == nil {
+		t.Fatal("expected error importing state with duplicate proofs")
+	}
+	if _, err := db.GetSeed(); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+	keysets, _ := db.GetKeysets()
+	if len(keysets) != 1 || keysets[0].Id != "00a" {
+		t.Fatalf("expected keysets to be unchanged but got %v", keysets)
+	}
+	if _, err := db.GetMintQuote("mintquote1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+
+	if err := db.ImportState(state); err != nil {
+		t.Fatalf("unexpected error importing state: %v", err)
+	}
+	keysets, _ = db.GetKeysets()
+	if len(keysets) != 1 || keysets[0].Id != "00b" {
+		t.Fatalf("expected keyset '00b' but got %v", keysets)
+	}
+	usedProofs, _ := db.GetAllProofsUsed()
+	if len(usedProofs) != len(proofs) {
+		t.Fatalf("expected %v proofs but got %v", len(proofs), len(usedProofs))
+	}
+	pendingProofs, _ := db.GetPendingProofsByQuote("meltquote1")
+	if len(pendingProofs) != 1 {
+		t.Fatalf("expected %v pending proofs but got %v", 1, len(pendingProofs))
+	}
+}
@@ -0,0 +1,5 @@
+ALTER TABLE melt_quotes ADD COLUMN fee_reserve_msat INTEGER;
+
+-- quotes created before tracking msat only have whole sat amounts
+UPDATE melt_quotes SET amount_msat = amount * 1000 WHERE amount_msat IS NULL OR amount_msat = 0;
+UPDATE melt_quotes SET fee_reserve_msat = fee_reserve * 1000;
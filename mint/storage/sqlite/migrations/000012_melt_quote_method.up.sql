@@ -0,0 +1 @@
+ALTER TABLE melt_quotes ADD COLUMN method TEXT;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_mint_quotes_state;
+DROP INDEX IF EXISTS idx_mint_quotes_payment_hash;
+DROP INDEX IF EXISTS idx_melt_quotes_state;
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS idx_mint_quotes_state ON mint_quotes(state);
+CREATE INDEX IF NOT EXISTS idx_mint_quotes_payment_hash ON mint_quotes(payment_hash);
+CREATE INDEX IF NOT EXISTS idx_melt_quotes_state ON melt_quotes(state);
@@ -0,0 +1,12 @@
+DROP VIEW IF EXISTS total_issued;
+
+CREATE VIEW IF NOT EXISTS total_issued AS 
+SELECT keyset_id, COALESCE(amount, 0) AS balance FROM (
+    SELECT keyset_id, SUM(amount) AS amount 
+    FROM blind_signatures 
+    GROUP BY keyset_id
+);
+
+DROP TABLE IF EXISTS pruned_blind_signatures;
+DROP INDEX IF EXISTS idx_blind_signatures_created_at;
+ALTER TABLE blind_signatures DROP COLUMN created_at;
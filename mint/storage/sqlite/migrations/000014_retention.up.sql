@@ -0,0 +1,21 @@
+ALTER TABLE blind_signatures ADD COLUMN created_at INTEGER;
+-- signatures saved before this migration are considered created now
+UPDATE blind_signatures SET created_at = CAST(strftime('%s', 'now') AS INTEGER);
+CREATE INDEX IF NOT EXISTS idx_blind_signatures_created_at ON blind_signatures(created_at);
+
+-- amounts by keyset of the blind signatures deleted by the retention policy
+CREATE TABLE IF NOT EXISTS pruned_blind_signatures (
+	keyset_id TEXT NOT NULL PRIMARY KEY,
+	amount INTEGER NOT NULL
+);
+
+-- issued ecash includes the signatures that were deleted
+DROP VIEW IF EXISTS total_issued;
+
+CREATE VIEW IF NOT EXISTS total_issued AS 
+SELECT keyset_id, COALESCE(SUM(amount), 0) AS balance FROM (
+    SELECT keyset_id, amount FROM blind_signatures
+    UNION ALL
+    SELECT keyset_id, amount FROM pruned_blind_signatures
+)
+GROUP BY keyset_id;
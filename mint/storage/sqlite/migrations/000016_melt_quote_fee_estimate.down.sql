@@ -0,0 +1,2 @@
+ALTER TABLE melt_quotes DROP COLUMN estimated_fee_msat;
+ALTER TABLE melt_quotes DROP COLUMN percentage_fee_reserve_msat;
@@ -0,0 +1,2 @@
+ALTER TABLE melt_quotes ADD COLUMN percentage_fee_reserve_msat INTEGER;
+ALTER TABLE melt_quotes ADD COLUMN estimated_fee_msat INTEGER;
@@ -6,10 +6,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
@@ -19,96 +20,198 @@ import (
 	"github.com/elnosh/gonuts/mint/storage"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 //go:embed migrations
 var migrations embed.FS
 
+const (
+	// time a connection waits for a lock held by another connection
+	// before failing with 'database is locked'
+	busyTimeout = 5 * time.Second
+	// WAL mode allows reads while a write is in progress but there
+	// is still only a single writer, so the pool is kept small.
+	maxOpenConns = 8
+	maxIdleConns = 4
+)
+
 type SQLiteDB struct {
 	db *sql.DB
 }
 
-// create a temporary directory with the migration files.
-// migration files are embedded with go:embed. These are then read
-// and copied to a temporary directory.
-// This is needed to pass the directory to migrate.New
-func migrationsDir() (string, error) {
-	tempDir, err := os.MkdirTemp("", "migrations")
+// dsn builds the data source name for the db in dbpath. Transactions start
+// with an immediate lock so that a read transaction that later writes
+// does not fail with 'database is locked' when another one is writing.
+func dsn(dbpath string) string {
+	return fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_foreign_keys=on&_txlock=immediate",
+		dbpath, busyTimeout.Milliseconds())
+}
+
+// InitSQLite opens the mint db in path and runs the migrations
+// embedded in the binary that have not been applied yet
+func InitSQLite(path string) (*SQLiteDB, error) {
+	return InitSQLiteWithMigrations(path, "")
+}
+
+// ErrNewerSchema is returned when the db has migrations applied
+// that are not known by this version of the mint.
+var ErrNewerSchema = errors.New("db was created by a newer version of gonuts")
+
+// InitSQLiteWithMigrations is the same as InitSQLite but reads the migrations
+// from the migrationsPath directory if it is not empty. This is meant for
+// development, to try migrations without building the binary again.
+//
+// The version of the last migration applied is recorded in the db
+// so each migration only runs once. It fails without changing the db if
+// the recorded version is newer than the last migration known.
+func InitSQLiteWithMigrations(path, migrationsPath string) (*SQLiteDB, error) {
+	dbpath := filepath.Join(path, "mint.sqlite.db")
+	db, err := sql.Open("sqlite3", dsn(dbpath))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
 
-	migrationFiles, err := migrations.ReadDir("migrations")
+	migrationsSource, err := openMigrationsSource(migrationsPath)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	latestVersion, err := lastMigrationVersion(migrationsSource)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %v", err)
 	}
 
-	for _, file := range migrationFiles {
-		filePath := filepath.Join(tempDir, file.Name())
+	m, err := migrate.NewWithSourceInstance("migrations", migrationsSource, fmt.Sprintf("sqlite3://%s", dbpath))
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
 
-		migrationFilePath := filepath.Join("migrations", file.Name())
-		migrationFile, err := migrations.Open(migrationFilePath)
-		if err != nil {
-			return "", err
-		}
-		defer migrationFile.Close()
+	if err := checkSchemaVersion(m, latestVersion); err != nil {
+		return nil, err
+	}
 
-		destFile, err := os.Create(filePath)
-		if err != nil {
-			return "", err
-		}
-		defer destFile.Close()
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("error running migrations: %v", err)
+	}
 
-		_, err = io.Copy(destFile, migrationFile)
-		if err != nil {
-			return "", err
-		}
+	if err := db.Ping(); err != nil {
+		return nil, err
 	}
 
-	return tempDir, nil
+	return &SQLiteDB{db: db}, nil
 }
 
-func InitSQLite(path string) (*SQLiteDB, error) {
+// OpenReadReplica opens the db in path in read-only mode. It is meant for
+// a replica of the mint db that is kept in sync with the primary by another
+// process, so migrations are not run on it.
+func OpenReadReplica(path string) (*SQLiteDB, error) {
 	dbpath := filepath.Join(path, "mint.sqlite.db")
-	db, err := sql.Open("sqlite3", dbpath)
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d",
+		dbpath, busyTimeout.Milliseconds()))
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(1)
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
 
-	tempMigrationsDir, err := migrationsDir()
-	if err != nil {
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
-	defer os.RemoveAll(tempMigrationsDir)
 
-	m, err := migrate.New(fmt.Sprintf("file://%s", tempMigrationsDir), fmt.Sprintf("sqlite3://%s", dbpath))
+	return &SQLiteDB{db: db}, nil
+}
+
+func openMigrationsSource(migrationsPath string) (source.Driver, error) {
+	if len(migrationsPath) > 0 {
+		return source.Open(fmt.Sprintf("file://%s", migrationsPath))
+	}
+	return iofs.New(migrations, "migrations")
+}
+
+// lastMigrationVersion returns the version of the last migration in the source
+func lastMigrationVersion(migrationsSource source.Driver) (uint, error) {
+	version, err := migrationsSource.First()
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	for {
+		next, err := migrationsSource.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		} else if err != nil {
+			return 0, err
+		}
+		version = next
 	}
+}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return nil, err
+// checkSchemaVersion verifies the db can be migrated up to latestVersion.
+// A new db without any migrations applied is valid.
+func checkSchemaVersion(m *migrate.Migrate, latestVersion uint) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading db schema version: %v", err)
 	}
 
-	if err := db.Ping(); err != nil {
-		return nil, err
+	if dirty {
+		return fmt.Errorf("migration to version %v of the db schema did not complete. It needs to be fixed manually", version)
 	}
+	if version > latestVersion {
+		return fmt.Errorf("%w: db schema version is %v but the latest supported is %v",
+			ErrNewerSchema, version, latestVersion)
+	}
+	return nil
+}
 
-	return &SQLiteDB{db: db}, nil
+// SchemaVersion returns the version of the last migration applied to the db
+func (sqlite *SQLiteDB) SchemaVersion() (uint, error) {
+	var version uint
+	if err := sqlite.db.QueryRow("SELECT version FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
 }
 
 func (sqlite *SQLiteDB) Close() error {
 	return sqlite.db.Close()
 }
 
+// Backup writes a copy of the db to path with VACUUM INTO.
+// It runs in a single read transaction so the copy is consistent
+// and writes from the mint can continue while it is in progress.
+func (sqlite *SQLiteDB) Backup(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("file '%v' already exists", path)
+	}
+	if _, err := sqlite.db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("error backing up db: %v", err)
+	}
+	return nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 func (sqlite *SQLiteDB) SaveSeed(seed []byte) error {
+	return saveSeed(sqlite.db, seed)
+}
+
+func saveSeed(e execer, seed []byte) error {
 	hexSeed := hex.EncodeToString(seed)
 
-	_, err := sqlite.db.Exec(`
-	INSERT INTO seed (id, seed) VALUES (?, ?)
+	_, err := e.Exec(`
+	INSERT OR REPLACE INTO seed (id, seed) VALUES (?, ?)
 	`, "id", hexSeed)
 
 	return err
@@ -131,7 +234,11 @@ func (sqlite *SQLiteDB) GetSeed() ([]byte, error) {
 }
 
 func (sqlite *SQLiteDB) SaveKeyset(keyset storage.DBKeyset) error {
-	_, err := sqlite.db.Exec(`
+	return saveKeyset(sqlite.db, keyset)
+}
+
+func saveKeyset(e execer, keyset storage.DBKeyset) error {
+	_, err := e.Exec(`
 		INSERT INTO keysets (id, unit, active, seed, derivation_path_idx, input_fee_ppk) VALUES (?, ?, ?, ?, ?, ?)
 	`, keyset.Id, keyset.Unit, keyset.Active, keyset.Seed, keyset.DerivationPathIdx, keyset.InputFeePpk)
 
@@ -166,6 +273,45 @@ func (sqlite *SQLiteDB) GetKeysets() ([]storage.DBKeyset, error) {
 	return keysets, nil
 }
 
+func (sqlite *SQLiteDB) ListKeysets(limit, offset int) ([]storage.DBKeyset, error) {
+	keysets := []storage.DBKeyset{}
+
+	rows, err := sqlite.db.Query(
+		"SELECT * FROM keysets ORDER BY rowid LIMIT ? OFFSET ?",
+		sqlLimit(limit), offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var keyset storage.DBKeyset
+		err := rows.Scan(
+			&keyset.Id,
+			&keyset.Unit,
+			&keyset.Active,
+			&keyset.Seed,
+			&keyset.DerivationPathIdx,
+			&keyset.InputFeePpk,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keysets = append(keysets, keyset)
+	}
+
+	return keysets, nil
+}
+
+// sqlLimit converts a limit of 0 to -1, which is no limit in sqlite
+func sqlLimit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
+
 func (sqlite *SQLiteDB) UpdateKeysetActive(id string, active bool) error {
 	result, err := sqlite.db.Exec("UPDATE keysets SET active = ? WHERE id = ?", active, id)
 	if err != nil {
@@ -182,12 +328,36 @@ func (sqlite *SQLiteDB) UpdateKeysetActive(id string, active bool) error {
 	return nil
 }
 
+func (sqlite *SQLiteDB) DeleteKeyset(id string) error {
+	result, err := sqlite.db.Exec("DELETE FROM keysets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return errors.New("keyset was not deleted")
+	}
+	return nil
+}
+
 func (sqlite *SQLiteDB) SaveProofs(proofs cashu.Proofs) error {
 	tx, err := sqlite.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
+	if err := saveProofs(tx, proofs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveProofs(tx *sql.Tx, proofs cashu.Proofs) error {
 	stmt, err := tx.Prepare("INSERT INTO proofs (y, amount, keyset_id, secret, c, witness) VALUES (?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return err
@@ -202,15 +372,9 @@ func (sqlite *SQLiteDB) SaveProofs(proofs cashu.Proofs) error {
 		Yhex := hex.EncodeToString(Y.SerializeCompressed())
 
 		if _, err := stmt.Exec(Yhex, proof.Amount, proof.Id, proof.Secret, proof.C, proof.Witness); err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
-
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -254,12 +418,54 @@ func (sqlite *SQLiteDB) GetProofsUsed(Ys []string) ([]storage.DBProof, error) {
 	return proofs, nil
 }
 
+func (sqlite *SQLiteDB) GetAllProofsUsed() ([]storage.DBProof, error) {
+	proofs := []storage.DBProof{}
+
+	rows, err := sqlite.db.Query("SELECT y, amount, keyset_id, secret, c, witness FROM proofs")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var proof storage.DBProof
+		var witness sql.NullString
+
+		err := rows.Scan(
+			&proof.Y,
+			&proof.Amount,
+			&proof.Id,
+			&proof.Secret,
+			&proof.C,
+			&witness,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if witness.Valid {
+			proof.Witness = witness.String
+		}
+
+		proofs = append(proofs, proof)
+	}
+
+	return proofs, nil
+}
+
 func (sqlite *SQLiteDB) AddPendingProofs(proofs cashu.Proofs, quoteId string) error {
 	tx, err := sqlite.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	if err := addPendingProofs(tx, proofs, quoteId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
+func addPendingProofs(tx *sql.Tx, proofs cashu.Proofs, quoteId string) error {
 	stmt, err := tx.Prepare("INSERT INTO pending_proofs (y, amount, keyset_id, secret, c, witness, melt_quote_id) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return err
@@ -274,15 +480,9 @@ func (sqlite *SQLiteDB) AddPendingProofs(proofs cashu.Proofs, quoteId string) er
 		Yhex := hex.EncodeToString(Y.SerializeCompressed())
 
 		if _, err := stmt.Exec(Yhex, proof.Amount, proof.Id, proof.Secret, proof.C, proof.Witness, quoteId); err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
-
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -364,6 +564,43 @@ func (sqlite *SQLiteDB) GetPendingProofsByQuote(quoteId string) ([]storage.DBPro
 	return proofs, nil
 }
 
+func (sqlite *SQLiteDB) GetAllPendingProofs() ([]storage.DBProof, error) {
+	proofs := []storage.DBProof{}
+	query := `SELECT y, amount, keyset_id, secret, c, melt_quote_id, witness FROM pending_proofs`
+
+	rows, err := sqlite.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var proof storage.DBProof
+		var witness sql.NullString
+
+		err := rows.Scan(
+			&proof.Y,
+			&proof.Amount,
+			&proof.Id,
+			&proof.Secret,
+			&proof.C,
+			&proof.MeltQuoteId,
+			&witness,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if witness.Valid {
+			proof.Witness = witness.String
+		}
+
+		proofs = append(proofs, proof)
+	}
+
+	return proofs, nil
+}
+
 func (sqlite *SQLiteDB) RemovePendingProofs(Ys []string) error {
 	tx, err := sqlite.db.Begin()
 	if err != nil {
@@ -391,12 +628,16 @@ func (sqlite *SQLiteDB) RemovePendingProofs(Ys []string) error {
 }
 
 func (sqlite *SQLiteDB) SaveMintQuote(mintQuote storage.MintQuote) error {
+	return saveMintQuote(sqlite.db, mintQuote)
+}
+
+func saveMintQuote(e execer, mintQuote storage.MintQuote) error {
 	var pubkey string
 	if mintQuote.Pubkey != nil {
 		pubkey = hex.EncodeToString(mintQuote.Pubkey.SerializeCompressed())
 	}
 
-	_, err := sqlite.db.Exec(
+	_, err := e.Exec(
 		`INSERT INTO mint_quotes (id, payment_request, payment_hash, amount, state, expiry, pubkey)
 		VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		mintQuote.Id,
@@ -413,46 +654,69 @@ func (sqlite *SQLiteDB) SaveMintQuote(mintQuote storage.MintQuote) error {
 
 func (sqlite *SQLiteDB) GetMintQuote(quoteId string) (storage.MintQuote, error) {
 	row := sqlite.db.QueryRow("SELECT * FROM mint_quotes WHERE id = ?", quoteId)
+	return scanMintQuote(row)
+}
 
-	var mintQuote storage.MintQuote
-	var state string
-	var pubkey sql.NullString
+func (sqlite *SQLiteDB) GetMintQuoteByPaymentHash(paymentHash string) (storage.MintQuote, error) {
+	row := sqlite.db.QueryRow("SELECT * FROM mint_quotes WHERE payment_hash = ?", paymentHash)
+	return scanMintQuote(row)
+}
 
-	err := row.Scan(
-		&mintQuote.Id,
-		&mintQuote.PaymentRequest,
-		&mintQuote.PaymentHash,
-		&mintQuote.Amount,
-		&state,
-		&mintQuote.Expiry,
-		&pubkey,
-	)
+func (sqlite *SQLiteDB) GetMintQuotes() ([]storage.MintQuote, error) {
+	mintQuotes := []storage.MintQuote{}
+
+	rows, err := sqlite.db.Query("SELECT * FROM mint_quotes")
 	if err != nil {
-		return storage.MintQuote{}, err
+		return nil, err
 	}
-	mintQuote.State = nut04.StringToState(state)
+	defer rows.Close()
 
-	if pubkey.Valid && len(pubkey.String) > 0 {
-		// these should not error because validation is done before saving with public key
-		// if there is an error, something bad happened
-		hexPubkey, err := hex.DecodeString(pubkey.String)
+	for rows.Next() {
+		mintQuote, err := scanMintQuote(rows)
 		if err != nil {
-			return storage.MintQuote{}, fmt.Errorf("invalid public key in db: %v", err)
+			return nil, err
 		}
+		mintQuotes = append(mintQuotes, mintQuote)
+	}
 
-		publicKey, err := secp256k1.ParsePubKey(hexPubkey)
+	return mintQuotes, nil
+}
+
+func (sqlite *SQLiteDB) ListMintQuotes(state nut04.State, limit, offset int) ([]storage.MintQuote, error) {
+	mintQuotes := []storage.MintQuote{}
+
+	query := "SELECT * FROM mint_quotes"
+	args := []any{}
+	if state != nut04.Unknown {
+		query += " WHERE state = ?"
+		args = append(args, state.String())
+	}
+	query += " ORDER BY rowid LIMIT ? OFFSET ?"
+	args = append(args, sqlLimit(limit), offset)
+
+	rows, err := sqlite.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		mintQuote, err := scanMintQuote(rows)
 		if err != nil {
-			return storage.MintQuote{}, fmt.Errorf("invalid public key in db: %v", err)
+			return nil, err
 		}
-		mintQuote.Pubkey = publicKey
+		mintQuotes = append(mintQuotes, mintQuote)
 	}
 
-	return mintQuote, nil
+	return mintQuotes, nil
 }
 
-func (sqlite *SQLiteDB) GetMintQuoteByPaymentHash(paymentHash string) (storage.MintQuote, error) {
-	row := sqlite.db.QueryRow("SELECT * FROM mint_quotes WHERE payment_hash = ?", paymentHash)
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
 
+func scanMintQuote(row scanner) (storage.MintQuote, error) {
 	var mintQuote storage.MintQuote
 	var state string
 	var pubkey sql.NullString
@@ -507,10 +771,15 @@ func (sqlite *SQLiteDB) UpdateMintQuoteState(quoteId string, state nut04.State)
 }
 
 func (sqlite *SQLiteDB) SaveMeltQuote(meltQuote storage.MeltQuote) error {
-	_, err := sqlite.db.Exec(`
+	return saveMeltQuote(sqlite.db, meltQuote)
+}
+
+func saveMeltQuote(e execer, meltQuote storage.MeltQuote) error {
+	_, err := e.Exec(`
 		INSERT INTO melt_quotes 
-		(id, request, payment_hash, amount, fee_reserve, state, expiry, preimage, is_mpp, amount_msat) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		(id, request, payment_hash, amount, fee_reserve, state, expiry, preimage, is_mpp, amount_msat, fee_reserve_msat, method, backend,
+		percentage_fee_reserve_msat, estimated_fee_msat) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		meltQuote.Id,
 		meltQuote.InvoiceRequest,
 		meltQuote.PaymentHash,
@@ -521,6 +790,11 @@ func (sqlite *SQLiteDB) SaveMeltQuote(meltQuote storage.MeltQuote) error {
 		meltQuote.Preimage,
 		meltQuote.IsMpp,
 		meltQuote.AmountMsat,
+		meltQuote.FeeReserveMsat,
+		meltQuote.Method,
+		meltQuote.Backend,
+		meltQuote.PercentageFeeReserveMsat,
+		meltQuote.EstimatedFeeMsat,
 	)
 
 	return err
@@ -528,45 +802,77 @@ func (sqlite *SQLiteDB) SaveMeltQuote(meltQuote storage.MeltQuote) error {
 
 func (sqlite *SQLiteDB) GetMeltQuote(quoteId string) (storage.MeltQuote, error) {
 	row := sqlite.db.QueryRow("SELECT * FROM melt_quotes WHERE id = ?", quoteId)
+	return scanMeltQuote(row)
+}
 
-	var meltQuote storage.MeltQuote
-	var state string
-	var isMpp sql.NullBool
-	var amountMsat sql.NullInt64
-
-	err := row.Scan(
-		&meltQuote.Id,
-		&meltQuote.InvoiceRequest,
-		&meltQuote.PaymentHash,
-		&meltQuote.Amount,
-		&meltQuote.FeeReserve,
-		&state,
-		&meltQuote.Expiry,
-		&meltQuote.Preimage,
-		&isMpp,
-		&amountMsat,
-	)
+func (sqlite *SQLiteDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.MeltQuote, error) {
+	row := sqlite.db.QueryRow("SELECT * FROM melt_quotes WHERE request = ?", invoice)
+	meltQuote, err := scanMeltQuote(row)
 	if err != nil {
-		return storage.MeltQuote{}, err
+		return nil, err
 	}
-	meltQuote.State = nut05.StringToState(state)
-	if isMpp.Valid {
-		meltQuote.IsMpp = isMpp.Bool
+	return &meltQuote, nil
+}
+
+func (sqlite *SQLiteDB) GetMeltQuotes() ([]storage.MeltQuote, error) {
+	meltQuotes := []storage.MeltQuote{}
+
+	rows, err := sqlite.db.Query("SELECT * FROM melt_quotes")
+	if err != nil {
+		return nil, err
 	}
-	if amountMsat.Valid {
-		meltQuote.AmountMsat = uint64(amountMsat.Int64)
+	defer rows.Close()
+
+	for rows.Next() {
+		meltQuote, err := scanMeltQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		meltQuotes = append(meltQuotes, meltQuote)
 	}
 
-	return meltQuote, nil
+	return meltQuotes, nil
 }
 
-func (sqlite *SQLiteDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.MeltQuote, error) {
-	row := sqlite.db.QueryRow("SELECT * FROM melt_quotes WHERE request = ?", invoice)
+func (sqlite *SQLiteDB) ListMeltQuotes(state nut05.State, limit, offset int) ([]storage.MeltQuote, error) {
+	meltQuotes := []storage.MeltQuote{}
+
+	query := "SELECT * FROM melt_quotes"
+	args := []any{}
+	if state != nut05.Unknown {
+		query += " WHERE state = ?"
+		args = append(args, state.String())
+	}
+	query += " ORDER BY rowid LIMIT ? OFFSET ?"
+	args = append(args, sqlLimit(limit), offset)
+
+	rows, err := sqlite.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	for rows.Next() {
+		meltQuote, err := scanMeltQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		meltQuotes = append(meltQuotes, meltQuote)
+	}
+
+	return meltQuotes, nil
+}
+
+func scanMeltQuote(row scanner) (storage.MeltQuote, error) {
 	var meltQuote storage.MeltQuote
 	var state string
 	var isMpp sql.NullBool
 	var amountMsat sql.NullInt64
+	var feeReserveMsat sql.NullInt64
+	var method sql.NullString
+	var backend sql.NullString
+	var percentageFeeReserveMsat sql.NullInt64
+	var estimatedFeeMsat sql.NullInt64
 
 	err := row.Scan(
 		&meltQuote.Id,
@@ -579,9 +885,14 @@ func (sqlite *SQLiteDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.M
 		&meltQuote.Preimage,
 		&isMpp,
 		&amountMsat,
+		&feeReserveMsat,
+		&method,
+		&backend,
+		&percentageFeeReserveMsat,
+		&estimatedFeeMsat,
 	)
 	if err != nil {
-		return nil, err
+		return storage.MeltQuote{}, err
 	}
 	meltQuote.State = nut05.StringToState(state)
 	if isMpp.Valid {
@@ -590,8 +901,24 @@ func (sqlite *SQLiteDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.M
 	if amountMsat.Valid {
 		meltQuote.AmountMsat = uint64(amountMsat.Int64)
 	}
+	if feeReserveMsat.Valid {
+		meltQuote.FeeReserveMsat = uint64(feeReserveMsat.Int64)
+	}
+	if method.Valid {
+		meltQuote.Method = method.String
+	}
+	if backend.Valid {
+		meltQuote.Backend = backend.String
+	}
+	if percentageFeeReserveMsat.Valid {
+		meltQuote.PercentageFeeReserveMsat = uint64(percentageFeeReserveMsat.Int64)
+	}
+	if estimatedFeeMsat.Valid {
+		estimatedFee := uint64(estimatedFeeMsat.Int64)
+		meltQuote.EstimatedFeeMsat = &estimatedFee
+	}
 
-	return &meltQuote, nil
+	return meltQuote, nil
 }
 
 func (sqlite *SQLiteDB) UpdateMeltQuote(quoteId, preimage string, state nut05.State) error {
@@ -614,30 +941,106 @@ func (sqlite *SQLiteDB) UpdateMeltQuote(quoteId, preimage string, state nut05.St
 	return nil
 }
 
+func (sqlite *SQLiteDB) UpdateMeltQuoteBackend(quoteId, backend string) error {
+	result, err := sqlite.db.Exec("UPDATE melt_quotes SET backend = ? WHERE id = ?", backend, quoteId)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return errors.New("melt quote was not updated")
+	}
+	return nil
+}
+
 func (sqlite *SQLiteDB) SaveBlindSignatures(B_s []string, blindSignatures cashu.BlindedSignatures) error {
 	tx, err := sqlite.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT INTO blind_signatures (b_, c_, keyset_id, amount, e, s) VALUES (?, ?, ?, ?, ?, ?)")
+	if err := saveBlindSignatures(tx, B_s, blindSignatures); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveBlindSignatures(tx *sql.Tx, B_s []string, blindSignatures cashu.BlindedSignatures) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO blind_signatures (b_, c_, keyset_id, amount, e, s, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
+	createdAt := time.Now().Unix()
+
 	for i, sig := range blindSignatures {
-		if _, err := stmt.Exec(B_s[i], sig.C_, sig.Id, sig.Amount, sig.DLEQ.E, sig.DLEQ.S); err != nil {
-			tx.Rollback()
+		var e, s sql.NullString
+		if sig.DLEQ != nil {
+			e = sql.NullString{String: sig.DLEQ.E, Valid: true}
+			s = sql.NullString{String: sig.DLEQ.S, Valid: true}
+		}
+		if _, err := stmt.Exec(B_s[i], sig.C_, sig.Id, sig.Amount, e, s, createdAt); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	if err := tx.Commit(); err != nil {
+func (sqlite *SQLiteDB) ImportState(state storage.MintState) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	if err := saveSeed(tx, state.Seed); err != nil {
+		return fmt.Errorf("error saving seed: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM keysets"); err != nil {
+		return fmt.Errorf("error removing keysets: %v", err)
+	}
+	for _, keyset := range state.Keysets {
+		if err := saveKeyset(tx, keyset); err != nil {
+			return fmt.Errorf("error saving keyset '%v': %v", keyset.Id, err)
+		}
+	}
+	for _, quote := range state.MintQuotes {
+		if err := saveMintQuote(tx, quote); err != nil {
+			return fmt.Errorf("error saving mint quote '%v': %v", quote.Id, err)
+		}
+	}
+	for _, quote := range state.MeltQuotes {
+		if err := saveMeltQuote(tx, quote); err != nil {
+			return fmt.Errorf("error saving melt quote '%v': %v", quote.Id, err)
+		}
+	}
+	if err := saveProofs(tx, state.Proofs); err != nil {
+		return fmt.Errorf("error saving used proofs: %v", err)
+	}
+	for quoteId, proofs := range state.PendingProofs {
+		if err := addPendingProofs(tx, proofs, quoteId); err != nil {
+			return fmt.Errorf("error saving pending proofs for quote '%v': %v", quoteId, err)
+		}
+	}
+	B_s := make([]string, len(state.BlindSignatures))
+	signatures := make(cashu.BlindedSignatures, len(state.BlindSignatures))
+	for i, sig := range state.BlindSignatures {
+		B_s[i] = sig.B_
+		signatures[i] = sig.Signature
+	}
+	if err := saveBlindSignatures(tx, B_s, signatures); err != nil {
+		return fmt.Errorf("error saving blind signatures: %v", err)
+	}
+
+	return tx.Commit()
 }
 
 func (sqlite *SQLiteDB) GetBlindSignature(B_ string) (cashu.BlindedSignature, error) {
@@ -716,6 +1119,105 @@ func (sqlite *SQLiteDB) GetBlindSignatures(B_s []string) (cashu.BlindedSignature
 	return signatures, nil
 }
 
+func (sqlite *SQLiteDB) GetAllBlindSignatures() ([]storage.DBBlindSignature, error) {
+	rows, err := sqlite.db.Query("SELECT b_, amount, c_, keyset_id, e, s FROM blind_signatures")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDBBlindSignatures(rows)
+}
+
+// number of B_s looked up in each query of GetBlindSignaturesByB_.
+// Keeps the number of parameters in a query under the sqlite limit.
+const blindSignaturesBatchSize = 500
+
+func (sqlite *SQLiteDB) GetBlindSignaturesByB_(B_s []string) ([]storage.DBBlindSignature, error) {
+	signatures := []storage.DBBlindSignature{}
+	if len(B_s) == 0 {
+		return signatures, nil
+	}
+
+	query := func(n int) string {
+		return "SELECT b_, amount, c_, keyset_id, e, s FROM blind_signatures WHERE b_ IN (?" +
+			strings.Repeat(",?", n-1) + ")"
+	}
+
+	// statement for full batches is prepared once and reused.
+	// The last batch, if smaller, gets its own query.
+	var batchStmt *sql.Stmt
+	if len(B_s) >= blindSignaturesBatchSize {
+		stmt, err := sqlite.db.Prepare(query(blindSignaturesBatchSize))
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+		batchStmt = stmt
+	}
+
+	for start := 0; start < len(B_s); start += blindSignaturesBatchSize {
+		end := min(start+blindSignaturesBatchSize, len(B_s))
+		args := make([]any, end-start)
+		for i, B_ := range B_s[start:end] {
+			args[i] = B_
+		}
+
+		var rows *sql.Rows
+		var err error
+		if len(args) == blindSignaturesBatchSize {
+			rows, err = batchStmt.Query(args...)
+		} else {
+			rows, err = sqlite.db.Query(query(len(args)), args...)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		batch, err := scanDBBlindSignatures(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, batch...)
+	}
+
+	return signatures, nil
+}
+
+func scanDBBlindSignatures(rows *sql.Rows) ([]storage.DBBlindSignature, error) {
+	signatures := []storage.DBBlindSignature{}
+
+	for rows.Next() {
+		var signature storage.DBBlindSignature
+		var e sql.NullString
+		var s sql.NullString
+
+		err := rows.Scan(
+			&signature.B_,
+			&signature.Signature.Amount,
+			&signature.Signature.C_,
+			&signature.Signature.Id,
+			&e,
+			&s,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Valid && s.Valid {
+			signature.Signature.DLEQ = &cashu.DLEQProof{
+				E: e.String,
+				S: s.String,
+			}
+		}
+
+		signatures = append(signatures, signature)
+	}
+
+	return signatures, rows.Err()
+}
+
 func (sqlite *SQLiteDB) GetIssuedEcash() (map[string]uint64, error) {
 	ecashIssued := make(map[string]uint64)
 
@@ -757,3 +1259,57 @@ func (sqlite *SQLiteDB) GetRedeemedEcash() (map[string]uint64, error) {
 
 	return ecashRedeemed, nil
 }
+
+func (sqlite *SQLiteDB) Prune(cutoffs storage.PruneCutoffs, dryRun bool) (storage.PruneResult, error) {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return storage.PruneResult{}, err
+	}
+	defer tx.Rollback()
+
+	var result storage.PruneResult
+
+	// each cutoff is a filter on a table. A zero cutoff does not match anything
+	// so the same queries work for the tables that are not pruned
+	mintQuotesFilter := "FROM mint_quotes WHERE state = 'ISSUED' AND expiry < ?"
+	meltQuotesFilter := "FROM melt_quotes WHERE state = 'PAID' AND expiry < ?"
+	blindSignaturesFilter := "FROM blind_signatures WHERE created_at < ?"
+
+	counts := []struct {
+		filter string
+		cutoff int64
+		count  *int64
+	}{
+		{mintQuotesFilter, cutoffs.MintQuotes, &result.MintQuotes},
+		{meltQuotesFilter, cutoffs.MeltQuotes, &result.MeltQuotes},
+		{blindSignaturesFilter, cutoffs.BlindSignatures, &result.BlindSignatures},
+	}
+	for _, c := range counts {
+		if err := tx.QueryRow("SELECT COUNT(*) "+c.filter, c.cutoff).Scan(c.count); err != nil {
+			return storage.PruneResult{}, err
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	// keep amounts of the signatures deleted so issued ecash stays the same
+	if _, err := tx.Exec(`
+		INSERT INTO pruned_blind_signatures (keyset_id, amount)
+		SELECT keyset_id, SUM(amount) `+blindSignaturesFilter+` GROUP BY keyset_id
+		ON CONFLICT(keyset_id) DO UPDATE SET amount = amount + excluded.amount
+	`, cutoffs.BlindSignatures); err != nil {
+		return storage.PruneResult{}, err
+	}
+
+	for _, c := range counts {
+		if _, err := tx.Exec("DELETE "+c.filter, c.cutoff); err != nil {
+			return storage.PruneResult{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.PruneResult{}, err
+	}
+	return result, nil
+}
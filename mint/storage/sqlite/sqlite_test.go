@@ -2,15 +2,19 @@ package sqlite
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/hex"
+	"errors"
 	"log"
 	"math/rand/v2"
 	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
@@ -81,6 +85,44 @@ func TestProofs(t *testing.T) {
 	}
 }
 
+func TestConcurrentWrites(t *testing.T) {
+	var journalMode string
+	if err := db.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		t.Fatalf("unexpected error reading journal mode: %v", err)
+	}
+	if journalMode != "wal" {
+		t.Fatalf("expected journal mode 'wal' but got '%v'", journalMode)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proofs := generateRandomProofs(10)
+			if err := db.SaveProofs(proofs); err != nil {
+				errs <- err
+				return
+			}
+			Ys := make([]string, len(proofs))
+			for j, proof := range proofs {
+				Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+				Ys[j] = hex.EncodeToString(Y.SerializeCompressed())
+			}
+			if _, err := db.GetProofsUsed(Ys); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("unexpected error with concurrent writes: %v", err)
+	}
+}
+
 func TestPendingProofs(t *testing.T) {
 	quoteId := "quoteid12345"
 	proofs := generateRandomProofs(50)
@@ -265,6 +307,80 @@ func TestMintQuotes(t *testing.T) {
 	}
 }
 
+func TestListQuotes(t *testing.T) {
+	// fresh db so quotes saved in other tests are not listed
+	sqlitedb, err := InitSQLite(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error initializing db: %v", err)
+	}
+	defer sqlitedb.Close()
+
+	mintQuotes := generateRandomMintQuotes(10, false)
+	for i := range mintQuotes {
+		if i%2 == 0 {
+			mintQuotes[i].State = nut04.Paid
+		}
+		if err := sqlitedb.SaveMintQuote(mintQuotes[i]); err != nil {
+			t.Fatalf("error saving mint quote: %v", err)
+		}
+	}
+
+	listed, err := sqlitedb.ListMintQuotes(nut04.Unknown, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error listing mint quotes: %v", err)
+	}
+	if !reflect.DeepEqual(listed, mintQuotes) {
+		t.Fatal("listed mint quotes do not match the ones saved")
+	}
+
+	listed, err = sqlitedb.ListMintQuotes(nut04.Paid, 2, 1)
+	if err != nil {
+		t.Fatalf("unexpected error listing mint quotes: %v", err)
+	}
+	expectedMintQuotes := []storage.MintQuote{mintQuotes[2], mintQuotes[4]}
+	if !reflect.DeepEqual(listed, expectedMintQuotes) {
+		t.Fatalf("expected mint quotes '%v' but got '%v'", expectedMintQuotes, listed)
+	}
+
+	meltQuotes := generateRandomMeltQuotes(5)
+	meltQuotes[3].State = nut05.Pending
+	for _, quote := range meltQuotes {
+		if err := sqlitedb.SaveMeltQuote(quote); err != nil {
+			t.Fatalf("error saving melt quote: %v", err)
+		}
+	}
+
+	listedMelt, err := sqlitedb.ListMeltQuotes(nut05.Pending, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error listing melt quotes: %v", err)
+	}
+	if len(listedMelt) != 1 || listedMelt[0].Id != meltQuotes[3].Id {
+		t.Fatalf("expected melt quote '%v' but got '%v'", meltQuotes[3].Id, listedMelt)
+	}
+
+	listedMelt, err = sqlitedb.ListMeltQuotes(nut05.Unknown, 10, 4)
+	if err != nil {
+		t.Fatalf("unexpected error listing melt quotes: %v", err)
+	}
+	if len(listedMelt) != 1 || listedMelt[0].Id != meltQuotes[4].Id {
+		t.Fatalf("expected melt quote '%v' but got '%v'", meltQuotes[4].Id, listedMelt)
+	}
+
+	for i := 0; i < 3; i++ {
+		keyset := storage.DBKeyset{Id: generateRandomString(16), Unit: "sat", Seed: "seed", DerivationPathIdx: uint32(i)}
+		if err := sqlitedb.SaveKeyset(keyset); err != nil {
+			t.Fatalf("error saving keyset: %v", err)
+		}
+	}
+	keysets, err := sqlitedb.ListKeysets(1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error listing keysets: %v", err)
+	}
+	if len(keysets) != 1 || keysets[0].DerivationPathIdx != 2 {
+		t.Fatalf("expected keyset with derivation path idx 2 but got '%v'", keysets)
+	}
+}
+
 func TestMeltQuote(t *testing.T) {
 	meltQuotes := generateRandomMeltQuotes(150)
 
@@ -333,6 +449,21 @@ func TestMeltQuote(t *testing.T) {
 	if !reflect.DeepEqual(expectedQuote, quote) {
 		t.Fatal("quote from db does not match generated one")
 	}
+
+	if err := db.UpdateMeltQuoteBackend(quote.Id, "fallback"); err != nil {
+		t.Fatalf("error updating melt quote backend: %v", err)
+	}
+	expectedQuote.Backend = "fallback"
+	quote, err = db.GetMeltQuote(expectedQuote.Id)
+	if err != nil {
+		t.Fatalf("error getting melt quote by id: %v", err)
+	}
+	if !reflect.DeepEqual(expectedQuote, quote) {
+		t.Fatal("quote from db does not match generated one")
+	}
+	if err := db.UpdateMeltQuoteBackend("unknown", "fallback"); err == nil {
+		t.Fatal("expected error updating quote that does not exist")
+	}
 }
 
 func TestBlindSignatures(t *testing.T) {
@@ -366,6 +497,277 @@ func TestBlindSignatures(t *testing.T) {
 
 }
 
+func TestGetBlindSignaturesByB_(t *testing.T) {
+	// more than one batch of signatures plus some B_s that were not signed
+	count := blindSignaturesBatchSize + 100
+	B_s := generateRandomB_s(count)
+	blindSignatures := generateBlindSignatures(count)
+	if err := db.SaveBlindSignatures(B_s, blindSignatures); err != nil {
+		t.Fatalf("unexpected error saving blind signatures: %v", err)
+	}
+	lookup := append(generateRandomB_s(10), B_s...)
+
+	dbSignatures, err := db.GetBlindSignaturesByB_(lookup)
+	if err != nil {
+		t.Fatalf("unexpected error getting blind signatures: %v", err)
+	}
+	if len(dbSignatures) != count {
+		t.Fatalf("expected %v blind signatures but got %v", count, len(dbSignatures))
+	}
+
+	expected := make(map[string]cashu.BlindedSignature, count)
+	for i, B_ := range B_s {
+		expected[B_] = blindSignatures[i]
+	}
+	for _, sig := range dbSignatures {
+		if !reflect.DeepEqual(sig.Signature, expected[sig.B_]) {
+			t.Fatalf("blind signature for '%v' does not match the one saved", sig.B_)
+		}
+	}
+
+	dbSignatures, err = db.GetBlindSignaturesByB_([]string{})
+	if err != nil {
+		t.Fatalf("unexpected error getting blind signatures: %v", err)
+	}
+	if len(dbSignatures) != 0 {
+		t.Fatalf("expected no blind signatures but got %v", len(dbSignatures))
+	}
+}
+
+func TestBackup(t *testing.T) {
+	proofs := generateRandomProofs(10)
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	backupDir := t.TempDir()
+	backupPath := filepath.Join(backupDir, "mint.sqlite.db")
+	if err := db.Backup(backupPath); err != nil {
+		t.Fatalf("unexpected error backing up db: %v", err)
+	}
+	if err := db.Backup(backupPath); err == nil {
+		t.Fatal("expected error backing up to a file that already exists")
+	}
+
+	// backup should be usable as the db of a mint
+	backup, err := InitSQLite(backupDir)
+	if err != nil {
+		t.Fatalf("unexpected error opening backup: %v", err)
+	}
+	defer backup.Close()
+
+	usedProofs, err := backup.GetAllProofsUsed()
+	if err != nil {
+		t.Fatalf("unexpected error getting proofs from backup: %v", err)
+	}
+	expectedProofs, err := db.GetAllProofsUsed()
+	if err != nil {
+		t.Fatalf("unexpected error getting proofs from db: %v", err)
+	}
+	if len(usedProofs) != len(expectedProofs) {
+		t.Fatalf("expected %v proofs in backup but got %v", len(expectedProofs), len(usedProofs))
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	if _, err := OpenReadReplica(t.TempDir()); err == nil {
+		t.Fatal("expected error opening replica that does not exist")
+	}
+
+	proofs := generateRandomProofs(10)
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	replicaDir := t.TempDir()
+	if err := db.Backup(filepath.Join(replicaDir, "mint.sqlite.db")); err != nil {
+		t.Fatalf("unexpected error copying db: %v", err)
+	}
+
+	replica, err := OpenReadReplica(replicaDir)
+	if err != nil {
+		t.Fatalf("unexpected error opening replica: %v", err)
+	}
+	defer replica.Close()
+
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+	usedProofs, err := replica.GetProofsUsed(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error getting proofs from replica: %v", err)
+	}
+	if len(usedProofs) != len(proofs) {
+		t.Fatalf("expected %v proofs in replica but got %v", len(proofs), len(usedProofs))
+	}
+
+	if err := replica.SaveProofs(generateRandomProofs(1)); err == nil {
+		t.Fatal("expected error writing to read replica")
+	}
+}
+
+func TestImportState(t *testing.T) {
+	sqlitedb, err := InitSQLite(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error initializing db: %v", err)
+	}
+	defer sqlitedb.Close()
+
+	if err := sqlitedb.SaveKeyset(storage.DBKeyset{Id: "00a", Unit: "sat", Active: true}); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+
+	proofs := generateRandomProofs(5)
+	state := storage.MintState{
+		Seed:            []byte{1, 2, 3},
+		Keysets:         []storage.DBKeyset{{Id: "00b", Unit: "sat", Active: true}},
+		MintQuotes:      generateRandomMintQuotes(3, false),
+		MeltQuotes:      generateRandomMeltQuotes(2),
+		Proofs:          proofs,
+		PendingProofs:   map[string]cashu.Proofs{"quote1": generateRandomProofs(2)},
+		BlindSignatures: []storage.DBBlindSignature{{B_: generateRandomString(66), Signature: generateBlindSignatures(1)[0]}},
+	}
+
+	// duplicate proof fails after the seed, keysets
+	// and quotes were written so none of them are kept
+	failingState := state
+	failingState.Proofs = append(slices.Clone(proofs), proofs[0])
+	if err := sqlitedb.ImportState(failingState); err == nil {
+		t.Fatal("expected error importing state with duplicate proofs")
+	}
+	if _, err := sqlitedb.GetSeed(); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+	keysets, _ := sqlitedb.GetKeysets()
+	if len(keysets) != 1 || keysets[0].Id != "00a" {
+		t.Fatalf("expected keysets to be unchanged but got %v", keysets)
+	}
+	mintQuotes, _ := sqlitedb.GetMintQuotes()
+	if len(mintQuotes) != 0 {
+		t.Fatalf("expected no mint quotes but got %v", len(mintQuotes))
+	}
+
+	if err := sqlitedb.ImportState(state); err != nil {
+		t.Fatalf("unexpected error importing state: %v", err)
+	}
+	seed, _ := sqlitedb.GetSeed()
+	if !bytes.Equal(seed, state.Seed) {
+		t.Fatalf("expected seed '%v' but got '%v'", state.Seed, seed)
+	}
+	keysets, _ = sqlitedb.GetKeysets()
+	if len(keysets) != 1 || keysets[0].Id != "00b" {
+		t.Fatalf("expected keyset '00b' but got %v", keysets)
+	}
+	usedProofs, _ := sqlitedb.GetAllProofsUsed()
+	if len(usedProofs) != len(proofs) {
+		t.Fatalf("expected %v proofs but got %v", len(proofs), len(usedProofs))
+	}
+	pendingProofs, _ := sqlitedb.GetPendingProofsByQuote("quote1")
+	if len(pendingProofs) != 2 {
+		t.Fatalf("expected %v pending proofs but got %v", 2, len(pendingProofs))
+	}
+	meltQuotes, _ := sqlitedb.GetMeltQuotes()
+	if len(meltQuotes) != 2 {
+		t.Fatalf("expected %v melt quotes but got %v", 2, len(meltQuotes))
+	}
+	blindSignatures, _ := sqlitedb.GetAllBlindSignatures()
+	if len(blindSignatures) != 1 {
+		t.Fatalf("expected %v blind signatures but got %v", 1, len(blindSignatures))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	sqlitedb, err := InitSQLite(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error initializing db: %v", err)
+	}
+	defer sqlitedb.Close()
+
+	now := time.Now().Unix()
+	mintQuotes := generateRandomMintQuotes(3, false)
+	mintQuotes[0].State, mintQuotes[0].Expiry = nut04.Issued, uint64(now-1000)
+	// not issued so it is kept even if expired
+	mintQuotes[1].State, mintQuotes[1].Expiry = nut04.Paid, uint64(now-1000)
+	mintQuotes[2].State, mintQuotes[2].Expiry = nut04.Issued, uint64(now+1000)
+	for _, quote := range mintQuotes {
+		if err := sqlitedb.SaveMintQuote(quote); err != nil {
+			t.Fatalf("error saving mint quote: %v", err)
+		}
+	}
+
+	meltQuotes := generateRandomMeltQuotes(2)
+	meltQuotes[0].State, meltQuotes[0].Expiry = nut05.Paid, uint64(now-1000)
+	meltQuotes[1].State, meltQuotes[1].Expiry = nut05.Pending, uint64(now-1000)
+	for _, quote := range meltQuotes {
+		if err := sqlitedb.SaveMeltQuote(quote); err != nil {
+			t.Fatalf("error saving melt quote: %v", err)
+		}
+	}
+
+	blindSignatures := generateBlindSignatures(5)
+	if err := sqlitedb.SaveBlindSignatures(generateRandomB_s(5), blindSignatures); err != nil {
+		t.Fatalf("error saving blind signatures: %v", err)
+	}
+	issuedBefore, err := sqlitedb.GetIssuedEcash()
+	if err != nil {
+		t.Fatalf("unexpected error getting issued ecash: %v", err)
+	}
+
+	cutoffs := storage.PruneCutoffs{MintQuotes: now, MeltQuotes: now, BlindSignatures: now + 1}
+	expected := storage.PruneResult{MintQuotes: 1, MeltQuotes: 1, BlindSignatures: 5}
+
+	result, err := sqlitedb.Prune(cutoffs, true)
+	if err != nil {
+		t.Fatalf("unexpected error in dry run: %v", err)
+	}
+	if result != expected {
+		t.Fatalf("expected dry run result %+v but got %+v", expected, result)
+	}
+	if quotes, _ := sqlitedb.GetMintQuotes(); len(quotes) != 3 {
+		t.Fatalf("expected dry run to keep 3 mint quotes but got %v", len(quotes))
+	}
+
+	result, err = sqlitedb.Prune(cutoffs, false)
+	if err != nil {
+		t.Fatalf("unexpected error pruning: %v", err)
+	}
+	if result != expected {
+		t.Fatalf("expected result %+v but got %+v", expected, result)
+	}
+
+	if _, err := sqlitedb.GetMintQuote(mintQuotes[0].Id); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+	}
+	if quotes, _ := sqlitedb.GetMintQuotes(); len(quotes) != 2 {
+		t.Fatalf("expected 2 mint quotes but got %v", len(quotes))
+	}
+	if quotes, _ := sqlitedb.GetMeltQuotes(); len(quotes) != 1 || quotes[0].Id != meltQuotes[1].Id {
+		t.Fatalf("expected only melt quote '%v' but got %+v", meltQuotes[1].Id, quotes)
+	}
+	if sigs, _ := sqlitedb.GetAllBlindSignatures(); len(sigs) != 0 {
+		t.Fatalf("expected no blind signatures but got %v", len(sigs))
+	}
+
+	// issued ecash should not change after blind signatures are deleted
+	issuedAfter, err := sqlitedb.GetIssuedEcash()
+	if err != nil {
+		t.Fatalf("unexpected error getting issued ecash: %v", err)
+	}
+	if !reflect.DeepEqual(issuedBefore, issuedAfter) {
+		t.Fatalf("expected issued ecash '%v' but got '%v'", issuedBefore, issuedAfter)
+	}
+
+	// zero cutoffs do not delete anything
+	result, err = sqlitedb.Prune(storage.PruneCutoffs{}, false)
+	if err != nil {
+		t.Fatalf("unexpected error pruning: %v", err)
+	}
+	if result != (storage.PruneResult{}) {
+		t.Fatalf("expected nothing pruned but got %+v", result)
+	}
+}
+
 func TestBalanceViews(t *testing.T) {
 	dbpath := "./balanceviewsdb"
 	if err := os.MkdirAll(dbpath, 0750); err != nil {
@@ -517,12 +919,20 @@ func generateRandomMeltQuotes(num int) []storage.MeltQuote {
 	quotes := make([]storage.MeltQuote, num)
 	for i := 0; i < num; i++ {
 		quote := storage.MeltQuote{
-			Id:             generateRandomString(32),
-			InvoiceRequest: generateRandomString(100),
-			PaymentHash:    generateRandomString(50),
-			Amount:         21,
-			FeeReserve:     1,
-			State:          nut05.Unpaid,
+			Id:                       generateRandomString(32),
+			InvoiceRequest:           generateRandomString(100),
+			PaymentHash:              generateRandomString(50),
+			Amount:                   21,
+			FeeReserve:               1,
+			State:                    nut05.Unpaid,
+			AmountMsat:               20500,
+			FeeReserveMsat:           205,
+			PercentageFeeReserveMsat: 205,
+		}
+		// every other quote has a fee estimate
+		if i%2 == 0 {
+			estimatedFee := uint64(150)
+			quote.EstimatedFeeMsat = &estimatedFee
 		}
 		quotes[i] = quote
 	}
@@ -554,3 +964,42 @@ func generateBlindSignatures(num int) cashu.BlindedSignatures {
 	}
 	return blindSigs
 }
+
+func TestMigrations(t *testing.T) {
+	dbpath := t.TempDir()
+
+	// migrations embedded in the binary
+	sqlitedb, err := InitSQLite(dbpath)
+	if err != nil {
+		t.Fatalf("unexpected error initializing db: %v", err)
+	}
+	version, err := sqlitedb.SchemaVersion()
+	if err != nil {
+		t.Fatalf("unexpected error reading migration version: %v", err)
+	}
+	if version != 16 {
+		t.Fatalf("expected migration version 16 but got %v", version)
+	}
+	sqlitedb.Close()
+
+	// opening again should not run migrations already applied
+	sqlitedb, err = InitSQLiteWithMigrations(dbpath, "./migrations")
+	if err != nil {
+		t.Fatalf("unexpected error opening db again: %v", err)
+	}
+
+	// db migrated by a newer version should not be opened
+	if _, err := sqlitedb.db.Exec("UPDATE schema_migrations SET version = 1000"); err != nil {
+		t.Fatalf("unexpected error updating schema version: %v", err)
+	}
+	sqlitedb.Close()
+	_, err = InitSQLite(dbpath)
+	if !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrNewerSchema, err)
+	}
+
+	_, err = InitSQLiteWithMigrations(t.TempDir(), "./nonexistent")
+	if err == nil {
+		t.Fatal("expected error with invalid migrations path")
+	}
+}
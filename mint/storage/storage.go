@@ -7,41 +7,132 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
 )
 
+// MintDB is the storage of the mint. It is split in a reader and a writer
+// half so that reads which can tolerate some lag, like checking the
+// state of proofs, can be served by a read-only replica of the db.
 type MintDB interface {
-	SaveSeed([]byte) error
+	MintDBReader
+	MintDBWriter
+
+	Close() error
+}
+
+// MintDBReader has the methods that only read from the db
+type MintDBReader interface {
 	GetSeed() ([]byte, error)
 
-	SaveKeyset(DBKeyset) error
 	GetKeysets() ([]DBKeyset, error)
-	UpdateKeysetActive(keysetId string, active bool) error
+	// ListKeysets returns up to limit keysets, skipping the first offset.
+	// A limit of 0 returns all of them.
+	ListKeysets(limit, offset int) ([]DBKeyset, error)
 
-	SaveProofs(cashu.Proofs) error
 	GetProofsUsed(Ys []string) ([]DBProof, error)
-	AddPendingProofs(proofs cashu.Proofs, quoteId string) error
 	GetPendingProofs(Ys []string) ([]DBProof, error)
 	GetPendingProofsByQuote(quoteId string) ([]DBProof, error)
-	RemovePendingProofs(Ys []string) error
+	// these return all the used and pending proofs
+	GetAllProofsUsed() ([]DBProof, error)
+	GetAllPendingProofs() ([]DBProof, error)
 
-	SaveMintQuote(MintQuote) error
 	GetMintQuote(string) (MintQuote, error)
 	GetMintQuoteByPaymentHash(string) (MintQuote, error)
-	UpdateMintQuoteState(quoteId string, state nut04.State) error
+	GetMintQuotes() ([]MintQuote, error)
+	// ListMintQuotes returns the mint quotes in state, in the order they were saved.
+	// nut04.Unknown matches quotes in any state. Limit and offset work as in ListKeysets.
+	ListMintQuotes(state nut04.State, limit, offset int) ([]MintQuote, error)
 
-	SaveMeltQuote(MeltQuote) error
 	GetMeltQuote(string) (MeltQuote, error)
 	// used to check if a melt quote already exists for the passed invoice
 	GetMeltQuoteByPaymentRequest(string) (*MeltQuote, error)
-	UpdateMeltQuote(quoteId string, preimage string, state nut05.State) error
+	GetMeltQuotes() ([]MeltQuote, error)
+	// ListMeltQuotes is the same as ListMintQuotes for melt quotes.
+	ListMeltQuotes(state nut05.State, limit, offset int) ([]MeltQuote, error)
 
-	SaveBlindSignatures(B_s []string, blindSignatures cashu.BlindedSignatures) error
 	GetBlindSignature(B_ string) (cashu.BlindedSignature, error)
 	GetBlindSignatures(B_s []string) (cashu.BlindedSignatures, error)
+	// GetBlindSignaturesByB_ returns the signatures for the B_s that have been signed
+	// along with their B_. B_s without a signature are not in the result.
+	GetBlindSignaturesByB_(B_s []string) ([]DBBlindSignature, error)
+	GetAllBlindSignatures() ([]DBBlindSignature, error)
 
 	// these return a map of keyset id and amount
 	GetIssuedEcash() (map[string]uint64, error)
 	GetRedeemedEcash() (map[string]uint64, error)
+}
 
-	Close() error
+// MintDBWriter has the methods that write to the db
+type MintDBWriter interface {
+	SaveSeed([]byte) error
+
+	SaveKeyset(DBKeyset) error
+	UpdateKeysetActive(keysetId string, active bool) error
+	DeleteKeyset(keysetId string) error
+
+	SaveProofs(cashu.Proofs) error
+	AddPendingProofs(proofs cashu.Proofs, quoteId string) error
+	RemovePendingProofs(Ys []string) error
+
+	SaveMintQuote(MintQuote) error
+	UpdateMintQuoteState(quoteId string, state nut04.State) error
+
+	SaveMeltQuote(MeltQuote) error
+	UpdateMeltQuote(quoteId string, preimage string, state nut05.State) error
+	UpdateMeltQuoteBackend(quoteId string, backend string) error
+
+	SaveBlindSignatures(B_s []string, blindSignatures cashu.BlindedSignatures) error
+
+	// ImportState replaces the seed and keysets with the ones in state and saves its
+	// quotes, proofs and blind signatures in a single transaction. Nothing is
+	// saved if it fails.
+	ImportState(state MintState) error
+
+	// Prune deletes the data older than the cutoffs and returns how much was deleted.
+	// If dryRun is true nothing is deleted, it only counts what would be.
+	Prune(cutoffs PruneCutoffs, dryRun bool) (PruneResult, error)
+}
+
+// PruneCutoffs are the unix times before which data is deleted by Prune.
+// A zero value keeps that data. Proofs are never deleted.
+type PruneCutoffs struct {
+	// issued mint quotes that expired before this time
+	MintQuotes int64
+	// paid melt quotes that expired before this time
+	MeltQuotes int64
+	// blind signatures created before this time. Their amounts are
+	// still counted in the issued ecash after they are deleted.
+	BlindSignatures int64
+}
+
+// PruneResult has the number of records deleted by Prune
+type PruneResult struct {
+	MintQuotes      int64
+	MeltQuotes      int64
+	BlindSignatures int64
+}
+
+// MintState is the data of a mint loaded with ImportState
+type MintState struct {
+	Seed       []byte
+	Keysets    []DBKeyset
+	MintQuotes []MintQuote
+	MeltQuotes []MeltQuote
+	Proofs     cashu.Proofs
+	// pending proofs by the id of the melt quote they are for
+	PendingProofs   map[string]cashu.Proofs
+	BlindSignatures []DBBlindSignature
+}
+
+// Backuper is implemented by the dbs that can write a consistent
+// copy of their data while the mint keeps running.
+type Backuper interface {
+	// Backup writes the copy to a new file in path.
+	// It fails if the file already exists.
+	Backup(path string) error
+}
+
+// SchemaVersioner is implemented by the dbs that keep
+// a version of their schema updated with migrations.
+type SchemaVersioner interface {
+	SchemaVersion() (uint, error)
 }
 
 type DBKeyset struct {
@@ -64,6 +155,11 @@ type DBProof struct {
 	MeltQuoteId string
 }
 
+type DBBlindSignature struct {
+	B_        string
+	Signature cashu.BlindedSignature
+}
+
 type MintQuote struct {
 	Id             string
 	Amount         uint64
@@ -84,6 +180,18 @@ type MeltQuote struct {
 	Expiry         uint64
 	Preimage       string
 	IsMpp          bool
-	// used when the melt quote is MPP
-	AmountMsat uint64
+	// amount to pay in msat. Amount and FeeReserve are
+	// these values rounded up to the ecash unit (sat)
+	AmountMsat     uint64
+	FeeReserveMsat uint64
+	// fee reserve from the percentage of the backend and the fee estimated
+	// by probing routes, if any. FeeReserveMsat is computed from these.
+	PercentageFeeReserveMsat uint64
+	EstimatedFeeMsat         *uint64
+	// payment method of the quote. Empty for bolt11 quotes.
+	// For keysend quotes, InvoiceRequest holds the destination pubkey
+	Method string
+	// name of the lightning backend the payment was sent with when
+	// the mint routes payments across several backends. Empty otherwise.
+	Backend string
 }
@@ -0,0 +1,81 @@
+// Package proxy routes outbound connections through a SOCKS5 or
+// HTTP proxy so that they can go through Tor and reach .onion hosts.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrOnionRequiresProxy = errors.New("a proxy is required to connect to .onion hosts")
+
+// Parse validates the proxy url. Supported schemes are socks5, socks5h, http and https.
+// Host names are resolved by the proxy, so socks5 is treated the same as socks5h.
+func Parse(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %v", err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		// websocket dialer only knows about socks5
+		u.Scheme = "socks5"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("invalid proxy url '%v'. Expected socks5, socks5h, http or https scheme", proxyURL)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy url '%v'. Missing host", proxyURL)
+	}
+	return u, nil
+}
+
+// IsOnion returns whether the host of the url is a Tor onion service
+func IsOnion(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Hostname()), ".onion")
+}
+
+// Transport returns an http.RoundTripper that makes requests through the proxy.
+// If proxyURL is nil, requests are made directly and requests to .onion
+// hosts fail with ErrOnionRequiresProxy instead of leaking DNS lookups.
+func Transport(proxyURL *url.URL) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL == nil {
+		return &directTransport{base: transport}
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return transport
+}
+
+// WebsocketDialer returns a websocket dialer that connects through the proxy.
+// If proxyURL is nil, it connects directly.
+func WebsocketDialer(proxyURL *url.URL) *websocket.Dialer {
+	if proxyURL == nil {
+		return websocket.DefaultDialer
+	}
+	return &websocket.Dialer{
+		Proxy:            http.ProxyURL(proxyURL),
+		HandshakeTimeout: 45 * time.Second,
+	}
+}
+
+type directTransport struct {
+	base http.RoundTripper
+}
+
+func (t *directTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(strings.ToLower(req.URL.Hostname()), ".onion") {
+		return nil, ErrOnionRequiresProxy
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		proxyURL       string
+		expectedScheme string
+		valid          bool
+	}{
+		{proxyURL: "socks5://127.0.0.1:9050", expectedScheme: "socks5", valid: true},
+		{proxyURL: "socks5h://127.0.0.1:9050", expectedScheme: "socks5", valid: true},
+		{proxyURL: "http://localhost:8118", expectedScheme: "http", valid: true},
+		{proxyURL: "socks4://127.0.0.1:9050", valid: false},
+		{proxyURL: "127.0.0.1:9050", valid: false},
+		{proxyURL: "socks5://", valid: false},
+	}
+
+	for _, test := range tests {
+		u, err := Parse(test.proxyURL)
+		if !test.valid {
+			if err == nil {
+				t.Fatalf("expected error parsing '%v'", test.proxyURL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error parsing '%v': %v", test.proxyURL, err)
+		}
+		if u.Scheme != test.expectedScheme {
+			t.Fatalf("expected scheme '%v' but got '%v'", test.expectedScheme, u.Scheme)
+		}
+	}
+}
+
+func TestIsOnion(t *testing.T) {
+	onion := "http://2jsnlhfnelig5acq6iacydmzdbdmg7xwunm4xl6qwbvzacw4lwrjmlyd.onion:3338"
+	if !IsOnion(onion) {
+		t.Fatalf("expected '%v' to be onion", onion)
+	}
+	if IsOnion("https://mint.example.com") {
+		t.Fatal("expected mint.example.com to not be onion")
+	}
+}
+
+func TestDirectTransportOnion(t *testing.T) {
+	client := &http.Client{Transport: Transport(nil)}
+	_, err := client.Get("http://2jsnlhfnelig5acq6iacydmzdbdmg7xwunm4xl6qwbvzacw4lwrjmlyd.onion/v1/info")
+	if !errors.Is(err, ErrOnionRequiresProxy) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrOnionRequiresProxy, err)
+	}
+}
@@ -848,7 +848,7 @@ func GetBlindedSignatures(amount uint64, mint *mint.Mint, payer LightningBackend
 	error) {
 
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := mint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err := mint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("error requesting mint quote: %v", err)
 	}
@@ -867,7 +867,7 @@ func GetBlindedSignatures(amount uint64, mint *mint.Mint, payer LightningBackend
 		Quote:   mintQuoteResponse.Id,
 		Outputs: blindedMessages,
 	}
-	blindedSignatures, err := mint.MintTokens(mintTokensRequest)
+	blindedSignatures, err := mint.MintTokens(context.Background(), mintTokensRequest)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("got unexpected error minting tokens: %v", err)
 	}
@@ -935,7 +935,7 @@ func GetProofsWithSpendingCondition(
 	payer LightningBackend,
 ) (cashu.Proofs, error) {
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := mint.RequestMintQuote(mintQuoteRequest)
+	mintQuoteResponse, err := mint.RequestMintQuote(context.Background(), mintQuoteRequest)
 	if err != nil {
 		return nil, fmt.Errorf("error requesting mint quote: %v", err)
 	}
@@ -957,7 +957,7 @@ func GetProofsWithSpendingCondition(
 		Quote:   mintQuoteResponse.Id,
 		Outputs: blindedMessages,
 	}
-	blindedSignatures, err := mint.MintTokens(mintTokensRequest)
+	blindedSignatures, err := mint.MintTokens(context.Background(), mintTokensRequest)
 	if err != nil {
 		return nil, fmt.Errorf("got unexpected error minting tokens: %v", err)
 	}
@@ -997,16 +997,15 @@ func AddP2PKWitnessToInputs(inputs cashu.Proofs, signingKeys []*btcec.PrivateKey
 	return inputs, nil
 }
 
-func AddP2PKWitnessToOutputs(
-	outputs cashu.BlindedMessages,
-	signingKeys []*btcec.PrivateKey,
-) (cashu.BlindedMessages, error) {
+// AddP2PKWitnessToOutputs signs the B_ of each output as wallets
+// did for SIG_ALL before the previous version of NUT-11 was replaced
+func AddP2PKWitnessToOutputs(outputs cashu.BlindedMessages, signingKeys []*btcec.PrivateKey) (cashu.BlindedMessages, error) {
 	for i, output := range outputs {
-		msgToSign, err := hex.DecodeString(output.B_)
+		B_, err := hex.DecodeString(output.B_)
 		if err != nil {
 			return nil, err
 		}
-		hash := sha256.Sum256(msgToSign)
+		hash := sha256.Sum256(B_)
 		signatures := make([]string, len(signingKeys))
 
 		for j, key := range signingKeys {
@@ -1014,12 +1013,10 @@ func AddP2PKWitnessToOutputs(
 			if err != nil {
 				return nil, err
 			}
-			sig := hex.EncodeToString(signature.Serialize())
-			signatures[j] = sig
+			signatures[j] = hex.EncodeToString(signature.Serialize())
 		}
 
-		p2pkWitness := nut11.P2PKWitness{Signatures: signatures}
-		witness, err := json.Marshal(p2pkWitness)
+		witness, err := json.Marshal(nut11.P2PKWitness{Signatures: signatures})
 		if err != nil {
 			return nil, err
 		}
@@ -1057,37 +1054,6 @@ func AddHTLCWitnessToInputs(inputs cashu.Proofs, preimage string, signingKey *bt
 	return inputs, nil
 }
 
-// it will add signatures if signingKey is not nil
-func AddHTLCWitnessToOutputs(outputs cashu.BlindedMessages, preimage string, signingKey *btcec.PrivateKey) (cashu.BlindedMessages, error) {
-	for i, output := range outputs {
-		htlcWitness := nut14.HTLCWitness{Preimage: preimage}
-
-		if signingKey != nil {
-			msgToSign, err := hex.DecodeString(output.B_)
-			if err != nil {
-				return nil, err
-			}
-			hash := sha256.Sum256(msgToSign)
-			signature, err := schnorr.Sign(signingKey, hash[:])
-			if err != nil {
-				return nil, err
-			}
-			sig := hex.EncodeToString(signature.Serialize())
-			htlcWitness.Signatures = []string{sig}
-		}
-
-		witness, err := json.Marshal(htlcWitness)
-		if err != nil {
-			return nil, err
-		}
-
-		output.Witness = string(witness)
-		outputs[i] = output
-	}
-
-	return outputs, nil
-}
-
 func Fees(proofs cashu.Proofs, mint string) (uint, error) {
 	keysetResponse, err := client.GetAllKeysets(mint)
 	if err != nil {
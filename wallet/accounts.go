@@ -0,0 +1,158 @@
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// Unit returns the unit of the proofs the wallet operates with
+func (w *Wallet) Unit() cashu.Unit {
+	return w.unit
+}
+
+// Account returns the wallet for the unit. Accounts share the seed, storage
+// and default mint of the wallet but only use keysets and proofs of their unit,
+// so balances, mints, sends and receives are kept separate for each unit.
+// The default mint of the wallet needs to support the unit.
+func (w *Wallet) Account(unit cashu.Unit) (*Wallet, error) {
+	if w.parent != nil {
+		return w.parent.Account(unit)
+	}
+	if unit == w.unit {
+		return w, nil
+	}
+
+	w.accountsMu.Lock()
+	defer w.accountsMu.Unlock()
+	if account, ok := w.accounts[unit]; ok {
+		return account, nil
+	}
+
+	account := &Wallet{
+		db:          w.db,
+		unit:        unit,
+		defaultMint: w.defaultMint,
+		masterKey:   w.masterKey,
+		privateKey:  w.privateKey,
+		nostrKey:    w.nostrKey,
+		nostrRelays: w.nostrRelays,
+		client:      w.client,
+		lnurlClient: w.lnurlClient,
+		parent:      w,
+
+		splitStrategy:          w.splitStrategy,
+		autoConsolidate:        w.autoConsolidate,
+		consolidationThreshold: w.consolidationThreshold,
+	}
+	mints, err := account.loadWalletMints()
+	if err != nil {
+		return nil, err
+	}
+	account.mints = mints
+	if _, ok := account.getMint(w.defaultMint); !ok {
+		if _, err := account.AddMint(w.defaultMint); err != nil {
+			return nil, fmt.Errorf("could not add '%v' for unit %v: %v", w.defaultMint, unit, err)
+		}
+	}
+
+	if w.accounts == nil {
+		w.accounts = make(map[cashu.Unit]*Wallet)
+	}
+	w.accounts[unit] = account
+	return account, nil
+}
+
+// GetBalanceByUnit returns the balance of the proofs in each unit
+func (w *Wallet) GetBalanceByUnit() map[cashu.Unit]uint64 {
+	keysetUnits := w.keysetUnits()
+	balances := make(map[cashu.Unit]uint64)
+	for _, proof := range w.db.GetProofs() {
+		unit, ok := keysetUnits[proof.Id]
+		if !ok {
+			unit = cashu.Sat
+		}
+		balances[unit] += proof.Amount
+	}
+	return balances
+}
+
+// keysetUnits returns the unit of each keyset in the db
+func (w *Wallet) keysetUnits() map[string]cashu.Unit {
+	keysetUnits := make(map[string]cashu.Unit)
+	for _, mintKeysets := range w.db.GetKeysets() {
+		for _, keyset := range mintKeysets {
+			unit, err := cashu.UnitFromString(keyset.Unit)
+			if err != nil {
+				continue
+			}
+			keysetUnits[keyset.Id] = unit
+		}
+	}
+	return keysetUnits
+}
+
+// isWalletUnitKeyset returns whether the keyset is of the unit of the wallet.
+// Keysets that are not known or that do not have a unit are assumed to be sat.
+func (w *Wallet) isWalletUnitKeyset(keysetUnits map[string]cashu.Unit, keysetId string) bool {
+	unit, ok := keysetUnits[keysetId]
+	if !ok {
+		unit = cashu.Sat
+	}
+	return unit == w.unit
+}
+
+// checkToken does the structural checks on the proofs of the token
+// before they are sent to the mint and checks they are in the unit of the wallet
+func (w *Wallet) checkToken(token cashu.Token) error {
+	if err := token.Proofs().Validate(); err != nil {
+		return fmt.Errorf("invalid proofs in token: %w", err)
+	}
+	return w.checkTokenUnit(token)
+}
+
+// checkTokenUnit prevents receiving tokens of other units or
+// tokens that have proofs from keysets of other units
+func (w *Wallet) checkTokenUnit(token cashu.Token) error {
+	if unit := cashu.TokenUnit(token); unit != w.unit.String() {
+		return fmt.Errorf("%w: token is in %v but wallet is in %v", cashu.ErrInvalidUnit, unit, w.unit)
+	}
+	return w.checkProofsUnit(token.Proofs())
+}
+
+func (w *Wallet) checkProofsUnit(proofs cashu.Proofs) error {
+	checked := make(map[string]bool)
+	for _, proof := range proofs {
+		if checked[proof.Id] {
+			continue
+		}
+		checked[proof.Id] = true
+		if keyset := w.db.GetKeyset(proof.Id); keyset != nil && keyset.Unit != w.unit.String() {
+			return fmt.Errorf("%w: proofs from keyset '%v' are in %v", cashu.ErrInvalidUnit, keyset.Id, keyset.Unit)
+		}
+	}
+	return nil
+}
+
+func (w *Wallet) unitProofs(proofs cashu.Proofs) cashu.Proofs {
+	keysetUnits := w.keysetUnits()
+	unitProofs := cashu.Proofs{}
+	for _, proof := range proofs {
+		if w.isWalletUnitKeyset(keysetUnits, proof.Id) {
+			unitProofs = append(unitProofs, proof)
+		}
+	}
+	return unitProofs
+}
+
+func (w *Wallet) unitPendingProofs(proofs []storage.DBProof) []storage.DBProof {
+	keysetUnits := w.keysetUnits()
+	unitProofs := []storage.DBProof{}
+	for _, proof := range proofs {
+		if w.isWalletUnitKeyset(keysetUnits, proof.Id) {
+			unitProofs = append(unitProofs, proof)
+		}
+	}
+	return unitProofs
+}
@@ -0,0 +1,322 @@
+package wallet
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/internal/keys"
+	"github.com/elnosh/gonuts/wallet/storage"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	backupVersion = 1
+	backupKDF     = "scrypt"
+
+	// scrypt parameters used to derive the encryption key from the passphrase
+	backupScryptN = 1 << 15
+	backupScryptR = 8
+	backupScryptP = 1
+)
+
+var (
+	ErrInvalidBackup            = errors.New("invalid backup file")
+	ErrInvalidBackupPassphrase  = errors.New("invalid passphrase or backup has been tampered with")
+	ErrUnsupportedBackupVersion = errors.New("unsupported backup version")
+)
+
+// backupFile is the format of the backup written to disk. Everything
+// except what is needed to decrypt it is inside the ciphertext.
+type backupFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       string `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// walletBackup is the content of the backup
+type walletBackup struct {
+	Mnemonic string   `json:"mnemonic"`
+	Mints    []string `json:"mints"`
+	// keysets of the mints along with the counters
+	Keysets   []*crypto.WalletKeyset `json:"keysets"`
+	Proofs    cashu.Proofs           `json:"proofs"`
+	CreatedAt int64                  `json:"created_at"`
+}
+
+// ExportBackup writes to path a backup of the wallet encrypted with the passphrase.
+// The backup has the seed, proofs, trusted mints and keyset counters of the wallet.
+func (w *Wallet) ExportBackup(path, passphrase string) error {
+	if len(passphrase) == 0 {
+		return errors.New("passphrase cannot be empty")
+	}
+
+	w.mu.Lock()
+	backup := walletBackup{
+		Mnemonic:  w.db.GetMnemonic(),
+		Mints:     w.TrustedMints(),
+		Keysets:   []*crypto.WalletKeyset{},
+		Proofs:    w.db.GetProofs(),
+		CreatedAt: time.Now().Unix(),
+	}
+	for mintURL, keysets := range w.db.GetKeysets() {
+		if _, ok := w.getMint(mintURL); !ok {
+			continue
+		}
+		for _, keyset := range keysets {
+			backup.Keysets = append(backup.Keysets, &keyset)
+		}
+	}
+	w.mu.Unlock()
+
+	plaintext, err := json.Marshal(backup)
+	if err != nil {
+		return err
+	}
+	file, err := encryptBackup(plaintext, passphrase)
+	if err != nil {
+		return err
+	}
+	fileBytes, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, fileBytes, 0600)
+}
+
+// ImportBackup merges the backup in path into the wallet. Proofs and keysets the
+// wallet already has are skipped. Keyset counters are only merged if the backup
+// is from the same seed as the wallet. It returns the amount of the proofs imported.
+func (w *Wallet) ImportBackup(path, passphrase string) (uint64, error) {
+	backup, err := readBackup(path, passphrase)
+	if err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sameSeed := backup.Mnemonic == w.db.GetMnemonic()
+	amountImported, err := mergeBackup(w.db, backup, sameSeed)
+	if err != nil {
+		return 0, err
+	}
+
+	mints, err := w.loadWalletMints()
+	if err != nil {
+		return 0, err
+	}
+	w.mintsMu.Lock()
+	w.mints = mints
+	w.mintsMu.Unlock()
+
+	return amountImported, nil
+}
+
+// RestoreFromBackup creates a new wallet in walletPath from the backup.
+// It will fail if there is already a wallet in walletPath.
+// It returns the amount of the proofs restored.
+func RestoreFromBackup(walletPath string, storageType StorageType, backupPath, passphrase string) (uint64, error) {
+	for _, dbfile := range []string{"wallet.db", "wallet.sqlite.db"} {
+		if _, err := os.Stat(filepath.Join(walletPath, dbfile)); err == nil {
+			return 0, errors.New("wallet already exists")
+		}
+	}
+
+	backup, err := readBackup(backupPath, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	seed, err := keys.SeedFromMnemonic(backup.Mnemonic)
+	if err != nil {
+		return 0, ErrInvalidBackup
+	}
+
+	if err := os.MkdirAll(walletPath, 0700); err != nil {
+		return 0, err
+	}
+	db, err := InitStorage(walletPath, storageType)
+	if err != nil {
+		return 0, fmt.Errorf("error restoring wallet: %v", err)
+	}
+	defer db.Close()
+
+	db.SaveMnemonicSeed(backup.Mnemonic, seed)
+
+	return mergeBackup(db, backup, true)
+}
+
+func mergeBackup(db storage.WalletDB, backup *walletBackup, sameSeed bool) (uint64, error) {
+	keysets := db.GetKeysets()
+	for _, mint := range backup.Mints {
+		// mints in backup are trusted again if they had been removed
+		if err := db.DeleteRemovedMint(mint); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, keyset := range backup.Keysets {
+		dbKeyset := db.GetKeyset(keyset.Id)
+		if dbKeyset == nil {
+			// counters are tied to the seed that generated the secrets
+			if !sameSeed {
+				keyset.Counter = 0
+			}
+			// keep the active keyset the wallet knows for the mint
+			if _, ok := keysets[keyset.MintURL]; ok {
+				keyset.Active = false
+			}
+			if err := db.SaveKeyset(keyset); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if sameSeed && keyset.Counter > dbKeyset.Counter {
+			if err := db.IncrementKeysetCounter(keyset.Id, keyset.Counter-dbKeyset.Counter); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	existing := make(map[string]bool)
+	for _, proof := range db.GetProofs() {
+		existing[proof.Secret] = true
+	}
+	for _, proof := range db.GetPendingProofs() {
+		existing[proof.Secret] = true
+	}
+
+	proofsToImport := cashu.Proofs{}
+	for _, proof := range backup.Proofs {
+		if existing[proof.Secret] {
+			continue
+		}
+		existing[proof.Secret] = true
+		proofsToImport = append(proofsToImport, proof)
+	}
+	if err := db.SaveProofs(proofsToImport); err != nil {
+		return 0, fmt.Errorf("error storing proofs: %v", err)
+	}
+
+	return proofsToImport.Amount(), nil
+}
+
+func readBackup(path, passphrase string) (*walletBackup, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file backupFile
+	if err := json.Unmarshal(fileBytes, &file); err != nil {
+		return nil, ErrInvalidBackup
+	}
+	plaintext, err := decryptBackup(file, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var backup walletBackup
+	if err := json.Unmarshal(plaintext, &backup); err != nil {
+		return nil, ErrInvalidBackup
+	}
+	return &backup, nil
+}
+
+func encryptBackup(plaintext []byte, passphrase string) (*backupFile, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	file := &backupFile{
+		Version: backupVersion,
+		KDF:     backupKDF,
+		Salt:    hex.EncodeToString(salt),
+		N:       backupScryptN,
+		R:       backupScryptR,
+		P:       backupScryptP,
+		Nonce:   hex.EncodeToString(nonce),
+	}
+
+	aead, err := backupCipher(file, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, nonce, plaintext, backupAdditionalData(file))
+	file.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+
+	return file, nil
+}
+
+func decryptBackup(file backupFile, passphrase string) ([]byte, error) {
+	if file.Version != backupVersion {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedBackupVersion, file.Version)
+	}
+	if file.KDF != backupKDF {
+		return nil, ErrInvalidBackup
+	}
+
+	nonce, err := hex.DecodeString(file.Nonce)
+	if err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return nil, ErrInvalidBackup
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(file.Ciphertext)
+	if err != nil {
+		return nil, ErrInvalidBackup
+	}
+
+	aead, err := backupCipher(&file, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, backupAdditionalData(&file))
+	if err != nil {
+		return nil, ErrInvalidBackupPassphrase
+	}
+	return plaintext, nil
+}
+
+func backupCipher(file *backupFile, passphrase string) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(file.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, ErrInvalidBackup
+	}
+	// do not let a crafted file make the key derivation use too much memory
+	if file.N > backupScryptN || file.R > backupScryptR || file.P > backupScryptP {
+		return nil, ErrInvalidBackup
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, file.N, file.R, file.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, ErrInvalidBackup
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+// backupAdditionalData binds the unencrypted parameters
+// of the file to the ciphertext so they cannot be changed
+func backupAdditionalData(file *backupFile) []byte {
+	return []byte(fmt.Sprintf("gonuts-backup:%v:%v:%v:%v:%v:%v",
+		file.Version, file.KDF, file.Salt, file.N, file.R, file.P))
+}
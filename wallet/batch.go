@@ -0,0 +1,195 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/cashu/nuts/nut12"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// ReceiveAll receives the tokens making a single swap per mint instead of one
+// per token. Mints in the tokens that are not trusted are added to the wallet.
+// Tokens locked with SIG_ALL are received on their own since their outputs need
+// to be signed. If the swap with a mint fails, the other mints are still tried.
+// It returns the total amount received.
+func (w *Wallet) ReceiveAll(tokens []cashu.Token) (uint64, error) {
+	var errs []error
+	var amountReceived uint64
+
+	proofsByMint := make(map[string]cashu.Proofs)
+	YsByMint := make(map[string][]string)
+	memosByMint := make(map[string][]string)
+	// keep order in which mints appear in the tokens
+	var mints []string
+	// same token could be passed more than once
+	seen := make(map[string]bool)
+
+	for _, token := range tokens {
+		tokenMint := token.Mint()
+		if err := w.checkToken(token); err != nil {
+			errs = append(errs, err)
+			w.emitError(err, tokenMint, "")
+			continue
+		}
+		proofs := cashu.Proofs{}
+		for _, proof := range token.Proofs() {
+			if !seen[proof.Secret] {
+				seen[proof.Secret] = true
+				proofs = append(proofs, proof)
+			}
+		}
+		if len(proofs) == 0 {
+			continue
+		}
+		Ys, err := proofYs(proofs)
+		if err != nil {
+			errs = append(errs, err)
+			w.emitError(err, tokenMint, "")
+			continue
+		}
+		if err := w.checkProofsNotSeen(Ys); err != nil {
+			errs = append(errs, err)
+			w.emitError(err, tokenMint, "")
+			continue
+		}
+
+		nut10Secret, err := nut10.DeserializeSecret(proofs[0].Secret)
+		if err == nil && nut10Secret.Kind == nut10.P2PK && nut11.IsSigAll(nut10Secret) {
+			amount, err := w.Receive(token, false)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			amountReceived += amount
+			continue
+		}
+
+		proofs, _, err = w.signP2PKInputs(proofs)
+		if err != nil {
+			errs = append(errs, err)
+			w.emitError(err, tokenMint, "")
+			continue
+		}
+
+		if _, ok := proofsByMint[tokenMint]; !ok {
+			mints = append(mints, tokenMint)
+		}
+		proofsByMint[tokenMint] = append(proofsByMint[tokenMint], proofs...)
+		YsByMint[tokenMint] = append(YsByMint[tokenMint], Ys...)
+		memo := cashu.GetTokenInfo(token).Memo
+		if len(memo) > 0 && !slices.Contains(memosByMint[tokenMint], memo) {
+			memosByMint[tokenMint] = append(memosByMint[tokenMint], memo)
+		}
+	}
+
+	for _, mintURL := range mints {
+		memo := strings.Join(memosByMint[mintURL], "; ")
+		amount, err := w.receiveBatch(proofsByMint[mintURL], mintURL, memo)
+		if err != nil {
+			err = fmt.Errorf("could not receive from '%v': %v", mintURL, err)
+			errs = append(errs, err)
+			w.emitError(err, mintURL, "")
+			continue
+		}
+		amountReceived += amount
+		w.db.SaveSeenYs(YsByMint[mintURL])
+
+		if w.autoConsolidate {
+			// best effort, the ecash was already received
+			w.consolidateMint(mintURL)
+		}
+		w.emit(Event{Type: TokenReceived, Mint: mintURL, Amount: amount})
+	}
+
+	return amountReceived, errors.Join(errs...)
+}
+
+// receiveBatch swaps the proofs, which can be from multiple tokens, in a single request.
+// The memo of the tokens is recorded in the history.
+func (w *Wallet) receiveBatch(proofs cashu.Proofs, mintURL, memo string) (uint64, error) {
+	if err := w.verifyProofsDLEQ(proofs, mintURL); err != nil {
+		return 0, err
+	}
+
+	// only add mint if not previously trusted
+	mint, ok := w.getMint(mintURL)
+	if !ok {
+		newMint, err := w.AddMint(mintURL)
+		if err != nil {
+			return 0, err
+		}
+		mint = *newMint
+	}
+
+	newProofs, err := w.swapReceived(proofs, &mint)
+	if err != nil {
+		return 0, err
+	}
+
+	amountReceived := newProofs.Amount()
+	fee := proofs.Amount() - amountReceived
+	w.saveTransactionWithMemo(storage.ReceiveTransaction, mintURL, amountReceived, fee, w.serializeProofs(proofs, mintURL), memo)
+
+	return amountReceived, nil
+}
+
+// verifyProofsDLEQ verifies the DLEQ proofs, if present, with the keys of the keyset
+// of each proof. Proofs from the tokens in a batch can be from different keysets of the mint.
+func (w *Wallet) verifyProofsDLEQ(proofs cashu.Proofs, mintURL string) error {
+	proofsByKeyset := make(map[string]cashu.Proofs)
+	for _, proof := range proofs {
+		if proof.DLEQ != nil {
+			proofsByKeyset[proof.Id] = append(proofsByKeyset[proof.Id], proof)
+		}
+	}
+
+	for id, keysetProofs := range proofsByKeyset {
+		keys, err := w.keysetPublicKeys(mintURL, id)
+		if err != nil {
+			return fmt.Errorf("could not get keys of keyset '%v': %v", id, err)
+		}
+		if !nut12.VerifyProofsDLEQ(keysetProofs, crypto.WalletKeyset{Id: id, PublicKeys: keys}) {
+			return errors.New("invalid DLEQ proof")
+		}
+	}
+	return nil
+}
+
+// keysetPublicKeys returns the keys of the keyset of the mint. They are
+// requested from the mint if it is not trusted or the keyset is not known.
+func (w *Wallet) keysetPublicKeys(mintURL, id string) (crypto.PublicKeys, error) {
+	if mint, ok := w.getMint(mintURL); ok {
+		if mint.activeKeyset.Id == id {
+			return mint.activeKeyset.PublicKeys, nil
+		}
+		if keyset, ok := mint.inactiveKeysets[id]; ok {
+			return keyset.PublicKeys, nil
+		}
+	}
+	return getKeysetKeys(w.client, mintURL, id)
+}
+
+func (w *Wallet) swapReceived(proofs cashu.Proofs, mint *walletMint) (cashu.Proofs, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, err := w.createSwapRequest(proofs, mint)
+	if err != nil {
+		return nil, fmt.Errorf("could not create swap request: %v", err)
+	}
+	newProofs, err := w.swap(mint.mintURL, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not swap proofs: %v", err)
+	}
+	if err := w.db.SaveProofs(newProofs); err != nil {
+		return nil, fmt.Errorf("error storing proofs: %v", err)
+	}
+	return newProofs, nil
+}
@@ -0,0 +1,126 @@
+package wallet
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+)
+
+// how long the capabilities of a mint are cached before fetching them again
+const mintCapabilitiesTTL = time.Hour
+
+// MintCapabilities are the features a mint advertises in its info.
+// Methods and subscriptions are only those for the unit of the wallet.
+type MintCapabilities struct {
+	// NUT-04
+	MintMethods     []nut06.MethodSetting
+	MintingDisabled bool
+	// NUT-05
+	MeltMethods     []nut06.MethodSetting
+	MeltingDisabled bool
+	// NUT-07
+	TokenStateCheck bool
+	// NUT-08
+	OverpaidFeesReturn bool
+	// NUT-09
+	Restore bool
+	// NUT-10
+	SpendingConditions bool
+	// NUT-11
+	P2PK bool
+	// NUT-12
+	DLEQ bool
+	// NUT-14
+	HTLC bool
+	// NUT-15
+	MultiPathPayments bool
+	// NUT-17. Kinds of websocket subscriptions supported
+	Subscriptions []nut17.SubscriptionKind
+	// NUT-20
+	MintQuoteSignatures bool
+
+	FetchedAt time.Time
+}
+
+// SupportsSubscription returns whether the mint supports
+// websocket subscriptions of the kind
+func (c *MintCapabilities) SupportsSubscription(kind nut17.SubscriptionKind) bool {
+	return slices.Contains(c.Subscriptions, kind)
+}
+
+// MintCapabilities returns the features supported by the mint. They are fetched
+// when the mint is added to the wallet and cached for an hour.
+func (w *Wallet) MintCapabilities(mintURL string) (*MintCapabilities, error) {
+	w.capabilitiesMu.Lock()
+	capabilities, ok := w.mintCapabilities[mintURL]
+	w.capabilitiesMu.Unlock()
+	if ok && time.Since(capabilities.FetchedAt) < mintCapabilitiesTTL {
+		return capabilities, nil
+	}
+	return w.fetchMintCapabilities(mintURL)
+}
+
+func (w *Wallet) fetchMintCapabilities(mintURL string) (*MintCapabilities, error) {
+	mintInfo, err := w.client.GetMintInfo(mintURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting info from mint: %v", err)
+	}
+	capabilities := capabilitiesFromInfo(mintInfo, w.unit)
+
+	w.capabilitiesMu.Lock()
+	if w.mintCapabilities == nil {
+		w.mintCapabilities = make(map[string]*MintCapabilities)
+	}
+	w.mintCapabilities[mintURL] = capabilities
+	w.capabilitiesMu.Unlock()
+
+	return capabilities, nil
+}
+
+func capabilitiesFromInfo(mintInfo *nut06.MintInfo, unit cashu.Unit) *MintCapabilities {
+	nuts := mintInfo.Nuts
+	capabilities := &MintCapabilities{
+		MintMethods:         methodsForUnit(nuts.Nut04.Methods, unit),
+		MintingDisabled:     nuts.Nut04.Disabled,
+		MeltMethods:         methodsForUnit(nuts.Nut05.Methods, unit),
+		MeltingDisabled:     nuts.Nut05.Disabled,
+		TokenStateCheck:     nuts.Nut07.Supported,
+		OverpaidFeesReturn:  nuts.Nut08.Supported,
+		Restore:             nuts.Nut09.Supported,
+		SpendingConditions:  nuts.Nut10.Supported,
+		P2PK:                nuts.Nut11.Supported,
+		DLEQ:                nuts.Nut12.Supported,
+		HTLC:                nuts.Nut14.Supported,
+		MintQuoteSignatures: nuts.Nut20.Supported,
+		FetchedAt:           time.Now(),
+	}
+	if nuts.Nut15 != nil {
+		capabilities.MultiPathPayments = len(methodsForUnit(nuts.Nut15.Methods, unit)) > 0
+	}
+	for _, method := range nuts.Nut17.Supported {
+		if method.Unit != unit.String() {
+			continue
+		}
+		for _, command := range method.Commands {
+			kind := nut17.StringToKind(command)
+			if kind != nut17.Unknown && !slices.Contains(capabilities.Subscriptions, kind) {
+				capabilities.Subscriptions = append(capabilities.Subscriptions, kind)
+			}
+		}
+	}
+	return capabilities
+}
+
+func methodsForUnit(methods []nut06.MethodSetting, unit cashu.Unit) []nut06.MethodSetting {
+	unitMethods := []nut06.MethodSetting{}
+	for _, method := range methods {
+		if method.Unit == unit.String() {
+			unitMethods = append(unitMethods, method)
+		}
+	}
+	return unitMethods
+}
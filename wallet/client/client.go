@@ -2,11 +2,17 @@ package client
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut01"
 	"github.com/elnosh/gonuts/cashu/nuts/nut02"
@@ -16,10 +22,117 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut06"
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut18"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/proxy"
 )
 
+const (
+	requestTimeout = 30 * time.Second
+	// GET requests are retried on network errors or if the mint
+	// responds with a server error. POST requests are not retried
+	// since they might have been processed by the mint.
+	maxGetAttempts = 3
+	retryDelay     = 500 * time.Millisecond
+)
+
+// UserAgent is sent in the User-Agent header of requests to the mint
+var UserAgent = "gonuts"
+
+var httpClient = &http.Client{Timeout: requestTimeout, Transport: proxy.Transport(nil)}
+
+// SetProxy makes requests to mints go through the proxy.
+// If proxyURL is nil, requests are made directly.
+// It does not apply to clients created with New.
+func SetProxy(proxyURL *url.URL) {
+	httpClient.Transport = proxy.Transport(proxyURL)
+}
+
+var (
+	// ErrInvalidSignature is returned when the info or keys response of a mint
+	// does not have a valid signature from the public key pinned for the mint
+	ErrInvalidSignature = errors.New("response from mint does not have a valid signature from its public key")
+	// ErrMintPubkeyChanged is returned when the info of a mint
+	// has a public key different from the one pinned for it
+	ErrMintPubkeyChanged = errors.New("public key of mint does not match the one pinned")
+)
+
+// Client makes requests to mints with its http client.
+// The package level functions use a default Client.
+// A nil *Client uses the default http client.
+type Client struct {
+	httpClient *http.Client
+
+	// public keys of the mints that sign their info and keys
+	// responses. See PinMintPubkey
+	pubkeys   map[string]*secp256k1.PublicKey
+	pubkeysMu sync.RWMutex
+}
+
+func (c *Client) client() *http.Client {
+	if c == nil {
+		return httpClient
+	}
+	return c.httpClient
+}
+
+var defaultClient = &Client{httpClient: httpClient}
+
+// New returns a Client that makes requests with httpClient.
+// If httpClient is nil, the default http client of the package is used.
+func New(client *http.Client) *Client {
+	if client == nil {
+		client = httpClient
+	}
+	return &Client{httpClient: client}
+}
+
+// PinMintPubkey sets the public key of the mint. Once pinned, the responses of
+// the mint to info, keys and keysets requests need to be signed by it in the
+// cashu.SIGNATURE_HEADER or they fail with ErrInvalidSignature.
+// Keys are also pinned by GetMintInfo the first time a mint
+// returns its info signed by the public key in it.
+func (c *Client) PinMintPubkey(mintURL string, pubkey *secp256k1.PublicKey) {
+	if c == nil {
+		return
+	}
+	c.pubkeysMu.Lock()
+	defer c.pubkeysMu.Unlock()
+	if c.pubkeys == nil {
+		c.pubkeys = make(map[string]*secp256k1.PublicKey)
+	}
+	c.pubkeys[mintURL] = pubkey
+}
+
+// MintPubkey returns the public key pinned for the mint or nil if there is none
+func (c *Client) MintPubkey(mintURL string) *secp256k1.PublicKey {
+	if c == nil {
+		return nil
+	}
+	c.pubkeysMu.RLock()
+	defer c.pubkeysMu.RUnlock()
+	return c.pubkeys[mintURL]
+}
+
+// verifySignature checks that the body of the response is signed
+// by the public key pinned for the mint, if there is one.
+func (c *Client) verifySignature(mintURL string, resp *http.Response, body []byte) error {
+	pubkey := c.MintPubkey(mintURL)
+	if pubkey == nil {
+		return nil
+	}
+	if !crypto.VerifyMessageSignature(resp.Header.Get(cashu.SIGNATURE_HEADER), body, pubkey) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
 func GetMintInfo(mintURL string) (*nut06.MintInfo, error) {
-	resp, err := get(mintURL + "/v1/info")
+	return defaultClient.GetMintInfo(mintURL)
+}
+
+func (c *Client) GetMintInfo(mintURL string) (*nut06.MintInfo, error) {
+	resp, err := c.get(mintURL + "/v1/info")
 	if err != nil {
 		return nil, err
 	}
@@ -35,11 +148,54 @@ func GetMintInfo(mintURL string) (*nut06.MintInfo, error) {
 		return nil, fmt.Errorf("error reading response from mint: %v", err)
 	}
 
+	if pinned := c.MintPubkey(mintURL); pinned != nil {
+		pubkey, err := parsePubkey(mintInfo.Pubkey)
+		if err != nil || !pubkey.IsEqual(pinned) {
+			return nil, ErrMintPubkeyChanged
+		}
+		if err := c.verifySignature(mintURL, resp, body); err != nil {
+			return nil, err
+		}
+	} else if pubkey := signedByInfoPubkey(mintInfo, resp, body); pubkey != nil {
+		// trust the key the first time the mint is seen. Mints that
+		// do not sign their responses are not pinned.
+		c.PinMintPubkey(mintURL, pubkey)
+	}
+
 	return &mintInfo, nil
 }
 
+// signedByInfoPubkey returns the public key in the mint info if
+// the response has a valid signature from it
+func signedByInfoPubkey(mintInfo nut06.MintInfo, resp *http.Response, body []byte) *secp256k1.PublicKey {
+	signature := resp.Header.Get(cashu.SIGNATURE_HEADER)
+	if len(signature) == 0 || len(mintInfo.Pubkey) == 0 {
+		return nil
+	}
+	pubkey, err := parsePubkey(mintInfo.Pubkey)
+	if err != nil {
+		return nil
+	}
+	if !crypto.VerifyMessageSignature(signature, body, pubkey) {
+		return nil
+	}
+	return pubkey
+}
+
+func parsePubkey(pubkey string) (*secp256k1.PublicKey, error) {
+	pubkeyBytes, err := hex.DecodeString(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1.ParsePubKey(pubkeyBytes)
+}
+
 func GetActiveKeysets(mintURL string) (*nut01.GetKeysResponse, error) {
-	resp, err := get(mintURL + "/v1/keys")
+	return defaultClient.GetActiveKeysets(mintURL)
+}
+
+func (c *Client) GetActiveKeysets(mintURL string) (*nut01.GetKeysResponse, error) {
+	resp, err := c.get(mintURL + "/v1/keys")
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +205,9 @@ func GetActiveKeysets(mintURL string) (*nut01.GetKeysResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := c.verifySignature(mintURL, resp, body); err != nil {
+		return nil, err
+	}
 
 	var keysetRes nut01.GetKeysResponse
 	if err := json.Unmarshal(body, &keysetRes); err != nil {
@@ -59,7 +218,11 @@ func GetActiveKeysets(mintURL string) (*nut01.GetKeysResponse, error) {
 }
 
 func GetAllKeysets(mintURL string) (*nut02.GetKeysetsResponse, error) {
-	resp, err := get(mintURL + "/v1/keysets")
+	return defaultClient.GetAllKeysets(mintURL)
+}
+
+func (c *Client) GetAllKeysets(mintURL string) (*nut02.GetKeysetsResponse, error) {
+	resp, err := c.get(mintURL + "/v1/keysets")
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +232,9 @@ func GetAllKeysets(mintURL string) (*nut02.GetKeysetsResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := c.verifySignature(mintURL, resp, body); err != nil {
+		return nil, err
+	}
 
 	var keysetsRes nut02.GetKeysetsResponse
 	if err := json.Unmarshal(body, &keysetsRes); err != nil {
@@ -79,7 +245,11 @@ func GetAllKeysets(mintURL string) (*nut02.GetKeysetsResponse, error) {
 }
 
 func GetKeysetById(mintURL, id string) (*nut01.GetKeysResponse, error) {
-	resp, err := get(mintURL + "/v1/keys/" + id)
+	return defaultClient.GetKeysetById(mintURL, id)
+}
+
+func (c *Client) GetKeysetById(mintURL, id string) (*nut01.GetKeysResponse, error) {
+	resp, err := c.get(mintURL + "/v1/keys/" + id)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +259,9 @@ func GetKeysetById(mintURL, id string) (*nut01.GetKeysResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := c.verifySignature(mintURL, resp, body); err != nil {
+		return nil, err
+	}
 
 	var keysetRes nut01.GetKeysResponse
 	if err := json.Unmarshal(body, &keysetRes); err != nil {
@@ -99,13 +272,18 @@ func GetKeysetById(mintURL, id string) (*nut01.GetKeysResponse, error) {
 }
 
 func PostMintQuoteBolt11(mintURL string, mintQuoteRequest nut04.PostMintQuoteBolt11Request) (
+	*nut04.PostMintQuoteBolt11Response, error) {
+	return defaultClient.PostMintQuoteBolt11(mintURL, mintQuoteRequest)
+}
+
+func (c *Client) PostMintQuoteBolt11(mintURL string, mintQuoteRequest nut04.PostMintQuoteBolt11Request) (
 	*nut04.PostMintQuoteBolt11Response, error) {
 	requestBody, err := json.Marshal(mintQuoteRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/mint/quote/bolt11", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.httpPost(mintURL+"/v1/mint/quote/bolt11", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +303,11 @@ func PostMintQuoteBolt11(mintURL string, mintQuoteRequest nut04.PostMintQuoteBol
 }
 
 func GetMintQuoteState(mintURL, quoteId string) (*nut04.PostMintQuoteBolt11Response, error) {
-	resp, err := get(mintURL + "/v1/mint/quote/bolt11/" + quoteId)
+	return defaultClient.GetMintQuoteState(mintURL, quoteId)
+}
+
+func (c *Client) GetMintQuoteState(mintURL, quoteId string) (*nut04.PostMintQuoteBolt11Response, error) {
+	resp, err := c.get(mintURL + "/v1/mint/quote/bolt11/" + quoteId)
 	if err != nil {
 		return nil, err
 	}
@@ -145,13 +327,18 @@ func GetMintQuoteState(mintURL, quoteId string) (*nut04.PostMintQuoteBolt11Respo
 }
 
 func PostMintBolt11(mintURL string, mintRequest nut04.PostMintBolt11Request) (
+	*nut04.PostMintBolt11Response, error) {
+	return defaultClient.PostMintBolt11(mintURL, mintRequest)
+}
+
+func (c *Client) PostMintBolt11(mintURL string, mintRequest nut04.PostMintBolt11Request) (
 	*nut04.PostMintBolt11Response, error) {
 	requestBody, err := json.Marshal(mintRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/mint/bolt11", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.httpPost(mintURL+"/v1/mint/bolt11", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -171,12 +358,16 @@ func PostMintBolt11(mintURL string, mintRequest nut04.PostMintBolt11Request) (
 }
 
 func PostSwap(mintURL string, swapRequest nut03.PostSwapRequest) (*nut03.PostSwapResponse, error) {
+	return defaultClient.PostSwap(mintURL, swapRequest)
+}
+
+func (c *Client) PostSwap(mintURL string, swapRequest nut03.PostSwapRequest) (*nut03.PostSwapResponse, error) {
 	requestBody, err := json.Marshal(swapRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/swap", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.httpPost(mintURL+"/v1/swap", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -197,13 +388,18 @@ func PostSwap(mintURL string, swapRequest nut03.PostSwapRequest) (*nut03.PostSwa
 
 func PostMeltQuoteBolt11(mintURL string, meltQuoteRequest nut05.PostMeltQuoteBolt11Request) (
 	*nut05.PostMeltQuoteBolt11Response, error) {
+	return defaultClient.PostMeltQuoteBolt11(mintURL, meltQuoteRequest)
+}
+
+func (c *Client) PostMeltQuoteBolt11(mintURL string, meltQuoteRequest nut05.PostMeltQuoteBolt11Request) (
+	*nut05.PostMeltQuoteBolt11Response, error) {
 
 	requestBody, err := json.Marshal(meltQuoteRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/melt/quote/bolt11", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.httpPost(mintURL+"/v1/melt/quote/bolt11", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -223,7 +419,11 @@ func PostMeltQuoteBolt11(mintURL string, meltQuoteRequest nut05.PostMeltQuoteBol
 }
 
 func GetMeltQuoteState(mintURL, quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
-	resp, err := get(mintURL + "/v1/melt/quote/bolt11/" + quoteId)
+	return defaultClient.GetMeltQuoteState(mintURL, quoteId)
+}
+
+func (c *Client) GetMeltQuoteState(mintURL, quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	resp, err := c.get(mintURL + "/v1/melt/quote/bolt11/" + quoteId)
 	if err != nil {
 		return nil, err
 	}
@@ -244,13 +444,18 @@ func GetMeltQuoteState(mintURL, quoteId string) (*nut05.PostMeltQuoteBolt11Respo
 
 func PostMeltBolt11(mintURL string, meltRequest nut05.PostMeltBolt11Request) (
 	*nut05.PostMeltQuoteBolt11Response, error) {
+	return defaultClient.PostMeltBolt11(mintURL, meltRequest)
+}
+
+func (c *Client) PostMeltBolt11(mintURL string, meltRequest nut05.PostMeltBolt11Request) (
+	*nut05.PostMeltQuoteBolt11Response, error) {
 
 	requestBody, err := json.Marshal(meltRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/melt/bolt11", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.httpPost(mintURL+"/v1/melt/bolt11", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -271,13 +476,18 @@ func PostMeltBolt11(mintURL string, meltRequest nut05.PostMeltBolt11Request) (
 
 func PostCheckProofState(mintURL string, stateRequest nut07.PostCheckStateRequest) (
 	*nut07.PostCheckStateResponse, error) {
+	return defaultClient.PostCheckProofState(mintURL, stateRequest)
+}
+
+func (c *Client) PostCheckProofState(mintURL string, stateRequest nut07.PostCheckStateRequest) (
+	*nut07.PostCheckStateResponse, error) {
 
 	requestBody, err := json.Marshal(stateRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/checkstate", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.httpPost(mintURL+"/v1/checkstate", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -298,13 +508,18 @@ func PostCheckProofState(mintURL string, stateRequest nut07.PostCheckStateReques
 
 func PostRestore(mintURL string, restoreRequest nut09.PostRestoreRequest) (
 	*nut09.PostRestoreResponse, error) {
+	return defaultClient.PostRestore(mintURL, restoreRequest)
+}
+
+func (c *Client) PostRestore(mintURL string, restoreRequest nut09.PostRestoreRequest) (
+	*nut09.PostRestoreResponse, error) {
 
 	requestBody, err := json.Marshal(restoreRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/restore", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.httpPost(mintURL+"/v1/restore", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -323,8 +538,46 @@ func PostRestore(mintURL string, restoreRequest nut09.PostRestoreRequest) (
 	return &restoreResponse, nil
 }
 
-func get(url string) (*http.Response, error) {
-	resp, err := http.Get(url)
+// PostPaymentRequestPayload sends the payload to pay a NUT-18
+// payment request to the URL target of a post transport
+func PostPaymentRequestPayload(url string, payload nut18.PaymentRequestPayload) error {
+	return defaultClient.PostPaymentRequestPayload(url, payload)
+}
+
+func (c *Client) PostPaymentRequestPayload(url string, payload nut18.PaymentRequestPayload) error {
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	resp, err := c.httpPost(url, "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (c *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		resp, err = c.client().Do(req)
+		retry := err != nil || resp.StatusCode >= 500
+		if !retry || attempt == maxGetAttempts {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		time.Sleep(retryDelay)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -332,8 +585,15 @@ func get(url string) (*http.Response, error) {
 	return parse(resp)
 }
 
-func httpPost(url, contentType string, body io.Reader) (*http.Response, error) {
-	resp, err := http.Post(url, contentType, body)
+func (c *Client) httpPost(url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := c.client().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -342,20 +602,30 @@ func httpPost(url, contentType string, body io.Reader) (*http.Response, error) {
 }
 
 func parse(response *http.Response) (*http.Response, error) {
-	if response.StatusCode == 400 {
-		var errResponse cashu.Error
-		err := json.NewDecoder(response.Body).Decode(&errResponse)
-		if err != nil {
-			return nil, fmt.Errorf("could not decode error response from mint: %v", err)
-		}
-		return nil, errResponse
+	success := response.StatusCode >= 200 && response.StatusCode < 300
+	if !success {
+		defer response.Body.Close()
 	}
 
-	if response.StatusCode != 200 {
+	if !success {
 		body, err := io.ReadAll(response.Body)
 		if err != nil {
 			return nil, err
 		}
+
+		// parse the error into a cashu.Error so it can be matched by its code
+		// with errors.Is. Mints can also return these with status codes other than 400
+		var errResponse cashu.Error
+		decodeErr := json.Unmarshal(body, &errResponse)
+		if decodeErr == nil && errResponse.Code != 0 {
+			return nil, errResponse
+		}
+		if response.StatusCode == 400 {
+			if decodeErr != nil {
+				return nil, fmt.Errorf("could not decode error response from mint: %v", decodeErr)
+			}
+			return nil, errResponse
+		}
 		return nil, fmt.Errorf("%s", body)
 	}
 
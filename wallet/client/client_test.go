@@ -0,0 +1,208 @@
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+func TestGetRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("User-Agent") != UserAgent {
+			t.Errorf("expected user agent '%v' but got '%v'", UserAgent, r.Header.Get("User-Agent"))
+		}
+		if attempts < maxGetAttempts {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(nut06.MintInfo{Name: "test mint"})
+	}))
+	defer server.Close()
+
+	mintInfo, err := GetMintInfo(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mintInfo.Name != "test mint" {
+		t.Fatalf("expected mint name 'test mint' but got '%v'", mintInfo.Name)
+	}
+	if attempts != maxGetAttempts {
+		t.Fatalf("expected %v attempts but got %v", maxGetAttempts, attempts)
+	}
+}
+
+func TestPostCashuError(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected content type 'application/json' but got '%v'", r.Header.Get("Content-Type"))
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(cashu.ProofAlreadyUsedErr)
+	}))
+	defer server.Close()
+
+	_, err := PostCheckProofState(server.URL, nut07.PostCheckStateRequest{Ys: []string{"Y"}})
+	if !errors.Is(err, cashu.ProofAlreadyUsedErr) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.ProofAlreadyUsedErr, err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected POST to not be retried but got %v attempts", attempts)
+	}
+}
+
+func TestParseCashuErrorCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// different detail than this implementation but same error code
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(cashu.Error{Detail: "Token already spent.", Code: cashu.ProofAlreadyUsedErrCode})
+	}))
+	defer server.Close()
+
+	_, err := PostCheckProofState(server.URL, nut07.PostCheckStateRequest{Ys: []string{"Y"}})
+	if !errors.Is(err, cashu.ProofAlreadyUsedErr) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.ProofAlreadyUsedErr, err)
+	}
+	var cashuErr *cashu.Error
+	if !errors.As(err, &cashuErr) {
+		t.Fatalf("expected cashu error but got '%v'", err)
+	}
+	if cashuErr.Detail != "Token already spent." {
+		t.Fatalf("expected detail 'Token already spent.' but got '%v'", cashuErr.Detail)
+	}
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(nut06.MintInfo{Name: "test mint"})
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	client := New(&http.Client{Transport: transport})
+	if _, err := client.GetMintInfo(server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transport.requests != 1 {
+		t.Fatalf("expected request to go through custom transport but got %v requests", transport.requests)
+	}
+
+	// package level functions should not use the custom client
+	if _, err := GetMintInfo(server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transport.requests != 1 {
+		t.Fatalf("expected 1 request through custom transport but got %v", transport.requests)
+	}
+
+	// clients keep their own pinned keys so they are not shared
+	if New(nil).client() != httpClient {
+		t.Fatal("expected default http client if http client is nil")
+	}
+}
+
+func TestSignedResponses(t *testing.T) {
+	mintKey, _ := secp256k1.GeneratePrivateKey()
+	otherKey, _ := secp256k1.GeneratePrivateKey()
+
+	signingKey := mintKey
+	infoKey := mintKey
+	sign := true
+	tamper := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		switch r.URL.Path {
+		case "/v1/info":
+			body, _ = json.Marshal(nut06.MintInfo{
+				Name:   "test mint",
+				Pubkey: hex.EncodeToString(infoKey.PubKey().SerializeCompressed()),
+			})
+		case "/v1/keys":
+			body, _ = json.Marshal(nut01.GetKeysResponse{Keysets: []nut01.Keyset{{Id: "00a", Unit: "sat"}}})
+		}
+		if sign {
+			signature, _ := crypto.SignMessage(signingKey, body)
+			w.Header().Set(cashu.SIGNATURE_HEADER, signature)
+		}
+		if tamper {
+			body, _ = json.Marshal(nut01.GetKeysResponse{Keysets: []nut01.Keyset{{Id: "00b", Unit: "sat"}}})
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	// key is pinned the first time the mint returns its info signed
+	client := New(nil)
+	if _, err := client.GetMintInfo(server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pinned := client.MintPubkey(server.URL); pinned == nil || !pinned.IsEqual(mintKey.PubKey()) {
+		t.Fatalf("expected mint public key to be pinned but got '%v'", pinned)
+	}
+	keys, err := client.GetActiveKeysets(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys.Keysets[0].Id != "00a" {
+		t.Fatalf("expected keyset '00a' but got '%v'", keys.Keysets[0].Id)
+	}
+
+	// response changed after it was signed
+	tamper = true
+	if _, err := client.GetActiveKeysets(server.URL); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidSignature, err)
+	}
+	tamper = false
+
+	sign = false
+	if _, err := client.GetActiveKeysets(server.URL); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidSignature, err)
+	}
+	sign = true
+
+	signingKey = otherKey
+	if _, err := client.GetActiveKeysets(server.URL); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidSignature, err)
+	}
+
+	// info signed by a different key than the one pinned
+	infoKey = otherKey
+	if _, err := client.GetMintInfo(server.URL); !errors.Is(err, ErrMintPubkeyChanged) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintPubkeyChanged, err)
+	}
+
+	// mints that do not sign their responses are not pinned
+	sign = false
+	unsignedClient := New(nil)
+	if _, err := unsignedClient.GetMintInfo(server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if unsignedClient.MintPubkey(server.URL) != nil {
+		t.Fatal("expected mint public key to not be pinned")
+	}
+	if _, err := unsignedClient.GetActiveKeysets(server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
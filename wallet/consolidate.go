@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// number of proofs of the same amount in a mint after
+// which they are consolidated into proofs of larger amounts
+const defaultConsolidationThreshold = 10
+
+// Consolidate swaps the proofs of amounts that the wallet has accumulated too many
+// of for proofs of larger amounts. This keeps the number of proofs in the wallet,
+// and the inputs needed to send, low. It returns the number of proofs removed.
+func (w *Wallet) Consolidate() (int, error) {
+	var errs []error
+	proofsRemoved := 0
+	for _, mint := range w.walletMints() {
+		removed, err := w.consolidateMint(mint.mintURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not consolidate proofs from '%v': %v", mint.mintURL, err))
+			continue
+		}
+		proofsRemoved += removed
+	}
+	return proofsRemoved, errors.Join(errs...)
+}
+
+func (w *Wallet) consolidateMint(mintURL string) (int, error) {
+	// get latest keysets from mint in case active keyset has changed
+	if _, err := w.getActiveKeyset(mintURL); err != nil {
+		return 0, err
+	}
+	mint, ok := w.getMint(mintURL)
+	if !ok {
+		return 0, ErrMintNotExist
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	proofs := proofsToConsolidate(w.getActiveProofsByMint(mintURL), w.consolidationThreshold, w.splitStrategy.proofsPerAmount())
+	if len(proofs) == 0 {
+		return 0, nil
+	}
+
+	amount := proofs.Amount()
+	fees := uint64(feesForProofs(proofs, &mint))
+	if amount <= fees {
+		return 0, nil
+	}
+	split := cashu.AmountSplit(amount - fees)
+	// not worth swapping if it does not reduce the number of proofs
+	if len(split) >= len(proofs) {
+		return 0, nil
+	}
+
+	counter := w.counterForKeyset(mint.activeKeyset.Id)
+	outputs, secrets, rs, err := w.createBlindedMessages(split, mint.activeKeyset.Id, &counter)
+	if err != nil {
+		return 0, fmt.Errorf("error creating blinded messages: %v", err)
+	}
+	if err := w.reserveCounter(mint.activeKeyset.Id, len(outputs)); err != nil {
+		return 0, err
+	}
+	req := swapRequestPayload{
+		inputs:  proofs,
+		outputs: outputs,
+		secrets: secrets,
+		rs:      rs,
+		keyset:  &mint.activeKeyset,
+	}
+	newProofs, err := w.swap(mintURL, req)
+	if err != nil {
+		return 0, fmt.Errorf("could not swap proofs: %v", err)
+	}
+	for _, proof := range proofs {
+		if err := w.db.DeleteProof(proof.Secret); err != nil {
+			return 0, err
+		}
+	}
+	if err := w.db.SaveProofs(newProofs); err != nil {
+		return 0, fmt.Errorf("error storing proofs: %v", err)
+	}
+
+	w.saveTransaction(storage.SwapTransaction, mintURL, newProofs.Amount(), fees, "")
+
+	return len(proofs) - len(newProofs), nil
+}
+
+// proofsToConsolidate selects, for every amount that has more proofs than the
+// threshold, the proofs over the number the wallet keeps of each amount.
+func proofsToConsolidate(proofs cashu.Proofs, threshold, keep int) cashu.Proofs {
+	if threshold <= 0 {
+		threshold = defaultConsolidationThreshold
+	}
+	// never consolidate below the number of proofs the wallet aims to keep
+	threshold = max(threshold, keep)
+
+	proofsByAmount := make(map[uint64]cashu.Proofs)
+	for _, proof := range proofs {
+		proofsByAmount[proof.Amount] = append(proofsByAmount[proof.Amount], proof)
+	}
+
+	amounts := make([]uint64, 0, len(proofsByAmount))
+	for amount := range proofsByAmount {
+		amounts = append(amounts, amount)
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+
+	var selected cashu.Proofs
+	for _, amount := range amounts {
+		amountProofs := proofsByAmount[amount]
+		if len(amountProofs) > threshold {
+			selected = append(selected, amountProofs[keep:]...)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,200 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/lnurl"
+	"github.com/elnosh/gonuts/wallet/nostr"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+var (
+	ErrContactNotFound = errors.New("contact not found")
+)
+
+// AddContact saves the contact, replacing the contact with the same name.
+// The contact needs at least a public key, an npub or nprofile or a
+// lightning address.
+func (w *Wallet) AddContact(contact storage.Contact) error {
+	contact, err := validateContact(contact)
+	if err != nil {
+		return err
+	}
+	return w.db.SaveContact(contact)
+}
+
+func validateContact(contact storage.Contact) (storage.Contact, error) {
+	contact.Name = strings.TrimSpace(contact.Name)
+	if len(contact.Name) == 0 {
+		return contact, errors.New("contact name cannot be empty")
+	}
+	if len(contact.PublicKey) == 0 && len(contact.Nostr) == 0 && len(contact.LightningAddress) == 0 {
+		return contact, fmt.Errorf("contact '%v' needs a public key, nostr profile or lightning address", contact.Name)
+	}
+
+	if len(contact.PublicKey) > 0 {
+		publicKey, err := parseHexPublicKey(contact.PublicKey)
+		if err != nil {
+			return contact, fmt.Errorf("invalid public key for contact '%v': %v", contact.Name, err)
+		}
+		contact.PublicKey = hex.EncodeToString(publicKey.SerializeCompressed())
+	}
+	if len(contact.Nostr) > 0 {
+		if _, _, err := decodeNostrContact(contact.Nostr); err != nil {
+			return contact, fmt.Errorf("invalid nostr profile for contact '%v': %v", contact.Name, err)
+		}
+	}
+	if len(contact.LightningAddress) > 0 {
+		if _, err := lnurl.PayURL(contact.LightningAddress); err != nil {
+			return contact, fmt.Errorf("invalid lightning address for contact '%v': %v", contact.Name, err)
+		}
+	}
+	return contact, nil
+}
+
+func parseHexPublicKey(publicKey string) (*secp256k1.PublicKey, error) {
+	publicKeyBytes, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1.ParsePubKey(publicKeyBytes)
+}
+
+// decodeNostrContact returns the public key of the npub or nprofile
+// and the relays in the nprofile
+func decodeNostrContact(profile string) (*secp256k1.PublicKey, []string, error) {
+	if strings.HasPrefix(profile, "nprofile") {
+		return nostr.DecodeNprofile(profile)
+	}
+	publicKey, err := nostr.DecodeNpub(profile)
+	return publicKey, nil, err
+}
+
+// Contacts returns the contacts of the wallet sorted by name
+func (w *Wallet) Contacts() []storage.Contact {
+	contacts := w.db.GetContacts()
+	slices.SortFunc(contacts, func(a, b storage.Contact) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return contacts
+}
+
+func (w *Wallet) GetContact(name string) (*storage.Contact, error) {
+	contact := w.db.GetContact(name)
+	if contact == nil {
+		return nil, ErrContactNotFound
+	}
+	return contact, nil
+}
+
+func (w *Wallet) RemoveContact(name string) error {
+	if err := w.db.DeleteContact(name); err != nil {
+		if errors.Is(err, storage.ContactNotFound) {
+			return ErrContactNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// ExportContacts returns the contacts as a JSON array that can be imported with ImportContacts
+func (w *Wallet) ExportContacts() ([]byte, error) {
+	return json.MarshalIndent(w.Contacts(), "", "  ")
+}
+
+// ImportContacts saves the contacts in the JSON array. Contacts with the same name
+// are replaced. No contact is saved if any of them is invalid.
+// It returns the number of contacts imported.
+func (w *Wallet) ImportContacts(data []byte) (int, error) {
+	var contacts []storage.Contact
+	if err := json.Unmarshal(data, &contacts); err != nil {
+		return 0, fmt.Errorf("invalid contacts: %v", err)
+	}
+
+	for i, contact := range contacts {
+		validContact, err := validateContact(contact)
+		if err != nil {
+			return 0, err
+		}
+		contacts[i] = validContact
+	}
+
+	for i, contact := range contacts {
+		if err := w.db.SaveContact(contact); err != nil {
+			return i, fmt.Errorf("error saving contact '%v': %v", contact.Name, err)
+		}
+	}
+	return len(contacts), nil
+}
+
+// SendToContact sends the amount to the contact. If the contact has a public key,
+// the ecash is locked to it. If it has a nostr profile, the token is sent to it
+// through nostr. The proofs sent are returned even if sending them through nostr
+// fails so that the token is not lost.
+func (w *Wallet) SendToContact(
+	amount uint64,
+	mintURL string,
+	name string,
+	includeFees bool,
+) (cashu.Proofs, error) {
+	contact, err := w.GetContact(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(contact.PublicKey) == 0 && len(contact.Nostr) == 0 {
+		return nil, fmt.Errorf("contact '%v' only has a lightning address. Pay it instead", name)
+	}
+
+	var proofs cashu.Proofs
+	if len(contact.PublicKey) > 0 {
+		publicKey, err := parseHexPublicKey(contact.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key for contact '%v': %v", name, err)
+		}
+		proofs, err = w.SendToPubkey(amount, mintURL, publicKey, nil, includeFees)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		proofs, err = w.Send(amount, mintURL, includeFees)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(contact.Nostr) > 0 {
+		if err := w.sendTokenToNostrContact(proofs, mintURL, contact.Nostr); err != nil {
+			return proofs, fmt.Errorf("could not send token through nostr: %w", err)
+		}
+	}
+	return proofs, nil
+}
+
+func (w *Wallet) sendTokenToNostrContact(proofs cashu.Proofs, mintURL, profile string) error {
+	receiver, relays, err := decodeNostrContact(profile)
+	if err != nil {
+		return err
+	}
+	for _, relay := range w.nostrRelays {
+		if !slices.Contains(relays, relay) {
+			relays = append(relays, relay)
+		}
+	}
+
+	token, err := cashu.NewTokenV4(proofs, mintURL, w.unit, false)
+	if err != nil {
+		return err
+	}
+	tokenString, err := token.Serialize()
+	if err != nil {
+		return err
+	}
+	return w.sendNostrMessage(receiver, relays, tokenString)
+}
@@ -0,0 +1,111 @@
+package wallet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+type EventType int
+
+const (
+	// ecash was received from a token
+	TokenReceived EventType = iota + 1
+	// ecash was minted after the invoice of the mint quote was paid
+	MintCompleted
+	// invoice of the melt quote was paid
+	MeltCompleted
+	// a receive, mint or melt failed
+	ErrorEvent
+)
+
+func (e EventType) String() string {
+	switch e {
+	case TokenReceived:
+		return "token_received"
+	case MintCompleted:
+		return "mint_completed"
+	case MeltCompleted:
+		return "melt_completed"
+	case ErrorEvent:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is passed to the handlers registered with Subscribe
+type Event struct {
+	Type EventType
+	// unit of the account that emitted the event
+	Unit cashu.Unit
+	Mint string
+	// amount received, minted or paid
+	Amount uint64
+	// id of the mint or melt quote
+	Quote string
+	// error of the operation if Type is ErrorEvent
+	Err  error
+	Time time.Time
+}
+
+type eventHandlers struct {
+	mu       sync.Mutex
+	nextId   int
+	handlers map[int]func(Event)
+}
+
+// Subscribe registers the handler to be called with the events of the wallet
+// and its accounts. It returns a function to remove the handler.
+// Handlers are called synchronously once the operation has completed, so they
+// should return quickly. They can call the wallet.
+func (w *Wallet) Subscribe(handler func(Event)) (unsubscribe func()) {
+	if w.parent != nil {
+		return w.parent.Subscribe(handler)
+	}
+
+	w.events.mu.Lock()
+	defer w.events.mu.Unlock()
+	if w.events.handlers == nil {
+		w.events.handlers = make(map[int]func(Event))
+	}
+	id := w.events.nextId
+	w.events.nextId++
+	w.events.handlers[id] = handler
+
+	return func() {
+		w.events.mu.Lock()
+		defer w.events.mu.Unlock()
+		delete(w.events.handlers, id)
+	}
+}
+
+// emit calls the handlers subscribed to the wallet, or to the
+// wallet the account was created from, with the event
+func (w *Wallet) emit(event Event) {
+	root := w
+	if w.parent != nil {
+		root = w.parent
+	}
+
+	root.events.mu.Lock()
+	handlers := make([]func(Event), 0, len(root.events.handlers))
+	for _, handler := range root.events.handlers {
+		handlers = append(handlers, handler)
+	}
+	root.events.mu.Unlock()
+	if len(handlers) == 0 {
+		return
+	}
+
+	event.Unit = w.unit
+	event.Time = time.Now()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func (w *Wallet) emitError(err error, mint, quote string) {
+	w.emit(Event{Type: ErrorEvent, Mint: mint, Quote: quote, Err: err})
+}
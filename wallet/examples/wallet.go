@@ -5,6 +5,8 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut04"
@@ -15,9 +17,12 @@ func main() {
 	config := wallet.Config{
 		WalletPath:     "./cashu",
 		CurrentMintURL: "http://localhost:3338",
+		Unit:           cashu.Sat,
+		StorageType:    wallet.SQLiteStorage,
 	}
 
-	wallet, err := wallet.LoadWallet(config)
+	// options can be passed to use a custom http client or storage
+	wallet, err := wallet.LoadWallet(config, wallet.WithHTTPClient(&http.Client{Timeout: time.Minute}))
 
 	// Mint tokens
 	mintQuote, err := wallet.RequestMint(42, wallet.CurrentMint())
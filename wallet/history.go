@@ -0,0 +1,132 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// GetHistory returns the transactions made by the wallet
+// that match the filter, from newest to oldest.
+func (w *Wallet) GetHistory(filter storage.TransactionFilter) []storage.Transaction {
+	return w.db.GetTransactions(filter)
+}
+
+// LabelTransaction adds the labels to the transaction in the history
+// with the id. Transactions can then be filtered by label in GetHistory.
+func (w *Wallet) LabelTransaction(id string, labels ...string) error {
+	labels, err := cleanLabels(labels)
+	if err != nil {
+		return err
+	}
+	return w.db.AddTransactionLabels(id, labels)
+}
+
+// LabelProofs sets the label of the proofs in the wallet.
+// An empty label removes the label from the proofs.
+func (w *Wallet) LabelProofs(proofs cashu.Proofs, label string) error {
+	secrets := make([]string, len(proofs))
+	for i, proof := range proofs {
+		secrets[i] = proof.Secret
+	}
+	return w.db.SaveProofLabel(secrets, strings.TrimSpace(label))
+}
+
+// GetProofsByLabel returns the proofs in the wallet with the label
+func (w *Wallet) GetProofsByLabel(label string) cashu.Proofs {
+	labels := w.db.GetProofLabels()
+	proofs := cashu.Proofs{}
+	for _, proof := range w.unitProofs(w.db.GetProofs()) {
+		if labels[proof.Secret] == label {
+			proofs = append(proofs, proof)
+		}
+	}
+	return proofs
+}
+
+func cleanLabels(labels []string) ([]string, error) {
+	cleaned := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if len(label) == 0 {
+			return nil, errors.New("label cannot be empty")
+		}
+		cleaned = append(cleaned, label)
+	}
+	return cleaned, nil
+}
+
+// saveTransaction records the transaction in the history of the wallet with the
+// resulting balance. The operation already went through with the mint when this
+// is called so failing to record it should not fail the operation.
+func (w *Wallet) saveTransaction(
+	txType storage.TransactionType,
+	mint string,
+	amount uint64,
+	fee uint64,
+	counterpart string,
+) {
+	w.saveTransactionWithMemo(txType, mint, amount, fee, counterpart, "")
+}
+
+func (w *Wallet) saveTransactionWithMemo(
+	txType storage.TransactionType,
+	mint string,
+	amount uint64,
+	fee uint64,
+	counterpart string,
+	memo string,
+) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return
+	}
+
+	transaction := storage.Transaction{
+		Id:          hex.EncodeToString(id),
+		Type:        txType,
+		Mint:        mint,
+		Unit:        w.unit.String(),
+		Amount:      amount,
+		Fee:         fee,
+		Counterpart: counterpart,
+		Balance:     w.GetBalance(),
+		CreatedAt:   time.Now().Unix(),
+		Memo:        memo,
+	}
+	w.db.SaveTransaction(transaction)
+}
+
+// feesPaid returns the amount that left the wallet since
+// balanceBefore on top of the amount of the transaction.
+func (w *Wallet) feesPaid(balanceBefore, amount uint64) uint64 {
+	spent := balanceBefore - min(balanceBefore, w.GetBalance())
+	if spent <= amount {
+		return 0
+	}
+	return spent - amount
+}
+
+// serializeProofs returns the proofs as a token to keep in the history
+func (w *Wallet) serializeProofs(proofs cashu.Proofs, mint string) string {
+	var token cashu.Token
+	token, err := cashu.NewTokenV4(proofs, mint, w.unit, false)
+	if err != nil {
+		// keysets with old ids can only be serialized as V3
+		token, err = cashu.NewTokenV3(proofs, mint, w.unit, false)
+		if err != nil {
+			return ""
+		}
+	}
+
+	serialized, err := token.Serialize()
+	if err != nil {
+		return ""
+	}
+	return serialized
+}
@@ -0,0 +1,99 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+// MintInvoice has what is needed to show the invoice of a mint
+// quote to the payer and to mint the ecash once it is paid.
+type MintInvoice struct {
+	QuoteId string
+	Mint    string
+	// BOLT11 invoice to be paid
+	Request string
+	Amount  uint64
+	Unit    cashu.Unit
+	// unix timestamp after which the invoice can no longer be paid.
+	// 0 if neither the mint nor the invoice set one
+	Expiry uint64
+}
+
+// URI returns the invoice as a 'lightning:' URI
+func (invoice MintInvoice) URI() string {
+	return "lightning:" + invoice.Request
+}
+
+// QRContent returns the content to encode in a QR code for the invoice.
+// It is the URI in uppercase so that it can be encoded in
+// alphanumeric mode, which makes for a smaller QR code.
+func (invoice MintInvoice) QRContent() string {
+	return strings.ToUpper(invoice.URI())
+}
+
+// Expired returns whether the invoice can no longer be paid
+func (invoice MintInvoice) Expired() bool {
+	return invoice.Expiry > 0 && time.Now().Unix() >= int64(invoice.Expiry)
+}
+
+// RequestMintInvoice requests a mint quote for the amount like RequestMint
+// and returns the invoice to show to the payer.
+// Use AwaitAndMint to mint the ecash once it is paid.
+func (w *Wallet) RequestMintInvoice(amount uint64, mint string) (*MintInvoice, error) {
+	mintResponse, err := w.RequestMint(amount, mint)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := mintResponse.Expiry
+	if expiry == 0 {
+		bolt11, err := decodepay.Decodepay(mintResponse.Request)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding bolt11 invoice: %v", err)
+		}
+		if bolt11.Expiry > 0 {
+			expiry = uint64(bolt11.CreatedAt + bolt11.Expiry)
+		}
+	}
+
+	return &MintInvoice{
+		QuoteId: mintResponse.Quote,
+		Mint:    mint,
+		Request: mintResponse.Request,
+		Amount:  amount,
+		Unit:    w.unit,
+		Expiry:  expiry,
+	}, nil
+}
+
+// AwaitAndMint waits for the invoice of the mint quote to be paid and
+// mints the ecash. It returns ErrQuoteExpired if the quote expires
+// before it is paid and ctx.Err() if ctx is done.
+func (w *Wallet) AwaitAndMint(ctx context.Context, quoteId string) (uint64, error) {
+	quote := w.db.GetMintQuoteById(quoteId)
+	if quote == nil {
+		return 0, ErrQuoteNotFound
+	}
+
+	awaitCtx := ctx
+	if quote.QuoteExpiry > 0 {
+		var cancel context.CancelFunc
+		awaitCtx, cancel = context.WithDeadline(ctx, time.Unix(int64(quote.QuoteExpiry), 0))
+		defer cancel()
+	}
+
+	if err := w.AwaitMintPaid(awaitCtx, quoteId); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return 0, ErrQuoteExpired
+		}
+		return 0, err
+	}
+
+	return w.MintTokens(quoteId)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
 
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/crypto"
@@ -12,16 +13,20 @@ import (
 
 // GetMintActiveKeyset gets the active keyset with the specified unit
 func GetMintActiveKeyset(mintURL string, unit cashu.Unit) (*crypto.WalletKeyset, error) {
-	keysets, err := client.GetAllKeysets(mintURL)
+	return getMintActiveKeyset(client.New(nil), mintURL, unit)
+}
+
+func getMintActiveKeyset(mintClient *client.Client, mintURL string, unit cashu.Unit) (*crypto.WalletKeyset, error) {
+	keysets, err := mintClient.GetAllKeysets(mintURL)
 	if err != nil {
-		return nil, fmt.Errorf("error getting active keysets from mint: %v", err)
+		return nil, fmt.Errorf("error getting active keysets from mint: %w", err)
 	}
 
 	for _, keyset := range keysets.Keysets {
 		if keyset.Active && keyset.Unit == unit.String() {
 			_, err := hex.DecodeString(keyset.Id)
 			if err == nil {
-				keys, err := GetKeysetKeys(mintURL, keyset.Id)
+				keys, err := getKeysetKeys(mintClient, mintURL, keyset.Id)
 				if err != nil {
 					return nil, err
 				}
@@ -41,9 +46,17 @@ func GetMintActiveKeyset(mintURL string, unit cashu.Unit) (*crypto.WalletKeyset,
 }
 
 func GetMintInactiveKeysets(mintURL string, unit cashu.Unit) (map[string]crypto.WalletKeyset, error) {
-	keysetsResponse, err := client.GetAllKeysets(mintURL)
+	return getMintInactiveKeysets(client.New(nil), mintURL, unit)
+}
+
+func getMintInactiveKeysets(
+	mintClient *client.Client,
+	mintURL string,
+	unit cashu.Unit,
+) (map[string]crypto.WalletKeyset, error) {
+	keysetsResponse, err := mintClient.GetAllKeysets(mintURL)
 	if err != nil {
-		return nil, fmt.Errorf("error getting keysets from mint: %v", err)
+		return nil, fmt.Errorf("error getting keysets from mint: %w", err)
 	}
 
 	inactiveKeysets := make(map[string]crypto.WalletKeyset)
@@ -64,9 +77,13 @@ func GetMintInactiveKeysets(mintURL string, unit cashu.Unit) (map[string]crypto.
 }
 
 func GetKeysetKeys(mintURL, id string) (crypto.PublicKeys, error) {
-	keysetsResponse, err := client.GetKeysetById(mintURL, id)
+	return getKeysetKeys(client.New(nil), mintURL, id)
+}
+
+func getKeysetKeys(mintClient *client.Client, mintURL, id string) (crypto.PublicKeys, error) {
+	keysetsResponse, err := mintClient.GetKeysetById(mintURL, id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting keyset from mint: %v", err)
+		return nil, fmt.Errorf("error getting keyset from mint: %w", err)
 	}
 
 	derivedId := crypto.DeriveKeysetId(keysetsResponse.Keysets[0].Keys)
@@ -81,21 +98,25 @@ func GetKeysetKeys(mintURL, id string) (crypto.PublicKeys, error) {
 // if mint passed is known and the latest active keyset has changed,
 // it will inactivate the previous active and save new active to db
 func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
-	mint, ok := w.mints[mintURL]
+	mint, ok := w.getMint(mintURL)
 	// if mint is not known, get active sat keyset from calling mint
 	if !ok {
-		activeKeyset, err := GetMintActiveKeyset(mintURL, w.unit)
+		activeKeyset, err := getMintActiveKeyset(w.client, mintURL, w.unit)
 		if err != nil {
 			return nil, err
 		}
 		return activeKeyset, nil
 	}
 
-	allKeysets, err := client.GetAllKeysets(mintURL)
+	allKeysets, err := w.client.GetAllKeysets(mintURL)
 	if err != nil {
 		return nil, err
 	}
 
+	// copy the map since the stored mint can be read concurrently
+	mint.inactiveKeysets = maps.Clone(mint.inactiveKeysets)
+	changed := false
+
 	activeKeyset := mint.activeKeyset
 	var activeInputFeePpk uint
 	// check if there is new active keyset
@@ -113,6 +134,7 @@ func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
 		// inactivate previous active
 		activeKeyset.Active = false
 		mint.inactiveKeysets[activeKeyset.Id] = activeKeyset
+		changed = true
 		if err := w.db.SaveKeyset(&activeKeyset); err != nil {
 			return nil, err
 		}
@@ -131,7 +153,7 @@ func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
 					mint.activeKeyset = activeKeyset
 					delete(mint.inactiveKeysets, storedKeyset.Id)
 				} else {
-					keys, err := GetKeysetKeys(mintURL, keyset.Id)
+					keys, err := getKeysetKeys(w.client, mintURL, keyset.Id)
 					if err != nil {
 						return nil, err
 					}
@@ -149,7 +171,7 @@ func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
 					}
 					mint.activeKeyset = activeKeyset
 				}
-				w.mints[mintURL] = mint
+				changed = true
 			}
 		}
 	} else {
@@ -160,8 +182,30 @@ func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
 				return nil, err
 			}
 			mint.activeKeyset = activeKeyset
-			w.mints[mintURL] = mint
+			changed = true
+		}
+	}
+
+	// keep input_fee_ppk of inactive keysets up to date since
+	// it is still charged when spending proofs from them
+	for _, keyset := range allKeysets.Keysets {
+		inactiveKeyset, ok := mint.inactiveKeysets[keyset.Id]
+		if !ok || inactiveKeyset.InputFeePpk == keyset.InputFeePpk {
+			continue
+		}
+		if storedKeyset := w.db.GetKeyset(keyset.Id); storedKeyset != nil {
+			storedKeyset.InputFeePpk = keyset.InputFeePpk
+			if err := w.db.SaveKeyset(storedKeyset); err != nil {
+				return nil, err
+			}
 		}
+		inactiveKeyset.InputFeePpk = keyset.InputFeePpk
+		mint.inactiveKeysets[keyset.Id] = inactiveKeyset
+		changed = true
+	}
+
+	if changed {
+		w.setMint(mint)
 	}
 
 	return &activeKeyset, nil
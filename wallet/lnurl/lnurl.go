@@ -0,0 +1,251 @@
+// Package lnurl resolves lightning addresses (LUD-16) and LNURL-pay (LUD-06)
+// endpoints to BOLT11 invoices that can be paid by the wallet.
+package lnurl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/elnosh/gonuts/proxy"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const (
+	payRequestTag  = "payRequest"
+	requestTimeout = 30 * time.Second
+)
+
+var (
+	ErrInvalidAddress       = errors.New("invalid lightning address or lnurl")
+	ErrAmountOutOfRange     = errors.New("amount is outside of range accepted by receiver")
+	ErrCommentTooLong       = errors.New("comment is longer than allowed by receiver")
+	ErrInvalidInvoiceAmount = errors.New("invoice amount does not match requested amount")
+	ErrInvalidMetadataHash  = errors.New("invoice description hash does not match metadata")
+)
+
+var httpClient = &http.Client{Timeout: requestTimeout, Transport: proxy.Transport(nil)}
+
+// SetProxy makes requests to LNURL endpoints go through the proxy.
+// If proxyURL is nil, requests are made directly.
+// It does not apply to clients created with New.
+func SetProxy(proxyURL *url.URL) {
+	httpClient.Transport = proxy.Transport(proxyURL)
+}
+
+// Client makes requests to LNURL endpoints with its http client.
+// The package level functions use a default Client.
+// A nil *Client uses the default http client.
+type Client struct {
+	httpClient *http.Client
+}
+
+func (c *Client) client() *http.Client {
+	if c == nil {
+		return httpClient
+	}
+	return c.httpClient
+}
+
+var defaultClient = &Client{httpClient: httpClient}
+
+// New returns a Client that makes requests with httpClient.
+// If httpClient is nil, the default http client of the package is used.
+func New(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		return defaultClient
+	}
+	return &Client{httpClient: httpClient}
+}
+
+// PayParams is the response from an LNURL-pay endpoint
+type PayParams struct {
+	Tag      string `json:"tag"`
+	Callback string `json:"callback"`
+	// amounts are in millisats
+	MinSendable    uint64 `json:"minSendable"`
+	MaxSendable    uint64 `json:"maxSendable"`
+	Metadata       string `json:"metadata"`
+	CommentAllowed int    `json:"commentAllowed"`
+
+	// client used to request the invoice from the callback
+	client *Client
+}
+
+type errorResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type invoiceResponse struct {
+	PR string `json:"pr"`
+}
+
+// IsLNURL returns whether the string is a lightning address or a bech32 encoded LNURL
+func IsLNURL(s string) bool {
+	_, err := PayURL(s)
+	return err == nil
+}
+
+// PayURL returns the URL of the LNURL-pay endpoint for the
+// lightning address (user@domain.com) or bech32 encoded LNURL.
+func PayURL(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "lightning:"), "LIGHTNING:")
+
+	if strings.HasPrefix(strings.ToLower(s), "lnurl1") {
+		prefix, data, err := bech32.DecodeNoLimit(s)
+		if err != nil || prefix != "lnurl" {
+			return "", ErrInvalidAddress
+		}
+		decoded, err := bech32.ConvertBits(data, 5, 8, false)
+		if err != nil {
+			return "", ErrInvalidAddress
+		}
+		return string(decoded), nil
+	}
+
+	user, domain, found := strings.Cut(s, "@")
+	if !found || len(user) == 0 || len(domain) == 0 || strings.ContainsAny(user, "/?#") {
+		return "", ErrInvalidAddress
+	}
+	host, err := url.Parse("//" + domain)
+	if err != nil || host.Host != domain || len(host.Hostname()) == 0 {
+		return "", ErrInvalidAddress
+	}
+
+	scheme := "https"
+	// LUD-16 allows onion services over http. Also allowed
+	// for local addresses which are useful for testing
+	hostname := host.Hostname()
+	ip := net.ParseIP(hostname)
+	if strings.HasSuffix(hostname, ".onion") || hostname == "localhost" || (ip != nil && ip.IsLoopback()) {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%v://%v/.well-known/lnurlp/%v", scheme, domain, strings.ToLower(user)), nil
+}
+
+// GetPayParams fetches the LNURL-pay parameters for the
+// lightning address or bech32 encoded LNURL.
+func GetPayParams(address string) (*PayParams, error) {
+	return defaultClient.GetPayParams(address)
+}
+
+// GetPayParams fetches the LNURL-pay parameters for the
+// lightning address or bech32 encoded LNURL.
+func (c *Client) GetPayParams(address string) (*PayParams, error) {
+	payURL, err := PayURL(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var params PayParams
+	if err := c.getJSON(payURL, &params); err != nil {
+		return nil, err
+	}
+	if params.Tag != payRequestTag {
+		return nil, fmt.Errorf("unexpected lnurl tag '%v'", params.Tag)
+	}
+	if len(params.Callback) == 0 {
+		return nil, errors.New("lnurl response does not have a callback")
+	}
+	params.client = c
+
+	return &params, nil
+}
+
+// RequestInvoice requests an invoice for the amount in millisats to the callback.
+// The comment is only sent if it is not empty. The invoice returned is verified
+// to be for the amount requested and to commit to the metadata of the params.
+func (p *PayParams) RequestInvoice(amountMsat uint64, comment string) (string, error) {
+	if amountMsat < p.MinSendable || amountMsat > p.MaxSendable {
+		return "", fmt.Errorf("%w: %v - %v sats", ErrAmountOutOfRange, p.MinSendable/1000, p.MaxSendable/1000)
+	}
+	if len(comment) > p.CommentAllowed {
+		return "", fmt.Errorf("%w: max length %v", ErrCommentTooLong, p.CommentAllowed)
+	}
+
+	callbackURL, err := url.Parse(p.Callback)
+	if err != nil {
+		return "", fmt.Errorf("invalid callback url: %v", err)
+	}
+	query := callbackURL.Query()
+	query.Set("amount", strconv.FormatUint(amountMsat, 10))
+	if len(comment) > 0 {
+		query.Set("comment", comment)
+	}
+	callbackURL.RawQuery = query.Encode()
+
+	var response invoiceResponse
+	if err := p.client.getJSON(callbackURL.String(), &response); err != nil {
+		return "", err
+	}
+
+	bolt11, err := decodepay.Decodepay(response.PR)
+	if err != nil {
+		return "", fmt.Errorf("invalid invoice: %v", err)
+	}
+	if uint64(bolt11.MSatoshi) != amountMsat {
+		return "", ErrInvalidInvoiceAmount
+	}
+	metadataHash := sha256.Sum256([]byte(p.Metadata))
+	if bolt11.DescriptionHash != hex.EncodeToString(metadataHash[:]) {
+		return "", ErrInvalidMetadataHash
+	}
+
+	return response.PR, nil
+}
+
+// GetInvoice resolves the lightning address or bech32 encoded
+// LNURL to an invoice for the amount in sats.
+func GetInvoice(address string, amount uint64, comment string) (string, error) {
+	return defaultClient.GetInvoice(address, amount, comment)
+}
+
+// GetInvoice resolves the lightning address or bech32 encoded
+// LNURL to an invoice for the amount in sats.
+func (c *Client) GetInvoice(address string, amount uint64, comment string) (string, error) {
+	params, err := c.GetPayParams(address)
+	if err != nil {
+		return "", err
+	}
+	return params.RequestInvoice(amount*1000, comment)
+}
+
+func (c *Client) getJSON(endpoint string, v any) error {
+	resp, err := c.client().Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// errors are returned as {"status": "ERROR", "reason": "..."}
+	var errResponse errorResponse
+	if err := json.Unmarshal(body, &errResponse); err == nil && strings.EqualFold(errResponse.Status, "ERROR") {
+		return fmt.Errorf("lnurl error: %v", errResponse.Reason)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response from '%v': %v", endpoint, resp.Status)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error reading lnurl response: %v", err)
+	}
+	return nil
+}
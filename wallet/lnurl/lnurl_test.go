@@ -0,0 +1,204 @@
+package lnurl
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
+)
+
+func TestPayURL(t *testing.T) {
+	tests := []struct {
+		address     string
+		expectedURL string
+		expectedErr error
+	}{
+		{
+			address:     "alice@example.com",
+			expectedURL: "https://example.com/.well-known/lnurlp/alice",
+		},
+		{
+			address:     "lightning:Alice@example.com",
+			expectedURL: "https://example.com/.well-known/lnurlp/alice",
+		},
+		{
+			address:     "alice@127.0.0.1:8080",
+			expectedURL: "http://127.0.0.1:8080/.well-known/lnurlp/alice",
+		},
+		{
+			address:     "alice@example.onion",
+			expectedURL: "http://example.onion/.well-known/lnurlp/alice",
+		},
+		{
+			// test vector from LUD-01
+			address:     "LNURL1DP68GURN8GHJ7UM9WFMXJCM99E3K7MF0V9CXJ0M385EKVCENXC6R2C35XVUKXEFCV5MKVV34X5EKZD3EV56NYD3HXQURZEPEXEJXXEPNXSCRVWFNV9NXZCN9XQ6XYEFHVGCXXCMYXYMNSERXFQ5FNS",
+			expectedURL: "https://service.com/api?q=3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df",
+		},
+		{address: "alice", expectedErr: ErrInvalidAddress},
+		{address: "@example.com", expectedErr: ErrInvalidAddress},
+		{address: "alice@example.com/path", expectedErr: ErrInvalidAddress},
+		{address: "lnbc100n1pja0w9pdqqx", expectedErr: ErrInvalidAddress},
+	}
+
+	for _, test := range tests {
+		payURL, err := PayURL(test.address)
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+		if payURL != test.expectedURL {
+			t.Fatalf("expected url '%v' but got '%v'", test.expectedURL, payURL)
+		}
+	}
+}
+
+const testMetadata = `[["text/plain","pay to alice"]]`
+
+func createInvoice(amountMsat uint64, descriptionHash [32]byte) (string, error) {
+	invoice, err := zpay32.NewInvoice(
+		&chaincfg.SigNetParams,
+		sha256.Sum256([]byte("preimage")),
+		time.Now(),
+		zpay32.Amount(lnwire.MilliSatoshi(amountMsat)),
+		zpay32.DescriptionHash(descriptionHash),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return invoice.Encode(zpay32.MessageSigner{
+		SignCompact: func(msg []byte) ([]byte, error) {
+			key, err := secp256k1.GeneratePrivateKey()
+			if err != nil {
+				return nil, err
+			}
+			return ecdsa.SignCompact(key, msg, true), nil
+		},
+	})
+}
+
+// lnurlServer returns invoices for the metadata passed
+// but advertises testMetadata in the pay params.
+func lnurlServer(t *testing.T, invoiceMetadata string, amountTweak uint64) *httptest.Server {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/lnurlp/alice", func(rw http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(rw).Encode(PayParams{
+			Tag:            payRequestTag,
+			Callback:       server.URL + "/callback?user=alice",
+			MinSendable:    1000,
+			MaxSendable:    1_000_000,
+			Metadata:       testMetadata,
+			CommentAllowed: 10,
+		})
+	})
+	mux.HandleFunc("/callback", func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("user") != "alice" {
+			t.Errorf("expected query params of callback to be preserved")
+		}
+		if comment := req.URL.Query().Get("comment"); comment == "fail" {
+			json.NewEncoder(rw).Encode(errorResponse{Status: "ERROR", Reason: "could not create invoice"})
+			return
+		}
+		amount, _ := strconv.ParseUint(req.URL.Query().Get("amount"), 10, 64)
+		invoice, err := createInvoice(amount+amountTweak, sha256.Sum256([]byte(invoiceMetadata)))
+		if err != nil {
+			t.Errorf("error creating invoice: %v", err)
+		}
+		json.NewEncoder(rw).Encode(invoiceResponse{PR: invoice})
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func TestGetInvoice(t *testing.T) {
+	server := lnurlServer(t, testMetadata, 0)
+	defer server.Close()
+	address := "alice@" + strings.TrimPrefix(server.URL, "http://")
+
+	invoice, err := GetInvoice(address, 100, "thanks")
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice: %v", err)
+	}
+	if !strings.HasPrefix(invoice, "lntbs1u") {
+		t.Fatalf("expected invoice for 100 sats but got '%v'", invoice)
+	}
+
+	tests := []struct {
+		amount      uint64
+		comment     string
+		expectedErr string
+	}{
+		{amount: 0, expectedErr: ErrAmountOutOfRange.Error()},
+		{amount: 1001, expectedErr: ErrAmountOutOfRange.Error()},
+		{amount: 100, comment: "comment too long", expectedErr: ErrCommentTooLong.Error()},
+		{amount: 100, comment: "fail", expectedErr: "could not create invoice"},
+	}
+	for _, test := range tests {
+		_, err := GetInvoice(address, test.amount, test.comment)
+		if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+	}
+
+	if _, err := GetInvoice("bob@"+strings.TrimPrefix(server.URL, "http://"), 100, ""); err == nil {
+		t.Fatal("expected error getting invoice for unknown user")
+	}
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientGetInvoice(t *testing.T) {
+	server := lnurlServer(t, testMetadata, 0)
+	defer server.Close()
+	address := "alice@" + strings.TrimPrefix(server.URL, "http://")
+
+	transport := &countingTransport{}
+	client := New(&http.Client{Transport: transport})
+	if _, err := client.GetInvoice(address, 100, ""); err != nil {
+		t.Fatalf("unexpected error getting invoice: %v", err)
+	}
+	// pay params and callback requests
+	if transport.requests != 2 {
+		t.Fatalf("expected 2 requests through custom transport but got %v", transport.requests)
+	}
+}
+
+func TestGetInvoiceVerification(t *testing.T) {
+	// invoice committing to different metadata
+	server := lnurlServer(t, `[["text/plain","pay to mallory"]]`, 0)
+	defer server.Close()
+	address := "alice@" + strings.TrimPrefix(server.URL, "http://")
+
+	_, err := GetInvoice(address, 100, "")
+	if !errors.Is(err, ErrInvalidMetadataHash) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidMetadataHash, err)
+	}
+
+	// invoice for different amount
+	server = lnurlServer(t, testMetadata, 1000)
+	defer server.Close()
+	address = "alice@" + strings.TrimPrefix(server.URL, "http://")
+
+	_, err = GetInvoice(address, 100, "")
+	if !errors.Is(err, ErrInvalidInvoiceAmount) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidInvoiceAmount, err)
+	}
+}
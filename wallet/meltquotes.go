@@ -0,0 +1,106 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+// MeltQuoteCost is a melt quote from one of the mints of the wallet
+// and what it would cost to pay it with the proofs in that mint.
+type MeltQuoteCost struct {
+	Mint  string
+	Quote nut05.PostMeltQuoteBolt11Response
+	// fees of the proofs that would be used to pay the quote
+	InputFees uint64
+	// amount + fee reserve + input fees
+	TotalCost uint64
+}
+
+// QuoteMeltAcrossMints requests a melt quote for the invoice to every mint where
+// the wallet has enough balance to pay it. The quotes are returned sorted by
+// total cost so the cheapest mint to pay from is first. Any of them can then
+// be paid with Melt. If some mints fail to return a quote, the quotes from the
+// other mints are still returned along with the errors.
+func (w *Wallet) QuoteMeltAcrossMints(invoice string) ([]MeltQuoteCost, error) {
+	bolt11, err := decodepay.Decodepay(invoice)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invoice: %v", err)
+	}
+	invoiceAmount := uint64(bolt11.MSatoshi / 1000)
+
+	var mints []walletMint
+	for mintURL, balance := range w.GetBalanceByMints() {
+		// amount of quotes in other units is only known after requesting them
+		if balance == 0 || w.unit == cashu.Sat && balance < invoiceAmount {
+			continue
+		}
+		if mint, ok := w.getMint(mintURL); ok {
+			mints = append(mints, mint)
+		}
+	}
+	if len(mints) == 0 {
+		return nil, ErrInsufficientMintBalance
+	}
+
+	type result struct {
+		response *nut05.PostMeltQuoteBolt11Response
+		err      error
+	}
+	results := make([]result, len(mints))
+	var wg sync.WaitGroup
+	for i, mint := range mints {
+		wg.Add(1)
+		go func(i int, mintURL string) {
+			defer wg.Done()
+			meltQuoteResponse, err := w.RequestMeltQuote(invoice, mintURL)
+			results[i] = result{response: meltQuoteResponse, err: err}
+		}(i, mint.mintURL)
+	}
+	wg.Wait()
+
+	var errs []error
+	quotes := []MeltQuoteCost{}
+	for i, mint := range mints {
+		if results[i].err != nil {
+			errs = append(errs, fmt.Errorf("could not get melt quote from '%v': %v", mint.mintURL, results[i].err))
+			continue
+		}
+		quote := results[i].response
+
+		// proofs the melt would use, to know the fees for spending them
+		proofs, err := w.selectProofsForAmount(quote.Amount+quote.FeeReserve, &mint, true)
+		if err != nil {
+			continue
+		}
+		inputFees := uint64(feesForProofs(proofs, &mint))
+
+		quotes = append(quotes, MeltQuoteCost{
+			Mint:      mint.mintURL,
+			Quote:     *quote,
+			InputFees: inputFees,
+			TotalCost: quote.Amount + quote.FeeReserve + inputFees,
+		})
+	}
+
+	slices.SortStableFunc(quotes, func(a, b MeltQuoteCost) int {
+		switch {
+		case a.TotalCost < b.TotalCost:
+			return -1
+		case a.TotalCost > b.TotalCost:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	if len(quotes) == 0 && len(errs) == 0 {
+		return nil, ErrInsufficientMintBalance
+	}
+	return quotes, errors.Join(errs...)
+}
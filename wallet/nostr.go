@@ -0,0 +1,197 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut18"
+	"github.com/elnosh/gonuts/internal/keys"
+	"github.com/elnosh/gonuts/wallet/nostr"
+)
+
+var (
+	ErrNoNostrRelays = errors.New("no nostr relays configured")
+	errNotEcash      = errors.New("message does not contain ecash")
+)
+
+// look back window when subscribing to relays. Gift wraps
+// have their timestamps randomized up to 2 days in the past
+const nostrSubscriptionLookback = 2 * 24 * time.Hour
+
+// DeriveNostrKey derives the nostr key of the wallet following NIP-06
+func DeriveNostrKey(key *hdkeychain.ExtendedKey) (*btcec.PrivateKey, error) {
+	// m/44'/1237'/0'/0/0
+	nostrKey, err := keys.DerivePath(key, keys.Hardened(44), keys.Hardened(1237), keys.Hardened(0), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return nostrKey.ECPrivKey()
+}
+
+// NostrPublicKey returns the npub of the wallet where it can receive ecash
+func (w *Wallet) NostrPublicKey() (string, error) {
+	return nostr.EncodeNpub(w.nostrKey.PubKey())
+}
+
+// NostrProfile returns the nprofile of the wallet with its relays
+func (w *Wallet) NostrProfile() (string, error) {
+	return nostr.EncodeNprofile(w.nostrKey.PubKey(), w.nostrRelays)
+}
+
+// NostrRelays returns the relays configured in the wallet
+func (w *Wallet) NostrRelays() []string {
+	return w.nostrRelays
+}
+
+// SendToNostr sends the message as a NIP-17 direct message to the npub
+// through the relays configured in the wallet.
+func (w *Wallet) SendToNostr(npub string, message string) error {
+	receiver, err := nostr.DecodeNpub(npub)
+	if err != nil {
+		return err
+	}
+	return w.sendNostrMessage(receiver, w.nostrRelays, message)
+}
+
+// sendNostrMessage publishes the message to the relays. It succeeds
+// if the message was accepted by at least one of the relays.
+func (w *Wallet) sendNostrMessage(receiver *secp256k1.PublicKey, relays []string, message string) error {
+	if len(relays) == 0 {
+		return ErrNoNostrRelays
+	}
+
+	wrap, err := nostr.WrapMessage(w.nostrKey, receiver, message)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(relays))
+	for i, relay := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = nostr.Publish(context.Background(), relay, *wrap)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("could not publish message to any relay: %v", errors.Join(errs...))
+}
+
+// NostrRedeemed is the result of redeeming ecash received through nostr
+type NostrRedeemed struct {
+	Amount uint64
+	Err    error
+}
+
+// ListenNostr watches the relays configured in the wallet for direct messages
+// sent to the wallet's npub. Tokens and payment request payloads received are
+// redeemed and the result is sent in the returned channel until ctx is done.
+// Ecash from mints not trusted by the wallet is swapped to the default mint.
+func (w *Wallet) ListenNostr(ctx context.Context) (<-chan NostrRedeemed, error) {
+	if len(w.nostrRelays) == 0 {
+		return nil, ErrNoNostrRelays
+	}
+
+	filter := nostr.Filter{
+		Kinds: []int{nostr.KindGiftWrap},
+		PTags: []string{nostr.PublicKeyHex(w.nostrKey.PubKey())},
+		Since: time.Now().Add(-nostrSubscriptionLookback).Unix(),
+	}
+
+	events := make(chan nostr.Event)
+	var wg sync.WaitGroup
+	var errs []error
+	for _, relay := range w.nostrRelays {
+		relayEvents, err := nostr.Subscribe(ctx, relay, filter)
+		if err != nil {
+			// ignore relays that are not reachable
+			errs = append(errs, err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range relayEvents {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	if len(errs) == len(w.nostrRelays) {
+		return nil, fmt.Errorf("could not subscribe to any relay: %v", errors.Join(errs...))
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	redeemed := make(chan NostrRedeemed)
+	go func() {
+		defer close(redeemed)
+		// same event can come from multiple relays
+		seen := make(map[string]bool)
+		for event := range events {
+			if seen[event.Id] {
+				continue
+			}
+			seen[event.Id] = true
+
+			rumor, err := nostr.UnwrapMessage(w.nostrKey, event)
+			if err != nil || rumor.Kind != nostr.KindPrivateDirectMessage {
+				continue
+			}
+
+			amount, err := w.redeemNostrMessage(rumor.Content)
+			if errors.Is(err, errNotEcash) {
+				continue
+			}
+			select {
+			case redeemed <- NostrRedeemed{Amount: amount, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return redeemed, nil
+}
+
+// redeemNostrMessage receives the ecash in the message which
+// can be either a token or a payment request payload
+func (w *Wallet) redeemNostrMessage(message string) (uint64, error) {
+	message = strings.TrimSpace(message)
+
+	if strings.HasPrefix(message, "cashu") {
+		token, err := cashu.DecodeToken(message)
+		if err != nil {
+			return 0, err
+		}
+		_, trusted := w.getMint(token.Mint())
+		return w.Receive(token, !trusted)
+	}
+
+	var payload nut18.PaymentRequestPayload
+	if err := json.Unmarshal([]byte(message), &payload); err != nil || len(payload.Proofs) == 0 {
+		return 0, errNotEcash
+	}
+	return w.ReceivePaymentRequestPayload(payload)
+}
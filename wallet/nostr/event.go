@@ -0,0 +1,32 @@
+// Package nostr has the minimal Nostr functionality needed by the wallet to
+// send and receive ecash as private direct messages (NIP-17).
+package nostr
+
+import (
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/internal/nip01"
+)
+
+const (
+	KindSeal                 = 13
+	KindPrivateDirectMessage = 14
+	KindGiftWrap             = 1059
+)
+
+var (
+	ErrInvalidEventId        = nip01.ErrInvalidEventId
+	ErrInvalidEventSignature = nip01.ErrInvalidEventSignature
+)
+
+// Event as defined in NIP-01
+type Event = nip01.Event
+
+// PublicKeyHex returns the x-only hex encoded public key used in events
+func PublicKeyHex(publicKey *secp256k1.PublicKey) string {
+	return nip01.PublicKeyHex(publicKey)
+}
+
+// ParsePublicKey parses an x-only hex encoded public key
+func ParsePublicKey(publicKey string) (*secp256k1.PublicKey, error) {
+	return nip01.ParsePublicKey(publicKey)
+}
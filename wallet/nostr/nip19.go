@@ -0,0 +1,109 @@
+package nostr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// NIP-19 bech32 encoded entities
+// https://github.com/nostr-protocol/nips/blob/master/19.md
+
+const (
+	npubPrefix     = "npub"
+	nprofilePrefix = "nprofile"
+
+	tlvSpecial = 0
+	tlvRelay   = 1
+)
+
+var (
+	ErrInvalidNpub     = errors.New("invalid npub")
+	ErrInvalidNprofile = errors.New("invalid nprofile")
+)
+
+func encodeBech32(prefix string, data []byte) (string, error) {
+	converted, err := bech32.ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode(prefix, converted)
+}
+
+func decodeBech32(expectedPrefix, encoded string) ([]byte, error) {
+	prefix, data, err := bech32.DecodeNoLimit(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != expectedPrefix {
+		return nil, fmt.Errorf("expected prefix '%v' but got '%v'", expectedPrefix, prefix)
+	}
+	return bech32.ConvertBits(data, 5, 8, false)
+}
+
+func EncodeNpub(publicKey *secp256k1.PublicKey) (string, error) {
+	return encodeBech32(npubPrefix, schnorr.SerializePubKey(publicKey))
+}
+
+func DecodeNpub(npub string) (*secp256k1.PublicKey, error) {
+	data, err := decodeBech32(npubPrefix, npub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNpub, err)
+	}
+	publicKey, err := schnorr.ParsePubKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNpub, err)
+	}
+	return publicKey, nil
+}
+
+// EncodeNprofile encodes the public key along with relays where it can be found
+func EncodeNprofile(publicKey *secp256k1.PublicKey, relays []string) (string, error) {
+	data := []byte{tlvSpecial, 32}
+	data = append(data, schnorr.SerializePubKey(publicKey)...)
+	for _, relay := range relays {
+		if len(relay) > 255 {
+			return "", fmt.Errorf("relay url too long: %v", relay)
+		}
+		data = append(data, tlvRelay, byte(len(relay)))
+		data = append(data, relay...)
+	}
+	return encodeBech32(nprofilePrefix, data)
+}
+
+// DecodeNprofile returns the public key and relays in the nprofile
+func DecodeNprofile(nprofile string) (*secp256k1.PublicKey, []string, error) {
+	data, err := decodeBech32(nprofilePrefix, nprofile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidNprofile, err)
+	}
+
+	var publicKey *secp256k1.PublicKey
+	var relays []string
+	for len(data) >= 2 {
+		t, l := data[0], int(data[1])
+		if len(data) < 2+l {
+			return nil, nil, ErrInvalidNprofile
+		}
+		value := data[2 : 2+l]
+		data = data[2+l:]
+
+		switch t {
+		case tlvSpecial:
+			publicKey, err = schnorr.ParsePubKey(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: %v", ErrInvalidNprofile, err)
+			}
+		case tlvRelay:
+			relays = append(relays, string(value))
+		}
+	}
+
+	if publicKey == nil {
+		return nil, nil, ErrInvalidNprofile
+	}
+	return publicKey, relays, nil
+}
@@ -0,0 +1,147 @@
+package nostr
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/hkdf"
+)
+
+// NIP-44 version 2 encryption
+// https://github.com/nostr-protocol/nips/blob/master/44.md
+
+const (
+	nip44Version   = 2
+	minPlaintext   = 1
+	maxPlaintext   = 65535
+	nip44NonceSize = 32
+	nip44MacSize   = 32
+)
+
+var (
+	ErrInvalidPayload = errors.New("invalid NIP-44 payload")
+	ErrInvalidMac     = errors.New("invalid NIP-44 MAC")
+)
+
+// ConversationKey returns the NIP-44 key shared between the private key and the public key
+func ConversationKey(privateKey *secp256k1.PrivateKey, publicKey *secp256k1.PublicKey) []byte {
+	sharedX := secp256k1.GenerateSharedSecret(privateKey, publicKey)
+	return hkdf.Extract(sha256.New, sharedX, []byte("nip44-v2"))
+}
+
+func messageKeys(conversationKey, nonce []byte) (chachaKey, chachaNonce, hmacKey []byte, err error) {
+	keys := make([]byte, 76)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, conversationKey, nonce), keys); err != nil {
+		return nil, nil, nil, err
+	}
+	return keys[:32], keys[32:44], keys[44:], nil
+}
+
+func paddedLen(unpaddedLen int) int {
+	if unpaddedLen <= 32 {
+		return 32
+	}
+	nextPower := 1 << bits.Len(uint(unpaddedLen-1))
+	chunk := 32
+	if nextPower > 256 {
+		chunk = nextPower / 8
+	}
+	return chunk * ((unpaddedLen-1)/chunk + 1)
+}
+
+// Encrypt encrypts the plaintext with the conversation key
+func Encrypt(plaintext string, conversationKey []byte) (string, error) {
+	nonce := make([]byte, nip44NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return encrypt(plaintext, conversationKey, nonce)
+}
+
+func encrypt(plaintext string, conversationKey, nonce []byte) (string, error) {
+	if len(plaintext) < minPlaintext || len(plaintext) > maxPlaintext {
+		return "", errors.New("invalid plaintext length")
+	}
+
+	chachaKey, chachaNonce, hmacKey, err := messageKeys(conversationKey, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	padded := make([]byte, 2+paddedLen(len(plaintext)))
+	binary.BigEndian.PutUint16(padded, uint16(len(plaintext)))
+	copy(padded[2:], plaintext)
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(chachaKey, chachaNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(padded))
+	cipher.XORKeyStream(ciphertext, padded)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(nonce)
+	mac.Write(ciphertext)
+
+	payload := make([]byte, 0, 1+len(nonce)+len(ciphertext)+nip44MacSize)
+	payload = append(payload, nip44Version)
+	payload = append(payload, nonce...)
+	payload = append(payload, ciphertext...)
+	payload = mac.Sum(payload)
+
+	return base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// Decrypt decrypts the payload with the conversation key
+func Decrypt(payload string, conversationKey []byte) (string, error) {
+	if len(payload) == 0 || payload[0] == '#' {
+		return "", errors.New("unknown NIP-44 version")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidPayload
+	}
+	// version + nonce + min padded length with size prefix + mac
+	if len(data) < 1+nip44NonceSize+34+nip44MacSize || data[0] != nip44Version {
+		return "", ErrInvalidPayload
+	}
+
+	nonce := data[1 : 1+nip44NonceSize]
+	ciphertext := data[1+nip44NonceSize : len(data)-nip44MacSize]
+	payloadMac := data[len(data)-nip44MacSize:]
+
+	chachaKey, chachaNonce, hmacKey, err := messageKeys(conversationKey, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(nonce)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), payloadMac) {
+		return "", ErrInvalidMac
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(chachaKey, chachaNonce)
+	if err != nil {
+		return "", err
+	}
+	padded := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(padded, ciphertext)
+
+	unpaddedLen := int(binary.BigEndian.Uint16(padded))
+	if unpaddedLen < minPlaintext || len(padded) != 2+paddedLen(unpaddedLen) {
+		return "", ErrInvalidPayload
+	}
+
+	return string(padded[2 : 2+unpaddedLen]), nil
+}
@@ -0,0 +1,140 @@
+package nostr
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// NIP-17 private direct messages sealed and gift wrapped following NIP-59
+// https://github.com/nostr-protocol/nips/blob/master/17.md
+// https://github.com/nostr-protocol/nips/blob/master/59.md
+
+// timestamps of seals and gift wraps are set
+// up to 2 days in the past to hide the real time
+const maxTimestampTweak = 60 * 60 * 24 * 2
+
+func randomTimestamp() int64 {
+	tweak, err := rand.Int(rand.Reader, big.NewInt(maxTimestampTweak))
+	if err != nil {
+		return time.Now().Unix()
+	}
+	return time.Now().Unix() - tweak.Int64()
+}
+
+// WrapMessage creates a gift wrapped NIP-17 direct message from sender to receiver
+func WrapMessage(
+	sender *secp256k1.PrivateKey,
+	receiver *secp256k1.PublicKey,
+	message string,
+) (*Event, error) {
+	receiverHex := PublicKeyHex(receiver)
+
+	// unsigned message
+	rumor := Event{
+		PubKey:    PublicKeyHex(sender.PubKey()),
+		CreatedAt: time.Now().Unix(),
+		Kind:      KindPrivateDirectMessage,
+		Tags:      [][]string{{"p", receiverHex}},
+		Content:   message,
+	}
+	if err := rumor.ComputeId(); err != nil {
+		return nil, err
+	}
+	rumorJson, err := json.Marshal(rumor)
+	if err != nil {
+		return nil, err
+	}
+
+	sealContent, err := Encrypt(string(rumorJson), ConversationKey(sender, receiver))
+	if err != nil {
+		return nil, err
+	}
+	seal := Event{
+		CreatedAt: randomTimestamp(),
+		Kind:      KindSeal,
+		Tags:      [][]string{},
+		Content:   sealContent,
+	}
+	if err := seal.Sign(sender); err != nil {
+		return nil, err
+	}
+	sealJson, err := json.Marshal(seal)
+	if err != nil {
+		return nil, err
+	}
+
+	// gift wrap is signed with a random key
+	ephemeralKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapContent, err := Encrypt(string(sealJson), ConversationKey(ephemeralKey, receiver))
+	if err != nil {
+		return nil, err
+	}
+	wrap := Event{
+		CreatedAt: randomTimestamp(),
+		Kind:      KindGiftWrap,
+		Tags:      [][]string{{"p", receiverHex}},
+		Content:   wrapContent,
+	}
+	if err := wrap.Sign(ephemeralKey); err != nil {
+		return nil, err
+	}
+
+	return &wrap, nil
+}
+
+// UnwrapMessage opens a gift wrapped direct message and returns the rumor.
+// The pubkey of the returned rumor is the verified sender of the message.
+func UnwrapMessage(receiver *secp256k1.PrivateKey, wrap Event) (*Event, error) {
+	if wrap.Kind != KindGiftWrap {
+		return nil, errors.New("event is not a gift wrap")
+	}
+	if err := wrap.Verify(); err != nil {
+		return nil, err
+	}
+
+	wrapPubkey, err := ParsePublicKey(wrap.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	sealJson, err := Decrypt(wrap.Content, ConversationKey(receiver, wrapPubkey))
+	if err != nil {
+		return nil, err
+	}
+	var seal Event
+	if err := json.Unmarshal([]byte(sealJson), &seal); err != nil {
+		return nil, err
+	}
+	if seal.Kind != KindSeal {
+		return nil, errors.New("gift wrap does not contain a seal")
+	}
+	if err := seal.Verify(); err != nil {
+		return nil, err
+	}
+
+	sealPubkey, err := ParsePublicKey(seal.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	rumorJson, err := Decrypt(seal.Content, ConversationKey(receiver, sealPubkey))
+	if err != nil {
+		return nil, err
+	}
+	var rumor Event
+	if err := json.Unmarshal([]byte(rumorJson), &rumor); err != nil {
+		return nil, err
+	}
+	// sender of rumor must be the one that signed the seal
+	if rumor.PubKey != seal.PubKey {
+		return nil, errors.New("rumor pubkey does not match seal pubkey")
+	}
+
+	return &rumor, nil
+}
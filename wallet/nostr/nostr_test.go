@@ -0,0 +1,249 @@
+package nostr
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/gorilla/websocket"
+)
+
+func TestNip44(t *testing.T) {
+	sec1, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000001")
+	sec2, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000002")
+	key1 := secp256k1.PrivKeyFromBytes(sec1)
+	key2 := secp256k1.PrivKeyFromBytes(sec2)
+
+	conversationKey := ConversationKey(key1, key2.PubKey())
+	expectedKey := "c41c775356fd92eadc63ff5a0dc1da211b268cbea22316767095b2871ea1412d"
+	if hex.EncodeToString(conversationKey) != expectedKey {
+		t.Fatalf("expected conversation key '%v' but got '%x'", expectedKey, conversationKey)
+	}
+	if hex.EncodeToString(ConversationKey(key2, key1.PubKey())) != expectedKey {
+		t.Fatal("expected conversation key to be the same from both sides")
+	}
+
+	nonce, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000001")
+	payload, err := encrypt("a", conversationKey, nonce)
+	if err != nil {
+		t.Fatalf("unexpected error encrypting: %v", err)
+	}
+	expectedPayload := "AgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAABee0G5VSK0/9YypIObAtDKfYEAjD35uVkHyB0F4DwrcNaCXlCWZKaArsGrY6M9wnuTMxWfp1RTN9Xga8no+kF5Vsb"
+	if payload != expectedPayload {
+		t.Fatalf("expected payload '%v' but got '%v'", expectedPayload, payload)
+	}
+
+	plaintext, err := Decrypt(payload, conversationKey)
+	if err != nil {
+		t.Fatalf("unexpected error decrypting: %v", err)
+	}
+	if plaintext != "a" {
+		t.Fatalf("expected plaintext 'a' but got '%v'", plaintext)
+	}
+
+	// round trip with messages of different lengths
+	for _, length := range []int{1, 32, 33, 257, 1000, 65535} {
+		message := strings.Repeat("x", length)
+		payload, err := Encrypt(message, conversationKey)
+		if err != nil {
+			t.Fatalf("unexpected error encrypting: %v", err)
+		}
+		plaintext, err := Decrypt(payload, conversationKey)
+		if err != nil {
+			t.Fatalf("unexpected error decrypting: %v", err)
+		}
+		if plaintext != message {
+			t.Fatalf("decrypted message of length %v does not match", length)
+		}
+	}
+
+	// tampered payload
+	data := []byte(expectedPayload)
+	data[60] = 'A'
+	if _, err := Decrypt(string(data), conversationKey); !errors.Is(err, ErrInvalidMac) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidMac, err)
+	}
+}
+
+func TestNip19(t *testing.T) {
+	pubkeyHex := "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+	npub := "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"
+
+	publicKey, err := ParsePublicKey(pubkeyHex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encoded, err := EncodeNpub(publicKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if encoded != npub {
+		t.Fatalf("expected npub '%v' but got '%v'", npub, encoded)
+	}
+	decoded, err := DecodeNpub(npub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if PublicKeyHex(decoded) != pubkeyHex {
+		t.Fatalf("expected pubkey '%v' but got '%v'", pubkeyHex, PublicKeyHex(decoded))
+	}
+
+	relays := []string{"wss://relay.damus.io", "wss://nos.lol"}
+	nprofile, err := EncodeNprofile(publicKey, relays)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decodedKey, decodedRelays, err := DecodeNprofile(nprofile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if PublicKeyHex(decodedKey) != pubkeyHex {
+		t.Fatalf("expected pubkey '%v' but got '%v'", pubkeyHex, PublicKeyHex(decodedKey))
+	}
+	if strings.Join(decodedRelays, ",") != strings.Join(relays, ",") {
+		t.Fatalf("expected relays '%v' but got '%v'", relays, decodedRelays)
+	}
+
+	if _, err := DecodeNpub(nprofile); !errors.Is(err, ErrInvalidNpub) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidNpub, err)
+	}
+}
+
+func TestGiftWrap(t *testing.T) {
+	sender, _ := secp256k1.GeneratePrivateKey()
+	receiver, _ := secp256k1.GeneratePrivateKey()
+
+	message := "cashuBo2FteBtodHRwczovL25vZmVlcy50ZXN0bnV0LmNhc2h1"
+	wrap, err := WrapMessage(sender, receiver.PubKey(), message)
+	if err != nil {
+		t.Fatalf("unexpected error wrapping message: %v", err)
+	}
+	if wrap.Kind != KindGiftWrap {
+		t.Fatalf("expected event of kind %v but got %v", KindGiftWrap, wrap.Kind)
+	}
+	if wrap.PubKey == PublicKeyHex(sender.PubKey()) {
+		t.Fatal("expected gift wrap to not be signed by sender")
+	}
+	if p, _ := wrap.Tag("p"); p != PublicKeyHex(receiver.PubKey()) {
+		t.Fatalf("expected p tag '%v' but got '%v'", PublicKeyHex(receiver.PubKey()), p)
+	}
+	if err := wrap.Verify(); err != nil {
+		t.Fatalf("unexpected error verifying gift wrap: %v", err)
+	}
+
+	rumor, err := UnwrapMessage(receiver, *wrap)
+	if err != nil {
+		t.Fatalf("unexpected error unwrapping message: %v", err)
+	}
+	if rumor.Content != message {
+		t.Fatalf("expected message '%v' but got '%v'", message, rumor.Content)
+	}
+	if rumor.PubKey != PublicKeyHex(sender.PubKey()) {
+		t.Fatalf("expected sender '%v' but got '%v'", PublicKeyHex(sender.PubKey()), rumor.PubKey)
+	}
+
+	// only receiver can unwrap it
+	other, _ := secp256k1.GeneratePrivateKey()
+	if _, err := UnwrapMessage(other, *wrap); err == nil {
+		t.Fatal("expected error unwrapping message with another key")
+	}
+
+	// tampered gift wrap
+	wrap.Content = wrap.Content[:len(wrap.Content)-4] + "AAAA"
+	if _, err := UnwrapMessage(receiver, *wrap); !errors.Is(err, ErrInvalidEventId) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidEventId, err)
+	}
+}
+
+// fakeRelay accepts events and sends them to subscriptions
+// that were opened before the event was published
+func fakeRelay(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	subscriptions := make(chan func(Event), 10)
+
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(rw, req, nil)
+		if err != nil {
+			t.Errorf("error upgrading connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg []json.RawMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			var msgType string
+			json.Unmarshal(msg[0], &msgType)
+
+			switch msgType {
+			case "EVENT":
+				var event Event
+				json.Unmarshal(msg[1], &event)
+				accepted := event.Verify() == nil
+				conn.WriteJSON([]any{"OK", event.Id, accepted, ""})
+				if accepted {
+					select {
+					case send := <-subscriptions:
+						send(event)
+					default:
+					}
+				}
+			case "REQ":
+				var subId string
+				json.Unmarshal(msg[1], &subId)
+				subscriptions <- func(event Event) {
+					conn.WriteJSON([]any{"EVENT", subId, event})
+				}
+			}
+		}
+	}))
+}
+
+func TestRelay(t *testing.T) {
+	relay := fakeRelay(t)
+	defer relay.Close()
+	relayURL := "ws" + strings.TrimPrefix(relay.URL, "http")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	receiver, _ := secp256k1.GeneratePrivateKey()
+	filter := Filter{Kinds: []int{KindGiftWrap}, PTags: []string{PublicKeyHex(receiver.PubKey())}}
+	events, err := Subscribe(ctx, relayURL, filter)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+	// wait for subscription to be registered by relay
+	time.Sleep(100 * time.Millisecond)
+
+	sender, _ := secp256k1.GeneratePrivateKey()
+	wrap, _ := WrapMessage(sender, receiver.PubKey(), "hello")
+	if err := Publish(ctx, relayURL, *wrap); err != nil {
+		t.Fatalf("unexpected error publishing event: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Id != wrap.Id {
+			t.Fatalf("expected event '%v' but got '%v'", wrap.Id, event.Id)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for event")
+	}
+
+	// invalid event gets rejected
+	invalid := *wrap
+	invalid.Content = "tampered"
+	if err := Publish(ctx, relayURL, invalid); err == nil {
+		t.Fatal("expected error publishing invalid event")
+	}
+}
@@ -0,0 +1,145 @@
+package nostr
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/elnosh/gonuts/proxy"
+	"github.com/gorilla/websocket"
+)
+
+const publishTimeout = 10 * time.Second
+
+var dialer = websocket.DefaultDialer
+
+// SetProxy makes connections to relays go through the proxy.
+// If proxyURL is nil, connections are made directly.
+func SetProxy(proxyURL *url.URL) {
+	dialer = proxy.WebsocketDialer(proxyURL)
+}
+
+// Filter for subscriptions as defined in NIP-01
+type Filter struct {
+	Kinds []int    `json:"kinds,omitempty"`
+	PTags []string `json:"#p,omitempty"`
+	Since int64    `json:"since,omitempty"`
+}
+
+// Publish sends the event to the relay and waits until the relay accepts it
+func Publish(ctx context.Context, relayURL string, event Event) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	conn, _, err := dialer.DialContext(ctx, relayURL, nil)
+	if err != nil {
+		return fmt.Errorf("could not connect to relay '%v': %v", relayURL, err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	conn.SetWriteDeadline(deadline)
+
+	if err := conn.WriteJSON([]any{"EVENT", event}); err != nil {
+		return err
+	}
+
+	for {
+		var msg []json.RawMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return fmt.Errorf("error reading from relay '%v': %v", relayURL, err)
+		}
+		if len(msg) < 3 {
+			continue
+		}
+
+		var msgType, eventId string
+		json.Unmarshal(msg[0], &msgType)
+		json.Unmarshal(msg[1], &eventId)
+		if msgType != "OK" || eventId != event.Id {
+			continue
+		}
+
+		var accepted bool
+		json.Unmarshal(msg[2], &accepted)
+		if !accepted {
+			var reason string
+			if len(msg) > 3 {
+				json.Unmarshal(msg[3], &reason)
+			}
+			return fmt.Errorf("event rejected by relay '%v': %v", relayURL, reason)
+		}
+		return nil
+	}
+}
+
+// Subscribe opens a subscription in the relay with the filter. Events
+// matching the filter are sent in the returned channel, which will be
+// closed when the context is canceled or the connection is closed.
+func Subscribe(ctx context.Context, relayURL string, filter Filter) (<-chan Event, error) {
+	conn, _, err := dialer.DialContext(ctx, relayURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to relay '%v': %v", relayURL, err)
+	}
+
+	subIdBytes := make([]byte, 8)
+	if _, err := rand.Read(subIdBytes); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	subId := hex.EncodeToString(subIdBytes)
+
+	if err := conn.WriteJSON([]any{"REQ", subId, filter}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		<-ctx.Done()
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.Close()
+	}()
+
+	go func() {
+		defer close(events)
+		for {
+			var msg []json.RawMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				var syntaxErr *json.SyntaxError
+				if errors.As(err, &syntaxErr) {
+					continue
+				}
+				return
+			}
+			if len(msg) < 3 {
+				continue
+			}
+
+			var msgType, msgSubId string
+			json.Unmarshal(msg[0], &msgType)
+			json.Unmarshal(msg[1], &msgSubId)
+			if msgType != "EVENT" || msgSubId != subId {
+				continue
+			}
+
+			var event Event
+			if err := json.Unmarshal(msg[2], &event); err != nil {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
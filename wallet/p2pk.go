@@ -1,40 +1,190 @@
 package wallet
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/internal/keys"
 )
 
 // Derive key that wallet will use to receive locked ecash
 func DeriveP2PK(key *hdkeychain.ExtendedKey) (*btcec.PrivateKey, error) {
-	// m/129372'
-	purpose, err := key.Derive(hdkeychain.HardenedKeyStart + 129372)
+	// m/129372'/0'/1'/0
+	extKey, err := keys.DerivePath(key, keys.Hardened(129372), keys.Hardened(0), keys.Hardened(1), 0)
 	if err != nil {
 		return nil, err
 	}
 
-	// m/129372'/0'
-	coinType, err := purpose.Derive(hdkeychain.HardenedKeyStart + 0)
+	pk, err := extKey.ECPrivKey()
 	if err != nil {
 		return nil, err
 	}
 
-	// m/129372'/0'/1'
-	first, err := coinType.Derive(hdkeychain.HardenedKeyStart + 1)
-	if err != nil {
-		return nil, err
+	return pk, nil
+}
+
+// P2PKSigners describes the signatures needed to spend
+// proofs in a token locked to the same P2PK conditions
+type P2PKSigners struct {
+	// keys that can sign the proofs
+	PublicKeys []string
+	// number of signatures required from PublicKeys. It is 0
+	// if the locktime passed and there are no refund keys
+	NSigs int
+	// keys in PublicKeys that the wallet can sign with
+	WalletKeys []string
+	SigAll     bool
+	ProofCount int
+	Amount     uint64
+}
+
+// CanSign returns whether the wallet can provide the signatures required
+func (s P2PKSigners) CanSign() bool {
+	return len(s.WalletKeys) >= s.NSigs
+}
+
+// MissingSigners returns the keys from which a signature is needed
+// that the wallet does not have if it cannot sign by itself
+func (s P2PKSigners) MissingSigners() []string {
+	if s.CanSign() {
+		return nil
+	}
+	var missing []string
+	for _, key := range s.PublicKeys {
+		if !slices.Contains(s.WalletKeys, key) {
+			missing = append(missing, key)
+		}
 	}
+	return missing
+}
 
-	// m/129372'/0'/1'/0
-	extKey, err := first.Derive(0)
-	if err != nil {
-		return nil, err
+func (s P2PKSigners) missingSignersErr() error {
+	return fmt.Errorf("%w: %v signatures required from %v but wallet can only sign with %v. Missing %v signatures from %v",
+		ErrMissingSigners, s.NSigs, s.PublicKeys, s.WalletKeys, s.NSigs-len(s.WalletKeys), s.MissingSigners())
+}
+
+// TokenSigners returns the signatures needed to spend the P2PK locked proofs in the
+// token. Proofs locked to the same conditions are grouped together.
+func (w *Wallet) TokenSigners(token cashu.Token) ([]P2PKSigners, error) {
+	var signers []P2PKSigners
+	conditions := make(map[string]int)
+	for _, proof := range token.Proofs() {
+		secret, err := nut10.DeserializeSecret(proof.Secret)
+		if err != nil || secret.Kind != nut10.P2PK {
+			continue
+		}
+
+		key := lockConditions(secret)
+		i, ok := conditions[key]
+		if !ok {
+			proofSigners, _, err := w.p2pkSigners(secret)
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, proofSigners)
+			i = len(signers) - 1
+			conditions[key] = i
+		}
+		signers[i].ProofCount++
+		signers[i].Amount += proof.Amount
 	}
+	return signers, nil
+}
 
-	pk, err := extKey.ECPrivKey()
+// signP2PKInputs adds to the witness of the P2PK locked proofs signatures from the keys
+// of the wallet that can sign them. It returns ErrMissingSigners naming the keys missing
+// if the wallet cannot provide the signatures required. Proofs with SIG_ALL are not
+// signed here. The keys to sign them are returned so that they sign the whole
+// request with nut11.AddSigAllSignatures once the outputs are created.
+func (w *Wallet) signP2PKInputs(proofs cashu.Proofs) (cashu.Proofs, []*btcec.PrivateKey, error) {
+	signed := make(cashu.Proofs, len(proofs))
+	copy(signed, proofs)
+
+	var sigAllKeys []*btcec.PrivateKey
+	for i, proof := range signed {
+		secret, err := nut10.DeserializeSecret(proof.Secret)
+		if err != nil || secret.Kind != nut10.P2PK {
+			continue
+		}
+
+		signers, keys, err := w.p2pkSigners(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !signers.CanSign() {
+			return nil, nil, signers.missingSignersErr()
+		}
+		if signers.NSigs == 0 {
+			continue
+		}
+
+		keys = keys[:signers.NSigs]
+		if signers.SigAll {
+			sigAllKeys = keys
+			continue
+		}
+		signedProof, err := nut11.AddSignaturesToInputs(cashu.Proofs{proof}, keys)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error signing inputs: %v", err)
+		}
+		signed[i] = signedProof[0]
+	}
+	return signed, sigAllKeys, nil
+}
+
+// p2pkSigners returns who needs to sign the P2PK locked secret
+// and the keys of the wallet that can sign it
+func (w *Wallet) p2pkSigners(secret nut10.WellKnownSecret) (P2PKSigners, []*btcec.PrivateKey, error) {
+	pubkeys, nsigs, err := nut11.RequiredSigners(secret)
 	if err != nil {
-		return nil, err
+		return P2PKSigners{}, nil, fmt.Errorf("invalid locked ecash: %v", err)
 	}
 
-	return pk, nil
+	signers := P2PKSigners{
+		PublicKeys: make([]string, len(pubkeys)),
+		NSigs:      nsigs,
+		WalletKeys: []string{},
+		SigAll:     nut11.IsSigAll(secret),
+	}
+	var keys []*btcec.PrivateKey
+	for i, pubkey := range pubkeys {
+		signers.PublicKeys[i] = hex.EncodeToString(pubkey.SerializeCompressed())
+		for _, key := range w.signingKeys() {
+			// signatures are verified against the x-only key
+			if bytes.Equal(schnorr.SerializePubKey(key.PubKey()), schnorr.SerializePubKey(pubkey)) &&
+				!slices.Contains(keys, key) {
+				keys = append(keys, key)
+				signers.WalletKeys = append(signers.WalletKeys, signers.PublicKeys[i])
+				break
+			}
+		}
+	}
+	return signers, keys, nil
+}
+
+// signingKeys returns the keys ecash can be locked to that the wallet
+// can sign with. The nostr key is included since senders may lock
+// ecash to the nostr public key of the receiver.
+func (w *Wallet) signingKeys() []*btcec.PrivateKey {
+	keys := []*btcec.PrivateKey{w.privateKey}
+	if w.nostrKey != nil {
+		keys = append(keys, w.nostrKey)
+	}
+	return keys
+}
+
+// lockConditions identifies the spending conditions of the
+// secret, which are the same for proofs locked together
+func lockConditions(secret nut10.WellKnownSecret) string {
+	tags, _ := json.Marshal(secret.Data.Tags)
+	return secret.Data.Data + string(tags)
 }
@@ -0,0 +1,186 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut18"
+	"github.com/elnosh/gonuts/wallet/nostr"
+)
+
+var (
+	ErrTransportNotSupported = errors.New("payment request transport not supported")
+	ErrPaymentRequestAmount  = errors.New("amount needs to be specified for payment request without amount")
+)
+
+// CreatePaymentRequest creates a NUT-18 payment request for the amount that can
+// be paid to any of the mints trusted by the wallet. If amount is 0, the payer
+// chooses the amount. The payment will be delivered through the transports passed.
+// If no transports are set, the payer has to deliver the payment out-of-band.
+func (w *Wallet) CreatePaymentRequest(
+	amount uint64,
+	description string,
+	transports []nut18.Transport,
+) (*nut18.PaymentRequest, error) {
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+
+	mints := w.TrustedMints()
+	slices.Sort(mints)
+
+	return &nut18.PaymentRequest{
+		Id:          hex.EncodeToString(idBytes),
+		Amount:      amount,
+		Unit:        w.unit.String(),
+		Mints:       mints,
+		Description: description,
+		Transports:  transports,
+	}, nil
+}
+
+// PayPaymentRequest pays the NUT-18 payment request from one of the mints accepted
+// by the request in which the wallet has enough funds. The amount passed is only
+// used if the request does not specify one. If the request has a post transport the
+// payment will be sent to its target, otherwise it is sent as a NIP-17 direct message
+// if it has a nostr transport. The payload with the proofs is returned so it
+// can be delivered out-of-band if the request does not have any transports.
+func (w *Wallet) PayPaymentRequest(request nut18.PaymentRequest, amount uint64) (*nut18.PaymentRequestPayload, error) {
+	if request.Amount > 0 {
+		amount = request.Amount
+	}
+	if amount == 0 {
+		return nil, ErrPaymentRequestAmount
+	}
+	if len(request.Unit) > 0 && request.Unit != w.unit.String() {
+		return nil, cashu.ErrInvalidUnit
+	}
+
+	// check transport before selecting proofs to send
+	var postTransport *nut18.Transport
+	var nostrReceiver *secp256k1.PublicKey
+	var nostrRelays []string
+	if len(request.Transports) > 0 {
+		if transport, ok := request.Transport(nut18.PostTransport); ok {
+			postTransport = &transport
+		} else if transport, ok := request.Transport(nut18.NostrTransport); ok && supportsNip17(transport) {
+			receiver, relays, err := nostr.DecodeNprofile(transport.Target)
+			if err != nil {
+				return nil, err
+			}
+			// use relays from wallet if nprofile does not have any
+			if len(relays) == 0 {
+				relays = w.nostrRelays
+			}
+			if len(relays) == 0 {
+				return nil, ErrNoNostrRelays
+			}
+			nostrReceiver, nostrRelays = receiver, relays
+		} else {
+			return nil, ErrTransportNotSupported
+		}
+	}
+
+	mint, err := w.mintForPaymentRequest(request, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	proofs, err := w.Send(amount, mint, true)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := nut18.PaymentRequestPayload{
+		Id:     request.Id,
+		Mint:   mint,
+		Unit:   w.unit.String(),
+		Proofs: proofs,
+	}
+
+	if postTransport != nil {
+		if err := w.client.PostPaymentRequestPayload(postTransport.Target, payload); err != nil {
+			return nil, fmt.Errorf("error sending payment to '%v': %v", postTransport.Target, err)
+		}
+	} else if nostrReceiver != nil {
+		payloadJson, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.sendNostrMessage(nostrReceiver, nostrRelays, string(payloadJson)); err != nil {
+			return nil, fmt.Errorf("error sending payment through nostr: %v", err)
+		}
+	}
+
+	return &payload, nil
+}
+
+// supportsNip17 returns whether the nostr transport accepts NIP-17 direct
+// messages. If the transport does not specify NIPs, NIP-17 is assumed.
+func supportsNip17(transport nut18.Transport) bool {
+	hasNipTag := false
+	for _, tag := range transport.Tags {
+		if len(tag) == 0 || tag[0] != "n" {
+			continue
+		}
+		hasNipTag = true
+		if slices.Contains(tag[1:], "17") {
+			return true
+		}
+	}
+	return !hasNipTag
+}
+
+// mintForPaymentRequest returns a mint accepted by the request in
+// which the wallet has enough balance to pay the amount
+func (w *Wallet) mintForPaymentRequest(request nut18.PaymentRequest, amount uint64) (string, error) {
+	balanceByMints := w.GetBalanceByMints()
+
+	// if request does not specify mints, any mint is accepted
+	if len(request.Mints) == 0 {
+		if balanceByMints[w.defaultMint] >= amount {
+			return w.defaultMint, nil
+		}
+		for mint, balance := range balanceByMints {
+			if balance >= amount {
+				return mint, nil
+			}
+		}
+		return "", ErrInsufficientMintBalance
+	}
+
+	for _, mint := range request.Mints {
+		if balance, ok := balanceByMints[mint]; ok && balance >= amount {
+			return mint, nil
+		}
+	}
+	return "", fmt.Errorf("%w from mints accepted by payment request", ErrInsufficientMintBalance)
+}
+
+// ReceivePaymentRequestPayload redeems the proofs in a payload received
+// for a payment request. The proofs must be from a mint trusted by the wallet.
+func (w *Wallet) ReceivePaymentRequestPayload(payload nut18.PaymentRequestPayload) (uint64, error) {
+	if payload.Unit != w.unit.String() {
+		return 0, cashu.ErrInvalidUnit
+	}
+	if _, ok := w.getMint(payload.Mint); !ok {
+		return 0, ErrMintNotExist
+	}
+	if len(payload.Proofs) == 0 {
+		return 0, errors.New("payload does not have proofs")
+	}
+
+	token, err := cashu.NewTokenV4(payload.Proofs, payload.Mint, w.unit, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return w.Receive(token, false)
+}
@@ -7,24 +7,42 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/btcsuite/btcd/btcutil/hdkeychain"
-	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut09"
 	"github.com/elnosh/gonuts/cashu/nuts/nut13"
 	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/internal/keys"
 	"github.com/elnosh/gonuts/wallet/client"
-	"github.com/tyler-smith/go-bip39"
 )
 
-func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, error) {
+const (
+	// number of outputs sent to the mint in each restore request
+	restoreBatchSize = 100
+	// the restore of a keyset stops after this many
+	// consecutive counters without signatures from the mint
+	restoreGapLimit = 300
+)
+
+// Restore creates a new wallet in walletPath from the mnemonic and
+// recovers the proofs from the mints by deriving again the outputs
+// of each keyset until restoreGapLimit outputs in a row were not
+// signed by the mint. The counter of each keyset is set past the
+// last output signed so restored wallets do not reuse secrets.
+// It returns the amount of the proofs restored.
+func Restore(
+	walletPath string,
+	storageType StorageType,
+	mnemonic string,
+	mintsToRestore []string,
+	opts ...Option,
+) (uint64, error) {
 	// check if wallet db already exists, if there is one, throw error.
-	dbpath := filepath.Join(walletPath, "wallet.db")
-	_, err := os.Stat(dbpath)
-	if err == nil {
-		return 0, errors.New("wallet already exists")
+	for _, dbfile := range []string{"wallet.db", "wallet.sqlite.db"} {
+		if _, err := os.Stat(filepath.Join(walletPath, dbfile)); err == nil {
+			return 0, errors.New("wallet already exists")
+		}
 	}
 
 	if err := os.MkdirAll(walletPath, 0700); err != nil {
@@ -32,47 +50,52 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 	}
 
 	// check mnemonic is valid
-	if !bip39.IsMnemonicValid(mnemonic) {
+	if !keys.ValidMnemonic(mnemonic) {
 		return 0, errors.New("invalid mnemonic")
 	}
 
 	// create wallet db
-	db, err := InitStorage(walletPath)
+	db, err := InitStorage(walletPath, storageType)
 	if err != nil {
 		return 0, fmt.Errorf("error restoring wallet: %v", err)
 	}
 
-	seed := bip39.NewSeed(mnemonic, "")
+	seed, err := keys.SeedFromMnemonic(mnemonic)
+	if err != nil {
+		return 0, err
+	}
 	// get master key from seed
-	masterKey, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	masterKey, err := keys.NewMaster(seed)
 	if err != nil {
 		return 0, err
 	}
 	db.SaveMnemonicSeed(mnemonic, seed)
 
 	proofsRestored := cashu.Proofs{}
+	mintClient := client.New(applyOptions(opts).httpClient)
 
 	// for each mint get the keysets and do restore process for each keyset
 	for _, mint := range mintsToRestore {
-		mintInfo, err := client.GetMintInfo(mint)
+		mintInfo, err := mintClient.GetMintInfo(mint)
 		if err != nil {
 			return 0, fmt.Errorf("error getting info from mint: %v", err)
 		}
 
-		if !mintInfo.Nuts.Nut07.Supported || !mintInfo.Nuts.Nut09.Supported {
+		capabilities := capabilitiesFromInfo(mintInfo, cashu.Sat)
+		if !capabilities.TokenStateCheck || !capabilities.Restore {
 			fmt.Println("mint does not support the necessary operations to restore wallet")
 			continue
 		}
 
 		// call to get mint keysets
-		keysetsResponse, err := client.GetAllKeysets(mint)
+		keysetsResponse, err := mintClient.GetAllKeysets(mint)
 		if err != nil {
 			return 0, err
 		}
 
 		for _, keyset := range keysetsResponse.Keysets {
 			if keyset.Unit != cashu.Sat.String() {
-				break
+				continue
 			}
 
 			_, err := hex.DecodeString(keyset.Id)
@@ -83,7 +106,7 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 
 			var counter uint32 = 0
 
-			keysetKeys, err := GetKeysetKeys(mint, keyset.Id)
+			keysetKeys, err := getKeysetKeys(mintClient, mint, keyset.Id)
 			if err != nil {
 				return 0, err
 			}
@@ -106,15 +129,16 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 				return 0, err
 			}
 
-			// stop when it reaches 3 consecutive empty batches
-			emptyBatches := 0
-			for emptyBatches < 3 {
-				blindedMessages := make(cashu.BlindedMessages, 100)
-				rs := make([]*secp256k1.PrivateKey, 100)
-				secrets := make([]string, 100)
+			// counter after the last output signed by the mint
+			// and the one saved for the keyset
+			var nextCounter, savedCounter uint32 = 0, 0
+			for counter-nextCounter < restoreGapLimit {
+				batchStart := counter
+				blindedMessages := make(cashu.BlindedMessages, restoreBatchSize)
+				rs := make([]*secp256k1.PrivateKey, restoreBatchSize)
+				secrets := make([]string, restoreBatchSize)
 
-				// create batch of 100 blinded messages
-				for i := 0; i < 100; i++ {
+				for i := 0; i < restoreBatchSize; i++ {
 					secret, r, err := generateDeterministicSecret(keysetDerivationPath, counter)
 					if err != nil {
 						return 0, err
@@ -133,13 +157,13 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 
 				// if response has signatures, unblind them and check proof states
 				restoreRequest := nut09.PostRestoreRequest{Outputs: blindedMessages}
-				restoreResponse, err := client.PostRestore(mint, restoreRequest)
+				restoreResponse, err := mintClient.PostRestore(mint, restoreRequest)
 				if err != nil {
-					return 0, fmt.Errorf("error restoring signatures from mint '%v': %v", mint, err)
+					return 0, fmt.Errorf("error restoring signatures from mint '%v': %w", mint, err)
 				}
 
 				if len(restoreResponse.Signatures) == 0 {
-					emptyBatches++
+					crypto.ZeroPrivateKeys(rs...)
 					continue
 				}
 
@@ -160,6 +184,7 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 							break
 						}
 					}
+					nextCounter = max(nextCounter, batchStart+uint32(blindMessageIdx)+1)
 
 					C, err := unblindSignature(signature.C_, rs[blindMessageIdx], pubkey)
 					if err != nil {
@@ -181,9 +206,10 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 					}
 					proofs[Yhex] = proof
 				}
+				crypto.ZeroPrivateKeys(rs...)
 
 				proofStateRequest := nut07.PostCheckStateRequest{Ys: Ys}
-				proofStateResponse, err := client.PostCheckProofState(mint, proofStateRequest)
+				proofStateResponse, err := mintClient.PostCheckProofState(mint, proofStateRequest)
 				if err != nil {
 					return 0, err
 				}
@@ -217,11 +243,11 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 					}
 				}
 
-				// save wallet keyset with latest counter moving forward for wallet
-				if err := db.IncrementKeysetCounter(keyset.Id, counter); err != nil {
+				// move the counter of the keyset past the outputs signed by the mint
+				if err := db.IncrementKeysetCounter(keyset.Id, nextCounter-savedCounter); err != nil {
 					return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
 				}
-				emptyBatches = 0
+				savedCounter = nextCounter
 			}
 		}
 	}
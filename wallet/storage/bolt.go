@@ -1,15 +1,15 @@
 package storage
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
 
 	"github.com/elnosh/gonuts/cashu"
-	"github.com/elnosh/gonuts/cashu/nuts/nut04"
-	"github.com/elnosh/gonuts/cashu/nuts/nut05"
 	"github.com/elnosh/gonuts/crypto"
 	bolt "go.etcd.io/bbolt"
 )
@@ -17,9 +17,16 @@ import (
 const (
 	KEYSETS_BUCKET        = "keysets"
 	PROOFS_BUCKET         = "proofs"
+	PROOF_KEYSETS_BUCKET  = "proof_keysets"
 	PENDING_PROOFS_BUCKET = "pending_proofs"
 	MINT_QUOTES_BUCKET    = "mint_quotes"
 	MELT_QUOTES_BUCKET    = "melt_quotes"
+	REMOVED_MINTS_BUCKET  = "removed_mints"
+	TRANSACTIONS_BUCKET   = "transactions"
+	PROOF_LABELS_BUCKET   = "proof_labels"
+	SEEN_PROOFS_BUCKET    = "seen_proofs"
+	CONTACTS_BUCKET       = "contacts"
+	MINT_PUBKEYS_BUCKET   = "mint_pubkeys"
 	INVOICES_BUCKET       = "invoices"
 	SEED_BUCKET           = "seed"
 	MNEMONIC_KEY          = "mnemonic"
@@ -27,6 +34,8 @@ const (
 
 var (
 	ProofNotFound         = errors.New("proof not found")
+	TransactionNotFound   = errors.New("transaction not found")
+	ContactNotFound       = errors.New("contact not found")
 	KeysetMintURLNotFound = errors.New("keyset with mint url not found")
 )
 
@@ -40,59 +49,18 @@ func InitBolt(path string) (*BoltDB, error) {
 		return nil, fmt.Errorf("error setting bolt db: %v", err)
 	}
 
-	boltdb := &BoltDB{bolt: db}
-	err = boltdb.initWalletBuckets()
-	if err != nil {
-		return nil, fmt.Errorf("error setting bolt db: %v", err)
-	}
-
-	if err := boltdb.MigrateInvoicesToQuotes(); err != nil {
-		return nil, fmt.Errorf("error migrating db: %v", err)
+	if err := migrateBolt(db, boltMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating db: %w", err)
 	}
 
-	return boltdb, nil
+	return &BoltDB{bolt: db}, nil
 }
 
 func (db *BoltDB) Close() error {
 	return db.bolt.Close()
 }
 
-func (db *BoltDB) initWalletBuckets() error {
-	return db.bolt.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(KEYSETS_BUCKET))
-		if err != nil {
-			return err
-		}
-
-		_, err = tx.CreateBucketIfNotExists([]byte(PROOFS_BUCKET))
-		if err != nil {
-			return err
-		}
-
-		_, err = tx.CreateBucketIfNotExists([]byte(PENDING_PROOFS_BUCKET))
-		if err != nil {
-			return err
-		}
-
-		_, err = tx.CreateBucketIfNotExists([]byte(MINT_QUOTES_BUCKET))
-		if err != nil {
-			return err
-		}
-
-		_, err = tx.CreateBucketIfNotExists([]byte(MELT_QUOTES_BUCKET))
-		if err != nil {
-			return err
-		}
-
-		_, err = tx.CreateBucketIfNotExists([]byte(SEED_BUCKET))
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-}
-
 func (db *BoltDB) SaveMnemonicSeed(mnemonic string, seed []byte) {
 	db.bolt.Update(func(tx *bolt.Tx) error {
 		seedb := tx.Bucket([]byte(SEED_BUCKET))
@@ -122,16 +90,56 @@ func (db *BoltDB) GetSeed() []byte {
 	return seed
 }
 
+// Proofs are stored in a bucket for each keyset inside the proofs bucket,
+// keyed by their Y. The proof keysets bucket has the keyset of each Y
+// so a proof can be found without going through all the keysets.
 func (db *BoltDB) SaveProofs(proofs cashu.Proofs) error {
 	return db.bolt.Update(func(tx *bolt.Tx) error {
-		proofsb := tx.Bucket([]byte(PROOFS_BUCKET))
 		for _, proof := range proofs {
-			key := []byte(proof.Secret)
-			jsonProof, err := json.Marshal(proof)
+			if err := putProof(tx, proof); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func putProof(tx *bolt.Tx, proof cashu.Proof) error {
+	Y, err := crypto.HashToCurve([]byte(proof.Secret))
+	if err != nil {
+		return err
+	}
+	key := Y.SerializeCompressed()
+
+	jsonProof, err := json.Marshal(proof)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %v", err)
+	}
+	keysetb, err := tx.Bucket([]byte(PROOFS_BUCKET)).CreateBucketIfNotExists([]byte(proof.Id))
+	if err != nil {
+		return err
+	}
+	if err := keysetb.Put(key, jsonProof); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte(PROOF_KEYSETS_BUCKET)).Put(key, []byte(proof.Id)); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(SEEN_PROOFS_BUCKET)).Put(key, []byte{})
+}
+
+// SaveSeenYs records the Ys of proofs that went through the wallet
+// without being stored, such as the proofs of a token received.
+// Proofs saved with SaveProofs or as pending are recorded as well.
+func (db *BoltDB) SaveSeenYs(Ys []string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		seenb := tx.Bucket([]byte(SEEN_PROOFS_BUCKET))
+		for _, v := range Ys {
+			y, err := hex.DecodeString(v)
 			if err != nil {
-				return fmt.Errorf("invalid proof: %v", err)
+				return fmt.Errorf("invalid Y: %v", err)
 			}
-			if err := proofsb.Put(key, jsonProof); err != nil {
+			if err := seenb.Put(y, []byte{}); err != nil {
 				return err
 			}
 		}
@@ -139,62 +147,151 @@ func (db *BoltDB) SaveProofs(proofs cashu.Proofs) error {
 	})
 }
 
-// return all proofs from db
-func (db *BoltDB) GetProofs() cashu.Proofs {
-	proofs := cashu.Proofs{}
+// GetSeenYs returns which of the Ys passed were already seen by the wallet
+func (db *BoltDB) GetSeenYs(Ys []string) []string {
+	seen := []string{}
 
 	db.bolt.View(func(tx *bolt.Tx) error {
-		proofsb := tx.Bucket([]byte(PROOFS_BUCKET))
-
-		c := proofsb.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var proof cashu.Proof
-			if err := json.Unmarshal(v, &proof); err != nil {
+		seenb := tx.Bucket([]byte(SEEN_PROOFS_BUCKET))
+		for _, v := range Ys {
+			y, err := hex.DecodeString(v)
+			if err != nil {
 				continue
 			}
-			proofs = append(proofs, proof)
+			if seenb.Get(y) != nil {
+				seen = append(seen, v)
+			}
 		}
 		return nil
 	})
+	return seen
+}
+
+// return all proofs from db
+func (db *BoltDB) GetProofs() cashu.Proofs {
+	proofs := cashu.Proofs{}
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		proofsb := tx.Bucket([]byte(PROOFS_BUCKET))
+		return proofsb.ForEach(func(keysetId, v []byte) error {
+			proofs = append(proofs, keysetProofs(proofsb.Bucket(keysetId))...)
+			return nil
+		})
+	})
 	return proofs
 }
 
 func (db *BoltDB) GetProofsByKeysetId(id string) cashu.Proofs {
 	proofs := cashu.Proofs{}
 
-	if err := db.bolt.View(func(tx *bolt.Tx) error {
-		proofsb := tx.Bucket([]byte(PROOFS_BUCKET))
+	db.bolt.View(func(tx *bolt.Tx) error {
+		proofs = keysetProofs(tx.Bucket([]byte(PROOFS_BUCKET)).Bucket([]byte(id)))
+		return nil
+	})
+	return proofs
+}
 
-		c := proofsb.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+// GetKeysetProofsByY returns the proofs of the keyset keyed by their Y
+func (db *BoltDB) GetKeysetProofsByY(id string) map[string]cashu.Proof {
+	proofs := make(map[string]cashu.Proof)
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		keysetb := tx.Bucket([]byte(PROOFS_BUCKET)).Bucket([]byte(id))
+		if keysetb == nil {
+			return nil
+		}
+		return keysetb.ForEach(func(k, v []byte) error {
 			var proof cashu.Proof
 			if err := json.Unmarshal(v, &proof); err != nil {
-				return err
+				return nil
 			}
+			proofs[hex.EncodeToString(k)] = proof
+			return nil
+		})
+	})
+	return proofs
+}
 
-			if proof.Id == id {
-				proofs = append(proofs, proof)
-			}
-		}
-		return nil
-	}); err != nil {
-		return cashu.Proofs{}
+// keysetProofs returns the proofs in the bucket of a keyset.
+// The bucket is nil if the keyset does not have proofs.
+func keysetProofs(keysetb *bolt.Bucket) cashu.Proofs {
+	proofs := cashu.Proofs{}
+	if keysetb == nil {
+		return proofs
 	}
 
+	c := keysetb.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var proof cashu.Proof
+		if err := json.Unmarshal(v, &proof); err != nil {
+			continue
+		}
+		proofs = append(proofs, proof)
+	}
 	return proofs
 }
 
 func (db *BoltDB) DeleteProof(secret string) error {
+	Y, err := crypto.HashToCurve([]byte(secret))
+	if err != nil {
+		return err
+	}
+	key := Y.SerializeCompressed()
+
 	return db.bolt.Update(func(tx *bolt.Tx) error {
-		proofsb := tx.Bucket([]byte(PROOFS_BUCKET))
-		val := proofsb.Get([]byte(secret))
-		if val == nil {
+		proofKeysetsb := tx.Bucket([]byte(PROOF_KEYSETS_BUCKET))
+		keysetId := proofKeysetsb.Get(key)
+		if keysetId == nil {
 			return ProofNotFound
 		}
-		return proofsb.Delete([]byte(secret))
+		keysetb := tx.Bucket([]byte(PROOFS_BUCKET)).Bucket(keysetId)
+		if keysetb == nil || keysetb.Get(key) == nil {
+			return ProofNotFound
+		}
+
+		if err := tx.Bucket([]byte(PROOF_LABELS_BUCKET)).Delete([]byte(secret)); err != nil {
+			return err
+		}
+		if err := proofKeysetsb.Delete(key); err != nil {
+			return err
+		}
+		return keysetb.Delete(key)
 	})
 }
 
+// SaveProofLabel sets the label of the proofs.
+// An empty label removes the label from the proofs.
+func (db *BoltDB) SaveProofLabel(secrets []string, label string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		labelsb := tx.Bucket([]byte(PROOF_LABELS_BUCKET))
+		for _, secret := range secrets {
+			var err error
+			if len(label) == 0 {
+				err = labelsb.Delete([]byte(secret))
+			} else {
+				err = labelsb.Put([]byte(secret), []byte(label))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *BoltDB) GetProofLabels() map[string]string {
+	labels := make(map[string]string)
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		labelsb := tx.Bucket([]byte(PROOF_LABELS_BUCKET))
+		return labelsb.ForEach(func(k, v []byte) error {
+			labels[string(k)] = string(v)
+			return nil
+		})
+	})
+	return labels
+}
+
 func (db *BoltDB) AddPendingProofs(proofs cashu.Proofs) error {
 	return db.bolt.Update(func(tx *bolt.Tx) error {
 		pendingProofsb := tx.Bucket([]byte(PENDING_PROOFS_BUCKET))
@@ -221,6 +318,9 @@ func (db *BoltDB) AddPendingProofs(proofs cashu.Proofs) error {
 			if err := pendingProofsb.Put(Y.SerializeCompressed(), jsonProof); err != nil {
 				return err
 			}
+			if err := tx.Bucket([]byte(SEEN_PROOFS_BUCKET)).Put(Y.SerializeCompressed(), []byte{}); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -253,6 +353,9 @@ func (db *BoltDB) AddPendingProofsByQuoteId(proofs cashu.Proofs, quoteId string)
 			if err := pendingProofsb.Put(Y.SerializeCompressed(), jsonProof); err != nil {
 				return err
 			}
+			if err := tx.Bucket([]byte(SEEN_PROOFS_BUCKET)).Put(Y.SerializeCompressed(), []byte{}); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -347,18 +450,28 @@ func (db *BoltDB) DeletePendingProofsByQuoteId(quoteId string) error {
 // NOTE: Keysets are stored in nested buckets by mint URL. I.e a keyset with mint URL
 // http://mint.com will create a bucket inside the KEYSETS_BUCKET named by the mint URL
 // and inside this bucket, save the keysets by keyset id
+// SaveKeyset saves the keyset. If the keyset was already saved, the
+// counter is never moved back so that secrets are not derived again.
 func (db *BoltDB) SaveKeyset(keyset *crypto.WalletKeyset) error {
-	jsonKeyset, err := json.Marshal(keyset)
-	if err != nil {
-		return fmt.Errorf("invalid keyset format: %v", err)
-	}
-
 	if err := db.bolt.Update(func(tx *bolt.Tx) error {
 		keysetsb := tx.Bucket([]byte(KEYSETS_BUCKET))
 		mintBucket, err := keysetsb.CreateBucketIfNotExists([]byte(keyset.MintURL))
 		if err != nil {
 			return err
 		}
+
+		toSave := *keyset
+		if storedBytes := mintBucket.Get([]byte(keyset.Id)); storedBytes != nil {
+			var stored crypto.WalletKeyset
+			if err := json.Unmarshal(storedBytes, &stored); err == nil {
+				toSave.Counter = max(toSave.Counter, stored.Counter)
+			}
+		}
+
+		jsonKeyset, err := json.Marshal(&toSave)
+		if err != nil {
+			return fmt.Errorf("invalid keyset format: %v", err)
+		}
 		return mintBucket.Put([]byte(keyset.Id), jsonKeyset)
 	}); err != nil {
 		return fmt.Errorf("error saving keyset: %v", err)
@@ -539,6 +652,116 @@ func (db *BoltDB) UpdateKeysetMintURL(oldURL, newURL string) error {
 	})
 }
 
+// SaveRemovedMint marks the mint as removed. The keysets of the mint
+// are kept so that the counters are not reset if the mint is added again.
+func (db *BoltDB) SaveRemovedMint(mintURL string) error {
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		removedb := tx.Bucket([]byte(REMOVED_MINTS_BUCKET))
+		return removedb.Put([]byte(mintURL), []byte{})
+	}); err != nil {
+		return fmt.Errorf("error saving removed mint: %v", err)
+	}
+	return nil
+}
+
+func (db *BoltDB) GetRemovedMints() []string {
+	var mints []string
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		removedb := tx.Bucket([]byte(REMOVED_MINTS_BUCKET))
+		return removedb.ForEach(func(k, v []byte) error {
+			mints = append(mints, string(k))
+			return nil
+		})
+	})
+
+	return mints
+}
+
+func (db *BoltDB) DeleteRemovedMint(mintURL string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		removedb := tx.Bucket([]byte(REMOVED_MINTS_BUCKET))
+		return removedb.Delete([]byte(mintURL))
+	})
+}
+
+func (db *BoltDB) SaveMintPubkey(mintURL, pubkey string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		pubkeysb := tx.Bucket([]byte(MINT_PUBKEYS_BUCKET))
+		return pubkeysb.Put([]byte(mintURL), []byte(pubkey))
+	})
+}
+
+func (db *BoltDB) GetMintPubkeys() map[string]string {
+	pubkeys := make(map[string]string)
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		pubkeysb := tx.Bucket([]byte(MINT_PUBKEYS_BUCKET))
+		return pubkeysb.ForEach(func(k, v []byte) error {
+			pubkeys[string(k)] = string(v)
+			return nil
+		})
+	})
+	return pubkeys
+}
+
+// SaveContact saves the contact, replacing the contact with the same name
+func (db *BoltDB) SaveContact(contact Contact) error {
+	jsonContact, err := json.Marshal(contact)
+	if err != nil {
+		return fmt.Errorf("invalid contact: %v", err)
+	}
+
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		contactsb := tx.Bucket([]byte(CONTACTS_BUCKET))
+		return contactsb.Put([]byte(contact.Name), jsonContact)
+	})
+}
+
+func (db *BoltDB) GetContacts() []Contact {
+	contacts := []Contact{}
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		contactsb := tx.Bucket([]byte(CONTACTS_BUCKET))
+		return contactsb.ForEach(func(k, v []byte) error {
+			var contact Contact
+			if err := json.Unmarshal(v, &contact); err != nil {
+				return nil
+			}
+			contacts = append(contacts, contact)
+			return nil
+		})
+	})
+	return contacts
+}
+
+func (db *BoltDB) GetContact(name string) *Contact {
+	var contact *Contact
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		contactsb := tx.Bucket([]byte(CONTACTS_BUCKET))
+		jsonContact := contactsb.Get([]byte(name))
+		if jsonContact == nil {
+			return nil
+		}
+		if err := json.Unmarshal(jsonContact, &contact); err != nil {
+			contact = nil
+		}
+		return nil
+	})
+	return contact
+}
+
+func (db *BoltDB) DeleteContact(name string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		contactsb := tx.Bucket([]byte(CONTACTS_BUCKET))
+		if contactsb.Get([]byte(name)) == nil {
+			return ContactNotFound
+		}
+		return contactsb.Delete([]byte(name))
+	})
+}
+
 func (db *BoltDB) SaveMintQuote(quote MintQuote) error {
 	jsonbytes, err := json.Marshal(&quote)
 	if err != nil {
@@ -640,69 +863,83 @@ func (db *BoltDB) GetMeltQuoteById(id string) *MeltQuote {
 	return quote
 }
 
-func (db *BoltDB) MigrateInvoicesToQuotes() error {
-	invoices := db.GetInvoices()
+func (db *BoltDB) SaveTransaction(transaction Transaction) error {
+	jsonbytes, err := json.Marshal(transaction)
+	if err != nil {
+		return fmt.Errorf("invalid transaction: %v", err)
+	}
 
-	for _, invoice := range invoices {
-		switch invoice.TransactionType {
-		case Mint:
-			state := nut04.Unpaid
-			if invoice.Paid {
-				state = nut04.Paid
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		transactionsb := tx.Bucket([]byte(TRANSACTIONS_BUCKET))
+		// key by sequence to keep transactions in the order they were saved
+		seq, err := transactionsb.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return transactionsb.Put(key, jsonbytes)
+	})
+}
+
+func (db *BoltDB) GetTransactions(filter TransactionFilter) []Transaction {
+	var transactions []Transaction
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		transactionsb := tx.Bucket([]byte(TRANSACTIONS_BUCKET))
+		c := transactionsb.Cursor()
+
+		skipped := 0
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if filter.Limit > 0 && len(transactions) == filter.Limit {
+				break
 			}
 
-			mintQuote := MintQuote{
-				QuoteId:        invoice.Id,
-				Mint:           invoice.Mint,
-				Method:         cashu.BOLT11_METHOD,
-				State:          state,
-				Unit:           cashu.Sat.String(),
-				Amount:         invoice.QuoteAmount,
-				PaymentRequest: invoice.PaymentRequest,
-				CreatedAt:      invoice.CreatedAt,
-				QuoteExpiry:    invoice.QuoteExpiry,
+			var transaction Transaction
+			if err := json.Unmarshal(v, &transaction); err != nil {
+				continue
 			}
-			if err := db.SaveMintQuote(mintQuote); err != nil {
-				return fmt.Errorf("error saving mint quote: %v", err)
+			if !filter.matches(transaction) {
+				continue
+			}
+			if skipped < filter.Offset {
+				skipped++
+				continue
 			}
+			transactions = append(transactions, transaction)
+		}
+		return nil
+	})
+
+	return transactions
+}
 
-		case Melt:
-			state := nut05.Unpaid
-			if invoice.Paid {
-				state = nut05.Paid
+// AddTransactionLabels adds the labels to the transaction.
+// Labels the transaction already has are not duplicated.
+func (db *BoltDB) AddTransactionLabels(id string, labels []string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		transactionsb := tx.Bucket([]byte(TRANSACTIONS_BUCKET))
+		c := transactionsb.Cursor()
+
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var transaction Transaction
+			if err := json.Unmarshal(v, &transaction); err != nil || transaction.Id != id {
+				continue
 			}
 
-			meltQuote := MeltQuote{
-				QuoteId:        invoice.Id,
-				Mint:           invoice.Mint,
-				Method:         cashu.BOLT11_METHOD,
-				State:          state,
-				Unit:           cashu.Sat.String(),
-				PaymentRequest: invoice.PaymentRequest,
-				Amount:         invoice.QuoteAmount,
-				FeeReserve:     invoice.QuoteAmount - invoice.InvoiceAmount,
-				Preimage:       invoice.Preimage,
-				SettledAt:      invoice.SettledAt,
-				QuoteExpiry:    invoice.QuoteExpiry,
+			for _, label := range labels {
+				if !slices.Contains(transaction.Labels, label) {
+					transaction.Labels = append(transaction.Labels, label)
+				}
 			}
-			if err := db.SaveMeltQuote(meltQuote); err != nil {
-				return fmt.Errorf("error saving melt quote: %v", err)
+			jsonbytes, err := json.Marshal(transaction)
+			if err != nil {
+				return fmt.Errorf("invalid transaction: %v", err)
 			}
-
-		default:
-			continue
+			return transactionsb.Put(k, jsonbytes)
 		}
-	}
-
-	// delete invoices bucket after migrating to quotes buckets
-	if len(invoices) > 0 {
-		db.bolt.Update(func(tx *bolt.Tx) error {
-			tx.DeleteBucket([]byte(INVOICES_BUCKET))
-			return nil
-		})
-	}
-
-	return nil
+		return TransactionNotFound
+	})
 }
 
 func (db *BoltDB) SaveInvoice(invoice Invoice) error {
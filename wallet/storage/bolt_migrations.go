@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	META_BUCKET        = "meta"
+	SCHEMA_VERSION_KEY = "schema_version"
+)
+
+// ErrNewerSchema is returned when the wallet db was migrated
+// by a newer version of gonuts than the one opening it.
+var ErrNewerSchema = errors.New("wallet db was created by a newer version of gonuts")
+
+type boltMigration struct {
+	version uint32
+	migrate func(tx *bolt.Tx) error
+}
+
+// boltMigrations change the structure of the wallet db. They run in order,
+// each one in the same transaction that records its version so a migration
+// that fails does not leave the db half migrated.
+//
+// Wallets created before the schema was versioned start at version 0 and
+// run all of them, so these need to work on a db where they were already applied.
+// New migrations only run on dbs at the previous version.
+var boltMigrations = []boltMigration{
+	{version: 1, migrate: createWalletBuckets},
+	{version: 2, migrate: createSeenProofsBucket},
+	{version: 3, migrate: migrateInvoicesToQuotes},
+	{version: 4, migrate: bucketProofsByKeyset},
+	{version: 5, migrate: createMintPubkeysBucket},
+}
+
+// migrateBolt applies the migrations newer than the version of the db.
+// It fails without changing anything if the db has a version
+// newer than the last of the migrations.
+func migrateBolt(db *bolt.DB, migrations []boltMigration) error {
+	var version uint32
+	if err := db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if version > latest {
+		return fmt.Errorf("%w: db schema version is %v but the latest supported is %v",
+			ErrNewerSchema, version, latest)
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= version {
+			continue
+		}
+		if err := db.Update(func(tx *bolt.Tx) error {
+			if err := migration.migrate(tx); err != nil {
+				return err
+			}
+			return putSchemaVersion(tx, migration.version)
+		}); err != nil {
+			return fmt.Errorf("error running migration %v: %v", migration.version, err)
+		}
+	}
+
+	return nil
+}
+
+// schemaVersion returns the version of the last migration applied.
+// It is 0 if the db does not have one recorded.
+func schemaVersion(tx *bolt.Tx) uint32 {
+	metab := tx.Bucket([]byte(META_BUCKET))
+	if metab == nil {
+		return 0
+	}
+	versionBytes := metab.Get([]byte(SCHEMA_VERSION_KEY))
+	if len(versionBytes) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(versionBytes)
+}
+
+func putSchemaVersion(tx *bolt.Tx, version uint32) error {
+	metab, err := tx.CreateBucketIfNotExists([]byte(META_BUCKET))
+	if err != nil {
+		return err
+	}
+	versionBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(versionBytes, version)
+	return metab.Put([]byte(SCHEMA_VERSION_KEY), versionBytes)
+}
+
+// SchemaVersion returns the version of the last migration applied to the db
+func (db *BoltDB) SchemaVersion() (uint32, error) {
+	var version uint32
+	if err := db.bolt.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func createWalletBuckets(tx *bolt.Tx) error {
+	buckets := []string{
+		KEYSETS_BUCKET,
+		PROOFS_BUCKET,
+		PENDING_PROOFS_BUCKET,
+		MINT_QUOTES_BUCKET,
+		MELT_QUOTES_BUCKET,
+		SEED_BUCKET,
+		REMOVED_MINTS_BUCKET,
+		TRANSACTIONS_BUCKET,
+		PROOF_LABELS_BUCKET,
+		CONTACTS_BUCKET,
+	}
+	for _, bucket := range buckets {
+		if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSeenProofsBucket creates the bucket of seen proofs. Wallets created
+// before proofs were tracked start with the proofs they currently have.
+func createSeenProofsBucket(tx *bolt.Tx) error {
+	if tx.Bucket([]byte(SEEN_PROOFS_BUCKET)) != nil {
+		return nil
+	}
+	seenb, err := tx.CreateBucket([]byte(SEEN_PROOFS_BUCKET))
+	if err != nil {
+		return err
+	}
+
+	proofsb := tx.Bucket([]byte(PROOFS_BUCKET))
+	if err := proofsb.ForEach(func(k, v []byte) error {
+		Y, err := crypto.HashToCurve(k)
+		if err != nil {
+			return err
+		}
+		return seenb.Put(Y.SerializeCompressed(), []byte{})
+	}); err != nil {
+		return err
+	}
+
+	// pending proofs are keyed by Y
+	pendingProofsb := tx.Bucket([]byte(PENDING_PROOFS_BUCKET))
+	return pendingProofsb.ForEach(func(k, v []byte) error {
+		return seenb.Put(k, []byte{})
+	})
+}
+
+// migrateInvoicesToQuotes moves the invoices saved by older versions
+// of the wallet to the mint and melt quotes buckets.
+func migrateInvoicesToQuotes(tx *bolt.Tx) error {
+	invoicesb := tx.Bucket([]byte(INVOICES_BUCKET))
+	if invoicesb == nil {
+		return nil
+	}
+
+	mintQuotesb := tx.Bucket([]byte(MINT_QUOTES_BUCKET))
+	meltQuotesb := tx.Bucket([]byte(MELT_QUOTES_BUCKET))
+
+	if err := invoicesb.ForEach(func(k, v []byte) error {
+		var invoice Invoice
+		// skip invoices that can not be read instead of failing to open the wallet
+		if err := json.Unmarshal(v, &invoice); err != nil {
+			return nil
+		}
+
+		switch invoice.TransactionType {
+		case Mint:
+			state := nut04.Unpaid
+			if invoice.Paid {
+				state = nut04.Paid
+			}
+
+			mintQuote := MintQuote{
+				QuoteId:        invoice.Id,
+				Mint:           invoice.Mint,
+				Method:         cashu.BOLT11_METHOD,
+				State:          state,
+				Unit:           cashu.Sat.String(),
+				Amount:         invoice.QuoteAmount,
+				PaymentRequest: invoice.PaymentRequest,
+				CreatedAt:      invoice.CreatedAt,
+				QuoteExpiry:    invoice.QuoteExpiry,
+			}
+			jsonbytes, err := json.Marshal(&mintQuote)
+			if err != nil {
+				return fmt.Errorf("invalid mint quote: %v", err)
+			}
+			return mintQuotesb.Put([]byte(mintQuote.QuoteId), jsonbytes)
+
+		case Melt:
+			state := nut05.Unpaid
+			if invoice.Paid {
+				state = nut05.Paid
+			}
+
+			meltQuote := MeltQuote{
+				QuoteId:        invoice.Id,
+				Mint:           invoice.Mint,
+				Method:         cashu.BOLT11_METHOD,
+				State:          state,
+				Unit:           cashu.Sat.String(),
+				PaymentRequest: invoice.PaymentRequest,
+				Amount:         invoice.QuoteAmount,
+				FeeReserve:     invoice.QuoteAmount - invoice.InvoiceAmount,
+				Preimage:       invoice.Preimage,
+				SettledAt:      invoice.SettledAt,
+				QuoteExpiry:    invoice.QuoteExpiry,
+			}
+			jsonbytes, err := json.Marshal(&meltQuote)
+			if err != nil {
+				return fmt.Errorf("invalid melt quote: %v", err)
+			}
+			return meltQuotesb.Put([]byte(meltQuote.QuoteId), jsonbytes)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return tx.DeleteBucket([]byte(INVOICES_BUCKET))
+}
+
+// bucketProofsByKeyset moves the proofs, which were keyed by secret
+// in a single bucket, to a bucket for each keyset keyed by Y.
+func bucketProofsByKeyset(tx *bolt.Tx) error {
+	proofs := cashu.Proofs{}
+	if err := tx.Bucket([]byte(PROOFS_BUCKET)).ForEach(func(k, v []byte) error {
+		var proof cashu.Proof
+		if err := json.Unmarshal(v, &proof); err != nil {
+			return fmt.Errorf("invalid proof: %v", err)
+		}
+		proofs = append(proofs, proof)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.DeleteBucket([]byte(PROOFS_BUCKET)); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket([]byte(PROOFS_BUCKET)); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucketIfNotExists([]byte(PROOF_KEYSETS_BUCKET)); err != nil {
+		return err
+	}
+
+	for _, proof := range proofs {
+		if err := putProof(tx, proof); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createMintPubkeysBucket(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists([]byte(MINT_PUBKEYS_BUCKET))
+	return err
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"log"
 	"math"
 	"math/rand/v2"
 	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"strconv"
@@ -20,10 +23,12 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut04"
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
 	"github.com/elnosh/gonuts/crypto"
+	bolt "go.etcd.io/bbolt"
 )
 
 var (
-	db *BoltDB
+	db       WalletDB
+	sqliteDB *SQLiteDB
 )
 
 func TestMain(m *testing.M) {
@@ -46,6 +51,16 @@ func testMain(m *testing.M) (int, error) {
 	}
 	defer os.RemoveAll(dbpath)
 
+	sqlitepath := "./testdbsqlite"
+	if err := os.MkdirAll(sqlitepath, 0750); err != nil {
+		return 1, err
+	}
+	sqliteDB, err = InitSQLite(sqlitepath)
+	if err != nil {
+		return 1, err
+	}
+	defer os.RemoveAll(sqlitepath)
+
 	return m.Run(), nil
 }
 
@@ -97,6 +112,22 @@ func TestProofs(t *testing.T) {
 		t.Fatalf("expected '%v' proofs from db for keyset '%v' but got '%v'",
 			expectedNumProofs, keysetId1, len(proofsById))
 	}
+
+	proofsByY := db.GetKeysetProofsByY(keysetId1)
+	if len(proofsByY) != expectedNumProofs {
+		t.Fatalf("expected '%v' proofs by Y for keyset '%v' but got '%v'",
+			expectedNumProofs, keysetId1, len(proofsByY))
+	}
+	for _, dbProof := range toDBProofs(randomProofs1[numToDelete:], "") {
+		proof, ok := proofsByY[dbProof.Y]
+		if !ok || proof.Secret != dbProof.Secret {
+			t.Fatalf("expected proof with Y '%v' for keyset '%v'", dbProof.Y, keysetId1)
+		}
+	}
+
+	if err := db.DeleteProof(randomProofs1[0].Secret); !errors.Is(err, ProofNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ProofNotFound, err)
+	}
 }
 
 func TestPendingProofs(t *testing.T) {
@@ -262,6 +293,90 @@ func TestKeysets(t *testing.T) {
 	}
 }
 
+func TestKeysetCounterNotDecreased(t *testing.T) {
+	keyset := generateKeyset("http://localhost:3338")
+	if err := db.SaveKeyset(&keyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+	if err := db.IncrementKeysetCounter(keyset.Id, 10); err != nil {
+		t.Fatalf("error updating keyset counter: %v", err)
+	}
+
+	// saving a copy with an outdated counter should keep the counter
+	keyset.Active = false
+	keyset.InputFeePpk = 100
+	if err := db.SaveKeyset(&keyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+	stored := db.GetKeyset(keyset.Id)
+	if stored.Counter != 10 {
+		t.Fatalf("expected counter 10 but got %v", stored.Counter)
+	}
+	if stored.Active || stored.InputFeePpk != 100 {
+		t.Fatalf("expected keyset to be updated but got '%+v'", stored)
+	}
+
+	keyset.Counter = 15
+	if err := db.SaveKeyset(&keyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+	if counter := db.GetKeysetCounter(keyset.Id); counter != 15 {
+		t.Fatalf("expected counter 15 but got %v", counter)
+	}
+}
+
+func TestRemovedMints(t *testing.T) {
+	mint1 := "http://localhost:3338"
+	mint2 := "http://localhost:8888"
+
+	if err := db.SaveRemovedMint(mint1); err != nil {
+		t.Fatalf("error saving removed mint: %v", err)
+	}
+	if err := db.SaveRemovedMint(mint2); err != nil {
+		t.Fatalf("error saving removed mint: %v", err)
+	}
+
+	removedMints := db.GetRemovedMints()
+	if len(removedMints) != 2 {
+		t.Fatalf("expected 2 removed mints but got %v", len(removedMints))
+	}
+
+	if err := db.DeleteRemovedMint(mint1); err != nil {
+		t.Fatalf("error deleting removed mint: %v", err)
+	}
+
+	removedMints = db.GetRemovedMints()
+	if len(removedMints) != 1 {
+		t.Fatalf("expected 1 removed mint but got %v", len(removedMints))
+	}
+	if removedMints[0] != mint2 {
+		t.Fatalf("expected removed mint '%v' but got '%v'", mint2, removedMints[0])
+	}
+}
+
+func TestMintPubkeys(t *testing.T) {
+	mint1 := "http://localhost:3338"
+	mint2 := "http://localhost:8888"
+	pubkey1 := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	pubkey2 := "03a0f6e5c8be1b9ea1d3b0a6a5ef0f7dbcbe0dd4f8b0d4e1d0ed9d1c6f3c0b7e44"
+
+	if err := db.SaveMintPubkey(mint1, pubkey1); err != nil {
+		t.Fatalf("error saving mint pubkey: %v", err)
+	}
+	if err := db.SaveMintPubkey(mint2, pubkey1); err != nil {
+		t.Fatalf("error saving mint pubkey: %v", err)
+	}
+	// replaces pubkey for the same mint
+	if err := db.SaveMintPubkey(mint2, pubkey2); err != nil {
+		t.Fatalf("error saving mint pubkey: %v", err)
+	}
+
+	expected := map[string]string{mint1: pubkey1, mint2: pubkey2}
+	if pubkeys := db.GetMintPubkeys(); !reflect.DeepEqual(expected, pubkeys) {
+		t.Fatalf("expected mint pubkeys '%v' but got '%v'", expected, pubkeys)
+	}
+}
+
 func TestMintQuotes(t *testing.T) {
 	quoteId := "quoteId1"
 	mintQuote := generateMintQuote(quoteId, false)
@@ -349,6 +464,303 @@ func TestMeltQuotes(t *testing.T) {
 	}
 }
 
+func TestTransactions(t *testing.T) {
+	mints := []string{"http://localhost:3338", "http://localhost:3339"}
+	types := []TransactionType{MintTransaction, SendTransaction, ReceiveTransaction, MeltTransaction, SwapTransaction}
+
+	numTransactions := 40
+	transactions := make([]Transaction, numTransactions)
+	for i := 0; i < numTransactions; i++ {
+		transactions[i] = Transaction{
+			Id:          generateRandomString(32),
+			Type:        types[i%len(types)],
+			Mint:        mints[i%len(mints)],
+			Unit:        "sat",
+			Amount:      uint64(i + 1),
+			Fee:         1,
+			Counterpart: generateRandomString(64),
+			Balance:     uint64(i * 10),
+			CreatedAt:   int64(1000 + i),
+		}
+		if err := db.SaveTransaction(transactions[i]); err != nil {
+			t.Fatalf("error saving transaction: %v", err)
+		}
+	}
+
+	// transactions are returned from newest to oldest
+	allTransactions := db.GetTransactions(TransactionFilter{})
+	if len(allTransactions) != numTransactions {
+		t.Fatalf("expected '%v' transactions but got '%v'", numTransactions, len(allTransactions))
+	}
+	for i, transaction := range allTransactions {
+		expected := transactions[numTransactions-1-i]
+		if !reflect.DeepEqual(expected, transaction) {
+			t.Fatalf("expected transaction '%+v' but got '%+v'", expected, transaction)
+		}
+	}
+
+	tests := []struct {
+		filter      TransactionFilter
+		expectedIds []string
+	}{
+		{
+			filter:      TransactionFilter{Limit: 3},
+			expectedIds: []string{transactions[39].Id, transactions[38].Id, transactions[37].Id},
+		},
+		{
+			filter:      TransactionFilter{Offset: 3, Limit: 2},
+			expectedIds: []string{transactions[36].Id, transactions[35].Id},
+		},
+		{
+			filter:      TransactionFilter{Offset: 38},
+			expectedIds: []string{transactions[1].Id, transactions[0].Id},
+		},
+		{
+			filter:      TransactionFilter{Offset: 40},
+			expectedIds: nil,
+		},
+		{
+			filter:      TransactionFilter{Type: MeltTransaction, Limit: 2},
+			expectedIds: []string{transactions[38].Id, transactions[33].Id},
+		},
+		{
+			filter:      TransactionFilter{Type: SendTransaction, Mint: mints[1], Offset: 1},
+			expectedIds: []string{transactions[21].Id, transactions[11].Id, transactions[1].Id},
+		},
+		{
+			filter:      TransactionFilter{Since: 1010, Until: 1012},
+			expectedIds: []string{transactions[12].Id, transactions[11].Id, transactions[10].Id},
+		},
+	}
+
+	for _, test := range tests {
+		transactions := db.GetTransactions(test.filter)
+		var ids []string
+		for _, transaction := range transactions {
+			ids = append(ids, transaction.Id)
+		}
+		if !reflect.DeepEqual(test.expectedIds, ids) {
+			t.Fatalf("filter %+v: expected transactions '%v' but got '%v'", test.filter, test.expectedIds, ids)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	transaction := Transaction{
+		Id:        generateRandomString(32),
+		Type:      ReceiveTransaction,
+		Mint:      "http://localhost:3338",
+		Unit:      "sat",
+		Amount:    21,
+		Balance:   21,
+		CreatedAt: 2000,
+		Memo:      "tip from alice",
+		Labels:    []string{"tips"},
+	}
+	if err := db.SaveTransaction(transaction); err != nil {
+		t.Fatalf("error saving transaction: %v", err)
+	}
+	if err := db.AddTransactionLabels(transaction.Id, []string{"tips", "alice"}); err != nil {
+		t.Fatalf("error adding labels: %v", err)
+	}
+	if err := db.AddTransactionLabels("unknown", []string{"tips"}); !errors.Is(err, TransactionNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", TransactionNotFound, err)
+	}
+
+	transactions := db.GetTransactions(TransactionFilter{Label: "alice"})
+	if len(transactions) != 1 {
+		t.Fatalf("expected 1 transaction with label but got %v", len(transactions))
+	}
+	transaction.Labels = []string{"tips", "alice"}
+	if !reflect.DeepEqual(transaction, transactions[0]) {
+		t.Fatalf("expected transaction '%+v' but got '%+v'", transaction, transactions[0])
+	}
+	if transactions := db.GetTransactions(TransactionFilter{Label: "bob"}); len(transactions) != 0 {
+		t.Fatalf("expected no transactions with label but got %v", len(transactions))
+	}
+
+	proofs := generateRandomProofs("labelsKeysetId", 3)
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	secrets := []string{proofs[0].Secret, proofs[1].Secret}
+	if err := db.SaveProofLabel(secrets, "tips"); err != nil {
+		t.Fatalf("error saving proof labels: %v", err)
+	}
+	labels := db.GetProofLabels()
+	if labels[proofs[0].Secret] != "tips" || labels[proofs[1].Secret] != "tips" {
+		t.Fatalf("expected proofs to have label 'tips' but got '%v'", labels)
+	}
+	if _, ok := labels[proofs[2].Secret]; ok {
+		t.Fatal("expected proof without label")
+	}
+
+	if err := db.SaveProofLabel(secrets[1:], ""); err != nil {
+		t.Fatalf("error removing proof label: %v", err)
+	}
+	if err := db.DeleteProof(proofs[0].Secret); err != nil {
+		t.Fatalf("error deleting proof: %v", err)
+	}
+	labels = db.GetProofLabels()
+	for _, secret := range secrets {
+		if _, ok := labels[secret]; ok {
+			t.Fatalf("expected label of proof '%v' to be removed", secret)
+		}
+	}
+}
+
+func TestSeenYs(t *testing.T) {
+	proofs := generateRandomProofs("seenKeysetId", 2)
+	pendingProofs := generateRandomProofs("seenKeysetId", 2)
+	receivedProofs := generateRandomProofs("seenKeysetId", 2)
+	unknownProofs := generateRandomProofs("seenKeysetId", 2)
+
+	var Ys []string
+	for _, dbProof := range toDBProofs(slices.Concat(proofs, pendingProofs, receivedProofs, unknownProofs), "") {
+		Ys = append(Ys, dbProof.Y)
+	}
+
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	if err := db.AddPendingProofs(pendingProofs); err != nil {
+		t.Fatalf("error saving pending proofs: %v", err)
+	}
+	if err := db.SaveSeenYs(Ys[4:6]); err != nil {
+		t.Fatalf("error saving seen Ys: %v", err)
+	}
+
+	// proofs are still seen after they are deleted
+	for _, proof := range proofs {
+		if err := db.DeleteProof(proof.Secret); err != nil {
+			t.Fatalf("error deleting proof: %v", err)
+		}
+	}
+	if err := db.DeletePendingProofs(Ys[2:4]); err != nil {
+		t.Fatalf("error deleting pending proofs: %v", err)
+	}
+
+	seen := db.GetSeenYs(Ys)
+	slices.Sort(seen)
+	expected := slices.Clone(Ys[:6])
+	slices.Sort(expected)
+	if !reflect.DeepEqual(expected, seen) {
+		t.Fatalf("expected seen Ys '%v' but got '%v'", expected, seen)
+	}
+	if seen := db.GetSeenYs(Ys[6:]); len(seen) != 0 {
+		t.Fatalf("expected no seen Ys but got '%v'", seen)
+	}
+}
+
+func TestSchemaMigrations(t *testing.T) {
+	dbpath := t.TempDir()
+
+	// db from a wallet created before the schema was versioned
+	legacy, err := bolt.Open(filepath.Join(dbpath, "wallet.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("unexpected error opening bolt db: %v", err)
+	}
+	proof := generateRandomProofs("legacyKeysetId", 1)[0]
+	invoice := Invoice{TransactionType: Mint, Id: "legacyquote", Mint: "http://localhost:3338", QuoteAmount: 21, Paid: true}
+	if err := legacy.Update(func(tx *bolt.Tx) error {
+		proofsb, err := tx.CreateBucket([]byte(PROOFS_BUCKET))
+		if err != nil {
+			return err
+		}
+		jsonProof, _ := json.Marshal(proof)
+		if err := proofsb.Put([]byte(proof.Secret), jsonProof); err != nil {
+			return err
+		}
+
+		invoicesb, err := tx.CreateBucket([]byte(INVOICES_BUCKET))
+		if err != nil {
+			return err
+		}
+		jsonInvoice, _ := json.Marshal(invoice)
+		return invoicesb.Put([]byte("paymenthash"), jsonInvoice)
+	}); err != nil {
+		t.Fatalf("unexpected error setting up legacy db: %v", err)
+	}
+	legacy.Close()
+
+	boltdb, err := InitBolt(dbpath)
+	if err != nil {
+		t.Fatalf("unexpected error migrating db: %v", err)
+	}
+	latest := boltMigrations[len(boltMigrations)-1].version
+	if version, _ := boltdb.SchemaVersion(); version != latest {
+		t.Fatalf("expected schema version %v but got %v", latest, version)
+	}
+
+	if proofs := boltdb.GetProofs(); len(proofs) != 1 || proofs[0].Secret != proof.Secret {
+		t.Fatalf("expected proof from before migrations but got '%v'", proofs)
+	}
+	if proofs := boltdb.GetProofsByKeysetId("legacyKeysetId"); len(proofs) != 1 {
+		t.Fatalf("expected proof from before migrations in its keyset but got '%v'", proofs)
+	}
+	Y := toDBProofs(cashu.Proofs{proof}, "")[0].Y
+	if seen := boltdb.GetSeenYs([]string{Y}); len(seen) != 1 {
+		t.Fatal("expected proof from before migrations to be seen")
+	}
+	mintQuote := boltdb.GetMintQuoteById("legacyquote")
+	if mintQuote == nil || mintQuote.State != nut04.Paid || mintQuote.Amount != 21 {
+		t.Fatalf("expected paid mint quote migrated from invoice but got %+v", mintQuote)
+	}
+
+	// db migrated by a newer version should not be opened
+	if err := boltdb.bolt.Update(func(tx *bolt.Tx) error {
+		return putSchemaVersion(tx, latest+1)
+	}); err != nil {
+		t.Fatalf("unexpected error updating schema version: %v", err)
+	}
+	boltdb.Close()
+
+	if _, err := InitBolt(dbpath); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrNewerSchema, err)
+	}
+}
+
+func TestContacts(t *testing.T) {
+	contacts := []Contact{
+		{Name: "alice", PublicKey: "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"},
+		{Name: "bob", LightningAddress: "bob@localhost"},
+	}
+	for _, contact := range contacts {
+		if err := db.SaveContact(contact); err != nil {
+			t.Fatalf("error saving contact: %v", err)
+		}
+	}
+	// replaces contact with the same name
+	contacts[1].Nostr = "npub1bob"
+	if err := db.SaveContact(contacts[1]); err != nil {
+		t.Fatalf("error saving contact: %v", err)
+	}
+
+	savedContacts := db.GetContacts()
+	slices.SortFunc(savedContacts, func(a, b Contact) int { return strings.Compare(a.Name, b.Name) })
+	if !reflect.DeepEqual(contacts, savedContacts) {
+		t.Fatalf("expected contacts '%+v' but got '%+v'", contacts, savedContacts)
+	}
+
+	contact := db.GetContact("bob")
+	if contact == nil || !reflect.DeepEqual(contacts[1], *contact) {
+		t.Fatalf("expected contact '%+v' but got '%+v'", contacts[1], contact)
+	}
+	if contact := db.GetContact("carol"); contact != nil {
+		t.Fatalf("expected no contact but got '%+v'", contact)
+	}
+
+	if err := db.DeleteContact("alice"); err != nil {
+		t.Fatalf("error deleting contact: %v", err)
+	}
+	if err := db.DeleteContact("alice"); !errors.Is(err, ContactNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ContactNotFound, err)
+	}
+	if contacts := db.GetContacts(); len(contacts) != 1 {
+		t.Fatalf("expected 1 contact but got %v", len(contacts))
+	}
+}
+
 func toDBProofs(proofs cashu.Proofs, quoteId string) []DBProof {
 	dbProofs := make([]DBProof, len(proofs))
 
@@ -470,6 +882,9 @@ func generateMeltQuote(id string) MeltQuote {
 		Method:  "bolt11",
 		State:   nut05.Unpaid,
 		Amount:  21,
+
+		ChangeKeysetId: "00a2b3c4d5e6f708",
+		ChangeCounter:  42,
 	}
 }
 
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS transactions (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	id TEXT NOT NULL UNIQUE,
+	type TEXT NOT NULL,
+	mint TEXT NOT NULL,
+	unit TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	fee INTEGER NOT NULL DEFAULT 0,
+	counterpart TEXT NOT NULL DEFAULT '',
+	balance INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions(created_at);
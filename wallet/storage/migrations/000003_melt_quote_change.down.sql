@@ -0,0 +1,2 @@
+ALTER TABLE melt_quotes DROP COLUMN change_counter;
+ALTER TABLE melt_quotes DROP COLUMN change_keyset_id;
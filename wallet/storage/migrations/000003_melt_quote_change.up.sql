@@ -0,0 +1,2 @@
+ALTER TABLE melt_quotes ADD COLUMN change_keyset_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE melt_quotes ADD COLUMN change_counter INTEGER NOT NULL DEFAULT 0;
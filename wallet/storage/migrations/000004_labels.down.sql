@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS proof_labels;
+DROP INDEX IF EXISTS idx_transaction_labels_label;
+DROP TABLE IF EXISTS transaction_labels;
+ALTER TABLE transactions DROP COLUMN memo;
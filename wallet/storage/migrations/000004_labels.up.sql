@@ -0,0 +1,14 @@
+ALTER TABLE transactions ADD COLUMN memo TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS transaction_labels (
+	transaction_id TEXT NOT NULL,
+	label TEXT NOT NULL,
+	PRIMARY KEY (transaction_id, label)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_labels_label ON transaction_labels(label);
+
+CREATE TABLE IF NOT EXISTS proof_labels (
+	secret TEXT NOT NULL PRIMARY KEY,
+	label TEXT NOT NULL
+);
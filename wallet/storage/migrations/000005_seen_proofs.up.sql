@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS seen_proofs (
+	y TEXT NOT NULL PRIMARY KEY
+);
+
+INSERT OR IGNORE INTO seen_proofs (y) SELECT y FROM pending_proofs;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS contacts (
+	name TEXT NOT NULL PRIMARY KEY,
+	public_key TEXT NOT NULL DEFAULT '',
+	nostr TEXT NOT NULL DEFAULT '',
+	lightning_address TEXT NOT NULL DEFAULT ''
+);
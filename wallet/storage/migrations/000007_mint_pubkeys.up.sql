@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS mint_pubkeys (
+	mint_url TEXT NOT NULL PRIMARY KEY,
+	pubkey TEXT NOT NULL
+);
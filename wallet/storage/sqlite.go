@@ -0,0 +1,1061 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// version of the migration that adds the seen_proofs table
+const seenProofsVersion = 5
+
+type SQLiteDB struct {
+	db *sql.DB
+}
+
+func InitSQLite(path string) (*SQLiteDB, error) {
+	dbpath := filepath.Join(path, "wallet.sqlite.db")
+	db, err := sql.Open("sqlite3", dbpath)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	// migrations are read from the files embedded in the binary
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", source, fmt.Sprintf("sqlite3://%s", dbpath))
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	version, _, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return nil, err
+	}
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	sqlite := &SQLiteDB{db: db}
+	// Ys of proofs are not stored so the ones already in the
+	// wallet are added after the seen_proofs table is created
+	if version < seenProofsVersion {
+		if err := sqlite.SaveProofs(sqlite.GetProofs()); err != nil {
+			return nil, fmt.Errorf("error migrating db: %v", err)
+		}
+	}
+
+	return sqlite, nil
+}
+
+func (sqlite *SQLiteDB) Close() error {
+	return sqlite.db.Close()
+}
+
+func (sqlite *SQLiteDB) SaveMnemonicSeed(mnemonic string, seed []byte) {
+	sqlite.db.Exec(`
+	INSERT OR REPLACE INTO seed (id, seed, mnemonic) VALUES (?, ?, ?)
+	`, "id", hex.EncodeToString(seed), mnemonic)
+}
+
+func (sqlite *SQLiteDB) GetSeed() []byte {
+	var hexSeed string
+	row := sqlite.db.QueryRow("SELECT seed FROM seed WHERE id = ?", "id")
+	if err := row.Scan(&hexSeed); err != nil {
+		return nil
+	}
+
+	seed, err := hex.DecodeString(hexSeed)
+	if err != nil {
+		return nil
+	}
+	return seed
+}
+
+func (sqlite *SQLiteDB) GetMnemonic() string {
+	var mnemonic string
+	row := sqlite.db.QueryRow("SELECT mnemonic FROM seed WHERE id = ?", "id")
+	if err := row.Scan(&mnemonic); err != nil {
+		return ""
+	}
+	return mnemonic
+}
+
+// dleqColumns returns the values to store the DLEQ proof in nullable columns
+func dleqColumns(dleq *cashu.DLEQProof) (e, s, r sql.NullString) {
+	if dleq != nil {
+		e = sql.NullString{String: dleq.E, Valid: true}
+		s = sql.NullString{String: dleq.S, Valid: true}
+		r = sql.NullString{String: dleq.R, Valid: true}
+	}
+	return
+}
+
+func dleqFromColumns(e, s, r sql.NullString) *cashu.DLEQProof {
+	if !e.Valid || !s.Valid {
+		return nil
+	}
+	return &cashu.DLEQProof{E: e.String, S: s.String, R: r.String}
+}
+
+func (sqlite *SQLiteDB) SaveProofs(proofs cashu.Proofs) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+	INSERT OR REPLACE INTO proofs (secret, amount, keyset_id, c, witness, dleq_e, dleq_s, dleq_r)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		witness := sql.NullString{String: proof.Witness, Valid: len(proof.Witness) > 0}
+		e, s, r := dleqColumns(proof.DLEQ)
+		if _, err := stmt.Exec(proof.Secret, proof.Amount, proof.Id, proof.C, witness, e, s, r); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+
+	if err := saveSeenYs(tx, Ys); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveSeenYs(tx *sql.Tx, Ys []string) error {
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO seen_proofs (y) VALUES (?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, y := range Ys {
+		if _, err := stmt.Exec(y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSeenYs records the Ys of proofs that went through the wallet
+// without being stored, such as the proofs of a token received.
+// Proofs saved with SaveProofs or as pending are recorded as well.
+func (sqlite *SQLiteDB) SaveSeenYs(Ys []string) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := saveSeenYs(tx, Ys); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSeenYs returns which of the Ys passed were already seen by the wallet
+func (sqlite *SQLiteDB) GetSeenYs(Ys []string) []string {
+	seen := []string{}
+	if len(Ys) == 0 {
+		return seen
+	}
+
+	query := `SELECT y FROM seen_proofs WHERE y in (?` + strings.Repeat(",?", len(Ys)-1) + `)`
+	args := make([]any, len(Ys))
+	for i, y := range Ys {
+		args[i] = y
+	}
+
+	rows, err := sqlite.db.Query(query, args...)
+	if err != nil {
+		return seen
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var y string
+		if err := rows.Scan(&y); err != nil {
+			return []string{}
+		}
+		seen = append(seen, y)
+	}
+	return seen
+}
+
+func (sqlite *SQLiteDB) getProofs(query string, args ...any) cashu.Proofs {
+	proofs := cashu.Proofs{}
+
+	rows, err := sqlite.db.Query(query, args...)
+	if err != nil {
+		return proofs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var proof cashu.Proof
+		var witness, e, s, r sql.NullString
+
+		err := rows.Scan(
+			&proof.Secret,
+			&proof.Amount,
+			&proof.Id,
+			&proof.C,
+			&witness,
+			&e,
+			&s,
+			&r,
+		)
+		if err != nil {
+			return cashu.Proofs{}
+		}
+		proof.Witness = witness.String
+		proof.DLEQ = dleqFromColumns(e, s, r)
+
+		proofs = append(proofs, proof)
+	}
+
+	return proofs
+}
+
+// return all proofs from db
+func (sqlite *SQLiteDB) GetProofs() cashu.Proofs {
+	return sqlite.getProofs(`
+	SELECT secret, amount, keyset_id, c, witness, dleq_e, dleq_s, dleq_r FROM proofs
+	`)
+}
+
+func (sqlite *SQLiteDB) GetProofsByKeysetId(id string) cashu.Proofs {
+	return sqlite.getProofs(`
+	SELECT secret, amount, keyset_id, c, witness, dleq_e, dleq_s, dleq_r FROM proofs WHERE keyset_id = ?
+	`, id)
+}
+
+// GetKeysetProofsByY returns the proofs of the keyset keyed by their Y.
+// Proofs are stored by secret so their Y is computed here.
+func (sqlite *SQLiteDB) GetKeysetProofsByY(id string) map[string]cashu.Proof {
+	proofs := sqlite.GetProofsByKeysetId(id)
+
+	proofsByY := make(map[string]cashu.Proof, len(proofs))
+	for _, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			continue
+		}
+		proofsByY[hex.EncodeToString(Y.SerializeCompressed())] = proof
+	}
+	return proofsByY
+}
+
+func (sqlite *SQLiteDB) DeleteProof(secret string) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM proofs WHERE secret = ?", secret)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count != 1 {
+		tx.Rollback()
+		return ProofNotFound
+	}
+
+	if _, err := tx.Exec("DELETE FROM proof_labels WHERE secret = ?", secret); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveProofLabel sets the label of the proofs.
+// An empty label removes the label from the proofs.
+func (sqlite *SQLiteDB) SaveProofLabel(secrets []string, label string) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
+		if len(label) == 0 {
+			_, err = tx.Exec("DELETE FROM proof_labels WHERE secret = ?", secret)
+		} else {
+			_, err = tx.Exec("INSERT OR REPLACE INTO proof_labels (secret, label) VALUES (?, ?)", secret, label)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (sqlite *SQLiteDB) GetProofLabels() map[string]string {
+	labels := make(map[string]string)
+
+	rows, err := sqlite.db.Query("SELECT secret, label FROM proof_labels")
+	if err != nil {
+		return labels
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var secret, label string
+		if err := rows.Scan(&secret, &label); err != nil {
+			continue
+		}
+		labels[secret] = label
+	}
+	return labels
+}
+
+func (sqlite *SQLiteDB) AddPendingProofs(proofs cashu.Proofs) error {
+	return sqlite.addPendingProofs(proofs, "")
+}
+
+func (sqlite *SQLiteDB) AddPendingProofsByQuoteId(proofs cashu.Proofs, quoteId string) error {
+	return sqlite.addPendingProofs(proofs, quoteId)
+}
+
+func (sqlite *SQLiteDB) addPendingProofs(proofs cashu.Proofs, quoteId string) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+	INSERT OR REPLACE INTO pending_proofs (y, amount, keyset_id, secret, c, dleq_e, dleq_s, dleq_r, melt_quote_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	meltQuoteId := sql.NullString{String: quoteId, Valid: len(quoteId) > 0}
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+
+		e, s, r := dleqColumns(proof.DLEQ)
+		if _, err := stmt.Exec(Yhex, proof.Amount, proof.Id, proof.Secret, proof.C, e, s, r, meltQuoteId); err != nil {
+			tx.Rollback()
+			return err
+		}
+		Ys[i] = Yhex
+	}
+
+	if err := saveSeenYs(tx, Ys); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (sqlite *SQLiteDB) getPendingProofs(query string, args ...any) []DBProof {
+	proofs := []DBProof{}
+
+	rows, err := sqlite.db.Query(query, args...)
+	if err != nil {
+		return proofs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var proof DBProof
+		var e, s, r, meltQuoteId sql.NullString
+
+		err := rows.Scan(
+			&proof.Y,
+			&proof.Amount,
+			&proof.Id,
+			&proof.Secret,
+			&proof.C,
+			&e,
+			&s,
+			&r,
+			&meltQuoteId,
+		)
+		if err != nil {
+			return []DBProof{}
+		}
+		proof.DLEQ = dleqFromColumns(e, s, r)
+		proof.MeltQuoteId = meltQuoteId.String
+
+		proofs = append(proofs, proof)
+	}
+
+	return proofs
+}
+
+func (sqlite *SQLiteDB) GetPendingProofs() []DBProof {
+	return sqlite.getPendingProofs(`
+	SELECT y, amount, keyset_id, secret, c, dleq_e, dleq_s, dleq_r, melt_quote_id FROM pending_proofs
+	`)
+}
+
+func (sqlite *SQLiteDB) GetPendingProofsByQuoteId(quoteId string) []DBProof {
+	return sqlite.getPendingProofs(`
+	SELECT y, amount, keyset_id, secret, c, dleq_e, dleq_s, dleq_r, melt_quote_id
+	FROM pending_proofs WHERE melt_quote_id = ?
+	`, quoteId)
+}
+
+func (sqlite *SQLiteDB) DeletePendingProofs(Ys []string) error {
+	if len(Ys) == 0 {
+		return nil
+	}
+
+	query := `DELETE FROM pending_proofs WHERE y in (?` + strings.Repeat(",?", len(Ys)-1) + `)`
+	args := make([]any, len(Ys))
+	for i, y := range Ys {
+		args[i] = y
+	}
+
+	_, err := sqlite.db.Exec(query, args...)
+	return err
+}
+
+func (sqlite *SQLiteDB) DeletePendingProofsByQuoteId(quoteId string) error {
+	_, err := sqlite.db.Exec("DELETE FROM pending_proofs WHERE melt_quote_id = ?", quoteId)
+	return err
+}
+
+// SaveKeyset saves the keyset. If the keyset was already saved, the
+// counter is never moved back so that secrets are not derived again.
+func (sqlite *SQLiteDB) SaveKeyset(keyset *crypto.WalletKeyset) error {
+	publicKeys, err := json.Marshal(crypto.PublicKeys(keyset.PublicKeys))
+	if err != nil {
+		return fmt.Errorf("invalid keyset format: %v", err)
+	}
+
+	_, err = sqlite.db.Exec(`
+	INSERT INTO keysets (id, mint_url, unit, active, public_keys, counter, input_fee_ppk)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		mint_url = excluded.mint_url,
+		unit = excluded.unit,
+		active = excluded.active,
+		public_keys = excluded.public_keys,
+		counter = max(keysets.counter, excluded.counter),
+		input_fee_ppk = excluded.input_fee_ppk
+	`, keyset.Id, keyset.MintURL, keyset.Unit, keyset.Active, string(publicKeys), keyset.Counter, keyset.InputFeePpk)
+	if err != nil {
+		return fmt.Errorf("error saving keyset: %v", err)
+	}
+	return nil
+}
+
+func scanKeyset(row interface{ Scan(...any) error }) (*crypto.WalletKeyset, error) {
+	var keyset crypto.WalletKeyset
+	var publicKeys string
+
+	err := row.Scan(
+		&keyset.Id,
+		&keyset.MintURL,
+		&keyset.Unit,
+		&keyset.Active,
+		&publicKeys,
+		&keyset.Counter,
+		&keyset.InputFeePpk,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(crypto.PublicKeys)
+	if err := keys.UnmarshalJSON([]byte(publicKeys)); err != nil {
+		return nil, err
+	}
+	keyset.PublicKeys = keys
+
+	return &keyset, nil
+}
+
+func (sqlite *SQLiteDB) GetKeysets() crypto.KeysetsMap {
+	keysets := make(crypto.KeysetsMap)
+
+	rows, err := sqlite.db.Query(`
+	SELECT id, mint_url, unit, active, public_keys, counter, input_fee_ppk FROM keysets
+	`)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		keyset, err := scanKeyset(rows)
+		if err != nil {
+			return nil
+		}
+		keysets[keyset.MintURL] = append(keysets[keyset.MintURL], *keyset)
+	}
+
+	return keysets
+}
+
+func (sqlite *SQLiteDB) GetKeyset(keysetId string) *crypto.WalletKeyset {
+	row := sqlite.db.QueryRow(`
+	SELECT id, mint_url, unit, active, public_keys, counter, input_fee_ppk FROM keysets WHERE id = ?
+	`, keysetId)
+
+	keyset, err := scanKeyset(row)
+	if err != nil {
+		return nil
+	}
+	return keyset
+}
+
+func (sqlite *SQLiteDB) IncrementKeysetCounter(keysetId string, num uint32) error {
+	result, err := sqlite.db.Exec("UPDATE keysets SET counter = counter + ? WHERE id = ?", num, keysetId)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return errors.New("keyset does not exist")
+	}
+	return nil
+}
+
+func (sqlite *SQLiteDB) GetKeysetCounter(keysetId string) uint32 {
+	var counter uint32
+	row := sqlite.db.QueryRow("SELECT counter FROM keysets WHERE id = ?", keysetId)
+	if err := row.Scan(&counter); err != nil {
+		return 0
+	}
+	return counter
+}
+
+func (sqlite *SQLiteDB) UpdateKeysetMintURL(oldURL, newURL string) error {
+	result, err := sqlite.db.Exec("UPDATE keysets SET mint_url = ? WHERE mint_url = ?", newURL, oldURL)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return KeysetMintURLNotFound
+	}
+	return nil
+}
+
+// SaveRemovedMint marks the mint as removed. The keysets of the mint
+// are kept so that the counters are not reset if the mint is added again.
+func (sqlite *SQLiteDB) SaveRemovedMint(mintURL string) error {
+	if _, err := sqlite.db.Exec("INSERT OR IGNORE INTO removed_mints (mint_url) VALUES (?)", mintURL); err != nil {
+		return fmt.Errorf("error saving removed mint: %v", err)
+	}
+	return nil
+}
+
+func (sqlite *SQLiteDB) GetRemovedMints() []string {
+	var mints []string
+
+	rows, err := sqlite.db.Query("SELECT mint_url FROM removed_mints")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mint string
+		if err := rows.Scan(&mint); err != nil {
+			return nil
+		}
+		mints = append(mints, mint)
+	}
+
+	return mints
+}
+
+func (sqlite *SQLiteDB) DeleteRemovedMint(mintURL string) error {
+	_, err := sqlite.db.Exec("DELETE FROM removed_mints WHERE mint_url = ?", mintURL)
+	return err
+}
+
+func (sqlite *SQLiteDB) SaveMintPubkey(mintURL, pubkey string) error {
+	_, err := sqlite.db.Exec("INSERT OR REPLACE INTO mint_pubkeys (mint_url, pubkey) VALUES (?, ?)", mintURL, pubkey)
+	return err
+}
+
+func (sqlite *SQLiteDB) GetMintPubkeys() map[string]string {
+	pubkeys := make(map[string]string)
+
+	rows, err := sqlite.db.Query("SELECT mint_url, pubkey FROM mint_pubkeys")
+	if err != nil {
+		return pubkeys
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mintURL, pubkey string
+		if err := rows.Scan(&mintURL, &pubkey); err != nil {
+			return pubkeys
+		}
+		pubkeys[mintURL] = pubkey
+	}
+	return pubkeys
+}
+
+// SaveContact saves the contact, replacing the contact with the same name
+func (sqlite *SQLiteDB) SaveContact(contact Contact) error {
+	_, err := sqlite.db.Exec(`
+	INSERT OR REPLACE INTO contacts (name, public_key, nostr, lightning_address) VALUES (?, ?, ?, ?)
+	`, contact.Name, contact.PublicKey, contact.Nostr, contact.LightningAddress)
+	return err
+}
+
+func (sqlite *SQLiteDB) getContacts(query string, args ...any) []Contact {
+	contacts := []Contact{}
+
+	rows, err := sqlite.db.Query(query, args...)
+	if err != nil {
+		return contacts
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contact Contact
+		if err := rows.Scan(&contact.Name, &contact.PublicKey, &contact.Nostr, &contact.LightningAddress); err != nil {
+			return []Contact{}
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts
+}
+
+func (sqlite *SQLiteDB) GetContacts() []Contact {
+	return sqlite.getContacts("SELECT name, public_key, nostr, lightning_address FROM contacts")
+}
+
+func (sqlite *SQLiteDB) GetContact(name string) *Contact {
+	contacts := sqlite.getContacts(`
+	SELECT name, public_key, nostr, lightning_address FROM contacts WHERE name = ?
+	`, name)
+	if len(contacts) == 0 {
+		return nil
+	}
+	return &contacts[0]
+}
+
+func (sqlite *SQLiteDB) DeleteContact(name string) error {
+	result, err := sqlite.db.Exec("DELETE FROM contacts WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return ContactNotFound
+	}
+	return nil
+}
+
+func (sqlite *SQLiteDB) SaveMintQuote(quote MintQuote) error {
+	var privateKey sql.NullString
+	if quote.PrivateKey != nil {
+		privateKey = sql.NullString{String: hex.EncodeToString(quote.PrivateKey.Serialize()), Valid: true}
+	}
+
+	_, err := sqlite.db.Exec(`
+	INSERT OR REPLACE INTO mint_quotes
+	(id, mint, method, state, unit, payment_request, amount, created_at, settled_at, expiry, private_key)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		quote.QuoteId,
+		quote.Mint,
+		quote.Method,
+		quote.State.String(),
+		quote.Unit,
+		quote.PaymentRequest,
+		quote.Amount,
+		quote.CreatedAt,
+		quote.SettledAt,
+		quote.QuoteExpiry,
+		privateKey,
+	)
+	return err
+}
+
+const mintQuoteColumns = `id, mint, method, state, unit, payment_request,
+	amount, created_at, settled_at, expiry, private_key`
+
+func scanMintQuote(row interface{ Scan(...any) error }) (*MintQuote, error) {
+	var quote MintQuote
+	var state string
+	var privateKey sql.NullString
+
+	err := row.Scan(
+		&quote.QuoteId,
+		&quote.Mint,
+		&quote.Method,
+		&state,
+		&quote.Unit,
+		&quote.PaymentRequest,
+		&quote.Amount,
+		&quote.CreatedAt,
+		&quote.SettledAt,
+		&quote.QuoteExpiry,
+		&privateKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	quote.State = nut04.StringToState(state)
+
+	if privateKey.Valid {
+		keyBytes, err := hex.DecodeString(privateKey.String)
+		if err != nil {
+			return nil, err
+		}
+		quote.PrivateKey = secp256k1.PrivKeyFromBytes(keyBytes)
+	}
+
+	return &quote, nil
+}
+
+func (sqlite *SQLiteDB) GetMintQuotes() []MintQuote {
+	var mintQuotes []MintQuote
+
+	rows, err := sqlite.db.Query("SELECT " + mintQuoteColumns + " FROM mint_quotes")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		quote, err := scanMintQuote(rows)
+		if err != nil {
+			continue
+		}
+		mintQuotes = append(mintQuotes, *quote)
+	}
+
+	return mintQuotes
+}
+
+func (sqlite *SQLiteDB) GetMintQuoteById(id string) *MintQuote {
+	row := sqlite.db.QueryRow("SELECT "+mintQuoteColumns+" FROM mint_quotes WHERE id = ?", id)
+	quote, err := scanMintQuote(row)
+	if err != nil {
+		return nil
+	}
+	return quote
+}
+
+func (sqlite *SQLiteDB) SaveMeltQuote(quote MeltQuote) error {
+	_, err := sqlite.db.Exec(`
+	INSERT OR REPLACE INTO melt_quotes
+	(id, mint, method, state, unit, payment_request, amount, fee_reserve,
+	preimage, created_at, settled_at, expiry, change_keyset_id, change_counter)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		quote.QuoteId,
+		quote.Mint,
+		quote.Method,
+		quote.State.String(),
+		quote.Unit,
+		quote.PaymentRequest,
+		quote.Amount,
+		quote.FeeReserve,
+		quote.Preimage,
+		quote.CreatedAt,
+		quote.SettledAt,
+		quote.QuoteExpiry,
+		quote.ChangeKeysetId,
+		quote.ChangeCounter,
+	)
+	return err
+}
+
+const meltQuoteColumns = `id, mint, method, state, unit, payment_request,
+	amount, fee_reserve, preimage, created_at, settled_at, expiry,
+	change_keyset_id, change_counter`
+
+func scanMeltQuote(row interface{ Scan(...any) error }) (*MeltQuote, error) {
+	var quote MeltQuote
+	var state string
+	var preimage sql.NullString
+
+	err := row.Scan(
+		&quote.QuoteId,
+		&quote.Mint,
+		&quote.Method,
+		&state,
+		&quote.Unit,
+		&quote.PaymentRequest,
+		&quote.Amount,
+		&quote.FeeReserve,
+		&preimage,
+		&quote.CreatedAt,
+		&quote.SettledAt,
+		&quote.QuoteExpiry,
+		&quote.ChangeKeysetId,
+		&quote.ChangeCounter,
+	)
+	if err != nil {
+		return nil, err
+	}
+	quote.State = nut05.StringToState(state)
+	quote.Preimage = preimage.String
+
+	return &quote, nil
+}
+
+func (sqlite *SQLiteDB) GetMeltQuotes() []MeltQuote {
+	var meltQuotes []MeltQuote
+
+	rows, err := sqlite.db.Query("SELECT " + meltQuoteColumns + " FROM melt_quotes")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		quote, err := scanMeltQuote(rows)
+		if err != nil {
+			continue
+		}
+		meltQuotes = append(meltQuotes, *quote)
+	}
+
+	return meltQuotes
+}
+
+func (sqlite *SQLiteDB) GetMeltQuoteById(id string) *MeltQuote {
+	row := sqlite.db.QueryRow("SELECT "+meltQuoteColumns+" FROM melt_quotes WHERE id = ?", id)
+	quote, err := scanMeltQuote(row)
+	if err != nil {
+		return nil
+	}
+	return quote
+}
+
+func (sqlite *SQLiteDB) SaveTransaction(transaction Transaction) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO transactions
+	(id, type, mint, unit, amount, fee, counterpart, balance, created_at, memo)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		transaction.Id,
+		transaction.Type.String(),
+		transaction.Mint,
+		transaction.Unit,
+		transaction.Amount,
+		transaction.Fee,
+		transaction.Counterpart,
+		transaction.Balance,
+		transaction.CreatedAt,
+		transaction.Memo,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := addTransactionLabels(tx, transaction.Id, transaction.Labels); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddTransactionLabels adds the labels to the transaction.
+// Labels the transaction already has are not duplicated.
+func (sqlite *SQLiteDB) AddTransactionLabels(id string, labels []string) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	row := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM transactions WHERE id = ?)", id)
+	if err := row.Scan(&exists); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !exists {
+		tx.Rollback()
+		return TransactionNotFound
+	}
+
+	if err := addTransactionLabels(tx, id, labels); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func addTransactionLabels(tx *sql.Tx, id string, labels []string) error {
+	for _, label := range labels {
+		_, err := tx.Exec("INSERT OR IGNORE INTO transaction_labels (transaction_id, label) VALUES (?, ?)", id, label)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sqlite *SQLiteDB) GetTransactions(filter TransactionFilter) []Transaction {
+	query := `SELECT id, type, mint, unit, amount, fee, counterpart, balance, created_at, memo
+	FROM transactions WHERE 1 = 1`
+	var args []any
+
+	if filter.Type != 0 {
+		query += " AND type = ?"
+		args = append(args, filter.Type.String())
+	}
+	if len(filter.Mint) > 0 {
+		query += " AND mint = ?"
+		args = append(args, filter.Mint)
+	}
+	if filter.Since > 0 {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since)
+	}
+	if filter.Until > 0 {
+		query += " AND created_at <= ?"
+		args = append(args, filter.Until)
+	}
+	if len(filter.Label) > 0 {
+		query += " AND EXISTS (SELECT 1 FROM transaction_labels WHERE transaction_id = transactions.id AND label = ?)"
+		args = append(args, filter.Label)
+	}
+
+	// sqlite requires a limit to use an offset. -1 means no limit
+	limit := -1
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	query += " ORDER BY seq DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, filter.Offset)
+
+	rows, err := sqlite.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var transactions []Transaction
+	for rows.Next() {
+		var transaction Transaction
+		var txType string
+
+		err := rows.Scan(
+			&transaction.Id,
+			&txType,
+			&transaction.Mint,
+			&transaction.Unit,
+			&transaction.Amount,
+			&transaction.Fee,
+			&transaction.Counterpart,
+			&transaction.Balance,
+			&transaction.CreatedAt,
+			&transaction.Memo,
+		)
+		if err != nil {
+			continue
+		}
+		transaction.Type = StringToTransactionType(txType)
+		transactions = append(transactions, transaction)
+	}
+	// only one connection is open so labels
+	// can be read after the rows are closed
+	rows.Close()
+
+	for i, transaction := range transactions {
+		transactions[i].Labels = sqlite.getTransactionLabels(transaction.Id)
+	}
+
+	return transactions
+}
+
+func (sqlite *SQLiteDB) getTransactionLabels(id string) []string {
+	rows, err := sqlite.db.Query("SELECT label FROM transaction_labels WHERE transaction_id = ? ORDER BY rowid", id)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var labels []string
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			continue
+		}
+		labels = append(labels, label)
+	}
+	return labels
+}
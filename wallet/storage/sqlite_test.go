@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+)
+
+// TestSQLite runs the same tests used for bolt against the sqlite db
+func TestSQLite(t *testing.T) {
+	boltDB := db
+	db = sqliteDB
+	defer func() {
+		db = boltDB
+	}()
+
+	t.Run("Proofs", TestProofs)
+	t.Run("PendingProofs", TestPendingProofs)
+	t.Run("Keysets", TestKeysets)
+	t.Run("KeysetCounterNotDecreased", TestKeysetCounterNotDecreased)
+	t.Run("RemovedMints", TestRemovedMints)
+	t.Run("MintPubkeys", TestMintPubkeys)
+	t.Run("MintQuotes", TestMintQuotes)
+	t.Run("MeltQuotes", TestMeltQuotes)
+	t.Run("Transactions", TestTransactions)
+	t.Run("Labels", TestLabels)
+	t.Run("SeenYs", TestSeenYs)
+	t.Run("Contacts", TestContacts)
+	t.Run("Seed", testSeed)
+}
+
+func testSeed(t *testing.T) {
+	if seed := db.GetSeed(); len(seed) != 0 {
+		t.Fatalf("expected empty seed but got '%v'", seed)
+	}
+
+	mnemonic := "leader monkey parrot ring guide accident before fence cannon height naive bean"
+	seed := []byte("seed")
+	db.SaveMnemonicSeed(mnemonic, seed)
+
+	if string(db.GetSeed()) != string(seed) {
+		t.Fatalf("expected seed '%v' but got '%v'", seed, db.GetSeed())
+	}
+	if db.GetMnemonic() != mnemonic {
+		t.Fatalf("expected mnemonic '%v' but got '%v'", mnemonic, db.GetMnemonic())
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"encoding/json"
+	"slices"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
@@ -28,6 +29,50 @@ func (quote QuoteType) String() string {
 	}
 }
 
+type TransactionType int
+
+const (
+	MintTransaction TransactionType = iota + 1
+	SendTransaction
+	ReceiveTransaction
+	MeltTransaction
+	SwapTransaction
+)
+
+func (txType TransactionType) String() string {
+	switch txType {
+	case MintTransaction:
+		return "mint"
+	case SendTransaction:
+		return "send"
+	case ReceiveTransaction:
+		return "receive"
+	case MeltTransaction:
+		return "melt"
+	case SwapTransaction:
+		return "swap"
+	default:
+		return "unknown"
+	}
+}
+
+func StringToTransactionType(s string) TransactionType {
+	switch s {
+	case "mint":
+		return MintTransaction
+	case "send":
+		return SendTransaction
+	case "receive":
+		return ReceiveTransaction
+	case "melt":
+		return MeltTransaction
+	case "swap":
+		return SwapTransaction
+	default:
+		return 0
+	}
+}
+
 type WalletDB interface {
 	SaveMnemonicSeed(string, []byte)
 	GetSeed() []byte
@@ -36,8 +81,20 @@ type WalletDB interface {
 	SaveProofs(cashu.Proofs) error
 	GetProofs() cashu.Proofs
 	GetProofsByKeysetId(string) cashu.Proofs
+	// proofs of the keyset keyed by their Y
+	GetKeysetProofsByY(string) map[string]cashu.Proof
 	DeleteProof(string) error
 
+	// labels of proofs by their secret. The label
+	// of a proof is removed when the proof is deleted
+	SaveProofLabel(secrets []string, label string) error
+	GetProofLabels() map[string]string
+
+	// Ys of all the proofs the wallet has stored or received, including
+	// the ones already spent, to detect proofs that are received twice
+	SaveSeenYs(Ys []string) error
+	GetSeenYs(Ys []string) []string
+
 	AddPendingProofs(cashu.Proofs) error
 	AddPendingProofsByQuoteId(cashu.Proofs, string) error
 	GetPendingProofs() []DBProof
@@ -52,6 +109,20 @@ type WalletDB interface {
 	GetKeysetCounter(string) uint32
 	UpdateKeysetMintURL(oldURL, newURL string) error
 
+	SaveRemovedMint(string) error
+	GetRemovedMints() []string
+	DeleteRemovedMint(string) error
+
+	// hex encoded public keys of the mints that sign their
+	// responses, pinned the first time the wallet adds the mint
+	SaveMintPubkey(mintURL, pubkey string) error
+	GetMintPubkeys() map[string]string
+
+	SaveContact(Contact) error
+	GetContacts() []Contact
+	GetContact(name string) *Contact
+	DeleteContact(name string) error
+
 	SaveMintQuote(MintQuote) error
 	GetMintQuotes() []MintQuote
 	GetMintQuoteById(string) *MintQuote
@@ -60,6 +131,10 @@ type WalletDB interface {
 	GetMeltQuotes() []MeltQuote
 	GetMeltQuoteById(string) *MeltQuote
 
+	SaveTransaction(Transaction) error
+	GetTransactions(TransactionFilter) []Transaction
+	AddTransactionLabels(id string, labels []string) error
+
 	Close() error
 }
 
@@ -162,6 +237,72 @@ type MeltQuote struct {
 	CreatedAt      int64
 	SettledAt      int64
 	QuoteExpiry    uint64
+	// keyset and counter of the first NUT-08 blank output
+	// sent to the mint to get change for overpaid fees
+	ChangeKeysetId string
+	ChangeCounter  uint32
+}
+
+// Transaction is an entry in the history of the wallet
+type Transaction struct {
+	Id     string
+	Type   TransactionType
+	Mint   string
+	Unit   string
+	Amount uint64
+	Fee    uint64
+	// token sent or received, payment request for mint and melt
+	// or the mint the funds were moved to in a swap between mints
+	Counterpart string
+	// balance of the wallet after the transaction
+	Balance   uint64
+	CreatedAt int64
+	// memo of the token received
+	Memo   string
+	Labels []string
+}
+
+// TransactionFilter selects the transactions returned from the history.
+// Zero values match all transactions. Transactions are returned from
+// newest to oldest and Offset and Limit can be used to paginate them.
+type TransactionFilter struct {
+	Type  TransactionType
+	Mint  string
+	Since int64
+	Until int64
+	Label string
+
+	Offset int
+	Limit  int
+}
+
+func (filter TransactionFilter) matches(transaction Transaction) bool {
+	if filter.Type != 0 && transaction.Type != filter.Type {
+		return false
+	}
+	if len(filter.Mint) > 0 && transaction.Mint != filter.Mint {
+		return false
+	}
+	if filter.Since > 0 && transaction.CreatedAt < filter.Since {
+		return false
+	}
+	if filter.Until > 0 && transaction.CreatedAt > filter.Until {
+		return false
+	}
+	if len(filter.Label) > 0 && !slices.Contains(transaction.Labels, filter.Label) {
+		return false
+	}
+	return true
+}
+
+// Contact is a recipient saved by name so that it can be reused when sending
+type Contact struct {
+	Name string `json:"name"`
+	// hex public key to lock ecash sent to the contact
+	PublicKey string `json:"pubkey,omitempty"`
+	// npub or nprofile to send ecash to the contact through nostr
+	Nostr            string `json:"nostr,omitempty"`
+	LightningAddress string `json:"lightning_address,omitempty"`
 }
 
 type Invoice struct {
@@ -14,6 +14,7 @@ import (
 
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/proxy"
 	"github.com/elnosh/gonuts/wallet/client"
 	"github.com/gorilla/websocket"
 )
@@ -22,6 +23,14 @@ var (
 	ErrNUT17NotSupported = errors.New("NUT-17 Not supported")
 )
 
+var dialer = websocket.DefaultDialer
+
+// SetProxy makes websocket connections to mints go through the proxy.
+// If proxyURL is nil, connections are made directly.
+func SetProxy(proxyURL *url.URL) {
+	dialer = proxy.WebsocketDialer(proxyURL)
+}
+
 type SubscriptionManager struct {
 	wsConn *websocket.Conn
 	mu     sync.RWMutex
@@ -55,7 +64,7 @@ func NewSubscriptionManager(mint string) (*SubscriptionManager, error) {
 		scheme = "wss"
 	}
 	wsURL := scheme + "://" + mintURL.Host + mintURL.Path + "/v1/ws"
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	conn, _, err := dialer.Dial(wsURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -114,9 +123,15 @@ func (sm *SubscriptionManager) Run(errChan chan<- error) {
 			if err := json.Unmarshal(msg, &notification); err == nil {
 				subId := notification.Params.SubId
 				// if subscription exists, send notification on that channel
+				sm.mu.RLock()
 				sub, ok := sm.subs[subId]
+				sm.mu.RUnlock()
 				if ok {
-					sub.notificationChannel <- notification
+					select {
+					case sub.notificationChannel <- notification:
+					case <-sm.ctx.Done():
+						return
+					}
 					continue
 				}
 			}
@@ -289,6 +304,20 @@ func (s *Subscription) Read() (nut17.WsNotification, error) {
 	}
 }
 
+// ReadContext is like Read but returns an error if ctx is done before a notification arrives
+func (s *Subscription) ReadContext(ctx context.Context) (nut17.WsNotification, error) {
+	select {
+	case msg, ok := <-s.notificationChannel:
+		if ok {
+			return msg, nil
+		} else {
+			return nut17.WsNotification{}, errors.New("could not read from subscription. Channel got closed")
+		}
+	case <-ctx.Done():
+		return nut17.WsNotification{}, ctx.Err()
+	}
+}
+
 func (s *Subscription) SubId() string {
 	return s.subId
 }
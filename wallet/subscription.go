@@ -0,0 +1,158 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/wallet/submanager"
+)
+
+const (
+	// interval to check the state of the quote if
+	// the mint does not support websocket subscriptions
+	mintQuotePollInterval = 5 * time.Second
+	// how long to keep the subscription if quote does not have expiry
+	mintQuoteSubscriptionTimeout = time.Hour
+)
+
+type mintQuoteSubscription struct {
+	// closed when the mint notifies the quote was paid
+	paid chan struct{}
+	// closed if the subscription could not be made or was lost
+	failed chan struct{}
+}
+
+// AwaitMintPaid blocks until the invoice of the mint quote is paid or ctx is done.
+// If the mint supports NUT-17, it returns as soon as the mint notifies the wallet
+// through the websocket subscription opened in RequestMint. Otherwise it will
+// poll the mint for the state of the quote.
+func (w *Wallet) AwaitMintPaid(ctx context.Context, quoteId string) error {
+	w.subsMu.Lock()
+	sub := w.mintQuoteSubs[quoteId]
+	w.subsMu.Unlock()
+
+	var paid, subFailed <-chan struct{}
+	if sub != nil {
+		paid = sub.paid
+		subFailed = sub.failed
+	}
+
+	for {
+		quote, err := w.MintQuoteState(quoteId)
+		if err != nil {
+			return err
+		}
+		if quote.State == nut04.Paid || quote.State == nut04.Issued {
+			return nil
+		}
+
+		// without a subscription, fall back to polling the mint
+		var poll <-chan time.Time
+		if paid == nil {
+			poll = time.After(mintQuotePollInterval)
+		}
+
+		select {
+		case <-paid:
+			return nil
+		case <-subFailed:
+			paid = nil
+			subFailed = nil
+		case <-poll:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// subscribeMintQuote subscribes in the background to updates on the
+// state of the quote if the mint supports it. It is best effort,
+// AwaitMintPaid will poll the mint if the subscription fails.
+func (w *Wallet) subscribeMintQuote(mintURL string, quoteId string, expiry uint64) {
+	// do not try to connect if mint does not support it
+	capabilities, err := w.MintCapabilities(mintURL)
+	if err != nil || !capabilities.SupportsSubscription(nut17.Bolt11MintQuote) {
+		return
+	}
+
+	sub := &mintQuoteSubscription{
+		paid:   make(chan struct{}),
+		failed: make(chan struct{}),
+	}
+
+	w.subsMu.Lock()
+	if w.mintQuoteSubs == nil {
+		w.mintQuoteSubs = make(map[string]*mintQuoteSubscription)
+	}
+	w.mintQuoteSubs[quoteId] = sub
+	w.subsMu.Unlock()
+
+	deadline := time.Now().Add(mintQuoteSubscriptionTimeout)
+	if expiry > 0 {
+		deadline = time.Unix(int64(expiry), 0)
+	}
+
+	go func() {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+
+		isPaid := watchMintQuote(ctx, mintURL, quoteId)
+
+		w.subsMu.Lock()
+		delete(w.mintQuoteSubs, quoteId)
+		w.subsMu.Unlock()
+
+		if isPaid {
+			close(sub.paid)
+		} else {
+			close(sub.failed)
+		}
+	}()
+}
+
+// watchMintQuote blocks until the mint notifies that the quote was paid. It returns
+// false if the mint does not support NUT-17, the connection is lost or ctx is done.
+func watchMintQuote(ctx context.Context, mintURL string, quoteId string) bool {
+	subManager, err := submanager.NewSubscriptionManager(mintURL)
+	if err != nil {
+		return false
+	}
+	defer subManager.Close()
+
+	errChan := make(chan error, 1)
+	go subManager.Run(errChan)
+
+	subscription, err := subManager.Subscribe(nut17.Bolt11MintQuote, []string{quoteId})
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-errChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		notification, err := subscription.ReadContext(ctx)
+		if err != nil {
+			return false
+		}
+
+		var mintQuote nut04.PostMintQuoteBolt11Response
+		if err := json.Unmarshal(notification.Params.Payload, &mintQuote); err != nil {
+			continue
+		}
+		if mintQuote.State == nut04.Paid || mintQuote.State == nut04.Issued {
+			subManager.CloseSubscripton(subscription.SubId())
+			return true
+		}
+	}
+}
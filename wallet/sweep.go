@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/lnurl"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+// max number of invoices requested to the lnurl service when
+// looking for an amount that covers the fee reserve of the mint
+const maxSweepQuoteAttempts = 5
+
+// SweepPayment is the payment made from a mint in a sweep
+type SweepPayment struct {
+	Mint    string
+	QuoteId string
+	Amount  uint64
+	// lightning and input fees. For pending payments it
+	// is what was reserved since the change is not known yet
+	Fee   uint64
+	State nut05.State
+}
+
+// SweepReport has the payments made in a sweep
+type SweepReport struct {
+	Payments []SweepPayment
+	// total amount paid to the destination
+	Paid uint64
+	Fees uint64
+}
+
+// SweepAll melts the balance of the wallet to the destination, which can be a
+// BOLT11 invoice, a lightning address or a LNURL. Each mint makes at most one
+// payment. For a lightning address or LNURL, every mint with balance pays an
+// invoice for all its balance minus the fees. An invoice can only be paid once,
+// so it is paid from the mint with the largest balance and the amount of the
+// invoice should be that balance minus the fees.
+// It continues if the payment from one mint fails and returns the errors joined.
+func (w *Wallet) SweepAll(destination string) (*SweepReport, error) {
+	report := &SweepReport{}
+
+	if lnurl.IsLNURL(destination) {
+		if w.unit != cashu.Sat {
+			return nil, fmt.Errorf("%w: cannot pay lightning address from %v", cashu.ErrInvalidUnit, w.unit)
+		}
+		params, err := w.lnurlClient.GetPayParams(destination)
+		if err != nil {
+			return nil, fmt.Errorf("could not get pay params from '%v': %w", destination, err)
+		}
+
+		var errs []error
+		for mint, balance := range w.GetBalanceByMints() {
+			if balance == 0 {
+				continue
+			}
+			payment, err := w.sweepMintToLNURL(mint, params)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("mint '%v': %w", mint, err))
+				continue
+			}
+			report.add(*payment)
+		}
+		return report, errors.Join(errs...)
+	}
+
+	invoice := strings.TrimSpace(destination)
+	invoice = strings.TrimPrefix(strings.TrimPrefix(invoice, "lightning:"), "LIGHTNING:")
+	if _, err := decodepay.Decodepay(invoice); err != nil {
+		return nil, errors.New("destination is not a valid invoice, lightning address or LNURL")
+	}
+
+	var mint string
+	var mintBalance uint64
+	for mintURL, balance := range w.GetBalanceByMints() {
+		if balance > mintBalance {
+			mint = mintURL
+			mintBalance = balance
+		}
+	}
+	if mintBalance == 0 {
+		return nil, ErrInsufficientMintBalance
+	}
+
+	meltQuote, err := w.RequestMeltQuote(invoice, mint)
+	if err != nil {
+		return nil, err
+	}
+	if meltQuote.Amount+meltQuote.FeeReserve > mintBalance {
+		return nil, fmt.Errorf("%w: invoice and fee reserve are %v but largest mint balance is %v",
+			ErrInsufficientMintBalance, meltQuote.Amount+meltQuote.FeeReserve, mintBalance)
+	}
+	payment, err := w.sweepMelt(mint, meltQuote.Quote)
+	if err != nil {
+		return nil, err
+	}
+	report.add(*payment)
+	return report, nil
+}
+
+func (report *SweepReport) add(payment SweepPayment) {
+	report.Payments = append(report.Payments, payment)
+	if payment.State == nut05.Paid {
+		report.Paid += payment.Amount
+	}
+	report.Fees += payment.Fee
+}
+
+// sweepMintToLNURL pays to the lnurl an invoice for the balance of the mint minus the fees.
+// Since the fee reserve of the mint depends on the amount, it requests invoices for smaller
+// amounts until the quote for one of them can be paid with the balance.
+func (w *Wallet) sweepMintToLNURL(mintURL string, params *lnurl.PayParams) (*SweepPayment, error) {
+	mint, ok := w.getMint(mintURL)
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+	proofs := w.getProofsFromMint(mintURL)
+	inputFees := uint64(feesForProofs(proofs, &mint))
+	if proofs.Amount() <= inputFees {
+		return nil, ErrInsufficientMintBalance
+	}
+	available := proofs.Amount() - inputFees
+
+	amount := min(available, params.MaxSendable/1000)
+	for range maxSweepQuoteAttempts {
+		if amount == 0 || amount*1000 < params.MinSendable {
+			return nil, fmt.Errorf("%w: %v sats after fees is below the minimum of %v sats",
+				ErrInsufficientMintBalance, amount, params.MinSendable/1000)
+		}
+
+		invoice, err := params.RequestInvoice(amount*1000, "")
+		if err != nil {
+			return nil, err
+		}
+		meltQuote, err := w.RequestMeltQuote(invoice, mintURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if meltQuote.Amount+meltQuote.FeeReserve <= available {
+			return w.sweepMelt(mintURL, meltQuote.Quote)
+		}
+		if meltQuote.FeeReserve >= available {
+			return nil, ErrInsufficientMintBalance
+		}
+		amount = min(amount-1, available-meltQuote.FeeReserve)
+	}
+
+	return nil, errors.New("could not find an amount that covers the fee reserve of the mint")
+}
+
+func (w *Wallet) sweepMelt(mint, quoteId string) (*SweepPayment, error) {
+	balanceBefore := w.GetBalanceByMints()[mint]
+	meltResponse, err := w.Melt(quoteId)
+	if err != nil {
+		return nil, err
+	}
+	if meltResponse.State == nut05.Unpaid {
+		return nil, errors.New("mint could not pay lightning invoice")
+	}
+
+	payment := &SweepPayment{
+		Mint:    mint,
+		QuoteId: quoteId,
+		Amount:  meltResponse.Amount,
+		State:   meltResponse.State,
+	}
+	spent := balanceBefore - w.GetBalanceByMints()[mint]
+	if spent > payment.Amount {
+		payment.Fee = spent - payment.Amount
+	}
+	return payment, nil
+}
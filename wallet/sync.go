@@ -0,0 +1,164 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// unpaid mint quotes that expired longer than this are no longer checked
+const mintQuoteSyncGracePeriod = 24 * time.Hour
+
+// SyncReport has what was recovered in a sync of the wallet
+type SyncReport struct {
+	// mint quotes that had been paid and were minted
+	MintedQuotes []string
+	// amount minted from the quotes
+	Minted uint64
+	// pending melt quotes that were paid
+	MeltsPaid []string
+	// pending melt quotes that failed and whose proofs were returned to the wallet
+	MeltsFailed []string
+}
+
+// Sync checks with the mints the state of operations that might not have been
+// completed because the wallet was closed or lost connection. Mint quotes that
+// were paid are minted, pending melt quotes are settled or their proofs
+// returned to the wallet and pending proofs that were spent are removed.
+// It continues if checking one of them fails and returns the errors joined.
+func (w *Wallet) Sync() (*SyncReport, error) {
+	report := &SyncReport{}
+	var errs []error
+
+	for _, quote := range w.db.GetMintQuotes() {
+		if !needsSync(quote) {
+			continue
+		}
+		amount, err := w.syncMintQuote(quote)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mint quote '%v': %w", quote.QuoteId, err))
+			continue
+		}
+		if amount > 0 {
+			report.MintedQuotes = append(report.MintedQuotes, quote.QuoteId)
+			report.Minted += amount
+		}
+	}
+
+	for _, quoteId := range w.GetPendingMeltQuotes() {
+		quoteState, err := w.CheckMeltQuoteState(quoteId)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("melt quote '%v': %w", quoteId, err))
+			continue
+		}
+		switch quoteState.State {
+		case nut05.Paid:
+			report.MeltsPaid = append(report.MeltsPaid, quoteId)
+			if quote := w.db.GetMeltQuoteById(quoteId); quote != nil {
+				w.emit(Event{Type: MeltCompleted, Mint: quote.Mint, Amount: quote.Amount, Quote: quoteId})
+			}
+		case nut05.Unpaid:
+			report.MeltsFailed = append(report.MeltsFailed, quoteId)
+		}
+	}
+
+	// unspent pending proofs are not reclaimed because they
+	// could be part of a token that has not been redeemed yet
+	if err := w.RemoveSpentProofs(); err != nil {
+		errs = append(errs, fmt.Errorf("pending proofs: %w", err))
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// needsSync returns whether the quote could have been paid without being minted
+func needsSync(quote storage.MintQuote) bool {
+	if quote.State == nut04.Issued {
+		return false
+	}
+	if len(quote.Method) > 0 && quote.Method != cashu.BOLT11_METHOD {
+		return false
+	}
+	if quote.State == nut04.Unpaid && quote.QuoteExpiry > 0 {
+		expiry := time.Unix(int64(quote.QuoteExpiry), 0)
+		return time.Since(expiry) < mintQuoteSyncGracePeriod
+	}
+	return true
+}
+
+// syncMintQuote mints the quote if it was paid. It returns 0 if it was not
+func (w *Wallet) syncMintQuote(quote storage.MintQuote) (uint64, error) {
+	wallet := w
+	if len(quote.Unit) > 0 && quote.Unit != w.unit.String() {
+		unit, err := cashu.UnitFromString(quote.Unit)
+		if err != nil {
+			return 0, err
+		}
+		wallet, err = w.Account(unit)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	quoteState, err := wallet.MintQuoteState(quote.QuoteId)
+	if err != nil {
+		return 0, err
+	}
+	if quoteState.State != nut04.Paid {
+		return 0, nil
+	}
+	return wallet.MintTokens(quote.QuoteId)
+}
+
+// StartSync runs Sync in the background right away and then every interval
+// until the wallet is shut down. If onSync is not nil, it is called with
+// the result of each sync. It does nothing if the sync is already running.
+func (w *Wallet) StartSync(interval time.Duration, onSync func(*SyncReport, error)) {
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+	if w.stopSync != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	w.stopSync = func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			report, err := w.Sync()
+			if onSync != nil {
+				onSync(report, err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StopSync stops the background sync started with StartSync and
+// waits for a sync in progress to finish
+func (w *Wallet) StopSync() {
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+	if w.stopSync != nil {
+		w.stopSync()
+		w.stopSync = nil
+	}
+}
@@ -6,7 +6,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"math"
+	"maps"
+	"net/http"
 	"net/url"
 	"os"
 	"slices"
@@ -16,7 +17,6 @@ import (
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
-	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut03"
@@ -31,9 +31,13 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut15"
 	"github.com/elnosh/gonuts/cashu/nuts/nut20"
 	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/internal/keys"
+	"github.com/elnosh/gonuts/proxy"
 	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/lnurl"
+	"github.com/elnosh/gonuts/wallet/nostr"
 	"github.com/elnosh/gonuts/wallet/storage"
-	"github.com/tyler-smith/go-bip39"
+	"github.com/elnosh/gonuts/wallet/submanager"
 
 	decodepay "github.com/nbd-wtf/ln-decodepay"
 )
@@ -42,6 +46,11 @@ var (
 	ErrMintNotExist            = errors.New("mint does not exist")
 	ErrInsufficientMintBalance = errors.New("not enough funds in selected mint")
 	ErrQuoteNotFound           = errors.New("quote not found")
+	ErrQuoteExpired            = errors.New("quote expired")
+	ErrMissingSigners          = errors.New("wallet cannot sign locked ecash")
+	ErrOfflineSendNotPossible  = errors.New("wallet does not have proofs to send exact amount without a swap")
+	ErrTokenAlreadyReceived    = errors.New("proofs in token were already received or spent by the wallet")
+	ErrMintSwapPending         = errors.New("payment between mints is pending")
 )
 
 type Wallet struct {
@@ -53,10 +62,49 @@ type Wallet struct {
 	// key to receive locked ecash
 	privateKey *btcec.PrivateKey
 
-	// list of mints that have been trusted
-	mints map[string]walletMint
+	// key and relays to send and receive ecash through nostr
+	nostrKey    *btcec.PrivateKey
+	nostrRelays []string
 
+	// clients for the requests to mints and LNURL endpoints
+	client      *client.Client
+	lnurlClient *lnurl.Client
+
+	// list of mints that have been trusted. Use getMint, setMint
+	// and walletMints to access it since it is guarded by mintsMu
+	mints   map[string]walletMint
+	mintsMu sync.RWMutex
+
+	// features supported by the mints. Use MintCapabilities to access it
+	mintCapabilities map[string]*MintCapabilities
+	capabilitiesMu   sync.Mutex
+
+	// held while selecting proofs and using keyset counters so that
+	// concurrent operations do not spend the same proofs or reuse
+	// counters. Proofs selected are removed from the available proofs
+	// before it is released.
 	mu sync.RWMutex
+
+	splitStrategy          SplitStrategy
+	autoConsolidate        bool
+	consolidationThreshold int
+
+	// websocket subscriptions to mint quotes waiting to be paid
+	mintQuoteSubs map[string]*mintQuoteSubscription
+	subsMu        sync.Mutex
+
+	// wallets for other units. See Account
+	accounts   map[cashu.Unit]*Wallet
+	accountsMu sync.Mutex
+	// wallet the account was created from
+	parent *Wallet
+
+	// stops the background sync. See StartSync
+	stopSync func()
+	syncMu   sync.Mutex
+
+	// handlers registered with Subscribe
+	events eventHandlers
 }
 
 type walletMint struct {
@@ -65,31 +113,159 @@ type walletMint struct {
 	inactiveKeysets map[string]crypto.WalletKeyset
 }
 
+func (w *Wallet) getMint(mintURL string) (walletMint, bool) {
+	w.mintsMu.RLock()
+	defer w.mintsMu.RUnlock()
+	mint, ok := w.mints[mintURL]
+	return mint, ok
+}
+
+// setMint saves the mint in the list of trusted mints. The inactiveKeysets map
+// should not be shared with a mint previously stored to avoid concurrent writes.
+func (w *Wallet) setMint(mint walletMint) {
+	w.mintsMu.Lock()
+	defer w.mintsMu.Unlock()
+	w.mints[mint.mintURL] = mint
+}
+
+func (w *Wallet) deleteMint(mintURL string) {
+	w.mintsMu.Lock()
+	defer w.mintsMu.Unlock()
+	delete(w.mints, mintURL)
+}
+
+// walletMints returns a snapshot of the trusted mints
+func (w *Wallet) walletMints() []walletMint {
+	w.mintsMu.RLock()
+	defer w.mintsMu.RUnlock()
+	mints := make([]walletMint, 0, len(w.mints))
+	for _, mint := range w.mints {
+		mints = append(mints, mint)
+	}
+	return mints
+}
+
+// StorageType is the database used by the wallet
+type StorageType int
+
+const (
+	BoltStorage StorageType = iota
+	SQLiteStorage
+)
+
 type Config struct {
 	WalletPath     string
 	CurrentMintURL string
+	// unit of the proofs the wallet operates with. Defaults to sat if not set.
+	// Wallets for other units can be obtained with Account
+	Unit cashu.Unit
+	// defaults to bolt if not set
+	StorageType StorageType
+	// relays used to send and receive ecash through nostr
+	NostrRelays []string
+	// socks5 or http proxy through which all the connections of the
+	// wallet are made. i.e socks5://127.0.0.1:9050 to go through Tor.
+	// It is required to use mints or relays that are .onion addresses.
+	// The proxy is shared by all the wallets loaded in the process.
+	ProxyURL string
+	// amounts of the proofs the wallet asks for when
+	// receiving ecash or getting change from the mint
+	SplitStrategy SplitStrategy
+	// consolidate proofs from the mint after receiving if there are
+	// more than ConsolidationThreshold proofs of the same amount
+	AutoConsolidate bool
+	// defaults to 10 if not set
+	ConsolidationThreshold int
+	// if set, the wallet will check in the background every SyncInterval
+	// for mint quotes that were paid, pending melts and pending proofs.
+	// See Sync
+	SyncInterval time.Duration
+}
+
+type walletOptions struct {
+	httpClient *http.Client
+	db         storage.WalletDB
 }
 
-func InitStorage(path string) (storage.WalletDB, error) {
-	// bolt db atm
-	return storage.InitBolt(path)
+// Option sets optional settings when loading or restoring a wallet
+type Option func(*walletOptions)
+
+// WithHTTPClient makes the wallet use httpClient for requests to mints and
+// LNURL endpoints instead of the default client. Config.ProxyURL does not apply
+// to these requests, so a proxy should be set in the transport of httpClient.
+// Websocket connections to mints and connections to nostr relays are not affected.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(options *walletOptions) {
+		options.httpClient = httpClient
+	}
 }
 
-func LoadWallet(config Config) (*Wallet, error) {
-	path := config.WalletPath
-	if err := os.MkdirAll(path, 0700); err != nil {
+// WithStorage makes the wallet use db instead of creating the storage
+// in Config.WalletPath with Config.StorageType. The db is closed on Shutdown.
+// It only applies to LoadWallet.
+func WithStorage(db storage.WalletDB) Option {
+	return func(options *walletOptions) {
+		options.db = db
+	}
+}
+
+func applyOptions(opts []Option) walletOptions {
+	var options walletOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func InitStorage(path string, storageType StorageType) (storage.WalletDB, error) {
+	switch storageType {
+	case BoltStorage:
+		return storage.InitBolt(path)
+	case SQLiteStorage:
+		return storage.InitSQLite(path)
+	default:
+		return nil, errors.New("unknown storage type")
+	}
+}
+
+// LoadWallet loads the wallet from the storage in Config.WalletPath or creates
+// a new one if it does not exist. The current mint is added to the trusted
+// mints of the wallet if it was not already.
+func LoadWallet(config Config, opts ...Option) (*Wallet, error) {
+	options := applyOptions(opts)
+	if len(config.CurrentMintURL) == 0 {
+		return nil, errors.New("mint url is required")
+	}
+	if _, err := cashu.UnitFromString(config.Unit.String()); err != nil {
 		return nil, err
 	}
 
-	db, err := InitStorage(path)
-	if err != nil {
-		return nil, fmt.Errorf("InitStorage: %v", err)
+	if len(config.ProxyURL) > 0 {
+		proxyURL, err := proxy.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		setProxy(proxyURL)
+	}
+
+	db := options.db
+	if db == nil {
+		path := config.WalletPath
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return nil, err
+		}
+
+		var err error
+		db, err = InitStorage(path, config.StorageType)
+		if err != nil {
+			return nil, fmt.Errorf("InitStorage: %v", err)
+		}
 	}
 
 	isErr := true
 	defer func() {
-		// close db if an error happened
-		if isErr {
+		// close db if an error happened and it was created here
+		if isErr && options.db == nil {
 			db.Close()
 		}
 	}()
@@ -97,22 +273,19 @@ func LoadWallet(config Config) (*Wallet, error) {
 	seed := db.GetSeed()
 	if len(seed) == 0 {
 		// create and save new seed if none existed previously
-		entropy, err := bip39.NewEntropy(128)
+		mnemonic, err := keys.NewMnemonic()
 		if err != nil {
 			return nil, fmt.Errorf("error generating seed: %v", err)
 		}
 
-		mnemonic, err := bip39.NewMnemonic(entropy)
+		seed, err = keys.SeedFromMnemonic(mnemonic)
 		if err != nil {
 			return nil, fmt.Errorf("error generating seed: %v", err)
 		}
-
-		seed = bip39.NewSeed(mnemonic, "")
 		db.SaveMnemonicSeed(mnemonic, seed)
 	}
 
-	// TODO: what's the point of chain params here?
-	masterKey, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	masterKey, err := keys.NewMaster(seed)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +295,28 @@ func LoadWallet(config Config) (*Wallet, error) {
 		return nil, err
 	}
 
-	wallet := &Wallet{db: db, unit: cashu.Sat, masterKey: masterKey, privateKey: privateKey}
+	nostrKey, err := DeriveNostrKey(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := &Wallet{
+		db:          db,
+		unit:        config.Unit,
+		masterKey:   masterKey,
+		privateKey:  privateKey,
+		nostrKey:    nostrKey,
+		nostrRelays: config.NostrRelays,
+		client:      client.New(options.httpClient),
+		lnurlClient: lnurl.New(options.httpClient),
+
+		splitStrategy:          config.SplitStrategy,
+		autoConsolidate:        config.AutoConsolidate,
+		consolidationThreshold: config.ConsolidationThreshold,
+	}
+	if err := wallet.loadMintPubkeys(); err != nil {
+		return nil, err
+	}
 	wallet.mints, err = wallet.loadWalletMints()
 	if err != nil {
 		return nil, err
@@ -134,7 +328,7 @@ func LoadWallet(config Config) (*Wallet, error) {
 	mintURL := url.String()
 	wallet.defaultMint = mintURL
 
-	_, ok := wallet.mints[mintURL]
+	_, ok := wallet.getMint(mintURL)
 	if !ok {
 		// if mint is new, add it
 		_, err := wallet.AddMint(mintURL)
@@ -147,6 +341,13 @@ func LoadWallet(config Config) (*Wallet, error) {
 		if err != nil {
 			return nil, err
 		}
+		// move proofs from inactive keysets to the active one. This is best effort,
+		// if it fails proofs from inactive keysets are still selected first when spending
+		wallet.SwapInactiveProofs(mintURL)
+	}
+
+	if config.SyncInterval > 0 {
+		wallet.StartSync(config.SyncInterval, nil)
 	}
 
 	isErr = false
@@ -154,6 +355,7 @@ func LoadWallet(config Config) (*Wallet, error) {
 }
 
 func (w *Wallet) Shutdown() error {
+	w.StopSync()
 	return w.db.Close()
 }
 
@@ -165,20 +367,35 @@ func (w *Wallet) AddMint(mint string) (*walletMint, error) {
 	}
 	mintURL := url.String()
 
-	activeKeyset, err := GetMintActiveKeyset(mintURL, w.unit)
+	if _, err := w.fetchMintCapabilities(mintURL); err != nil {
+		return nil, err
+	}
+	if err := w.saveMintPubkey(mintURL); err != nil {
+		return nil, err
+	}
+
+	activeKeyset, err := getMintActiveKeyset(w.client, mintURL, w.unit)
 	if err != nil {
 		return nil, err
 	}
 
-	inactiveKeysets, err := GetMintInactiveKeysets(mintURL, w.unit)
+	inactiveKeysets, err := getMintInactiveKeysets(w.client, mintURL, w.unit)
 	if err != nil {
 		return nil, err
 	}
 
+	// keep counters of keysets already in the db in case
+	// the mint had been removed and is being added again
+	if keyset := w.db.GetKeyset(activeKeyset.Id); keyset != nil {
+		activeKeyset.Counter = keyset.Counter
+	}
 	if err := w.db.SaveKeyset(activeKeyset); err != nil {
 		return nil, err
 	}
 	for i, keyset := range inactiveKeysets {
+		if dbKeyset := w.db.GetKeyset(keyset.Id); dbKeyset != nil {
+			keyset.Counter = dbKeyset.Counter
+		}
 		if err := w.db.SaveKeyset(&keyset); err != nil {
 			return nil, err
 		}
@@ -186,15 +403,45 @@ func (w *Wallet) AddMint(mint string) (*walletMint, error) {
 		keyset.PublicKeys = make(map[uint64]*secp256k1.PublicKey)
 		inactiveKeysets[i] = keyset
 	}
+	if err := w.db.DeleteRemovedMint(mintURL); err != nil {
+		return nil, err
+	}
 	newWalletMint := walletMint{mintURL, *activeKeyset, inactiveKeysets}
-	w.mints[mintURL] = newWalletMint
+	w.setMint(newWalletMint)
 
 	return &newWalletMint, nil
 }
 
+// RemoveMint removes the mint from the list of mints trusted by the wallet.
+// The mint cannot be removed if it is the default mint or if the wallet
+// still has proofs from it.
+func (w *Wallet) RemoveMint(mint string) error {
+	if _, ok := w.getMint(mint); !ok {
+		return ErrMintNotExist
+	}
+	if mint == w.defaultMint {
+		return errors.New("cannot remove default mint")
+	}
+
+	balance := w.GetBalanceByMints()[mint]
+	if balance > 0 {
+		return fmt.Errorf("cannot remove mint with balance of %v", balance)
+	}
+	if len(w.pendingProofsByMint()[mint]) > 0 {
+		return errors.New("cannot remove mint with pending proofs")
+	}
+
+	if err := w.db.SaveRemovedMint(mint); err != nil {
+		return err
+	}
+	w.deleteMint(mint)
+
+	return nil
+}
+
 // GetBalance returns the total balance aggregated from all proofs
 func (w *Wallet) GetBalance() uint64 {
-	return w.db.GetProofs().Amount()
+	return w.unitProofs(w.db.GetProofs()).Amount()
 }
 
 // GetBalanceByMints returns a map of string mint
@@ -202,7 +449,7 @@ func (w *Wallet) GetBalance() uint64 {
 func (w *Wallet) GetBalanceByMints() map[string]uint64 {
 	mintsBalances := make(map[string]uint64)
 
-	for _, mint := range w.mints {
+	for _, mint := range w.walletMints() {
 		proofs := w.db.GetProofsByKeysetId(mint.activeKeyset.Id)
 		mintBalance := proofs.Amount()
 
@@ -218,7 +465,7 @@ func (w *Wallet) GetBalanceByMints() map[string]uint64 {
 }
 
 func (w *Wallet) PendingBalance() uint64 {
-	return amount(w.db.GetPendingProofs())
+	return amount(w.unitPendingProofs(w.db.GetPendingProofs()))
 }
 
 func amount(proofs []storage.DBProof) uint64 {
@@ -229,9 +476,10 @@ func amount(proofs []storage.DBProof) uint64 {
 	return totalAmount
 }
 
-// RequestMint requests a mint quote to the mint for the specified amount
+// RequestMint requests a mint quote to the mint for the specified amount.
+// Use AwaitMintPaid to wait for the invoice of the quote to be paid.
 func (w *Wallet) RequestMint(amount uint64, mint string) (*nut04.PostMintQuoteBolt11Response, error) {
-	selectedMint, ok := w.mints[mint]
+	selectedMint, ok := w.getMint(mint)
 	if !ok {
 		return nil, ErrMintNotExist
 	}
@@ -246,7 +494,7 @@ func (w *Wallet) RequestMint(amount uint64, mint string) (*nut04.PostMintQuoteBo
 		Unit:   w.unit.String(),
 		Pubkey: hex.EncodeToString(privateKey.PubKey().SerializeCompressed()),
 	}
-	mintResponse, err := client.PostMintQuoteBolt11(selectedMint.mintURL, mintRequest)
+	mintResponse, err := w.client.PostMintQuoteBolt11(selectedMint.mintURL, mintRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -271,6 +519,7 @@ func (w *Wallet) RequestMint(amount uint64, mint string) (*nut04.PostMintQuoteBo
 	if err := w.db.SaveMintQuote(quote); err != nil {
 		return nil, fmt.Errorf("error saving mint quote: %v", err)
 	}
+	w.subscribeMintQuote(selectedMint.mintURL, mintResponse.Quote, mintResponse.Expiry)
 
 	return mintResponse, nil
 }
@@ -302,7 +551,7 @@ func (w *Wallet) MintQuoteState(quoteId string) (*nut04.PostMintQuoteBolt11Respo
 		}, nil
 	}
 
-	mintQuote, err := client.GetMintQuoteState(mint, quoteId)
+	mintQuote, err := w.client.GetMintQuoteState(mint, quoteId)
 	if err != nil {
 		return nil, err
 	}
@@ -324,10 +573,32 @@ func (w *Wallet) MintQuoteState(quoteId string) (*nut04.PostMintQuoteBolt11Respo
 // If successful, it will unblind the signatures to generate proofs
 // and store the proofs in the db.
 func (w *Wallet) MintTokens(quoteId string) (uint64, error) {
+	amountMinted, err := w.mintTokens(quoteId)
+	if err != nil {
+		var mint string
+		if quote := w.db.GetMintQuoteById(quoteId); quote != nil {
+			mint = quote.Mint
+		}
+		w.emitError(err, mint, quoteId)
+		return 0, err
+	}
+
+	quote := w.db.GetMintQuoteById(quoteId)
+	w.saveTransaction(storage.MintTransaction, quote.Mint, amountMinted, 0, quote.PaymentRequest)
+	w.emit(Event{Type: MintCompleted, Mint: quote.Mint, Amount: amountMinted, Quote: quoteId})
+	return amountMinted, nil
+}
+
+// mintTokens mints the proofs for the quote without recording it
+// in the history. Used when minting is part of another operation.
+func (w *Wallet) mintTokens(quoteId string) (uint64, error) {
 	quote := w.db.GetMintQuoteById(quoteId)
 	if quote == nil {
 		return 0, ErrQuoteNotFound
 	}
+	if len(quote.Unit) > 0 && quote.Unit != w.unit.String() {
+		return 0, fmt.Errorf("%w: quote is in %v but wallet is in %v", cashu.ErrInvalidUnit, quote.Unit, w.unit)
+	}
 
 	mint := quote.Mint
 	if len(quote.Mint) == 0 {
@@ -362,6 +633,10 @@ func (w *Wallet) MintTokens(quoteId string) (uint64, error) {
 		return 0, fmt.Errorf("error creating blinded messages: %v", err)
 	}
 
+	if err := w.reserveCounter(activeKeyset.Id, len(blindedMessages)); err != nil {
+		return 0, err
+	}
+
 	var signature string
 	if quote.PrivateKey != nil {
 		sig, err := nut20.SignMintQuote(quote.PrivateKey, quoteId, blindedMessages)
@@ -377,7 +652,7 @@ func (w *Wallet) MintTokens(quoteId string) (uint64, error) {
 		Outputs:   blindedMessages,
 		Signature: signature,
 	}
-	mintResponse, err := client.PostMintBolt11(mint, postMintRequest)
+	mintResponse, err := w.client.PostMintBolt11(mint, postMintRequest)
 	if err != nil {
 		return 0, err
 	}
@@ -393,11 +668,6 @@ func (w *Wallet) MintTokens(quoteId string) (uint64, error) {
 		return 0, fmt.Errorf("error storing proofs: %v", err)
 	}
 
-	// only increase counter if mint was successful
-	if err := w.db.IncrementKeysetCounter(activeKeyset.Id, uint32(len(blindedMessages))); err != nil {
-		return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
-	}
-
 	quote.State = nut04.Issued
 	quote.SettledAt = time.Now().Unix()
 	if err = w.db.SaveMintQuote(*quote); err != nil {
@@ -409,13 +679,14 @@ func (w *Wallet) MintTokens(quoteId string) (uint64, error) {
 
 // Send will return proofs for the given amount
 func (w *Wallet) Send(amount uint64, mintURL string, includeFees bool) (cashu.Proofs, error) {
-	selectedMint, ok := w.mints[mintURL]
+	selectedMint, ok := w.getMint(mintURL)
 	if !ok {
 		return nil, ErrMintNotExist
 	}
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	balanceBefore := w.GetBalance()
 	proofsToSend, err := w.getProofsForAmount(amount, &selectedMint, includeFees)
 	if err != nil {
 		return nil, err
@@ -425,9 +696,51 @@ func (w *Wallet) Send(amount uint64, mintURL string, includeFees bool) (cashu.Pr
 		return nil, fmt.Errorf("could not save proofs to pending: %v", err)
 	}
 
+	w.saveTransaction(storage.SendTransaction, mintURL, amount,
+		w.feesPaid(balanceBefore, amount), w.serializeProofs(proofsToSend, mintURL))
+
 	return proofsToSend, nil
 }
 
+// SendOffline will return proofs for the given amount selected from the proofs
+// stored in the wallet without making any requests to the mint. It returns
+// ErrOfflineSendNotPossible if the stored proofs cannot add up to the exact amount
+// (plus fees if includeFees is true) and a swap would be needed to get change.
+func (w *Wallet) SendOffline(amount uint64, mintURL string, includeFees bool) (cashu.Proofs, error) {
+	selectedMint, ok := w.getMint(mintURL)
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	selectedProofs, err := w.selectProofsForAmount(amount, &selectedMint, includeFees)
+	if err != nil {
+		return nil, err
+	}
+
+	var fees uint64 = 0
+	if includeFees {
+		fees = uint64(feesForProofs(selectedProofs, &selectedMint))
+	}
+	if selectedProofs.Amount() != amount+fees {
+		return nil, ErrOfflineSendNotPossible
+	}
+
+	for _, proof := range selectedProofs {
+		if err := w.db.DeleteProof(proof.Secret); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.db.AddPendingProofs(selectedProofs); err != nil {
+		return nil, fmt.Errorf("could not save proofs to pending: %v", err)
+	}
+
+	w.saveTransaction(storage.SendTransaction, mintURL, amount, fees, w.serializeProofs(selectedProofs, mintURL))
+
+	return selectedProofs, nil
+}
+
 // SendToPubkey returns proofs that are locked to the passed pubkey
 func (w *Wallet) SendToPubkey(
 	amount uint64,
@@ -436,41 +749,43 @@ func (w *Wallet) SendToPubkey(
 	tags *nut11.P2PKTags,
 	includeFees bool,
 ) (cashu.Proofs, error) {
-	selectedMint, ok := w.mints[mintURL]
+	selectedMint, ok := w.getMint(mintURL)
 	if !ok {
 		return nil, ErrMintNotExist
 	}
 
 	// check first if mint supports P2PK NUT
-	mintInfo, err := client.GetMintInfo(mintURL)
+	capabilities, err := w.MintCapabilities(mintURL)
 	if err != nil {
-		return nil, fmt.Errorf("error getting info from mint: %v", err)
+		return nil, err
 	}
-	if !mintInfo.Nuts.Nut11.Supported {
+	if !capabilities.P2PK {
 		return nil, errors.New("mint does not support Pay to Public Key")
 	}
 
 	if pubkey == nil {
 		return nil, errors.New("got nil pubkey")
 	}
-	hexPubkey := hex.EncodeToString(pubkey.SerializeCompressed())
-	serializedTags := [][]string{}
+	secretBuilder := nut10.NewP2PKSecret(pubkey)
 	if tags != nil {
-		serializedTags = nut11.SerializeP2PKTags(*tags)
+		secretBuilder.WithConditions(*tags)
 	}
-	p2pkSpendingCondition := nut10.SpendingCondition{
-		Kind: nut10.P2PK,
-		Data: hexPubkey,
-		Tags: serializedTags,
+	p2pkSpendingCondition, err := secretBuilder.SpendingCondition()
+	if err != nil {
+		return nil, err
 	}
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	balanceBefore := w.GetBalance()
 	lockedProofs, err := w.swapToSend(amount, &selectedMint, &p2pkSpendingCondition, includeFees)
 	if err != nil {
 		return nil, err
 	}
 
+	w.saveTransaction(storage.SendTransaction, mintURL, amount,
+		w.feesPaid(balanceBefore, amount), w.serializeProofs(lockedProofs, mintURL))
+
 	return lockedProofs, nil
 }
 
@@ -482,17 +797,17 @@ func (w *Wallet) HTLCLockedProofs(
 	tags *nut11.P2PKTags,
 	includeFees bool,
 ) (cashu.Proofs, error) {
-	selectedMint, ok := w.mints[mintURL]
+	selectedMint, ok := w.getMint(mintURL)
 	if !ok {
 		return nil, ErrMintNotExist
 	}
 
 	// check first if mint supports HTLC NUT
-	mintInfo, err := client.GetMintInfo(mintURL)
+	capabilities, err := w.MintCapabilities(mintURL)
 	if err != nil {
-		return nil, fmt.Errorf("error getting info from mint: %v", err)
+		return nil, err
 	}
-	if !mintInfo.Nuts.Nut14.Supported {
+	if !capabilities.HTLC {
 		return nil, errors.New("mint does not support HTLCs")
 	}
 
@@ -503,29 +818,68 @@ func (w *Wallet) HTLCLockedProofs(
 	hashBytes := sha256.Sum256(preimageBytes)
 	hash := hex.EncodeToString(hashBytes[:])
 
-	serializedTags := [][]string{}
+	secretBuilder := nut10.NewHTLCSecret(hash)
 	if tags != nil {
-		serializedTags = nut11.SerializeP2PKTags(*tags)
+		secretBuilder.WithConditions(*tags)
 	}
-	htlcSpendingCondition := nut10.SpendingCondition{
-		Kind: nut10.HTLC,
-		Data: hash,
-		Tags: serializedTags,
+	htlcSpendingCondition, err := secretBuilder.SpendingCondition()
+	if err != nil {
+		return nil, err
 	}
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	balanceBefore := w.GetBalance()
 	lockedProofs, err := w.swapToSend(amount, &selectedMint, &htlcSpendingCondition, includeFees)
 	if err != nil {
 		return nil, err
 	}
 
+	w.saveTransaction(storage.SendTransaction, mintURL, amount,
+		w.feesPaid(balanceBefore, amount), w.serializeProofs(lockedProofs, mintURL))
+
 	return lockedProofs, nil
 }
 
 // Receives Cashu token. If swap is true, it will swap the funds to the configured default mint.
 // If false, it will add the proofs from the mint and add that mint to the list of trusted mints.
 func (w *Wallet) Receive(token cashu.Token, swapToTrusted bool) (uint64, error) {
+	Ys, err := proofYs(token.Proofs())
+	if err != nil {
+		w.emitError(err, token.Mint(), "")
+		return 0, err
+	}
+	if err := w.checkProofsNotSeen(Ys); err != nil {
+		w.emitError(err, token.Mint(), "")
+		return 0, err
+	}
+
+	amountReceived, err := w.receive(token, swapToTrusted)
+	if err != nil {
+		w.emitError(err, token.Mint(), "")
+		return 0, err
+	}
+	// best effort, the ecash was already received
+	w.db.SaveSeenYs(Ys)
+
+	// funds end up in the default mint if swapped to trusted
+	mint := token.Mint()
+	if swapToTrusted {
+		mint = w.defaultMint
+	}
+	w.saveReceiveTransaction(token, mint, amountReceived)
+	if w.autoConsolidate {
+		// best effort, the ecash was already received
+		w.consolidateMint(mint)
+	}
+	w.emit(Event{Type: TokenReceived, Mint: mint, Amount: amountReceived})
+	return amountReceived, nil
+}
+
+func (w *Wallet) receive(token cashu.Token, swapToTrusted bool) (uint64, error) {
+	if err := w.checkToken(token); err != nil {
+		return 0, err
+	}
 	proofsToSwap := token.Proofs()
 	tokenMint := token.Mint()
 
@@ -539,38 +893,31 @@ func (w *Wallet) Receive(token cashu.Token, swapToTrusted bool) (uint64, error)
 		return 0, errors.New("invalid DLEQ proof")
 	}
 
-	// if P2PK, add signature to Witness in the proofs
-	nut10Secret, err := nut10.DeserializeSecret(proofsToSwap[0].Secret)
-	if err == nil && nut10Secret.Kind == nut10.P2PK {
-		// check that public key in data is one wallet can sign for
-		if !nut11.CanSign(nut10Secret, w.privateKey) {
-			return 0, fmt.Errorf("cannot sign locked proofs")
-		}
-		proofsToSwap, err = nut11.AddSignatureToInputs(proofsToSwap, w.privateKey)
-		if err != nil {
-			return 0, fmt.Errorf("error signing inputs: %v", err)
-		}
+	// if P2PK, add signatures from the keys of the wallet to Witness in the proofs
+	proofsToSwap, sigAllKeys, err := w.signP2PKInputs(proofsToSwap)
+	if err != nil {
+		return 0, err
 	}
 
 	// if mint in token is already the default mint, do not swap to trusted
-	if _, ok := w.mints[tokenMint]; ok && tokenMint == w.defaultMint {
+	if _, ok := w.getMint(tokenMint); ok && tokenMint == w.defaultMint {
 		swapToTrusted = false
 	}
 
 	if swapToTrusted {
-		inactiveKeysets, err := GetMintInactiveKeysets(tokenMint, w.unit)
+		inactiveKeysets, err := getMintInactiveKeysets(w.client, tokenMint, w.unit)
 		if err != nil {
 			return 0, err
 		}
 		mint := &walletMint{mintURL: tokenMint, activeKeyset: *keyset, inactiveKeysets: inactiveKeysets}
-		amountSwapped, err := w.swapToTrusted(proofsToSwap, mint)
+		amountSwapped, err := w.swapToTrusted(proofsToSwap, mint, sigAllKeys)
 		if err != nil {
 			return 0, fmt.Errorf("error swapping token to trusted mint: %v", err)
 		}
 		return amountSwapped, nil
 	} else {
 		// only add mint if not previously trusted
-		mint, ok := w.mints[tokenMint]
+		mint, ok := w.getMint(tokenMint)
 		if !ok {
 			newMint, err := w.AddMint(tokenMint)
 			if err != nil {
@@ -579,31 +926,27 @@ func (w *Wallet) Receive(token cashu.Token, swapToTrusted bool) (uint64, error)
 			mint = *newMint
 		}
 
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
 		req, err := w.createSwapRequest(proofsToSwap, &mint)
 		if err != nil {
 			return 0, fmt.Errorf("could not create swap request: %v", err)
 		}
 
-		//if P2PK locked ecash has `SIG_ALL` flag, sign outputs
-		if nut10Secret.Kind == nut10.P2PK && nut11.IsSigAll(nut10Secret) {
-			req.outputs, err = nut11.AddSignatureToOutputs(req.outputs, w.privateKey)
+		//if P2PK locked ecash has `SIG_ALL` flag, sign inputs and outputs
+		if len(sigAllKeys) > 0 {
+			req.inputs, err = nut11.AddSigAllSignatures(req.inputs, req.outputs, sigAllKeys)
 			if err != nil {
-				return 0, fmt.Errorf("error signing outputs: %v", err)
+				return 0, fmt.Errorf("error signing inputs and outputs: %v", err)
 			}
 		}
 
-		newProofs, err := swap(tokenMint, req)
+		newProofs, err := w.swap(tokenMint, req)
 		if err != nil {
 			return 0, fmt.Errorf("could not swap proofs: %v", err)
 		}
 
-		w.mu.Lock()
-		defer w.mu.Unlock()
-
-		if err = w.db.IncrementKeysetCounter(req.keyset.Id, uint32(len(req.outputs))); err != nil {
-			return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
-		}
-
 		if err := w.db.SaveProofs(newProofs); err != nil {
 			return 0, fmt.Errorf("error storing proofs: %v", err)
 		}
@@ -615,6 +958,32 @@ func (w *Wallet) Receive(token cashu.Token, swapToTrusted bool) (uint64, error)
 // locked ecash. If successful, it will make a swap and store the new proofs.
 // It will add the mint in the token to the list of trusted mints.
 func (w *Wallet) ReceiveHTLC(token cashu.Token, preimage string) (uint64, error) {
+	Ys, err := proofYs(token.Proofs())
+	if err != nil {
+		w.emitError(err, token.Mint(), "")
+		return 0, err
+	}
+	if err := w.checkProofsNotSeen(Ys); err != nil {
+		w.emitError(err, token.Mint(), "")
+		return 0, err
+	}
+
+	amountReceived, err := w.receiveHTLC(token, preimage)
+	if err != nil {
+		w.emitError(err, token.Mint(), "")
+		return 0, err
+	}
+	w.db.SaveSeenYs(Ys)
+
+	w.saveReceiveTransaction(token, token.Mint(), amountReceived)
+	w.emit(Event{Type: TokenReceived, Mint: token.Mint(), Amount: amountReceived})
+	return amountReceived, nil
+}
+
+func (w *Wallet) receiveHTLC(token cashu.Token, preimage string) (uint64, error) {
+	if err := w.checkToken(token); err != nil {
+		return 0, err
+	}
 	proofs := token.Proofs()
 	tokenMint := token.Mint()
 
@@ -637,7 +1006,7 @@ func (w *Wallet) ReceiveHTLC(token cashu.Token, preimage string) (uint64, error)
 		}
 
 		// only add mint if not previously trusted
-		mint, ok := w.mints[tokenMint]
+		mint, ok := w.getMint(tokenMint)
 		if !ok {
 			newMint, err := w.AddMint(tokenMint)
 			if err != nil {
@@ -651,24 +1020,19 @@ func (w *Wallet) ReceiveHTLC(token cashu.Token, preimage string) (uint64, error)
 			return 0, fmt.Errorf("could not create swap request: %v", err)
 		}
 
-		//if `SIG_ALL` flag, sign outputs
+		//if `SIG_ALL` flag, sign inputs and outputs
 		if nut11.IsSigAll(nut10Secret) {
-			req.outputs, err = nut14.AddWitnessHTLCToOutputs(req.outputs, preimage, w.privateKey)
+			req.inputs, err = nut14.AddSigAllWitnessHTLC(req.inputs, req.outputs, preimage, w.privateKey)
 			if err != nil {
-				return 0, fmt.Errorf("could not add HTLC witness to outputs: %v", err)
+				return 0, fmt.Errorf("could not add HTLC witness: %v", err)
 			}
 		}
 
-		newProofs, err := swap(tokenMint, req)
+		newProofs, err := w.swap(tokenMint, req)
 		if err != nil {
 			return 0, fmt.Errorf("could not swap proofs: %v", err)
 		}
 
-		err = w.db.IncrementKeysetCounter(req.keyset.Id, uint32(len(req.outputs)))
-		if err != nil {
-			return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
-		}
-
 		if err := w.db.SaveProofs(newProofs); err != nil {
 			return 0, fmt.Errorf("error storing proofs: %v", err)
 		}
@@ -678,6 +1042,53 @@ func (w *Wallet) ReceiveHTLC(token cashu.Token, preimage string) (uint64, error)
 	return 0, errors.New("ecash does not have an HTLC spending condition")
 }
 
+func proofYs(proofs cashu.Proofs) ([]string, error) {
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof secret: %v", err)
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+	return Ys, nil
+}
+
+// checkProofsNotSeen detects locally, before calling the mint, a token that was
+// already received or that has proofs the wallet already spent. Proofs pending
+// from a send can still be received back to cancel it.
+func (w *Wallet) checkProofsNotSeen(Ys []string) error {
+	seen := w.db.GetSeenYs(Ys)
+	if len(seen) == 0 {
+		return nil
+	}
+
+	sent := make(map[string]bool)
+	for _, proof := range w.db.GetPendingProofs() {
+		if len(proof.MeltQuoteId) == 0 {
+			sent[proof.Y] = true
+		}
+	}
+	for _, Y := range seen {
+		if !sent[Y] {
+			return ErrTokenAlreadyReceived
+		}
+	}
+	return nil
+}
+
+// saveReceiveTransaction records the token received in the history.
+// Fees are what was lost from the token amount in the swap.
+func (w *Wallet) saveReceiveTransaction(token cashu.Token, mint string, amountReceived uint64) {
+	var fee uint64
+	if tokenAmount := token.Amount(); tokenAmount > amountReceived {
+		fee = tokenAmount - amountReceived
+	}
+	serializedToken, _ := token.Serialize()
+	memo := cashu.GetTokenInfo(token).Memo
+	w.saveTransactionWithMemo(storage.ReceiveTransaction, mint, amountReceived, fee, serializedToken, memo)
+}
+
 type swapRequestPayload struct {
 	inputs  cashu.Proofs
 	outputs cashu.BlindedMessages
@@ -687,6 +1098,8 @@ type swapRequestPayload struct {
 	keyset *crypto.WalletKeyset
 }
 
+// createSwapRequest creates the outputs to swap the proofs for and reserves
+// the counters used for them. w.mu should be held while calling this.
 func (w *Wallet) createSwapRequest(proofs cashu.Proofs, mint *walletMint) (swapRequestPayload, error) {
 	keysetCounter := w.counterForKeyset(mint.activeKeyset.Id)
 
@@ -696,6 +1109,9 @@ func (w *Wallet) createSwapRequest(proofs cashu.Proofs, mint *walletMint) (swapR
 	if err != nil {
 		return swapRequestPayload{}, fmt.Errorf("createBlindedMessages: %v", err)
 	}
+	if err := w.reserveCounter(mint.activeKeyset.Id, len(outputs)); err != nil {
+		return swapRequestPayload{}, err
+	}
 
 	return swapRequestPayload{
 		inputs:  proofs,
@@ -706,12 +1122,12 @@ func (w *Wallet) createSwapRequest(proofs cashu.Proofs, mint *walletMint) (swapR
 	}, nil
 }
 
-func swap(mint string, swapRequest swapRequestPayload) (cashu.Proofs, error) {
+func (w *Wallet) swap(mint string, swapRequest swapRequestPayload) (cashu.Proofs, error) {
 	request := nut03.PostSwapRequest{
 		Inputs:  swapRequest.inputs,
 		Outputs: swapRequest.outputs,
 	}
-	swapResponse, err := client.PostSwap(mint, request)
+	swapResponse, err := w.client.PostSwap(mint, request)
 	if err != nil {
 		return nil, err
 	}
@@ -731,31 +1147,70 @@ func swap(mint string, swapRequest swapRequestPayload) (cashu.Proofs, error) {
 	return proofs, nil
 }
 
+// SwapInactiveProofs swaps the proofs the wallet has from inactive keysets
+// of the mint for proofs from the active keyset. It returns the amount swapped.
+func (w *Wallet) SwapInactiveProofs(mintURL string) (uint64, error) {
+	if _, ok := w.getMint(mintURL); !ok {
+		return 0, ErrMintNotExist
+	}
+
+	// get latest keysets from mint in case active keyset has changed
+	if _, err := w.getActiveKeyset(mintURL); err != nil {
+		return 0, err
+	}
+	mint, _ := w.getMint(mintURL)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	proofs := w.getInactiveProofsByMint(mintURL)
+	if len(proofs) == 0 {
+		return 0, nil
+	}
+	// not worth swapping if fees would take all the amount
+	if proofs.Amount() <= uint64(feesForProofs(proofs, &mint)) {
+		return 0, nil
+	}
+
+	req, err := w.createSwapRequest(proofs, &mint)
+	if err != nil {
+		return 0, fmt.Errorf("could not create swap request: %v", err)
+	}
+	newProofs, err := w.swap(mintURL, req)
+	if err != nil {
+		return 0, fmt.Errorf("could not swap proofs: %v", err)
+	}
+	for _, proof := range proofs {
+		if err := w.db.DeleteProof(proof.Secret); err != nil {
+			return 0, err
+		}
+	}
+	if err := w.db.SaveProofs(newProofs); err != nil {
+		return 0, fmt.Errorf("error storing proofs: %v", err)
+	}
+
+	amountSwapped := newProofs.Amount()
+	w.saveTransaction(storage.SwapTransaction, mintURL, amountSwapped, proofs.Amount()-amountSwapped, "")
+
+	return amountSwapped, nil
+}
+
 // swapToTrusted will swap the proofs from mint
-// to the wallet's configured default mint
-func (w *Wallet) swapToTrusted(proofs cashu.Proofs, mint *walletMint) (uint64, error) {
+// to the wallet's configured default mint. sigAllKeys are
+// the keys that sign the outputs of proofs locked with SIG_ALL
+func (w *Wallet) swapToTrusted(proofs cashu.Proofs, mint *walletMint, sigAllKeys []*btcec.PrivateKey) (uint64, error) {
 	proofsToSwap := proofs
 
 	// if proofs are P2PK locked and sig all, add signatures to swap them first and then melt
-	nut10Secret, err := nut10.DeserializeSecret(proofs[0].Secret)
-	if err == nil && nut10Secret.Kind == nut10.P2PK && nut11.IsSigAll(nut10Secret) {
-		req, err := w.createSwapRequest(proofs, mint)
+	if len(sigAllKeys) > 0 {
+		newProofs, err := w.swapSigAll(proofs, mint, sigAllKeys)
 		if err != nil {
-			return 0, fmt.Errorf("could not create swap request: %v", err)
-		}
-		req.outputs, err = nut11.AddSignatureToOutputs(req.outputs, w.privateKey)
-		if err != nil {
-			return 0, fmt.Errorf("error signing outputs: %v", err)
-		}
-
-		newProofs, err := swap(mint.mintURL, req)
-		if err != nil {
-			return 0, fmt.Errorf("could not swap proofs: %v", err)
+			return 0, err
 		}
 		proofsToSwap = newProofs
 	}
 
-	defaultMint := w.mints[w.defaultMint]
+	defaultMint, _ := w.getMint(w.defaultMint)
 	amountSwapped, err := w.swapProofs(proofsToSwap, mint, &defaultMint)
 	if err != nil {
 		return 0, err
@@ -764,9 +1219,31 @@ func (w *Wallet) swapToTrusted(proofs cashu.Proofs, mint *walletMint) (uint64, e
 	return amountSwapped, nil
 }
 
+// swapSigAll swaps the P2PK locked proofs with SIG_ALL flag
+// adding the signatures from the keys on the inputs and outputs
+func (w *Wallet) swapSigAll(proofs cashu.Proofs, mint *walletMint, keys []*btcec.PrivateKey) (cashu.Proofs, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, err := w.createSwapRequest(proofs, mint)
+	if err != nil {
+		return nil, fmt.Errorf("could not create swap request: %v", err)
+	}
+	req.inputs, err = nut11.AddSigAllSignatures(req.inputs, req.outputs, keys)
+	if err != nil {
+		return nil, fmt.Errorf("error signing inputs and outputs: %v", err)
+	}
+
+	newProofs, err := w.swap(mint.mintURL, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not swap proofs: %v", err)
+	}
+	return newProofs, nil
+}
+
 // RequestMeltQuote will request a melt quote to the mint for the specified request
 func (w *Wallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBolt11Response, error) {
-	_, ok := w.mints[mint]
+	_, ok := w.getMint(mint)
 	if !ok {
 		return nil, ErrMintNotExist
 	}
@@ -777,7 +1254,7 @@ func (w *Wallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBol
 	}
 
 	meltRequest := nut05.PostMeltQuoteBolt11Request{Request: request, Unit: w.unit.String()}
-	meltQuoteResponse, err := client.PostMeltQuoteBolt11(mint, meltRequest)
+	meltQuoteResponse, err := w.client.PostMeltQuoteBolt11(mint, meltRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -801,13 +1278,34 @@ func (w *Wallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBol
 	return meltQuoteResponse, nil
 }
 
+// RequestLNURLMeltQuote resolves the lightning address or LNURL to an invoice
+// for the amount in sats and requests a melt quote to the mint to pay it.
+// The comment is sent to the receiver if it is not empty.
+func (w *Wallet) RequestLNURLMeltQuote(
+	address string,
+	amount uint64,
+	comment string,
+	mint string,
+) (*nut05.PostMeltQuoteBolt11Response, error) {
+	if _, ok := w.getMint(mint); !ok {
+		return nil, ErrMintNotExist
+	}
+
+	invoice, err := w.lnurlClient.GetInvoice(address, amount, comment)
+	if err != nil {
+		return nil, fmt.Errorf("could not get invoice from '%v': %w", address, err)
+	}
+
+	return w.RequestMeltQuote(invoice, mint)
+}
+
 func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
 	quote := w.db.GetMeltQuoteById(quoteId)
 	if quote == nil {
 		return nil, ErrQuoteNotFound
 	}
 
-	quoteStateResponse, err := client.GetMeltQuoteState(quote.Mint, quoteId)
+	quoteStateResponse, err := w.client.GetMeltQuoteState(quote.Mint, quoteId)
 	if err != nil {
 		return nil, err
 	}
@@ -821,19 +1319,14 @@ func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11
 				return nil, err
 			}
 
-			pendingProofs := w.db.GetPendingProofsByQuoteId(quoteId)
-			var keysetId string
-			if len(pendingProofs) > 0 {
-				keysetId = pendingProofs[0].Id
-			}
 			if err := w.db.DeletePendingProofsByQuoteId(quoteId); err != nil {
 				return nil, fmt.Errorf("error removing pending proofs: %v", err)
 			}
-			change := len(quoteStateResponse.Change)
-			// increment the counter if there was change from this quote
-			if change > 0 {
-				if err := w.db.IncrementKeysetCounter(keysetId, uint32(change)); err != nil {
-					return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
+			// the melt was pending when the mint returned the response so
+			// the change for overpaid fees has not been stored yet
+			if len(quoteStateResponse.Change) > 0 {
+				if err := w.saveMeltChange(quote, quoteStateResponse.Change); err != nil {
+					return nil, err
 				}
 			}
 		} else if quoteStateResponse.State == nut05.Unpaid {
@@ -875,6 +1368,23 @@ func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11
 // Melt will melt proofs by requesting the mint to pay the
 // payment request from the melt quote passed
 func (w *Wallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	meltResponse, err := w.melt(quoteId)
+	var mint string
+	var amount uint64
+	if quote := w.db.GetMeltQuoteById(quoteId); quote != nil {
+		mint, amount = quote.Mint, quote.Amount
+	}
+	if err != nil {
+		w.emitError(err, mint, quoteId)
+		return nil, err
+	}
+	if meltResponse.State == nut05.Paid {
+		w.emit(Event{Type: MeltCompleted, Mint: mint, Amount: amount, Quote: quoteId})
+	}
+	return meltResponse, nil
+}
+
+func (w *Wallet) melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
 	quote := w.db.GetMeltQuoteById(quoteId)
 	if quote == nil {
 		return nil, ErrQuoteNotFound
@@ -896,41 +1406,23 @@ func (w *Wallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error
 		}
 	}
 
-	mint := w.mints[quote.Mint]
+	mint, _ := w.getMint(quote.Mint)
 
-	amountNeeded := quote.Amount + quote.FeeReserve
-	proofs, err := w.getProofsForAmount(amountNeeded, &mint, true)
+	proofs, activeKeyset, blankOutputs, err := w.prepareMelt(quote, &mint)
 	if err != nil {
 		return nil, err
 	}
-
-	// set proofs to pending
-	if err := w.db.AddPendingProofsByQuoteId(proofs, quote.QuoteId); err != nil {
-		return nil, fmt.Errorf("error saving pending proofs: %v", err)
-	}
-
-	activeKeyset, err := w.getActiveKeyset(mint.mintURL)
-	if err != nil {
-		return nil, fmt.Errorf("error getting active sat keyset: %v", err)
-	}
-	counter := w.counterForKeyset(activeKeyset.Id)
-
-	// NUT-08 include blank outputs in request for overpaid lightning fees
-	numBlankOutputs := calculateBlankOutputs(quote.FeeReserve)
-	split := make([]uint64, numBlankOutputs)
-	outputs, outputsSecrets, outputsRs, err := w.createBlindedMessages(split, activeKeyset.Id, &counter)
-	if err != nil {
-		return nil, fmt.Errorf("error generating blinded messages for change: %v", err)
-	}
+	outputs, outputsSecrets, outputsRs := blankOutputs.outputs, blankOutputs.secrets, blankOutputs.rs
+	defer crypto.ZeroPrivateKeys(outputsRs...)
 
 	meltBolt11Request := nut05.PostMeltBolt11Request{
 		Quote:   quote.QuoteId,
 		Inputs:  proofs,
 		Outputs: outputs,
 	}
-	meltBolt11Response, err := client.PostMeltBolt11(mint.mintURL, meltBolt11Request)
+	meltBolt11Response, err := w.client.PostMeltBolt11(mint.mintURL, meltBolt11Request)
 	if err != nil {
-		if cashuErr, ok := err.(cashu.Error); ok && cashuErr.Code == cashu.LightningPaymentErrCode {
+		if errors.Is(err, cashu.LightningPaymentFailed) {
 			// only remove proofs from pending and save them for use
 			// if got specific error that payment failed
 			if err := w.db.SaveProofs(proofs); err != nil {
@@ -975,6 +1467,7 @@ func (w *Wallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error
 			return nil, err
 		}
 
+		var changeAmount uint64
 		change := len(meltBolt11Response.Change)
 		// if mint provided blind signtures for any overpaid lightning fees:
 		// - unblind them and save the proofs in the db
@@ -993,14 +1486,112 @@ func (w *Wallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error
 			if err := w.db.SaveProofs(changeProofs); err != nil {
 				return nil, fmt.Errorf("error storing change proofs: %v", err)
 			}
-			if err := w.db.IncrementKeysetCounter(activeKeyset.Id, uint32(change)); err != nil {
-				return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
-			}
+			changeAmount = changeProofs.Amount()
 		}
+
+		fee := proofs.Amount() - quote.Amount - changeAmount
+		w.saveTransaction(storage.MeltTransaction, quote.Mint, quote.Amount, fee, quote.PaymentRequest)
 	}
 	return meltBolt11Response, err
 }
 
+type blankOutputs struct {
+	outputs cashu.BlindedMessages
+	secrets []string
+	rs      []*secp256k1.PrivateKey
+}
+
+// prepareMelt selects the proofs for the melt quote and moves them to pending. It also
+// creates the NUT-08 blank outputs for overpaid lightning fees. The counter is incremented
+// by all the blank outputs since the lock is not held while the payment is in flight and
+// other operations could otherwise reuse them.
+func (w *Wallet) prepareMelt(
+	quote *storage.MeltQuote,
+	mint *walletMint,
+) (cashu.Proofs, *crypto.WalletKeyset, blankOutputs, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	amountNeeded := quote.Amount + quote.FeeReserve
+	proofs, err := w.getProofsForAmount(amountNeeded, mint, true)
+	if err != nil {
+		return nil, nil, blankOutputs{}, err
+	}
+
+	// set proofs to pending
+	if err := w.db.AddPendingProofsByQuoteId(proofs, quote.QuoteId); err != nil {
+		return nil, nil, blankOutputs{}, fmt.Errorf("error saving pending proofs: %v", err)
+	}
+
+	activeKeyset, err := w.getActiveKeyset(mint.mintURL)
+	if err != nil {
+		return nil, nil, blankOutputs{}, fmt.Errorf("error getting active sat keyset: %v", err)
+	}
+	counter := w.counterForKeyset(activeKeyset.Id)
+
+	// keep where the blank outputs start so that the change can be
+	// recovered if the payment is pending and settles later
+	quote.ChangeKeysetId = activeKeyset.Id
+	quote.ChangeCounter = counter
+	if err := w.db.SaveMeltQuote(*quote); err != nil {
+		return nil, nil, blankOutputs{}, fmt.Errorf("error updating melt quote: %v", err)
+	}
+
+	// NUT-08 include blank outputs in request for overpaid lightning fees
+	numBlankOutputs := cashu.BlankOutputsCount(quote.FeeReserve)
+	split := make([]uint64, numBlankOutputs)
+	outputs, secrets, rs, err := w.createBlindedMessages(split, activeKeyset.Id, &counter)
+	if err != nil {
+		return nil, nil, blankOutputs{}, fmt.Errorf("error generating blinded messages for change: %v", err)
+	}
+	if err := w.reserveCounter(activeKeyset.Id, numBlankOutputs); err != nil {
+		return nil, nil, blankOutputs{}, err
+	}
+
+	return proofs, activeKeyset, blankOutputs{outputs, secrets, rs}, nil
+}
+
+// saveMeltChange unblinds the signatures the mint returned for the
+// blank outputs of the melt quote and stores the change proofs
+func (w *Wallet) saveMeltChange(quote *storage.MeltQuote, change cashu.BlindedSignatures) error {
+	// blank outputs were not stored for the quote
+	if len(quote.ChangeKeysetId) == 0 {
+		return nil
+	}
+	keyset := w.db.GetKeyset(quote.ChangeKeysetId)
+	if keyset == nil {
+		return fmt.Errorf("keyset '%v' of change not found", quote.ChangeKeysetId)
+	}
+
+	numBlankOutputs := cashu.BlankOutputsCount(quote.FeeReserve)
+	if len(change) > numBlankOutputs {
+		return errors.New("mint returned more change than blank outputs sent")
+	}
+
+	// derive again the blank outputs that were sent in the melt request
+	counter := quote.ChangeCounter
+	outputs, secrets, rs, err := w.createBlindedMessages(make([]uint64, numBlankOutputs), keyset.Id, &counter)
+	if err != nil {
+		return fmt.Errorf("error generating blinded messages for change: %v", err)
+	}
+	defer crypto.ZeroPrivateKeys(rs...)
+
+	changeProofs, err := constructProofs(
+		change,
+		outputs[:len(change)],
+		secrets[:len(change)],
+		rs[:len(change)],
+		keyset,
+	)
+	if err != nil {
+		return fmt.Errorf("error unblinding signature from change: %v", err)
+	}
+	if err := w.db.SaveProofs(changeProofs); err != nil {
+		return fmt.Errorf("error storing change proofs: %v", err)
+	}
+	return nil
+}
+
 // MultiMintPayment tries an MPP according to NUT-15. The split is a map where the
 // key is the mint and the uint64 is the amount in msat.
 func (w *Wallet) MultiMintPayment(request string, split map[string]uint64) ([]nut05.PostMeltQuoteBolt11Response, error) {
@@ -1021,16 +1612,16 @@ func (w *Wallet) MultiMintPayment(request string, split map[string]uint64) ([]nu
 	// - sufficient funds in each specified mint
 	// - sum of split amounts equals invoice amount
 	for mint, amountMsat := range split {
-		_, ok := w.mints[mint]
+		_, ok := w.getMint(mint)
 		if !ok {
 			return nil, ErrMintNotExist
 		}
 
-		supported, err := nut15.IsMppSupported(mint, w.unit)
+		capabilities, err := w.MintCapabilities(mint)
 		if err != nil {
 			return nil, err
 		}
-		if !supported {
+		if !capabilities.MultiPathPayments {
 			return nil, fmt.Errorf("mint '%v' does not support multimint payments", mint)
 		}
 
@@ -1065,7 +1656,7 @@ func (w *Wallet) MultiMintPayment(request string, split map[string]uint64) ([]nu
 					Unit:    w.unit.String(),
 					Options: map[string]nut05.MppOption{"mpp": {AmountMsat: amount}},
 				}
-				meltQuoteResponse, err := client.PostMeltQuoteBolt11(mint, meltRequest)
+				meltQuoteResponse, err := w.client.PostMeltQuoteBolt11(mint, meltRequest)
 				if err != nil {
 					results[j] = result{response: nil, err: err}
 					return
@@ -1126,11 +1717,63 @@ func (w *Wallet) MultiMintPayment(request string, split map[string]uint64) ([]nu
 	return meltQuoteResponses, nil
 }
 
+// SwapMints moves amount from one mint to another. It requests a mint quote
+// for amount at toMint and pays its invoice with a melt at fromMint, so the
+// fee reserve of the melt is paid on top of amount and any overpaid fees
+// come back as change. It returns the amount minted at toMint.
+//
+// Both quotes are stored, so a swap that does not complete can be recovered
+// with Sync. If the payment is still pending, the error is ErrMintSwapPending.
+// If the invoice was paid but minting failed, it can be retried with MintTokens.
+func (w *Wallet) SwapMints(fromMint, toMint string, amount uint64) (uint64, error) {
+	if _, ok := w.getMint(fromMint); !ok {
+		return 0, ErrMintNotExist
+	}
+	if _, ok := w.getMint(toMint); !ok {
+		return 0, ErrMintNotExist
+	}
+	if fromMint == toMint {
+		return 0, errors.New("mints to swap between need to be different")
+	}
+
+	mintQuote, err := w.RequestMint(amount, toMint)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting mint quote: %v", err)
+	}
+	meltQuote, err := w.RequestMeltQuote(mintQuote.Request, fromMint)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting melt quote: %w", err)
+	}
+	if w.GetBalanceByMints()[fromMint] < meltQuote.Amount+meltQuote.FeeReserve {
+		return 0, ErrInsufficientMintBalance
+	}
+
+	// melt keeps the proofs as pending or gives them back
+	// to the wallet if the payment failed
+	meltResponse, err := w.Melt(meltQuote.Quote)
+	if err != nil {
+		return 0, fmt.Errorf("error paying invoice from mint '%v': %w", fromMint, err)
+	}
+	switch meltResponse.State {
+	case nut05.Unpaid:
+		return 0, fmt.Errorf("mint '%v' could not pay invoice from mint '%v'", fromMint, toMint)
+	case nut05.Pending:
+		return 0, fmt.Errorf("%w: melt quote '%v' from mint '%v'. Tokens for mint quote '%v' can be minted once it is paid",
+			ErrMintSwapPending, meltQuote.Quote, fromMint, mintQuote.Quote)
+	}
+
+	mintedAmount, err := w.MintTokens(mintQuote.Quote)
+	if err != nil {
+		return 0, fmt.Errorf("invoice was paid but could not mint tokens for quote '%v': %w", mintQuote.Quote, err)
+	}
+	return mintedAmount, nil
+}
+
 // MintSwap will swap the amount from to the specified mint
 func (w *Wallet) MintSwap(amount uint64, from, to string) (uint64, error) {
 	// check both mints are in list of trusted mints
-	fromMint, fromOk := w.mints[from]
-	toMint, toOk := w.mints[to]
+	fromMint, fromOk := w.getMint(from)
+	toMint, toOk := w.getMint(to)
 	if !fromOk || !toOk {
 		return 0, ErrMintNotExist
 	}
@@ -1140,7 +1783,9 @@ func (w *Wallet) MintSwap(amount uint64, from, to string) (uint64, error) {
 		return 0, ErrInsufficientMintBalance
 	}
 
+	w.mu.Lock()
 	proofsToSwap, err := w.getProofsForAmount(amount, &fromMint, true)
+	w.mu.Unlock()
 	if err != nil {
 		return 0, err
 	}
@@ -1150,6 +1795,8 @@ func (w *Wallet) MintSwap(amount uint64, from, to string) (uint64, error) {
 		return 0, err
 	}
 
+	w.saveTransaction(storage.SwapTransaction, from, amountSwapped, proofsToSwap.Amount()-amountSwapped, to)
+
 	return amountSwapped, nil
 }
 
@@ -1173,10 +1820,10 @@ func (w *Wallet) swapProofs(proofs cashu.Proofs, from, to *walletMint) (uint64,
 
 		// request melt quote from the 'from' mint
 		// this melt will pay the invoice generated from the previous mint quote request
-		meltRequest := nut05.PostMeltQuoteBolt11Request{Request: mintResponse.Request, Unit: cashu.Sat.String()}
-		meltQuoteResponse, err = client.PostMeltQuoteBolt11(from.mintURL, meltRequest)
+		meltRequest := nut05.PostMeltQuoteBolt11Request{Request: mintResponse.Request, Unit: w.unit.String()}
+		meltQuoteResponse, err = w.client.PostMeltQuoteBolt11(from.mintURL, meltRequest)
 		if err != nil {
-			return 0, fmt.Errorf("error with melt request: %v", err)
+			return 0, fmt.Errorf("error with melt request: %w", err)
 		}
 
 		// if amount in proofs is less than amount asked from mint in melt request,
@@ -1191,15 +1838,15 @@ func (w *Wallet) swapProofs(proofs cashu.Proofs, from, to *walletMint) (uint64,
 
 	// request from mint to pay invoice from the mint quote request
 	meltBolt11Request := nut05.PostMeltBolt11Request{Quote: meltQuoteResponse.Quote, Inputs: proofs}
-	meltBolt11Response, err := client.PostMeltBolt11(from.mintURL, meltBolt11Request)
+	meltBolt11Response, err := w.client.PostMeltBolt11(from.mintURL, meltBolt11Request)
 	if err != nil {
-		return 0, fmt.Errorf("error melting token: %v", err)
+		return 0, fmt.Errorf("error melting token: %w", err)
 	}
 
 	// if melt request was successful and invoice got paid,
 	// make mint request to get valid proofs
 	if meltBolt11Response.State == nut05.Paid {
-		mintedAmount, err := w.MintTokens(mintResponse.Quote)
+		mintedAmount, err := w.mintTokens(mintResponse.Quote)
 		if err != nil {
 			return 0, fmt.Errorf("error minting tokens: %v", err)
 		}
@@ -1216,7 +1863,7 @@ func (w *Wallet) getProofsFromMint(mintURL string) cashu.Proofs {
 }
 
 func (w *Wallet) getInactiveProofsByMint(mintURL string) cashu.Proofs {
-	selectedMint := w.mints[mintURL]
+	selectedMint, _ := w.getMint(mintURL)
 
 	proofs := cashu.Proofs{}
 	for _, keyset := range selectedMint.inactiveKeysets {
@@ -1228,7 +1875,7 @@ func (w *Wallet) getInactiveProofsByMint(mintURL string) cashu.Proofs {
 }
 
 func (w *Wallet) getActiveProofsByMint(mintURL string) cashu.Proofs {
-	selectedMint := w.mints[mintURL]
+	selectedMint, _ := w.getMint(mintURL)
 	return w.db.GetProofsByKeysetId(selectedMint.activeKeyset.Id)
 }
 
@@ -1427,9 +2074,13 @@ func (w *Wallet) swapToSend(
 
 	cashu.SortBlindedMessages(blindedMessages, secrets, rs)
 
+	if err := w.reserveCounter(activeSatKeyset.Id, int(incrementCounterBy)); err != nil {
+		return nil, err
+	}
+
 	// call swap endpoint
 	swapRequest := nut03.PostSwapRequest{Inputs: proofsToSwap, Outputs: blindedMessages}
-	swapResponse, err := client.PostSwap(mint.mintURL, swapRequest)
+	swapResponse, err := w.client.PostSwap(mint.mintURL, swapRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -1459,16 +2110,13 @@ func (w *Wallet) swapToSend(
 		return nil, fmt.Errorf("error storing proofs: %v", err)
 	}
 
-	err = w.db.IncrementKeysetCounter(activeSatKeyset.Id, incrementCounterBy)
-	if err != nil {
-		return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
-	}
-
 	return proofsToSend, nil
 }
 
 // getProofsForAmount will return proofs from mint for the given amount.
-// It returns error if wallet does not have enough proofs to fulfill amount
+// It returns error if wallet does not have enough proofs to fulfill amount.
+// The proofs returned are removed from the wallet so w.mu should be held
+// to avoid concurrent operations selecting the same proofs.
 func (w *Wallet) getProofsForAmount(
 	amount uint64,
 	mint *walletMint,
@@ -1503,11 +2151,33 @@ func (w *Wallet) getProofsForAmount(
 	return proofsToSend, nil
 }
 
+// number of proofs of each amount the wallet aims to have
+const proofsTargetPerAmount = 3
+
+// SplitStrategy defines the denominations the wallet aims to hold. Having
+// proofs of each amount lets the wallet send offline without swapping.
+type SplitStrategy struct {
+	// number of proofs of each amount the wallet aims to keep.
+	// Defaults to 3 if not set
+	ProofsPerAmount int
+	// largest amount the wallet aims to keep ProofsPerAmount proofs of.
+	// Amounts above it are split in the fewest proofs possible.
+	// If not set, there is no cap
+	MaxAmount uint64
+}
+
+func (s SplitStrategy) proofsPerAmount() int {
+	if s.ProofsPerAmount <= 0 {
+		return proofsTargetPerAmount
+	}
+	return s.ProofsPerAmount
+}
+
 // splitWalletTarget returns a split for an amount.
 // creates the split based on the state of the wallet.
-// it has a defautl target of 3 coins of each amount
+// it targets the number of coins of each amount set in the split strategy
 func (w *Wallet) splitWalletTarget(amountToSplit uint64, mint string) []uint64 {
-	target := 3
+	target := w.splitStrategy.proofsPerAmount()
 	proofs := w.getProofsFromMint(mint)
 
 	// amounts that are in wallet
@@ -1517,55 +2187,21 @@ func (w *Wallet) splitWalletTarget(amountToSplit uint64, mint string) []uint64 {
 	}
 	slices.Sort(amountsInWallet)
 
-	allPosibleAmounts := make([]uint64, crypto.MAX_ORDER)
-	for i := 0; i < crypto.MAX_ORDER; i++ {
-		amount := uint64(math.Pow(2, float64(i)))
-		allPosibleAmounts[i] = amount
-	}
-
 	// based on amounts that are already in the wallet
-	// define what amounts wanted to reach target
-	var neededAmounts []uint64
-	for _, amount := range allPosibleAmounts {
-		count := cashu.Count(amountsInWallet, amount)
-		timesToAdd := cashu.Max(0, uint64(target)-uint64(count))
-		for i := 0; i < int(timesToAdd); i++ {
-			neededAmounts = append(neededAmounts, amount)
-		}
-	}
-	slices.Sort(neededAmounts)
-
-	// fill in based on the needed amounts
-	// that are below the amount passed (amountToSplit)
-	var amounts []uint64
-	var amountsSum uint64 = 0
-	for amountsSum < amountToSplit {
-		if len(neededAmounts) > 0 {
-			if amountsSum+neededAmounts[0] > amountToSplit {
-				break
-			}
-			amounts = append(amounts, neededAmounts[0])
-			amountsSum += neededAmounts[0]
-			neededAmounts = slices.Delete(neededAmounts, 0, 1)
-		} else {
+	// define how many of each amount are needed to reach target
+	neededCounts := make(map[uint64]int)
+	for i := 0; i < cashu.MAX_ORDER; i++ {
+		amount := uint64(1) << i
+		if w.splitStrategy.MaxAmount > 0 && amount > w.splitStrategy.MaxAmount {
 			break
 		}
+		count := int(cashu.Count(amountsInWallet, amount))
+		if count < target {
+			neededCounts[amount] = target - count
+		}
 	}
 
-	remainingAmount := amountToSplit - amountsSum
-	if remainingAmount > 0 {
-		amounts = append(amounts, cashu.AmountSplit(remainingAmount)...)
-	}
-	slices.Sort(amounts)
-
-	return amounts
-}
-
-func calculateBlankOutputs(feeReserve uint64) int {
-	if feeReserve == 0 {
-		return 0
-	}
-	return int(math.Max(math.Ceil(math.Log2(float64(feeReserve))), 1))
+	return cashu.AmountSplitTargeting(amountToSplit, neededCounts)
 }
 
 func feesForProofs(proofs cashu.Proofs, mint *walletMint) uint {
@@ -1717,6 +2353,8 @@ func constructProofs(
 	rs []*secp256k1.PrivateKey,
 	keyset *crypto.WalletKeyset,
 ) (cashu.Proofs, error) {
+	// blinding factors are not needed once the signatures are unblinded
+	defer crypto.ZeroPrivateKeys(rs...)
 
 	sigsLenght := len(blindedSignatures)
 	if sigsLenght != len(secrets) || sigsLenght != len(rs) {
@@ -1790,11 +2428,43 @@ func (w *Wallet) counterForKeyset(keysetId string) uint32 {
 	return w.db.GetKeysetCounter(keysetId)
 }
 
+// reserveCounter moves the counter of the keyset past the num outputs that were
+// derived from it. It is called before the outputs are sent to the mint so their
+// secrets are never reused, even if the request fails after the mint signed them
+// or the wallet stops before saving the proofs. Those proofs can be recovered
+// with Restore, which scans past the unused counters this can leave.
+func (w *Wallet) reserveCounter(keysetId string, num int) error {
+	if num == 0 {
+		return nil
+	}
+	if err := w.db.IncrementKeysetCounter(keysetId, uint32(num)); err != nil {
+		return fmt.Errorf("error incrementing keyset counter: %v", err)
+	}
+	return nil
+}
+
+// setProxy routes the connections to mints, LNURL
+// endpoints and nostr relays through the proxy
+func setProxy(proxyURL *url.URL) {
+	client.SetProxy(proxyURL)
+	lnurl.SetProxy(proxyURL)
+	submanager.SetProxy(proxyURL)
+	nostr.SetProxy(proxyURL)
+}
+
 func (w *Wallet) loadWalletMints() (map[string]walletMint, error) {
 	walletMints := make(map[string]walletMint)
 
+	removedMints := make(map[string]bool)
+	for _, mint := range w.db.GetRemovedMints() {
+		removedMints[mint] = true
+	}
+
 	keysets := w.db.GetKeysets()
 	for k, mintKeysets := range keysets {
+		if removedMints[k] {
+			continue
+		}
 		var activeKeyset crypto.WalletKeyset
 		inactiveKeysets := make(map[string]crypto.WalletKeyset)
 		for _, keyset := range mintKeysets {
@@ -1803,9 +2473,12 @@ func (w *Wallet) loadWalletMints() (map[string]walletMint, error) {
 			if err != nil {
 				continue
 			}
+			if keyset.Unit != w.unit.String() {
+				continue
+			}
 
 			if len(keyset.PublicKeys) == 0 {
-				publicKeys, err := GetKeysetKeys(keyset.MintURL, keyset.Id)
+				publicKeys, err := getKeysetKeys(w.client, keyset.MintURL, keyset.Id)
 				if err != nil {
 					return nil, err
 				}
@@ -1822,6 +2495,11 @@ func (w *Wallet) loadWalletMints() (map[string]walletMint, error) {
 			}
 		}
 
+		// mint does not have keysets for the unit of the wallet
+		if len(activeKeyset.Id) == 0 && len(inactiveKeysets) == 0 {
+			continue
+		}
+
 		walletMints[k] = walletMint{
 			mintURL:         k,
 			activeKeyset:    activeKeyset,
@@ -1832,24 +2510,55 @@ func (w *Wallet) loadWalletMints() (map[string]walletMint, error) {
 	return walletMints, nil
 }
 
+// loadMintPubkeys pins in the client the public keys of the mints saved in the db
+func (w *Wallet) loadMintPubkeys() error {
+	for mintURL, hexPubkey := range w.db.GetMintPubkeys() {
+		pubkeyBytes, err := hex.DecodeString(hexPubkey)
+		if err != nil {
+			return fmt.Errorf("invalid public key saved for mint '%v': %v", mintURL, err)
+		}
+		pubkey, err := secp256k1.ParsePubKey(pubkeyBytes)
+		if err != nil {
+			return fmt.Errorf("invalid public key saved for mint '%v': %v", mintURL, err)
+		}
+		w.client.PinMintPubkey(mintURL, pubkey)
+	}
+	return nil
+}
+
+// saveMintPubkey saves the public key pinned by the client for the mint.
+// The client pins it the first time the mint returns its info signed.
+func (w *Wallet) saveMintPubkey(mintURL string) error {
+	pubkey := w.client.MintPubkey(mintURL)
+	if pubkey == nil {
+		return nil
+	}
+	hexPubkey := hex.EncodeToString(pubkey.SerializeCompressed())
+	if w.db.GetMintPubkeys()[mintURL] == hexPubkey {
+		return nil
+	}
+	if err := w.db.SaveMintPubkey(mintURL, hexPubkey); err != nil {
+		return fmt.Errorf("error saving public key of mint: %v", err)
+	}
+	return nil
+}
+
 // CurrentMint returns the current mint url
 func (w *Wallet) CurrentMint() string {
 	return w.defaultMint
 }
 
 func (w *Wallet) TrustedMints() []string {
-	trustedMints := make([]string, len(w.mints))
-
-	i := 0
-	for mintURL := range w.mints {
-		trustedMints[i] = mintURL
-		i++
+	mints := w.walletMints()
+	trustedMints := make([]string, len(mints))
+	for i, mint := range mints {
+		trustedMints[i] = mint.mintURL
 	}
 	return trustedMints
 }
 
 func (w *Wallet) UpdateMintURL(oldURL, newURL string) error {
-	mint, ok := w.mints[oldURL]
+	mint, ok := w.getMint(oldURL)
 	if !ok {
 		return ErrMintNotExist
 	}
@@ -1857,19 +2566,28 @@ func (w *Wallet) UpdateMintURL(oldURL, newURL string) error {
 	if err := w.db.UpdateKeysetMintURL(oldURL, newURL); err != nil {
 		return fmt.Errorf("error updating mint URL in database: %v", err)
 	}
+	// same mint so it has to keep signing with the same key
+	if pubkey := w.client.MintPubkey(oldURL); pubkey != nil {
+		w.client.PinMintPubkey(newURL, pubkey)
+		if err := w.saveMintPubkey(newURL); err != nil {
+			return err
+		}
+	}
 
 	mint.mintURL = newURL
 	mint.activeKeyset.MintURL = newURL
+	inactiveKeysets := make(map[string]crypto.WalletKeyset, len(mint.inactiveKeysets))
 	for _, inactive := range mint.inactiveKeysets {
 		inactive.MintURL = newURL
-		mint.inactiveKeysets[inactive.Id] = inactive
+		inactiveKeysets[inactive.Id] = inactive
 	}
-	w.mints[newURL] = mint
+	mint.inactiveKeysets = inactiveKeysets
+	w.setMint(mint)
 
 	if oldURL == w.defaultMint {
 		w.defaultMint = newURL
 	}
-	delete(w.mints, oldURL)
+	w.deleteMint(oldURL)
 
 	return nil
 }
@@ -1892,7 +2610,7 @@ func (w *Wallet) pendingProofsByMint() map[string][]storage.DBProof {
 
 	proofsByMint := make(map[string][]storage.DBProof)
 	for keysetId, proofs := range proofsByKeysetId {
-		for _, mint := range w.mints {
+		for _, mint := range w.walletMints() {
 			if mint.activeKeyset.Id == keysetId {
 				proofsByMint[mint.mintURL] = append(proofsByMint[mint.mintURL], proofs...)
 				break
@@ -1921,7 +2639,7 @@ func (w *Wallet) RemoveSpentProofs() error {
 		}
 
 		proofStateRequest := nut07.PostCheckStateRequest{Ys: Ys}
-		proofStateResponse, err := client.PostCheckProofState(mint, proofStateRequest)
+		proofStateResponse, err := w.client.PostCheckProofState(mint, proofStateRequest)
 		if err != nil {
 			return err
 		}
@@ -1941,9 +2659,89 @@ func (w *Wallet) RemoveSpentProofs() error {
 	return nil
 }
 
+// size of the batches of Ys sent to the mint when checking proof states
+const checkStateBatchSize = 100
+
+// ProofsStateReport has the proofs that were found
+// in a spent or pending state when checking with the mint
+type ProofsStateReport struct {
+	Spent   cashu.Proofs
+	Pending cashu.Proofs
+}
+
+// CheckProofsSpent checks the state of the proofs stored in the wallet against
+// their mints. Proofs that are spent are removed from the wallet and proofs that
+// are pending are moved to pending so they are not counted in the balance.
+func (w *Wallet) CheckProofsSpent() (*ProofsStateReport, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	report := &ProofsStateReport{}
+	for _, mint := range w.walletMints() {
+		mintURL := mint.mintURL
+
+		// get proofs keyed by Y per keyset instead of hashing each proof here
+		proofsByY := make(map[string]cashu.Proof)
+		keysetIds := []string{mint.activeKeyset.Id}
+		for _, keyset := range mint.inactiveKeysets {
+			keysetIds = append(keysetIds, keyset.Id)
+		}
+		for _, id := range keysetIds {
+			maps.Copy(proofsByY, w.db.GetKeysetProofsByY(id))
+		}
+		allYs := slices.Collect(maps.Keys(proofsByY))
+
+		for start := 0; start < len(allYs); start += checkStateBatchSize {
+			end := min(start+checkStateBatchSize, len(allYs))
+			Ys := allYs[start:end]
+
+			proofStateRequest := nut07.PostCheckStateRequest{Ys: Ys}
+			proofStateResponse, err := w.client.PostCheckProofState(mintURL, proofStateRequest)
+			if err != nil {
+				return nil, err
+			}
+
+			var pendingProofs cashu.Proofs
+			for _, state := range proofStateResponse.States {
+				proof, ok := proofsByY[state.Y]
+				if !ok {
+					continue
+				}
+
+				switch state.State {
+				case nut07.Spent:
+					if err := w.db.DeleteProof(proof.Secret); err != nil {
+						return nil, fmt.Errorf("error removing spent proof: %v", err)
+					}
+					report.Spent = append(report.Spent, proof)
+				case nut07.Pending:
+					pendingProofs = append(pendingProofs, proof)
+				}
+			}
+
+			if len(pendingProofs) > 0 {
+				if err := w.db.AddPendingProofs(pendingProofs); err != nil {
+					return nil, fmt.Errorf("could not save proofs to pending: %v", err)
+				}
+				for _, proof := range pendingProofs {
+					if err := w.db.DeleteProof(proof.Secret); err != nil {
+						return nil, err
+					}
+				}
+				report.Pending = append(report.Pending, pendingProofs...)
+			}
+		}
+	}
+
+	return report, nil
+}
+
 // ReclaimUnspentProofs will check the state of pending proofs
 // and try to reclaim proofs that are in a unspent state
 func (w *Wallet) ReclaimUnspentProofs() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	pendingProofs := w.pendingProofsByMint()
 
 	var amountReclaimed uint64
@@ -1954,7 +2752,7 @@ func (w *Wallet) ReclaimUnspentProofs() (uint64, error) {
 		}
 
 		proofStateRequest := nut07.PostCheckStateRequest{Ys: Ys}
-		proofStateResponse, err := client.PostCheckProofState(mintURL, proofStateRequest)
+		proofStateResponse, err := w.client.PostCheckProofState(mintURL, proofStateRequest)
 		if err != nil {
 			return 0, err
 		}
@@ -1980,19 +2778,15 @@ func (w *Wallet) ReclaimUnspentProofs() (uint64, error) {
 		}
 
 		if len(proofsToReclaim) > 0 {
-			mint := w.mints[mintURL]
+			mint, _ := w.getMint(mintURL)
 			req, err := w.createSwapRequest(proofsToReclaim, &mint)
 			if err != nil {
 				return 0, fmt.Errorf("could not create swap request: %v", err)
 			}
-			newProofs, err := swap(mintURL, req)
+			newProofs, err := w.swap(mintURL, req)
 			if err != nil {
 				return 0, fmt.Errorf("could not swap proofs: %v", err)
 			}
-			err = w.db.IncrementKeysetCounter(req.keyset.Id, uint32(len(req.outputs)))
-			if err != nil {
-				return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
-			}
 			if err := w.db.SaveProofs(newProofs); err != nil {
 				return 0, fmt.Errorf("error storing proofs: %v", err)
 			}
@@ -2000,7 +2794,7 @@ func (w *Wallet) ReclaimUnspentProofs() (uint64, error) {
 				return 0, fmt.Errorf("error removing pending proofs: %v", err)
 			}
 
-			amountReclaimed = newProofs.Amount()
+			amountReclaimed += newProofs.Amount()
 		}
 	}
 
@@ -4,9 +4,12 @@ package wallet_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"slices"
@@ -22,10 +25,12 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
 	"github.com/elnosh/gonuts/cashu/nuts/nut12"
 	"github.com/elnosh/gonuts/cashu/nuts/nut15"
+	"github.com/elnosh/gonuts/cashu/nuts/nut18"
 	"github.com/elnosh/gonuts/mint"
 	"github.com/elnosh/gonuts/mint/lightning"
 	"github.com/elnosh/gonuts/testutils"
 	"github.com/elnosh/gonuts/wallet"
+	"github.com/elnosh/gonuts/wallet/storage"
 	"github.com/lightningnetwork/lnd/lnrpc"
 )
 
@@ -431,6 +436,54 @@ func TestMintSwap(t *testing.T) {
 	}
 }
 
+func TestSwapMints(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testswapmintswallet")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	var amountToSwap uint64 = 1000
+	_, err = testWallet.SwapMints(testWallet.CurrentMint(), mintURL2, amountToSwap)
+	if !errors.Is(err, wallet.ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got error '%v'", wallet.ErrMintNotExist, err)
+	}
+
+	_, err = testWallet.AddMint(mintURL2)
+	if err != nil {
+		t.Fatalf("unexpected error adding mint to wallet: %v", err)
+	}
+
+	_, err = testWallet.SwapMints(testWallet.CurrentMint(), mintURL2, amountToSwap)
+	if !errors.Is(err, wallet.ErrInsufficientMintBalance) {
+		t.Fatalf("expected error '%v' but got error '%v'", wallet.ErrInsufficientMintBalance, err)
+	}
+
+	var fundAmount uint64 = 21000
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, fundAmount); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+	amountSwapped, err := testWallet.SwapMints(testWallet.CurrentMint(), mintURL2, amountToSwap)
+	if err != nil {
+		t.Fatalf("unexpected error swapping between mints: %v", err)
+	}
+	// full amount is received at the other mint since fees are paid on top
+	if amountSwapped != amountToSwap {
+		t.Fatalf("expected amount swapped '%v' but got '%v'", amountToSwap, amountSwapped)
+	}
+
+	balanceByMints := testWallet.GetBalanceByMints()
+	if balanceByMints[mintURL2] != amountToSwap {
+		t.Fatalf("expected balance '%v' but got '%v'", amountToSwap, balanceByMints[mintURL2])
+	}
+	// overpaid fee reserve is returned as change
+	if balanceByMints[testWallet.CurrentMint()] > fundAmount-amountToSwap {
+		t.Fatalf("expected balance of at most '%v' but got '%v'",
+			fundAmount-amountToSwap, balanceByMints[testWallet.CurrentMint()])
+	}
+}
+
 // check balance is correct after certain operations
 func TestWalletBalance(t *testing.T) {
 	testWalletPath := filepath.Join(".", "/testwalletbalance")
@@ -763,6 +816,70 @@ func TestPendingProofs(t *testing.T) {
 }
 
 // Test wallet operations work after mint rotates to new keyset
+func TestPaymentRequest(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testpaymentrequestwallet")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	testWalletPath2 := filepath.Join(".", "/testpaymentrequestwallet2")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath2)
+
+	if err := testutils.FundCashuWallet(ctx, testWallet2, nil, 5000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	// server receiving payments through the post transport
+	received := make(chan uint64, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var payload nut18.PaymentRequestPayload
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		amount, err := testWallet.ReceivePaymentRequestPayload(payload)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- amount
+	}))
+	defer server.Close()
+
+	var amount uint64 = 2100
+	transports := []nut18.Transport{{Type: nut18.PostTransport, Target: server.URL}}
+	paymentRequest, err := testWallet.CreatePaymentRequest(amount, "test payment", transports)
+	if err != nil {
+		t.Fatalf("unexpected error creating payment request: %v", err)
+	}
+	encoded, err := paymentRequest.Encode()
+	if err != nil {
+		t.Fatalf("unexpected error encoding payment request: %v", err)
+	}
+	decoded, err := nut18.DecodePaymentRequest(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error decoding payment request: %v", err)
+	}
+
+	if _, err := testWallet2.PayPaymentRequest(*decoded, 0); err != nil {
+		t.Fatalf("unexpected error paying payment request: %v", err)
+	}
+
+	amountReceived := <-received
+	if amountReceived != amount {
+		t.Fatalf("expected amount received of %v but got %v", amount, amountReceived)
+	}
+	if testWallet.GetBalance() != amount {
+		t.Fatalf("expected balance of %v but got %v", amount, testWallet.GetBalance())
+	}
+}
+
 func TestKeysetRotations(t *testing.T) {
 	port, _ := testutils.GetAvailablePort()
 	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
@@ -848,7 +965,30 @@ func TestKeysetRotations(t *testing.T) {
 		}
 	}()
 	time.Sleep(time.Millisecond * 500)
-	_, err = testWallet2.Receive(token, false)
+	amountReceived, err := testWallet2.Receive(token, false)
+	if err != nil {
+		t.Fatalf("unexpected error receiving token: %v", err)
+	}
+
+	testMint = bumpKeyset(testMint)
+	go func() {
+		if err := testMint.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	time.Sleep(time.Millisecond * 500)
+
+	// proofs received are now from an inactive keyset
+	amountSwapped, err := testWallet2.SwapInactiveProofs(mintURL)
+	if err != nil {
+		t.Fatalf("unexpected error swapping inactive proofs: %v", err)
+	}
+	if amountSwapped != amountReceived {
+		t.Fatalf("expected amount swapped of %v but got %v", amountReceived, amountSwapped)
+	}
+	if testWallet2.GetBalance() != amountReceived {
+		t.Fatalf("expected balance of %v but got %v", amountReceived, testWallet2.GetBalance())
+	}
 }
 
 func TestWalletRestore(t *testing.T) {
@@ -917,7 +1057,7 @@ func testWalletRestore(
 	// delete wallet db to restore
 	os.RemoveAll(filepath.Join(restorePath, "wallet.db"))
 
-	amountRestored, err := wallet.Restore(restorePath, mnemonic, []string{mintURL})
+	amountRestored, err := wallet.Restore(restorePath, wallet.BoltStorage, mnemonic, []string{mintURL})
 	if err != nil {
 		t.Fatalf("error restoring wallet: %v\n", err)
 	}
@@ -1600,3 +1740,465 @@ func TestWalletRestoreNutshell(t *testing.T) {
 
 	testWalletRestore(t, testWallet, testWallet2, testWalletPath)
 }
+
+func TestSQLiteWallet(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testsqlitewallet")
+	if err := os.MkdirAll(testWalletPath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	config := wallet.Config{
+		WalletPath:     testWalletPath,
+		CurrentMintURL: mintURL1,
+		StorageType:    wallet.SQLiteStorage,
+	}
+	testWallet, err := wallet.LoadWallet(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 10000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	testWalletPath2 := filepath.Join(".", "/testsqlitewallet2")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath2)
+
+	proofsToSend, err := testWallet.Send(2100, mintURL1, true)
+	if err != nil {
+		t.Fatalf("unexpected error in send: %v", err)
+	}
+	token, _ := cashu.NewTokenV4(proofsToSend, mintURL1, cashu.Sat, false)
+	if _, err := testWallet2.Receive(token, false); err != nil {
+		t.Fatalf("unexpected error in receive: %v", err)
+	}
+
+	balance := testWallet.GetBalance()
+	mnemonic := testWallet.Mnemonic()
+	testWallet.Shutdown()
+
+	// reload wallet and check data was persisted
+	testWallet, err = wallet.LoadWallet(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testWallet.Shutdown()
+
+	if testWallet.GetBalance() != balance {
+		t.Fatalf("expected balance of '%v' but got '%v'", balance, testWallet.GetBalance())
+	}
+	if testWallet.Mnemonic() != mnemonic {
+		t.Fatal("mnemonic of reloaded wallet does not match")
+	}
+	if len(testWallet.GetMintQuotes()) != 1 {
+		t.Fatalf("expected 1 mint quote but got '%v'", len(testWallet.GetMintQuotes()))
+	}
+}
+
+func TestHistory(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwallethistory")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath)
+	}()
+
+	testWalletPath2 := filepath.Join(".", "/testwallethistory2")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath2)
+	}()
+
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 10000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	var sendAmount uint64 = 2100
+	proofsToSend, err := testWallet.Send(sendAmount, mintURL1, false)
+	if err != nil {
+		t.Fatalf("unexpected error in send: %v", err)
+	}
+	token, _ := cashu.NewTokenV4(proofsToSend, mintURL1, cashu.Sat, false)
+	amountReceived, err := testWallet2.Receive(token, false)
+	if err != nil {
+		t.Fatalf("unexpected error in receive: %v", err)
+	}
+
+	history := testWallet.GetHistory(storage.TransactionFilter{})
+	if len(history) != 2 {
+		t.Fatalf("expected 2 transactions but got '%v'", len(history))
+	}
+
+	send := history[0]
+	if send.Type != storage.SendTransaction {
+		t.Fatalf("expected send transaction but got '%v'", send.Type)
+	}
+	if send.Amount != sendAmount {
+		t.Fatalf("expected amount of '%v' but got '%v'", sendAmount, send.Amount)
+	}
+	if send.Balance != testWallet.GetBalance() {
+		t.Fatalf("expected balance of '%v' but got '%v'", testWallet.GetBalance(), send.Balance)
+	}
+	sentToken, err := cashu.DecodeToken(send.Counterpart)
+	if err != nil {
+		t.Fatalf("could not decode token in history: %v", err)
+	}
+	if sentToken.Amount() != proofsToSend.Amount() {
+		t.Fatalf("expected token amount of '%v' but got '%v'", proofsToSend.Amount(), sentToken.Amount())
+	}
+
+	mint := history[1]
+	if mint.Type != storage.MintTransaction {
+		t.Fatalf("expected mint transaction but got '%v'", mint.Type)
+	}
+	if mint.Amount != 10000 || mint.Balance != 10000 {
+		t.Fatalf("expected amount and balance of 10000 but got '%v' and '%v'", mint.Amount, mint.Balance)
+	}
+	if mint.Mint != mintURL1 {
+		t.Fatalf("expected mint '%v' but got '%v'", mintURL1, mint.Mint)
+	}
+
+	history = testWallet.GetHistory(storage.TransactionFilter{Type: storage.MintTransaction})
+	if len(history) != 1 {
+		t.Fatalf("expected 1 transaction but got '%v'", len(history))
+	}
+
+	history = testWallet2.GetHistory(storage.TransactionFilter{})
+	if len(history) != 1 {
+		t.Fatalf("expected 1 transaction but got '%v'", len(history))
+	}
+	receive := history[0]
+	if receive.Type != storage.ReceiveTransaction {
+		t.Fatalf("expected receive transaction but got '%v'", receive.Type)
+	}
+	if receive.Amount != amountReceived {
+		t.Fatalf("expected amount of '%v' but got '%v'", amountReceived, receive.Amount)
+	}
+	if receive.Fee != token.Amount()-amountReceived {
+		t.Fatalf("expected fee of '%v' but got '%v'", token.Amount()-amountReceived, receive.Fee)
+	}
+}
+
+func TestAwaitMintPaid(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletawaitmint")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath)
+	}()
+
+	mintResponse, err := testWallet.RequestMint(2100, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error requesting mint: %v", err)
+	}
+
+	awaitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := testWallet.AwaitMintPaid(awaitCtx, mintResponse.Quote); err != nil {
+		t.Fatalf("unexpected error waiting for quote to be paid: %v", err)
+	}
+
+	amountMinted, err := testWallet.MintTokens(mintResponse.Quote)
+	if err != nil {
+		t.Fatalf("unexpected error minting tokens: %v", err)
+	}
+	if amountMinted != 2100 {
+		t.Fatalf("expected minted amount of 2100 but got %v", amountMinted)
+	}
+
+	// already issued quote should return right away
+	if err := testWallet.AwaitMintPaid(awaitCtx, mintResponse.Quote); err != nil {
+		t.Fatalf("unexpected error waiting for quote to be paid: %v", err)
+	}
+
+	err = testWallet.AwaitMintPaid(awaitCtx, "nonexistentquote")
+	if !errors.Is(err, wallet.ErrQuoteNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", wallet.ErrQuoteNotFound, err)
+	}
+}
+
+func TestAwaitAndMint(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletawaitandmint")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath)
+	}()
+
+	invoice, err := testWallet.RequestMintInvoice(2100, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error requesting mint invoice: %v", err)
+	}
+	if invoice.Amount != 2100 {
+		t.Fatalf("expected amount of 2100 but got %v", invoice.Amount)
+	}
+	if invoice.Mint != mintURL1 {
+		t.Fatalf("expected mint '%v' but got '%v'", mintURL1, invoice.Mint)
+	}
+	if invoice.Expiry == 0 || invoice.Expired() {
+		t.Fatalf("expected invoice with expiry in the future but got %v", invoice.Expiry)
+	}
+
+	awaitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	amountMinted, err := testWallet.AwaitAndMint(awaitCtx, invoice.QuoteId)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if amountMinted != 2100 {
+		t.Fatalf("expected minted amount of 2100 but got %v", amountMinted)
+	}
+	if testWallet.GetBalance() != 2100 {
+		t.Fatalf("expected balance of 2100 but got %v", testWallet.GetBalance())
+	}
+
+	_, err = testWallet.AwaitAndMint(awaitCtx, "nonexistentquote")
+	if !errors.Is(err, wallet.ErrQuoteNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", wallet.ErrQuoteNotFound, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletsync")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath)
+	}()
+
+	// quote paid but not minted, i.e wallet was closed before minting
+	mintResponse, err := testWallet.RequestMint(2100, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error requesting mint: %v", err)
+	}
+
+	report, err := testWallet.Sync()
+	if err != nil {
+		t.Fatalf("unexpected error syncing wallet: %v", err)
+	}
+	if report.Minted != 2100 {
+		t.Fatalf("expected minted amount of 2100 but got %v", report.Minted)
+	}
+	if len(report.MintedQuotes) != 1 || report.MintedQuotes[0] != mintResponse.Quote {
+		t.Fatalf("expected minted quotes '%v' but got '%v'", []string{mintResponse.Quote}, report.MintedQuotes)
+	}
+	if testWallet.GetBalance() != 2100 {
+		t.Fatalf("expected balance of 2100 but got %v", testWallet.GetBalance())
+	}
+
+	// issued quote should not be minted again
+	report, err = testWallet.Sync()
+	if err != nil {
+		t.Fatalf("unexpected error syncing wallet: %v", err)
+	}
+	if report.Minted != 0 {
+		t.Fatalf("expected minted amount of 0 but got %v", report.Minted)
+	}
+
+	// spent pending proofs are removed
+	proofs, err := testWallet.Send(500, mintURL1, true)
+	if err != nil {
+		t.Fatalf("unexpected error in send: %v", err)
+	}
+	token, _ := cashu.NewTokenV4(proofs, mintURL1, cashu.Sat, false)
+	testWalletPath2 := filepath.Join(".", "/testwalletsync2")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath2)
+	}()
+	if _, err := testWallet2.Receive(token, false); err != nil {
+		t.Fatalf("unexpected error receiving token: %v", err)
+	}
+
+	if _, err := testWallet.Sync(); err != nil {
+		t.Fatalf("unexpected error syncing wallet: %v", err)
+	}
+	if testWallet.PendingBalance() != 0 {
+		t.Fatalf("expected pending balance of 0 but got %v", testWallet.PendingBalance())
+	}
+}
+
+func TestSweepAll(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletsweep")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath)
+	}()
+
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 2100); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	// invoice for more than the balance
+	bolt11, _, _, _ := lightning.CreateFakeInvoice(3000, false)
+	_, err = testWallet.SweepAll(bolt11)
+	if !errors.Is(err, wallet.ErrInsufficientMintBalance) {
+		t.Fatalf("expected error '%v' but got '%v'", wallet.ErrInsufficientMintBalance, err)
+	}
+	if testWallet.GetBalance() != 2100 {
+		t.Fatalf("expected balance of 2100 but got %v", testWallet.GetBalance())
+	}
+
+	bolt11, _, _, _ = lightning.CreateFakeInvoice(2000, false)
+	report, err := testWallet.SweepAll(bolt11)
+	if err != nil {
+		t.Fatalf("unexpected error sweeping: %v", err)
+	}
+	if len(report.Payments) != 1 {
+		t.Fatalf("expected 1 payment but got %v", len(report.Payments))
+	}
+	if report.Payments[0].State != nut05.Paid {
+		t.Fatalf("expected payment state '%v' but got '%v'", nut05.Paid, report.Payments[0].State)
+	}
+	if report.Paid != 2000 {
+		t.Fatalf("expected paid amount of 2000 but got %v", report.Paid)
+	}
+	if testWallet.GetBalance() != 2100-report.Paid-report.Fees {
+		t.Fatalf("expected balance of %v but got %v", 2100-report.Paid-report.Fees, testWallet.GetBalance())
+	}
+
+	_, err = testWallet.SweepAll("notaninvoice")
+	if err == nil {
+		t.Fatal("expected error with invalid destination")
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletconsolidate")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath)
+	}()
+
+	testWalletPath2 := filepath.Join(".", "/testwalletconsolidate2")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath2)
+	}()
+
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 1000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	// receive many proofs of 1 sat
+	for i := 0; i < 15; i++ {
+		proofs, err := testWallet.Send(1, mintURL1, false)
+		if err != nil {
+			t.Fatalf("unexpected error in send: %v", err)
+		}
+		token, _ := cashu.NewTokenV4(proofs, mintURL1, cashu.Sat, false)
+		if _, err := testWallet2.Receive(token, false); err != nil {
+			t.Fatalf("unexpected error in receive: %v", err)
+		}
+	}
+
+	balance := testWallet2.GetBalance()
+	proofsRemoved, err := testWallet2.Consolidate()
+	if err != nil {
+		t.Fatalf("unexpected error consolidating: %v", err)
+	}
+	if proofsRemoved == 0 {
+		t.Fatal("expected proofs to be consolidated")
+	}
+	if testWallet2.GetBalance() != balance {
+		t.Fatalf("expected balance of '%v' but got '%v'", balance, testWallet2.GetBalance())
+	}
+
+	// nothing left to consolidate
+	proofsRemoved, err = testWallet2.Consolidate()
+	if err != nil {
+		t.Fatalf("unexpected error consolidating: %v", err)
+	}
+	if proofsRemoved != 0 {
+		t.Fatalf("expected no proofs consolidated but got '%v'", proofsRemoved)
+	}
+}
+
+func TestReceiveAll(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletreceiveall")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath)
+	}()
+
+	testWalletPath2 := filepath.Join(".", "/testwalletreceiveall2")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll(testWalletPath2)
+	}()
+
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 1000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	var tokens []cashu.Token
+	var amountSent uint64
+	for _, amount := range []uint64{21, 42, 5, 100, 13} {
+		proofs, err := testWallet.Send(amount, mintURL1, false)
+		if err != nil {
+			t.Fatalf("unexpected error in send: %v", err)
+		}
+		token, _ := cashu.NewTokenV4(proofs, mintURL1, cashu.Sat, false)
+		tokens = append(tokens, token)
+		amountSent += amount
+	}
+	// same token passed twice is only received once
+	tokens = append(tokens, tokens[0])
+
+	amountReceived, err := testWallet2.ReceiveAll(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error in receive all: %v", err)
+	}
+	if amountReceived != amountSent {
+		t.Fatalf("expected amount received of '%v' but got '%v'", amountSent, amountReceived)
+	}
+	if testWallet2.GetBalance() != amountSent {
+		t.Fatalf("expected balance of '%v' but got '%v'", amountSent, testWallet2.GetBalance())
+	}
+
+	// single receive transaction for the mint
+	history := testWallet2.GetHistory(storage.TransactionFilter{Type: storage.ReceiveTransaction})
+	if len(history) != 1 {
+		t.Fatalf("expected 1 transaction but got '%v'", len(history))
+	}
+
+	// tokens already spent
+	_, err = testWallet2.ReceiveAll(tokens[:2])
+	if err == nil {
+		t.Fatal("expected error receiving spent tokens")
+	}
+}
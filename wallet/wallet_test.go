@@ -5,18 +5,36 @@ package wallet
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut02"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/cashu/nuts/nut18"
 	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/nostr"
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/tyler-smith/go-bip39"
 )
 
 func TestCreateBlindedMessages(t *testing.T) {
@@ -203,7 +221,7 @@ func TestUpdateMintURL(t *testing.T) {
 	}
 	defer os.RemoveAll(dbpath)
 
-	db, err := InitStorage(dbpath)
+	db, err := InitStorage(dbpath, BoltStorage)
 	if err != nil {
 		t.Fatalf("InitStorage: %v", err)
 	}
@@ -241,6 +259,280 @@ func TestUpdateMintURL(t *testing.T) {
 	}
 }
 
+func TestSendOffline(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	activeKeyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	mints := map[string]walletMint{
+		mintURL: {
+			mintURL:         mintURL,
+			activeKeyset:    *activeKeyset,
+			inactiveKeysets: map[string]crypto.WalletKeyset{},
+		},
+	}
+
+	dbpath := ".testwalletoffline"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	db.SaveKeyset(activeKeyset)
+
+	proofs := cashu.Proofs{}
+	for _, amount := range []uint64{1, 2, 4, 8} {
+		proofs = append(proofs, cashu.Proof{
+			Amount: amount,
+			Id:     activeKeyset.Id,
+			Secret: "secret" + strconv.FormatUint(amount, 10),
+			C:      "C",
+		})
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	wallet := &Wallet{mints: mints, db: db, defaultMint: mintURL}
+
+	proofsToSend, err := wallet.SendOffline(6, mintURL, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if proofsToSend.Amount() != 6 {
+		t.Fatalf("expected proofs of amount 6 but got %v", proofsToSend.Amount())
+	}
+	if wallet.GetBalance() != 9 {
+		t.Fatalf("expected balance of 9 but got %v", wallet.GetBalance())
+	}
+	if wallet.PendingBalance() != 6 {
+		t.Fatalf("expected pending balance of 6 but got %v", wallet.PendingBalance())
+	}
+
+	// remaining proofs (1 and 8) cannot add up to 5
+	_, err = wallet.SendOffline(5, mintURL, true)
+	if !errors.Is(err, ErrOfflineSendNotPossible) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrOfflineSendNotPossible, err)
+	}
+	if wallet.GetBalance() != 9 {
+		t.Fatalf("expected balance of 9 but got %v", wallet.GetBalance())
+	}
+
+	_, err = wallet.SendOffline(5, "http://nonexistent.mint", true)
+	if !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+}
+
+func TestConcurrentSendOffline(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	activeKeyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	mints := map[string]walletMint{
+		mintURL: {
+			mintURL:         mintURL,
+			activeKeyset:    *activeKeyset,
+			inactiveKeysets: map[string]crypto.WalletKeyset{},
+		},
+	}
+
+	dbpath := ".testwalletconcurrent"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	db.SaveKeyset(activeKeyset)
+
+	numProofs := 20
+	proofs := make(cashu.Proofs, numProofs)
+	for i := 0; i < numProofs; i++ {
+		proofs[i] = cashu.Proof{
+			Amount: 1,
+			Id:     activeKeyset.Id,
+			Secret: "secret" + strconv.Itoa(i),
+			C:      "C",
+		}
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	wallet := &Wallet{mints: mints, db: db, defaultMint: mintURL}
+
+	// more sends than proofs available. Each proof should only be sent once
+	numSends := 30
+	results := make([]cashu.Proofs, numSends)
+	var wg sync.WaitGroup
+	for i := 0; i < numSends; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = wallet.SendOffline(1, mintURL, false)
+		}()
+	}
+	wg.Wait()
+
+	sent := make(map[string]bool)
+	for _, result := range results {
+		for _, proof := range result {
+			if sent[proof.Secret] {
+				t.Fatalf("proof '%v' was sent more than once", proof.Secret)
+			}
+			sent[proof.Secret] = true
+		}
+	}
+	if len(sent) != numProofs {
+		t.Fatalf("expected %v proofs sent but got %v", numProofs, len(sent))
+	}
+	if wallet.GetBalance() != 0 {
+		t.Fatalf("expected balance of 0 but got %v", wallet.GetBalance())
+	}
+	if wallet.PendingBalance() != uint64(numProofs) {
+		t.Fatalf("expected pending balance of %v but got %v", numProofs, wallet.PendingBalance())
+	}
+}
+
+func TestPayPaymentRequestErrors(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	activeKeyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	mints := map[string]walletMint{
+		mintURL: {
+			mintURL:         mintURL,
+			activeKeyset:    *activeKeyset,
+			inactiveKeysets: map[string]crypto.WalletKeyset{},
+		},
+	}
+
+	dbpath := ".testwalletpaymentrequest"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	db.SaveKeyset(activeKeyset)
+	proofs := cashu.Proofs{{Amount: 8, Id: activeKeyset.Id, Secret: "secret8", C: "C"}}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	wallet := &Wallet{mints: mints, db: db, defaultMint: mintURL, unit: cashu.Sat}
+
+	request, err := wallet.CreatePaymentRequest(0, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(request.Mints) != 1 || request.Mints[0] != mintURL {
+		t.Fatalf("expected payment request with mints '%v' but got '%v'", []string{mintURL}, request.Mints)
+	}
+
+	receiverKey, _ := secp256k1.GeneratePrivateKey()
+	// nprofile without relays
+	nprofile, err := nostr.EncodeNprofile(receiverKey.PubKey(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		request       nut18.PaymentRequest
+		amount        uint64
+		expectedError error
+	}{
+		{
+			request:       *request,
+			amount:        0,
+			expectedError: ErrPaymentRequestAmount,
+		},
+		{
+			request:       nut18.PaymentRequest{Amount: 8, Unit: "usd"},
+			expectedError: cashu.ErrInvalidUnit,
+		},
+		{
+			request: nut18.PaymentRequest{
+				Amount:     8,
+				Transports: []nut18.Transport{{Type: "unknown", Target: "target"}},
+			},
+			expectedError: ErrTransportNotSupported,
+		},
+		{
+			request: nut18.PaymentRequest{
+				Amount: 8,
+				Transports: []nut18.Transport{
+					{Type: nut18.NostrTransport, Target: nprofile, Tags: [][]string{{"n", "04"}}},
+				},
+			},
+			expectedError: ErrTransportNotSupported,
+		},
+		{
+			request: nut18.PaymentRequest{
+				Amount:     8,
+				Transports: []nut18.Transport{{Type: nut18.NostrTransport, Target: nprofile}},
+			},
+			expectedError: ErrNoNostrRelays,
+		},
+		{
+			request:       nut18.PaymentRequest{Amount: 16},
+			expectedError: ErrInsufficientMintBalance,
+		},
+		{
+			request:       nut18.PaymentRequest{Amount: 8, Mints: []string{"http://othermint.com"}},
+			expectedError: ErrInsufficientMintBalance,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := wallet.PayPaymentRequest(test.request, test.amount)
+		if !errors.Is(err, test.expectedError) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedError, err)
+		}
+	}
+
+	payload := nut18.PaymentRequestPayload{Mint: "http://othermint.com", Unit: "sat", Proofs: proofs}
+	_, err = wallet.ReceivePaymentRequestPayload(payload)
+	if !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+}
+
+func TestDeriveNostrKey(t *testing.T) {
+	// test vector from NIP-06
+	mnemonic := "leader monkey parrot ring guide accident before fence cannon height naive bean"
+	seed := bip39.NewSeed(mnemonic, "")
+	masterKey, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key, err := DeriveNostrKey(masterKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedKey := "7f7ff03d123792d6ac594bfa67bf6d0c0ab55b6b1fdb6249303fe861f1ccba9a"
+	if hex.EncodeToString(key.Serialize()) != expectedKey {
+		t.Fatalf("expected key '%v' but got '%x'", expectedKey, key.Serialize())
+	}
+
+	expectedNpub := "npub1zutzeysacnf9rru6zqwmxd54mud0k44tst6l70ja5mhv8jjumytsd2x7nu"
+	wallet := &Wallet{nostrKey: key}
+	npub, err := wallet.NostrPublicKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if npub != expectedNpub {
+		t.Fatalf("expected npub '%v' but got '%v'", expectedNpub, npub)
+	}
+}
+
 func generateWalletKeyset(seed, derivationPath string, active bool, mintURL string) *crypto.WalletKeyset {
 	keys := make(map[uint64]*secp256k1.PublicKey, 64)
 
@@ -259,3 +551,1142 @@ func generateWalletKeyset(seed, derivationPath string, active bool, mintURL stri
 		PublicKeys: keys,
 	}
 }
+
+func TestBackup(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	activeKeyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	activeKeyset.Counter = 10
+	mints := map[string]walletMint{
+		mintURL: {
+			mintURL:         mintURL,
+			activeKeyset:    *activeKeyset,
+			inactiveKeysets: map[string]crypto.WalletKeyset{},
+		},
+	}
+
+	dbpath := ".testwalletbackup"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	mnemonic := "leader monkey parrot ring guide accident before fence cannon height naive bean"
+	db.SaveMnemonicSeed(mnemonic, bip39.NewSeed(mnemonic, ""))
+	db.SaveKeyset(activeKeyset)
+
+	proofs := cashu.Proofs{}
+	for _, amount := range []uint64{1, 2, 4, 8} {
+		proofs = append(proofs, cashu.Proof{
+			Amount: amount,
+			Id:     activeKeyset.Id,
+			Secret: "secret" + strconv.FormatUint(amount, 10),
+			C:      "C",
+		})
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	wallet := &Wallet{mints: mints, db: db, defaultMint: mintURL}
+
+	backupPath := dbpath + "/backup.json"
+	passphrase := "correct horse battery staple"
+	if err := wallet.ExportBackup(backupPath, passphrase); err != nil {
+		t.Fatalf("unexpected error exporting backup: %v", err)
+	}
+
+	if _, err := wallet.ImportBackup(backupPath, "wrong passphrase"); !errors.Is(err, ErrInvalidBackupPassphrase) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidBackupPassphrase, err)
+	}
+
+	// importing in the same wallet should not duplicate anything
+	amountImported, err := wallet.ImportBackup(backupPath, passphrase)
+	if err != nil {
+		t.Fatalf("unexpected error importing backup: %v", err)
+	}
+	if amountImported != 0 {
+		t.Fatalf("expected imported amount of 0 but got %v", amountImported)
+	}
+	if wallet.GetBalance() != 15 {
+		t.Fatalf("expected balance of 15 but got %v", wallet.GetBalance())
+	}
+
+	// import in wallet from different seed that already has one of the proofs
+	dbpath2 := ".testwalletbackup2"
+	if err := os.MkdirAll(dbpath2, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath2)
+
+	db2, err := InitStorage(dbpath2, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	mnemonic2 := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	db2.SaveMnemonicSeed(mnemonic2, bip39.NewSeed(mnemonic2, ""))
+	if err := db2.SaveProofs(proofs[:1]); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	wallet2 := &Wallet{mints: map[string]walletMint{}, db: db2}
+
+	amountImported, err = wallet2.ImportBackup(backupPath, passphrase)
+	if err != nil {
+		t.Fatalf("unexpected error importing backup: %v", err)
+	}
+	if amountImported != 14 {
+		t.Fatalf("expected imported amount of 14 but got %v", amountImported)
+	}
+	if wallet2.GetBalance() != 15 {
+		t.Fatalf("expected balance of 15 but got %v", wallet2.GetBalance())
+	}
+	if _, ok := wallet2.mints[mintURL]; !ok {
+		t.Fatalf("expected mint '%v' to be trusted after import", mintURL)
+	}
+	// counters from a different seed should not be imported
+	if counter := db2.GetKeysetCounter(activeKeyset.Id); counter != 0 {
+		t.Fatalf("expected keyset counter of 0 but got %v", counter)
+	}
+
+	// restore new wallet from backup
+	restorePath := ".testwalletbackuprestore"
+	defer os.RemoveAll(restorePath)
+	amountRestored, err := RestoreFromBackup(restorePath, SQLiteStorage, backupPath, passphrase)
+	if err != nil {
+		t.Fatalf("unexpected error restoring from backup: %v", err)
+	}
+	if amountRestored != 15 {
+		t.Fatalf("expected restored amount of 15 but got %v", amountRestored)
+	}
+	if _, err := RestoreFromBackup(restorePath, SQLiteStorage, backupPath, passphrase); err == nil {
+		t.Fatal("expected error restoring into existing wallet")
+	}
+
+	restoredDB, err := InitStorage(restorePath, SQLiteStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	defer restoredDB.Close()
+	if restoredDB.GetMnemonic() != mnemonic {
+		t.Fatalf("expected mnemonic '%v' but got '%v'", mnemonic, restoredDB.GetMnemonic())
+	}
+	if counter := restoredDB.GetKeysetCounter(activeKeyset.Id); counter != 10 {
+		t.Fatalf("expected keyset counter of 10 but got %v", counter)
+	}
+
+	// tampering with the parameters of the file should fail decryption
+	fileBytes, err := os.ReadFile(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file backupFile
+	if err := json.Unmarshal(fileBytes, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.N = file.N / 2
+	if _, err := decryptBackup(file, passphrase); !errors.Is(err, ErrInvalidBackupPassphrase) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvalidBackupPassphrase, err)
+	}
+	file.Version = 2
+	if _, err := decryptBackup(file, passphrase); !errors.Is(err, ErrUnsupportedBackupVersion) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrUnsupportedBackupVersion, err)
+	}
+}
+
+func TestProofsToConsolidate(t *testing.T) {
+	proofs := cashu.Proofs{}
+	addProofs := func(amount uint64, n int) {
+		for i := 0; i < n; i++ {
+			proofs = append(proofs, cashu.Proof{Amount: amount, Secret: strconv.Itoa(len(proofs))})
+		}
+	}
+	addProofs(1, 12)
+	addProofs(2, 10)
+	addProofs(8, 4)
+	addProofs(16, 11)
+
+	selected := proofsToConsolidate(proofs, 10, proofsTargetPerAmount)
+	// proofsTargetPerAmount of each amount over the threshold are kept
+	expectedLen := 12 - proofsTargetPerAmount + 11 - proofsTargetPerAmount
+	if len(selected) != expectedLen {
+		t.Fatalf("expected '%v' proofs but got '%v'", expectedLen, len(selected))
+	}
+	for _, proof := range selected {
+		if proof.Amount != 1 && proof.Amount != 16 {
+			t.Fatalf("unexpected proof of amount '%v' selected", proof.Amount)
+		}
+	}
+
+	// default threshold
+	selected = proofsToConsolidate(proofs, 0, proofsTargetPerAmount)
+	if len(selected) != expectedLen {
+		t.Fatalf("expected '%v' proofs but got '%v'", expectedLen, len(selected))
+	}
+
+	selected = proofsToConsolidate(proofs, 12, proofsTargetPerAmount)
+	if len(selected) != 0 {
+		t.Fatalf("expected no proofs but got '%v'", len(selected))
+	}
+}
+
+func TestSplitWalletTarget(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	activeKeyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	mints := map[string]walletMint{
+		mintURL: {
+			mintURL:         mintURL,
+			activeKeyset:    *activeKeyset,
+			inactiveKeysets: map[string]crypto.WalletKeyset{},
+		},
+	}
+
+	dbpath := ".testwalletsplit"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	db.SaveKeyset(activeKeyset)
+
+	// wallet already has 2 proofs of 1
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: activeKeyset.Id, Secret: "secret1", C: "C"},
+		{Amount: 1, Id: activeKeyset.Id, Secret: "secret2", C: "C"},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	tests := []struct {
+		strategy SplitStrategy
+		amount   uint64
+		expected []uint64
+	}{
+		// default of 3 proofs of each amount
+		{
+			strategy: SplitStrategy{},
+			amount:   10,
+			expected: []uint64{1, 1, 2, 2, 2, 2},
+		},
+		{
+			strategy: SplitStrategy{ProofsPerAmount: 4},
+			amount:   20,
+			expected: []uint64{1, 1, 2, 2, 2, 2, 2, 4, 4},
+		},
+		// amounts above the cap are not targeted
+		{
+			strategy: SplitStrategy{ProofsPerAmount: 3, MaxAmount: 2},
+			amount:   20,
+			expected: []uint64{1, 2, 2, 2, 1, 4, 8},
+		},
+	}
+
+	for _, test := range tests {
+		wallet := &Wallet{mints: mints, db: db, defaultMint: mintURL, splitStrategy: test.strategy}
+		split := wallet.splitWalletTarget(test.amount, mintURL)
+		slices.Sort(test.expected)
+		if !reflect.DeepEqual(split, test.expected) {
+			t.Fatalf("expected split '%v' but got '%v'", test.expected, split)
+		}
+	}
+}
+
+func TestMintCapabilities(t *testing.T) {
+	mintInfo := &nut06.MintInfo{
+		Nuts: nut06.Nuts{
+			Nut04: nut06.NutSetting{
+				Methods: []nut06.MethodSetting{
+					{Method: cashu.BOLT11_METHOD, Unit: "sat", MaxAmount: 10000},
+					{Method: cashu.BOLT11_METHOD, Unit: "usd"},
+				},
+			},
+			Nut05: nut06.NutSetting{Disabled: true},
+			Nut07: nut06.Supported{Supported: true},
+			Nut11: nut06.Supported{Supported: true},
+			Nut15: &nut06.NutSetting{
+				Methods: []nut06.MethodSetting{{Method: cashu.BOLT11_METHOD, Unit: "usd"}},
+			},
+			Nut17: nut17.InfoSetting{
+				Supported: []nut17.SupportedMethod{
+					{
+						Method:   cashu.BOLT11_METHOD,
+						Unit:     "sat",
+						Commands: []string{"bolt11_mint_quote", "proof_state", "unknown_command"},
+					},
+				},
+			},
+		},
+	}
+
+	capabilities := capabilitiesFromInfo(mintInfo, cashu.Sat)
+	expectedMintMethods := []nut06.MethodSetting{{Method: cashu.BOLT11_METHOD, Unit: "sat", MaxAmount: 10000}}
+	if !reflect.DeepEqual(capabilities.MintMethods, expectedMintMethods) {
+		t.Fatalf("expected mint methods '%v' but got '%v'", expectedMintMethods, capabilities.MintMethods)
+	}
+	if !capabilities.MeltingDisabled {
+		t.Fatal("expected melting to be disabled")
+	}
+	if !capabilities.TokenStateCheck || !capabilities.P2PK {
+		t.Fatal("expected NUT-07 and NUT-11 to be supported")
+	}
+	if capabilities.Restore || capabilities.HTLC {
+		t.Fatal("expected NUT-09 and NUT-14 to not be supported")
+	}
+	// NUT-15 only supported for usd
+	if capabilities.MultiPathPayments {
+		t.Fatal("expected multi path payments to not be supported")
+	}
+	expectedSubscriptions := []nut17.SubscriptionKind{nut17.Bolt11MintQuote, nut17.ProofState}
+	if !reflect.DeepEqual(capabilities.Subscriptions, expectedSubscriptions) {
+		t.Fatalf("expected subscriptions '%v' but got '%v'", expectedSubscriptions, capabilities.Subscriptions)
+	}
+	if capabilities.SupportsSubscription(nut17.Bolt11MeltQuote) {
+		t.Fatal("expected melt quote subscriptions to not be supported")
+	}
+
+	// cached capabilities are returned without making a request to the mint
+	mintURL := "http://nonexistent.mint"
+	wallet := &Wallet{mintCapabilities: map[string]*MintCapabilities{mintURL: capabilities}}
+	cached, err := wallet.MintCapabilities(mintURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cached != capabilities {
+		t.Fatal("expected cached capabilities")
+	}
+
+	// stale capabilities are fetched again
+	capabilities.FetchedAt = time.Now().Add(-mintCapabilitiesTTL)
+	if _, err := wallet.MintCapabilities(mintURL); err == nil {
+		t.Fatal("expected error fetching capabilities from nonexistent mint")
+	}
+}
+
+func TestUnitAccounts(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	satKeyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	usdKeyset := generateWalletKeyset("key2", "0/0/1", true, mintURL)
+	usdKeyset.Unit = cashu.Usd.String()
+
+	dbpath := ".testwalletunits"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	db.SaveKeyset(satKeyset)
+	db.SaveKeyset(usdKeyset)
+
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: satKeyset.Id, Secret: "secret1", C: C},
+		{Amount: 4, Id: satKeyset.Id, Secret: "secret2", C: C},
+		{Amount: 2, Id: usdKeyset.Id, Secret: "secret3", C: C},
+		{Amount: 8, Id: usdKeyset.Id, Secret: "secret4", C: C},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	wallet := &Wallet{db: db, defaultMint: mintURL}
+	mints, err := wallet.loadWalletMints()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wallet.mints = mints
+	if wallet.mints[mintURL].activeKeyset.Id != satKeyset.Id {
+		t.Fatalf("expected active keyset '%v' but got '%v'", satKeyset.Id, wallet.mints[mintURL].activeKeyset.Id)
+	}
+
+	if wallet.GetBalance() != 5 {
+		t.Fatalf("expected balance of 5 but got %v", wallet.GetBalance())
+	}
+	balances := wallet.GetBalanceByUnit()
+	if balances[cashu.Sat] != 5 || balances[cashu.Usd] != 10 {
+		t.Fatalf("expected balances of 5 sat and 10 usd but got %v", balances)
+	}
+
+	usdAccount, err := wallet.Account(cashu.Usd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if usdAccount.GetBalance() != 10 {
+		t.Fatalf("expected balance of 10 but got %v", usdAccount.GetBalance())
+	}
+	if usdAccount.mints[mintURL].activeKeyset.Id != usdKeyset.Id {
+		t.Fatalf("expected active keyset '%v' but got '%v'", usdKeyset.Id, usdAccount.mints[mintURL].activeKeyset.Id)
+	}
+	account, err := usdAccount.Account(cashu.Usd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if account != usdAccount {
+		t.Fatal("expected account for the unit to be reused")
+	}
+
+	usdToken, err := cashu.NewTokenV4(proofs[2:], mintURL, cashu.Usd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.checkTokenUnit(usdToken); !errors.Is(err, cashu.ErrInvalidUnit) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.ErrInvalidUnit, err)
+	}
+	if err := usdAccount.checkTokenUnit(usdToken); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// token that says sat but has proofs from a usd keyset
+	mixedToken, err := cashu.NewTokenV4(proofs, mintURL, cashu.Sat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.checkTokenUnit(mixedToken); !errors.Is(err, cashu.ErrInvalidUnit) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.ErrInvalidUnit, err)
+	}
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestLoadWalletConfig(t *testing.T) {
+	if _, err := LoadWallet(Config{}); err == nil {
+		t.Fatal("expected error loading wallet without mint url")
+	}
+	_, err := LoadWallet(Config{CurrentMintURL: "http://localhost:3338", Unit: cashu.Unit(10)})
+	if !errors.Is(err, cashu.ErrInvalidUnit) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.ErrInvalidUnit, err)
+	}
+
+	var keysets []*crypto.WalletKeyset
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := nut02.GetKeysetsResponse{}
+		for _, keyset := range keysets {
+			response.Keysets = append(response.Keysets, nut02.Keyset{Id: keyset.Id, Unit: keyset.Unit, Active: true})
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	satKeyset := generateWalletKeyset("key1", "0/0/0", true, server.URL)
+	usdKeyset := generateWalletKeyset("key2", "0/0/1", true, server.URL)
+	usdKeyset.Unit = cashu.Usd.String()
+	keysets = []*crypto.WalletKeyset{satKeyset, usdKeyset}
+
+	dbpath := ".testwalletconfig"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	db.SaveKeyset(satKeyset)
+	db.SaveKeyset(usdKeyset)
+
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: satKeyset.Id, Secret: "secret1", C: C},
+		{Amount: 2, Id: usdKeyset.Id, Secret: "secret2", C: C},
+		{Amount: 8, Id: usdKeyset.Id, Secret: "secret3", C: C},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	transport := &countingTransport{}
+	config := Config{CurrentMintURL: server.URL, Unit: cashu.Usd}
+	wallet, err := LoadWallet(config, WithStorage(db), WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatalf("unexpected error loading wallet: %v", err)
+	}
+	defer wallet.Shutdown()
+
+	if wallet.Unit() != cashu.Usd {
+		t.Fatalf("expected wallet unit '%v' but got '%v'", cashu.Usd, wallet.Unit())
+	}
+	if balance := wallet.GetBalance(); balance != 10 {
+		t.Fatalf("expected balance of 10 but got %v", balance)
+	}
+	if transport.requests == 0 {
+		t.Fatal("expected requests to mint to go through custom http client")
+	}
+}
+
+func TestLabels(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	keyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+
+	dbpath := ".testwalletlabels"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, SQLiteStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	defer db.Close()
+	db.SaveKeyset(keyset)
+
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: keyset.Id, Secret: "secret1", C: C},
+		{Amount: 4, Id: keyset.Id, Secret: "secret2", C: C},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	wallet := &Wallet{db: db, defaultMint: mintURL}
+
+	token, err := cashu.NewTokenV4(proofs, mintURL, cashu.Sat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Memo = "tip from alice"
+	wallet.saveReceiveTransaction(token, mintURL, token.Amount())
+
+	history := wallet.GetHistory(storage.TransactionFilter{})
+	if len(history) != 1 {
+		t.Fatalf("expected 1 transaction but got %v", len(history))
+	}
+	if history[0].Memo != token.Memo {
+		t.Fatalf("expected memo '%v' but got '%v'", token.Memo, history[0].Memo)
+	}
+
+	if err := wallet.LabelTransaction(history[0].Id, " "); err == nil {
+		t.Fatal("expected error adding empty label")
+	}
+	if err := wallet.LabelTransaction(history[0].Id, "tips"); err != nil {
+		t.Fatalf("unexpected error labeling transaction: %v", err)
+	}
+	history = wallet.GetHistory(storage.TransactionFilter{Label: "tips"})
+	if len(history) != 1 || !slices.Equal(history[0].Labels, []string{"tips"}) {
+		t.Fatalf("expected transaction with label 'tips' but got '%+v'", history)
+	}
+
+	if err := wallet.LabelProofs(proofs[:1], "tips"); err != nil {
+		t.Fatalf("unexpected error labeling proofs: %v", err)
+	}
+	labeled := wallet.GetProofsByLabel("tips")
+	if len(labeled) != 1 || labeled[0].Secret != proofs[0].Secret {
+		t.Fatalf("expected proof '%v' with label but got '%v'", proofs[0].Secret, labeled)
+	}
+	if unlabeled := wallet.GetProofsByLabel(""); len(unlabeled) != 1 {
+		t.Fatalf("expected 1 proof without label but got %v", len(unlabeled))
+	}
+}
+
+func TestCounterReservedBeforeSwap(t *testing.T) {
+	var keyset *crypto.WalletKeyset
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/keysets":
+			json.NewEncoder(w).Encode(nut02.GetKeysetsResponse{
+				Keysets: []nut02.Keyset{{Id: keyset.Id, Unit: keyset.Unit, Active: true}},
+			})
+		case "/v1/swap":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(cashu.ProofAlreadyUsedErr)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	keyset = generateWalletKeyset("key1", "0/0/0", true, server.URL)
+
+	dbpath := ".testwalletcounter"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	defer db.Close()
+	db.SaveKeyset(keyset)
+
+	seed, _ := hdkeychain.GenerateSeed(16)
+	masterKey, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	wallet := &Wallet{
+		db:          db,
+		masterKey:   masterKey,
+		defaultMint: server.URL,
+		mints: map[string]walletMint{
+			server.URL: {mintURL: server.URL, activeKeyset: *keyset},
+		},
+	}
+
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: keyset.Id, Secret: "secret1", C: C},
+		{Amount: 4, Id: keyset.Id, Secret: "secret2", C: C},
+	}
+	token, err := cashu.NewTokenV4(proofs, server.URL, cashu.Sat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the counter is moved past the outputs sent to the mint
+	// even if the request fails, so they are not used again
+	var previousCounter uint32
+	for i := 0; i < 2; i++ {
+		if _, err := wallet.Receive(token, false); err == nil {
+			t.Fatal("expected error receiving token but got nil")
+		}
+		counter := db.GetKeysetCounter(keyset.Id)
+		if counter <= previousCounter {
+			t.Fatalf("expected counter to be greater than %v but got %v", previousCounter, counter)
+		}
+		previousCounter = counter
+	}
+}
+
+func TestReceiveSeenProofs(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	dbpath := ".testwalletseen"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, SQLiteStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	defer db.Close()
+	wallet := &Wallet{db: db, defaultMint: mintURL}
+
+	keyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: keyset.Id, Secret: "secret1", C: C},
+		{Amount: 2, Id: keyset.Id, Secret: "secret2", C: C},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatal(err)
+	}
+
+	// proofs in the wallet
+	token, _ := cashu.NewTokenV4(proofs, mintURL, cashu.Sat, false)
+	if _, err := wallet.Receive(token, false); !errors.Is(err, ErrTokenAlreadyReceived) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrTokenAlreadyReceived, err)
+	}
+	if _, err := wallet.ReceiveAll([]cashu.Token{token}); !errors.Is(err, ErrTokenAlreadyReceived) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrTokenAlreadyReceived, err)
+	}
+
+	// proofs pending from a send can be received back
+	db.DeleteProof(proofs[0].Secret)
+	if err := db.AddPendingProofs(proofs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	Ys, _ := proofYs(proofs[:1])
+	if err := wallet.checkProofsNotSeen(Ys); err != nil {
+		t.Fatalf("unexpected error checking pending proofs: %v", err)
+	}
+
+	// proofs spent by the wallet
+	db.DeletePendingProofs(Ys)
+	if err := wallet.checkProofsNotSeen(Ys); !errors.Is(err, ErrTokenAlreadyReceived) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrTokenAlreadyReceived, err)
+	}
+
+	Ys, _ = proofYs(cashu.Proofs{{Amount: 1, Id: keyset.Id, Secret: "secret3", C: C}})
+	if err := wallet.checkProofsNotSeen(Ys); err != nil {
+		t.Fatalf("unexpected error checking new proofs: %v", err)
+	}
+}
+
+func TestVerifyProofsDLEQMultipleKeysets(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	activeKeyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	inactiveKeyset := generateWalletKeyset("key2", "0/0/0", false, mintURL)
+	wallet := &Wallet{
+		mints: map[string]walletMint{
+			mintURL: {
+				mintURL:         mintURL,
+				activeKeyset:    *activeKeyset,
+				inactiveKeysets: map[string]crypto.WalletKeyset{inactiveKeyset.Id: *inactiveKeyset},
+			},
+		},
+	}
+
+	// batch with proofs from tokens of both keysets of the mint
+	proofs := cashu.Proofs{
+		dleqProof(t, "key1", "0/0/0", activeKeyset.Id, 4, "secret1"),
+		dleqProof(t, "key2", "0/0/0", inactiveKeyset.Id, 8, "secret2"),
+		dleqProof(t, "key2", "0/0/0", inactiveKeyset.Id, 1, "secret3"),
+	}
+	if err := wallet.verifyProofsDLEQ(proofs, mintURL); err != nil {
+		t.Fatalf("unexpected error verifying DLEQ proofs: %v", err)
+	}
+
+	// proof claiming the inactive keyset but signed with the key of the active one
+	invalid := dleqProof(t, "key1", "0/0/0", inactiveKeyset.Id, 2, "secret4")
+	if err := wallet.verifyProofsDLEQ(append(proofs, invalid), mintURL); err == nil {
+		t.Fatal("expected error verifying invalid DLEQ proof")
+	}
+}
+
+// dleqProof returns a proof for the keyset id signed with the key generated in
+// generateWalletKeyset from seed and derivationPath, with its DLEQ proof
+func dleqProof(t *testing.T, seed, derivationPath, keysetId string, amount uint64, secret string) cashu.Proof {
+	hash := sha256.Sum256([]byte(seed + derivationPath + strconv.FormatUint(amount, 10)))
+	k, K := btcec.PrivKeyFromBytes(hash[:])
+
+	r, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	B_, r, err := crypto.BlindMessage(secret, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	C_ := crypto.SignBlindedMessage(B_, k)
+	e, s := crypto.GenerateDLEQ(k, B_, C_)
+	C := crypto.UnblindSignature(C_, r, K)
+
+	return cashu.Proof{
+		Amount: amount,
+		Id:     keysetId,
+		Secret: secret,
+		C:      hex.EncodeToString(C.SerializeCompressed()),
+		DLEQ: &cashu.DLEQProof{
+			E: hex.EncodeToString(e.Serialize()),
+			S: hex.EncodeToString(s.Serialize()),
+			R: hex.EncodeToString(r.Serialize()),
+		},
+	}
+}
+
+func TestQuoteMeltAcrossMints(t *testing.T) {
+	invoice := "lnbcrt20u1pnn00ztpp5h6frn7fk93jurxpygwnkck2u7dc05c2he7l7amgna7ngteeynk2qdqqcqzzsxqyz5vqsp5s6fw9g7twqcv5h9pv74vutwj7v3f4xy8jgtwww05mt0lp0sl8zsq9qyyssqt9khadm8v7mzc7z7rkuah4xqncrsjfxueqjfv2enze7vvha478asgztpfdw9c6redv2zr4xru7t6k6epfsw50tguzc08g88up0ct08gpalvp8d"
+
+	meltQuoteServer := func(feeReserve uint64) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/melt/quote/bolt11" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"quote":       "quote" + strconv.FormatUint(feeReserve, 10),
+				"request":     invoice,
+				"amount":      2000,
+				"unit":        "sat",
+				"fee_reserve": feeReserve,
+				"state":       nut05.Unpaid.String(),
+			})
+		}))
+	}
+	// cheaper fee reserve but proofs with input fees
+	mint1 := meltQuoteServer(10)
+	defer mint1.Close()
+	mint2 := meltQuoteServer(20)
+	defer mint2.Close()
+	mint3 := meltQuoteServer(2)
+	defer mint3.Close()
+
+	dbpath := ".testwalletmeltquotes"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	defer db.Close()
+
+	wallet := &Wallet{db: db, defaultMint: mint1.URL, mints: make(map[string]walletMint)}
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	for i, mint := range []struct {
+		url         string
+		balance     uint64
+		inputFeePpk uint
+	}{
+		{url: mint1.URL, balance: 4096, inputFeePpk: 20000},
+		{url: mint2.URL, balance: 4096},
+		// not enough balance to pay the invoice
+		{url: mint3.URL, balance: 1024},
+	} {
+		keyset := generateWalletKeyset("key"+strconv.Itoa(i), "0/0/0", true, mint.url)
+		keyset.InputFeePpk = mint.inputFeePpk
+		wallet.mints[mint.url] = walletMint{mintURL: mint.url, activeKeyset: *keyset}
+
+		var proofs cashu.Proofs
+		for _, amount := range cashu.AmountSplit(mint.balance) {
+			proofs = append(proofs, cashu.Proof{Amount: amount, Id: keyset.Id, Secret: mint.url + strconv.FormatUint(amount, 10), C: C})
+		}
+		if err := db.SaveProofs(proofs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	quotes, err := wallet.QuoteMeltAcrossMints(invoice)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quotes: %v", err)
+	}
+	if len(quotes) != 2 {
+		t.Fatalf("expected 2 melt quotes but got %v", len(quotes))
+	}
+
+	expectedCosts := []struct {
+		mint      string
+		inputFees uint64
+		totalCost uint64
+	}{
+		{mint: mint2.URL, inputFees: 0, totalCost: 2020},
+		{mint: mint1.URL, inputFees: 20, totalCost: 2030},
+	}
+	for i, expected := range expectedCosts {
+		if quotes[i].Mint != expected.mint {
+			t.Fatalf("expected quote from mint '%v' but got '%v'", expected.mint, quotes[i].Mint)
+		}
+		if quotes[i].InputFees != expected.inputFees {
+			t.Fatalf("expected input fees of %v but got %v", expected.inputFees, quotes[i].InputFees)
+		}
+		if quotes[i].TotalCost != expected.totalCost {
+			t.Fatalf("expected total cost of %v but got %v", expected.totalCost, quotes[i].TotalCost)
+		}
+		// quotes are saved so they can be paid
+		if quote := db.GetMeltQuoteById(quotes[i].Quote.Quote); quote == nil || quote.Mint != expected.mint {
+			t.Fatalf("expected melt quote '%v' to be saved", quotes[i].Quote.Quote)
+		}
+	}
+}
+
+func TestMintInvoice(t *testing.T) {
+	invoice := MintInvoice{
+		QuoteId: "quote1",
+		Request: "lnbcrt21u1pn5q8hzpp5",
+		Amount:  2100,
+	}
+
+	if invoice.URI() != "lightning:lnbcrt21u1pn5q8hzpp5" {
+		t.Fatalf("expected URI 'lightning:lnbcrt21u1pn5q8hzpp5' but got '%v'", invoice.URI())
+	}
+	if invoice.QRContent() != "LIGHTNING:LNBCRT21U1PN5Q8HZPP5" {
+		t.Fatalf("expected QR content 'LIGHTNING:LNBCRT21U1PN5Q8HZPP5' but got '%v'", invoice.QRContent())
+	}
+
+	if invoice.Expired() {
+		t.Fatal("expected invoice without expiry to not be expired")
+	}
+	invoice.Expiry = uint64(time.Now().Add(time.Hour).Unix())
+	if invoice.Expired() {
+		t.Fatal("expected invoice to not be expired")
+	}
+	invoice.Expiry = uint64(time.Now().Add(-time.Minute).Unix())
+	if !invoice.Expired() {
+		t.Fatal("expected invoice to be expired")
+	}
+}
+
+func TestNeedsSync(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		quote    storage.MintQuote
+		expected bool
+	}{
+		{
+			quote:    storage.MintQuote{State: nut04.Unpaid, Method: cashu.BOLT11_METHOD},
+			expected: true,
+		},
+		{
+			quote:    storage.MintQuote{State: nut04.Paid, QuoteExpiry: uint64(now.Add(-48 * time.Hour).Unix())},
+			expected: true,
+		},
+		{
+			quote:    storage.MintQuote{State: nut04.Unpaid, QuoteExpiry: uint64(now.Add(time.Hour).Unix())},
+			expected: true,
+		},
+		{
+			quote:    storage.MintQuote{State: nut04.Unpaid, QuoteExpiry: uint64(now.Add(-time.Hour).Unix())},
+			expected: true,
+		},
+		{
+			quote:    storage.MintQuote{State: nut04.Unpaid, QuoteExpiry: uint64(now.Add(-48 * time.Hour).Unix())},
+			expected: false,
+		},
+		{
+			quote:    storage.MintQuote{State: nut04.Issued},
+			expected: false,
+		},
+		{
+			quote:    storage.MintQuote{State: nut04.Unpaid, Method: "bolt12"},
+			expected: false,
+		},
+	}
+
+	for i, test := range tests {
+		if needsSync(test.quote) != test.expected {
+			t.Fatalf("test %v: expected %v but got %v", i, test.expected, !test.expected)
+		}
+	}
+}
+
+func TestTokenSigners(t *testing.T) {
+	privateKey, _ := btcec.NewPrivateKey()
+	nostrKey, _ := btcec.NewPrivateKey()
+	otherKey, _ := btcec.NewPrivateKey()
+	walletPubkey := hex.EncodeToString(privateKey.PubKey().SerializeCompressed())
+	nostrPubkey := hex.EncodeToString(nostrKey.PubKey().SerializeCompressed())
+	otherPubkey := hex.EncodeToString(otherKey.PubKey().SerializeCompressed())
+
+	wallet := &Wallet{privateKey: privateKey, nostrKey: nostrKey}
+
+	lockedProofs := func(data string, tags [][]string, amounts ...uint64) cashu.Proofs {
+		proofs := cashu.Proofs{}
+		for _, amount := range amounts {
+			secret, err := nut10.NewSecretFromSpendingCondition(nut10.SpendingCondition{
+				Kind: nut10.P2PK,
+				Data: data,
+				Tags: tags,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			proofs = append(proofs, cashu.Proof{
+				Amount: amount,
+				Id:     "00ad268c4d1f5826",
+				Secret: secret,
+				C:      "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf",
+			})
+		}
+		return proofs
+	}
+	newToken := func(proofs cashu.Proofs) cashu.Token {
+		token, err := cashu.NewTokenV4(proofs, "http://localhost:3338", cashu.Sat, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// 2-of-2 with the key of the wallet and its nostr key
+	multisigTags := [][]string{{"n_sigs", "2"}, {"pubkeys", nostrPubkey}}
+	proofs := lockedProofs(walletPubkey, multisigTags, 1, 2)
+	signers, err := wallet.TokenSigners(newToken(proofs))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("expected 1 group of signers but got %v", len(signers))
+	}
+	if signers[0].NSigs != 2 || !signers[0].CanSign() || signers[0].Amount != 3 {
+		t.Fatalf("expected wallet to be able to sign 2 signatures for amount 3 but got %+v", signers[0])
+	}
+
+	signedProofs, _, err := wallet.signP2PKInputs(proofs)
+	if err != nil {
+		t.Fatalf("unexpected error signing: %v", err)
+	}
+	for _, proof := range signedProofs {
+		secret, _ := nut10.DeserializeSecret(proof.Secret)
+		if err := nut11.VerifyP2PKLockedProof(proof, secret); err != nil {
+			t.Fatalf("unexpected error verifying signatures: %v", err)
+		}
+	}
+
+	// 2-of-2 with a key the wallet does not have
+	proofs = lockedProofs(walletPubkey, [][]string{{"n_sigs", "2"}, {"pubkeys", otherPubkey}}, 4)
+	signers, err = wallet.TokenSigners(newToken(proofs))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signers[0].CanSign() {
+		t.Fatal("expected wallet to not be able to sign")
+	}
+	missing := signers[0].MissingSigners()
+	if !reflect.DeepEqual(missing, []string{otherPubkey}) {
+		t.Fatalf("expected missing signers %v but got %v", []string{otherPubkey}, missing)
+	}
+
+	_, _, err = wallet.signP2PKInputs(proofs)
+	if !errors.Is(err, ErrMissingSigners) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMissingSigners, err)
+	}
+
+	// locked to a key the wallet does not have
+	proofs = lockedProofs(otherPubkey, nil, 8)
+	_, _, err = wallet.signP2PKInputs(proofs)
+	if !errors.Is(err, ErrMissingSigners) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMissingSigners, err)
+	}
+}
+
+func TestContacts(t *testing.T) {
+	dbpath := ".testwalletcontacts"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	defer db.Close()
+	wallet := &Wallet{db: db}
+
+	privateKey, _ := secp256k1.GeneratePrivateKey()
+	publicKey := hex.EncodeToString(privateKey.PubKey().SerializeCompressed())
+	npub, _ := nostr.EncodeNpub(privateKey.PubKey())
+
+	invalidContacts := []storage.Contact{
+		{Name: " ", PublicKey: publicKey},
+		{Name: "alice"},
+		{Name: "alice", PublicKey: "02abcd"},
+		{Name: "alice", Nostr: "npub1invalid"},
+		{Name: "alice", LightningAddress: "alice"},
+	}
+	for _, contact := range invalidContacts {
+		if err := wallet.AddContact(contact); err == nil {
+			t.Fatalf("expected error adding invalid contact '%+v'", contact)
+		}
+	}
+
+	if err := wallet.AddContact(storage.Contact{Name: " bob ", LightningAddress: "bob@example.com"}); err != nil {
+		t.Fatalf("unexpected error adding contact: %v", err)
+	}
+	alice := storage.Contact{Name: "alice", PublicKey: publicKey, Nostr: npub}
+	if err := wallet.AddContact(alice); err != nil {
+		t.Fatalf("unexpected error adding contact: %v", err)
+	}
+
+	contacts := wallet.Contacts()
+	if len(contacts) != 2 || contacts[0].Name != "alice" || contacts[1].Name != "bob" {
+		t.Fatalf("expected contacts 'alice' and 'bob' but got %+v", contacts)
+	}
+
+	// lightning address only contacts cannot be sent ecash
+	if _, err := wallet.SendToContact(10, "http://localhost:3338", "bob", true); err == nil {
+		t.Fatal("expected error sending to contact without public key or nostr profile")
+	}
+
+	exported, err := wallet.ExportContacts()
+	if err != nil {
+		t.Fatalf("unexpected error exporting contacts: %v", err)
+	}
+
+	if err := wallet.RemoveContact("alice"); err != nil {
+		t.Fatalf("unexpected error removing contact: %v", err)
+	}
+	if err := wallet.RemoveContact("alice"); !errors.Is(err, ErrContactNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrContactNotFound, err)
+	}
+	if _, err := wallet.GetContact("alice"); !errors.Is(err, ErrContactNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrContactNotFound, err)
+	}
+
+	// nothing is imported if a contact is invalid
+	invalid := []byte(`[{"name": "carol", "pubkey": "` + publicKey + `"}, {"name": "dave"}]`)
+	if _, err := wallet.ImportContacts(invalid); err == nil {
+		t.Fatal("expected error importing invalid contacts")
+	}
+	if len(wallet.Contacts()) != 1 {
+		t.Fatalf("expected 1 contact but got %v", len(wallet.Contacts()))
+	}
+
+	imported, err := wallet.ImportContacts(exported)
+	if err != nil {
+		t.Fatalf("unexpected error importing contacts: %v", err)
+	}
+	if imported != 2 {
+		t.Fatalf("expected 2 contacts imported but got %v", imported)
+	}
+	contact, err := wallet.GetContact("alice")
+	if err != nil {
+		t.Fatalf("unexpected error getting contact: %v", err)
+	}
+	if *contact != alice {
+		t.Fatalf("expected contact '%+v' but got '%+v'", alice, *contact)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	mintURL := "http://localhost:3338"
+	dbpath := ".testwalletevents"
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := InitStorage(dbpath, BoltStorage)
+	if err != nil {
+		t.Fatalf("InitStorage: %v", err)
+	}
+	defer db.Close()
+	wallet := &Wallet{db: db, defaultMint: mintURL, unit: cashu.Sat}
+
+	var events []Event
+	unsubscribe := wallet.Subscribe(func(event Event) {
+		events = append(events, event)
+	})
+
+	if _, err := wallet.MintTokens("unknownquote"); !errors.Is(err, ErrQuoteNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrQuoteNotFound, err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event but got %v", len(events))
+	}
+	if events[0].Type != ErrorEvent || events[0].Quote != "unknownquote" || !errors.Is(events[0].Err, ErrQuoteNotFound) {
+		t.Fatalf("expected error event for quote but got %+v", events[0])
+	}
+
+	keyset := generateWalletKeyset("key1", "0/0/0", true, mintURL)
+	C := "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf"
+	proofs := cashu.Proofs{{Amount: 1, Id: keyset.Id, Secret: "secret1", C: C}}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatal(err)
+	}
+	token, _ := cashu.NewTokenV4(proofs, mintURL, cashu.Sat, false)
+	if _, err := wallet.Receive(token, false); !errors.Is(err, ErrTokenAlreadyReceived) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrTokenAlreadyReceived, err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events but got %v", len(events))
+	}
+	if events[1].Type != ErrorEvent || events[1].Mint != mintURL || !errors.Is(events[1].Err, ErrTokenAlreadyReceived) {
+		t.Fatalf("expected error event for token but got %+v", events[1])
+	}
+
+	// events of accounts go to the handlers of the wallet
+	account := &Wallet{db: db, unit: cashu.Usd, parent: wallet}
+	account.emit(Event{Type: TokenReceived, Mint: mintURL, Amount: 10})
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events but got %v", len(events))
+	}
+	if events[2].Type != TokenReceived || events[2].Unit != cashu.Usd || events[2].Amount != 10 {
+		t.Fatalf("expected token received event for account but got %+v", events[2])
+	}
+
+	unsubscribe()
+	wallet.MintTokens("unknownquote")
+	if len(events) != 3 {
+		t.Fatalf("expected no events after unsubscribing but got %v", len(events))
+	}
+}
@@ -0,0 +1,93 @@
+package walletd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/wallet/walletd/walletrpc"
+)
+
+// events buffered for each subscriber. Subscribers that do not keep
+// up lose events instead of blocking the operations of the wallet.
+const eventsBufferSize = 64
+
+// eventBroker sends the events of the wallet to the subscribers of the gRPC stream
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan *walletrpc.Event]struct{}
+	// last balance seen to know when it changes
+	balance uint64
+	closed  bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[chan *walletrpc.Event]struct{})}
+}
+
+// subscribe returns a channel with the events published from now on.
+// The channel is closed when the broker is closed.
+func (b *eventBroker) subscribe() chan *walletrpc.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *walletrpc.Event, eventsBufferSize)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan *walletrpc.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends the events with the balance of the wallet after them.
+// A BALANCE_CHANGED event is added if the balance is not the last one seen.
+func (b *eventBroker) publish(balance uint64, events ...*walletrpc.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if balance != b.balance {
+		b.balance = balance
+		events = append(events, &walletrpc.Event{Type: walletrpc.EventType_BALANCE_CHANGED})
+	}
+
+	now := time.Now().Unix()
+	for _, event := range events {
+		event.Balance = balance
+		event.Timestamp = now
+		for ch := range b.subscribers {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+// setBalance sets the balance to compare against without publishing an event
+func (b *eventBroker) setBalance(balance uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balance = balance
+}
+
+// close ends the streams of the subscribers
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,197 @@
+package walletd
+
+import (
+	"context"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/walletd/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// rpcServer implements the gRPC interface of the daemon
+type rpcServer struct {
+	walletrpc.UnimplementedWalletServer
+	s *Server
+}
+
+func (s *Server) setupGRPCServer(port int) {
+	s.grpcPort = port
+	s.grpcServer = grpc.NewServer(
+		grpc.UnaryInterceptor(func(
+			ctx context.Context,
+			req any,
+			info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler,
+		) (any, error) {
+			if err := s.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(
+			srv any,
+			stream grpc.ServerStream,
+			info *grpc.StreamServerInfo,
+			handler grpc.StreamHandler,
+		) error {
+			if err := s.authorize(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	walletrpc.RegisterWalletServer(s.grpcServer, &rpcServer{s: s})
+}
+
+// authorize checks the 'authorization' metadata of the request
+// in the same way as the Authorization header of the HTTP API
+func (s *Server) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := md.Get("authorization")
+	if len(authorization) == 0 || !s.validAuthorization(authorization[0]) {
+		return status.Error(codes.Unauthenticated, ErrUnauthorized.Error())
+	}
+	return nil
+}
+
+func (r *rpcServer) GetBalance(
+	ctx context.Context,
+	req *walletrpc.GetBalanceRequest,
+) (*walletrpc.BalanceResponse, error) {
+	response := &walletrpc.BalanceResponse{
+		Total:   r.s.wallet.GetBalance(),
+		Pending: r.s.wallet.PendingBalance(),
+	}
+	for mint, balance := range r.s.wallet.GetBalanceByMints() {
+		response.Mints = append(response.Mints, &walletrpc.MintBalance{Mint: mint, Balance: balance})
+	}
+	return response, nil
+}
+
+func (r *rpcServer) MintQuote(
+	ctx context.Context,
+	req *walletrpc.MintQuoteRequest,
+) (*walletrpc.MintQuoteResponse, error) {
+	quote, err := r.s.wallet.RequestMint(req.Amount, r.s.mintOrDefault(req.Mint))
+	if err != nil {
+		return nil, err
+	}
+	return &walletrpc.MintQuoteResponse{
+		Quote:   quote.Quote,
+		Request: quote.Request,
+		State:   quote.State.String(),
+		Expiry:  quote.Expiry,
+	}, nil
+}
+
+func (r *rpcServer) Mint(ctx context.Context, req *walletrpc.MintRequest) (*walletrpc.AmountResponse, error) {
+	amount, err := r.s.wallet.MintTokens(req.Quote)
+	if err != nil {
+		return nil, err
+	}
+	r.s.notifyMinted(req.Quote, amount)
+	return &walletrpc.AmountResponse{Amount: amount}, nil
+}
+
+func (r *rpcServer) Send(ctx context.Context, req *walletrpc.SendRequest) (*walletrpc.SendResponse, error) {
+	mint := r.s.mintOrDefault(req.Mint)
+	proofs, err := r.s.wallet.Send(req.Amount, mint, !req.NoFees)
+	if err != nil {
+		return nil, err
+	}
+	r.s.notify()
+
+	token, err := cashu.NewTokenV4(proofs, mint, r.s.wallet.Unit(), false)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	tokenstr, err := token.Serialize()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &walletrpc.SendResponse{Token: tokenstr}, nil
+}
+
+func (r *rpcServer) Receive(ctx context.Context, req *walletrpc.ReceiveRequest) (*walletrpc.AmountResponse, error) {
+	if len(req.Token) < 6 {
+		return nil, status.Error(codes.InvalidArgument, "invalid token")
+	}
+	token, err := cashu.DecodeToken(req.Token)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	amount, err := r.s.wallet.Receive(token, req.SwapToTrusted)
+	if err != nil {
+		return nil, err
+	}
+	r.s.notify(&walletrpc.Event{Type: walletrpc.EventType_TOKEN_RECEIVED, Amount: amount, Mint: token.Mint()})
+	return &walletrpc.AmountResponse{Amount: amount}, nil
+}
+
+func (r *rpcServer) Melt(ctx context.Context, req *walletrpc.MeltRequest) (*walletrpc.MeltResponse, error) {
+	mint := r.s.mintOrDefault(req.Mint)
+	quote, err := r.s.wallet.RequestMeltQuote(req.Invoice, mint)
+	if err != nil {
+		return nil, err
+	}
+
+	meltResponse, err := r.s.wallet.Melt(quote.Quote)
+	if err != nil {
+		return nil, err
+	}
+	r.s.notifyMelt(meltResponse, mint)
+
+	return &walletrpc.MeltResponse{
+		Quote:      meltResponse.Quote,
+		State:      meltResponse.State.String(),
+		Amount:     meltResponse.Amount,
+		FeeReserve: meltResponse.FeeReserve,
+		Preimage:   meltResponse.Preimage,
+	}, nil
+}
+
+// SubscribeEvents streams the events until the client cancels the
+// subscription or the daemon shuts down
+func (r *rpcServer) SubscribeEvents(
+	req *walletrpc.SubscribeEventsRequest,
+	stream walletrpc.Wallet_SubscribeEventsServer,
+) error {
+	events := r.s.events.subscribe()
+	defer r.s.events.unsubscribe(events)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// AuthCredentials returns the per-RPC credentials that clients of the gRPC
+// interface need to pass with grpc.WithPerRPCCredentials. Since the daemon
+// only listens on localhost, they are allowed without transport security.
+func AuthCredentials(token string) credentials.PerRPCCredentials {
+	return bearerToken(token)
+}
+
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
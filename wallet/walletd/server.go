@@ -0,0 +1,445 @@
+// Package walletd exposes a wallet through a local HTTP API, and optionally
+// gRPC, so that other applications can use it without linking the wallet package.
+package walletd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet"
+	"github.com/elnosh/gonuts/wallet/walletd/walletrpc"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+)
+
+const (
+	// 1MB
+	REQUEST_BODY_SIZE_LIMIT = 1024 * 1024
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrInvalidBody  = errors.New("invalid request body")
+)
+
+type ServerConfig struct {
+	Port int
+	// token that requests need to pass in the Authorization header
+	// as 'Bearer <token>'
+	AuthToken string
+	// port for the gRPC interface. It is not served if 0
+	GRPCPort int
+}
+
+type Server struct {
+	httpServer *http.Server
+	grpcServer *grpc.Server
+	grpcPort   int
+	wallet     *wallet.Wallet
+	authToken  string
+	events     *eventBroker
+}
+
+func SetupServer(w *wallet.Wallet, config ServerConfig) (*Server, error) {
+	if len(config.AuthToken) == 0 {
+		return nil, errors.New("auth token cannot be empty")
+	}
+
+	server := &Server{
+		wallet:    w,
+		authToken: config.AuthToken,
+		events:    newEventBroker(),
+	}
+	server.setupHttpServer(config.Port)
+	if config.GRPCPort > 0 {
+		server.setupGRPCServer(config.GRPCPort)
+	}
+	return server, nil
+}
+
+func (s *Server) Start() error {
+	s.events.setBalance(s.wallet.GetBalance())
+
+	if s.grpcServer != nil {
+		// only listen on localhost for the same reason as the HTTP API
+		listener, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(s.grpcPort))
+		if err != nil {
+			return err
+		}
+		go s.grpcServer.Serve(listener)
+	}
+
+	err := s.httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown() error {
+	// end the event streams so that the gRPC server can stop gracefully
+	s.events.close()
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+	}
+	return s.httpServer.Shutdown(context.Background())
+}
+
+func (s *Server) setupHttpServer(port int) {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/v1/balance", s.getBalance).Methods(http.MethodGet)
+	r.HandleFunc("/v1/mint/quote", s.mintQuote).Methods(http.MethodPost)
+	r.HandleFunc("/v1/mint", s.mintTokens).Methods(http.MethodPost)
+	r.HandleFunc("/v1/send", s.send).Methods(http.MethodPost)
+	r.HandleFunc("/v1/receive", s.receive).Methods(http.MethodPost)
+	r.HandleFunc("/v1/melt", s.melt).Methods(http.MethodPost)
+	r.HandleFunc("/v1/history", s.history).Methods(http.MethodGet)
+
+	// only listen on localhost since the API can spend the funds in the wallet.
+	// authenticate wraps the router instead of being a mux middleware so that
+	// requests are rejected even if they do not match a route
+	s.httpServer = &http.Server{
+		Addr:    "127.0.0.1:" + strconv.Itoa(port),
+		Handler: s.authenticate(r),
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+
+		if !s.validAuthorization(req.Header.Get("Authorization")) {
+			writeErr(rw, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// validAuthorization checks the authorization is 'Bearer <token>' with the auth token
+func (s *Server) validAuthorization(authorization string) bool {
+	token, found := strings.CutPrefix(authorization, "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(s.authToken)) == 1
+}
+
+// notify publishes the events to the gRPC subscribers
+// along with a balance change if there was one
+func (s *Server) notify(events ...*walletrpc.Event) {
+	s.events.publish(s.wallet.GetBalance(), events...)
+}
+
+func (s *Server) notifyMinted(quoteId string, amount uint64) {
+	event := &walletrpc.Event{Type: walletrpc.EventType_MINT_QUOTE_SETTLED, Amount: amount, Quote: quoteId}
+	if quote := s.wallet.GetMintQuoteById(quoteId); quote != nil {
+		event.Mint = quote.Mint
+	}
+	s.notify(event)
+}
+
+func (s *Server) notifyMelt(meltResponse *nut05.PostMeltQuoteBolt11Response, mint string) {
+	if meltResponse.State != nut05.Paid {
+		s.notify()
+		return
+	}
+	s.notify(&walletrpc.Event{
+		Type:   walletrpc.EventType_MELT_QUOTE_SETTLED,
+		Amount: meltResponse.Amount,
+		Mint:   mint,
+		Quote:  meltResponse.Quote,
+	})
+}
+
+// NotifySync publishes the events for the quotes settled in
+// a sync of the wallet, such as the one started with StartSync
+func (s *Server) NotifySync(report *wallet.SyncReport) {
+	if report == nil {
+		return
+	}
+
+	var events []*walletrpc.Event
+	for _, quoteId := range report.MintedQuotes {
+		event := &walletrpc.Event{Type: walletrpc.EventType_MINT_QUOTE_SETTLED, Quote: quoteId}
+		if quote := s.wallet.GetMintQuoteById(quoteId); quote != nil {
+			event.Amount = quote.Amount
+			event.Mint = quote.Mint
+		}
+		events = append(events, event)
+	}
+	for _, quoteId := range report.MeltsPaid {
+		event := &walletrpc.Event{Type: walletrpc.EventType_MELT_QUOTE_SETTLED, Quote: quoteId}
+		for _, quote := range s.wallet.GetMeltQuotes() {
+			if quote.QuoteId == quoteId {
+				event.Amount = quote.Amount
+				event.Mint = quote.Mint
+				break
+			}
+		}
+		events = append(events, event)
+	}
+	s.notify(events...)
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeErr(rw http.ResponseWriter, code int, err error) {
+	rw.WriteHeader(code)
+	errRes, _ := json.Marshal(ErrorResponse{Error: err.Error()})
+	rw.Write(errRes)
+}
+
+func writeJSON(rw http.ResponseWriter, v any) {
+	jsonRes, err := json.Marshal(v)
+	if err != nil {
+		writeErr(rw, http.StatusInternalServerError, err)
+		return
+	}
+	rw.Write(jsonRes)
+}
+
+func decodeBody(req *http.Request, v any) error {
+	body := http.MaxBytesReader(nil, req.Body, REQUEST_BODY_SIZE_LIMIT)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return ErrInvalidBody
+	}
+	return nil
+}
+
+// mintOrDefault returns the mint passed in the request
+// or the default mint of the wallet if empty
+func (s *Server) mintOrDefault(mint string) string {
+	if len(mint) == 0 {
+		return s.wallet.CurrentMint()
+	}
+	return mint
+}
+
+type BalanceResponse struct {
+	Total   uint64            `json:"total"`
+	Pending uint64            `json:"pending"`
+	Mints   map[string]uint64 `json:"mints"`
+}
+
+func (s *Server) getBalance(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, BalanceResponse{
+		Total:   s.wallet.GetBalance(),
+		Pending: s.wallet.PendingBalance(),
+		Mints:   s.wallet.GetBalanceByMints(),
+	})
+}
+
+type MintQuoteRequest struct {
+	Amount uint64 `json:"amount"`
+	Mint   string `json:"mint,omitempty"`
+}
+
+func (s *Server) mintQuote(rw http.ResponseWriter, req *http.Request) {
+	var request MintQuoteRequest
+	if err := decodeBody(req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	quote, err := s.wallet.RequestMint(request.Amount, s.mintOrDefault(request.Mint))
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(rw, quote)
+}
+
+type MintRequest struct {
+	Quote string `json:"quote"`
+}
+
+type AmountResponse struct {
+	Amount uint64 `json:"amount"`
+}
+
+func (s *Server) mintTokens(rw http.ResponseWriter, req *http.Request) {
+	var request MintRequest
+	if err := decodeBody(req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	amount, err := s.wallet.MintTokens(request.Quote)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	s.notifyMinted(request.Quote, amount)
+	writeJSON(rw, AmountResponse{Amount: amount})
+}
+
+type SendRequest struct {
+	Amount uint64 `json:"amount"`
+	Mint   string `json:"mint,omitempty"`
+	// if true, fees to redeem the token are paid by the receiver
+	NoFees bool `json:"no_fees,omitempty"`
+}
+
+type SendResponse struct {
+	Token string `json:"token"`
+}
+
+func (s *Server) send(rw http.ResponseWriter, req *http.Request) {
+	var request SendRequest
+	if err := decodeBody(req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	mint := s.mintOrDefault(request.Mint)
+	proofs, err := s.wallet.Send(request.Amount, mint, !request.NoFees)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	s.notify()
+
+	token, err := cashu.NewTokenV4(proofs, mint, s.wallet.Unit(), false)
+	if err != nil {
+		writeErr(rw, http.StatusInternalServerError, err)
+		return
+	}
+	tokenstr, err := token.Serialize()
+	if err != nil {
+		writeErr(rw, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(rw, SendResponse{Token: tokenstr})
+}
+
+type ReceiveRequest struct {
+	Token         string `json:"token"`
+	SwapToTrusted bool   `json:"swap_to_trusted,omitempty"`
+}
+
+func (s *Server) receive(rw http.ResponseWriter, req *http.Request) {
+	var request ReceiveRequest
+	if err := decodeBody(req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(request.Token) < 6 {
+		writeErr(rw, http.StatusBadRequest, errors.New("invalid token"))
+		return
+	}
+	token, err := cashu.DecodeToken(request.Token)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	amount, err := s.wallet.Receive(token, request.SwapToTrusted)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	s.notify(&walletrpc.Event{Type: walletrpc.EventType_TOKEN_RECEIVED, Amount: amount, Mint: token.Mint()})
+	writeJSON(rw, AmountResponse{Amount: amount})
+}
+
+type MeltRequest struct {
+	Invoice string `json:"invoice"`
+	Mint    string `json:"mint,omitempty"`
+}
+
+func (s *Server) melt(rw http.ResponseWriter, req *http.Request) {
+	var request MeltRequest
+	if err := decodeBody(req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	mint := s.mintOrDefault(request.Mint)
+	quote, err := s.wallet.RequestMeltQuote(request.Invoice, mint)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	meltResponse, err := s.wallet.Melt(quote.Quote)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	s.notifyMelt(meltResponse, mint)
+	writeJSON(rw, meltResponse)
+}
+
+type MintQuoteEntry struct {
+	Quote          string `json:"quote"`
+	Mint           string `json:"mint"`
+	State          string `json:"state"`
+	PaymentRequest string `json:"request"`
+	Amount         uint64 `json:"amount"`
+	CreatedAt      int64  `json:"created_at"`
+	SettledAt      int64  `json:"settled_at,omitempty"`
+}
+
+type MeltQuoteEntry struct {
+	Quote          string `json:"quote"`
+	Mint           string `json:"mint"`
+	State          string `json:"state"`
+	PaymentRequest string `json:"request"`
+	Amount         uint64 `json:"amount"`
+	FeeReserve     uint64 `json:"fee_reserve"`
+	Preimage       string `json:"payment_preimage,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	SettledAt      int64  `json:"settled_at,omitempty"`
+}
+
+type HistoryResponse struct {
+	MintQuotes []MintQuoteEntry `json:"mint_quotes"`
+	MeltQuotes []MeltQuoteEntry `json:"melt_quotes"`
+}
+
+func (s *Server) history(rw http.ResponseWriter, req *http.Request) {
+	mintQuotes := s.wallet.GetMintQuotes()
+	meltQuotes := s.wallet.GetMeltQuotes()
+
+	history := HistoryResponse{
+		MintQuotes: make([]MintQuoteEntry, len(mintQuotes)),
+		MeltQuotes: make([]MeltQuoteEntry, len(meltQuotes)),
+	}
+	for i, quote := range mintQuotes {
+		history.MintQuotes[i] = MintQuoteEntry{
+			Quote:          quote.QuoteId,
+			Mint:           quote.Mint,
+			State:          quote.State.String(),
+			PaymentRequest: quote.PaymentRequest,
+			Amount:         quote.Amount,
+			CreatedAt:      quote.CreatedAt,
+			SettledAt:      quote.SettledAt,
+		}
+	}
+	for i, quote := range meltQuotes {
+		history.MeltQuotes[i] = MeltQuoteEntry{
+			Quote:          quote.QuoteId,
+			Mint:           quote.Mint,
+			State:          quote.State.String(),
+			PaymentRequest: quote.PaymentRequest,
+			Amount:         quote.Amount,
+			FeeReserve:     quote.FeeReserve,
+			Preimage:       quote.Preimage,
+			CreatedAt:      quote.CreatedAt,
+			SettledAt:      quote.SettledAt,
+		}
+	}
+
+	writeJSON(rw, history)
+}
@@ -0,0 +1,142 @@
+package walletd
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/wallet/walletd/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSetupServerNoToken(t *testing.T) {
+	_, err := SetupServer(nil, ServerConfig{Port: 8080})
+	if err == nil {
+		t.Fatal("expected error setting up server without auth token")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server, err := SetupServer(nil, ServerConfig{Port: 8080, AuthToken: "secrettoken"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		authorization string
+		expectedCode  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secrettoken", http.StatusUnauthorized},
+		{"Bearer wrongtoken", http.StatusUnauthorized},
+		// authenticated requests get to the router, which
+		// rejects the wrong method before reaching the wallet
+		{"Bearer secrettoken", http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/balance", nil)
+		if len(test.authorization) > 0 {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		rec := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedCode {
+			t.Fatalf("expected status code %v for authorization '%v' but got %v",
+				test.expectedCode, test.authorization, rec.Code)
+		}
+	}
+}
+
+func TestGRPCEvents(t *testing.T) {
+	server, err := SetupServer(nil, ServerConfig{Port: 8080, AuthToken: "secrettoken", GRPCPort: 8081})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	go server.grpcServer.Serve(listener)
+	defer server.grpcServer.Stop()
+
+	dial := func(opts ...grpc.DialOption) walletrpc.WalletClient {
+		opts = append(opts,
+			grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return walletrpc.NewWalletClient(conn)
+	}
+
+	// requests without the token are rejected before reaching the wallet
+	noAuthClient := dial()
+	_, err = noAuthClient.GetBalance(context.Background(), &walletrpc.GetBalanceRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected code '%v' but got '%v'", codes.Unauthenticated, status.Code(err))
+	}
+	wrongAuthClient := dial(grpc.WithPerRPCCredentials(AuthCredentials("wrongtoken")))
+	stream, err := wrongAuthClient.SubscribeEvents(context.Background(), &walletrpc.SubscribeEventsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected code '%v' but got '%v'", codes.Unauthenticated, status.Code(err))
+	}
+
+	client := dial(grpc.WithPerRPCCredentials(AuthCredentials("secrettoken")))
+	stream, err = client.SubscribeEvents(context.Background(), &walletrpc.SubscribeEventsRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+	// wait for the subscription to be registered
+	for i := 0; ; i++ {
+		server.events.mu.Lock()
+		subscribed := len(server.events.subscribers) > 0
+		server.events.mu.Unlock()
+		if subscribed {
+			break
+		}
+		if i > 100 {
+			t.Fatal("subscription was not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server.events.publish(21, &walletrpc.Event{Type: walletrpc.EventType_TOKEN_RECEIVED, Amount: 21})
+	// same balance does not send a balance change
+	server.events.publish(21)
+
+	expectedEvents := []walletrpc.EventType{walletrpc.EventType_TOKEN_RECEIVED, walletrpc.EventType_BALANCE_CHANGED}
+	for _, expected := range expectedEvents {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("unexpected error receiving event: %v", err)
+		}
+		if event.Type != expected {
+			t.Fatalf("expected event '%v' but got '%v'", expected, event.Type)
+		}
+		if event.Balance != 21 {
+			t.Fatalf("expected balance of 21 but got %v", event.Balance)
+		}
+	}
+
+	// stream ends when the daemon shuts down
+	server.events.close()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("expected end of stream but got '%v'", err)
+	}
+}